@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// PermissionsResponse is the JSON envelope returned by GetPermissions.
+type PermissionsResponse struct {
+	OK      bool                  `json:"ok"`
+	Missing []string              `json:"missing"`
+	Checks  []k8s.PermissionCheck `json:"checks"`
+}
+
+// GetPermissions handles GET /admin/permissions — reports, for every
+// operation the service relies on, whether its service account is allowed to
+// perform it.
+func (h *Handler) GetPermissions(w http.ResponseWriter, r *http.Request) {
+	checks, err := h.k8sManager.CheckPermissions(r.Context())
+	if err != nil {
+		logf(r, "GetPermissions error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to check permissions")
+		return
+	}
+
+	resp := PermissionsResponse{OK: true, Missing: []string{}, Checks: checks}
+	for _, c := range checks {
+		if !c.Allowed {
+			resp.OK = false
+			resp.Missing = append(resp.Missing, c.String())
+		}
+	}
+
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// GetCapacity handles GET /admin/capacity — reports namespace usage against
+// the configured capacity ceilings.
+func (h *Handler) GetCapacity(w http.ResponseWriter, r *http.Request) {
+	report, err := h.k8sManager.Capacity(r.Context())
+	if err != nil {
+		logf(r, "GetCapacity error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to compute capacity")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, report)
+}
+
+// ProfilesResponse is the JSON envelope returned by GetProfiles.
+type ProfilesResponse struct {
+	Default  string         `json:"default,omitempty"`
+	Profiles []*k8s.Profile `json:"profiles"`
+}
+
+// GetProfiles handles GET /admin/profiles — lists the provisioning profiles a
+// create request may select.
+func (h *Handler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	resp := ProfilesResponse{Default: h.cfg.DefaultProfile, Profiles: []*k8s.Profile{}}
+	for _, name := range k8s.ProfileNames(h.profiles) {
+		resp.Profiles = append(resp.Profiles, h.profiles[name])
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/aibudget"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/tenantauth"
+)
+
+// AIUsageRequest is the body of POST /admin/ai-usage, sent by the egress
+// proxy on behalf of a tenant.
+type AIUsageRequest struct {
+	TenantID string `json:"tenant_id"`
+	aibudget.Report
+}
+
+// RecordSelfAIUsage handles POST /self/instance/ai-usage — an instance
+// reports the AI usage it has made since its last report, and learns whether
+// it is throttled.
+func (h *Handler) RecordSelfAIUsage(w http.ResponseWriter, r *http.Request) {
+	if h.aiBudget == nil {
+		writeError(w, http.StatusNotImplemented, "AI usage tracking is not configured")
+		return
+	}
+	var rep aibudget.Report
+	if err := json.NewDecoder(r.Body).Decode(&rep); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	h.recordAIUsage(w, r, tenantauth.FromContext(r.Context()), rep)
+}
+
+// RecordAIUsage handles POST /admin/ai-usage — the egress proxy reports AI
+// usage it has seen for a tenant.
+func (h *Handler) RecordAIUsage(w http.ResponseWriter, r *http.Request) {
+	if h.aiBudget == nil {
+		writeError(w, http.StatusNotImplemented, "AI usage tracking is not configured")
+		return
+	}
+	var req AIUsageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	id, err := tenant.Parse(req.TenantID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tenant ID: "+err.Error())
+		return
+	}
+	req.TenantID = id.String()
+	h.recordAIUsage(w, r, req.TenantID, req.Report)
+}
+
+// recordAIUsage records rep for the tenant and writes its budget status.
+func (h *Handler) recordAIUsage(w http.ResponseWriter, r *http.Request, id string, rep aibudget.Report) {
+	st, err := h.aiBudget.Record(r.Context(), id, rep)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// GetSelfAIBudget handles GET /self/instance/ai-budget — the caller's AI
+// usage against its budget this month.
+func (h *Handler) GetSelfAIBudget(w http.ResponseWriter, r *http.Request) {
+	if h.aiBudget == nil {
+		writeError(w, http.StatusNotImplemented, "AI usage tracking is not configured")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.aiBudget.Status(tenantauth.FromContext(r.Context())))
+}
+
+// ListAIBudgets handles GET /admin/ai-budgets — every tenant with AI usage
+// this month against its budget, most used first.
+func (h *Handler) ListAIBudgets(w http.ResponseWriter, r *http.Request) {
+	if h.aiBudget == nil {
+		writeError(w, http.StatusNotImplemented, "AI usage tracking is not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.aiBudget.Statuses())
+}
+
+// GetAIBudget handles GET /admin/ai-budgets/{tenant-id} — one tenant's AI
+// usage against its budget this month.
+func (h *Handler) GetAIBudget(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.aiBudget == nil {
+		writeError(w, http.StatusNotImplemented, "AI usage tracking is not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.aiBudget.Status(id))
+}
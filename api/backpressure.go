@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// shedCapacityTTL is how long a capacity report is reused by the
+// load-shedding check, so that a burst of creates lists the namespace once.
+const shedCapacityTTL = 10 * time.Second
+
+// BackpressureResponse is the JSON body of a create refused with 429 because
+// the service is saturated. Reason is "queue_saturated" or
+// "capacity_saturated"; the client should retry after RetryAfterSeconds,
+// which the Retry-After header repeats.
+type BackpressureResponse struct {
+	Error             string  `json:"error"`
+	Reason            string  `json:"reason"`
+	RetryAfterSeconds int     `json:"retry_after_seconds"`
+	QueueDepth        int     `json:"queue_depth,omitempty"`
+	Resource          string  `json:"resource,omitempty"` // The saturated capacity dimension
+	Ratio             float64 `json:"ratio,omitempty"`
+	CorrelationID     string  `json:"correlation_id,omitempty"`
+}
+
+// admitCreate sheds a create while the work queue is SHED_QUEUE_DEPTH deep or
+// a capacity ceiling is SHED_CAPACITY_RATIO used, writing a 429 with
+// Retry-After, and returns false. A failure to read capacity admits the
+// create, whose own capacity check still applies.
+func (h *Handler) admitCreate(w http.ResponseWriter, r *http.Request, id string) bool {
+	resp := BackpressureResponse{CorrelationID: w.Header().Get(correlation.Header)}
+	retry := h.cfg.ShedRetryAfter
+
+	switch {
+	case h.cfg.ShedQueueDepth > 0 && h.workQueue != nil && h.workQueue.Depth() >= h.cfg.ShedQueueDepth:
+		resp.Reason = "queue_saturated"
+		resp.QueueDepth = h.workQueue.Depth()
+		resp.Error = fmt.Sprintf("provisioning queue is full (%d operations waiting); retry later", resp.QueueDepth)
+		retry = max(retry, h.workQueue.EstimatedWait())
+	default:
+		ru, ok := h.saturatedCapacity(r)
+		if !ok {
+			return true
+		}
+		resp.Reason = "capacity_saturated"
+		resp.Resource = ru.Resource
+		resp.Ratio = math.Round(ru.Ratio*1000) / 1000
+		resp.Error = fmt.Sprintf("cluster capacity is nearly exhausted (%s at %.0f%% of %s); retry later", ru.Resource, ru.Ratio*100, ru.Limit)
+	}
+
+	resp.RetryAfterSeconds = int(math.Ceil(retry.Seconds()))
+	logf(r, "CreateInstance shed: tenant=%s reason=%s retry_after=%ds", id, resp.Reason, resp.RetryAfterSeconds)
+	w.Header().Set("Retry-After", strconv.Itoa(resp.RetryAfterSeconds))
+	writeJSON(w, http.StatusTooManyRequests, resp)
+	return false
+}
+
+// saturatedCapacity returns the first capacity dimension used to
+// SHED_CAPACITY_RATIO or more, from a report at most shedCapacityTTL old.
+func (h *Handler) saturatedCapacity(r *http.Request) (k8s.ResourceUsage, bool) {
+	if h.cfg.ShedCapacityRatio <= 0 {
+		return k8s.ResourceUsage{}, false
+	}
+	h.shedMu.Lock()
+	defer h.shedMu.Unlock()
+	if h.shedCapacity == nil || time.Since(h.shedCheckAt) > shedCapacityTTL {
+		report, err := h.k8sManager.Capacity(r.Context())
+		if err != nil {
+			logf(r, "CreateInstance: load-shedding capacity check failed: %v", err)
+			return k8s.ResourceUsage{}, false
+		}
+		h.shedCapacity, h.shedCheckAt = report, time.Now()
+	}
+	for _, ru := range h.shedCapacity.Resources {
+		if ru.Limit != "" && ru.Ratio >= h.cfg.ShedCapacityRatio {
+			return ru, true
+		}
+	}
+	return k8s.ResourceUsage{}, false
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/billing"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+)
+
+// billingSignatureTolerance is how far the timestamp of a signed billing
+// event may be from the current time, to refuse replayed requests.
+const billingSignatureTolerance = 5 * time.Minute
+
+// BillingEventResponse reports what a billing event did.
+type BillingEventResponse struct {
+	TenantID string `json:"tenant_id"`
+	Type     string `json:"type"`
+	Outcome  string `json:"outcome"` // "opened", "open", "resolved" or "ignored"
+}
+
+// HandleBillingEvent handles POST /billing/events — the billing system
+// reports a payment_failed, subscription_canceled, payment_succeeded or
+// subscription_reactivated event for a tenant. The request is signed like
+// outbound webhooks, with BILLING_WEBHOOK_SECRET: X-Billing-Signature is
+// "sha256=" and the hex HMAC-SHA256 of "<X-Billing-Timestamp>.<body>".
+// Events of other types are acknowledged and ignored.
+func (h *Handler) HandleBillingEvent(w http.ResponseWriter, r *http.Request) {
+	if h.billing == nil {
+		writeError(w, http.StatusNotImplemented, "billing events are not configured")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !validBillingSignature(h.cfg.BillingWebhookSecret, r.Header, body, time.Now()) {
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+	var ev billing.Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	id, err := tenant.Parse(ev.TenantID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tenant ID: "+err.Error())
+		return
+	}
+	ev.TenantID = id.String()
+
+	outcome, err := h.billing.Handle(r.Context(), ev)
+	if err != nil {
+		h.recordAudit(r, "billing.event", ev.TenantID, "event="+ev.Type, err)
+		logf(r, "HandleBillingEvent error: tenant=%s event=%s err=%v", ev.TenantID, ev.Type, err)
+		reportError(r, ev.TenantID, err)
+		writeError(w, http.StatusInternalServerError, "failed to handle billing event")
+		return
+	}
+	if outcome != billing.OutcomeIgnored {
+		h.recordAudit(r, "billing.event", ev.TenantID, "event="+ev.Type+" event_id="+ev.ID+" outcome="+outcome, nil)
+	}
+	writeJSON(w, http.StatusOK, BillingEventResponse{TenantID: ev.TenantID, Type: ev.Type, Outcome: outcome})
+}
+
+// validBillingSignature reports whether header signs body with secret at a
+// time within billingSignatureTolerance of now.
+func validBillingSignature(secret string, header http.Header, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(header.Get("X-Billing-Timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > billingSignatureTolerance || d < -billingSignatureTolerance {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(header.Get("X-Billing-Signature"), "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// ListBillingCases handles GET /admin/billing/cases — every open billing
+// case with the actions taken on it, oldest first.
+func (h *Handler) ListBillingCases(w http.ResponseWriter, r *http.Request) {
+	if h.billing == nil {
+		writeError(w, http.StatusNotImplemented, "billing events are not configured")
+		return
+	}
+	cases, err := h.billing.Cases()
+	if err != nil {
+		logf(r, "ListBillingCases error: err=%v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read billing cases")
+		return
+	}
+	if cases == nil {
+		cases = []registry.BillingCase{}
+	}
+	writeResponse(w, r, http.StatusOK, cases)
+}
+
+// GetBillingCases handles GET /admin/billing/cases/{tenant-id} — the
+// tenant's open billing cases.
+func (h *Handler) GetBillingCases(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.billing == nil {
+		writeError(w, http.StatusNotImplemented, "billing events are not configured")
+		return
+	}
+	cases, err := h.billing.TenantCases(id)
+	if err != nil {
+		logf(r, "GetBillingCases error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read billing cases")
+		return
+	}
+	if cases == nil {
+		cases = []registry.BillingCase{}
+	}
+	writeResponse(w, r, http.StatusOK, cases)
+}
+
+// ResolveBillingCases handles DELETE /admin/billing/cases/{tenant-id} —
+// closes the tenant's open billing cases, as if the billing system had
+// reported them resolved, and resumes instances they suspended. For
+// problems settled outside the billing system.
+func (h *Handler) ResolveBillingCases(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.billing == nil {
+		writeError(w, http.StatusNotImplemented, "billing events are not configured")
+		return
+	}
+	n, err := h.billing.Resolve(r.Context(), id, "resolved by an admin")
+	h.recordAudit(r, "billing.cases.resolve", id, "", err)
+	if err != nil {
+		logf(r, "ResolveBillingCases error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to resolve billing cases")
+		return
+	}
+	if n == 0 {
+		writeError(w, http.StatusNotFound, "tenant has no open billing cases")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestValidBillingSignature(t *testing.T) {
+	const (
+		secret = "whsec_test"
+		ts     = "1767225600" // 2026-01-01T00:00:00Z
+		// HMAC-SHA256 of ts + "." + body under secret.
+		sig = "2cb25bd8edd66ffa0277ad0c15203665a937085d25212a5f240e7fb73b1a2935"
+	)
+	body := []byte(`{"id":"evt_1","type":"payment_failed"}`)
+	signedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		now       time.Time
+		want      bool
+	}{
+		{"valid", secret, ts, "sha256=" + sig, body, signedAt, true},
+		{"valid without prefix", secret, ts, sig, body, signedAt, true},
+		{"within tolerance", secret, ts, "sha256=" + sig, body, signedAt.Add(billingSignatureTolerance), true},
+		{"too old", secret, ts, "sha256=" + sig, body, signedAt.Add(billingSignatureTolerance + time.Second), false},
+		{"too far ahead", secret, ts, "sha256=" + sig, body, signedAt.Add(-billingSignatureTolerance - time.Second), false},
+		{"wrong secret", "whsec_other", ts, "sha256=" + sig, body, signedAt, false},
+		{"altered body", secret, ts, "sha256=" + sig, []byte(`{"id":"evt_1","type":"payment_succeeded"}`), signedAt, false},
+		{"timestamp not signed", secret, "1767225601", "sha256=" + sig, body, signedAt, false},
+		{"non-numeric timestamp", secret, "yesterday", "sha256=" + sig, body, signedAt, false},
+		{"missing timestamp", secret, "", "sha256=" + sig, body, signedAt, false},
+		{"signature not hex", secret, ts, "sha256=zz", body, signedAt, false},
+		{"missing signature", secret, ts, "", body, signedAt, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.timestamp != "" {
+				header.Set("X-Billing-Timestamp", tt.timestamp)
+			}
+			if tt.signature != "" {
+				header.Set("X-Billing-Signature", tt.signature)
+			}
+			if got := validBillingSignature(tt.secret, header, tt.body, tt.now); got != tt.want {
+				t.Errorf("validBillingSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// Bounds on branding values.
+const (
+	maxProductNameLength = 64
+	maxLogoURLLength     = 2048
+)
+
+// themeColorRe matches a #RRGGBB color.
+var themeColorRe = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+
+// BrandingRequest is the white-label branding accepted at creation. Omitted
+// fields keep OpenClaw's own.
+type BrandingRequest struct {
+	ProductName string `json:"product_name"` // e.g. "Acme Assistant"
+	LogoURL     string `json:"logo_url"`     // https URL of the logo image
+	ThemeColor  string `json:"theme_color"`  // e.g. "#0a66c2"
+}
+
+// branding validates req and converts it, returning nil for a nil or empty
+// req.
+func (req *BrandingRequest) branding() (*k8s.Branding, error) {
+	if req == nil || *req == (BrandingRequest{}) {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(req.ProductName) > maxProductNameLength || strings.IndexFunc(req.ProductName, unicode.IsControl) >= 0 {
+		return nil, errors.New("invalid branding.product_name: must be at most 64 characters, without control characters")
+	}
+	if req.LogoURL != "" {
+		u, err := url.Parse(req.LogoURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" || len(req.LogoURL) > maxLogoURLLength {
+			return nil, errors.New("invalid branding.logo_url: must be an https URL")
+		}
+	}
+	if req.ThemeColor != "" && !themeColorRe.MatchString(req.ThemeColor) {
+		return nil, errors.New("invalid branding.theme_color: must be a hex color such as #0a66c2")
+	}
+	return &k8s.Branding{
+		ProductName: strings.TrimSpace(req.ProductName),
+		LogoURL:     req.LogoURL,
+		ThemeColor:  strings.ToLower(req.ThemeColor),
+	}, nil
+}
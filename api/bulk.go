@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// imageTagPattern matches a valid container image tag.
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// BulkFilter selects instances for a bulk operation. Every set criterion must
+// match.
+type BulkFilter struct {
+	Tag         string `json:"tag,omitempty"`         // Label selector, e.g. "plan=trial" or "cohort"
+	Plan        string `json:"plan,omitempty"`        // Plan the instance was created with
+	Environment string `json:"environment,omitempty"` // "prod", "staging" or "dev"
+	Status      string `json:"status,omitempty"`      // e.g. "running" or "error"
+	OlderThan   string `json:"older_than,omitempty"`  // Minimum age, e.g. "720h"
+}
+
+// BulkRequest is the JSON body accepted by BulkInstances.
+type BulkRequest struct {
+	Filter   BulkFilter `json:"filter"`
+	Action   string     `json:"action"`              // "delete", "suspend", "resume" or "upgrade"
+	ImageTag string     `json:"image_tag,omitempty"` // Required for "upgrade"
+	DryRun   bool       `json:"dry_run,omitempty"`   // List the matching instances without acting
+}
+
+// BulkPreview is the response to a dry-run BulkInstances request.
+type BulkPreview struct {
+	Action  string           `json:"action"`
+	Matched []workqueue.Item `json:"matched"`
+}
+
+// BulkInstances handles POST /admin/instances/bulk — applies an action to
+// every instance matching a filter. The work runs through the work queue; the
+// response is the batch, whose progress GetBulkBatch reports.
+func (h *Handler) BulkInstances(w http.ResponseWriter, r *http.Request) {
+	if h.workQueue == nil {
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	var fn func(context.Context, workqueue.Item) error
+	switch req.Action {
+	case "delete":
+		fn = func(ctx context.Context, it workqueue.Item) error {
+			if err := h.k8sManager.DeleteInstance(ctx, it.TenantID); err != nil {
+				return err
+			}
+			h.forgetTenant(it.TenantID)
+			return nil
+		}
+	case "suspend":
+		fn = func(ctx context.Context, it workqueue.Item) error {
+			return h.k8sManager.SuspendInstance(ctx, it.TenantID)
+		}
+	case "resume":
+		fn = func(ctx context.Context, it workqueue.Item) error {
+			return h.k8sManager.ResumeInstance(ctx, it.TenantID)
+		}
+	case "upgrade":
+		if !imageTagPattern.MatchString(req.ImageTag) {
+			writeError(w, http.StatusBadRequest, "upgrade requires a valid image_tag")
+			return
+		}
+		fn = func(ctx context.Context, it workqueue.Item) error {
+			return h.k8sManager.UpgradeInstance(ctx, it.TenantID, req.ImageTag)
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "action must be one of delete, suspend, resume or upgrade")
+		return
+	}
+
+	match, err := bulkMatcher(req.Filter)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	instances, err := h.k8sManager.ListInstances(r.Context())
+	if err != nil {
+		logf(r, "BulkInstances error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to list instances")
+		return
+	}
+	items := []workqueue.Item{}
+	now := time.Now()
+	for _, inst := range instances {
+		if match(inst, now) {
+			items = append(items, workqueue.Item{TenantID: inst.TenantID, Instance: inst.Info.Name})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Instance < items[j].Instance })
+
+	if req.DryRun {
+		writeResponse(w, r, http.StatusOK, BulkPreview{Action: req.Action, Matched: items})
+		return
+	}
+
+	batch := h.workQueue.Submit(req.Action, workqueue.PriorityBulk, items, fn)
+	h.recordAudit(r, "instances.bulk."+req.Action, "", fmt.Sprintf("batch=%s instances=%d", batch.ID, batch.Total), nil)
+	logf(r, "BulkInstances: batch=%s action=%s instances=%d", batch.ID, req.Action, batch.Total)
+	writeResponse(w, r, http.StatusAccepted, batch)
+}
+
+// GetBulkBatch handles GET /admin/instances/bulk/{batch-id} — reports the
+// progress of a bulk operation.
+func (h *Handler) GetBulkBatch(w http.ResponseWriter, r *http.Request) {
+	if h.workQueue == nil {
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+	batch, ok := h.workQueue.Get(chi.URLParam(r, "batch-id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, batch)
+}
+
+// bulkMatcher compiles f into a predicate. At least one criterion is required
+// so that a missing filter cannot select the whole fleet.
+func bulkMatcher(f BulkFilter) (func(k8s.ClusterInstance, time.Time) bool, error) {
+	if f.Tag == "" && f.Plan == "" && f.Environment == "" && f.Status == "" && f.OlderThan == "" {
+		return nil, fmt.Errorf("filter must set at least one of tag, plan, environment, status or older_than")
+	}
+	if f.Environment != "" && !k8s.ValidEnvironment(f.Environment) {
+		return nil, fmt.Errorf("invalid environment: must be one of prod, staging or dev")
+	}
+
+	selector := labels.Everything()
+	if f.Tag != "" {
+		s, err := labels.Parse(f.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag selector: %v", err)
+		}
+		selector = s
+	}
+	var minAge time.Duration
+	if f.OlderThan != "" {
+		d, err := time.ParseDuration(f.OlderThan)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid older_than: must be a positive duration such as 720h")
+		}
+		minAge = d
+	}
+
+	return func(inst k8s.ClusterInstance, now time.Time) bool {
+		if f.Plan != "" && inst.Info.Plan != f.Plan {
+			return false
+		}
+		if f.Environment != "" && inst.Info.Environment != f.Environment {
+			return false
+		}
+		if f.Status != "" && !strings.EqualFold(inst.Info.Status, f.Status) {
+			return false
+		}
+		if minAge > 0 && (inst.Info.CreatedAt.IsZero() || now.Sub(inst.Info.CreatedAt) < minAge) {
+			return false
+		}
+		if f.Tag != "" && (inst.Object == nil || !selector.Matches(labels.Set(inst.Object.GetLabels()))) {
+			return false
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/rollout"
+)
+
+// Capability reports whether this deployment supports an optional feature.
+// Reason explains an unsupported feature, or a supported one that could not
+// be verified.
+type Capability struct {
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// CapabilitiesResponse describes what this deployment supports, so that
+// clients can adapt instead of hardcoding one environment's feature set.
+type CapabilitiesResponse struct {
+	Domain         string                `json:"domain"`
+	Features       map[string]Capability `json:"features"`
+	Plans          []string              `json:"plans"`
+	Profiles       []string              `json:"profiles"`
+	DefaultProfile string                `json:"default_profile,omitempty"`
+	Channels       []string              `json:"channels"`
+	Environments   []string              `json:"environments"`
+	Locales        []string              `json:"locales"` // For a tenant contact's locale
+	DefaultLocale  string                `json:"default_locale"`
+}
+
+// GetCapabilities handles GET /capabilities — the optional features this
+// deployment supports, with the plans, profiles, release channels and
+// environments that creates may name, and the locales tenants can choose.
+func (h *Handler) GetCapabilities(w http.ResponseWriter, r *http.Request) {
+	caps, err := h.k8sManager.LifecycleCapabilities(r.Context())
+	if err != nil {
+		logf(r, "GetCapabilities error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to discover capabilities")
+		return
+	}
+
+	features := map[string]Capability{
+		"data_export":         configured(h.exportStore != nil, "no object storage is configured"),
+		"purge_certificates":  configured(h.certSigner != nil, "no deletion certificate signing key is configured"),
+		"retain_storage":      {Supported: true},
+		"multi_cluster":       configured(len(h.cfg.KubeContexts) > 1, "a single cluster is configured"),
+		"wildcard_tls":        configured(h.cfg.TLSWildcardSecret != "", "no wildcard certificate is configured"),
+		"custom_domains":      {Reason: "instances are only served under " + h.cfg.Domain},
+		"internal_domain":     configured(h.cfg.InternalDomain != "", "instances are not exposed under an internal domain"),
+		"health_checks":       configured(h.health != nil, "health probing is disabled"),
+		"rightsizing":         configured(h.rightsizing != nil, "right-sizing is disabled"),
+		"bulk_operations":     configured(h.workQueue != nil, "the work queue is not configured"),
+		"email_notifications": configured(h.cfg.NotifyProvider != "", "no email provider is configured"),
+		"billing_policies":    configured(h.billing != nil, "no billing webhook secret is configured"),
+		"tenant_self_service": {Supported: true},
+		"organizations":       configured(h.registry != nil, "organizations need the registry"),
+	}
+	for _, c := range caps {
+		features[c.Action] = Capability{Supported: c.Supported, Reason: c.Reason}
+	}
+
+	resp := CapabilitiesResponse{
+		Domain:         h.cfg.Domain,
+		Features:       features,
+		Plans:          []string{},
+		Profiles:       []string{},
+		DefaultProfile: h.cfg.DefaultProfile,
+		Channels:       rollout.Channels,
+		Environments:   k8s.Environments,
+		Locales:        h.locales,
+		DefaultLocale:  h.cfg.DefaultLocale,
+	}
+	plans := map[string]bool{}
+	for name, p := range h.profiles {
+		resp.Profiles = append(resp.Profiles, name)
+		if p.Plan != "" && !plans[p.Plan] {
+			plans[p.Plan] = true
+			resp.Plans = append(resp.Plans, p.Plan)
+		}
+	}
+	sort.Strings(resp.Profiles)
+	sort.Strings(resp.Plans)
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// configured reports a feature that is supported when ok, and otherwise not
+// for reason.
+func configured(ok bool, reason string) Capability {
+	if ok {
+		return Capability{Supported: true}
+	}
+	return Capability{Reason: reason}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// ListPendingCertificates handles GET /admin/certificates — lists instances
+// whose TLS certificate has not been issued yet, with the ACME error for
+// failed issuance and how many retries have been made.
+func (h *Handler) ListPendingCertificates(w http.ResponseWriter, r *http.Request) {
+	if h.certs == nil {
+		writeError(w, http.StatusNotImplemented, "certificate monitoring is not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.certs.Pending())
+}
+
+// RetryCertificate handles POST /admin/certificates/{tenant-id}/retry —
+// re-creates the tenant's certificate so that issuance starts again
+// immediately instead of after cert-manager's failure backoff.
+func (h *Handler) RetryCertificate(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+
+	err := h.k8sManager.RetryCertificate(r.Context(), id)
+	h.recordAudit(r, "certificate.retry", id, "", err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if err != nil {
+		logf(r, "RetryCertificate error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retry certificate")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
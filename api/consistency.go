@@ -0,0 +1,42 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// GetConsistency handles GET /admin/consistency — compares the registry with
+// the cluster and reports orphans, mismatches and tenants with more than one
+// instance. Nothing is repaired.
+func (h *Handler) GetConsistency(w http.ResponseWriter, r *http.Request) {
+	h.checkConsistency(w, r, false)
+}
+
+// RepairConsistency handles POST /admin/consistency/repair — runs the same
+// check and rewrites the registry from the cluster wherever they disagree.
+func (h *Handler) RepairConsistency(w http.ResponseWriter, r *http.Request) {
+	h.checkConsistency(w, r, true)
+}
+
+func (h *Handler) checkConsistency(w http.ResponseWriter, r *http.Request, repair bool) {
+	if h.consistency == nil {
+		writeError(w, http.StatusNotImplemented, "consistency checking is not configured")
+		return
+	}
+
+	report, err := h.consistency.Check(r.Context(), repair)
+	if repair {
+		detail := ""
+		if report != nil {
+			detail = fmt.Sprintf("repaired=%d", report.Repaired)
+		}
+		h.recordAudit(r, "consistency.repair", "", detail, err)
+	}
+	if err != nil {
+		logf(r, "consistency check error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusServiceUnavailable, "consistency check failed")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, report)
+}
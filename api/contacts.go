@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/locale"
+	"github.com/mchatman/tenant-provisioner/internal/notify"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// maxContactEmails caps the emails of a tenant's contact.
+const maxContactEmails = 10
+
+// ContactRequest is the body of PutContact. EmailEvents left out, or null,
+// receives every lifecycle email the deployment sends; Locale left out uses
+// DEFAULT_LOCALE.
+type ContactRequest struct {
+	Emails      []string `json:"emails"`
+	EmailEvents []string `json:"email_events"`
+	Locale      string   `json:"locale"`
+}
+
+// checkContactRequest returns what is wrong with req, or "".
+func checkContactRequest(req ContactRequest) string {
+	if len(req.Emails) > maxContactEmails {
+		return fmt.Sprintf("at most %d emails are allowed", maxContactEmails)
+	}
+	for _, e := range req.Emails {
+		addr, err := mail.ParseAddress(e)
+		if err != nil || addr.Name != "" {
+			return fmt.Sprintf("invalid email %q: must be a bare email address", e)
+		}
+	}
+	for _, ev := range req.EmailEvents {
+		if !validNotifyEvent(ev) {
+			return fmt.Sprintf("invalid email event %q: must be one of ready, trial_expiring, suspended or deleted", ev)
+		}
+	}
+	return ""
+}
+
+// validNotifyEvent reports whether ev names a lifecycle email.
+func validNotifyEvent(ev string) bool {
+	for _, e := range notify.Events {
+		if string(e) == ev {
+			return true
+		}
+	}
+	return false
+}
+
+// GetContact handles GET /tenants/{tenant-id}/contact — whom the tenant's
+// lifecycle notifications go to, and which emails they receive.
+func (h *Handler) GetContact(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "contacts need the registry")
+		return
+	}
+	c, ok, err := h.registry.Contact(id)
+	if err != nil {
+		logf(r, "GetContact error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read contact")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "tenant has no contact")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, c)
+}
+
+// PutContact handles PUT /tenants/{tenant-id}/contact — sets the tenant's
+// contact emails and which lifecycle emails they receive. The contact takes
+// the place of the contact_email of the tenant's instances.
+func (h *Handler) PutContact(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "contacts need the registry")
+		return
+	}
+	var req ContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if msg := checkContactRequest(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if req.Locale != "" {
+		tag, err := locale.Parse(req.Locale)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error()+": must be a BCP 47 language tag such as \"de\" or \"pt-BR\"")
+			return
+		}
+		req.Locale = tag
+	}
+	if req.Emails == nil {
+		req.Emails = []string{}
+	}
+	c := registry.Contact{
+		TenantID:    id,
+		Emails:      req.Emails,
+		EmailEvents: req.EmailEvents,
+		Locale:      req.Locale,
+		UpdatedAt:   time.Now().UTC(),
+	}
+	err := h.registry.PutContact(c)
+	h.recordAudit(r, "contact.update", id, "", err)
+	if err != nil {
+		logf(r, "PutContact error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to save contact")
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+// DeleteContact handles DELETE /tenants/{tenant-id}/contact — notifications
+// go back to the contact_email of the tenant's instances.
+func (h *Handler) DeleteContact(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "contacts need the registry")
+		return
+	}
+	err := h.registry.DeleteContact(id)
+	h.recordAudit(r, "contact.delete", id, "", err)
+	if err != nil {
+		logf(r, "DeleteContact error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete contact")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// GetInstanceDiagnostics handles GET /tenants/{tenant-id}/instance/diagnostics
+// — the diagnostics captured when the tenant's instances missed the
+// provisioning deadline, newest first, including those of instances since
+// deleted.
+func (h *Handler) GetInstanceDiagnostics(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "the registry is not configured")
+		return
+	}
+	diagnostics := h.registry.Diagnostics(id)
+	if diagnostics == nil {
+		diagnostics = []k8s.Diagnostics{}
+	}
+	writeResponse(w, r, http.StatusOK, diagnostics)
+}
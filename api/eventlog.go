@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultEventPage = 100
+	maxEventPage     = 1000
+)
+
+// EventsResponse is a page of the lifecycle event log.
+type EventsResponse struct {
+	// Events are in the same format as webhook deliveries: CloudEvents, or
+	// registry.Event in the legacy format.
+	Events []any `json:"events"`
+	// NextCursor is passed as ?since= to fetch the following page; it is
+	// the given cursor when there are no new events.
+	NextCursor string `json:"next_cursor"`
+	HasMore    bool   `json:"has_more"`
+	// Truncated is set when events after the cursor have already been
+	// pruned; the consumer should reconcile from a full listing.
+	Truncated bool `json:"truncated"`
+}
+
+// ListEvents handles GET /admin/events — the lifecycle events logged after
+// ?since= (a cursor from a previous page or a webhook body's seq; the start
+// of the log when omitted), oldest first. ?limit=N sets the page size
+// (default 100, at most 1000).
+func (h *Handler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "the event log is not configured")
+		return
+	}
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "invalid since: must be a cursor from a previous page")
+			return
+		}
+		since = n
+	}
+	limit := defaultEventPage
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxEventPage {
+			writeError(w, http.StatusBadRequest, "invalid limit: must be between 1 and 1000")
+			return
+		}
+		limit = n
+	}
+
+	events, first, err := h.registry.Events(since, limit+1)
+	if err != nil {
+		logf(r, "ListEvents error: since=%d err=%v", since, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to read events")
+		return
+	}
+	resp := EventsResponse{Truncated: first > since+1}
+	if len(events) > limit {
+		events, resp.HasMore = events[:limit], true
+	}
+	cursor := since
+	resp.Events = make([]any, 0, len(events))
+	for _, ev := range events {
+		resp.Events = append(resp.Events, h.webhooks.Envelope(ev))
+		cursor = ev.Seq
+	}
+	resp.NextCursor = strconv.FormatInt(cursor, 10)
+	writeResponse(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// stateStreamInterval is how often the instance is re-read for the state
+	// stream. Pod, ingress and certificate changes do not touch the CR, so
+	// the stream polls rather than relying on instance events.
+	stateStreamInterval = 2 * time.Second
+
+	// stateStreamHeartbeat is how long the stream may stay silent before a
+	// comment is sent to keep proxies from closing it.
+	stateStreamHeartbeat = 15 * time.Second
+)
+
+// stateEvent is the data of a "state" event on the instance event stream.
+type stateEvent struct {
+	Status  string `json:"status"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// StreamInstanceEvents handles GET /tenants/{tenant-id}/instance/events — a
+// server-sent event stream of the instance's provisioning state. A "state"
+// event is sent on connect and whenever the status, state or message
+// changes; a "deleted" event is sent, and the stream closed, when the
+// instance goes away. Clients typically follow a new instance until it
+// reaches "running" or "error" and then disconnect.
+func (h *Handler) StreamInstanceEvents(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	rc := http.NewResponseController(w)
+	ctx := r.Context()
+
+	info, err := h.k8sManager.GetInstance(ctx, id)
+	if err != nil {
+		logf(r, "StreamInstanceEvents error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve instance")
+		return
+	}
+	if info == nil {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var last stateEvent
+	var lastWrite time.Time
+	ticker := time.NewTicker(stateStreamInterval)
+	defer ticker.Stop()
+	for {
+		if info == nil {
+			fmt.Fprint(w, "event: deleted\ndata: {}\n\n")
+			rc.Flush()
+			return
+		}
+		ev := stateEvent{Status: info.Status, State: info.State, Message: info.Message}
+		var chunk string
+		switch {
+		case ev != last:
+			data, _ := json.Marshal(ev)
+			chunk = fmt.Sprintf("event: state\ndata: %s\n\n", data)
+			last = ev
+		case time.Since(lastWrite) >= stateStreamHeartbeat:
+			chunk = ": keep-alive\n\n"
+		}
+		if chunk != "" {
+			io.WriteString(w, chunk)
+			if err := rc.Flush(); err != nil {
+				return
+			}
+			lastWrite = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if info, err = h.k8sManager.GetInstance(ctx, id); err != nil {
+			logf(r, "StreamInstanceEvents error: tenant=%s err=%v", id, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/flags"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+)
+
+// FlagRequest is the JSON body accepted by PutFlag.
+type FlagRequest struct {
+	Description string          `json:"description"`
+	Default     bool            `json:"default"`
+	Plans       map[string]bool `json:"plans"`   // Per-plan overrides
+	Tenants     map[string]bool `json:"tenants"` // Per-tenant overrides, by tenant ID
+}
+
+// FlagChangeResponse is the JSON envelope returned when a flag changes. Batch
+// tracks the rollout to running instances.
+type FlagChangeResponse struct {
+	Flag  *flags.Flag      `json:"flag,omitempty"`
+	Batch *workqueue.Batch `json:"batch,omitempty"`
+}
+
+// ListFlags handles GET /admin/flags — lists every feature flag.
+func (h *Handler) ListFlags(w http.ResponseWriter, r *http.Request) {
+	if h.flags == nil {
+		writeError(w, http.StatusNotImplemented, "feature flags are not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.flags.List())
+}
+
+// PutFlag handles PUT /admin/flags/{flag} — creates or replaces a flag and
+// rolls the change out to every running instance.
+func (h *Handler) PutFlag(w http.ResponseWriter, r *http.Request) {
+	if h.flags == nil {
+		writeError(w, http.StatusNotImplemented, "feature flags are not configured")
+		return
+	}
+	name := chi.URLParam(r, "flag")
+	if !flags.ValidName(name) {
+		writeError(w, http.StatusBadRequest, "invalid flag name: must be lowercase letters, digits, '-' or '_'")
+		return
+	}
+	var req FlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	tenants := make(map[string]bool, len(req.Tenants))
+	for raw, on := range req.Tenants {
+		id, err := tenant.Parse(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid tenant ID %q: %v", raw, err))
+			return
+		}
+		tenants[id.String()] = on
+	}
+
+	flag, err := h.flags.Put(flags.Flag{
+		Name:        name,
+		Description: req.Description,
+		Default:     req.Default,
+		Plans:       req.Plans,
+		Tenants:     tenants,
+	})
+	h.recordAudit(r, "flag.put", "", "flag="+name, err)
+	if err != nil {
+		logf(r, "PutFlag error: flag=%s err=%v", name, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save flag")
+		return
+	}
+
+	batch, ok := h.rolloutFlags(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusAccepted, FlagChangeResponse{Flag: &flag, Batch: batch})
+}
+
+// DeleteFlag handles DELETE /admin/flags/{flag} — removes a flag and its
+// variable from every running instance.
+func (h *Handler) DeleteFlag(w http.ResponseWriter, r *http.Request) {
+	if h.flags == nil {
+		writeError(w, http.StatusNotImplemented, "feature flags are not configured")
+		return
+	}
+	name := chi.URLParam(r, "flag")
+	found, err := h.flags.Delete(name)
+	if found || err != nil {
+		h.recordAudit(r, "flag.delete", "", "flag="+name, err)
+	}
+	if err != nil {
+		logf(r, "DeleteFlag error: flag=%s err=%v", name, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete flag")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "flag not found")
+		return
+	}
+
+	batch, ok := h.rolloutFlags(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusAccepted, FlagChangeResponse{Batch: batch})
+}
+
+// rolloutFlags queues a feature-flag update for every instance. Flags are
+// resolved when each item runs, so that later changes are never overwritten
+// by an older rollout. On failure it writes an error response and returns
+// false.
+func (h *Handler) rolloutFlags(w http.ResponseWriter, r *http.Request) (*workqueue.Batch, bool) {
+	if h.workQueue == nil {
+		return nil, true
+	}
+	instances, err := h.k8sManager.ListInstances(r.Context())
+	if err != nil {
+		logf(r, "flag rollout error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "flag saved but rollout failed to list instances")
+		return nil, false
+	}
+
+	plans := make(map[string]string, len(instances))
+	items := make([]workqueue.Item, 0, len(instances))
+	for _, inst := range instances {
+		plans[inst.TenantID] = inst.Info.Plan
+		items = append(items, workqueue.Item{TenantID: inst.TenantID, Instance: inst.Info.Name})
+	}
+	batch := h.workQueue.Submit("flags", workqueue.PriorityBulk, items, func(ctx context.Context, it workqueue.Item) error {
+		return h.k8sManager.SetFeatureFlags(ctx, it.TenantID, h.flags.Resolve(it.TenantID, plans[it.TenantID]))
+	})
+	logf(r, "flag rollout: batch=%s instances=%d", batch.ID, batch.Total)
+	return batch, true
+}
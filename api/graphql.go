@@ -0,0 +1,468 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/mchatman/tenant-provisioner/internal/audit"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+)
+
+// graphQLRequest is the body of POST /graphql.
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// gqlTenant is a tenant as seen by the GraphQL schema: an ID and the
+// registry rows that belong to it.
+type gqlTenant struct {
+	ID        string
+	Instances []registry.Record
+}
+
+// GraphQL handles GET and POST /graphql — a read-only query API over the
+// registry, usage ledger and recent audit entries for the admin dashboard.
+// GET takes ?query= (and optional ?variables= as JSON); POST takes the usual
+// {"query", "variables", "operationName"} body. Errors are reported in the
+// response's "errors" list with status 200, as GraphQL clients expect.
+func (h *Handler) GraphQL(w http.ResponseWriter, r *http.Request) {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "the instance registry is not configured")
+		return
+	}
+
+	var req graphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables: must be a JSON object")
+				return
+			}
+		}
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	h.graphQLOnce.Do(func() { h.graphQLSchema, h.graphQLErr = h.newGraphQLSchema() })
+	if h.graphQLErr != nil {
+		logf(r, "GraphQL: building schema: %v", h.graphQLErr)
+		reportError(r, "", h.graphQLErr)
+		writeError(w, http.StatusInternalServerError, "GraphQL schema unavailable")
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.graphQLSchema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	if len(result.Errors) > 0 {
+		logf(r, "GraphQL: query errors: %v", result.Errors)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
+
+// tenants groups registry rows by tenant, ordered by tenant ID.
+func (h *Handler) tenants() []gqlTenant {
+	byID := map[string]*gqlTenant{}
+	var out []*gqlTenant
+	for _, rec := range h.registry.List() {
+		t, ok := byID[rec.TenantID]
+		if !ok {
+			t = &gqlTenant{ID: rec.TenantID}
+			byID[rec.TenantID] = t
+			out = append(out, t)
+		}
+		t.Instances = append(t.Instances, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	tenants := make([]gqlTenant, len(out))
+	for i, t := range out {
+		tenants[i] = *t
+	}
+	return tenants
+}
+
+// tenantUsage returns a tenant's usage for month ("2006-01", or the current
+// month when empty), or nil when it had none.
+func (h *Handler) tenantUsage(tenantID, month string) (*usage.TenantUsage, error) {
+	if h.usage == nil {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	m := now
+	if month != "" {
+		var err error
+		if m, err = time.Parse("2006-01", month); err != nil {
+			return nil, errInvalidMonth
+		}
+	}
+	for _, t := range h.usage.Report(m, now).Tenants {
+		if t.TenantID == tenantID {
+			t := t
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordEnvironment returns the environment of a registry row; rows without
+// an "environment" label are production instances.
+func recordEnvironment(rec registry.Record) string {
+	if env := rec.Labels["environment"]; env != "" {
+		return env
+	}
+	return k8s.EnvProd
+}
+
+// errInvalidMonth is returned to GraphQL clients for a malformed month.
+var errInvalidMonth = errors.New("invalid month: must be YYYY-MM")
+
+// newGraphQLSchema builds the schema served by GraphQL. Resolvers read from
+// the handler's collaborators on every query, so the schema itself is static.
+func (h *Handler) newGraphQLSchema() (graphql.Schema, error) {
+	labelType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Label",
+		Fields: graphql.Fields{
+			"key":   &graphql.Field{Type: graphql.String},
+			"value": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	revisionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Revision",
+		Fields: graphql.Fields{
+			"revision": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(registry.Revision).Revision, nil
+			}},
+			"at": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(registry.Revision).At, nil
+			}},
+			"imageTag": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(registry.Revision).ImageTag, nil
+			}},
+			"specHash": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(registry.Revision).SpecHash, nil
+			}},
+		},
+	})
+
+	usageType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TenantUsage",
+		Fields: graphql.Fields{
+			"tenantId": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*usage.TenantUsage).TenantID, nil
+			}},
+			"plan": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*usage.TenantUsage).Plan, nil
+			}},
+			"instanceHours": &graphql.Field{Type: graphql.Float, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*usage.TenantUsage).InstanceHours, nil
+			}},
+			"storageGibHours": &graphql.Field{Type: graphql.Float, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*usage.TenantUsage).StorageGiBHours, nil
+			}},
+			"snapshots": &graphql.Field{Type: graphql.Int, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(*usage.TenantUsage).Snapshots, nil
+			}},
+		},
+	})
+
+	auditType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuditEntry",
+		Fields: graphql.Fields{
+			"time": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).Time, nil
+			}},
+			"action": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).Action, nil
+			}},
+			"tenantId": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).TenantID, nil
+			}},
+			"outcome": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).Outcome, nil
+			}},
+			"detail": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).Detail, nil
+			}},
+			"correlationId": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).CorrelationID, nil
+			}},
+			"caller": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(audit.Entry).Caller, nil
+			}},
+		},
+	})
+
+	auditArgs := graphql.FieldConfigArgument{
+		"action": &graphql.ArgumentConfig{Type: graphql.String},
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+	}
+	usageArgs := graphql.FieldConfigArgument{
+		"month": &graphql.ArgumentConfig{Type: graphql.String, Description: "YYYY-MM; defaults to the current month"},
+	}
+	auditEntries := func(tenantID string, args map[string]interface{}) []audit.Entry {
+		action, _ := args["action"].(string)
+		limit, _ := args["limit"].(int)
+		return h.auditHistory.Query(tenantID, action, limit)
+	}
+
+	// Instance and Tenant refer to each other, so their fields are thunks.
+	var tenantType *graphql.Object
+	instanceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Instance",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			rec := func(p graphql.ResolveParams) registry.Record { return p.Source.(registry.Record) }
+			return graphql.Fields{
+				"name": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).InstanceName, nil
+				}},
+				"tenantId": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).TenantID, nil
+				}},
+				"tenant": &graphql.Field{Type: tenantType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := rec(p).TenantID
+					for _, t := range h.tenants() {
+						if t.ID == id {
+							return t, nil
+						}
+					}
+					return nil, nil
+				}},
+				"plan": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).Plan, nil
+				}},
+				"status": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).Status, nil
+				}},
+				"contactEmail": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).ContactEmail, nil
+				}},
+				"environment": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return recordEnvironment(rec(p)), nil
+				}},
+				"channel": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).Labels["channel"], nil
+				}},
+				"profile": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).Labels["profile"], nil
+				}},
+				"labels": &graphql.Field{Type: graphql.NewList(labelType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					labels := rec(p).Labels
+					keys := make([]string, 0, len(labels))
+					for k := range labels {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					out := make([]map[string]string, len(keys))
+					for i, k := range keys {
+						out[i] = map[string]string{"key": k, "value": labels[k]}
+					}
+					return out, nil
+				}},
+				"createdAt": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).CreatedAt, nil
+				}},
+				"updatedAt": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).UpdatedAt, nil
+				}},
+				"deletedAt": &graphql.Field{Type: graphql.DateTime, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if t := rec(p).DeletedAt; t != nil {
+						return *t, nil
+					}
+					return nil, nil
+				}},
+				"revisions": &graphql.Field{Type: graphql.NewList(revisionType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return rec(p).Revisions, nil
+				}},
+			}
+		}),
+	})
+
+	instancesArgs := graphql.FieldConfigArgument{
+		"includeDeleted": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+	}
+	tenantType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tenant",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(gqlTenant).ID, nil
+			}},
+			"instances": &graphql.Field{Type: graphql.NewList(instanceType), Args: instancesArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				includeDeleted, _ := p.Args["includeDeleted"].(bool)
+				var out []registry.Record
+				for _, rec := range p.Source.(gqlTenant).Instances {
+					if includeDeleted || rec.DeletedAt == nil {
+						out = append(out, rec)
+					}
+				}
+				return out, nil
+			}},
+			"usage": &graphql.Field{Type: usageType, Args: usageArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				month, _ := p.Args["month"].(string)
+				u, err := h.tenantUsage(p.Source.(gqlTenant).ID, month)
+				if u == nil {
+					return nil, err
+				}
+				return u, err
+			}},
+			"auditEntries": &graphql.Field{Type: graphql.NewList(auditType), Args: auditArgs, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return auditEntries(p.Source.(gqlTenant).ID, p.Args), nil
+			}},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"tenant": &graphql.Field{
+				Type: tenantType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id, _ := p.Args["id"].(string)
+					for _, t := range h.tenants() {
+						if t.ID == id {
+							return t, nil
+						}
+					}
+					return nil, nil
+				},
+			},
+			"tenants": &graphql.Field{
+				Type: graphql.NewList(tenantType),
+				Args: graphql.FieldConfigArgument{
+					"plan": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only tenants with a live instance on this plan"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					plan, _ := p.Args["plan"].(string)
+					var out []gqlTenant
+					for _, t := range h.tenants() {
+						if plan == "" {
+							out = append(out, t)
+							continue
+						}
+						for _, rec := range t.Instances {
+							if rec.DeletedAt == nil && rec.Plan == plan {
+								out = append(out, t)
+								break
+							}
+						}
+					}
+					return out, nil
+				},
+			},
+			"instance": &graphql.Field{
+				Type: instanceType,
+				Args: graphql.FieldConfigArgument{
+					"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					name, _ := p.Args["name"].(string)
+					for _, rec := range h.registry.List() {
+						if rec.InstanceName == name {
+							return rec, nil
+						}
+					}
+					return nil, nil
+				},
+			},
+			"instances": &graphql.Field{
+				Type: graphql.NewList(instanceType),
+				Args: graphql.FieldConfigArgument{
+					"tenantId":       &graphql.ArgumentConfig{Type: graphql.String},
+					"status":         &graphql.ArgumentConfig{Type: graphql.String},
+					"plan":           &graphql.ArgumentConfig{Type: graphql.String},
+					"channel":        &graphql.ArgumentConfig{Type: graphql.String},
+					"environment":    &graphql.ArgumentConfig{Type: graphql.String},
+					"includeDeleted": &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tenantID, _ := p.Args["tenantId"].(string)
+					status, _ := p.Args["status"].(string)
+					plan, _ := p.Args["plan"].(string)
+					channel, _ := p.Args["channel"].(string)
+					environment, _ := p.Args["environment"].(string)
+					includeDeleted, _ := p.Args["includeDeleted"].(bool)
+					var out []registry.Record
+					for _, rec := range h.registry.List() {
+						switch {
+						case !includeDeleted && rec.DeletedAt != nil && status != "deleted":
+						case tenantID != "" && rec.TenantID != tenantID:
+						case status != "" && rec.Status != status:
+						case plan != "" && rec.Plan != plan:
+						case channel != "" && rec.Labels["channel"] != channel:
+						case environment != "" && recordEnvironment(rec) != environment:
+						default:
+							out = append(out, rec)
+						}
+					}
+					return out, nil
+				},
+			},
+			"usage": &graphql.Field{
+				Type: graphql.NewList(usageType),
+				Args: usageArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if h.usage == nil {
+						return nil, nil
+					}
+					now := time.Now().UTC()
+					month := now
+					if v, _ := p.Args["month"].(string); v != "" {
+						m, err := time.Parse("2006-01", v)
+						if err != nil {
+							return nil, errInvalidMonth
+						}
+						month = m
+					}
+					tenants := h.usage.Report(month, now).Tenants
+					out := make([]*usage.TenantUsage, len(tenants))
+					for i := range tenants {
+						out[i] = &tenants[i]
+					}
+					return out, nil
+				},
+			},
+			"auditEntries": &graphql.Field{
+				Type: graphql.NewList(auditType),
+				Args: graphql.FieldConfigArgument{
+					"tenantId": &graphql.ArgumentConfig{Type: graphql.String},
+					"action":   auditArgs["action"],
+					"limit":    auditArgs["limit"],
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					tenantID, _ := p.Args["tenantId"].(string)
+					return auditEntries(tenantID, p.Args), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
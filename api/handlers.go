@@ -3,26 +3,165 @@
 package api
 
 import (
+	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
-	"regexp"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/getsentry/sentry-go"
 	"github.com/go-chi/chi/v5"
+	"github.com/graphql-go/graphql"
+	"github.com/mchatman/tenant-provisioner/internal/aibudget"
+	"github.com/mchatman/tenant-provisioner/internal/audit"
+	"github.com/mchatman/tenant-provisioner/internal/billing"
+	"github.com/mchatman/tenant-provisioner/internal/caller"
+	"github.com/mchatman/tenant-provisioner/internal/certmonitor"
+	"github.com/mchatman/tenant-provisioner/internal/compliance"
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/configschema"
+	"github.com/mchatman/tenant-provisioner/internal/consistency"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/flags"
+	"github.com/mchatman/tenant-provisioner/internal/healthcheck"
 	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/objectstore"
+	"github.com/mchatman/tenant-provisioner/internal/recording"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/rightsizing"
+	"github.com/mchatman/tenant-provisioner/internal/rollout"
+	"github.com/mchatman/tenant-provisioner/internal/secretscan"
+	"github.com/mchatman/tenant-provisioner/internal/status"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/uptime"
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
 )
 
 // Handler groups the HTTP handlers and their shared dependencies.
 type Handler struct {
-	k8sManager *k8s.Manager
+	k8sManager   k8s.InstanceManager
+	cfg          *config.Config
+	certSigner   *compliance.Signer
+	exportStore  *objectstore.Client
+	audit        *audit.Logger
+	usage        *usage.Ledger
+	status       *status.Tracker
+	uptime       *uptime.History
+	consistency  *consistency.Checker
+	registry     *registry.Registry
+	workQueue    *workqueue.Queue
+	profiles     map[string]*k8s.Profile
+	flags        *flags.Store
+	rollouts     *rollout.Manager
+	rightsizing  *rightsizing.Advisor
+	certs        *certmonitor.Monitor
+	health       *healthcheck.Prober
+	webhooks     *webhooks.Dispatcher
+	aiBudget     *aibudget.Enforcer
+	billing      *billing.Engine
+	secretScan   *secretscan.Scanner
+	configSchema *configschema.Schema
+	recordings   *recording.Recorder
+	sealer       cipher.AEAD
+
+	auditHistory *audit.History
+	locales      []string
+
+	graphQLOnce   sync.Once
+	graphQLSchema graphql.Schema
+	graphQLErr    error
+
+	shedMu       sync.Mutex
+	shedCapacity *k8s.CapacityReport // Cached for the load-shedding check
+	shedCheckAt  time.Time
+
+	opMu      sync.Mutex
+	queuedOps map[string]bool // Operations queued here, kept current in the registry
+
+	orgMu      sync.Mutex
+	orgPending map[string]int // Creates admitted by organization and not yet finished
+
+	reserveMu sync.Mutex // Held from the capacity check until a reservation is stored
+}
+
+// Options holds the optional collaborators of a Handler. A nil member
+// disables the feature that depends on it.
+type Options struct {
+	CertSigner   *compliance.Signer      // Purge deletion
+	ExportStore  *objectstore.Client     // Data export
+	Audit        *audit.Logger           // Audit shipping; entries are still logged when nil
+	Usage        *usage.Ledger           // Usage reports
+	Status       *status.Tracker         // Public status feed
+	Uptime       *uptime.History         // Per-instance uptime
+	Consistency  *consistency.Checker    // Registry consistency reports
+	Registry     *registry.Registry      // Disaster-recovery rebuilds and shared operation state
+	WorkQueue    *workqueue.Queue        // Bulk operations and queued creates
+	Profiles     map[string]*k8s.Profile // Provisioning profiles by name
+	Flags        *flags.Store            // Feature flags
+	Rollouts     *rollout.Manager        // Channel-by-channel fleet upgrades
+	Rightsizing  *rightsizing.Advisor    // Resource request recommendations
+	CertMonitor  *certmonitor.Monitor    // TLS certificate issuance monitoring
+	Health       *healthcheck.Prober     // Deep health probing
+	Webhooks     *webhooks.Dispatcher    // Outbound webhooks; subscriptions live in Registry
+	AIBudget     *aibudget.Enforcer      // AI usage tracking and budgets
+	Billing      *billing.Engine         // Lifecycle actions driven by billing events
+	SecretScan   *secretscan.Scanner     // Credential scanning of tenant configuration
+	ConfigSchema *configschema.Schema    // Allowed config.raw overrides
+	Recordings   *recording.Recorder     // Per-key request/response recording
+	Sealer       cipher.AEAD             // Encrypts stored idempotent responses carrying gateway tokens
+
+	AuditHistory *audit.History // Recent audit entries for GraphQL queries
+	Locales      []string       // Locales customer-facing text is translated to
 }
 
-// NewHandler creates a Handler backed by the given k8s Manager.
-func NewHandler(k8sManager *k8s.Manager) *Handler {
+// NewHandler creates a Handler backed by the given instance manager.
+func NewHandler(k8sManager k8s.InstanceManager, cfg *config.Config, opts Options) *Handler {
 	return &Handler{
-		k8sManager: k8sManager,
+		k8sManager:   k8sManager,
+		cfg:          cfg,
+		certSigner:   opts.CertSigner,
+		exportStore:  opts.ExportStore,
+		audit:        opts.Audit,
+		usage:        opts.Usage,
+		status:       opts.Status,
+		uptime:       opts.Uptime,
+		consistency:  opts.Consistency,
+		registry:     opts.Registry,
+		workQueue:    opts.WorkQueue,
+		queuedOps:    make(map[string]bool),
+		orgPending:   make(map[string]int),
+		profiles:     opts.Profiles,
+		flags:        opts.Flags,
+		rollouts:     opts.Rollouts,
+		rightsizing:  opts.Rightsizing,
+		certs:        opts.CertMonitor,
+		health:       opts.Health,
+		webhooks:     opts.Webhooks,
+		aiBudget:     opts.AIBudget,
+		billing:      opts.Billing,
+		secretScan:   opts.SecretScan,
+		configSchema: opts.ConfigSchema,
+		recordings:   opts.Recordings,
+		sealer:       opts.Sealer,
+
+		auditHistory: opts.AuditHistory,
+		locales:      opts.Locales,
 	}
 }
 
@@ -37,9 +176,78 @@ func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	}
 }
 
-// writeError sends a JSON-formatted error message to the client.
+// writeResponse serialises v in the representation preferred by the
+// request's Accept header — JSON by default, or YAML when asked for — and
+// writes it with the given HTTP status code. It is used by admin and export
+// endpoints whose consumers include humans and scripts.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	if negotiate(r.Header.Get("Accept")) != mediaYAML {
+		writeJSON(w, status, v)
+		return
+	}
+
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		log.Printf("writeResponse: failed to encode YAML response: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", mediaYAML)
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// writeError sends a JSON-formatted error message to the client, including
+// the correlation ID already echoed in the response headers.
 func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
+	body := map[string]string{"error": msg}
+	if id := w.Header().Get(correlation.Header); id != "" {
+		body["correlation_id"] = id
+	}
+	writeJSON(w, status, body)
+}
+
+// reportError forwards an error that produced a 5xx response to the error
+// reporter, tagged with the tenant and correlation ID. It is a no-op when
+// error reporting is not configured.
+func reportError(r *http.Request, tenantID string, err error) {
+	hub := sentry.GetHubFromContext(r.Context())
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetTag("tenant_id", tenantID)
+		scope.SetTag("correlation_id", correlation.FromContext(r.Context()))
+		hub.CaptureException(err)
+	})
+}
+
+// logf writes a log line prefixed with the request's correlation ID.
+func logf(r *http.Request, format string, args ...interface{}) {
+	log.Output(2, "cid="+correlation.FromContext(r.Context())+" "+fmt.Sprintf(format, args...))
+}
+
+// recordAudit appends an audit entry for action on tenantID, deriving the
+// outcome from err.
+func (h *Handler) recordAudit(r *http.Request, action, tenantID, detail string, err error) {
+	e := audit.Entry{
+		Time:          time.Now().UTC(),
+		Action:        action,
+		TenantID:      tenantID,
+		Outcome:       "success",
+		Detail:        detail,
+		CorrelationID: correlation.FromContext(r.Context()),
+	}
+	if id, ok := caller.FromContext(r.Context()); ok {
+		e.Caller = id.User
+	}
+	if err != nil {
+		e.Outcome = "failure"
+		e.Detail = err.Error()
+	}
+	h.audit.Record(e)
+	h.auditHistory.Add(e)
 }
 
 // ---------- request / response types ----------
@@ -47,76 +255,440 @@ func writeError(w http.ResponseWriter, status int, msg string) {
 // InstanceResponse is the standard JSON envelope returned for instance
 // operations.
 type InstanceResponse struct {
-	Name         string `json:"name"`
-	Endpoint     string `json:"endpoint"`
-	Status       string `json:"status"`
-	GatewayToken string `json:"gateway_token,omitempty"`
+	Name             string `json:"name"`
+	Endpoint         string `json:"endpoint"`
+	InternalEndpoint string `json:"internal_endpoint,omitempty"`
+	Environment      string `json:"environment,omitempty"`
+	Status           string `json:"status"`
+	State            string `json:"state,omitempty"`
+	Message          string `json:"message,omitempty"`
+	GatewayToken     string `json:"gateway_token,omitempty"`
+
+	// DryRun and Spec are only set for ?dry_run=true requests.
+	DryRun bool                   `json:"dry_run,omitempty"`
+	Spec   map[string]interface{} `json:"spec,omitempty"`
+}
+
+// DeletionPlanResponse is returned by a dry-run delete and lists what the
+// real request would remove.
+type DeletionPlanResponse struct {
+	DryRun    bool                 `json:"dry_run"`
+	Mode      string               `json:"mode"` // "delete", "purge" or "retain_storage"
+	Artifacts []k8s.PurgedArtifact `json:"artifacts"`
+}
+
+// RetainedStorageResponse is returned by a delete with ?retain_storage=true
+// and lists the volumes and snapshots kept for a later re-creation.
+type RetainedStorageResponse struct {
+	TenantID      string                 `json:"tenant_id"`
+	RetainedUntil time.Time              `json:"retained_until"`
+	Retained      []k8s.RetainedArtifact `json:"retained"`
 }
 
 // CreateInstanceRequest is the optional JSON body accepted by CreateInstance.
 type CreateInstanceRequest struct {
 	GatewayToken string `json:"gateway_token"`
+
+	// Cost-allocation metadata, stamped as labels on created resources.
+	// Both must be valid Kubernetes label values.
+	Plan       string `json:"plan"`
+	CostCenter string `json:"cost_center"`
+
+	// ContactEmail receives lifecycle notifications for the instance.
+	ContactEmail string `json:"contact_email"`
+
+	// Profile names a provisioning profile; DEFAULT_PROFILE applies when
+	// empty.
+	Profile string `json:"profile"`
+
+	// Channel is the release channel: "stable", "beta" or "canary". The
+	// default depends on the environment (see ENVIRONMENT_CHANNELS).
+	Channel string `json:"channel"`
+
+	// Environment is "prod" (the default), "staging" or "dev". It decides
+	// the instance's hostname and the defaults and limits that apply to it.
+	Environment string `json:"environment"`
+
+	// HealthCheck overrides how the instance is probed; omitted fields use
+	// the HEALTH_CHECK_* defaults.
+	HealthCheck *HealthCheckRequest `json:"health_check"`
+
+	// Env sets variables of the instance, over the generated ones. The
+	// gateway token, proxy and feature variables cannot be set. Values are
+	// scanned for credentials (see SECRET_SCAN_MODE).
+	Env map[string]string `json:"env"`
+
+	// Config overrides OpenClaw settings. Its raw block must conform to the
+	// config.raw schema (see CONFIG_RAW_SCHEMA_PATH) and is scanned for
+	// credentials like Env.
+	Config *ConfigOverride `json:"config"`
+
+	// Annotations are set on the instance's metadata, for tooling such as
+	// backup or cost tools; keys must start with one of
+	// ANNOTATION_PREFIXES. Not available to organizations.
+	Annotations map[string]string `json:"annotations"`
+
+	// Branding white-labels the instance for a reseller: its product name,
+	// logo and theme color are written into config.raw, over Config.
+	Branding *BrandingRequest `json:"branding"`
 }
 
-// ---------- route handlers ----------
+// ConfigOverride is the config block of a create request.
+type ConfigOverride struct {
+	Raw map[string]interface{} `json:"raw"`
+}
 
-// uuidRe matches a standard UUID.
-var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+// HealthCheckRequest is the probe configuration accepted at creation.
+type HealthCheckRequest struct {
+	Path           string `json:"path"`            // e.g. "/healthz"
+	ExpectedStatus int    `json:"expected_status"` // e.g. 204
+	Interval       string `json:"interval"`        // Go duration, e.g. "30s"
+}
+
+// Bounds on a per-instance probe interval.
+const (
+	minHealthInterval = 10 * time.Second
+	maxHealthInterval = time.Hour
+)
 
-// tenantID extracts and validates the tenant-id path parameter. On validation
-// failure it writes an error response and returns an empty string.
+// healthCheck validates req and converts it, returning nil for a nil req.
+func (req *HealthCheckRequest) healthCheck() (*k8s.HealthCheck, error) {
+	if req == nil {
+		return nil, nil
+	}
+	hc := &k8s.HealthCheck{Path: req.Path, ExpectedStatus: req.ExpectedStatus}
+	if req.Path != "" {
+		u, err := url.Parse(req.Path)
+		if err != nil || !strings.HasPrefix(req.Path, "/") || u.Host != "" {
+			return nil, fmt.Errorf("invalid health_check.path: must be an absolute path such as /healthz")
+		}
+	}
+	if req.ExpectedStatus != 0 && (req.ExpectedStatus < 100 || req.ExpectedStatus > 599) {
+		return nil, fmt.Errorf("invalid health_check.expected_status: must be an HTTP status code")
+	}
+	if req.Interval != "" {
+		d, err := time.ParseDuration(req.Interval)
+		if err != nil || d < minHealthInterval || d > maxHealthInterval {
+			return nil, fmt.Errorf("invalid health_check.interval: must be a duration between %s and %s", minHealthInterval, maxHealthInterval)
+		}
+		hc.Interval = d
+	}
+	return hc, nil
+}
+
+// ExportResponse is the JSON envelope returned for data export operations.
+// DownloadURL is omitted for failed exports and only serves the archive once
+// Status is "completed".
+type ExportResponse struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ---------- route handlers ----------
+
+// tenantID extracts and validates the tenant-id path parameter, returning it
+// in canonical form (see tenant.Parse). On validation failure it writes an
+// error response and returns an empty string.
 func tenantID(w http.ResponseWriter, r *http.Request) string {
-	id := chi.URLParam(r, "tenant-id")
-	if !uuidRe.MatchString(id) {
-		writeError(w, http.StatusBadRequest, "invalid tenant ID: must be a valid UUID")
+	id, err := tenant.Parse(chi.URLParam(r, "tenant-id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid tenant ID: "+err.Error())
 		return ""
 	}
-	return id
+	return id.String()
+}
+
+// dryRun parses the dry_run query parameter. On an invalid value it writes an
+// error response and returns ok=false.
+func dryRun(w http.ResponseWriter, r *http.Request) (dry, ok bool) {
+	v := r.URL.Query().Get("dry_run")
+	if v == "" {
+		return false, true
+	}
+	dry, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid dry_run: must be a boolean")
+		return false, false
+	}
+	return dry, true
 }
 
 // CreateInstance handles POST /tenants/{tenant-id}/instance — provisions a new
-// OpenClaw instance for the tenant.
+// OpenClaw instance for the tenant. With ?dry_run=true the spec is generated
+// and validated server-side but nothing is created; the response carries the
+// would-be spec and endpoint. With ?async=true the create is queued behind
+// the work queue instead, and the 202 response is the operation, with its
+// queue position and estimated wait (see GetOperation).
 func (h *Handler) CreateInstance(w http.ResponseWriter, r *http.Request) {
 	id := tenantID(w, r)
 	if id == "" {
 		return
 	}
 
-	var req CreateInstanceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.GatewayToken == "" {
-		req.GatewayToken = generateToken()
+	dry, ok := dryRun(w, r)
+	if !ok {
+		return
+	}
+	async, ok := asyncCreate(w, r)
+	if !ok {
+		return
+	}
+
+	opts, ok := h.createOptions(w, r, id)
+	if !ok {
+		return
+	}
+	opts.DryRun = dry
+	orgDone, ok := h.admitOrgCreate(w, r, id, &opts)
+	if !ok {
+		return
+	}
+
+	logf(r, "CreateInstance: tenant=%s profile=%s dry_run=%t", id, profileName(opts.Profile), dry)
+	if !dry && !h.admitCreate(w, r, id) {
+		orgDone(errCreateNotRun)
+		return
+	}
+	if async && !dry {
+		h.queueCreate(w, r, id, opts, orgDone)
+		return
 	}
 
-	log.Printf("CreateInstance: tenant=%s", id)
+	action := "instance.create"
+	if dry {
+		action = "instance.create.dry_run"
+	}
 
-	info, err := h.k8sManager.CreateInstance(r.Context(), id, req.GatewayToken)
+	end := func(error) {}
+	if !dry {
+		end = h.journalCreate(correlation.NewID(), id, &opts)
+	}
+	info, err := h.k8sManager.CreateInstance(r.Context(), id, opts)
+	end(err)
+	orgDone(err)
+	var invalid *k8s.InvalidSpecError
+	if errors.As(err, &invalid) {
+		h.recordAudit(r, action, id, "", err)
+		logf(r, "CreateInstance rejected: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusBadRequest, invalid.Message)
+		return
+	}
+	var capacity *k8s.CapacityError
+	if errors.As(err, &capacity) {
+		h.recordAudit(r, action, id, "", err)
+		if !dry {
+			h.status.RecordProvisioning(false)
+		}
+		logf(r, "CreateInstance refused: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusServiceUnavailable, capacity.Error())
+		return
+	}
 	if err != nil {
-		log.Printf("CreateInstance error: tenant=%s err=%v", id, err)
+		h.recordAudit(r, action, id, "", err)
+		if !dry {
+			h.status.RecordProvisioning(false)
+		}
+		logf(r, "CreateInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
 		writeError(w, http.StatusInternalServerError, "failed to create instance")
 		return
 	}
+	h.recordAudit(r, action, id, "instance="+info.Name, nil)
+	if dry {
+		writeResponse(w, r, http.StatusOK, InstanceResponse{
+			Name:             info.Name,
+			Endpoint:         info.Endpoint,
+			InternalEndpoint: info.InternalEndpoint,
+			Environment:      info.Environment,
+			Status:           info.Status,
+			GatewayToken:     opts.GatewayToken,
+			DryRun:           true,
+			Spec:             k8s.RedactSpec(info.Spec, secretscan.SharedKeys(h.cfg)),
+		})
+		return
+	}
+	h.status.RecordProvisioning(true)
 
+	if info.ResourceVersion != "" {
+		w.Header().Set("ETag", `"`+info.ResourceVersion+`"`)
+	}
 	writeJSON(w, http.StatusCreated, InstanceResponse{
-		Name:         info.Name,
-		Endpoint:     info.Endpoint,
-		Status:       info.Status,
-		GatewayToken: req.GatewayToken,
+		Name:             info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           info.Status,
+		GatewayToken:     opts.GatewayToken,
 	})
 }
 
+// createOptions decodes and validates the optional CreateInstanceRequest body
+// of a create or reactivation. On an invalid request it writes an error
+// response and returns ok=false.
+func (h *Handler) createOptions(w http.ResponseWriter, r *http.Request, id string) (opts k8s.CreateOptions, ok bool) {
+	var req CreateInstanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return opts, false
+	}
+	if req.GatewayToken == "" {
+		req.GatewayToken = generateToken()
+	}
+	opts, err := h.checkCreateRequest(r, id, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return opts, false
+	}
+	return opts, true
+}
+
+// checkCreateRequest validates a create request for the tenant and converts
+// it to create options. The error of an invalid request is meant for a 400
+// response.
+func (h *Handler) checkCreateRequest(r *http.Request, id string, req CreateInstanceRequest) (k8s.CreateOptions, error) {
+	for field, value := range map[string]string{"plan": req.Plan, "cost_center": req.CostCenter} {
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return k8s.CreateOptions{}, fmt.Errorf("invalid %s: %s", field, errs[0])
+		}
+	}
+	if req.ContactEmail != "" {
+		addr, err := mail.ParseAddress(req.ContactEmail)
+		if err != nil || addr.Name != "" {
+			return k8s.CreateOptions{}, errors.New("invalid contact_email: must be a bare email address")
+		}
+	}
+	if req.Channel != "" && !rollout.ValidChannel(req.Channel) {
+		return k8s.CreateOptions{}, errors.New("invalid channel: must be one of stable, beta or canary")
+	}
+	if req.Environment == "" {
+		req.Environment = k8s.EnvProd
+	}
+	if !k8s.ValidEnvironment(req.Environment) {
+		return k8s.CreateOptions{}, errors.New("invalid environment: must be one of prod, staging or dev")
+	}
+	if req.Channel == "" {
+		req.Channel = h.cfg.EnvironmentChannels[req.Environment]
+	}
+	healthCheck, err := req.HealthCheck.healthCheck()
+	if err != nil {
+		return k8s.CreateOptions{}, err
+	}
+	branding, err := req.Branding.branding()
+	if err != nil {
+		return k8s.CreateOptions{}, err
+	}
+	for name := range req.Env {
+		if err := k8s.CheckEnvOverride(name); err != nil {
+			return k8s.CreateOptions{}, fmt.Errorf("invalid env: %v", err)
+		}
+	}
+	if len(req.Annotations) > 0 {
+		if len(h.cfg.AnnotationPrefixes) == 0 {
+			return k8s.CreateOptions{}, errors.New("annotations are not enabled")
+		}
+		if orgFromContext(r.Context()) != "" {
+			return k8s.CreateOptions{}, errors.New("annotations can only be set by admins")
+		}
+		for key := range req.Annotations {
+			if err := k8s.CheckAnnotation(key, h.cfg.AnnotationPrefixes); err != nil {
+				return k8s.CreateOptions{}, fmt.Errorf("invalid annotations: %v", err)
+			}
+		}
+	}
+	var rawConfig map[string]interface{}
+	if req.Config != nil && len(req.Config.Raw) > 0 {
+		if h.configSchema == nil {
+			return k8s.CreateOptions{}, errors.New("config.raw overrides are not enabled")
+		}
+		if err := k8s.CheckConfigOverride(req.Config.Raw); err != nil {
+			return k8s.CreateOptions{}, fmt.Errorf("invalid config: %v", err)
+		}
+		if violations := h.configSchema.Validate("config.raw", req.Config.Raw); len(violations) > 0 {
+			return k8s.CreateOptions{}, fmt.Errorf("invalid config: %s", strings.Join(violations, "; "))
+		}
+		rawConfig = req.Config.Raw
+	}
+	var findings []secretscan.Finding
+	for name, value := range req.Env {
+		findings = append(findings, h.scanSecrets("env."+name, value)...)
+	}
+	for key, value := range req.Annotations {
+		findings = append(findings, h.scanSecrets("annotations."+key, value)...)
+	}
+	if rawConfig != nil {
+		findings = append(findings, h.scanSecrets("config.raw", rawConfig)...)
+	}
+	if branding != nil && branding.LogoURL != "" {
+		findings = append(findings, h.scanSecrets("branding.logo_url", branding.LogoURL)...)
+	}
+	if err := h.checkSecrets(r, id, findings); err != nil {
+		return k8s.CreateOptions{}, err
+	}
+	if req.Profile == "" {
+		req.Profile = h.cfg.EnvironmentProfiles[req.Environment]
+	}
+	if req.Profile == "" {
+		req.Profile = h.cfg.DefaultProfile
+	}
+	var profile *k8s.Profile
+	if req.Profile != "" {
+		profile = h.profiles[req.Profile]
+		if profile == nil {
+			return k8s.CreateOptions{}, fmt.Errorf("unknown profile %q", req.Profile)
+		}
+		if req.Plan == "" {
+			req.Plan = profile.Plan
+		}
+	}
+	if plans := h.cfg.EnvironmentPlans[req.Environment]; len(plans) > 0 && !slices.Contains(plans, req.Plan) {
+		return k8s.CreateOptions{}, fmt.Errorf("invalid plan for %s instances: must be one of %s",
+			req.Environment, strings.Join(plans, ", "))
+	}
+
+	return k8s.CreateOptions{
+		GatewayToken: req.GatewayToken,
+		Plan:         req.Plan,
+		CostCenter:   req.CostCenter,
+		ContactEmail: req.ContactEmail,
+		Profile:      profile,
+		Channel:      req.Channel,
+		Environment:  req.Environment,
+		HealthCheck:  healthCheck,
+		Features:     h.flags.Resolve(id, req.Plan),
+		Env:          req.Env,
+		Annotations:  req.Annotations,
+		RawConfig:    rawConfig,
+		Branding:     branding,
+	}, nil
+}
+
+// profileName returns the name of p, or "" for none.
+func profileName(p *k8s.Profile) string {
+	if p == nil {
+		return ""
+	}
+	return p.Name
+}
+
 // GetInstance handles GET /tenants/{tenant-id}/instance — returns the current
-// status and endpoint of a tenant's instance.
+// status and endpoint of a tenant's instance. The response carries an ETag
+// derived from the CR's resourceVersion and the response body, whose state
+// comes from objects other than the CR; a matching If-None-Match yields 304.
 func (h *Handler) GetInstance(w http.ResponseWriter, r *http.Request) {
 	id := tenantID(w, r)
 	if id == "" {
 		return
 	}
 
-	log.Printf("GetInstance: tenant=%s", id)
+	logf(r, "GetInstance: tenant=%s", id)
 
 	info, err := h.k8sManager.GetInstance(r.Context(), id)
 	if err != nil {
-		log.Printf("GetInstance error: tenant=%s err=%v", id, err)
+		logf(r, "GetInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
 		writeError(w, http.StatusInternalServerError, "failed to retrieve instance")
 		return
 	}
@@ -126,37 +698,442 @@ func (h *Handler) GetInstance(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	writeJSON(w, http.StatusOK, InstanceResponse{
-		Name:         info.Name,
-		Endpoint:     info.Endpoint,
-		Status:       info.Status,
-		GatewayToken: info.GatewayToken,
-	})
+	resp := InstanceResponse{
+		Name:             info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           info.Status,
+		State:            info.State,
+		Message:          info.Message,
+		GatewayToken:     info.GatewayToken,
+	}
+	if info.ResourceVersion != "" {
+		etag := responseETag(info.ResourceVersion, resp)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// etagDigestLen is the length of the response digest in a response ETag.
+const etagDigestLen = 16
+
+// responseETag returns the ETag of a read of an instance at resourceVersion
+// answered with body: "<resourceVersion>.<digest of body>". The digest
+// changes with state the resourceVersion does not track, such as DNS and
+// certificate readiness; ifMatch only checks the resourceVersion.
+func responseETag(resourceVersion string, body interface{}) string {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return `"` + resourceVersion + `"`
+	}
+	sum := sha256.Sum256(b)
+	return `"` + resourceVersion + "." + hex.EncodeToString(sum[:])[:etagDigestLen] + `"`
 }
 
-// DeleteInstance handles DELETE /tenants/{tenant-id}/instance — tears down all
-// instances for the tenant.
+// etagVersion returns the resourceVersion an ETag names, without the digest
+// of a response ETag.
+func etagVersion(etag string) string {
+	if i := strings.LastIndex(etag, "."); i >= 0 && len(etag)-i-1 == etagDigestLen {
+		if _, err := hex.DecodeString(etag[i+1:]); err == nil {
+			return etag[:i]
+		}
+	}
+	return etag
+}
+
+// DeleteInstance handles DELETE /tenants/{tenant-id}/instance — tears down the
+// tenant's default instance, or the one named by
+// /tenants/{tenant-id}/instances/{instance-id}, along with its volumes,
+// snapshots, Secrets, ConfigMaps, ingress and DNS endpoints, verifies that
+// they are gone and forgets the instance's registry row. With ?mode=purge it
+// also returns a signed deletion certificate. With ?dry_run=true nothing is
+// deleted and the affected resources are listed. With ?retain_storage=true
+// the volumes and snapshots are kept for RETAINED_STORAGE_DAYS, or
+// ?retain_days=N (1-365), so that the instance can be re-created with its
+// data.
 func (h *Handler) DeleteInstance(w http.ResponseWriter, r *http.Request) {
 	id := tenantID(w, r)
 	if id == "" {
 		return
 	}
 
-	log.Printf("DeleteInstance: tenant=%s", id)
+	dry, ok := dryRun(w, r)
+	if !ok {
+		return
+	}
+	if r, ok = ifMatch(w, r); !ok {
+		return
+	}
+
+	retain := false
+	if v := r.URL.Query().Get("retain_storage"); v != "" {
+		var err error
+		if retain, err = strconv.ParseBool(v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid retain_storage: must be a boolean")
+			return
+		}
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if retain && mode == "purge" {
+		writeError(w, http.StatusBadRequest, "retain_storage cannot be combined with mode=purge")
+		return
+	}
+	if retain {
+		days := h.cfg.RetainedStorageDays
+		if v := r.URL.Query().Get("retain_days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 365 {
+				writeError(w, http.StatusBadRequest, "invalid retain_days: must be between 1 and 365")
+				return
+			}
+			days = n
+		}
+		if dry {
+			h.planDeletion(w, r, id, false, true)
+			return
+		}
+		h.deleteRetainingStorage(w, r, id, time.Now().UTC().Truncate(time.Second).Add(time.Duration(days)*24*time.Hour))
+		return
+	}
+
+	switch mode {
+	case "":
+	case "purge":
+		if !dry {
+			h.purgeInstance(w, r, id)
+			return
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "invalid mode: must be \"purge\" or omitted")
+		return
+	}
 
-	if err := h.k8sManager.DeleteInstance(r.Context(), id); err != nil {
-		log.Printf("DeleteInstance error: tenant=%s err=%v", id, err)
+	if dry {
+		h.planDeletion(w, r, id, mode == "purge", false)
+		return
+	}
+
+	logf(r, "DeleteInstance: tenant=%s", id)
+
+	info, err := h.k8sManager.GetInstance(r.Context(), id)
+	if err != nil {
+		logf(r, "DeleteInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
 		writeError(w, http.StatusInternalServerError, "failed to delete instance")
 		return
 	}
+	err = h.k8sManager.DeleteInstance(r.Context(), id)
+	h.recordAudit(r, "instance.delete", id, "", err)
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "DeleteInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete instance")
+		return
+	}
+	if info != nil {
+		h.forgetInstance(info.Name)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteRetainingStorage deletes the tenant's instance, keeping its volumes
+// and snapshots until until, and responds with what was kept.
+func (h *Handler) deleteRetainingStorage(w http.ResponseWriter, r *http.Request, id string, until time.Time) {
+	logf(r, "DeleteInstance: tenant=%s retain_storage until=%s", id, until.Format(time.RFC3339))
+
+	retained, err := h.k8sManager.DeleteInstanceRetainingStorage(r.Context(), id, until)
+	h.recordAudit(r, "instance.delete", id, "retain_storage until="+until.Format(time.RFC3339), err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "DeleteInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to delete instance")
+		return
+	}
+
+	// The registry rows are kept, marked deleted by the watch, for a
+	// reactivation to pick up again.
+	if retained == nil {
+		retained = []k8s.RetainedArtifact{}
+	}
+	writeResponse(w, r, http.StatusOK, RetainedStorageResponse{TenantID: id, RetainedUntil: until, Retained: retained})
+}
+
+// planDeletion answers a dry-run delete with the resources the real request
+// would remove. With retain, volumes and snapshots are left out of the plan.
+func (h *Handler) planDeletion(w http.ResponseWriter, r *http.Request, id string, purge, retain bool) {
+	logf(r, "PlanDeletion: tenant=%s purge=%t retain_storage=%t", id, purge, retain)
 
+	artifacts, err := h.k8sManager.PlanDeletion(r.Context(), id, purge)
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "PlanDeletion error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to plan deletion")
+		return
+	}
+	if len(artifacts) == 0 {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	resp := DeletionPlanResponse{DryRun: true, Mode: "delete", Artifacts: artifacts}
+	switch {
+	case purge:
+		resp.Mode = "purge"
+	case retain:
+		resp.Mode = "retain_storage"
+		resp.Artifacts = resp.Artifacts[:0]
+		for _, a := range artifacts {
+			if a.Kind != "PersistentVolumeClaim" && a.Kind != "VolumeSnapshot" {
+				resp.Artifacts = append(resp.Artifacts, a)
+			}
+		}
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// purgeInstance performs a wipe-and-verify deletion and responds with the
+// signed certificate attesting to it.
+func (h *Handler) purgeInstance(w http.ResponseWriter, r *http.Request, id string) {
+	if h.certSigner == nil {
+		writeError(w, http.StatusNotImplemented, "purge deletion is not configured")
+		return
+	}
+
+	logf(r, "PurgeInstance: tenant=%s", id)
+
+	report, err := h.k8sManager.PurgeInstance(r.Context(), id)
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		h.recordAudit(r, "instance.purge", id, "", err)
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		h.recordAudit(r, "instance.purge", id, "", err)
+		logf(r, "PurgeInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to purge instance")
+		return
+	}
+
+	if len(report.Artifacts) == 0 {
+		h.recordAudit(r, "instance.purge", id, "", k8s.ErrNotFound)
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	artifacts := make([]compliance.Artifact, 0, len(report.Artifacts))
+	for _, a := range report.Artifacts {
+		artifacts = append(artifacts, compliance.Artifact{Kind: a.Kind, Name: a.Name})
+		if a.Kind == "OpenClawInstance" && h.forgetInstance(a.Name) {
+			artifacts = append(artifacts, compliance.Artifact{Kind: compliance.RegistryRecordKind, Name: a.Name})
+		}
+	}
+
+	cert, err := h.certSigner.IssueDeletion(id, artifacts, report.VerifiedAt)
+	if err != nil {
+		logf(r, "PurgeInstance certificate error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to issue deletion certificate")
+		return
+	}
+
+	logf(r, "PurgeInstance: tenant=%s artifacts=%d certificate=%s", id, len(artifacts), cert.ID)
+	h.recordAudit(r, "instance.purge", id, fmt.Sprintf("artifacts=%d certificate=%s", len(artifacts), cert.ID), nil)
+	writeResponse(w, r, http.StatusOK, cert)
+}
+
+// CreateExport handles POST /tenants/{tenant-id}/export — snapshots the
+// tenant's volume and starts packaging it into a downloadable archive. The
+// returned download URL becomes valid once the export completes.
+func (h *Handler) CreateExport(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.exportStore == nil {
+		writeError(w, http.StatusNotImplemented, "data export is not configured")
+		return
+	}
+
+	exportID := generateToken()[:12]
+	key := h.exportKey(id, exportID)
+	uploadURL := h.exportStore.PresignURL(http.MethodPut, key, h.cfg.ExportURLTTL)
+
+	logf(r, "CreateExport: tenant=%s export=%s", id, exportID)
+
+	info, err := h.k8sManager.StartExport(r.Context(), id, exportID, uploadURL)
+	h.recordAudit(r, "instance.export", id, "export="+exportID, err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrNoVolume) {
+		writeError(w, http.StatusConflict, "instance has no persistent data to export")
+		return
+	}
+	if err != nil {
+		logf(r, "CreateExport error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to start export")
+		return
+	}
+	if h.usage != nil {
+		h.usage.RecordSnapshot(id, info.CreatedAt)
+	}
+
+	writeResponse(w, r, http.StatusAccepted, h.exportResponse(id, info))
+}
+
+// GetExport handles GET /tenants/{tenant-id}/export/{export-id} — reports the
+// progress of an export and, once complete, a fresh signed download URL.
+func (h *Handler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.exportStore == nil {
+		writeError(w, http.StatusNotImplemented, "data export is not configured")
+		return
+	}
+
+	exportID := chi.URLParam(r, "export-id")
+	if errs := validation.IsValidLabelValue(exportID); exportID == "" || len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "invalid export ID: must be a valid label value")
+		return
+	}
+	info, err := h.k8sManager.GetExport(r.Context(), id, exportID)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "export not found")
+		return
+	}
+	if err != nil {
+		logf(r, "GetExport error: tenant=%s export=%s err=%v", id, exportID, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve export")
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, h.exportResponse(id, info))
+}
+
+// exportKey returns the object key of a tenant's export archive.
+func (h *Handler) exportKey(tenantID, exportID string) string {
+	return fmt.Sprintf("%s%s/%s.tar.gz", h.cfg.ExportPrefix, tenantID, exportID)
+}
+
+// exportResponse builds the API view of an export. Pending exports carry the
+// URL the archive will be downloadable from; failed ones carry none.
+func (h *Handler) exportResponse(tenantID string, info *k8s.ExportInfo) ExportResponse {
+	resp := ExportResponse{
+		ID:        info.ID,
+		Status:    info.Status,
+		CreatedAt: info.CreatedAt,
+	}
+	if info.Status != "failed" {
+		resp.DownloadURL = h.exportStore.PresignURL(http.MethodGet, h.exportKey(tenantID, info.ID), h.cfg.ExportURLTTL)
+		expires := time.Now().UTC().Add(h.cfg.ExportURLTTL)
+		resp.ExpiresAt = &expires
+	}
+	return resp
+}
 
 // ---------- helpers ----------
 
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 prescribes for GET.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetTenant drops the tenant's registry rows once its teardown has been
+// verified.
+func (h *Handler) forgetTenant(tenantID string) {
+	if h.registry != nil {
+		h.registry.Forget(tenantID)
+	}
+}
+
+// forgetInstance drops the registry row of one of the tenant's instances once
+// its teardown has been verified. It reports whether a row was removed.
+func (h *Handler) forgetInstance(name string) bool {
+	if h.registry == nil {
+		return false
+	}
+	removed, err := h.registry.ForgetInstance(name)
+	if err != nil {
+		log.Printf("forgetInstance: %v", err)
+		return false
+	}
+	return removed
+}
+
+// ifMatch applies the request's If-Match header, when it names an ETag from
+// GET /tenants/{tenant-id}/instance or a mutation, as a precondition on the
+// instance's resourceVersion, returning the request to pass on. It answers
+// 400 and returns false for a list of ETags, and 412 for a weak ETag, which
+// never matches under the strong comparison If-Match requires.
+func ifMatch(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case value == "" || value == "*":
+		return r, true
+	case strings.Contains(value, ","):
+		writeError(w, http.StatusBadRequest, "If-Match must name a single ETag")
+		return nil, false
+	case strings.HasPrefix(value, "W/"):
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return nil, false
+	case len(value) < 3 || value[0] != '"' || value[len(value)-1] != '"':
+		writeError(w, http.StatusBadRequest, "invalid If-Match: must be a quoted ETag")
+		return nil, false
+	}
+	rv := etagVersion(value[1 : len(value)-1])
+	return r.WithContext(k8s.WithResourceVersion(r.Context(), rv)), true
+}
+
+// setETag sets the ETag of the tenant's instance as it is after a mutation,
+// for use in If-Match on the next one. Nothing is set if the instance cannot
+// be read.
+func (h *Handler) setETag(w http.ResponseWriter, r *http.Request, tenantID string) {
+	info, err := h.k8sManager.GetInstance(r.Context(), tenantID)
+	if err == nil && info != nil && info.ResourceVersion != "" {
+		w.Header().Set("ETag", `"`+info.ResourceVersion+`"`)
+	}
+}
+
 // generateToken creates a cryptographically random 32-byte hex gateway token.
 func generateToken() string {
 	b := make([]byte, 32)
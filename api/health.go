@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/healthcheck"
+)
+
+// GetInstanceHealth handles GET /tenants/{tenant-id}/instance/health —
+// returns the latest deep health probe of the instance, with the path,
+// expected status and interval in effect for it.
+func (h *Handler) GetInstanceHealth(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.health == nil {
+		writeError(w, http.StatusNotImplemented, "health probing is not configured")
+		return
+	}
+	result, ok := h.health.Result(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, result)
+}
+
+// FleetHealthResponse summarises health probing across every instance.
+type FleetHealthResponse struct {
+	Healthy   int                  `json:"healthy"`
+	Unhealthy int                  `json:"unhealthy"`
+	Degraded  int                  `json:"degraded"`
+	Pending   int                  `json:"pending"`
+	Instances []healthcheck.Result `json:"instances"` // Degraded first
+}
+
+// GetFleetHealth handles GET /admin/health — the latest probe of every
+// instance, with latency percentiles and recent failures, and counts by
+// outcome. ?degraded=true lists degraded instances only.
+func (h *Handler) GetFleetHealth(w http.ResponseWriter, r *http.Request) {
+	if h.health == nil {
+		writeError(w, http.StatusNotImplemented, "health probing is not configured")
+		return
+	}
+	onlyDegraded := r.URL.Query().Get("degraded") == "true"
+	resp := FleetHealthResponse{Instances: []healthcheck.Result{}}
+	for _, result := range h.health.Results() {
+		switch {
+		case result.Degraded:
+			resp.Degraded++
+		case result.Status == healthcheck.StatusHealthy:
+			resp.Healthy++
+		case result.Status == healthcheck.StatusUnhealthy:
+			resp.Unhealthy++
+		default:
+			resp.Pending++
+		}
+		if !onlyDegraded || result.Degraded {
+			resp.Instances = append(resp.Instances, result)
+		}
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
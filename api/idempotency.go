@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/caller"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/tenantauth"
+)
+
+// IdempotencyKeyHeader names the header with which clients make a mutating
+// request safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKey bounds the length of an Idempotency-Key.
+const maxIdempotencyKey = 255
+
+// maxIdempotentBody bounds the request and response bodies kept for an
+// Idempotency-Key. Larger responses are served but not stored, so retries
+// of such requests run again.
+const maxIdempotentBody = 1 << 20
+
+// replayedHeaders are the response headers stored with an idempotent
+// response and replayed with it.
+var replayedHeaders = []string{"Content-Type", "Location", "Retry-After", "Deprecation", "Sunset"}
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests carrying an
+// Idempotency-Key safe to retry. The first response to a key is stored in the
+// registry for IDEMPOTENCY_TTL, keyed by the key, the method and path, the
+// tenant and the caller, and replayed with an Idempotent-Replayed header to
+// retries. A retry while the first request is still running gets 409;
+// reusing a key with a different body gets 422. 5xx and 429 responses are
+// not stored, so that a retry runs the request again. Responses carrying
+// gateway tokens are stored encrypted with the Sealer. It must be installed
+// after the route's authentication and authorization, where the tenant and
+// the caller are known: inside the /tenants/{tenant-id} route, after
+// RequireTenantToken or RequireAdmin, or after OrgTenant.
+func (h *Handler) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || h.registry == nil || h.cfg.IdempotencyTTL <= 0 || !mutating(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		if len(body) > maxIdempotentBody {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body is too large for an Idempotency-Key")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		claim := registry.IdempotentResponse{
+			ID:          registry.IdempotencyID(key, r.Method, r.URL.Path, idempotencyTenant(r), idempotencyPrincipal(r)),
+			RequestHash: hex.EncodeToString(sum[:]),
+		}
+		existing, claimed, err := h.registry.ClaimIdempotencyKey(claim, h.cfg.IdempotencyTTL)
+		if err != nil {
+			logf(r, "Idempotency error: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to check Idempotency-Key")
+			return
+		}
+		if !claimed {
+			switch {
+			case existing.RequestHash != claim.RequestHash:
+				writeError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+			case !existing.Complete():
+				w.Header().Set("Retry-After", "1")
+				writeError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+			default:
+				h.replay(w, r, existing)
+			}
+			return
+		}
+
+		rw := &recordingWriter{ResponseWriter: w, max: maxIdempotentBody, status: http.StatusOK}
+		stored := false
+		defer func() {
+			// Also releases the key when the handler panics.
+			if !stored {
+				if err := h.registry.ReleaseIdempotencyKey(claim.ID); err != nil {
+					log.Printf("idempotency: %v", err)
+				}
+			}
+		}()
+		next.ServeHTTP(rw, r)
+
+		if rw.truncated || rw.status >= 500 || rw.status == http.StatusTooManyRequests {
+			return
+		}
+		resp := existing
+		resp.Status = rw.status
+		resp.Body = rw.body.Bytes()
+		resp.Header = http.Header{}
+		for _, name := range replayedHeaders {
+			if v := w.Header().Values(name); len(v) > 0 {
+				resp.Header[name] = v
+			}
+		}
+		if carriesGatewayTokens(resp.Body) && h.sealer != nil {
+			if err := h.seal(&resp); err != nil {
+				logf(r, "Idempotency error: %v", err)
+				return
+			}
+		}
+		if err := h.registry.PutIdempotentResponse(resp); err != nil {
+			logf(r, "Idempotency error: %v", err)
+			return
+		}
+		stored = true
+	})
+}
+
+// replay writes a stored idempotent response, decrypting a sealed one.
+func (h *Handler) replay(w http.ResponseWriter, r *http.Request, resp registry.IdempotentResponse) {
+	if resp.Sealed {
+		if err := h.unseal(&resp); err != nil {
+			logf(r, "Idempotency error: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to replay the response to this Idempotency-Key")
+			return
+		}
+	}
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// mutating reports whether requests with method change state.
+func mutating(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// idempotencyTenant returns the tenant on whose behalf r is made: the one
+// in the path, or the one authenticated by RequireTenantToken. Admin
+// requests have none.
+func idempotencyTenant(r *http.Request) string {
+	if id := chi.URLParam(r, "tenant-id"); id != "" {
+		return tenant.Canonical(id)
+	}
+	return tenantauth.FromContext(r.Context())
+}
+
+// idempotencyPrincipal returns who authenticated r: "admin" after
+// RequireAdmin, "org:<id>" or "tenant:<id>" after RequireOrgToken or
+// RequireTenantToken, and otherwise the caller asserted by the proxy, if any.
+// Keys of different principals never share a response.
+func idempotencyPrincipal(r *http.Request) string {
+	if admin, _ := r.Context().Value(adminContextKey{}).(bool); admin {
+		return "admin"
+	}
+	if id, ok := caller.FromContext(r.Context()); ok {
+		return id.User
+	}
+	return ""
+}
+
+// gatewayTokenFields are the response fields that carry gateway tokens.
+var gatewayTokenFields = []string{"gateway_token", "gateway_tokens"}
+
+// carriesGatewayTokens reports whether a response body is a JSON object
+// with a gateway token, which must not be stored in the clear.
+func carriesGatewayTokens(body []byte) bool {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return false
+	}
+	for _, field := range gatewayTokenFields {
+		if v, ok := obj[field]; ok && string(v) != `""` && string(v) != "null" && string(v) != "{}" {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSealer returns the AES-GCM cipher that encrypts stored idempotent
+// responses carrying gateway tokens, from a base64-encoded 32-byte key. An
+// empty key yields a cipher with a random key, whose responses only this
+// process can replay; generated reports that case.
+func NewSealer(keyBase64 string) (sealer cipher.AEAD, generated bool, err error) {
+	key := make([]byte, 32)
+	if keyBase64 == "" {
+		if _, err := rand.Read(key); err != nil {
+			return nil, false, err
+		}
+		generated = true
+	} else if key, err = base64.StdEncoding.DecodeString(keyBase64); err != nil || len(key) != 32 {
+		return nil, false, fmt.Errorf("must be 32 base64-encoded bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, false, err
+	}
+	sealer, err = cipher.NewGCM(block)
+	return sealer, generated, err
+}
+
+// seal encrypts the body of resp, bound to its ID.
+func (h *Handler) seal(resp *registry.IdempotentResponse) error {
+	nonce := make([]byte, h.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	resp.Body = h.sealer.Seal(nonce, nonce, resp.Body, []byte(resp.ID))
+	resp.Sealed = true
+	return nil
+}
+
+// unseal decrypts the body of a sealed resp.
+func (h *Handler) unseal(resp *registry.IdempotentResponse) error {
+	if h.sealer == nil {
+		return fmt.Errorf("response is encrypted but no key is set")
+	}
+	size := h.sealer.NonceSize()
+	if len(resp.Body) < size {
+		return fmt.Errorf("encrypted response is truncated")
+	}
+	body, err := h.sealer.Open(nil, resp.Body[:size], resp.Body[size:], []byte(resp.ID))
+	if err != nil {
+		return fmt.Errorf("decrypting response: %v", err)
+	}
+	resp.Body = body
+	resp.Sealed = false
+	return nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+func TestCarriesGatewayTokens(t *testing.T) {
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{`{"tenant_id":"a","gateway_token":"tok"}`, true},
+		{`{"gateway_tokens":{"default":"tok"}}`, true},
+		{`{"gateway_token":""}`, false},
+		{`{"gateway_token":null}`, false},
+		{`{"gateway_tokens":{}}`, false},
+		{`{"tenant_id":"a"}`, false},
+		{`[{"gateway_token":"tok"}]`, false},
+		{`not json`, false},
+	}
+	for _, tt := range tests {
+		if got := carriesGatewayTokens([]byte(tt.body)); got != tt.want {
+			t.Errorf("carriesGatewayTokens(%s) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestNewSealer(t *testing.T) {
+	tests := []struct {
+		name          string
+		key           string
+		wantGenerated bool
+		wantErr       bool
+	}{
+		{"generated", "", true, false},
+		{"32-byte key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)), false, false},
+		{"short key", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 16)), false, true},
+		{"not base64", "not base64!", false, true},
+	}
+	for _, tt := range tests {
+		sealer, generated, err := NewSealer(tt.key)
+		if (err != nil) != tt.wantErr || generated != tt.wantGenerated {
+			t.Errorf("%s: generated %v, error %v; want generated %v, error %v", tt.name, generated, err, tt.wantGenerated, tt.wantErr)
+		}
+		if err == nil && sealer == nil {
+			t.Errorf("%s: nil sealer", tt.name)
+		}
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	sealer, _, err := NewSealer("")
+	if err != nil {
+		t.Fatalf("NewSealer: %v", err)
+	}
+	h := &Handler{sealer: sealer}
+	body := []byte(`{"gateway_token":"tok"}`)
+
+	resp := registry.IdempotentResponse{ID: "key-1", Body: append([]byte(nil), body...)}
+	if err := h.seal(&resp); err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !resp.Sealed || bytes.Contains(resp.Body, []byte("tok")) {
+		t.Fatalf("sealed response %q is readable", resp.Body)
+	}
+
+	moved := resp
+	moved.ID = "key-2"
+	moved.Body = append([]byte(nil), resp.Body...)
+	if err := h.unseal(&moved); err == nil {
+		t.Error("unseal under another ID succeeded")
+	}
+	truncated := registry.IdempotentResponse{ID: "key-1", Body: resp.Body[:4], Sealed: true}
+	if err := h.unseal(&truncated); err == nil {
+		t.Error("unseal of a truncated response succeeded")
+	}
+	if err := (&Handler{}).unseal(&resp); err == nil {
+		t.Error("unseal without a key succeeded")
+	}
+
+	if err := h.unseal(&resp); err != nil {
+		t.Fatalf("unseal: %v", err)
+	}
+	if resp.Sealed || !bytes.Equal(resp.Body, body) {
+		t.Errorf("unsealed %q, sealed %v; want %q", resp.Body, resp.Sealed, body)
+	}
+}
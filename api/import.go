@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/legacyimport"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+)
+
+// maxImportBody bounds the size of an uploaded export.
+const maxImportBody = 10 << 20
+
+// ImportResult is the outcome of one row of an import.
+type ImportResult struct {
+	Line     int    `json:"line"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Status   string `json:"status"` // "created", "adopted", "exists", "invalid" or "failed"
+	Error    string `json:"error,omitempty"`
+}
+
+// ImportReport is the response to ImportTenants: the outcome of every row,
+// in the order of the export, and the count of each outcome.
+type ImportReport struct {
+	DryRun  bool           `json:"dry_run"`
+	Total   int            `json:"total"`
+	Counts  map[string]int `json:"counts"`
+	Results []ImportResult `json:"results"`
+}
+
+// ImportTenants handles POST /admin/import — creates or adopts instances for
+// the tenants of an export from the legacy provisioning system. The body is
+// the export, in CSV (Content-Type text/csv) or JSON (application/json); see
+// package legacyimport. A row naming an instance adopts that existing
+// OpenClawInstance; any other row creates an instance, unless the tenant
+// has one already. Rows are processed in order and independently: an
+// invalid or failed row is reported and the import goes on. With
+// ?dry_run=true every row is validated, and creates and adoptions are
+// checked server-side, but nothing changes.
+func (h *Handler) ImportTenants(w http.ResponseWriter, r *http.Request) {
+	dry, ok := dryRun(w, r)
+	if !ok {
+		return
+	}
+	format, err := importFormat(r)
+	if err != nil {
+		writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	rows, err := legacyimport.Parse(http.MaxBytesReader(w, r.Body, maxImportBody), format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(rows) > h.cfg.ImportMaxRows {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("export has %d rows; at most %d are allowed per import", len(rows), h.cfg.ImportMaxRows))
+		return
+	}
+
+	report := ImportReport{DryRun: dry, Total: len(rows), Counts: map[string]int{}, Results: []ImportResult{}}
+	for _, row := range rows {
+		res := h.importRow(r, row, dry)
+		report.Counts[res.Status]++
+		report.Results = append(report.Results, res)
+	}
+	logf(r, "ImportTenants: rows=%d dry_run=%t counts=%v", len(rows), dry, report.Counts)
+	if !dry {
+		h.recordAudit(r, "tenants.import", "", fmt.Sprintf("rows=%d created=%d adopted=%d failed=%d",
+			len(rows), report.Counts["created"], report.Counts["adopted"], report.Counts["failed"]+report.Counts["invalid"]), nil)
+	}
+	writeResponse(w, r, http.StatusOK, report)
+}
+
+// importFormat picks the export format from the Content-Type, or from
+// ?format= when the client cannot set one.
+func importFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if f != legacyimport.FormatCSV && f != legacyimport.FormatJSON {
+			return "", fmt.Errorf("invalid format: must be csv or json")
+		}
+		return f, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return legacyimport.FormatCSV, nil
+	case "application/json":
+		return legacyimport.FormatJSON, nil
+	}
+	return "", fmt.Errorf("Content-Type must be text/csv or application/json")
+}
+
+// importRow creates or adopts the instance of one row.
+func (h *Handler) importRow(r *http.Request, row legacyimport.Row, dry bool) ImportResult {
+	res := ImportResult{Line: row.Line, TenantID: row.TenantID, Instance: row.Instance}
+	fail := func(status string, err error) ImportResult {
+		res.Status, res.Error = status, err.Error()
+		return res
+	}
+	if row.Err != nil {
+		return fail("invalid", row.Err)
+	}
+	id, err := tenant.Parse(row.TenantID)
+	if err != nil {
+		return fail("invalid", fmt.Errorf("invalid tenant ID: %v", err))
+	}
+	res.TenantID = id.String()
+	req := CreateInstanceRequest{
+		GatewayToken: row.GatewayToken,
+		Plan:         row.Plan,
+		CostCenter:   row.CostCenter,
+		ContactEmail: row.ContactEmail,
+		Environment:  row.Environment,
+		Channel:      row.Channel,
+		Profile:      row.Profile,
+	}
+	if req.GatewayToken == "" {
+		req.GatewayToken = generateToken()
+	}
+	opts, err := h.checkCreateRequest(r, res.TenantID, req)
+	if err != nil {
+		return fail("invalid", err)
+	}
+	opts.DryRun = dry
+	ctx := r.Context()
+
+	if row.Instance != "" {
+		_, adopted, err := h.k8sManager.AdoptInstance(ctx, res.TenantID, row.Instance, opts)
+		if !dry {
+			h.recordAudit(r, "instance.adopt", res.TenantID, "instance="+row.Instance, err)
+		}
+		var invalid *k8s.InvalidSpecError
+		switch {
+		case errors.Is(err, k8s.ErrNotFound):
+			return fail("failed", fmt.Errorf("instance %s not found", row.Instance))
+		case errors.As(err, &invalid):
+			return fail("failed", errors.New(invalid.Message))
+		case err != nil:
+			logf(r, "ImportTenants adopt error: tenant=%s instance=%s err=%v", res.TenantID, row.Instance, err)
+			return fail("failed", errors.New("failed to adopt instance"))
+		case !adopted:
+			res.Status = "exists"
+		default:
+			res.Status = "adopted"
+		}
+		return res
+	}
+
+	// Re-running an import must not give tenants a second instance.
+	existing, err := h.k8sManager.TenantInstances(ctx, res.TenantID)
+	if err != nil {
+		logf(r, "ImportTenants error: tenant=%s err=%v", res.TenantID, err)
+		return fail("failed", errors.New("failed to list the tenant's instances"))
+	}
+	if len(existing) > 0 {
+		res.Status, res.Instance = "exists", existing[0].Name
+		return res
+	}
+	end := func(error) {}
+	if !dry {
+		end = h.journalCreate(correlation.NewID(), res.TenantID, &opts)
+	}
+	info, err := h.k8sManager.CreateInstance(ctx, res.TenantID, opts)
+	end(err)
+	if !dry {
+		detail := ""
+		if info != nil {
+			detail = "instance=" + info.Name
+		}
+		h.recordAudit(r, "instance.create", res.TenantID, detail, err)
+		h.status.RecordProvisioning(err == nil)
+	}
+	var invalid *k8s.InvalidSpecError
+	var capacity *k8s.CapacityError
+	switch {
+	case errors.As(err, &invalid):
+		return fail("failed", errors.New(invalid.Message))
+	case errors.As(err, &capacity):
+		return fail("failed", capacity)
+	case err != nil:
+		logf(r, "ImportTenants create error: tenant=%s err=%v", res.TenantID, err)
+		reportError(r, res.TenantID, err)
+		return fail("failed", errors.New("failed to create instance"))
+	}
+	res.Status, res.Instance = "created", info.Name
+	return res
+}
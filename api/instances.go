@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// TenantInstanceResponse describes one of a tenant's instances.
+type TenantInstanceResponse struct {
+	InstanceResponse
+	CreatedAt time.Time `json:"created_at"`
+	Default   bool      `json:"default"`
+}
+
+// ListTenantInstances handles GET /tenants/{tenant-id}/instances — the
+// tenant's instances, oldest first. The first is the default instance, which
+// the singular /tenants/{tenant-id}/instance routes act on.
+func (h *Handler) ListTenantInstances(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+
+	instances, err := h.k8sManager.TenantInstances(r.Context(), id)
+	if err != nil {
+		logf(r, "ListTenantInstances error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to list instances")
+		return
+	}
+
+	resp := make([]TenantInstanceResponse, 0, len(instances))
+	for i, info := range instances {
+		item := TenantInstanceResponse{
+			InstanceResponse: InstanceResponse{
+				Name:             info.Name,
+				Endpoint:         info.Endpoint,
+				InternalEndpoint: info.InternalEndpoint,
+				Environment:      info.Environment,
+				Status:           info.Status,
+				State:            info.State,
+				Message:          info.Message,
+			},
+			CreatedAt: info.CreatedAt,
+			Default:   i == 0,
+		}
+		resp = append(resp, item)
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// LifecycleRequest is the JSON body accepted by InstanceLifecycle.
+type LifecycleRequest struct {
+	Action string `json:"action"` // "suspend", "resume", "restart" or "terminate"
+}
+
+// LifecycleAction describes one lifecycle action for an instance. Supported
+// is whether the operator can perform it at all; Available is whether it
+// applies to the instance as it is now, e.g. resume only while suspended.
+type LifecycleAction struct {
+	Action    string `json:"action"`
+	Supported bool   `json:"supported"`
+	Available bool   `json:"available"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// LifecycleResponse is returned by GetInstanceLifecycle and, after an
+// action, by InstanceLifecycle.
+type LifecycleResponse struct {
+	Status  string            `json:"status"`
+	Actions []LifecycleAction `json:"actions"`
+}
+
+// GetInstanceLifecycle handles GET /tenants/{tenant-id}/instance/lifecycle —
+// the lifecycle actions the operator supports and which of them apply to the
+// instance in its current status.
+func (h *Handler) GetInstanceLifecycle(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+
+	info, caps, ok := h.lifecycleState(w, r, id)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, lifecycleResponse(info, caps))
+}
+
+// InstanceLifecycle handles POST /tenants/{tenant-id}/instance/lifecycle —
+// applies a lifecycle action to the tenant's instance. Actions the operator
+// does not support are refused with 501, and actions that do not apply to the
+// instance's current status with 409. Suspend, resume and restart answer 202
+// with the instance's lifecycle afterwards; terminate deletes the instance
+// like DELETE /tenants/{tenant-id}/instance and answers 204.
+func (h *Handler) InstanceLifecycle(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+
+	var req LifecycleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	r, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	info, caps, ok := h.lifecycleState(w, r, id)
+	if !ok {
+		return
+	}
+	var action *LifecycleAction
+	for _, a := range lifecycleResponse(info, caps).Actions {
+		if a.Action == req.Action {
+			action = &a
+			break
+		}
+	}
+	switch {
+	case action == nil:
+		writeError(w, http.StatusBadRequest, "invalid action: must be one of suspend, resume, restart or terminate")
+		return
+	case !action.Supported:
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("%s is not supported by the operator: %s", action.Action, action.Reason))
+		return
+	case !action.Available:
+		writeError(w, http.StatusConflict, fmt.Sprintf("%s does not apply to an instance that is %s", action.Action, info.Status))
+		return
+	}
+
+	logf(r, "InstanceLifecycle: tenant=%s action=%s", id, req.Action)
+
+	var err error
+	auditAction := "instance." + req.Action
+	switch req.Action {
+	case k8s.ActionSuspend:
+		err = h.k8sManager.SuspendInstance(r.Context(), id)
+	case k8s.ActionResume:
+		err = h.k8sManager.ResumeInstance(r.Context(), id)
+	case k8s.ActionRestart:
+		err = h.k8sManager.RestartInstance(r.Context(), id)
+	case k8s.ActionTerminate:
+		auditAction = "instance.delete"
+		err = h.k8sManager.DeleteInstance(r.Context(), id)
+	}
+	h.recordAudit(r, auditAction, id, "", err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "InstanceLifecycle error: tenant=%s action=%s err=%v", id, req.Action, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to "+req.Action+" instance")
+		return
+	}
+
+	if req.Action == k8s.ActionTerminate {
+		h.forgetInstance(info.Name)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	info, caps, ok = h.lifecycleState(w, r, id)
+	if !ok {
+		return
+	}
+	if info.ResourceVersion != "" {
+		w.Header().Set("ETag", `"`+info.ResourceVersion+`"`)
+	}
+	writeResponse(w, r, http.StatusAccepted, lifecycleResponse(info, caps))
+}
+
+// lifecycleState reads the tenant's instance and the operator's lifecycle
+// capabilities. On failure, including a missing instance, it writes an error
+// response and returns ok=false.
+func (h *Handler) lifecycleState(w http.ResponseWriter, r *http.Request, id string) (*k8s.InstanceInfo, []k8s.LifecycleCapability, bool) {
+	info, err := h.k8sManager.GetInstance(r.Context(), id)
+	if err != nil {
+		logf(r, "InstanceLifecycle error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve instance")
+		return nil, nil, false
+	}
+	if info == nil {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return nil, nil, false
+	}
+	caps, err := h.k8sManager.LifecycleCapabilities(r.Context())
+	if err != nil {
+		logf(r, "InstanceLifecycle error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to discover lifecycle capabilities")
+		return nil, nil, false
+	}
+	return info, caps, true
+}
+
+// lifecycleResponse combines the operator's capabilities with what applies
+// to the instance in its current status.
+func lifecycleResponse(info *k8s.InstanceInfo, caps []k8s.LifecycleCapability) LifecycleResponse {
+	suspended := info.Status == "suspended"
+	resp := LifecycleResponse{Status: info.Status, Actions: make([]LifecycleAction, 0, len(caps))}
+	for _, c := range caps {
+		a := LifecycleAction{Action: c.Action, Supported: c.Supported, Reason: c.Reason}
+		switch c.Action {
+		case k8s.ActionSuspend, k8s.ActionRestart:
+			a.Available = c.Supported && !suspended
+		case k8s.ActionResume:
+			a.Available = c.Supported && suspended
+		default:
+			a.Available = c.Supported
+		}
+		resp.Actions = append(resp.Actions, a)
+	}
+	return resp
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// GetInstanceMetrics handles GET /tenants/{tenant-id}/instance/metrics —
+// reports current CPU and memory usage against requests and limits, and
+// volume utilization, so that support can tell whether a slow tenant is
+// simply short of resources. Sources that could not be read are listed in
+// the response's warnings.
+func (h *Handler) GetInstanceMetrics(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+
+	metrics, err := h.k8sManager.InstanceMetrics(r.Context(), id)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if err != nil {
+		logf(r, "GetInstanceMetrics error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve instance metrics")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, metrics)
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/mchatman/tenant-provisioner/internal/caller"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/tenantauth"
+)
+
+// Correlation accepts the caller's X-Correlation-ID (or generates one),
+// stores it in the request context and echoes it on the response. It also
+// registers the ID as chi's request ID so that middleware.Logger includes it
+// in access logs; it therefore replaces middleware.RequestID.
+func Correlation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(correlation.Header)
+		if !correlation.Valid(id) {
+			id = correlation.NewID()
+		}
+
+		w.Header().Set(correlation.Header, id)
+		ctx := correlation.NewContext(r.Context(), id)
+		ctx = context.WithValue(ctx, middleware.RequestIDKey, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SentryScope tags the request's Sentry hub with its correlation ID so that
+// captured panics can be matched to logs. It must run inside the sentryhttp
+// handler, which installs the per-request hub.
+func SentryScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hub := sentry.GetHubFromContext(r.Context()); hub != nil {
+			hub.Scope().SetTag("correlation_id", correlation.FromContext(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeGrace is added to a route's timeout when moving the connection write
+// deadline, so the 504 written on timeout still reaches the client.
+const writeGrace = 5 * time.Second
+
+// RouteTimeout bounds the handlers of a route group to d: the request context
+// is cancelled after d (answering 504 if nothing was written yet) and the
+// connection write deadline is moved to match, overriding the server-wide
+// WriteTimeout. A d of zero removes both limits, for streaming endpoints.
+func RouteTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		bounded := middleware.Timeout(d)(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rc := http.NewResponseController(w)
+			if d <= 0 {
+				rc.SetWriteDeadline(time.Time{})
+				next.ServeHTTP(w, r)
+				return
+			}
+			rc.SetWriteDeadline(time.Now().Add(d + writeGrace))
+			bounded.ServeHTTP(w, r)
+		})
+	}
+}
+
+// CallerIdentity records the caller asserted by an authenticating proxy (for
+// example oauth2-proxy after an OIDC login) in the request context. The
+// headers are trusted as-is, so the service must only be reachable through
+// that proxy when userHeader is configured.
+func CallerIdentity(userHeader, groupsHeader string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := strings.TrimSpace(r.Header.Get(userHeader))
+			if user == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			id := caller.Identity{User: user, Proxied: true}
+			if groupsHeader != "" {
+				for _, g := range strings.Split(r.Header.Get(groupsHeader), ",") {
+					if g = strings.TrimSpace(g); g != "" {
+						id.Groups = append(id.Groups, g)
+					}
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(caller.NewContext(r.Context(), id)))
+		})
+	}
+}
+
+// bearerToken returns the token of a request's "Authorization: Bearer"
+// header, or "" when it has none or another scheme.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return ""
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// adminContextKey marks requests authenticated by RequireAdmin.
+type adminContextKey struct{}
+
+// RequireAdmin restricts a route group to callers presenting token as a
+// bearer token. With an empty token the group is disabled entirely.
+func RequireAdmin(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				writeError(w, http.StatusForbidden, "admin API is disabled")
+				return
+			}
+			presented := bearerToken(r)
+			if subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+				writeError(w, http.StatusUnauthorized, "invalid admin token")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, true)))
+		})
+	}
+}
+
+// RequireTenantToken restricts a route group to tenants presenting their
+// instance's gateway token as a bearer token. The tenant is stored in the
+// request context, operations are limited to the instance the token belongs
+// to, and the caller is recorded for auditing as "tenant:<id>".
+func RequireTenantToken(tokens *tenantauth.Index) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented := bearerToken(r)
+			owner, ok := tokens.Lookup(presented)
+			if !ok {
+				writeError(w, http.StatusUnauthorized, "invalid tenant token")
+				return
+			}
+			ctx := tenantauth.NewContext(r.Context(), owner.TenantID)
+			ctx = k8s.WithInstance(ctx, owner.Instance)
+			ctx = caller.NewContext(ctx, caller.Identity{User: "tenant:" + owner.TenantID})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// instanceIDRe matches an instance ID, which is the instance's Kubernetes
+// name.
+var instanceIDRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// DefaultInstance makes the singular /tenants/{tenant-id}/instance routes act
+// on the tenant's default instance, its oldest.
+func DefaultInstance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(k8s.WithDefaultInstance(r.Context())))
+	})
+}
+
+// SelectInstance makes the /tenants/{tenant-id}/instances/{instance-id}
+// routes act on the named instance of the tenant.
+func SelectInstance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "instance-id")
+		if !instanceIDRe.MatchString(id) {
+			writeError(w, http.StatusBadRequest, "invalid instance ID")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(k8s.WithInstance(r.Context(), id)))
+	})
+}
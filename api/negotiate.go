@@ -0,0 +1,59 @@
+package api
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+const (
+	mediaJSON = "application/json"
+	mediaYAML = "application/yaml"
+)
+
+// yamlTypes are the media types accepted as a request for YAML.
+var yamlTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+}
+
+// negotiate picks the response media type for an Accept header. JSON wins
+// ties and is the default when the header is absent or names nothing we
+// support.
+func negotiate(accept string) string {
+	if accept == "" {
+		return mediaJSON
+	}
+
+	best, bestQ := mediaJSON, -1.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+
+		var candidate string
+		switch {
+		case mediaType == mediaJSON, mediaType == "application/*", mediaType == "*/*":
+			candidate = mediaJSON
+		case yamlTypes[mediaType]:
+			candidate = mediaYAML
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && candidate == mediaJSON) {
+			best, bestQ = candidate, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+)
+
+// OperationResponse is the state of an asynchronous tenant operation, such as
+// a queued create. While the operation waits for a worker it carries its
+// position in the queue and the estimated wait, for the signup UI to show.
+type OperationResponse struct {
+	registry.Operation
+	GatewayToken string `json:"gateway_token,omitempty"` // Only when the operation is accepted
+}
+
+// tenantOperations are the work queue actions that run as tenant operations.
+var tenantOperations = map[string]bool{"create": true}
+
+// asyncCreate reports whether the create asks to be queued with ?async=true.
+// On an invalid value it writes an error response and returns ok=false.
+func asyncCreate(w http.ResponseWriter, r *http.Request) (async, ok bool) {
+	v := r.URL.Query().Get("async")
+	if v == "" {
+		return false, true
+	}
+	async, err := strconv.ParseBool(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid async: must be a boolean")
+		return false, false
+	}
+	return async, true
+}
+
+// queueCreate queues the create of a tenant's instance on the work queue, in
+// the lane of its plan, and responds 202 with the operation, whose progress
+// GetOperation reports. The outcome is audited, and failures reported, when
+// the create runs, and passed to done.
+func (h *Handler) queueCreate(w http.ResponseWriter, r *http.Request, id string, opts k8s.CreateOptions, done func(error)) {
+	if h.workQueue == nil {
+		done(errCreateNotRun)
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+	// The operation is written to the registry as it is queued, starts and
+	// finishes, so that a replica other than this one can report it.
+	ready := make(chan struct{})
+	var opID string
+	batch := h.workQueue.Submit("create", h.createPriority(opts.Plan), []workqueue.Item{{TenantID: id}}, func(ctx context.Context, _ workqueue.Item) error {
+		<-ready
+		h.saveOperation(opID)
+		err := h.runQueuedCreate(ctx, r, opID, id, opts)
+		done(err)
+		h.finishOperation(opID, err)
+		return err
+	})
+	opID = batch.ID
+	close(ready)
+
+	op := OperationResponse{Operation: operationState(batch), GatewayToken: opts.GatewayToken}
+	h.trackOperation(op.Operation)
+	logf(r, "CreateInstance queued: tenant=%s operation=%s position=%d", id, op.ID, op.QueuePosition)
+	w.Header().Set("Location", fmt.Sprintf("/tenants/%s/operations/%s", id, op.ID))
+	writeResponse(w, r, http.StatusAccepted, op)
+}
+
+// runQueuedCreate creates the tenant's instance from the work queue,
+// journaled under opID, audits the outcome and reports failures. The
+// returned error is what the operation reports to the caller.
+func (h *Handler) runQueuedCreate(ctx context.Context, r *http.Request, opID, id string, opts k8s.CreateOptions) error {
+	end := h.journalCreate(opID, id, &opts)
+	info, err := h.k8sManager.CreateInstance(ctx, id, opts)
+	end(err)
+	var invalid *k8s.InvalidSpecError
+	var capacity *k8s.CapacityError
+	switch {
+	case errors.As(err, &invalid):
+		h.recordAudit(r, "instance.create", id, "", err)
+		return errors.New(invalid.Message)
+	case errors.As(err, &capacity):
+		h.recordAudit(r, "instance.create", id, "", err)
+		h.status.RecordProvisioning(false)
+		return capacity
+	case err != nil:
+		h.recordAudit(r, "instance.create", id, "", err)
+		h.status.RecordProvisioning(false)
+		logf(r, "CreateInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		return errors.New("failed to create instance")
+	}
+	h.recordAudit(r, "instance.create", id, "instance="+info.Name, nil)
+	h.status.RecordProvisioning(true)
+	return nil
+}
+
+// journalCreate opens the registry's journal entry for a create, under the
+// given operation ID, and has opts report the create's steps to it, so that
+// the create can be resumed or rolled back should this replica stop half-way
+// (see package recovery). Pass the create's error to the returned function:
+// a failed create cleans up after itself and its entry is dropped, while the
+// entry of a successful one stays open until its instance.created event is
+// published.
+func (h *Handler) journalCreate(opID, tenantID string, opts *k8s.CreateOptions) func(error) {
+	if h.registry == nil {
+		return func(error) {}
+	}
+	if err := h.registry.BeginJournal(opID, "create", tenantID); err != nil {
+		log.Printf("operations: %v", err)
+		return func(error) {}
+	}
+	opts.Journal = func(step, instanceName string) {
+		if err := h.registry.JournalStep(opID, step, instanceName); err != nil {
+			log.Printf("operations: %v", err)
+		}
+	}
+	return func(err error) {
+		if err == nil {
+			return
+		}
+		if err := h.registry.EndJournal(opID); err != nil {
+			log.Printf("operations: %v", err)
+		}
+	}
+}
+
+// createPriority returns the work queue lane of a create on plan: the trial
+// lane for QUEUE_TRIAL_PLANS and creates without a plan, the paid lane
+// otherwise.
+func (h *Handler) createPriority(plan string) workqueue.Priority {
+	if plan == "" || slices.Contains(h.cfg.QueueTrialPlans, plan) {
+		return workqueue.PriorityTrial
+	}
+	return workqueue.PriorityPaid
+}
+
+// GetOperation handles GET /tenants/{tenant-id}/operations/{operation-id} —
+// reports the progress of an asynchronous operation on the tenant, such as a
+// create queued with ?async=true. Operations queued on this replica are
+// reported live; others are read from the registry, where the replica
+// running them keeps their state.
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.workQueue == nil && h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+	opID := chi.URLParam(r, "operation-id")
+	if h.workQueue != nil {
+		// Operations are single-item batches; bulk batches and other
+		// tenants' operations are not visible here.
+		if batch, ok := h.workQueue.Get(opID); ok && isOperation(batch) {
+			if batch.Items[0].TenantID != id {
+				writeError(w, http.StatusNotFound, "operation not found")
+				return
+			}
+			writeResponse(w, r, http.StatusOK, OperationResponse{Operation: operationState(batch)})
+			return
+		}
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotFound, "operation not found")
+		return
+	}
+	op, ok, err := h.registry.Operation(opID)
+	if err != nil {
+		logf(r, "GetOperation error: tenant=%s operation=%s err=%v", id, opID, err)
+		writeError(w, http.StatusInternalServerError, "failed to read operation")
+		return
+	}
+	if !ok || op.TenantID != id {
+		writeError(w, http.StatusNotFound, "operation not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, OperationResponse{Operation: op})
+}
+
+// isOperation reports whether a work queue batch is a tenant operation.
+func isOperation(b *workqueue.Batch) bool {
+	return tenantOperations[b.Action] && len(b.Items) == 1
+}
+
+// operationState describes a single-item batch as an operation, as of now.
+func operationState(b *workqueue.Batch) registry.Operation {
+	item := b.Items[0]
+	op := registry.Operation{
+		ID:                   b.ID,
+		Action:               b.Action,
+		TenantID:             item.TenantID,
+		Status:               item.Status,
+		QueuePosition:        b.QueuePosition,
+		EstimatedWaitSeconds: b.EstimatedWaitSeconds,
+		Error:                item.Error,
+		CreatedAt:            b.CreatedAt,
+		UpdatedAt:            time.Now().UTC(),
+		FinishedAt:           b.FinishedAt,
+	}
+	if op.Status == "pending" {
+		op.Status = "queued"
+	}
+	return op
+}
+
+// trackOperation writes a newly queued operation to the registry and
+// remembers it, so that RunOperationSync keeps its queue position current.
+func (h *Handler) trackOperation(op registry.Operation) {
+	if h.registry == nil {
+		return
+	}
+	h.putOperation(op)
+	h.opMu.Lock()
+	h.queuedOps[op.ID] = true
+	h.opMu.Unlock()
+}
+
+// saveOperation writes the current state of an operation queued on this
+// replica to the registry.
+func (h *Handler) saveOperation(opID string) {
+	if h.registry == nil {
+		return
+	}
+	if batch, ok := h.workQueue.Get(opID); ok {
+		h.putOperation(operationState(batch))
+	}
+}
+
+// finishOperation writes an operation's outcome to the registry. The work
+// queue records it only once the operation's function returns, so the
+// outcome is written here rather than read back from the queue.
+func (h *Handler) finishOperation(opID string, err error) {
+	if h.registry == nil {
+		return
+	}
+	h.opMu.Lock()
+	delete(h.queuedOps, opID)
+	h.opMu.Unlock()
+	batch, ok := h.workQueue.Get(opID)
+	if !ok {
+		return
+	}
+	op := operationState(batch)
+	now := time.Now().UTC()
+	op.Status, op.QueuePosition, op.EstimatedWaitSeconds, op.FinishedAt = "succeeded", 0, 0, &now
+	if err != nil {
+		op.Status, op.Error = "failed", err.Error()
+	}
+	h.putOperation(op)
+}
+
+func (h *Handler) putOperation(op registry.Operation) {
+	if err := h.registry.PutOperation(op); err != nil {
+		log.Printf("operations: %v", err)
+	}
+}
+
+// RunOperationSync writes the queue position and estimated wait of the
+// operations still queued on this replica to the registry every interval,
+// until ctx is cancelled, so that status requests served by other replicas
+// see them move up the queue.
+func (h *Handler) RunOperationSync(ctx context.Context, interval time.Duration) {
+	if h.registry == nil || h.workQueue == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.opMu.Lock()
+		ids := make([]string, 0, len(h.queuedOps))
+		for id := range h.queuedOps {
+			ids = append(ids, id)
+		}
+		h.opMu.Unlock()
+		for _, id := range ids {
+			batch, ok := h.workQueue.Get(id)
+			if !ok {
+				h.opMu.Lock()
+				delete(h.queuedOps, id)
+				h.opMu.Unlock()
+				continue
+			}
+			if op := operationState(batch); op.Status == "queued" {
+				h.putOperation(op)
+			}
+		}
+	}
+}
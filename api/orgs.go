@@ -0,0 +1,614 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/caller"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+)
+
+// orgIDRe matches an organization ID, which instances carry as their "org"
+// label.
+var orgIDRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Errors that abandon an organization update, for the handlers to answer.
+var (
+	errOrgNotFound  = errors.New("organization not found")
+	errOrgTokenGone = errors.New("token not found")
+	errOrgRefused   = errors.New("create refused")
+	errOrgDryRun    = errors.New("dry run") // Checks passed; nothing to store
+	errCreateNotRun = errors.New("create did not run")
+)
+
+type orgContextKey struct{}
+
+// orgFromContext returns the organization authenticated by RequireOrgToken,
+// or "".
+func orgFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(orgContextKey{}).(string)
+	return id
+}
+
+// OrgRequest is the body of PutOrg. Zero quotas are unlimited, and an empty
+// max_plan allows any plan.
+type OrgRequest struct {
+	Name         string `json:"name"`
+	MaxTenants   int    `json:"max_tenants"`
+	MaxInstances int    `json:"max_instances"`
+	MaxPlan      string `json:"max_plan"` // One of PLAN_TIERS
+}
+
+// OrgResponse describes an organization and its use of its quotas. Tokens
+// are listed without their values.
+type OrgResponse struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	MaxTenants   int                `json:"max_tenants"`
+	MaxInstances int                `json:"max_instances"`
+	MaxPlan      string             `json:"max_plan,omitempty"`
+	Tenants      []string           `json:"tenants"`
+	Instances    int                `json:"instances"` // Live instances of its tenants
+	Tokens       []OrgTokenResponse `json:"tokens"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+}
+
+// OrgTokenResponse describes an organization token. Token is only returned
+// when the token is created.
+type OrgTokenResponse struct {
+	ID        string    `json:"id"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OrgTenantResponse is a tenant of an organization with its live instances.
+type OrgTenantResponse struct {
+	TenantID  string                `json:"tenant_id"`
+	Instances []OrgInstanceResponse `json:"instances"`
+}
+
+// OrgInstanceResponse is an instance of an organization's tenant, as last
+// seen in the cluster.
+type OrgInstanceResponse struct {
+	Name        string `json:"name"`
+	Plan        string `json:"plan,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Status      string `json:"status"`
+}
+
+func (h *Handler) orgResponse(o registry.Organization) OrgResponse {
+	tokens := make([]OrgTokenResponse, 0, len(o.Tokens))
+	for _, t := range o.Tokens {
+		tokens = append(tokens, OrgTokenResponse{ID: t.ID, CreatedAt: t.CreatedAt})
+	}
+	tenants := o.Tenants
+	if tenants == nil {
+		tenants = []string{}
+	}
+	return OrgResponse{
+		ID:           o.ID,
+		Name:         o.Name,
+		MaxTenants:   o.MaxTenants,
+		MaxInstances: o.MaxInstances,
+		MaxPlan:      o.MaxPlan,
+		Tenants:      tenants,
+		Instances:    len(h.registry.TenantRecords(o.Tenants)),
+		Tokens:       tokens,
+		CreatedAt:    o.CreatedAt,
+		UpdatedAt:    o.UpdatedAt,
+	}
+}
+
+// orgID returns the validated {org-id} URL parameter. On an invalid ID, or
+// without a registry, it writes an error response and returns "".
+func (h *Handler) orgID(w http.ResponseWriter, r *http.Request) string {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "organizations need the registry")
+		return ""
+	}
+	id := chi.URLParam(r, "org-id")
+	if !orgIDRe.MatchString(id) {
+		writeError(w, http.StatusBadRequest, "invalid organization ID: must be a DNS label such as acme")
+		return ""
+	}
+	return id
+}
+
+// planRank returns the position of plan in PLAN_TIERS, or -1.
+func (h *Handler) planRank(plan string) int {
+	return slices.Index(h.cfg.PlanTiers, plan)
+}
+
+// ListOrgs handles GET /admin/orgs — every organization, ordered by ID.
+func (h *Handler) ListOrgs(w http.ResponseWriter, r *http.Request) {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "organizations need the registry")
+		return
+	}
+	orgs, err := h.registry.Organizations()
+	if err != nil {
+		logf(r, "ListOrgs error: err=%v", err)
+		writeError(w, http.StatusInternalServerError, "failed to read organizations")
+		return
+	}
+	resp := make([]OrgResponse, 0, len(orgs))
+	for _, o := range orgs {
+		resp = append(resp, h.orgResponse(o))
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// GetOrg handles GET /admin/orgs/{org-id}.
+func (h *Handler) GetOrg(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	o, ok, err := h.registry.Organization(id)
+	if err != nil {
+		logf(r, "GetOrg error: org=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read organization")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.orgResponse(o))
+}
+
+// PutOrg handles PUT /admin/orgs/{org-id} — creates the organization, or
+// replaces its name, quotas and plan ceiling. Lowering a quota below what is
+// in use refuses further creates but leaves existing tenants alone.
+func (h *Handler) PutOrg(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	var req OrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.MaxTenants < 0 || req.MaxInstances < 0 {
+		writeError(w, http.StatusBadRequest, "max_tenants and max_instances must not be negative")
+		return
+	}
+	if req.MaxPlan != "" && h.planRank(req.MaxPlan) < 0 {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid max_plan: must be one of %s", strings.Join(h.cfg.PlanTiers, ", ")))
+		return
+	}
+	if req.Name == "" {
+		req.Name = id
+	}
+	created := false
+	o, err := h.registry.UpdateOrganization(id, func(o *registry.Organization, found bool) error {
+		created = !found
+		o.Name, o.MaxTenants, o.MaxInstances, o.MaxPlan = req.Name, req.MaxTenants, req.MaxInstances, req.MaxPlan
+		return nil
+	})
+	h.recordAudit(r, "org.update", "", "org="+id, err)
+	if err != nil {
+		logf(r, "PutOrg error: org=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save organization")
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, h.orgResponse(o))
+}
+
+// DeleteOrg handles DELETE /admin/orgs/{org-id}. An organization whose
+// tenants still have instances is kept, answering 409.
+func (h *Handler) DeleteOrg(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	o, ok, err := h.registry.Organization(id)
+	if err != nil {
+		logf(r, "DeleteOrg error: org=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read organization")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+	if len(h.registry.TenantRecords(o.Tenants)) > 0 {
+		writeError(w, http.StatusConflict, "organization has tenants with instances")
+		return
+	}
+	err = h.registry.DeleteOrganization(id)
+	h.recordAudit(r, "org.delete", "", "org="+id, err)
+	if err != nil {
+		logf(r, "DeleteOrg error: org=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete organization")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateOrgToken handles POST /admin/orgs/{org-id}/tokens — issues an API
+// token for the organization's /org endpoints. The token is only returned
+// here; the registry keeps its digest.
+func (h *Handler) CreateOrgToken(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	token := OrgTokenResponse{ID: correlation.NewID(), Token: "org_" + generateToken(), CreatedAt: time.Now().UTC()}
+	_, err := h.registry.UpdateOrganization(id, func(o *registry.Organization, found bool) error {
+		if !found {
+			return errOrgNotFound
+		}
+		o.Tokens = append(o.Tokens, registry.OrgToken{ID: token.ID, Digest: registry.TokenDigest(token.Token), CreatedAt: token.CreatedAt})
+		return nil
+	})
+	if errors.Is(err, errOrgNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	h.recordAudit(r, "org.token.create", "", "org="+id+" token="+token.ID, err)
+	if err != nil {
+		logf(r, "CreateOrgToken error: org=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save organization")
+		return
+	}
+	writeJSON(w, http.StatusCreated, token)
+}
+
+// RevokeOrgToken handles DELETE /admin/orgs/{org-id}/tokens/{token-id}.
+func (h *Handler) RevokeOrgToken(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	tokenID := chi.URLParam(r, "token-id")
+	_, err := h.registry.UpdateOrganization(id, func(o *registry.Organization, found bool) error {
+		if !found {
+			return errOrgNotFound
+		}
+		i := slices.IndexFunc(o.Tokens, func(t registry.OrgToken) bool { return t.ID == tokenID })
+		if i < 0 {
+			return errOrgTokenGone
+		}
+		o.Tokens = slices.Delete(o.Tokens, i, i+1)
+		return nil
+	})
+	if errors.Is(err, errOrgNotFound) || errors.Is(err, errOrgTokenGone) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	h.recordAudit(r, "org.token.revoke", "", "org="+id+" token="+tokenID, err)
+	if err != nil {
+		logf(r, "RevokeOrgToken error: org=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save organization")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// OrgUsageResponse is an organization's usage for one billing period, ready
+// to invoice: a line per member tenant and their totals.
+type OrgUsageResponse struct {
+	OrgID   string `json:"org_id"`
+	OrgName string `json:"org_name"`
+	*usage.Rollup
+}
+
+// writeOrgUsage writes the usage rollup of o for the month r asks for, as
+// CSV or as JSON or YAML; see GetUsageReport.
+func (h *Handler) writeOrgUsage(w http.ResponseWriter, r *http.Request, o registry.Organization) {
+	report, ok := h.usageReport(w, r)
+	if !ok {
+		return
+	}
+	rollup := report.Rollup(o.Tenants)
+	if wantsCSV(r) {
+		writeCSVHeaders(w, "usage-"+o.ID+"-"+rollup.Month+".csv")
+		if err := rollup.WriteCSV(w); err != nil {
+			logf(r, "writeOrgUsage: writing CSV: %v", err)
+		}
+		return
+	}
+	writeResponse(w, r, http.StatusOK, OrgUsageResponse{OrgID: o.ID, OrgName: o.Name, Rollup: rollup})
+}
+
+// GetOrgUsage handles GET /admin/orgs/{org-id}/usage?month=2006-01 — the
+// instance-hours, storage, snapshots and AI usage of every tenant of the
+// organization for a calendar month, with their totals.
+func (h *Handler) GetOrgUsage(w http.ResponseWriter, r *http.Request) {
+	id := h.orgID(w, r)
+	if id == "" {
+		return
+	}
+	o, ok, err := h.registry.Organization(id)
+	if err != nil {
+		logf(r, "GetOrgUsage error: org=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read organization")
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "organization not found")
+		return
+	}
+	h.writeOrgUsage(w, r, o)
+}
+
+// RequireOrgToken restricts a route group to organizations presenting one
+// of their API tokens as a bearer token. The organization is stored in the
+// request context, and the caller is recorded for auditing as "org:<id>".
+func (h *Handler) RequireOrgToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.registry == nil {
+			writeError(w, http.StatusNotImplemented, "organizations need the registry")
+			return
+		}
+		presented := bearerToken(r)
+		o, ok, err := h.registry.OrganizationByToken(presented)
+		if err != nil {
+			logf(r, "RequireOrgToken error: err=%v", err)
+			writeError(w, http.StatusInternalServerError, "failed to read organizations")
+			return
+		}
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "invalid organization token")
+			return
+		}
+		ctx := context.WithValue(r.Context(), orgContextKey{}, o.ID)
+		ctx = caller.NewContext(ctx, caller.Identity{User: "org:" + o.ID})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OrgTenant limits the /org/tenants/{tenant-id} routes to the
+// organization's tenants. Creates may also name a new tenant, which
+// admitOrgCreate adds to the organization.
+func (h *Handler) OrgTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := tenantID(w, r)
+		if id == "" {
+			return
+		}
+		if r.Method != http.MethodPost {
+			o, _, err := h.registry.Organization(orgFromContext(r.Context()))
+			if err != nil {
+				logf(r, "OrgTenant error: tenant=%s err=%v", id, err)
+				writeError(w, http.StatusInternalServerError, "failed to read organization")
+				return
+			}
+			if !o.HasTenant(id) {
+				writeError(w, http.StatusNotFound, "tenant not found")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// selfOrg returns the organization authenticated by RequireOrgToken. On
+// failure it writes an error response and returns ok=false.
+func (h *Handler) selfOrg(w http.ResponseWriter, r *http.Request) (registry.Organization, bool) {
+	o, ok, err := h.registry.Organization(orgFromContext(r.Context()))
+	if err != nil || !ok {
+		logf(r, "selfOrg error: org=%s found=%t err=%v", orgFromContext(r.Context()), ok, err)
+		writeError(w, http.StatusInternalServerError, "failed to read organization")
+		return registry.Organization{}, false
+	}
+	return o, true
+}
+
+// GetSelfOrg handles GET /org — the caller's organization, with its quotas
+// and their use.
+func (h *Handler) GetSelfOrg(w http.ResponseWriter, r *http.Request) {
+	o, ok := h.selfOrg(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.orgResponse(o))
+}
+
+// ListSelfOrgTenants handles GET /org/tenants — the caller's tenants with
+// their live instances, as last seen in the cluster.
+func (h *Handler) ListSelfOrgTenants(w http.ResponseWriter, r *http.Request) {
+	o, ok := h.selfOrg(w, r)
+	if !ok {
+		return
+	}
+	resp := make([]OrgTenantResponse, 0, len(o.Tenants))
+	byTenant := make(map[string]int, len(o.Tenants))
+	for _, t := range o.Tenants {
+		byTenant[t] = len(resp)
+		resp = append(resp, OrgTenantResponse{TenantID: t, Instances: []OrgInstanceResponse{}})
+	}
+	for _, rec := range h.registry.TenantRecords(o.Tenants) {
+		t := &resp[byTenant[rec.TenantID]]
+		t.Instances = append(t.Instances, OrgInstanceResponse{
+			Name:        rec.InstanceName,
+			Plan:        rec.Plan,
+			Environment: rec.Labels["environment"],
+			Status:      rec.Status,
+		})
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// GetSelfOrgUsage handles GET /org/usage?month=2006-01 — the caller's usage
+// rollup; see GetOrgUsage.
+func (h *Handler) GetSelfOrgUsage(w http.ResponseWriter, r *http.Request) {
+	o, ok := h.selfOrg(w, r)
+	if !ok {
+		return
+	}
+	h.writeOrgUsage(w, r, o)
+}
+
+// orgCreateRefusal returns why o, whose tenants hold instances instances,
+// may not create an instance on plan for the tenant, or "". Under a plan
+// ceiling a create must resolve to a plan, named or its profile's, as one
+// without could provision anything.
+func (h *Handler) orgCreateRefusal(o registry.Organization, tenantID, plan string, instances int) (string, error) {
+	if o.MaxPlan != "" {
+		if plan == "" {
+			return fmt.Sprintf("a plan is required under the organization's plan ceiling %s", o.MaxPlan), nil
+		}
+		if rank := h.planRank(plan); rank < 0 || rank > h.planRank(o.MaxPlan) {
+			return fmt.Sprintf("plan %q is above the organization's plan ceiling %s", plan, o.MaxPlan), nil
+		}
+	}
+	if !o.HasTenant(tenantID) {
+		other, ok, err := h.registry.TenantOrganization(tenantID)
+		if err != nil {
+			return "", err
+		}
+		if ok && other.ID != o.ID {
+			return "tenant belongs to another organization", nil
+		}
+		if len(h.registry.TenantRecords([]string{tenantID})) > 0 {
+			return "tenant is not in the organization", nil
+		}
+		if o.MaxTenants > 0 && len(o.Tenants) >= o.MaxTenants {
+			return fmt.Sprintf("organization quota exceeded: %d of %d tenants", len(o.Tenants), o.MaxTenants), nil
+		}
+	}
+	if o.MaxInstances > 0 && instances >= o.MaxInstances {
+		return fmt.Sprintf("organization quota exceeded: %d of %d instances", instances, o.MaxInstances), nil
+	}
+	return "", nil
+}
+
+// orgInstances counts the instances of o's tenants: those in the cluster,
+// read from the API server since the registry learns of new ones from the
+// watch, and the creates admitted and not yet finished. Callers hold
+// h.orgMu.
+func (h *Handler) orgInstances(ctx context.Context, o registry.Organization) (int, error) {
+	if o.MaxInstances <= 0 {
+		return 0, nil
+	}
+	all, err := h.k8sManager.ListInstances(ctx)
+	if err != nil {
+		return 0, err
+	}
+	n := h.orgPending[o.ID]
+	for _, inst := range all {
+		if o.HasTenant(inst.TenantID) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// admitOrgCreate enforces the quotas and plan ceiling of the organization a
+// create is made through, labels the instance with the organization and,
+// unless the create is a dry run, adds the tenant to it. Creates made
+// without an organization token are admitted as they are. On refusal it
+// writes a 403 and returns false. Admissions are serialised, and an
+// admitted create counts against the instance quota until it finishes:
+// pass its error to the returned function, which also takes a tenant added
+// for a failed create out of the organization again.
+func (h *Handler) admitOrgCreate(w http.ResponseWriter, r *http.Request, id string, opts *k8s.CreateOptions) (func(error), bool) {
+	orgID := orgFromContext(r.Context())
+	if orgID == "" {
+		return func(error) {}, true
+	}
+	h.orgMu.Lock()
+	defer h.orgMu.Unlock()
+
+	var reason string
+	added := false
+	o, ok, err := h.registry.Organization(orgID)
+	if err == nil && !ok {
+		err = errOrgNotFound
+	}
+	var instances int
+	if err == nil {
+		instances, err = h.orgInstances(r.Context(), o)
+	}
+	if err == nil {
+		_, err = h.registry.UpdateOrganization(orgID, func(o *registry.Organization, found bool) error {
+			if !found {
+				return errOrgNotFound
+			}
+			var err error
+			if reason, err = h.orgCreateRefusal(*o, id, opts.Plan, instances); err != nil {
+				return err
+			}
+			if reason != "" {
+				return errOrgRefused
+			}
+			if opts.DryRun {
+				return errOrgDryRun
+			}
+			if !o.HasTenant(id) {
+				o.Tenants = append(o.Tenants, id)
+				added = true
+			}
+			return nil
+		})
+	}
+	switch {
+	case errors.Is(err, errOrgRefused):
+		h.recordAudit(r, "instance.create", id, "", errors.New(reason))
+		logf(r, "CreateInstance refused: tenant=%s org=%s reason=%s", id, orgID, reason)
+		writeError(w, http.StatusForbidden, reason)
+		return nil, false
+	case err != nil && !errors.Is(err, errOrgDryRun):
+		logf(r, "CreateInstance error: tenant=%s org=%s err=%v", id, orgID, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read organization")
+		return nil, false
+	}
+	opts.Organization = orgID
+	if opts.DryRun {
+		return func(error) {}, true
+	}
+	h.orgPending[orgID]++
+	return func(err error) {
+		h.orgMu.Lock()
+		defer h.orgMu.Unlock()
+		if h.orgPending[orgID]--; h.orgPending[orgID] <= 0 {
+			delete(h.orgPending, orgID)
+		}
+		if err != nil && added {
+			h.dropOrgTenant(orgID, id)
+		}
+	}, true
+}
+
+// dropOrgTenant takes a tenant added to an organization for a create that
+// failed out of it again, unless the tenant has instances after all.
+func (h *Handler) dropOrgTenant(orgID, tenantID string) {
+	if len(h.registry.TenantRecords([]string{tenantID})) > 0 {
+		return
+	}
+	_, err := h.registry.UpdateOrganization(orgID, func(o *registry.Organization, found bool) error {
+		if !found {
+			return errOrgNotFound
+		}
+		o.Tenants = slices.DeleteFunc(o.Tenants, func(t string) bool { return t == tenantID })
+		return nil
+	})
+	if err != nil && !errors.Is(err, errOrgNotFound) {
+		log.Printf("dropOrgTenant: org=%s tenant=%s err=%v", orgID, tenantID, err)
+	}
+}
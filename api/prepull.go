@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// imageRepositoryPattern matches an image repository with its registry host,
+// such as ghcr.io/openclaw/openclaw.
+var imageRepositoryPattern = regexp.MustCompile(`^[a-z0-9.-]+(:[0-9]+)?(/[a-z0-9._-]+)+$`)
+
+// PrePullRequest is the JSON body accepted by StartPrePull.
+type PrePullRequest struct {
+	ImageTag   string `json:"image_tag"`
+	Repository string `json:"repository"` // The instance image when omitted
+}
+
+// StartPrePull handles POST /admin/prepulls — starts pulling an image onto
+// every node, ahead of a fleet upgrade or a wave of signups, so that new and
+// upgraded instances start without waiting for the pull.
+func (h *Handler) StartPrePull(w http.ResponseWriter, r *http.Request) {
+	var req PrePullRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !imageTagPattern.MatchString(req.ImageTag) {
+		writeError(w, http.StatusBadRequest, "a valid image_tag is required")
+		return
+	}
+	if req.Repository == "" {
+		req.Repository = k8s.DefaultImageRepository
+	}
+	if !imageRepositoryPattern.MatchString(req.Repository) {
+		writeError(w, http.StatusBadRequest, "repository must be an image repository such as ghcr.io/openclaw/openclaw")
+		return
+	}
+
+	id := generateToken()[:12]
+	p, err := h.k8sManager.StartPrePull(r.Context(), id, req.Repository, req.ImageTag)
+	h.recordAudit(r, "prepull.start", "", "prepull="+id+" image="+req.Repository+":"+req.ImageTag, err)
+	var invalid *k8s.InvalidSpecError
+	if errors.As(err, &invalid) {
+		writeError(w, http.StatusBadRequest, invalid.Message)
+		return
+	}
+	if err != nil {
+		logf(r, "StartPrePull error: image=%s:%s err=%v", req.Repository, req.ImageTag, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to start pre-pull")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, p)
+}
+
+// ListPrePulls handles GET /admin/prepulls — every pre-pull, newest first,
+// with the number of nodes that have the image.
+func (h *Handler) ListPrePulls(w http.ResponseWriter, r *http.Request) {
+	list, err := h.k8sManager.PrePulls(r.Context())
+	if err != nil {
+		logf(r, "ListPrePulls error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to list pre-pulls")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, list)
+}
+
+// GetPrePull handles GET /admin/prepulls/{prepull-id} — the progress of one
+// pre-pull.
+func (h *Handler) GetPrePull(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "prepull-id")
+	p, err := h.k8sManager.GetPrePull(r.Context(), id)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "pre-pull not found")
+		return
+	}
+	if err != nil {
+		logf(r, "GetPrePull error: prepull=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to read pre-pull")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, p)
+}
+
+// DeletePrePull handles DELETE /admin/prepulls/{prepull-id} — removes a
+// pre-pull's pods once it is complete or no longer wanted. Pulled images stay
+// on the nodes.
+func (h *Handler) DeletePrePull(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "prepull-id")
+	err := h.k8sManager.DeletePrePull(r.Context(), id)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "pre-pull not found")
+		return
+	}
+	h.recordAudit(r, "prepull.delete", "", "prepull="+id, err)
+	if err != nil {
+		logf(r, "DeletePrePull error: prepull=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete pre-pull")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// RebuildRequest is the JSON body accepted by Rebuild.
+type RebuildRequest struct {
+	Context   string   `json:"context,omitempty"` // Kubeconfig context; the active one when empty
+	Namespace string   `json:"namespace"`
+	Tenants   []string `json:"tenants,omitempty"` // Restrict the rebuild to these tenants
+	DryRun    bool     `json:"dry_run,omitempty"`
+}
+
+// Rebuild handles POST /admin/rebuild — re-creates every live instance in the
+// registry into a fresh cluster and/or namespace, restoring volumes from their
+// latest snapshots, for region-loss recovery and recovery drills.
+func (h *Handler) Rebuild(w http.ResponseWriter, r *http.Request) {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "instance registry is not configured")
+		return
+	}
+
+	var req RebuildRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if errs := validation.IsDNS1123Label(req.Namespace); len(errs) > 0 {
+		writeError(w, http.StatusBadRequest, "invalid namespace: "+errs[0])
+		return
+	}
+	if req.Context != "" && !slices.Contains(h.cfg.KubeContexts, req.Context) {
+		writeError(w, http.StatusBadRequest, "context must be one of KUBE_CONTEXTS")
+		return
+	}
+	if req.Context == "" && req.Namespace == h.cfg.Namespace {
+		writeError(w, http.StatusBadRequest, "refusing to rebuild into the live namespace")
+		return
+	}
+
+	only := make(map[string]bool, len(req.Tenants))
+	for _, t := range req.Tenants {
+		only[t] = true
+	}
+	var instances []k8s.RebuildInstance
+	for _, rec := range h.registry.List() {
+		if rec.DeletedAt != nil || (len(only) > 0 && !only[rec.TenantID]) {
+			continue
+		}
+		instances = append(instances, k8s.RebuildInstance{
+			Name:        rec.InstanceName,
+			TenantID:    rec.TenantID,
+			Labels:      rec.Labels,
+			Annotations: rec.Annotations,
+			Spec:        rec.Spec,
+		})
+	}
+
+	report, err := h.k8sManager.Rebuild(r.Context(), k8s.RebuildOptions{
+		Context:   req.Context,
+		Namespace: req.Namespace,
+		DryRun:    req.DryRun,
+	}, instances)
+	if !req.DryRun {
+		detail := fmt.Sprintf("context=%s namespace=%s instances=%d", req.Context, req.Namespace, len(instances))
+		h.recordAudit(r, "registry.rebuild", "", detail, err)
+	}
+	if err != nil {
+		logf(r, "Rebuild error: namespace=%s err=%v", req.Namespace, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "rebuild failed")
+		return
+	}
+
+	failed := 0
+	for _, res := range report.Results {
+		if res.Status == "failed" {
+			failed++
+		}
+	}
+	logf(r, "Rebuild: context=%s namespace=%s instances=%d failed=%d dry_run=%v",
+		report.Context, report.Namespace, len(report.Results), failed, report.DryRun)
+	writeResponse(w, r, http.StatusOK, report)
+}
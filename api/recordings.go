@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/recording"
+)
+
+// RecordExchanges records the requests and responses of callers whose API
+// key has recording turned on (see POST /admin/debug/recordings). Requests
+// to /admin/debug themselves are never recorded. With a nil rec it does
+// nothing.
+func RecordExchanges(rec *recording.Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if rec == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := bearerToken(r)
+			if key == "" || strings.HasPrefix(r.URL.Path, "/admin/debug/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			keyID := recording.KeyID(key)
+			if !rec.Active(keyID) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			reqBody, reqTruncated := captureBody(r, rec.MaxBody())
+			rw := &recordingWriter{ResponseWriter: w, max: rec.MaxBody(), status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			rec.Add(keyID, recording.Exchange{
+				Time:            start.UTC(),
+				Duration:        time.Since(start).Round(time.Millisecond).String(),
+				CorrelationID:   correlation.FromContext(r.Context()),
+				Method:          r.Method,
+				URL:             r.URL.RequestURI(),
+				RemoteAddr:      r.RemoteAddr,
+				RequestHeaders:  r.Header,
+				RequestBody:     reqBody,
+				Status:          rw.status,
+				ResponseHeaders: w.Header(),
+				ResponseBody:    rw.body.String(),
+				Truncated:       reqTruncated || rw.truncated,
+			})
+		})
+	}
+}
+
+// captureBody reads up to max bytes of the request body for the recording
+// and puts them back in front of the rest, so that the handler reads the
+// body unchanged.
+func captureBody(r *http.Request, max int) (string, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", false
+	}
+	head, _ := io.ReadAll(io.LimitReader(r.Body, int64(max)+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if len(head) > max {
+		return string(head[:max]), true
+	}
+	return string(head), false
+}
+
+// recordingWriter keeps the status and the first max bytes of a response
+// as it is written.
+type recordingWriter struct {
+	http.ResponseWriter
+	max       int
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	if room := w.max - w.body.Len(); room < len(p) {
+		w.body.Write(p[:max(room, 0)])
+		w.truncated = true
+	} else {
+		w.body.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (w *recordingWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// RecordingRequest is the JSON body accepted by StartRecording. Exactly one
+// of Key and KeyID names the API key; a key is only used to compute its ID.
+type RecordingRequest struct {
+	Key      string `json:"key"`
+	KeyID    string `json:"key_id"`
+	Duration string `json:"duration"` // Go duration; RECORDING_MAX_DURATION when empty
+}
+
+// RecordingsResponse is a key's recording session and its exchanges, newest
+// first.
+type RecordingsResponse struct {
+	Session   recording.Session    `json:"session"`
+	Exchanges []recording.Exchange `json:"exchanges"`
+}
+
+// ListRecordings handles GET /admin/debug/recordings — lists the keys being
+// recorded, or whose recordings are still held.
+func (h *Handler) ListRecordings(w http.ResponseWriter, r *http.Request) {
+	if h.recordings == nil {
+		writeError(w, http.StatusNotImplemented, "request recording is not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.recordings.Sessions())
+}
+
+// StartRecording handles POST /admin/debug/recordings — turns recording on
+// for an API key, or extends it, for the requested duration.
+func (h *Handler) StartRecording(w http.ResponseWriter, r *http.Request) {
+	if h.recordings == nil {
+		writeError(w, http.StatusNotImplemented, "request recording is not configured")
+		return
+	}
+	var req RecordingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	keyID := req.KeyID
+	switch {
+	case req.Key != "" && req.KeyID != "":
+		writeError(w, http.StatusBadRequest, "set key or key_id, not both")
+		return
+	case req.Key != "":
+		keyID = recording.KeyID(req.Key)
+	case !recording.ValidKeyID(req.KeyID):
+		writeError(w, http.StatusBadRequest, "invalid key_id: must be of the form key_<16 hex digits>")
+		return
+	}
+	d := h.cfg.RecordingMaxDuration
+	if req.Duration != "" {
+		parsed, err := time.ParseDuration(req.Duration)
+		if err != nil || parsed <= 0 || parsed > h.cfg.RecordingMaxDuration {
+			writeError(w, http.StatusBadRequest, "invalid duration: must be positive and at most "+h.cfg.RecordingMaxDuration.String())
+			return
+		}
+		d = parsed
+	}
+
+	session := h.recordings.Start(keyID, d)
+	h.recordAudit(r, "recording.start", "", "key_id="+keyID+" until="+session.ExpiresAt.Format(time.RFC3339), nil)
+	logf(r, "StartRecording: key_id=%s until=%s", keyID, session.ExpiresAt.Format(time.RFC3339))
+	writeResponse(w, r, http.StatusOK, session)
+}
+
+// GetRecordings handles GET /admin/debug/recordings/{key-id} — the recorded
+// exchanges of a key, newest first.
+func (h *Handler) GetRecordings(w http.ResponseWriter, r *http.Request) {
+	if h.recordings == nil {
+		writeError(w, http.StatusNotImplemented, "request recording is not configured")
+		return
+	}
+	session, exchanges, ok := h.recordings.Exchanges(chi.URLParam(r, "key-id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "no recordings for this key")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, RecordingsResponse{Session: session, Exchanges: exchanges})
+}
+
+// StopRecording handles DELETE /admin/debug/recordings/{key-id} — turns
+// recording off for a key and discards its exchanges.
+func (h *Handler) StopRecording(w http.ResponseWriter, r *http.Request) {
+	if h.recordings == nil {
+		writeError(w, http.StatusNotImplemented, "request recording is not configured")
+		return
+	}
+	keyID := chi.URLParam(r, "key-id")
+	if !h.recordings.Stop(keyID) {
+		writeError(w, http.StatusNotFound, "no recordings for this key")
+		return
+	}
+	h.recordAudit(r, "recording.stop", "", "key_id="+keyID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+)
+
+// GetUsageReport handles GET /admin/reports/usage?month=2006-01 — returns
+// per-tenant instance-hours, storage, snapshots and plan for a calendar month
+// (the current one when month is omitted). The report is CSV when ?format=csv
+// is given or the Accept header asks for text/csv, and JSON or YAML otherwise.
+func (h *Handler) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	report, ok := h.usageReport(w, r)
+	if !ok {
+		return
+	}
+	if wantsCSV(r) {
+		writeCSVHeaders(w, "usage-"+report.Month+".csv")
+		if err := report.WriteCSV(w); err != nil {
+			logf(r, "GetUsageReport: writing CSV: %v", err)
+		}
+		return
+	}
+	writeResponse(w, r, http.StatusOK, report)
+}
+
+// usageReport returns the usage report of the month r asks for. On failure
+// it writes an error response and returns ok=false.
+func (h *Handler) usageReport(w http.ResponseWriter, r *http.Request) (*usage.Report, bool) {
+	if h.usage == nil {
+		writeError(w, http.StatusNotImplemented, "usage reporting is not configured")
+		return nil, false
+	}
+
+	now := time.Now().UTC()
+	month := now
+	if v := r.URL.Query().Get("month"); v != "" {
+		m, err := time.Parse("2006-01", v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid month: must be YYYY-MM")
+			return nil, false
+		}
+		month = m
+	}
+	return h.usage.Report(month, now), true
+}
+
+// wantsCSV reports whether r asks for CSV, with ?format=csv or an Accept
+// header of text/csv.
+func wantsCSV(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv")
+}
+
+// writeCSVHeaders starts a 200 response with a CSV attachment named name.
+func writeCSVHeaders(w http.ResponseWriter, name string) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// ReservationResponse is a reservation of a tenant's instance: the name and
+// URL the instance will have, held with its capacity until ExpiresAt.
+type ReservationResponse struct {
+	ID               string    `json:"id"`
+	TenantID         string    `json:"tenant_id"`
+	InstanceName     string    `json:"instance_name"`
+	Endpoint         string    `json:"endpoint"`
+	InternalEndpoint string    `json:"internal_endpoint,omitempty"`
+	Environment      string    `json:"environment,omitempty"`
+	Plan             string    `json:"plan,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+func reservationResponse(res registry.Reservation) ReservationResponse {
+	return ReservationResponse{
+		ID:               res.ID,
+		TenantID:         res.TenantID,
+		InstanceName:     res.InstanceName,
+		Endpoint:         res.Endpoint,
+		InternalEndpoint: res.InternalEndpoint,
+		Environment:      res.Environment,
+		Plan:             res.Plan,
+		CreatedAt:        res.CreatedAt,
+		ExpiresAt:        res.ExpiresAt,
+	}
+}
+
+// CommitReservationRequest is the optional JSON body of CommitReservation.
+type CommitReservationRequest struct {
+	GatewayToken string `json:"gateway_token"` // Generated when empty
+}
+
+// CreateReservation handles POST /tenants/{tenant-id}/instance/reservations —
+// the first phase of a two-phase create. It takes a create request, chooses
+// the instance's name and validates the instance as a dry-run create does,
+// then holds the name, the instance's capacity and the request for
+// RESERVATION_TTL without creating anything, so that the final URL can be
+// shown before the create is committed. A tenant holds at most one
+// reservation; a gateway token in the request is ignored.
+func (h *Handler) CreateReservation(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "reservations need the registry")
+		return
+	}
+
+	var req CreateInstanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.GatewayToken = ""
+	opts, err := h.checkCreateRequest(r, id, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Capacity is checked against the stored reservations, so a reservation
+	// is checked and stored under one lock; the store refuses a second one
+	// for the tenant made by another replica.
+	h.reserveMu.Lock()
+	defer h.reserveMu.Unlock()
+	held, err := h.registry.Reservations()
+	if err != nil {
+		logf(r, "CreateReservation error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read reservations")
+		return
+	}
+	for _, res := range held {
+		if res.TenantID == id {
+			writeError(w, http.StatusConflict, fmt.Sprintf("tenant already holds reservation %s", res.ID))
+			return
+		}
+	}
+	if !h.admitCreate(w, r, id) {
+		return
+	}
+
+	logf(r, "CreateReservation: tenant=%s profile=%s", id, profileName(opts.Profile))
+	info, hold, err := h.k8sManager.ReserveInstance(r.Context(), id, opts)
+	var invalid *k8s.InvalidSpecError
+	var capacity *k8s.CapacityError
+	switch {
+	case errors.As(err, &invalid):
+		h.recordAudit(r, "instance.reservation", id, "", err)
+		writeError(w, http.StatusBadRequest, invalid.Message)
+		return
+	case errors.As(err, &capacity):
+		h.recordAudit(r, "instance.reservation", id, "", err)
+		writeError(w, http.StatusServiceUnavailable, capacity.Error())
+		return
+	case err != nil:
+		h.recordAudit(r, "instance.reservation", id, "", err)
+		logf(r, "CreateReservation error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to reserve instance")
+		return
+	}
+
+	raw, err := json.Marshal(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to encode request")
+		return
+	}
+	now := time.Now().UTC()
+	res := registry.Reservation{
+		ID:               correlation.NewID(),
+		TenantID:         id,
+		InstanceName:     info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Plan:             opts.Plan,
+		CPU:              hold.CPU,
+		Memory:           hold.Memory,
+		Request:          raw,
+		CreatedAt:        now,
+		ExpiresAt:        now.Add(h.cfg.ReservationTTL),
+	}
+	existing, claimed, err := h.registry.ClaimReservation(res)
+	if err != nil {
+		logf(r, "CreateReservation error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to store reservation")
+		return
+	}
+	if !claimed {
+		writeError(w, http.StatusConflict, fmt.Sprintf("tenant already holds reservation %s", existing.ID))
+		return
+	}
+	h.recordAudit(r, "instance.reservation", id, "reservation="+res.ID+" instance="+res.InstanceName, nil)
+	w.Header().Set("Location", fmt.Sprintf("/tenants/%s/instance/reservations/%s", id, res.ID))
+	writeResponse(w, r, http.StatusCreated, reservationResponse(res))
+}
+
+// reservation looks up the tenant's unexpired reservation named in the
+// path. On failure it writes an error response and returns ok=false.
+func (h *Handler) reservation(w http.ResponseWriter, r *http.Request, id string) (res registry.Reservation, ok bool) {
+	if h.registry == nil {
+		writeError(w, http.StatusNotImplemented, "reservations need the registry")
+		return res, false
+	}
+	res, found, err := h.registry.Reservation(chi.URLParam(r, "reservation-id"))
+	if err != nil {
+		logf(r, "reservation error: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read reservation")
+		return res, false
+	}
+	if !found || res.TenantID != id {
+		writeError(w, http.StatusNotFound, "reservation not found")
+		return res, false
+	}
+	return res, true
+}
+
+// GetReservation handles GET
+// /tenants/{tenant-id}/instance/reservations/{reservation-id}.
+func (h *Handler) GetReservation(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	res, ok := h.reservation(w, r, id)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, reservationResponse(res))
+}
+
+// CommitReservation handles POST
+// /tenants/{tenant-id}/instance/reservations/{reservation-id}/commit — the
+// second phase of a two-phase create. The reserved request is validated
+// again and the instance is created under the reserved name, responding as
+// CreateInstance does. The reservation ends once the instance exists; a
+// failed commit leaves it in place to be retried until it expires.
+func (h *Handler) CommitReservation(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	res, ok := h.reservation(w, r, id)
+	if !ok {
+		return
+	}
+	var commit CommitReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&commit); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if commit.GatewayToken == "" {
+		commit.GatewayToken = generateToken()
+	}
+	var req CreateInstanceRequest
+	if err := json.Unmarshal(res.Request, &req); err != nil {
+		logf(r, "CommitReservation error: tenant=%s reservation=%s err=%v", id, res.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to read reservation")
+		return
+	}
+	req.GatewayToken = commit.GatewayToken
+	opts, err := h.checkCreateRequest(r, id, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	held := res.Held()
+	opts.Reservation = &held
+
+	logf(r, "CommitReservation: tenant=%s reservation=%s instance=%s", id, res.ID, res.InstanceName)
+	end := h.journalCreate(correlation.NewID(), id, &opts)
+	info, err := h.k8sManager.CreateInstance(r.Context(), id, opts)
+	end(err)
+	var invalid *k8s.InvalidSpecError
+	var capacity *k8s.CapacityError
+	switch {
+	case errors.As(err, &invalid):
+		h.recordAudit(r, "instance.create", id, "reservation="+res.ID, err)
+		writeError(w, http.StatusBadRequest, invalid.Message)
+		return
+	case errors.As(err, &capacity):
+		h.recordAudit(r, "instance.create", id, "reservation="+res.ID, err)
+		h.status.RecordProvisioning(false)
+		writeError(w, http.StatusServiceUnavailable, capacity.Error())
+		return
+	case err != nil:
+		h.recordAudit(r, "instance.create", id, "reservation="+res.ID, err)
+		h.status.RecordProvisioning(false)
+		logf(r, "CommitReservation error: tenant=%s reservation=%s err=%v", id, res.ID, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to create instance")
+		return
+	}
+	h.recordAudit(r, "instance.create", id, "reservation="+res.ID+" instance="+info.Name, nil)
+	h.status.RecordProvisioning(true)
+	if err := h.registry.DeleteReservation(res.ID); err != nil {
+		// It holds nothing that matters once it expires.
+		logf(r, "CommitReservation error: tenant=%s reservation=%s err=%v", id, res.ID, err)
+	}
+
+	if info.ResourceVersion != "" {
+		w.Header().Set("ETag", `"`+info.ResourceVersion+`"`)
+	}
+	writeJSON(w, http.StatusCreated, InstanceResponse{
+		Name:             info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           info.Status,
+		GatewayToken:     opts.GatewayToken,
+	})
+}
+
+// ReleaseReservation handles DELETE
+// /tenants/{tenant-id}/instance/reservations/{reservation-id} — gives up a
+// reservation, such as when checkout is abandoned, freeing its name and
+// capacity before it expires.
+func (h *Handler) ReleaseReservation(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	res, ok := h.reservation(w, r, id)
+	if !ok {
+		return
+	}
+	if err := h.registry.DeleteReservation(res.ID); err != nil {
+		logf(r, "ReleaseReservation error: tenant=%s reservation=%s err=%v", id, res.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to release reservation")
+		return
+	}
+	h.recordAudit(r, "instance.reservation.release", id, "reservation="+res.ID, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
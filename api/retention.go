@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// ReactivateInstance handles POST /tenants/{tenant-id}/instance/reactivate —
+// re-creates an instance deleted with ?retain_storage=true on its retained
+// volume, under its old name and endpoint. It accepts the same optional body
+// as CreateInstance.
+func (h *Handler) ReactivateInstance(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	opts, ok := h.createOptions(w, r, id)
+	if !ok {
+		return
+	}
+
+	logf(r, "ReactivateInstance: tenant=%s profile=%s", id, profileName(opts.Profile))
+
+	info, err := h.k8sManager.ReactivateInstance(r.Context(), id, opts)
+	var invalid *k8s.InvalidSpecError
+	var capacity *k8s.CapacityError
+	switch {
+	case errors.Is(err, k8s.ErrNoRetainedStorage):
+		h.recordAudit(r, "instance.reactivate", id, "", err)
+		writeError(w, http.StatusNotFound, "no retained storage to reactivate from")
+		return
+	case errors.Is(err, k8s.ErrInstanceExists):
+		h.recordAudit(r, "instance.reactivate", id, "", err)
+		writeError(w, http.StatusConflict, "tenant already has an instance")
+		return
+	case errors.As(err, &invalid):
+		h.recordAudit(r, "instance.reactivate", id, "", err)
+		logf(r, "ReactivateInstance rejected: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusBadRequest, invalid.Message)
+		return
+	case errors.As(err, &capacity):
+		h.recordAudit(r, "instance.reactivate", id, "", err)
+		h.status.RecordProvisioning(false)
+		logf(r, "ReactivateInstance refused: tenant=%s err=%v", id, err)
+		writeError(w, http.StatusServiceUnavailable, capacity.Error())
+		return
+	case err != nil:
+		h.recordAudit(r, "instance.reactivate", id, "", err)
+		h.status.RecordProvisioning(false)
+		logf(r, "ReactivateInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to reactivate instance")
+		return
+	}
+	h.recordAudit(r, "instance.reactivate", id, "instance="+info.Name, nil)
+	h.status.RecordProvisioning(true)
+
+	if info.ResourceVersion != "" {
+		w.Header().Set("ETag", `"`+info.ResourceVersion+`"`)
+	}
+	writeJSON(w, http.StatusCreated, InstanceResponse{
+		Name:             info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           info.Status,
+		GatewayToken:     opts.GatewayToken,
+	})
+}
+
+// ListRetainedStorage handles GET /admin/retained-storage — the volumes and
+// snapshots kept by deletes with ?retain_storage=true, soonest to expire
+// first.
+func (h *Handler) ListRetainedStorage(w http.ResponseWriter, r *http.Request) {
+	retained, err := h.k8sManager.RetainedStorage(r.Context())
+	if err != nil {
+		logf(r, "ListRetainedStorage error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to list retained storage")
+		return
+	}
+	if retained == nil {
+		retained = []k8s.RetainedArtifact{}
+	}
+	writeResponse(w, r, http.StatusOK, retained)
+}
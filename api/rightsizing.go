@@ -0,0 +1,64 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/rightsizing"
+)
+
+// ListRightsizing handles GET /admin/rightsizing — returns the right-sizing
+// recommendation for every instance with sampled usage.
+func (h *Handler) ListRightsizing(w http.ResponseWriter, r *http.Request) {
+	if h.rightsizing == nil {
+		writeError(w, http.StatusNotImplemented, "right-sizing is not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.rightsizing.Recommendations())
+}
+
+// ApplyRightsizing handles POST /admin/rightsizing/{tenant-id}/apply — sets
+// the tenant's resource requests to the recommended values.
+func (h *Handler) ApplyRightsizing(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.rightsizing == nil {
+		writeError(w, http.StatusNotImplemented, "right-sizing is not configured")
+		return
+	}
+	r, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	rec, err := h.rightsizing.Apply(r.Context(), id)
+	if errors.Is(err, rightsizing.ErrNothingToApply) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	detail := ""
+	if rec != nil {
+		detail = fmt.Sprintf("cpu=%dm memory=%d", rec.CPU.Recommended, rec.Memory.Recommended)
+	}
+	h.recordAudit(r, "instance.rightsize", id, detail, err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "ApplyRightsizing error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to apply recommendation")
+		return
+	}
+	h.setETag(w, r, id)
+	writeResponse(w, r, http.StatusOK, rec)
+}
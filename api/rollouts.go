@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/rollout"
+)
+
+// StartRolloutRequest is the JSON body accepted by StartRollout.
+type StartRolloutRequest struct {
+	ImageTag string `json:"image_tag"`
+}
+
+// ChannelRequest is the JSON body accepted by SetInstanceChannel.
+type ChannelRequest struct {
+	Channel string `json:"channel"`
+}
+
+// SetInstanceChannel handles PUT /tenants/{tenant-id}/instance/channel —
+// moves the tenant's instance to the stable, beta or canary release channel.
+func (h *Handler) SetInstanceChannel(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	var req ChannelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !rollout.ValidChannel(req.Channel) {
+		writeError(w, http.StatusBadRequest, "channel must be one of stable, beta or canary")
+		return
+	}
+	r, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.k8sManager.SetChannel(r.Context(), id, req.Channel)
+	h.recordAudit(r, "instance.channel", id, "channel="+req.Channel, err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "SetInstanceChannel error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to set channel")
+		return
+	}
+	h.setETag(w, r, id)
+	writeJSON(w, http.StatusOK, req)
+}
+
+// StartRollout handles POST /admin/rollouts — begins upgrading the fleet to
+// an image tag, canary channel first.
+func (h *Handler) StartRollout(w http.ResponseWriter, r *http.Request) {
+	if h.rollouts == nil {
+		writeError(w, http.StatusNotImplemented, "rollouts are not configured")
+		return
+	}
+	var req StartRolloutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !imageTagPattern.MatchString(req.ImageTag) {
+		writeError(w, http.StatusBadRequest, "a valid image_tag is required")
+		return
+	}
+
+	ro, err := h.rollouts.Start(req.ImageTag)
+	if errors.Is(err, rollout.ErrActive) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	h.recordAudit(r, "rollout.start", "", "rollout="+ro.ID+" image_tag="+req.ImageTag, err)
+	writeResponse(w, r, http.StatusAccepted, ro)
+}
+
+// ListRollouts handles GET /admin/rollouts — lists rollouts, newest first.
+func (h *Handler) ListRollouts(w http.ResponseWriter, r *http.Request) {
+	if h.rollouts == nil {
+		writeError(w, http.StatusNotImplemented, "rollouts are not configured")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.rollouts.List())
+}
+
+// GetRollout handles GET /admin/rollouts/{rollout-id} — reports a rollout's
+// progress through each channel.
+func (h *Handler) GetRollout(w http.ResponseWriter, r *http.Request) {
+	if h.rollouts == nil {
+		writeError(w, http.StatusNotImplemented, "rollouts are not configured")
+		return
+	}
+	ro, ok := h.rollouts.Get(chi.URLParam(r, "rollout-id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "rollout not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, ro)
+}
+
+// HaltRollout handles POST /admin/rollouts/{rollout-id}/halt — stops a
+// running rollout before its next promotion.
+func (h *Handler) HaltRollout(w http.ResponseWriter, r *http.Request) {
+	if h.rollouts == nil {
+		writeError(w, http.StatusNotImplemented, "rollouts are not configured")
+		return
+	}
+	id := chi.URLParam(r, "rollout-id")
+	ro, ok := h.rollouts.Halt(id, "halted by operator")
+	if !ok {
+		writeError(w, http.StatusNotFound, "rollout not found")
+		return
+	}
+	h.recordAudit(r, "rollout.halt", "", "rollout="+id, nil)
+	writeResponse(w, r, http.StatusOK, ro)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/secretscan"
+)
+
+// scanSecrets returns the credentials found in a tenant-provided value of
+// field, a string or a value decoded from JSON, or none when scanning is
+// off.
+func (h *Handler) scanSecrets(field string, value interface{}) []secretscan.Finding {
+	if h.secretScan == nil {
+		return nil
+	}
+	return h.secretScan.ScanTree(field, value)
+}
+
+// checkSecrets acts on the findings of a request's scan following
+// SECRET_SCAN_MODE. In reject mode it returns an error, meant for a 400,
+// naming the fields and kinds of credential; in flag mode it records an
+// instance.secrets_flagged audit entry and lets the request through. Values
+// are never echoed.
+func (h *Handler) checkSecrets(r *http.Request, tenantID string, findings []secretscan.Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Field < findings[j].Field })
+	described := make([]string, len(findings))
+	for i, f := range findings {
+		described[i] = f.String()
+	}
+	detail := strings.Join(described, "; ")
+
+	if h.cfg.SecretScanMode == secretscan.ModeFlag {
+		logf(r, "secret scan flagged: tenant=%s %s", tenantID, detail)
+		h.recordAudit(r, "instance.secrets_flagged", tenantID, detail, nil)
+		return nil
+	}
+	logf(r, "secret scan rejected: tenant=%s %s", tenantID, detail)
+	h.recordAudit(r, "instance.secrets_rejected", tenantID, detail, nil)
+	return fmt.Errorf("credentials found in request (%s); keep secrets out of instance configuration", detail)
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/tenantauth"
+)
+
+const (
+	// defaultLogTail and maxLogTail bound GET /self/instance/logs.
+	defaultLogTail = 100
+	maxLogTail     = 1000
+)
+
+// RotateTokenResponse carries a newly issued gateway token.
+type RotateTokenResponse struct {
+	GatewayToken string `json:"gateway_token"`
+}
+
+// GetSelfInstance handles GET /self/instance — the caller's instance status
+// and provisioning state, with an ETag for If-Match on the mutations.
+func (h *Handler) GetSelfInstance(w http.ResponseWriter, r *http.Request) {
+	id := tenantauth.FromContext(r.Context())
+
+	info, err := h.k8sManager.GetInstance(r.Context(), id)
+	if err != nil {
+		logf(r, "GetSelfInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve instance")
+		return
+	}
+	if info == nil {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	resp := InstanceResponse{
+		Name:             info.Name,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           info.Status,
+		State:            info.State,
+		Message:          info.Message,
+	}
+	if info.ResourceVersion != "" {
+		w.Header().Set("ETag", responseETag(info.ResourceVersion, resp))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// RestartSelfInstance handles POST /self/instance/restart — restarts the
+// caller's instance in place, keeping its spec and data.
+func (h *Handler) RestartSelfInstance(w http.ResponseWriter, r *http.Request) {
+	id := tenantauth.FromContext(r.Context())
+	r, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	logf(r, "RestartSelfInstance: tenant=%s", id)
+
+	err := h.k8sManager.RestartInstance(r.Context(), id)
+	h.recordAudit(r, "self.instance.restart", id, "", err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "RestartSelfInstance error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to restart instance")
+		return
+	}
+	h.setETag(w, r, id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// GetSelfInstanceLogs handles GET /self/instance/logs — the last lines
+// logged by the caller's instance as plain text. ?tail=N sets the number of
+// lines (default 100, at most 1000).
+func (h *Handler) GetSelfInstanceLogs(w http.ResponseWriter, r *http.Request) {
+	id := tenantauth.FromContext(r.Context())
+
+	tail := defaultLogTail
+	if v := r.URL.Query().Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLogTail {
+			writeError(w, http.StatusBadRequest, "invalid tail: must be between 1 and 1000")
+			return
+		}
+		tail = n
+	}
+
+	logs, err := h.k8sManager.InstanceLogs(r.Context(), id, tail)
+	switch {
+	case errors.Is(err, k8s.ErrNotFound):
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	case errors.Is(err, k8s.ErrNoPods):
+		writeError(w, http.StatusConflict, "instance is not running")
+		return
+	case err != nil:
+		logf(r, "GetSelfInstanceLogs error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to read instance logs")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(logs))
+}
+
+// RotateSelfToken handles POST /self/instance/token/rotate — issues a new
+// gateway token for the caller's instance and returns it. The instance
+// restarts with the new token, after which the old one is rejected here and
+// by the gateway.
+func (h *Handler) RotateSelfToken(w http.ResponseWriter, r *http.Request) {
+	id := tenantauth.FromContext(r.Context())
+	r, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	logf(r, "RotateSelfToken: tenant=%s", id)
+
+	token := generateToken()
+	err := h.k8sManager.RotateGatewayToken(r.Context(), id, token)
+	h.recordAudit(r, "self.token.rotate", id, "", err)
+	if errors.Is(err, k8s.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+	if errors.Is(err, k8s.ErrPreconditionFailed) {
+		writeError(w, http.StatusPreconditionFailed, "instance has changed since it was read")
+		return
+	}
+	if err != nil {
+		logf(r, "RotateSelfToken error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to rotate token")
+		return
+	}
+	h.setETag(w, r, id)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, RotateTokenResponse{GatewayToken: token})
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// GetStatus handles GET /status.json — the public fleet health summary. It
+// exposes no tenant or instance details.
+func (h *Handler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	if h.status == nil {
+		writeError(w, http.StatusNotImplemented, "status feed is not configured")
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	writeJSON(w, http.StatusOK, h.status.Summary())
+}
+
+// GetStatusFeed handles GET /status.atom — incidents as an Atom feed.
+func (h *Handler) GetStatusFeed(w http.ResponseWriter, r *http.Request) {
+	if h.status == nil {
+		writeError(w, http.StatusNotImplemented, "status feed is not configured")
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	w.WriteHeader(http.StatusOK)
+	if err := h.status.Summary().WriteAtom(w, scheme+"://"+r.Host+r.URL.Path); err != nil {
+		logf(r, "GetStatusFeed: %v", err)
+	}
+}
+
+// CreateIncidentRequest is the JSON body accepted by CreateIncident.
+type CreateIncidentRequest struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// CreateIncident handles POST /admin/incidents — publishes an incident on the
+// status feed.
+func (h *Handler) CreateIncident(w http.ResponseWriter, r *http.Request) {
+	if h.status == nil {
+		writeError(w, http.StatusNotImplemented, "status feed is not configured")
+		return
+	}
+	var req CreateIncidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Title) == "" {
+		writeError(w, http.StatusBadRequest, "title is required")
+		return
+	}
+
+	inc := h.status.OpenIncident(req.Title, req.Message)
+	h.recordAudit(r, "incident.open", "", "incident="+inc.ID, nil)
+	writeResponse(w, r, http.StatusCreated, inc)
+}
+
+// ResolveIncident handles POST /admin/incidents/{incident-id}/resolve.
+func (h *Handler) ResolveIncident(w http.ResponseWriter, r *http.Request) {
+	if h.status == nil {
+		writeError(w, http.StatusNotImplemented, "status feed is not configured")
+		return
+	}
+	id := chi.URLParam(r, "incident-id")
+	if !h.status.ResolveIncident(id) {
+		writeError(w, http.StatusNotFound, "no open incident with that ID")
+		return
+	}
+	h.recordAudit(r, "incident.resolve", "", "incident="+id, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
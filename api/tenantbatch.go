@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+)
+
+// TenantBatchRequest is the JSON body accepted by CreateTenantBatch: the
+// tenants to onboard and the create request applied to each of them. Every
+// tenant gets its own gateway token; a gateway_token in the request is
+// ignored.
+type TenantBatchRequest struct {
+	TenantIDs []string `json:"tenant_ids"`
+	CreateInstanceRequest
+}
+
+// TenantBatchResponse is a batch of creates. The gateway tokens of the
+// tenants' instances, by tenant ID, are only returned when the batch is
+// accepted.
+type TenantBatchResponse struct {
+	*workqueue.Batch
+	GatewayTokens map[string]string `json:"gateway_tokens,omitempty"`
+}
+
+// CreateTenantBatch handles POST /admin/tenants/batch — creates an instance
+// for each of a list of tenants, such as those a reseller brings at once.
+// The creates run through the work queue in the bulk lane; the 202
+// response is the batch, whose per-tenant outcomes GetTenantBatch reports.
+// The request is validated as a whole: an invalid tenant ID or create
+// option rejects the batch before anything is queued.
+func (h *Handler) CreateTenantBatch(w http.ResponseWriter, r *http.Request) {
+	if h.workQueue == nil {
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+
+	var req TenantBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if len(req.TenantIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "tenant_ids must list at least one tenant")
+		return
+	}
+	if len(req.TenantIDs) > h.cfg.TenantBatchMaxSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("tenant_ids lists %d tenants; at most %d are allowed", len(req.TenantIDs), h.cfg.TenantBatchMaxSize))
+		return
+	}
+	ids := make([]string, 0, len(req.TenantIDs))
+	seen := make(map[string]bool, len(req.TenantIDs))
+	var invalid []string
+	for _, raw := range req.TenantIDs {
+		id, err := tenant.Parse(raw)
+		if err != nil {
+			invalid = append(invalid, fmt.Sprintf("%q: %v", raw, err))
+			continue
+		}
+		if seen[id.String()] {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("tenant %s is listed more than once", id))
+			return
+		}
+		seen[id.String()] = true
+		ids = append(ids, id.String())
+	}
+	if len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, "invalid tenant IDs: "+strings.Join(invalid, "; "))
+		return
+	}
+
+	// The options are validated once, against the first tenant; only the
+	// gateway token and the tenant's feature flags differ between tenants.
+	base, err := h.checkCreateRequest(r, ids[0], req.CreateInstanceRequest)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := make(map[string]k8s.CreateOptions, len(ids))
+	tokens := make(map[string]string, len(ids))
+	items := make([]workqueue.Item, len(ids))
+	for i, id := range ids {
+		o := base
+		o.GatewayToken = generateToken()
+		o.Features = h.flags.Resolve(id, o.Plan)
+		opts[id] = o
+		tokens[id] = o.GatewayToken
+		items[i] = workqueue.Item{TenantID: id}
+	}
+
+	batch := h.workQueue.Submit("create", workqueue.PriorityBulk, items, func(ctx context.Context, it workqueue.Item) error {
+		return h.runQueuedCreate(ctx, r, correlation.NewID(), it.TenantID, opts[it.TenantID])
+	})
+	h.recordAudit(r, "tenants.batch.create", "", fmt.Sprintf("batch=%s tenants=%d plan=%s", batch.ID, batch.Total, base.Plan), nil)
+	logf(r, "CreateTenantBatch: batch=%s tenants=%d plan=%s", batch.ID, batch.Total, base.Plan)
+	w.Header().Set("Location", "/admin/tenants/batch/"+batch.ID)
+	writeResponse(w, r, http.StatusAccepted, TenantBatchResponse{Batch: batch, GatewayTokens: tokens})
+}
+
+// GetTenantBatch handles GET /admin/tenants/batch/{batch-id} — reports the
+// progress of a batch of creates, with the outcome of each tenant's.
+func (h *Handler) GetTenantBatch(w http.ResponseWriter, r *http.Request) {
+	if h.workQueue == nil {
+		writeError(w, http.StatusNotImplemented, "work queue is not configured")
+		return
+	}
+	batch, ok := h.workQueue.Get(chi.URLParam(r, "batch-id"))
+	if !ok || batch.Action != "create" {
+		writeError(w, http.StatusNotFound, "batch not found")
+		return
+	}
+	writeResponse(w, r, http.StatusOK, TenantBatchResponse{Batch: batch})
+}
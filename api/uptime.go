@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/uptime"
+)
+
+// UptimeResponse is the JSON envelope returned by GetInstanceUptime.
+type UptimeResponse struct {
+	Instance string                `json:"instance"`
+	Windows  []uptime.WindowReport `json:"windows"`
+}
+
+// GetInstanceUptime handles GET /tenants/{tenant-id}/instance/uptime —
+// reports the instance's uptime percentage and downtime windows over the last
+// 24 hours, 7 days and 30 days.
+func (h *Handler) GetInstanceUptime(w http.ResponseWriter, r *http.Request) {
+	id := tenantID(w, r)
+	if id == "" {
+		return
+	}
+	if h.uptime == nil {
+		writeError(w, http.StatusNotImplemented, "uptime tracking is not configured")
+		return
+	}
+
+	info, err := h.k8sManager.GetInstance(r.Context(), id)
+	if err != nil {
+		logf(r, "GetInstanceUptime error: tenant=%s err=%v", id, err)
+		reportError(r, id, err)
+		writeError(w, http.StatusInternalServerError, "failed to retrieve instance")
+		return
+	}
+	if info == nil {
+		writeError(w, http.StatusNotFound, "instance not found")
+		return
+	}
+
+	writeResponse(w, r, http.StatusOK, UptimeResponse{
+		Instance: info.Name,
+		Windows:  h.uptime.Report(info.Name, time.Now().UTC()),
+	})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/mchatman/tenant-provisioner/internal/buildinfo"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// VersionResponse identifies the running build of the service.
+type VersionResponse struct {
+	Version              string   `json:"version"`
+	Commit               string   `json:"commit"`
+	SpecTemplateRevision string   `json:"spec_template_revision"`
+	CRDVersions          []string `json:"crd_versions"` // OpenClawInstance versions this build can drive
+}
+
+// GetVersion handles GET /version — the build's version and commit, the
+// revision of the built-in spec template and the CRD versions it supports,
+// as also stamped on the objects it creates.
+func (h *Handler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, VersionResponse{
+		Version:              buildinfo.Version,
+		Commit:               buildinfo.Commit,
+		SpecTemplateRevision: k8s.SpecTemplateRevision,
+		CRDVersions:          k8s.SupportedCRDVersions(),
+	})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+)
+
+// WebhookRequest is the JSON body accepted by CreateWebhook and
+// UpdateWebhook. On update, omitted fields are left unchanged.
+type WebhookRequest struct {
+	URL     *string   `json:"url"`
+	Secret  *string   `json:"secret"` // Generated on create when omitted
+	Events  *[]string `json:"events"` // Event filter; every event when empty
+	Enabled *bool     `json:"enabled"`
+}
+
+// WebhookResponse describes a subscription. The secret is only returned when
+// it is set or generated.
+type WebhookResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func webhookResponse(wh registry.Webhook) WebhookResponse {
+	events := wh.Events
+	if events == nil {
+		events = []string{}
+	}
+	return WebhookResponse{
+		ID:        wh.ID,
+		URL:       wh.URL,
+		Events:    events,
+		Enabled:   wh.Enabled,
+		CreatedAt: wh.CreatedAt,
+		UpdatedAt: wh.UpdatedAt,
+	}
+}
+
+// applyWebhookRequest validates req and applies it to wh. It returns a
+// message for the caller when req is invalid.
+func applyWebhookRequest(wh *registry.Webhook, req WebhookRequest) string {
+	if req.URL != nil {
+		u, err := url.Parse(*req.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return "url must be an absolute http or https URL"
+		}
+		wh.URL = *req.URL
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			return "secret must not be empty"
+		}
+		wh.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		for _, f := range *req.Events {
+			if !webhooks.ValidFilter(f) {
+				return fmt.Sprintf("unknown event %q: must be one of %v, or a family such as instance.*", f, webhooks.Events)
+			}
+		}
+		wh.Events = *req.Events
+	}
+	if req.Enabled != nil {
+		wh.Enabled = *req.Enabled
+	}
+	return ""
+}
+
+// ListWebhooks handles GET /admin/webhooks — lists every webhook
+// subscription, oldest first.
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	if h.webhooks == nil {
+		writeError(w, http.StatusNotImplemented, "webhooks are not configured")
+		return
+	}
+	list := h.registry.Webhooks()
+	resp := make([]WebhookResponse, 0, len(list))
+	for _, wh := range list {
+		resp = append(resp, webhookResponse(wh))
+	}
+	writeResponse(w, r, http.StatusOK, resp)
+}
+
+// CreateWebhook handles POST /admin/webhooks — subscribes a URL to events.
+// The response carries the signing secret, which is not shown again.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.webhooks == nil {
+		writeError(w, http.StatusNotImplemented, "webhooks are not configured")
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.URL == nil {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	now := time.Now().UTC()
+	wh := registry.Webhook{ID: webhooks.NewID(), Enabled: true, CreatedAt: now, UpdatedAt: now}
+	if msg := applyWebhookRequest(&wh, req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if wh.Secret == "" {
+		wh.Secret = generateToken()
+	}
+
+	err := h.registry.PutWebhook(wh)
+	h.recordAudit(r, "webhook.create", "", "webhook="+wh.ID, err)
+	if err != nil {
+		logf(r, "CreateWebhook error: err=%v", err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save webhook")
+		return
+	}
+	resp := webhookResponse(wh)
+	resp.Secret = wh.Secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// GetWebhook handles GET /admin/webhooks/{webhook-id}.
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, webhookResponse(wh))
+}
+
+// UpdateWebhook handles PATCH /admin/webhooks/{webhook-id} — changes the
+// fields present in the body.
+func (h *Handler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if msg := applyWebhookRequest(&wh, req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	wh.UpdatedAt = time.Now().UTC()
+
+	err := h.registry.PutWebhook(wh)
+	h.recordAudit(r, "webhook.update", "", "webhook="+wh.ID, err)
+	if err != nil {
+		logf(r, "UpdateWebhook error: webhook=%s err=%v", wh.ID, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to save webhook")
+		return
+	}
+	resp := webhookResponse(wh)
+	if req.Secret != nil {
+		resp.Secret = wh.Secret
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// DeleteWebhook handles DELETE /admin/webhooks/{webhook-id} — removes the
+// subscription and its delivery log.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if h.webhooks == nil {
+		writeError(w, http.StatusNotImplemented, "webhooks are not configured")
+		return
+	}
+	id := chi.URLParam(r, "webhook-id")
+	found, err := h.registry.DeleteWebhook(id)
+	if found || err != nil {
+		h.recordAudit(r, "webhook.delete", "", "webhook="+id, err)
+	}
+	if err != nil {
+		logf(r, "DeleteWebhook error: webhook=%s err=%v", id, err)
+		reportError(r, "", err)
+		writeError(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	h.webhooks.Forget(id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries handles GET /admin/webhooks/{webhook-id}/deliveries —
+// the subscription's recent delivery attempts, newest first.
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	wh, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	writeResponse(w, r, http.StatusOK, h.webhooks.Deliveries(wh.ID))
+}
+
+// TestWebhook handles POST /admin/webhooks/{webhook-id}/test — sends a
+// webhook.test event once, even to a disabled subscription, and returns the
+// outcome.
+func (h *Handler) TestWebhook(w http.ResponseWriter, r *http.Request) {
+	wh, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	delivery := h.webhooks.Test(r.Context(), wh)
+	h.recordAudit(r, "webhook.test", "", "webhook="+wh.ID, nil)
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+// webhook returns the subscription named in the URL. On failure it writes an
+// error response and returns false.
+func (h *Handler) webhook(w http.ResponseWriter, r *http.Request) (registry.Webhook, bool) {
+	if h.webhooks == nil {
+		writeError(w, http.StatusNotImplemented, "webhooks are not configured")
+		return registry.Webhook{}, false
+	}
+	wh, ok := h.registry.Webhook(chi.URLParam(r, "webhook-id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return registry.Webhook{}, false
+	}
+	return wh, true
+}
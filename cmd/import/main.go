@@ -0,0 +1,118 @@
+// Command import migrates tenants from the legacy provisioning system. It
+// uploads a CSV or JSON export to a running provisioner's POST /admin/import,
+// which creates or adopts an instance for every row, and prints the outcome
+// of each row:
+//
+//	import [-dry-run] [-target URL] [-format csv|json] export.csv
+//
+// The admin token is read from ADMIN_API_TOKEN. It exits with status 1 when
+// any row is invalid or failed; re-running it after fixing those rows is
+// safe, since rows whose tenant already has an instance are skipped.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// result and report mirror api.ImportResult and api.ImportReport.
+type result struct {
+	Line     int    `json:"line"`
+	TenantID string `json:"tenant_id"`
+	Instance string `json:"instance"`
+	Status   string `json:"status"`
+	Error    string `json:"error"`
+}
+
+type report struct {
+	DryRun  bool           `json:"dry_run"`
+	Total   int            `json:"total"`
+	Counts  map[string]int `json:"counts"`
+	Results []result       `json:"results"`
+}
+
+func main() {
+	log.SetFlags(0)
+	target := flag.String("target", "http://localhost:8080", "base URL of the provisioner")
+	format := flag.String("format", "", "export format, csv or json; from the file extension by default")
+	dry := flag.Bool("dry-run", false, "validate every row without creating or adopting anything")
+	timeout := flag.Duration("timeout", 10*time.Minute, "how long to wait for the import")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: import [flags] export.csv|export.json\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	contentType := map[string]string{"csv": "text/csv", "json": "application/json"}[*format]
+	if contentType == "" {
+		log.Fatalf("cannot tell the format of %s: pass -format csv or -format json", path)
+	}
+	token := os.Getenv("ADMIN_API_TOKEN")
+	if token == "" {
+		log.Fatalf("ADMIN_API_TOKEN must be set")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer f.Close()
+
+	u := strings.TrimSuffix(*target, "/") + "/admin/import?" + url.Values{"dry_run": {fmt.Sprint(*dry)}}.Encode()
+	req, err := http.NewRequest(http.MethodPost, u, f)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		log.Fatalf("import failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatalf("reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("import failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var rep report
+	if err := json.Unmarshal(body, &rep); err != nil {
+		log.Fatalf("reading response: %v", err)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tTENANT\tINSTANCE\tSTATUS\tERROR")
+	for _, r := range rep.Results {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", r.Line, r.TenantID, r.Instance, r.Status, r.Error)
+	}
+	tw.Flush()
+
+	mode := ""
+	if rep.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("\n%d rows%s: %d created, %d adopted, %d existing, %d invalid, %d failed\n", rep.Total, mode,
+		rep.Counts["created"], rep.Counts["adopted"], rep.Counts["exists"], rep.Counts["invalid"], rep.Counts["failed"])
+	if rep.Counts["invalid"]+rep.Counts["failed"] > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,273 @@
+// Command loadgen drives synthetic tenants through the provisioner API —
+// create, poll until running, delete — at a fixed rate and reports latency
+// percentiles per operation. Point it at a staging environment to validate
+// capacity before expected signup spikes.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// headerFlags collects repeated -header "Name: value" flags.
+type headerFlags []string
+
+func (h *headerFlags) String() string     { return strings.Join(*h, ", ") }
+func (h *headerFlags) Set(v string) error { *h = append(*h, v); return nil }
+
+// options holds the parsed command line.
+type options struct {
+	target       string
+	tenants      int
+	rate         float64
+	concurrency  int
+	pollInterval time.Duration
+	readyTimeout time.Duration
+	keep         bool
+	headers      http.Header
+}
+
+// recorder accumulates per-operation latencies and failures.
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	failures  map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: make(map[string][]time.Duration),
+		failures:  make(map[string]int),
+	}
+}
+
+func (r *recorder) observe(op string, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.failures[op]++
+		return
+	}
+	r.latencies[op] = append(r.latencies[op], d)
+}
+
+// report prints a table of latency percentiles for each operation.
+func (r *recorder) report(elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Printf("\ncompleted in %s\n\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("%-8s %6s %6s %10s %10s %10s %10s\n", "op", "ok", "failed", "p50", "p90", "p99", "max")
+	for _, op := range []string{"create", "get", "ready", "delete"} {
+		ds := r.latencies[op]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		fmt.Printf("%-8s %6d %6d %10s %10s %10s %10s\n", op, len(ds), r.failures[op],
+			percentile(ds, 0.50), percentile(ds, 0.90), percentile(ds, 0.99), percentile(ds, 1))
+	}
+}
+
+// percentile returns the p-th percentile of the sorted durations ds.
+func percentile(ds []time.Duration, p float64) string {
+	if len(ds) == 0 {
+		return "-"
+	}
+	i := int(float64(len(ds))*p+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(ds) {
+		i = len(ds) - 1
+	}
+	return ds[i].Round(time.Millisecond).String()
+}
+
+func main() {
+	var opts options
+	var headers headerFlags
+	flag.StringVar(&opts.target, "target", "http://localhost:8080", "base URL of the provisioner")
+	flag.IntVar(&opts.tenants, "tenants", 10, "number of synthetic tenants")
+	flag.Float64Var(&opts.rate, "rate", 1, "tenants started per second")
+	flag.IntVar(&opts.concurrency, "concurrency", 50, "maximum tenants in flight")
+	flag.DurationVar(&opts.pollInterval, "poll-interval", 2*time.Second, "interval between status polls")
+	flag.DurationVar(&opts.readyTimeout, "ready-timeout", 5*time.Minute, "how long to wait for an instance to run")
+	flag.BoolVar(&opts.keep, "keep", false, "leave instances in place instead of deleting them")
+	flag.Var(&headers, "header", "extra request header as \"Name: value\" (repeatable)")
+	flag.Parse()
+
+	if opts.tenants <= 0 || opts.rate <= 0 || opts.concurrency <= 0 {
+		log.Fatalf("-tenants, -rate and -concurrency must be positive")
+	}
+	opts.target = strings.TrimSuffix(opts.target, "/")
+	opts.headers = http.Header{}
+	for _, h := range headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			log.Fatalf("invalid -header %q: want \"Name: value\"", h)
+		}
+		opts.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rec := newRecorder()
+	client := &http.Client{Timeout: 2 * time.Minute}
+	start := time.Now()
+	run(ctx, client, opts, rec)
+	rec.report(time.Since(start))
+
+	rec.mu.Lock()
+	failed := len(rec.failures) > 0
+	rec.mu.Unlock()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// run starts opts.tenants lifecycles at opts.rate and waits for them all.
+func run(ctx context.Context, client *http.Client, opts options, rec *recorder) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+	defer ticker.Stop()
+	sem := make(chan struct{}, opts.concurrency)
+	var wg sync.WaitGroup
+
+	log.Printf("starting %d tenants against %s at %.2f/s", opts.tenants, opts.target, opts.rate)
+	for i := 0; i < opts.tenants; i++ {
+		select {
+		case <-ctx.Done():
+			log.Printf("interrupted after starting %d tenants", i)
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			lifecycle(ctx, client, opts, rec, newTenantID())
+		}()
+		if i < opts.tenants-1 {
+			select {
+			case <-ctx.Done():
+			case <-ticker.C:
+			}
+		}
+	}
+	wg.Wait()
+}
+
+// lifecycle creates one tenant's instance, polls until it runs and deletes it.
+func lifecycle(ctx context.Context, client *http.Client, opts options, rec *recorder, tenantID string) {
+	url := fmt.Sprintf("%s/tenants/%s/instance", opts.target, tenantID)
+
+	began := time.Now()
+	_, err := call(ctx, client, opts, http.MethodPost, url, http.StatusCreated)
+	rec.observe("create", time.Since(began), err)
+	if err != nil {
+		log.Printf("tenant %s: create: %v", tenantID, err)
+		return
+	}
+
+	if !opts.keep {
+		defer func() {
+			// Clean up even when interrupted.
+			delCtx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			defer cancel()
+			t := time.Now()
+			_, err := call(delCtx, client, opts, http.MethodDelete, url, http.StatusNoContent)
+			rec.observe("delete", time.Since(t), err)
+			if err != nil {
+				log.Printf("tenant %s: delete: %v", tenantID, err)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(opts.readyTimeout)
+	for {
+		t := time.Now()
+		body, err := call(ctx, client, opts, http.MethodGet, url, http.StatusOK)
+		rec.observe("get", time.Since(t), err)
+		if err == nil {
+			var resp struct {
+				Status string `json:"status"`
+			}
+			json.Unmarshal(body, &resp)
+			switch resp.Status {
+			case "running":
+				rec.observe("ready", time.Since(began), nil)
+				return
+			case "error":
+				rec.observe("ready", 0, fmt.Errorf("instance failed"))
+				log.Printf("tenant %s: instance reported error", tenantID)
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			rec.observe("ready", 0, fmt.Errorf("timed out"))
+			log.Printf("tenant %s: not running after %s", tenantID, opts.readyTimeout)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			rec.observe("ready", 0, ctx.Err())
+			return
+		case <-time.After(opts.pollInterval):
+		}
+	}
+}
+
+// call performs one request and fails unless the response status is want.
+func call(ctx context.Context, client *http.Client, opts options, method, url string, want int) ([]byte, error) {
+	var body *bytes.Reader
+	if method == http.MethodPost {
+		body = bytes.NewReader([]byte("{}"))
+	} else {
+		body = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range opts.headers {
+		req.Header[name] = values
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(resp.Body)
+	if resp.StatusCode != want {
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, url, resp.StatusCode, strings.TrimSpace(buf.String()))
+	}
+	return buf.Bytes(), nil
+}
+
+// newTenantID returns a random version 4 UUID.
+func newTenantID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatalf("generating tenant ID: %v", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
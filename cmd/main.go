@@ -2,30 +2,167 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/getsentry/sentry-go"
+	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/mchatman/tenant-provisioner/api"
+	"github.com/mchatman/tenant-provisioner/internal/aibudget"
+	"github.com/mchatman/tenant-provisioner/internal/alerting"
+	"github.com/mchatman/tenant-provisioner/internal/audit"
+	"github.com/mchatman/tenant-provisioner/internal/billing"
+	"github.com/mchatman/tenant-provisioner/internal/buildinfo"
+	"github.com/mchatman/tenant-provisioner/internal/certmonitor"
+	"github.com/mchatman/tenant-provisioner/internal/compliance"
 	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/configschema"
+	"github.com/mchatman/tenant-provisioner/internal/consistency"
+	"github.com/mchatman/tenant-provisioner/internal/deadline"
+	"github.com/mchatman/tenant-provisioner/internal/debug"
+	"github.com/mchatman/tenant-provisioner/internal/flags"
+	"github.com/mchatman/tenant-provisioner/internal/healthcheck"
 	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/locale"
+	"github.com/mchatman/tenant-provisioner/internal/notify"
+	"github.com/mchatman/tenant-provisioner/internal/objectstore"
+	"github.com/mchatman/tenant-provisioner/internal/recording"
+	"github.com/mchatman/tenant-provisioner/internal/recovery"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/retention"
+	"github.com/mchatman/tenant-provisioner/internal/rightsizing"
+	"github.com/mchatman/tenant-provisioner/internal/rollout"
+	"github.com/mchatman/tenant-provisioner/internal/secretscan"
+	"github.com/mchatman/tenant-provisioner/internal/status"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"github.com/mchatman/tenant-provisioner/internal/tenantauth"
+	"github.com/mchatman/tenant-provisioner/internal/uptime"
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
 )
 
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
 	cfg := config.Load()
+	log.Printf("tenant-provisioner %s (commit %s, spec template %s, CRD versions %s)",
+		buildinfo.Version, buildinfo.Commit, k8s.SpecTemplateRevision, strings.Join(k8s.SupportedCRDVersions(), ", "))
 	log.Printf("config: namespace=%s domain=%s port=%s", cfg.Namespace, cfg.Domain, cfg.Port)
+	if len(cfg.ConfigFiles) > 0 {
+		log.Printf("config: layered under the environment: %s", strings.Join(cfg.ConfigFiles, ", "))
+	}
+	if cfg.ImpersonateCallers && cfg.CallerUserHeader == "" {
+		log.Fatalf("IMPERSONATE_CALLERS requires CALLER_USER_HEADER")
+	}
+	if !webhooks.ValidFormat(cfg.EventFormat) {
+		log.Fatalf("Invalid EVENT_FORMAT %q: must be \"cloudevents\" or \"legacy\"", cfg.EventFormat)
+	}
+	if !k8s.ValidIngressProvider(cfg.IngressProvider) {
+		log.Fatalf("Invalid INGRESS_PROVIDER %q: must be \"nginx\", \"traefik\" or \"gateway-api\"", cfg.IngressProvider)
+	}
+	if err := k8s.CheckEgressProxy(cfg); err != nil {
+		log.Fatalf("Invalid egress proxy configuration: %v", err)
+	}
+	if err := k8s.CheckInternalDomain(cfg); err != nil {
+		log.Fatalf("Invalid internal domain configuration: %v", err)
+	}
+	if !aibudget.ValidAction(cfg.AIBudgetAction) {
+		log.Fatalf("Invalid AI_BUDGET_ACTION %q: must be \"throttle\" or \"suspend\"", cfg.AIBudgetAction)
+	}
+	billingPolicies := map[string]billing.Policy{}
+	for event, steps := range map[string]map[string]string{
+		billing.EventPaymentFailed:        cfg.BillingPaymentFailedPolicy,
+		billing.EventSubscriptionCanceled: cfg.BillingSubscriptionCanceledPolicy,
+	} {
+		policy, err := billing.ParsePolicy(steps)
+		if err != nil {
+			log.Fatalf("Invalid billing policy for %s: %v", event, err)
+		}
+		billingPolicies[event] = policy
+	}
+	if cfg.BillingWebhookSecret != "" && cfg.BillingPolicyInterval <= 0 {
+		log.Fatalf("Invalid BILLING_POLICY_INTERVAL %s: must be positive", cfg.BillingPolicyInterval)
+	}
+	if cfg.AuditBucket != "" && (cfg.AuditFlushInterval <= 0 || cfg.AuditBatchSize < 1) {
+		log.Fatalf("Invalid audit shipping: AUDIT_FLUSH_INTERVAL and AUDIT_BATCH_SIZE must be positive")
+	}
+	if !secretscan.ValidMode(cfg.SecretScanMode) {
+		log.Fatalf("Invalid SECRET_SCAN_MODE %q: must be \"reject\", \"flag\" or \"off\"", cfg.SecretScanMode)
+	}
+	if cfg.TenantIDPattern != "" {
+		v, err := tenant.NewPatternValidator(cfg.TenantIDPattern)
+		if err != nil {
+			log.Fatalf("Invalid TENANT_ID_PATTERN: %v", err)
+		}
+		tenant.SetValidator(v)
+	}
+	if cfg.KubeReadQPS <= 0 || cfg.KubeReadBurst < 1 || cfg.KubeWriteQPS <= 0 || cfg.KubeWriteBurst < 1 {
+		log.Fatalf("Invalid Kubernetes client rate limits: KUBE_READ_QPS, KUBE_WRITE_QPS, KUBE_READ_BURST and KUBE_WRITE_BURST must be positive")
+	}
+	if cfg.KubeHedgeReads && (cfg.KubeHedgeDelay < 0 || cfg.KubeHedgeMaxRatio <= 0 || cfg.KubeHedgeMaxRatio > 1) {
+		log.Fatalf("Invalid read hedging: KUBE_HEDGE_DELAY must not be negative and KUBE_HEDGE_MAX_RATIO must be in (0, 1]")
+	}
+	if !k8s.ValidMesh(cfg.Mesh) {
+		log.Fatalf("Invalid MESH %q: must be \"istio\", \"linkerd\" or empty", cfg.Mesh)
+	}
+	if cfg.IngressProvider == k8s.IngressGatewayAPI {
+		switch {
+		case !k8s.ValidGatewayTLS(cfg.IngressGatewayTLS):
+			log.Fatalf("Invalid INGRESS_GATEWAY_TLS %q: must be \"shared\" or \"cert-manager\"", cfg.IngressGatewayTLS)
+		case cfg.IngressGatewayTLS == k8s.GatewayTLSShared && cfg.IngressGatewayName == "":
+			log.Fatalf("INGRESS_PROVIDER=gateway-api requires INGRESS_GATEWAY_NAME")
+		case cfg.IngressGatewayTLS == k8s.GatewayTLSCertManager && cfg.IngressGatewayClass == "":
+			log.Fatalf("INGRESS_GATEWAY_TLS=cert-manager requires INGRESS_GATEWAY_CLASS")
+		}
+	}
 
-	// Initialize K8s manager
-	k8sManager, err := k8s.NewManager(cfg)
-	if err != nil {
-		log.Fatalf("Failed to initialize K8s manager: %v", err)
+	if cfg.SentrySampleRate < 0 || cfg.SentrySampleRate > 1 {
+		log.Fatalf("Invalid SENTRY_SAMPLE_RATE %g: must be between 0 and 1", cfg.SentrySampleRate)
+	}
+
+	// Error reporting must be initialised before anything that may panic.
+	// The SDK reads a sample rate of 0 as its default of 1, so 0 leaves it
+	// uninitialised instead.
+	if cfg.SentryDSN != "" && cfg.SentrySampleRate > 0 {
+		err := sentry.Init(sentry.ClientOptions{
+			Dsn:              cfg.SentryDSN,
+			Environment:      cfg.SentryEnvironment,
+			Release:          buildinfo.Version,
+			SampleRate:       cfg.SentrySampleRate,
+			AttachStacktrace: true,
+		})
+		if err != nil {
+			log.Fatalf("Failed to initialize Sentry: %v", err)
+		}
+		defer sentry.Flush(5 * time.Second)
+	}
+
+	// Initialize K8s manager, or the in-memory fake for local development.
+	var k8sManager k8s.InstanceManager
+	var err error
+	switch cfg.Backend {
+	case "kubernetes":
+		k8sManager, err = k8s.NewManager(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize K8s manager: %v", err)
+		}
+	case "fake":
+		k8sManager, err = k8s.NewFakeManager(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize fake backend: %v", err)
+		}
+	default:
+		log.Fatalf("Invalid BACKEND %q: must be \"kubernetes\" or \"fake\"", cfg.Backend)
 	}
 
 	// Ensure namespace-level resources are correctly configured.
@@ -33,34 +170,672 @@ func main() {
 		log.Fatalf("Bootstrap failed: %v", err)
 	}
 
+	// Purge deletion is only offered when a certificate signing key is set.
+	var certSigner *compliance.Signer
+	if cfg.DeletionCertKey != "" {
+		certSigner, err = compliance.NewSigner(cfg.DeletionCertKey)
+		if err != nil {
+			log.Fatalf("Invalid DELETION_CERT_SIGNING_KEY: %v", err)
+		}
+		log.Printf("purge deletion enabled: certificate public key=%s", certSigner.PublicKey())
+	}
+
+	// Idempotent responses carrying gateway tokens are stored encrypted.
+	sealer, generated, err := api.NewSealer(cfg.IdempotencyKey)
+	if err != nil {
+		log.Fatalf("Invalid IDEMPOTENCY_ENCRYPTION_KEY: %v", err)
+	}
+	if generated && cfg.IdempotencyTTL > 0 {
+		log.Printf("idempotency: IDEMPOTENCY_ENCRYPTION_KEY is not set; retries of creates and token rotations are only replayed by this replica until it restarts")
+	}
+
+	// Data export is only offered when object storage is configured.
+	var exportStore *objectstore.Client
+	if cfg.ObjectStoreBucket != "" {
+		exportStore, err = objectstore.New(objectstore.Config{
+			Endpoint:  cfg.ObjectStoreEndpoint,
+			Region:    cfg.ObjectStoreRegion,
+			Bucket:    cfg.ObjectStoreBucket,
+			AccessKey: cfg.ObjectStoreAccessKey,
+			SecretKey: cfg.ObjectStoreSecretKey,
+		})
+		if err != nil {
+			log.Fatalf("Invalid object storage configuration: %v", err)
+		}
+	}
+
+	// Audit records are always logged, and shipped to object storage when an
+	// audit bucket is configured.
+	var auditLog *audit.Logger
+	auditDone := make(chan struct{})
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	if cfg.AuditBucket != "" {
+		auditStore, err := objectstore.New(objectstore.Config{
+			Endpoint:  cfg.ObjectStoreEndpoint,
+			Region:    cfg.ObjectStoreRegion,
+			Bucket:    cfg.AuditBucket,
+			AccessKey: cfg.ObjectStoreAccessKey,
+			SecretKey: cfg.ObjectStoreSecretKey,
+		})
+		if err != nil {
+			log.Fatalf("Invalid audit storage configuration: %v", err)
+		}
+		auditLog = audit.NewLogger(audit.NewObjectStoreSink(auditStore, cfg.AuditPrefix),
+			cfg.AuditBatchSize, cfg.AuditFlushInterval)
+		go func() {
+			auditLog.Run(auditCtx)
+			close(auditDone)
+		}()
+	} else {
+		close(auditDone)
+	}
+
+	// Report missing RBAC up front rather than as opaque 403s later.
+	permCtx, cancelPerm := context.WithTimeout(context.Background(), 30*time.Second)
+	checks, err := k8sManager.CheckPermissions(permCtx)
+	cancelPerm()
+	if err != nil {
+		log.Printf("RBAC self-check failed: %v", err)
+	}
+	for _, c := range checks {
+		switch {
+		case c.Error != "":
+			log.Printf("RBAC self-check: could not verify %s: %s", c, c.Error)
+		case !c.Allowed:
+			log.Printf("RBAC self-check: MISSING permission %s", c)
+		}
+	}
+
+	// Background loops run until shutdown.
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+
+	// Capacity alerts go to Sentry so that nodes are added before creations
+	// start being refused.
+	k8sManager.OnCapacityAlert(func(u k8s.ResourceUsage) {
+		sentry.WithScope(func(scope *sentry.Scope) {
+			scope.SetLevel(sentry.LevelWarning)
+			scope.SetTag("capacity_resource", u.Resource)
+			sentry.CaptureMessage(fmt.Sprintf("capacity: %s at %.0f%% (%s of %s)", u.Resource, u.Ratio*100, u.Used, u.Limit))
+		})
+	})
+
+	// The registry follows the cluster through the instance watch; its
+	// initial list and sync reconcile anything missed while we were down.
+	registryStore, err := registry.OpenStore(registry.StoreConfig{
+		Kind:        cfg.RegistryStore,
+		Path:        cfg.RegistryPath,
+		DatabaseURL: cfg.RegistryDatabaseURL,
+		AutoMigrate: cfg.RegistryAutoMigrate,
+	})
+	if err != nil {
+		log.Fatalf("Failed to open registry store: %v", err)
+	}
+	reg, err := registry.Open(registryStore)
+	if err != nil {
+		log.Fatalf("Failed to open registry: %v", err)
+	}
+	defer reg.Close()
+	k8sManager.OnInstanceEvent(reg.HandleInstanceEvent)
+	// Creates leave the names and capacity held by reservations alone.
+	k8sManager.UseReservations(reg.HeldReservations)
+	if exportStore != nil {
+		k8sManager.UseExportStore(exportStore)
+	}
+	checker := consistency.New(k8sManager, reg)
+	if cfg.ConsistencyCheckInterval > 0 {
+		go checker.Run(watchCtx, cfg.ConsistencyCheckInterval, cfg.ConsistencyAutoRepair)
+	}
+
+	// Storage kept by deletes with ?retain_storage=true is removed once its
+	// retention ends.
+	if cfg.RetentionJanitorInterval > 0 {
+		go retention.New(k8sManager).Run(watchCtx, cfg.RetentionJanitorInterval)
+	}
+
+	// Lifecycle events go to the webhook subscriptions kept in the registry.
+	// Customer-facing text is rendered in each tenant's locale, from the
+	// built-in translations and those in TRANSLATIONS_DIR.
+	var emailDir, descriptionDir string
+	if cfg.TranslationsDir != "" {
+		emailDir = filepath.Join(cfg.TranslationsDir, "email")
+		descriptionDir = filepath.Join(cfg.TranslationsDir, "webhooks")
+	}
+	emailTemplates, err := locale.Load(notify.Templates(), emailDir, cfg.DefaultLocale)
+	if err != nil {
+		log.Fatalf("Failed to load email translations: %v", err)
+	}
+	eventDescriptions, err := locale.Load(webhooks.Descriptions(), descriptionDir, cfg.DefaultLocale)
+	if err != nil {
+		log.Fatalf("Failed to load webhook translations: %v", err)
+	}
+
+	webhookDispatcher := webhooks.New(reg, webhooks.Config{
+		Timeout:      cfg.WebhookTimeout,
+		MaxAttempts:  cfg.WebhookMaxAttempts,
+		LogSize:      cfg.WebhookLogSize,
+		Format:       cfg.EventFormat,
+		Source:       cfg.EventSource,
+		Descriptions: eventDescriptions,
+	})
+	k8sManager.OnInstanceEvent(webhookDispatcher.HandleInstanceEvent)
+	if cfg.EventLogRetention > 0 {
+		go reg.RunEventPruning(watchCtx, cfg.EventLogRetention)
+	}
+
+	// Billable usage is recorded from the instance watch.
+	usageLedger, err := usage.NewLedger(cfg.UsageLedgerPath)
+	if err != nil {
+		log.Fatalf("Failed to load usage ledger: %v", err)
+	}
+	k8sManager.OnInstanceEvent(usageLedger.HandleInstanceEvent)
+
+	// AI usage reported by instances is held to the per-plan budgets.
+	aiBudget := aibudget.New(usageLedger, k8sManager, webhookDispatcher, aibudget.Config{
+		TokenBudgets:   cfg.AITokenBudgets,
+		RequestBudgets: cfg.AIRequestBudgets,
+		WarnAt:         cfg.AIBudgetWarnAt,
+		Action:         cfg.AIBudgetAction,
+	})
+
+	// Billing events drive warnings, suspension and deletion of the tenant's
+	// instances after each policy's grace periods.
+	auditHistory := audit.NewHistory(cfg.AuditHistorySize)
+	var billingEngine *billing.Engine
+	if cfg.BillingWebhookSecret != "" {
+		billingEngine = billing.New(reg, k8sManager, webhookDispatcher, auditLog, auditHistory, billingPolicies)
+		if cfg.BillingPolicyInterval > 0 {
+			go billingEngine.Run(watchCtx, cfg.BillingPolicyInterval)
+		}
+	}
+
+	// Deep health probing of running instances; instances that keep failing
+	// are reported degraded to the uptime history and the alerter.
+	var prober *healthcheck.Prober
+	if cfg.HealthCheckInterval > 0 {
+		prober = healthcheck.New(healthcheck.Config{
+			Path:           cfg.HealthCheckPath,
+			ExpectedStatus: cfg.HealthCheckExpectedStatus,
+			Interval:       cfg.HealthCheckInterval,
+			Timeout:        cfg.HealthCheckTimeout,
+			DegradedAfter:  cfg.HealthCheckDegradedAfter,
+		})
+		k8sManager.OnInstanceEvent(prober.HandleInstanceEvent)
+		go prober.Run(watchCtx)
+	}
+
+	// Status transitions feed per-instance uptime reports.
+	uptimeHistory, err := uptime.NewHistory(cfg.UptimeHistoryPath)
+	if err != nil {
+		log.Fatalf("Failed to load uptime history: %v", err)
+	}
+	k8sManager.OnInstanceEvent(uptimeHistory.HandleInstanceEvent)
+	if prober != nil {
+		prober.OnChange(uptimeHistory.HandleHealthChange)
+	}
+
+	// Lifecycle emails are only sent when a provider is configured.
+	var sender notify.Sender
+	switch cfg.NotifyProvider {
+	case "":
+	case "smtp":
+		sender = &notify.SMTPSender{Addr: cfg.SMTPAddr, Username: cfg.SMTPUsername, Password: cfg.SMTPPassword}
+	case "sendgrid":
+		sender = &notify.SendGridSender{APIKey: cfg.SendGridAPIKey}
+	default:
+		log.Fatalf("Invalid NOTIFY_PROVIDER %q: must be \"smtp\" or \"sendgrid\"", cfg.NotifyProvider)
+	}
+	if sender != nil {
+		notifier, err := notify.New(sender, cfg.NotifyFrom, map[notify.Event]bool{
+			notify.EventReady:         cfg.NotifyOnReady,
+			notify.EventTrialExpiring: cfg.NotifyOnTrialExpiry,
+			notify.EventSuspended:     cfg.NotifyOnSuspension,
+			notify.EventDeleted:       cfg.NotifyOnDeletion,
+		}, emailTemplates)
+		if err != nil {
+			log.Fatalf("Failed to initialize notifications: %v", err)
+		}
+		// Tenant contacts in the registry choose recipients and events.
+		notifier.UseContacts(reg.Contact)
+		k8sManager.OnInstanceEvent(notifier.HandleInstanceEvent)
+		log.Printf("lifecycle emails enabled via %s", cfg.NotifyProvider)
+	}
+
+	// Page on provisioning failures when an alert channel is configured.
+	if cfg.SlackWebhookURL != "" || cfg.PagerDutyRoutingKey != "" {
+		alerter := alerting.New(alerting.Config{
+			SlackWebhookURL:     cfg.SlackWebhookURL,
+			PagerDutyRoutingKey: cfg.PagerDutyRoutingKey,
+			Deadline:            cfg.ProvisioningAlertDeadline,
+			Source:              "tenant-provisioner/" + cfg.Namespace,
+		})
+		k8sManager.OnInstanceEvent(alerter.HandleInstanceEvent)
+		if prober != nil {
+			prober.OnChange(alerter.HandleHealthChange)
+		}
+		go alerter.Run(watchCtx)
+	}
+
+	// Instances that miss the provisioning deadline are failed, and their
+	// diagnostics kept in the registry.
+	if cfg.ProvisioningDeadline > 0 {
+		enforcer := deadline.New(k8sManager, reg, deadline.Config{
+			Deadline: cfg.ProvisioningDeadline,
+			Cleanup:  cfg.ProvisioningDeadlineCleanup,
+		})
+		k8sManager.OnInstanceEvent(enforcer.HandleInstanceEvent)
+		go enforcer.Run(watchCtx)
+	}
+
+	// Named provisioning profiles are fixed for the life of the process.
+	configSchema, err := configschema.Load(cfg.ConfigRawSchemaPath)
+	if err != nil {
+		log.Fatalf("Failed to load config.raw schema: %v", err)
+	}
+	profiles, err := k8s.LoadProfiles(cfg.ProfilesPath)
+	if err != nil {
+		log.Fatalf("Failed to load provisioning profiles: %v", err)
+	}
+	if cfg.DefaultProfile != "" && profiles[cfg.DefaultProfile] == nil {
+		log.Fatalf("DEFAULT_PROFILE %q is not defined in PROFILES_PATH", cfg.DefaultProfile)
+	}
+	for env, name := range cfg.EnvironmentProfiles {
+		if !k8s.ValidEnvironment(env) {
+			log.Fatalf("ENVIRONMENT_PROFILES: unknown environment %q", env)
+		}
+		if profiles[name] == nil {
+			log.Fatalf("ENVIRONMENT_PROFILES: profile %q for %s is not defined in PROFILES_PATH", name, env)
+		}
+	}
+	for env, channel := range cfg.EnvironmentChannels {
+		if !k8s.ValidEnvironment(env) || !rollout.ValidChannel(channel) {
+			log.Fatalf("ENVIRONMENT_CHANNELS: invalid entry %s=%s", env, channel)
+		}
+	}
+	for env := range cfg.EnvironmentPlans {
+		if !k8s.ValidEnvironment(env) {
+			log.Fatalf("ENVIRONMENT_PLANS: unknown environment %q", env)
+		}
+	}
+	if len(profiles) > 0 {
+		log.Printf("loaded provisioning profiles: %s", strings.Join(k8s.ProfileNames(profiles), ", "))
+	}
+
+	featureFlags, err := flags.Open(cfg.FeatureFlagsPath)
+	if err != nil {
+		log.Fatalf("Failed to load feature flags: %v", err)
+	}
+
+	// Bulk admin operations and queued creates run on a bounded pool of
+	// workers.
+	workQueue := workqueue.New(cfg.WorkQueueWorkers, cfg.WorkQueueTenantConcurrency, cfg.LongRouteTimeout)
+	go workQueue.Run(watchCtx)
+
+	// Fleet upgrades promote from canary to beta to stable as each bakes.
+	rollouts, err := rollout.New(rollout.Config{
+		BakeTime:     cfg.RolloutBakeTime,
+		MaxErrorRate: cfg.RolloutMaxErrorRate,
+	}, k8sManager, workQueue, cfg.RolloutsPath)
+	if err != nil {
+		log.Fatalf("Failed to load rollouts: %v", err)
+	}
+	go rollouts.Run(watchCtx, 30*time.Second)
+
+	// Usage sampling drives right-sizing recommendations.
+	var advisor *rightsizing.Advisor
+	if cfg.RightsizingSampleInterval > 0 {
+		advisor, err = rightsizing.New(rightsizing.Config{
+			Window:    cfg.RightsizingWindow,
+			Headroom:  cfg.RightsizingHeadroom,
+			AutoApply: cfg.RightsizingAutoApply,
+		}, k8sManager, profiles, cfg.RightsizingPath)
+		if err != nil {
+			log.Fatalf("Failed to load right-sizing history: %v", err)
+		}
+		k8sManager.OnInstanceEvent(advisor.HandleInstanceEvent)
+		go advisor.Run(watchCtx, cfg.RightsizingSampleInterval)
+	}
+
+	// Certificate monitoring retries failed TLS issuance for new instances.
+	var certMonitor *certmonitor.Monitor
+	if cfg.CertMonitorInterval > 0 {
+		certMonitor = certmonitor.New(certmonitor.Config{
+			MaxRetries:      cfg.CertMaxRetries,
+			FallbackTimeout: cfg.CertFallbackTimeout,
+			WildcardSecret:  cfg.TLSWildcardSecret,
+		}, k8sManager)
+		k8sManager.OnInstanceEvent(certMonitor.HandleInstanceEvent)
+		go certMonitor.Run(watchCtx, cfg.CertMonitorInterval)
+	}
+
+	// Tenants authenticate to the self-service API with their gateway token.
+	tenantTokens := tenantauth.NewIndex()
+	k8sManager.OnInstanceEvent(tenantTokens.HandleInstanceEvent)
+
+	// Follow instance changes so cached status is invalidated promptly.
+	go k8sManager.Watch(watchCtx)
+	go k8sManager.RunFailover(watchCtx)
+
+	// Instances created before gateway tokens moved into Secrets are
+	// migrated one at a time, without changing their tokens.
+	if cfg.GatewayTokenSecrets {
+		go func() {
+			n, err := k8sManager.MigrateGatewayTokens(watchCtx)
+			if err != nil {
+				log.Printf("gateway tokens: migration stopped after %d instance(s): %v", n, err)
+				sentry.CaptureException(fmt.Errorf("gateway token migration: %v", err))
+				return
+			}
+			log.Printf("gateway tokens: %d instance(s) migrated to secrets", n)
+		}()
+	}
+
+	// Tenant-provided configuration is scanned for credentials.
+	var secretScanner *secretscan.Scanner
+	if cfg.SecretScanMode != secretscan.ModeOff {
+		secretScanner = secretscan.New(secretscan.SharedKeys(cfg))
+	}
+
+	// API exchanges of keys an admin turns recording on for.
+	var recorder *recording.Recorder
+	if cfg.RecordingBufferSize > 0 {
+		recorder = recording.New(cfg.RecordingBufferSize, cfg.RecordingMaxBodyBytes)
+	}
+
 	// Initialize API handler
-	handler := api.NewHandler(k8sManager)
+	handler := api.NewHandler(k8sManager, cfg, api.Options{
+		CertSigner:   certSigner,
+		ExportStore:  exportStore,
+		Audit:        auditLog,
+		Usage:        usageLedger,
+		Status:       status.NewTracker(),
+		Uptime:       uptimeHistory,
+		Consistency:  checker,
+		Registry:     reg,
+		WorkQueue:    workQueue,
+		Profiles:     profiles,
+		Flags:        featureFlags,
+		Rollouts:     rollouts,
+		Rightsizing:  advisor,
+		CertMonitor:  certMonitor,
+		Health:       prober,
+		Webhooks:     webhookDispatcher,
+		AIBudget:     aiBudget,
+		Billing:      billingEngine,
+		SecretScan:   secretScanner,
+		ConfigSchema: configSchema,
+		Recordings:   recorder,
+		Sealer:       sealer,
+
+		AuditHistory: auditHistory,
+		Locales:      emailTemplates.Locales(),
+	})
+	// Operation state lives in the registry, so that any replica can report
+	// an operation queued on another.
+	go handler.RunOperationSync(watchCtx, cfg.OperationSyncInterval)
+	go reg.RunOperationPruning(watchCtx, cfg.OperationRetention)
+	// Creates a stopped replica left half-done are resumed or rolled back
+	// from the operation journal.
+	if cfg.JournalRecoveryInterval > 0 {
+		go recovery.New(k8sManager, reg, webhookDispatcher).Run(watchCtx, cfg.JournalRecoveryInterval, cfg.JournalStaleAfter)
+	}
+	go reg.RunReservationPruning(watchCtx)
+	if cfg.IdempotencyTTL > 0 {
+		go reg.RunIdempotencyPruning(watchCtx, cfg.IdempotencyTTL)
+	}
 
 	// Setup routes
 	r := chi.NewRouter()
-	r.Use(middleware.RequestID)
+	r.Use(api.Correlation)
 	r.Use(middleware.RealIP)
+	if cfg.CallerUserHeader != "" {
+		r.Use(api.CallerIdentity(cfg.CallerUserHeader, cfg.CallerGroupsHeader))
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	// Sentry sits inside Recoverer: it captures the panic with its stack and
+	// re-panics so that Recoverer still turns it into a 500.
+	r.Use(sentryhttp.New(sentryhttp.Options{Repanic: true}).Handle)
+	r.Use(api.SentryScope)
+	r.Use(middleware.Compress(5, "application/json", "application/yaml", "text/plain"))
+	// Inside Compress, so that recordings hold the uncompressed bodies.
+	r.Use(api.RecordExchanges(recorder))
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"status":"ok"}`))
 	})
 
-	r.Route("/tenants/{tenant-id}/instance", func(r chi.Router) {
-		r.Post("/", handler.CreateInstance)
-		r.Get("/", handler.GetInstance)
-		r.Delete("/", handler.DeleteInstance)
+	// Routes are grouped by how long their handlers may run; each group
+	// carries its own timeout (see RouteTimeout).
+
+	// Public, sanitized fleet health for the status page, the features this
+	// deployment supports and the running build.
+	r.Group(func(r chi.Router) {
+		r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+		r.Get("/status.json", handler.GetStatus)
+		r.Get("/status.atom", handler.GetStatusFeed)
+		r.Get("/capabilities", handler.GetCapabilities)
+		r.Get("/version", handler.GetVersion)
+	})
+
+	// Billing events authenticate with their signature.
+	r.With(api.RouteTimeout(cfg.WriteRouteTimeout)).Post("/billing/events", handler.HandleBillingEvent)
+
+	// The per-instance routes serve both the tenant's default instance, at
+	// /tenants/{tenant-id}/instance, and each of its instances by ID.
+	instanceRoutes := func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+			r.Get("/", handler.GetInstance)
+			r.Get("/uptime", handler.GetInstanceUptime)
+			r.Get("/metrics", handler.GetInstanceMetrics)
+			r.Get("/health", handler.GetInstanceHealth)
+			r.Get("/lifecycle", handler.GetInstanceLifecycle)
+			r.Get("/diagnostics", handler.GetInstanceDiagnostics)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.WriteRouteTimeout))
+			r.Post("/reactivate", handler.ReactivateInstance)
+			r.Put("/channel", handler.SetInstanceChannel)
+		})
+		// DELETE is a long operation because ?mode=purge waits for every
+		// artifact to disappear.
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.LongRouteTimeout))
+			r.Delete("/", handler.DeleteInstance)
+			r.Post("/lifecycle", handler.InstanceLifecycle)
+		})
+		// Event streams stay open until the client disconnects.
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(0))
+			r.Get("/events", handler.StreamInstanceEvents)
+		})
+	}
+
+	// Mutating requests with an Idempotency-Key replay their first response
+	// to retries; see Handler.Idempotency.
+	r.Route("/tenants/{tenant-id}", func(r chi.Router) {
+		r.Use(handler.Idempotency)
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+			r.Get("/instances", handler.ListTenantInstances)
+			r.Get("/export/{export-id}", handler.GetExport)
+			r.Get("/operations/{operation-id}", handler.GetOperation)
+			r.Get("/contact", handler.GetContact)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.WriteRouteTimeout))
+			r.Post("/instances", handler.CreateInstance)
+			r.Put("/contact", handler.PutContact)
+			r.Delete("/contact", handler.DeleteContact)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.LongRouteTimeout))
+			r.Post("/export", handler.CreateExport)
+		})
+		r.Route("/instance", func(r chi.Router) {
+			r.Use(api.DefaultInstance)
+			r.With(api.RouteTimeout(cfg.WriteRouteTimeout)).Post("/", handler.CreateInstance)
+			r.Route("/reservations", func(r chi.Router) {
+				r.Use(api.RouteTimeout(cfg.WriteRouteTimeout))
+				r.Post("/", handler.CreateReservation)
+				r.Get("/{reservation-id}", handler.GetReservation)
+				r.Delete("/{reservation-id}", handler.ReleaseReservation)
+				r.Post("/{reservation-id}/commit", handler.CommitReservation)
+			})
+			instanceRoutes(r)
+		})
+		r.Route("/instances/{instance-id}", func(r chi.Router) {
+			r.Use(api.SelectInstance)
+			instanceRoutes(r)
+		})
+	})
+
+	// The tenant self-service API, embedded in the customer dashboard, only
+	// offers operations that are safe for a tenant to run on its own instance.
+	r.Route("/self/instance", func(r chi.Router) {
+		r.Use(api.RequireTenantToken(tenantTokens))
+		r.Use(handler.Idempotency)
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+			r.Get("/", handler.GetSelfInstance)
+			r.Get("/logs", handler.GetSelfInstanceLogs)
+			r.Get("/ai-budget", handler.GetSelfAIBudget)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.WriteRouteTimeout))
+			r.Post("/restart", handler.RestartSelfInstance)
+			r.Post("/token/rotate", handler.RotateSelfToken)
+			r.Post("/ai-usage", handler.RecordSelfAIUsage)
+		})
+	})
+
+	// The reseller API: an organization's token reaches its own tenants, and
+	// may create new ones within the organization's quotas.
+	r.Route("/org", func(r chi.Router) {
+		r.Use(handler.RequireOrgToken)
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+			r.Get("/", handler.GetSelfOrg)
+			r.Get("/tenants", handler.ListSelfOrgTenants)
+			r.Get("/usage", handler.GetSelfOrgUsage)
+		})
+		r.Route("/tenants/{tenant-id}", func(r chi.Router) {
+			r.Use(handler.OrgTenant)
+			r.Use(handler.Idempotency)
+			r.With(api.RouteTimeout(cfg.ReadRouteTimeout)).Get("/instances", handler.ListTenantInstances)
+			r.With(api.RouteTimeout(cfg.WriteRouteTimeout)).Post("/instances", handler.CreateInstance)
+			r.Route("/instance", func(r chi.Router) {
+				r.Use(api.DefaultInstance)
+				r.With(api.RouteTimeout(cfg.ReadRouteTimeout)).Get("/", handler.GetInstance)
+				r.With(api.RouteTimeout(cfg.WriteRouteTimeout)).Post("/", handler.CreateInstance)
+				r.With(api.RouteTimeout(cfg.LongRouteTimeout)).Delete("/", handler.DeleteInstance)
+			})
+		})
+	})
+
+	// The admin dashboard's query API shares the admin token.
+	r.Group(func(r chi.Router) {
+		r.Use(api.RequireAdmin(cfg.AdminToken))
+		r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+		r.Get("/graphql", handler.GraphQL)
+		r.Post("/graphql", handler.GraphQL)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(api.RequireAdmin(cfg.AdminToken))
+		r.Use(handler.Idempotency)
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.ReadRouteTimeout))
+			r.Get("/permissions", handler.GetPermissions)
+			r.Get("/capacity", handler.GetCapacity)
+			r.Get("/health", handler.GetFleetHealth)
+			r.Get("/profiles", handler.GetProfiles)
+			r.Get("/flags", handler.ListFlags)
+			r.Get("/webhooks", handler.ListWebhooks)
+			r.Get("/webhooks/{webhook-id}", handler.GetWebhook)
+			r.Get("/webhooks/{webhook-id}/deliveries", handler.ListWebhookDeliveries)
+			r.Get("/events", handler.ListEvents)
+			r.Get("/rollouts", handler.ListRollouts)
+			r.Get("/rollouts/{rollout-id}", handler.GetRollout)
+			r.Get("/prepulls", handler.ListPrePulls)
+			r.Get("/prepulls/{prepull-id}", handler.GetPrePull)
+			r.Get("/reports/usage", handler.GetUsageReport)
+			r.Get("/ai-budgets", handler.ListAIBudgets)
+			r.Get("/ai-budgets/{tenant-id}", handler.GetAIBudget)
+			r.Get("/orgs", handler.ListOrgs)
+			r.Get("/orgs/{org-id}", handler.GetOrg)
+			r.Get("/orgs/{org-id}/usage", handler.GetOrgUsage)
+			r.Get("/billing/cases", handler.ListBillingCases)
+			r.Get("/billing/cases/{tenant-id}", handler.GetBillingCases)
+			r.Get("/certificates", handler.ListPendingCertificates)
+			r.Get("/rightsizing", handler.ListRightsizing)
+			r.Get("/consistency", handler.GetConsistency)
+			r.Get("/retained-storage", handler.ListRetainedStorage)
+			r.Get("/instances/bulk/{batch-id}", handler.GetBulkBatch)
+			r.Get("/tenants/batch/{batch-id}", handler.GetTenantBatch)
+			r.Get("/debug/recordings", handler.ListRecordings)
+			r.Get("/debug/recordings/{key-id}", handler.GetRecordings)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.WriteRouteTimeout))
+			r.Put("/flags/{flag}", handler.PutFlag)
+			r.Delete("/flags/{flag}", handler.DeleteFlag)
+			r.Post("/webhooks", handler.CreateWebhook)
+			r.Patch("/webhooks/{webhook-id}", handler.UpdateWebhook)
+			r.Delete("/webhooks/{webhook-id}", handler.DeleteWebhook)
+			r.Post("/webhooks/{webhook-id}/test", handler.TestWebhook)
+			r.Post("/rollouts", handler.StartRollout)
+			r.Post("/rollouts/{rollout-id}/halt", handler.HaltRollout)
+			r.Post("/prepulls", handler.StartPrePull)
+			r.Delete("/prepulls/{prepull-id}", handler.DeletePrePull)
+			r.Post("/ai-usage", handler.RecordAIUsage)
+			r.Put("/orgs/{org-id}", handler.PutOrg)
+			r.Delete("/orgs/{org-id}", handler.DeleteOrg)
+			r.Post("/orgs/{org-id}/tokens", handler.CreateOrgToken)
+			r.Delete("/orgs/{org-id}/tokens/{token-id}", handler.RevokeOrgToken)
+			r.Delete("/billing/cases/{tenant-id}", handler.ResolveBillingCases)
+			r.Post("/certificates/{tenant-id}/retry", handler.RetryCertificate)
+			r.Post("/rightsizing/{tenant-id}/apply", handler.ApplyRightsizing)
+			r.Post("/consistency/repair", handler.RepairConsistency)
+			r.Post("/incidents", handler.CreateIncident)
+			r.Post("/incidents/{incident-id}/resolve", handler.ResolveIncident)
+			r.Post("/instances/bulk", handler.BulkInstances)
+			r.Post("/tenants/batch", handler.CreateTenantBatch)
+			r.Post("/debug/recordings", handler.StartRecording)
+			r.Delete("/debug/recordings/{key-id}", handler.StopRecording)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RouteTimeout(cfg.LongRouteTimeout))
+			r.Post("/rebuild", handler.Rebuild)
+			r.Post("/import", handler.ImportTenants)
+		})
 	})
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Port,
 		Handler:      r,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 90 * time.Second,
-		IdleTimeout:  120 * time.Second,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	// Debug endpoints live on their own listener so they are never reachable
+	// through the public ingress.
+	var debugSrv *http.Server
+	if cfg.DebugAddr != "" {
+		debugSrv = &http.Server{
+			Addr:              cfg.DebugAddr,
+			Handler:           debug.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Printf("starting debug server on %s", cfg.DebugAddr)
+			if err := debugSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("debug server failed: %v", err)
+			}
+		}()
 	}
 
 	// Graceful shutdown
@@ -74,11 +849,18 @@ func main() {
 		if err := srv.Shutdown(ctx); err != nil {
 			log.Printf("graceful shutdown failed: %v", err)
 		}
+		if debugSrv != nil {
+			debugSrv.Close()
+		}
 	}()
 
 	log.Printf("starting tenant-provisioner on :%s", cfg.Port)
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("server failed: %v", err)
 	}
+
+	// Ship any buffered audit records before exiting.
+	stopAudit()
+	<-auditDone
 	log.Println("server stopped")
 }
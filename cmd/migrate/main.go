@@ -0,0 +1,102 @@
+// Command migrate manages the schema of the SQL registry stores. It reads the
+// same REGISTRY_STORE, REGISTRY_PATH and REGISTRY_DATABASE_URL variables as
+// the service:
+//
+//	migrate status     list migrations and whether they are applied
+//	migrate up [N]     apply the next N pending migrations, all by default
+//	migrate down N     revert the N most recently applied migrations
+//
+// Run it before starting a release with REGISTRY_AUTO_MIGRATE=false, or to
+// roll a schema change back before downgrading.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+func main() {
+	log.SetFlags(0)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: migrate status | up [N] | down N\n")
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	steps := 0
+	if flag.NArg() == 2 {
+		n, err := strconv.Atoi(flag.Arg(1))
+		if err != nil || n < 1 {
+			log.Fatalf("invalid step count %q: must be a positive integer", flag.Arg(1))
+		}
+		steps = n
+	}
+
+	cfg := config.Load()
+	store, err := registry.OpenSQLStore(registry.StoreConfig{
+		Kind:        cfg.RegistryStore,
+		Path:        cfg.RegistryPath,
+		DatabaseURL: cfg.RegistryDatabaseURL,
+	})
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer store.Close()
+
+	switch cmd := flag.Arg(0); cmd {
+	case "status":
+		if steps != 0 {
+			log.Fatalf("status takes no step count")
+		}
+		statuses, err := store.MigrationStatus()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		for _, st := range statuses {
+			name := st.Name
+			if name == "" {
+				name = "(unknown to this release)"
+			}
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-40s %s\n", st.Version, name, applied)
+		}
+	case "up":
+		done, err := store.MigrateUp(steps)
+		for _, m := range done {
+			fmt.Printf("applied %s\n", m)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		if len(done) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "down":
+		if steps == 0 {
+			log.Fatalf("down needs a step count")
+		}
+		done, err := store.MigrateDown(steps)
+		for _, m := range done {
+			fmt.Printf("reverted %s\n", m)
+		}
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	default:
+		log.Printf("unknown subcommand %q", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,239 @@
+// Command spec-lint renders the instance spec template for a set of sample
+// tenants and plans, validates each rendered OpenClawInstance against the
+// CRD's OpenAPI schema offline, and compares the output with golden files,
+// so that template breakage is caught before a deploy rather than by the
+// API server:
+//
+//	spec-lint                 render, validate and diff every sample
+//	spec-lint -update         rewrite the golden files from the rendered output
+//
+// Samples are rendered with only the variables in the samples file's config
+// block set, so that the output does not depend on the caller's environment
+// or hold its secrets. The provenance annotations use a fixed version and
+// commit. Run it from the repository root, or point the flags at the files.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/buildinfo"
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/configschema"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"sigs.k8s.io/yaml"
+)
+
+// samplesFile is the layout of the samples file.
+type samplesFile struct {
+	// Config holds the environment variables the service would be
+	// configured with, e.g. TENANT_DOMAIN or PROFILES_PATH.
+	Config  map[string]string `json:"config"`
+	Samples []sample          `json:"samples"`
+}
+
+// sample is one rendering of the template: a tenant and the options of its
+// create request.
+type sample struct {
+	Name         string                 `json:"name"`
+	TenantID     string                 `json:"tenant_id"`
+	InstanceName string                 `json:"instance_name"`
+	GatewayToken string                 `json:"gateway_token"`
+	Plan         string                 `json:"plan"`
+	CostCenter   string                 `json:"cost_center"`
+	ContactEmail string                 `json:"contact_email"`
+	Profile      string                 `json:"profile"`
+	Channel      string                 `json:"channel"`
+	Environment  string                 `json:"environment"`
+	Features     map[string]bool        `json:"features"`
+	Env          map[string]string      `json:"env"`
+	ConfigRaw    map[string]interface{} `json:"config_raw"`
+}
+
+func main() {
+	log.SetFlags(0)
+	samplesPath := flag.String("samples", "cmd/spec-lint/testdata/samples.yaml", "samples file")
+	goldenDir := flag.String("golden", "cmd/spec-lint/testdata/golden", "directory of golden files, one <sample>.yaml each")
+	crdPath := flag.String("crd", "internal/envtest/crds/openclawinstances.yaml", "OpenClawInstance CustomResourceDefinition manifest")
+	crdVersion := flag.String("crd-version", "v1alpha1", "CRD version to validate against")
+	update := flag.Bool("update", false, "rewrite the golden files instead of comparing with them")
+	flag.Parse()
+
+	data, err := os.ReadFile(*samplesPath)
+	if err != nil {
+		log.Fatalf("reading samples: %v", err)
+	}
+	var file samplesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		log.Fatalf("parsing samples %s: %v", *samplesPath, err)
+	}
+	data, err = os.ReadFile(*crdPath)
+	if err != nil {
+		log.Fatalf("reading CRD: %v", err)
+	}
+	crdSchema, err := configschema.ParseCRD(data, *crdVersion)
+	if err != nil {
+		log.Fatalf("%s: %v", *crdPath, err)
+	}
+
+	os.Clearenv()
+	for k, v := range file.Config {
+		os.Setenv(k, v)
+	}
+	buildinfo.Version, buildinfo.Commit = "spec-lint", "spec-lint"
+	cfg := config.Load()
+	profiles, err := k8s.LoadProfiles(cfg.ProfilesPath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	rawSchema, err := configschema.Load(cfg.ConfigRawSchemaPath)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	failed := 0
+	for _, s := range file.Samples {
+		problems, err := lint(cfg, profiles, rawSchema, crdSchema, s, *goldenDir, *update)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) == 0 {
+			fmt.Printf("ok    %s\n", s.Name)
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL  %s\n", s.Name)
+		for _, p := range problems {
+			fmt.Printf("      %s\n", strings.ReplaceAll(p, "\n", "\n      "))
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d samples failed\n", failed, len(file.Samples))
+		if !*update {
+			fmt.Printf("if the changes are intended, bump k8s.SpecTemplateRevision and run spec-lint -update\n")
+		}
+		os.Exit(1)
+	}
+}
+
+// lint renders a sample, validates it and compares it with, or with update
+// writes, its golden file. It returns the problems found.
+func lint(cfg *config.Config, profiles map[string]*k8s.Profile, rawSchema, crdSchema *configschema.Schema, s sample, goldenDir string, update bool) ([]string, error) {
+	if s.Name == "" || s.TenantID == "" || s.InstanceName == "" {
+		return nil, fmt.Errorf("sample needs a name, tenant_id and instance_name")
+	}
+	opts := k8s.CreateOptions{
+		GatewayToken: s.GatewayToken,
+		Plan:         s.Plan,
+		CostCenter:   s.CostCenter,
+		ContactEmail: s.ContactEmail,
+		Channel:      s.Channel,
+		Environment:  s.Environment,
+		Features:     s.Features,
+		Env:          s.Env,
+		RawConfig:    s.ConfigRaw,
+	}
+	if s.Profile != "" {
+		if opts.Profile = profiles[s.Profile]; opts.Profile == nil {
+			return nil, fmt.Errorf("unknown profile %q", s.Profile)
+		}
+		if opts.Plan == "" {
+			opts.Plan = opts.Profile.Plan
+		}
+	}
+
+	var problems []string
+	for name := range s.Env {
+		if err := k8s.CheckEnvOverride(name); err != nil {
+			problems = append(problems, "env: "+err.Error())
+		}
+	}
+	if len(s.ConfigRaw) > 0 {
+		if err := k8s.CheckConfigOverride(s.ConfigRaw); err != nil {
+			problems = append(problems, err.Error())
+		}
+		problems = append(problems, rawSchema.Validate("config.raw", s.ConfigRaw)...)
+	}
+
+	objects, err := k8s.RenderInstanceSpec(cfg, s.InstanceName, s.TenantID, opts)
+	if err != nil {
+		return problems, err
+	}
+	for _, v := range crdSchema.ValidateObject(objects[0]) {
+		problems = append(problems, "schema: "+v)
+	}
+
+	var rendered bytes.Buffer
+	for i, obj := range objects {
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return problems, err
+		}
+		if i > 0 {
+			rendered.WriteString("---\n")
+		}
+		rendered.Write(out)
+	}
+	path := filepath.Join(goldenDir, s.Name+".yaml")
+	if update {
+		if err := os.MkdirAll(goldenDir, 0o755); err != nil {
+			return problems, err
+		}
+		return problems, os.WriteFile(path, rendered.Bytes(), 0o644)
+	}
+	golden, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return append(problems, fmt.Sprintf("no golden file %s; run spec-lint -update", path)), nil
+	}
+	if err != nil {
+		return problems, err
+	}
+	if d := diff(string(golden), rendered.String()); d != "" {
+		problems = append(problems, fmt.Sprintf("rendered spec differs from %s:\n%s", path, d))
+	}
+	return problems, nil
+}
+
+// diff returns the lines removed from a ("-") and added in b ("+"), with the
+// line numbers of b, or "" when they are equal.
+func diff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	var out []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, fmt.Sprintf("%4d - %s", j+1, x[i]))
+			i++
+		default:
+			out = append(out, fmt.Sprintf("%4d + %s", j+1, y[j]))
+			j++
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,164 @@
+// Package aibudget holds tenants to monthly AI usage budgets set per plan.
+// Usage reported by instances, or by the egress proxy on their behalf, is
+// added to the usage ledger; at the warning threshold an ai_budget.warning
+// webhook is sent, and once the budget is spent the tenant is throttled or
+// its instances suspended, with an ai_budget.exceeded webhook. Each happens
+// once per tenant and month.
+package aibudget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/usage"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+)
+
+// Actions taken when a tenant spends its budget.
+const (
+	ActionThrottle = "throttle" // Report the tenant as throttled until the month ends
+	ActionSuspend  = "suspend"  // Also suspend the tenant's instances
+)
+
+// ValidAction reports whether a names an action.
+func ValidAction(a string) bool {
+	return a == ActionThrottle || a == ActionSuspend
+}
+
+// Config sets the budgets and what happens as they are spent.
+type Config struct {
+	TokenBudgets   map[string]int64 // Monthly tokens by plan; "*" for plans not listed
+	RequestBudgets map[string]int64 // Monthly requests by plan; "*" for plans not listed
+	WarnAt         float64          // Fraction of a budget that triggers the warning
+	Action         string           // ActionThrottle or ActionSuspend
+}
+
+// Report is AI usage reported for a tenant since its last report.
+type Report struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	Requests     int64 `json:"requests"`
+}
+
+// Status is a tenant's AI usage against its budget in the current month. A
+// budget of 0 is unlimited.
+type Status struct {
+	TenantID      string     `json:"tenant_id"`
+	Month         string     `json:"month"`
+	Plan          string     `json:"plan,omitempty"`
+	Tokens        int64      `json:"tokens"`
+	Requests      int64      `json:"requests"`
+	TokenBudget   int64      `json:"token_budget"`
+	RequestBudget int64      `json:"request_budget"`
+	Used          float64    `json:"used"` // Largest fraction spent of either budget
+	Throttled     bool       `json:"throttled"`
+	WarnedAt      *time.Time `json:"warned_at,omitempty"`
+	ExceededAt    *time.Time `json:"exceeded_at,omitempty"`
+}
+
+// Enforcer records AI usage and enforces the budgets.
+type Enforcer struct {
+	ledger   *usage.Ledger
+	mgr      k8s.InstanceManager
+	webhooks *webhooks.Dispatcher
+	cfg      Config
+}
+
+// New creates an Enforcer keeping usage in ledger, suspending through mgr and
+// warning through d, which may be nil.
+func New(ledger *usage.Ledger, mgr k8s.InstanceManager, d *webhooks.Dispatcher, cfg Config) *Enforcer {
+	return &Enforcer{ledger: ledger, mgr: mgr, webhooks: d, cfg: cfg}
+}
+
+// Record adds a report to the tenant's usage, acts on any threshold it
+// crosses and returns the tenant's status.
+func (e *Enforcer) Record(ctx context.Context, tenantID string, rep Report) (*Status, error) {
+	if rep.InputTokens < 0 || rep.OutputTokens < 0 || rep.Requests < 0 {
+		return nil, fmt.Errorf("usage must not be negative")
+	}
+	now := time.Now()
+	st := e.status(tenantID, e.ledger.RecordAI(tenantID, now, rep.InputTokens, rep.OutputTokens, rep.Requests))
+
+	if st.Used >= e.cfg.WarnAt && st.Used < 1 && e.ledger.MarkAIWarned(tenantID, now) {
+		log.Printf("aibudget: tenant %s has used %.0f%% of its %s AI budget", tenantID, st.Used*100, st.Month)
+		e.webhooks.PublishTenantEvent(webhooks.EventAIBudgetWarning, tenantID,
+			fmt.Sprintf("%.0f%% of the %s AI budget used (%s)", st.Used*100, st.Month, st.usage()))
+	}
+	if st.Used >= 1 && e.ledger.MarkAIExceeded(tenantID, now) {
+		e.exceeded(ctx, st)
+	}
+	return e.Status(tenantID), nil
+}
+
+// exceeded acts on a tenant that has spent its budget.
+func (e *Enforcer) exceeded(ctx context.Context, st *Status) {
+	message := fmt.Sprintf("%s AI budget exceeded (%s); tenant throttled", st.Month, st.usage())
+	if e.cfg.Action == ActionSuspend {
+		message = fmt.Sprintf("%s AI budget exceeded (%s); instances suspended", st.Month, st.usage())
+		if err := e.mgr.SuspendInstance(ctx, st.TenantID); err != nil && !errors.Is(err, k8s.ErrNotFound) {
+			log.Printf("aibudget: suspending tenant %s: %v", st.TenantID, err)
+			message = fmt.Sprintf("%s AI budget exceeded (%s); suspending instances failed: %v", st.Month, st.usage(), err)
+		}
+	}
+	log.Printf("aibudget: tenant %s: %s", st.TenantID, message)
+	e.webhooks.PublishTenantEvent(webhooks.EventAIBudgetExceeded, st.TenantID, message)
+}
+
+// Status returns the tenant's status in the current month.
+func (e *Enforcer) Status(tenantID string) *Status {
+	return e.status(tenantID, e.ledger.AI(tenantID, time.Now()))
+}
+
+// Statuses returns the status of every tenant with AI usage in the current
+// month, most used first.
+func (e *Enforcer) Statuses() []Status {
+	month := e.ledger.AIMonth(time.Now())
+	out := make([]Status, 0, len(month))
+	for _, u := range month {
+		out = append(out, *e.status(u.TenantID, u))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Used > out[j].Used })
+	return out
+}
+
+// status computes a tenant's status from its month's usage.
+func (e *Enforcer) status(tenantID string, u usage.AIUsage) *Status {
+	plan := e.ledger.Plan(tenantID)
+	st := &Status{
+		TenantID:      tenantID,
+		Month:         u.Month,
+		Plan:          plan,
+		Tokens:        u.Tokens(),
+		Requests:      u.Requests,
+		TokenBudget:   budget(e.cfg.TokenBudgets, plan),
+		RequestBudget: budget(e.cfg.RequestBudgets, plan),
+		WarnedAt:      u.WarnedAt,
+		ExceededAt:    u.ExceededAt,
+	}
+	if st.TokenBudget > 0 {
+		st.Used = float64(st.Tokens) / float64(st.TokenBudget)
+	}
+	if st.RequestBudget > 0 {
+		st.Used = max(st.Used, float64(st.Requests)/float64(st.RequestBudget))
+	}
+	st.Throttled = st.Used >= 1
+	return st
+}
+
+// usage describes the tenant's usage for messages.
+func (st *Status) usage() string {
+	return fmt.Sprintf("%d tokens, %d requests", st.Tokens, st.Requests)
+}
+
+// budget returns the plan's budget, or the "*" one, or 0 for none.
+func budget(budgets map[string]int64, plan string) int64 {
+	if b, ok := budgets[plan]; ok {
+		return b
+	}
+	return budgets["*"]
+}
@@ -0,0 +1,251 @@
+// Package alerting pages operators when instance provisioning fails or a
+// running instance keeps failing its health checks, via a Slack incoming
+// webhook and/or PagerDuty Events API v2.
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/healthcheck"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// pagerDutyURL is the PagerDuty Events API v2 enqueue endpoint.
+const pagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// Config selects the alert channels and the provisioning deadline.
+type Config struct {
+	SlackWebhookURL     string
+	PagerDutyRoutingKey string
+	Deadline            time.Duration // Alert when an instance is not running after this long; 0 disables
+	Source              string        // Reported as the PagerDuty source, e.g. the namespace
+}
+
+// Alert describes one provisioning failure or degraded instance.
+type Alert struct {
+	TenantID     string
+	InstanceName string
+	Reason       string // "error", "deadline" or "degraded"
+	Detail       string
+}
+
+// dedupKey identifies an instance's incident so that repeats are collapsed.
+func (a Alert) dedupKey() string { return "tenant-provisioner/" + a.InstanceName }
+
+func (a Alert) summary() string {
+	s := fmt.Sprintf("Provisioning failed for tenant %s (instance %s): %s", a.TenantID, a.InstanceName, a.Reason)
+	if a.Reason == "degraded" {
+		s = fmt.Sprintf("Instance %s of tenant %s is degraded", a.InstanceName, a.TenantID)
+	}
+	if a.Detail != "" {
+		s += " — " + a.Detail
+	}
+	return s
+}
+
+// tracked is the alerter's view of one instance.
+type tracked struct {
+	tenantID string
+	created  time.Time
+	status   string
+	message  string
+	alerted  bool
+	degraded bool // The open alert, if any, is for failing health checks
+}
+
+// Alerter follows instance events and raises one alert per failing instance.
+type Alerter struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	instances map[string]*tracked // By instance name
+}
+
+// New creates an Alerter.
+func New(cfg Config) *Alerter {
+	return &Alerter{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 15 * time.Second},
+		instances: make(map[string]*tracked),
+	}
+}
+
+// HandleInstanceEvent records instance state and alerts on entry into the
+// error state; pass it to OnInstanceEvent. An instance that recovers to
+// running resolves its PagerDuty incident and may alert again later.
+func (a *Alerter) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.Info == nil {
+		return
+	}
+	name := ev.Info.Name
+
+	a.mu.Lock()
+	if ev.Type == k8s.InstanceDeleted {
+		delete(a.instances, name)
+		a.mu.Unlock()
+		return
+	}
+	t, ok := a.instances[name]
+	if !ok {
+		t = &tracked{tenantID: ev.TenantID, created: ev.Info.CreatedAt}
+		if t.created.IsZero() {
+			t.created = time.Now()
+		}
+		a.instances[name] = t
+	}
+	t.status = ev.Info.Status
+	t.message = ev.Info.Message
+
+	var fire, resolve bool
+	switch {
+	case t.status == "error" && !t.alerted:
+		t.alerted, fire = true, true
+	case t.status == "running" && t.alerted && !t.degraded:
+		t.alerted, resolve = false, true
+	}
+	a.mu.Unlock()
+
+	alert := Alert{TenantID: ev.TenantID, InstanceName: name, Reason: "error", Detail: ev.Info.Message}
+	if fire {
+		go a.send(alert, "trigger")
+	}
+	if resolve {
+		go a.send(alert, "resolve")
+	}
+}
+
+// HandleHealthChange alerts when health probing marks a running instance
+// degraded and resolves the alert when it recovers; pass it to the prober's
+// OnChange. An instance already alerting for a provisioning failure does not
+// alert again.
+func (a *Alerter) HandleHealthChange(c healthcheck.Change) {
+	a.mu.Lock()
+	t, ok := a.instances[c.Instance]
+	if !ok {
+		a.mu.Unlock()
+		return
+	}
+	var fire, resolve bool
+	switch {
+	case c.Degraded && !t.alerted:
+		t.alerted, t.degraded, fire = true, true, true
+	case !c.Degraded && t.degraded:
+		t.alerted, t.degraded, resolve = false, false, true
+	}
+	a.mu.Unlock()
+
+	alert := Alert{TenantID: c.TenantID, InstanceName: c.Instance, Reason: "degraded", Detail: c.Detail}
+	if fire {
+		go a.send(alert, "trigger")
+	}
+	if resolve {
+		go a.send(alert, "resolve")
+	}
+}
+
+// Run checks for instances that have missed the provisioning deadline until
+// ctx is cancelled.
+func (a *Alerter) Run(ctx context.Context) {
+	if a.cfg.Deadline <= 0 {
+		return
+	}
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var overdue []Alert
+		a.mu.Lock()
+		for name, t := range a.instances {
+			if t.alerted || t.status == "running" || t.status == "suspended" || time.Since(t.created) < a.cfg.Deadline {
+				continue
+			}
+			t.alerted = true
+			overdue = append(overdue, Alert{
+				TenantID:     t.tenantID,
+				InstanceName: name,
+				Reason:       "deadline",
+				Detail:       fmt.Sprintf("still %s after %s", t.status, a.cfg.Deadline),
+			})
+		}
+		a.mu.Unlock()
+
+		for _, alert := range overdue {
+			a.send(alert, "trigger")
+		}
+	}
+}
+
+// send delivers alert to every configured channel. action is "trigger" or
+// "resolve"; Slack only receives triggers.
+func (a *Alerter) send(alert Alert, action string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	log.Printf("alert %s: %s", action, alert.summary())
+	if a.cfg.SlackWebhookURL != "" && action == "trigger" {
+		if err := a.post(ctx, a.cfg.SlackWebhookURL, map[string]string{"text": ":rotating_light: " + alert.summary()}); err != nil {
+			log.Printf("alerting: Slack: %v", err)
+		}
+	}
+	if a.cfg.PagerDutyRoutingKey != "" {
+		event := map[string]interface{}{
+			"routing_key":  a.cfg.PagerDutyRoutingKey,
+			"event_action": action,
+			"dedup_key":    alert.dedupKey(),
+		}
+		if action == "trigger" {
+			event["payload"] = map[string]interface{}{
+				"summary":  alert.summary(),
+				"source":   a.cfg.Source,
+				"severity": "error",
+				"custom_details": map[string]string{
+					"tenant_id": alert.TenantID,
+					"instance":  alert.InstanceName,
+					"reason":    alert.Reason,
+					"detail":    alert.Detail,
+				},
+			}
+		}
+		if err := a.post(ctx, pagerDutyURL, event); err != nil {
+			log.Printf("alerting: PagerDuty: %v", err)
+		}
+	}
+}
+
+// post sends v as JSON to url.
+func (a *Alerter) post(ctx context.Context, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
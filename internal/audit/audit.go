@@ -0,0 +1,143 @@
+// Package audit records who did what to which tenant and ships those records
+// in batches to long-term storage.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxBuffered caps the number of unshipped entries kept in memory while the
+// sink is failing; the oldest entries are dropped beyond it.
+const maxBuffered = 100000
+
+// Entry is a single audit record.
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Action        string    `json:"action"`
+	TenantID      string    `json:"tenant_id,omitempty"`
+	Outcome       string    `json:"outcome"` // "success" or "failure"
+	Detail        string    `json:"detail,omitempty"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Caller        string    `json:"caller,omitempty"`
+}
+
+// Sink persists a batch of entries. Implementations must be safe to retry
+// with the same batch after a failure.
+type Sink interface {
+	Ship(ctx context.Context, batch []Entry) error
+}
+
+// Logger buffers entries and periodically hands them to a Sink. A nil *Logger
+// is valid and only writes entries to the process log.
+type Logger struct {
+	sink      Sink
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	buf     []Entry
+	dropped int // total entries discarded by overflow, to reconcile in-flight flushes
+	flushCh chan struct{}
+}
+
+// NewLogger creates a Logger that ships to sink every interval, or sooner once
+// batchSize entries are buffered.
+func NewLogger(sink Sink, batchSize int, interval time.Duration) *Logger {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &Logger{
+		sink:      sink,
+		batchSize: batchSize,
+		interval:  interval,
+		flushCh:   make(chan struct{}, 1),
+	}
+}
+
+// Record appends an entry to the audit trail, stamping its time if unset.
+func (l *Logger) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if b, err := json.Marshal(e); err == nil {
+		log.Printf("audit: %s", b)
+	}
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	l.buf = append(l.buf, e)
+	if n := len(l.buf); n > maxBuffered {
+		log.Printf("audit: buffer full, dropping %d oldest entries", n-maxBuffered)
+		l.buf = l.buf[n-maxBuffered:]
+		l.dropped += n - maxBuffered
+	}
+	full := len(l.buf) >= l.batchSize
+	l.mu.Unlock()
+
+	if full {
+		select {
+		case l.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run ships buffered entries until ctx is cancelled, then performs a final
+// flush with a short grace period.
+func (l *Logger) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := l.Flush(flushCtx); err != nil {
+				log.Printf("audit: final flush failed: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		case <-l.flushCh:
+		}
+		if err := l.Flush(ctx); err != nil {
+			log.Printf("audit: flush failed, will retry: %v", err)
+		}
+	}
+}
+
+// Flush ships everything buffered so far in batches of at most batchSize.
+// Entries from a failed batch are kept for the next attempt.
+func (l *Logger) Flush(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		n := len(l.buf)
+		if n > l.batchSize {
+			n = l.batchSize
+		}
+		batch := append([]Entry(nil), l.buf[:n]...)
+		droppedBefore := l.dropped
+		l.mu.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := l.sink.Ship(ctx, batch); err != nil {
+			return err
+		}
+
+		// Overflow may have discarded part of the shipped batch meanwhile.
+		l.mu.Lock()
+		shipped := len(batch) - (l.dropped - droppedBefore)
+		if shipped > 0 {
+			l.buf = l.buf[shipped:]
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,60 @@
+package audit
+
+import "sync"
+
+// History keeps the most recent entries in memory so that they can be
+// queried without reading back from long-term storage. A nil *History is
+// valid and keeps nothing.
+type History struct {
+	size int
+
+	mu      sync.Mutex
+	entries []Entry // Ring buffer, oldest first until it is full
+	next    int     // Where the next entry goes once it is full
+}
+
+// NewHistory creates a History holding up to size entries.
+func NewHistory(size int) *History {
+	if size <= 0 {
+		size = 10000
+	}
+	return &History{size: size}
+}
+
+// Add appends e, overwriting the oldest entry once the history is full.
+func (h *History) Add(e Entry) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.entries) < h.size {
+		h.entries = append(h.entries, e)
+		return
+	}
+	h.entries[h.next] = e
+	h.next = (h.next + 1) % h.size
+}
+
+// Query returns up to limit entries, newest first, optionally restricted to
+// a tenant and/or action. A limit of 0 or less returns every match.
+func (h *History) Query(tenantID, action string, limit int) []Entry {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []Entry
+	n := len(h.entries)
+	for i := 0; i < n; i++ {
+		e := h.entries[(h.next-1-i+2*n)%n] // Newest first
+		if (tenantID != "" && e.TenantID != tenantID) || (action != "" && e.Action != action) {
+			continue
+		}
+		out = append(out, e)
+		if limit > 0 && len(out) == limit {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package audit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHistoryQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		added    int // Entries e0, e1, ... for tenants a, b, a, b, ...
+		tenantID string
+		action   string
+		limit    int
+		want     string
+	}{
+		{"empty", 3, 0, "", "", 0, ""},
+		{"not yet full", 3, 2, "", "", 0, "e1 e0"},
+		{"full", 3, 3, "", "", 0, "e2 e1 e0"},
+		{"oldest overwritten", 3, 5, "", "", 0, "e4 e3 e2"},
+		{"wrapped more than once", 3, 7, "", "", 0, "e6 e5 e4"},
+		{"limit", 3, 5, "", "", 2, "e4 e3"},
+		{"by tenant", 4, 6, "a", "", 0, "e4 e2"},
+		{"by action", 4, 6, "", "act1", 0, "e5 e3"},
+		{"by tenant and action", 4, 6, "a", "act1", 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistory(tt.size)
+			for i := 0; i < tt.added; i++ {
+				h.Add(Entry{Action: fmt.Sprintf("act%d", i%2), TenantID: string(rune('a' + i%2)), Detail: fmt.Sprintf("e%d", i)})
+			}
+			var got []string
+			for _, e := range h.Query(tt.tenantID, tt.action, tt.limit) {
+				got = append(got, e.Detail)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Query = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilHistory(t *testing.T) {
+	var h *History
+	h.Add(Entry{Action: "create"})
+	if got := h.Query("", "", 0); got != nil {
+		t.Errorf("Query on nil History = %v, want nil", got)
+	}
+}
@@ -0,0 +1,58 @@
+package audit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+
+	"github.com/mchatman/tenant-provisioner/internal/objectstore"
+)
+
+// ObjectStoreSink writes each batch as a gzip-compressed NDJSON object, with a
+// sibling ".sha256" object holding its checksum in sha256sum format. Objects
+// are keyed by date so that bucket lifecycle and object-lock rules can be
+// applied per prefix.
+type ObjectStoreSink struct {
+	store  *objectstore.Client
+	prefix string
+}
+
+// NewObjectStoreSink creates a sink writing under prefix in store's bucket.
+func NewObjectStoreSink(store *objectstore.Client, prefix string) *ObjectStoreSink {
+	return &ObjectStoreSink{store: store, prefix: prefix}
+}
+
+// Ship uploads batch. The object name is derived from the first entry's time
+// and a content hash, so retrying the same batch overwrites rather than
+// duplicates it.
+func (s *ObjectStoreSink) Ship(ctx context.Context, batch []Entry) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(gz)
+	for _, e := range batch {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("encoding audit entry: %v", err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("compressing audit batch: %v", err)
+	}
+	data := buf.Bytes()
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	first := batch[0].Time.UTC()
+	name := fmt.Sprintf("%s-%s.ndjson.gz", first.Format("20060102T150405Z"), checksum[:12])
+	key := path.Join(s.prefix, first.Format("2006/01/02"), name)
+
+	if err := s.store.Put(ctx, key, data, "application/gzip"); err != nil {
+		return err
+	}
+	return s.store.Put(ctx, key+".sha256", []byte(checksum+"  "+name+"\n"), "text/plain")
+}
@@ -0,0 +1,378 @@
+// Package billing turns events from the billing system, such as a failed
+// payment or a canceled subscription, into lifecycle actions on the tenant
+// after grace periods set per event: a warning webhook, then suspension of
+// the tenant's instances, then their deletion. Each event opens a case in
+// the registry that records the actions taken; the matching recovery event,
+// a successful payment or a reactivated subscription, closes it and resumes
+// instances the case suspended. Every action is audited.
+package billing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/audit"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+)
+
+// Billing events. The first two open a case; the others close it.
+const (
+	EventPaymentFailed           = "payment_failed"
+	EventSubscriptionCanceled    = "subscription_canceled"
+	EventPaymentSucceeded        = "payment_succeeded"
+	EventSubscriptionReactivated = "subscription_reactivated"
+)
+
+// resolves maps each closing event to the event of the case it closes.
+var resolves = map[string]string{
+	EventPaymentSucceeded:        EventPaymentFailed,
+	EventSubscriptionReactivated: EventSubscriptionCanceled,
+}
+
+// Lifecycle actions a policy can take.
+const (
+	ActionWarn    = "warn"    // Send a billing.warning webhook
+	ActionSuspend = "suspend" // Suspend the tenant's instances
+	ActionDelete  = "delete"  // Delete the tenant's instances, which closes the case
+)
+
+// actionOrder orders actions due at the same time.
+var actionOrder = map[string]int{ActionWarn: 0, ActionSuspend: 1, ActionDelete: 2}
+
+// Step is an action a policy takes After the billing event occurred.
+type Step struct {
+	Action string
+	After  time.Duration
+}
+
+// Policy is the steps taken on a case, in the order they fall due. An empty
+// policy only tracks the case.
+type Policy []Step
+
+// ParsePolicy parses a policy from action=delay pairs, such as
+// {"warn": "72h", "suspend": "168h", "delete": "720h"}.
+func ParsePolicy(steps map[string]string) (Policy, error) {
+	var p Policy
+	for action, after := range steps {
+		if _, ok := actionOrder[action]; !ok {
+			return nil, fmt.Errorf("unknown action %q: must be warn, suspend or delete", action)
+		}
+		d, err := time.ParseDuration(after)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid delay %q for %s", after, action)
+		}
+		p = append(p, Step{Action: action, After: d})
+	}
+	sort.Slice(p, func(i, j int) bool {
+		if p[i].After != p[j].After {
+			return p[i].After < p[j].After
+		}
+		return actionOrder[p[i].Action] < actionOrder[p[j].Action]
+	})
+	return p, nil
+}
+
+// Event is a billing event about a tenant, as posted by the billing system.
+type Event struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	TenantID   string    `json:"tenant_id"`
+	OccurredAt time.Time `json:"occurred_at"` // Defaults to when it is received
+}
+
+// Outcomes of Handle.
+const (
+	OutcomeOpened   = "opened"   // The event opened a case
+	OutcomeOpen     = "open"     // The tenant already had a case for the event
+	OutcomeResolved = "resolved" // The event closed a case
+	OutcomeIgnored  = "ignored"  // No case to open or close
+)
+
+// leaseName names the registry lease held by the replica running the
+// policy loop.
+const leaseName = "billing-policy"
+
+// Engine applies the policies to billing cases.
+type Engine struct {
+	reg      *registry.Registry
+	mgr      k8s.InstanceManager
+	webhooks *webhooks.Dispatcher
+	audit    *audit.Logger
+	history  *audit.History
+	policies map[string]Policy
+	holder   string // This replica, as the holder of the lease
+}
+
+// New creates an Engine that keeps cases in reg, acts through mgr, announces
+// through d and audits to auditLog and history, any of which but reg and mgr
+// may be nil. policies holds the policy of each opening event.
+func New(reg *registry.Registry, mgr k8s.InstanceManager, d *webhooks.Dispatcher, auditLog *audit.Logger, history *audit.History, policies map[string]Policy) *Engine {
+	return &Engine{reg: reg, mgr: mgr, webhooks: d, audit: auditLog, history: history, policies: policies, holder: leaseHolder()}
+}
+
+// leaseHolder identifies this process among the replicas: its host name,
+// which is the pod name, and a random suffix that tells restarts apart.
+func leaseHolder() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// Handle opens or closes a case for ev and takes any action already due.
+// Events of other types are ignored, as is a closing event that occurred
+// before the case it would close was opened.
+func (e *Engine) Handle(ctx context.Context, ev Event) (string, error) {
+	now := time.Now().UTC()
+	if ev.OccurredAt.IsZero() || ev.OccurredAt.After(now) {
+		ev.OccurredAt = now
+	}
+	if _, ok := e.policies[ev.Type]; ok {
+		return e.open(ctx, ev)
+	}
+	if event, ok := resolves[ev.Type]; ok {
+		return e.resolve(ctx, ev.TenantID, event, ev.OccurredAt, "event="+ev.Type+" event_id="+ev.ID)
+	}
+	return OutcomeIgnored, nil
+}
+
+// open opens the tenant's case for ev, unless one is open already.
+func (e *Engine) open(ctx context.Context, ev Event) (string, error) {
+	cases, err := e.reg.TenantBillingCases(ev.TenantID)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range cases {
+		if c.Event == ev.Type {
+			return OutcomeOpen, nil
+		}
+	}
+	c := registry.BillingCase{TenantID: ev.TenantID, Event: ev.Type, EventID: ev.ID, OpenedAt: ev.OccurredAt.UTC()}
+	added, err := e.reg.AddBillingCase(c)
+	if err != nil {
+		return "", err
+	}
+	if !added {
+		return OutcomeOpen, nil
+	}
+	log.Printf("billing: opened %s case of tenant %s", c.Event, c.TenantID)
+	e.evaluate(ctx, c, time.Now())
+	return OutcomeOpened, nil
+}
+
+// Resolve closes every open case of the tenant, as their closing events
+// would.
+func (e *Engine) Resolve(ctx context.Context, tenantID, detail string) (int, error) {
+	cases, err := e.reg.TenantBillingCases(tenantID)
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cases {
+		if _, err := e.resolve(ctx, tenantID, c.Event, time.Now(), detail); err != nil {
+			return 0, err
+		}
+	}
+	return len(cases), nil
+}
+
+// resolve closes the tenant's case for event, if it was opened before at,
+// and resumes the tenant's instances if the case suspended them and no other
+// case holds them suspended.
+func (e *Engine) resolve(ctx context.Context, tenantID, event string, at time.Time, detail string) (string, error) {
+	cases, err := e.reg.TenantBillingCases(tenantID)
+	if err != nil {
+		return "", err
+	}
+	var c *registry.BillingCase
+	stillSuspended := false
+	for i := range cases {
+		if cases[i].Event == event {
+			c = &cases[i]
+		} else if cases[i].Taken(ActionSuspend) {
+			stillSuspended = true
+		}
+	}
+	if c == nil || at.Before(c.OpenedAt) {
+		return OutcomeIgnored, nil
+	}
+	if err := e.reg.DeleteBillingCase(tenantID, event); err != nil {
+		return "", err
+	}
+	log.Printf("billing: resolved %s case of tenant %s", event, tenantID)
+	e.record("billing.resolve", tenantID, "case="+event+" "+detail, nil)
+
+	message := fmt.Sprintf("%s case resolved", event)
+	if c.Taken(ActionSuspend) && !stillSuspended {
+		err := e.mgr.ResumeInstance(ctx, tenantID)
+		if errors.Is(err, k8s.ErrNotFound) {
+			err = nil
+		}
+		e.record("billing.resume", tenantID, "case="+event, err)
+		if err != nil {
+			log.Printf("billing: resuming tenant %s: %v", tenantID, err)
+			message = fmt.Sprintf("%s case resolved; resuming instances failed: %v", event, err)
+		} else {
+			message = fmt.Sprintf("%s case resolved; instances resumed", event)
+		}
+	}
+	e.webhooks.PublishTenantEvent(webhooks.EventBillingResolved, tenantID, message)
+	return OutcomeResolved, nil
+}
+
+// Cases returns every open case, oldest first.
+func (e *Engine) Cases() ([]registry.BillingCase, error) {
+	return e.reg.BillingCases()
+}
+
+// TenantCases returns the tenant's open cases, oldest first.
+func (e *Engine) TenantCases(tenantID string) ([]registry.BillingCase, error) {
+	return e.reg.TenantBillingCases(tenantID)
+}
+
+// Evaluate takes the actions that have fallen due on every open case.
+func (e *Engine) Evaluate(ctx context.Context) error {
+	cases, err := e.reg.BillingCases()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, c := range cases {
+		e.evaluate(ctx, c, now)
+	}
+	return nil
+}
+
+// evaluate takes the actions due on c by now, in order. An action that fails
+// is retried on the next pass, before any later one is taken.
+//
+// Each action is claimed before it is taken, by recording it on the case
+// only if the case is still as read. Evaluations of the same case, from an
+// event and the policy loop or on different replicas, therefore never take
+// an action twice: the one that loses the claim stops, leaving the case to
+// the winner. A failed action's claim is withdrawn so that it is retried.
+func (e *Engine) evaluate(ctx context.Context, c registry.BillingCase, now time.Time) {
+	for _, step := range e.policies[c.Event] {
+		if c.Taken(step.Action) || now.Before(c.OpenedAt.Add(step.After)) {
+			continue
+		}
+		claimed := c
+		claimed.Actions = append(slices.Clone(c.Actions), registry.BillingAction{Action: step.Action, At: now.UTC()})
+		ok, err := e.reg.UpdateBillingCase(c, claimed)
+		if err != nil {
+			log.Printf("billing: %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		err = e.act(ctx, c, step)
+		e.record("billing."+step.Action, c.TenantID, fmt.Sprintf("case=%s after=%s", c.Event, step.After), err)
+		if err != nil {
+			log.Printf("billing: %s tenant %s on its %s case: %v", step.Action, c.TenantID, c.Event, err)
+			if _, err := e.reg.UpdateBillingCase(claimed, c); err != nil {
+				log.Printf("billing: %v", err)
+			}
+			return
+		}
+		if step.Action == ActionDelete {
+			if err := e.reg.DeleteBillingCase(c.TenantID, c.Event); err != nil {
+				log.Printf("billing: %v", err)
+			}
+			return
+		}
+		c = claimed
+	}
+}
+
+// act takes step on the tenant of c and announces it.
+func (e *Engine) act(ctx context.Context, c registry.BillingCase, step Step) error {
+	since := fmt.Sprintf("%s at %s", c.Event, c.OpenedAt.Format(time.RFC3339))
+	var event, message string
+	switch step.Action {
+	case ActionWarn:
+		event, message = webhooks.EventBillingWarning, since
+		if next, ok := e.next(c.Event, step); ok {
+			message += fmt.Sprintf("; instances will be %s at %s", pastTense[next.Action], c.OpenedAt.Add(next.After).Format(time.RFC3339))
+		}
+	case ActionSuspend:
+		if err := e.mgr.SuspendInstance(ctx, c.TenantID); err != nil && !errors.Is(err, k8s.ErrNotFound) {
+			return err
+		}
+		event, message = webhooks.EventBillingSuspended, since+"; instances suspended"
+	case ActionDelete:
+		if err := e.mgr.DeleteInstance(ctx, c.TenantID); err != nil && !errors.Is(err, k8s.ErrNotFound) {
+			return err
+		}
+		event, message = webhooks.EventBillingDeleted, since+"; instances deleted"
+	}
+	log.Printf("billing: tenant %s: %s", c.TenantID, message)
+	e.webhooks.PublishTenantEvent(event, c.TenantID, message)
+	return nil
+}
+
+// next returns the first suspend or delete step of the event's policy after
+// step.
+func (e *Engine) next(event string, step Step) (Step, bool) {
+	for _, s := range e.policies[event] {
+		if s.Action != ActionWarn && s.After >= step.After {
+			return s, true
+		}
+	}
+	return Step{}, false
+}
+
+// pastTense describes the instances after a suspend or delete action.
+var pastTense = map[string]string{ActionSuspend: "suspended", ActionDelete: "deleted"}
+
+// record audits a lifecycle action taken by the engine.
+func (e *Engine) record(action, tenantID, detail string, err error) {
+	entry := audit.Entry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		TenantID: tenantID,
+		Outcome:  "success",
+		Detail:   detail,
+		Caller:   "billing-policy",
+	}
+	if err != nil {
+		entry.Outcome = "failure"
+		entry.Detail = detail + ": " + err.Error()
+	}
+	e.audit.Record(entry)
+	e.history.Add(entry)
+}
+
+// Run takes due actions every interval, starting at once, until ctx is
+// cancelled. The interval must be positive. Only the replica holding the
+// registry's billing-policy lease evaluates; it renews the lease on every
+// pass, and another replica takes over once it has gone unrenewed for
+// three intervals.
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		held, err := e.reg.AcquireLease(leaseName, e.holder, 3*interval)
+		if err != nil {
+			log.Printf("billing: %v", err)
+		} else if held {
+			if err := e.Evaluate(ctx); err != nil {
+				log.Printf("billing: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
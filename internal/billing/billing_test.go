@@ -0,0 +1,137 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   map[string]string
+		want    string // Actions and delays, in order
+		wantErr bool
+	}{
+		{"empty", nil, "", false},
+		{"ordered by delay", map[string]string{"delete": "720h", "warn": "72h", "suspend": "168h"}, "warn@72h0m0s suspend@168h0m0s delete@720h0m0s", false},
+		{"same delay ordered by action", map[string]string{"delete": "0s", "suspend": "0s", "warn": "0s"}, "warn@0s suspend@0s delete@0s", false},
+		{"unknown action", map[string]string{"email": "1h"}, "", true},
+		{"invalid delay", map[string]string{"warn": "soon"}, "", true},
+		{"negative delay", map[string]string{"warn": "-1h"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(tt.steps)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy: error %v, want error %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, s := range p {
+				got = append(got, s.Action+"@"+s.After.String())
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("ParsePolicy = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// stubManager records the lifecycle actions taken through it, failing those
+// in fail.
+type stubManager struct {
+	k8s.InstanceManager
+	calls []string
+	fail  map[string]bool
+}
+
+func (m *stubManager) do(action string) error {
+	m.calls = append(m.calls, action)
+	if m.fail[action] {
+		return errors.New(action + " failed")
+	}
+	return nil
+}
+
+func (m *stubManager) SuspendInstance(ctx context.Context, tenantID string) error {
+	return m.do(ActionSuspend)
+}
+
+func (m *stubManager) DeleteInstance(ctx context.Context, tenantID string) error {
+	return m.do(ActionDelete)
+}
+
+func TestEvaluate(t *testing.T) {
+	opened := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+	policy := Policy{{ActionWarn, time.Hour}, {ActionSuspend, 2 * time.Hour}, {ActionDelete, 3 * time.Hour}}
+	actions := func(names ...string) []registry.BillingAction {
+		var a []registry.BillingAction
+		for i, name := range names {
+			a = append(a, registry.BillingAction{Action: name, At: opened.Add(time.Duration(i+1) * time.Hour)})
+		}
+		return a
+	}
+
+	tests := []struct {
+		name        string
+		stored      []registry.BillingAction // Taken on the case in the registry
+		read        []registry.BillingAction // Taken on the case evaluated, when older
+		after       time.Duration            // Since the case was opened
+		fail        string
+		wantCalls   string
+		wantActions string // Taken on the case afterwards; "closed" once deleted
+	}{
+		{name: "nothing due", after: 30 * time.Minute, wantActions: ""},
+		{name: "warning due", after: time.Hour, wantActions: "warn"},
+		{name: "warning and suspension due", after: 150 * time.Minute, wantCalls: "suspend", wantActions: "warn suspend"},
+		{name: "already warned", stored: actions(ActionWarn), after: 90 * time.Minute, wantActions: "warn"},
+		{name: "deletion closes the case", stored: actions(ActionWarn), after: 4 * time.Hour, wantCalls: "suspend delete", wantActions: "closed"},
+		{name: "failed suspension is retried", stored: actions(ActionWarn), after: 150 * time.Minute, fail: ActionSuspend, wantCalls: "suspend", wantActions: "warn"},
+		{name: "failed suspension holds back deletion", after: 4 * time.Hour, fail: ActionSuspend, wantCalls: "suspend", wantActions: "warn"},
+		{name: "claim lost to another evaluation", stored: actions(ActionWarn, ActionSuspend), read: actions(ActionWarn), after: 150 * time.Minute, wantActions: "warn suspend"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg, err := registry.Open(registry.NewMemoryStore())
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			stored := registry.BillingCase{TenantID: "a", Event: EventPaymentFailed, OpenedAt: opened, Actions: tt.stored}
+			if _, err := reg.AddBillingCase(stored); err != nil {
+				t.Fatalf("AddBillingCase: %v", err)
+			}
+			read := stored
+			if tt.read != nil {
+				read.Actions = tt.read
+			}
+			mgr := &stubManager{fail: map[string]bool{tt.fail: true}}
+			e := New(reg, mgr, nil, nil, nil, map[string]Policy{EventPaymentFailed: policy})
+
+			e.evaluate(context.Background(), read, opened.Add(tt.after))
+
+			if got := strings.Join(mgr.calls, " "); got != tt.wantCalls {
+				t.Errorf("manager calls %q, want %q", got, tt.wantCalls)
+			}
+			cases, err := reg.TenantBillingCases("a")
+			if err != nil {
+				t.Fatalf("TenantBillingCases: %v", err)
+			}
+			got := "closed"
+			if len(cases) == 1 {
+				var taken []string
+				for _, a := range cases[0].Actions {
+					taken = append(taken, a.Action)
+				}
+				got = strings.Join(taken, " ")
+			}
+			if got != tt.wantActions {
+				t.Errorf("actions taken %q, want %q", got, tt.wantActions)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+// Package buildinfo identifies the running build of the service.
+package buildinfo
+
+import "runtime/debug"
+
+// Version and Commit identify the release and source revision of the
+// service. They are set at build time with
+//
+//	go build -ldflags "-X github.com/mchatman/tenant-provisioner/internal/buildinfo.Version=v1.4.0 \
+//	  -X github.com/mchatman/tenant-provisioner/internal/buildinfo.Commit=$(git rev-parse HEAD)"
+//
+// Version is "dev" for local builds. When Commit is not set it is taken from
+// the VCS information the Go toolchain embeds, with a "-dirty" suffix for a
+// modified tree, or "unknown" when there is none.
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+func init() {
+	if Commit != "" {
+		return
+	}
+	Commit = "unknown"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if revision != "" {
+		Commit = revision
+		if modified == "true" {
+			Commit += "-dirty"
+		}
+	}
+}
@@ -0,0 +1,29 @@
+// Package caller carries the identity of the human or service behind an API
+// request, as asserted by the authenticating proxy in front of the service.
+package caller
+
+import "context"
+
+// Identity is an authenticated caller.
+type Identity struct {
+	User   string
+	Groups []string
+	// Proxied is set for identities asserted by the authenticating proxy,
+	// which name cluster users, as opposed to the "tenant:<id>" and
+	// "org:<id>" identities of token-authenticated callers, which are only
+	// recorded for auditing. Only proxied identities are impersonated.
+	Proxied bool
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the caller stored in ctx and whether there was one.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok && id.User != ""
+}
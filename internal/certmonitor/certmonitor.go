@@ -0,0 +1,188 @@
+// Package certmonitor follows TLS certificate issuance for new instances.
+// Failed issuance is retried a limited number of times, and an instance
+// whose certificate is still missing after a timeout can be moved onto a
+// wildcard certificate so that it does not stay stuck starting.
+package certmonitor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// Config tunes retries and the fallback.
+type Config struct {
+	MaxRetries      int           // Retries after a failed issuance
+	FallbackTimeout time.Duration // How long after creation to fall back
+	WildcardSecret  string        // Secret holding the wildcard certificate; no fallback when empty
+}
+
+// Pending is a certificate that has not been issued yet.
+type Pending struct {
+	TenantID    string    `json:"tenant_id"`
+	Instance    string    `json:"instance"`
+	Certificate string    `json:"certificate,omitempty"`
+	Since       time.Time `json:"since"`
+	Failed      bool      `json:"failed"`
+	Message     string    `json:"message,omitempty"`
+	Retries     int       `json:"retries"`
+	CheckedAt   time.Time `json:"checked_at,omitempty"`
+}
+
+// Monitor tracks instances whose certificate has not been seen ready.
+type Monitor struct {
+	cfg Config
+	mgr k8s.InstanceManager
+
+	mu      sync.Mutex
+	pending map[string]*Pending // by tenant ID
+	issued  map[string]bool     // tenants whose certificate was seen ready
+}
+
+// New creates a Monitor.
+func New(cfg Config, mgr k8s.InstanceManager) *Monitor {
+	return &Monitor{
+		cfg:     cfg,
+		mgr:     mgr,
+		pending: make(map[string]*Pending),
+		issued:  make(map[string]bool),
+	}
+}
+
+// HandleInstanceEvent starts tracking instances as they appear and forgets
+// deleted ones; pass it to OnInstanceEvent.
+func (m *Monitor) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.TenantID == "" || ev.Info == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch ev.Type {
+	case k8s.InstanceDeleted:
+		delete(m.pending, ev.TenantID)
+		delete(m.issued, ev.TenantID)
+	case k8s.InstanceAdded, k8s.InstanceUpdated:
+		if m.issued[ev.TenantID] || m.pending[ev.TenantID] != nil || ev.Info.Status == "suspended" {
+			return
+		}
+		since := ev.Info.CreatedAt
+		if since.IsZero() {
+			since = time.Now().UTC()
+		}
+		m.pending[ev.TenantID] = &Pending{TenantID: ev.TenantID, Instance: ev.Info.Name, Since: since}
+	}
+}
+
+// Run checks pending certificates every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.Check(ctx)
+	}
+}
+
+// Check reads the certificate of every pending instance, retrying failed
+// issuance and falling back to the wildcard certificate once
+// FallbackTimeout has passed.
+func (m *Monitor) Check(ctx context.Context) {
+	m.mu.Lock()
+	tenants := make([]string, 0, len(m.pending))
+	for tenantID := range m.pending {
+		tenants = append(tenants, tenantID)
+	}
+	m.mu.Unlock()
+
+	for _, tenantID := range tenants {
+		if ctx.Err() != nil {
+			return
+		}
+		m.check(ctx, tenantID)
+	}
+}
+
+// check handles one pending instance.
+func (m *Monitor) check(ctx context.Context, tenantID string) {
+	status, err := m.mgr.CertificateStatus(ctx, tenantID)
+	if errors.Is(err, k8s.ErrNotFound) {
+		m.forget(tenantID, false)
+		return
+	}
+	if err != nil {
+		log.Printf("certmonitor: tenant=%s: %v", tenantID, err)
+		return
+	}
+	if status.Ready {
+		m.forget(tenantID, true)
+		return
+	}
+
+	m.mu.Lock()
+	p, ok := m.pending[tenantID]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	p.Certificate = status.Name
+	p.Failed = status.Failed
+	p.Message = status.Message
+	p.CheckedAt = time.Now().UTC()
+	fallback := m.cfg.WildcardSecret != "" && m.cfg.FallbackTimeout > 0 && time.Since(p.Since) >= m.cfg.FallbackTimeout
+	retry := !fallback && status.Failed && p.Retries < m.cfg.MaxRetries
+	if retry {
+		p.Retries++
+	}
+	attempt := p.Retries
+	m.mu.Unlock()
+
+	switch {
+	case fallback:
+		if err := m.mgr.UseWildcardCertificate(ctx, tenantID, m.cfg.WildcardSecret); err != nil {
+			log.Printf("certmonitor: tenant=%s: falling back to wildcard certificate: %v", tenantID, err)
+			return
+		}
+		log.Printf("certmonitor: tenant=%s: certificate %s not issued after %s (%s); switched to wildcard certificate %s",
+			tenantID, status.Name, m.cfg.FallbackTimeout, status.Message, m.cfg.WildcardSecret)
+		m.forget(tenantID, true)
+	case retry:
+		if err := m.mgr.RetryCertificate(ctx, tenantID); err != nil {
+			log.Printf("certmonitor: tenant=%s: retrying certificate %s: %v", tenantID, status.Name, err)
+			return
+		}
+		log.Printf("certmonitor: tenant=%s: certificate %s failed (%s); retry %d of %d",
+			tenantID, status.Name, status.Message, attempt, m.cfg.MaxRetries)
+	}
+}
+
+// forget stops tracking the tenant, remembering whether its certificate was
+// issued so that later instance events do not track it again.
+func (m *Monitor) forget(tenantID string, issued bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, tenantID)
+	if issued {
+		m.issued[tenantID] = true
+	}
+}
+
+// Pending lists the certificates still being waited for, oldest first.
+func (m *Monitor) Pending() []Pending {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Pending, 0, len(m.pending))
+	for _, p := range m.pending {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Since.Before(out[j].Since) })
+	return out
+}
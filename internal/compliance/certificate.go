@@ -0,0 +1,131 @@
+// Package compliance produces signed, independently verifiable records of
+// data-protection operations such as purge deletions.
+package compliance
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Artifact identifies a single resource covered by a certificate.
+type Artifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// DeletionCertificate attests that every listed artifact belonging to a tenant
+// was deleted and verified absent at VerifiedAt.
+type DeletionCertificate struct {
+	ID          string     `json:"id"`
+	TenantID    string     `json:"tenant_id"`
+	Artifacts   []Artifact `json:"artifacts"`
+	VerifiedAt  time.Time  `json:"verified_at"`
+	IssuedAt    time.Time  `json:"issued_at"`
+	KeyID       string     `json:"key_id"`
+	Signature   string     `json:"signature,omitempty"`
+	Algorithm   string     `json:"algorithm"`
+	Description string     `json:"description"`
+}
+
+// Signer issues DeletionCertificates signed with an Ed25519 key.
+type Signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+}
+
+// NewSigner creates a Signer from a base64-encoded 32-byte Ed25519 seed.
+func NewSigner(seedBase64 string) (*Signer, error) {
+	seed, err := base64.StdEncoding.DecodeString(seedBase64)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signing key: %v", err)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be %d bytes, got %d", ed25519.SeedSize, len(seed))
+	}
+
+	key := ed25519.NewKeyFromSeed(seed)
+	sum := sha256.Sum256(key.Public().(ed25519.PublicKey))
+	return &Signer{
+		key:   key,
+		keyID: hex.EncodeToString(sum[:8]),
+	}, nil
+}
+
+// PublicKey returns the base64-encoded public key that verifies certificates
+// issued by s.
+func (s *Signer) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.key.Public().(ed25519.PublicKey))
+}
+
+// RegistryRecordKind is the Artifact kind of an instance's row in the
+// provisioner's registry.
+const RegistryRecordKind = "RegistryRecord"
+
+// certificateDescription states what a certificate attests to, and what it
+// does not.
+const certificateDescription = "All listed artifacts were deleted and verified absent: cluster resources " +
+	"from the cluster, export archives from object storage and RegistryRecord rows from the provisioner's " +
+	"registry. Records the provisioner keeps about the tenant other than those listed, such as audit " +
+	"entries, usage, billing and organization records, are not covered by this certificate."
+
+// IssueDeletion builds and signs a certificate for the given purge outcome.
+func (s *Signer) IssueDeletion(tenantID string, artifacts []Artifact, verifiedAt time.Time) (*DeletionCertificate, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("generating certificate id: %v", err)
+	}
+
+	cert := &DeletionCertificate{
+		ID:          hex.EncodeToString(id),
+		TenantID:    tenantID,
+		Artifacts:   artifacts,
+		VerifiedAt:  verifiedAt,
+		IssuedAt:    time.Now().UTC(),
+		KeyID:       s.keyID,
+		Algorithm:   "Ed25519",
+		Description: certificateDescription,
+	}
+
+	payload, err := signingPayload(cert)
+	if err != nil {
+		return nil, err
+	}
+	cert.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, payload))
+	return cert, nil
+}
+
+// Verify reports whether cert carries a valid signature from publicKey, the
+// base64-encoded Ed25519 public key returned by Signer.PublicKey.
+func Verify(cert *DeletionCertificate, publicKey string) (bool, error) {
+	pub, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false, fmt.Errorf("invalid public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(cert.Signature)
+	if err != nil {
+		return false, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	payload, err := signingPayload(cert)
+	if err != nil {
+		return false, err
+	}
+	return ed25519.Verify(pub, payload, sig), nil
+}
+
+// signingPayload returns the canonical JSON encoding of cert with the
+// signature field cleared.
+func signingPayload(cert *DeletionCertificate) ([]byte, error) {
+	unsigned := *cert
+	unsigned.Signature = ""
+	b, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("encoding certificate: %v", err)
+	}
+	return b, nil
+}
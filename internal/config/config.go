@@ -3,30 +3,897 @@
 // directly.
 package config
 
-import "os"
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Config holds all runtime configuration values.
 type Config struct {
+	// ConfigFiles are the config files read, layered under the
+	// environment, base first; see files.go.
+	ConfigFiles []string
+
 	Namespace string // Kubernetes namespace for tenant instances
 	Domain    string // Public domain suffix (e.g. "wareit.ai")
 	Port      string // HTTP listen port
+	DebugAddr string // Internal listen address for pprof/debug endpoints; disabled when empty
+
+	AdminToken string // Bearer token for /admin endpoints; the admin API is disabled when empty
+
+	// TenantIDPattern is the regular expression tenant IDs must match, for
+	// billing systems whose IDs are not UUIDs (e.g. "org_[a-z0-9]+"). UUIDs
+	// are required when empty.
+	TenantIDPattern string
+
+	// New instances are named InstanceNamePrefix followed by
+	// InstanceNameLength hex digits, random or, in "tenant" mode, derived
+	// from the tenant ID for a stable subdomain. A name already in use is
+	// replaced, up to InstanceNameAttempts candidates in all.
+	InstanceNamePrefix   string
+	InstanceNameLength   int
+	InstanceNameMode     string
+	InstanceNameAttempts int
+
+	// ReservedInstanceNames are kept for the service's own subdomains of
+	// Domain, such as www or api, and never given to an instance.
+	ReservedInstanceNames []string
+
+	// Backend selects where instances live: "kubernetes", or "fake" for an
+	// in-memory stand-in that needs no cluster (local development only).
+	Backend string
+
+	// Cluster credentials. KubeconfigBase64 takes precedence; otherwise
+	// KubeAuthMode selects a kubeconfig-less mode ("exec", "token-file",
+	// "gke", "eks" or "doks") against KubeAPIServer. With neither, in-cluster
+	// config and then ~/.kube/config are tried.
+	KubeconfigBase64     string
+	KubeconfigPath       string   // Local kubeconfig file; ~/.kube/config when empty
+	KubeContexts         []string // Kubeconfig contexts in failover priority order; current context when empty
+	KubeFailoverInterval time.Duration
+	KubeAuthMode         string
+	KubeAPIServer        string
+	KubeCAData           string   // Base64 PEM CA bundle for KubeAPIServer
+	KubeClusterName      string   // Cluster name/ID passed to the gke/eks/doks credential plugins
+	KubeExecCommand      string   // Credential plugin for "exec" mode
+	KubeExecArgs         []string // Space-separated arguments for KubeExecCommand
+	KubeExecAPIVersion   string
+	KubeTokenFile        string // Bearer token file for "token-file" mode, re-read as it rotates
+
+	// Client-side rate limits of the Kubernetes clients. Reads (instance
+	// lookups and lists, logs, metrics and the watch) and mutations go
+	// through separate clients, each with its own limiter, so that a burst
+	// of status polling cannot queue provisioning writes behind it.
+	KubeReadQPS    float64
+	KubeReadBurst  int
+	KubeWriteQPS   float64
+	KubeWriteBurst int
+
+	// KubeHedgeReads hedges reads of the read client: a read not answered
+	// within KubeHedgeDelay, or the p95 latency of recent reads when that is
+	// zero, is sent a second time and the first answer wins. At most
+	// KubeHedgeMaxRatio of reads are hedged.
+	KubeHedgeReads    bool
+	KubeHedgeDelay    time.Duration
+	KubeHedgeMaxRatio float64
+
+	// Server-wide connection timeouts.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// Per-route-group handler timeouts. Zero disables the limit for a group.
+	ReadRouteTimeout  time.Duration // Status lookups
+	WriteRouteTimeout time.Duration // Create and other quick mutations
+	LongRouteTimeout  time.Duration // Deletes (which may purge) and exports
+
+	InstanceCacheTTL time.Duration // How long GetInstance results are cached; 0 disables
+
+	// Cost-allocation labels for Kubecost/OpenCost. When CostLabels is set,
+	// created resources carry <prefix>tenant, plan, environment and
+	// cost-center labels.
+	CostLabels        bool
+	CostLabelPrefix   string
+	CostEnvironment   string
+	CostDefaultCenter string // Used when a create request names no cost center
+
+	// RegistryStore selects where the instance registry is kept: "memory",
+	// "file" (the JSON file at RegistryPath), "sqlite" (the database file at
+	// RegistryPath) or "postgres" (the database at RegistryDatabaseURL).
+	// Defaults to "file" when RegistryPath is set and "memory" otherwise.
+	RegistryStore       string
+	RegistryPath        string
+	RegistryDatabaseURL string
+
+	// RegistryAutoMigrate applies pending registry schema migrations at
+	// startup; otherwise startup fails until "migrate up" has been run.
+	RegistryAutoMigrate bool
+
+	// ConsistencyCheckInterval is how often the registry is compared with the
+	// cluster; 0 disables the periodic check. ConsistencyAutoRepair lets the
+	// periodic check rewrite the registry from the cluster.
+	ConsistencyCheckInterval time.Duration
+	ConsistencyAutoRepair    bool
+
+	// ProfilesPath is a YAML or JSON file of named provisioning profiles;
+	// DefaultProfile is applied when a create request names none.
+	ProfilesPath   string
+	DefaultProfile string
+
+	// Per-environment ("prod", "staging" or "dev") creation defaults: the
+	// profile applied when a request names none, the release channel used
+	// when it names none, and the plans an instance may be created on (any,
+	// when unlisted).
+	EnvironmentProfiles map[string]string
+	EnvironmentChannels map[string]string
+	EnvironmentPlans    map[string][]string
+
+	// AnnotationPrefixes are the annotation key prefixes, such as
+	// "backup.velero.io/", that admin create requests may set annotations
+	// under; none may be set when empty.
+	AnnotationPrefixes []string
+
+	// PlanTiers orders the plans from lowest to highest, for the plan
+	// ceilings of organizations.
+	PlanTiers []string
+
+	// ImagePolicyPath is a YAML or JSON file restricting, per plan, the image
+	// repositories and tags that instances may be created or upgraded to;
+	// every image is allowed when empty.
+	ImagePolicyPath string
+
+	// ImageDefaultsPath is a YAML or JSON file setting the image tag or
+	// digest, pull policy and pull secret of new instances per plan and
+	// environment; latest, Always and registry-wareit when empty.
+	ImageDefaultsPath string
+
+	// ImageMirrors maps image repository prefixes to the internal mirrors
+	// that instances, upgrades and pre-pulls pull them from instead, for
+	// clusters without internet egress.
+	ImageMirrors map[string]string
+
+	// InjectionsPath is a YAML or JSON file of init containers and sidecars
+	// added to new instances per plan and environment; none when empty.
+	InjectionsPath string
+
+	// ImagePinDigests resolves image tags to digests through the registry API
+	// at create and upgrade time and pins them in the instance spec.
+	// CosignPublicKey, a base64-encoded PEM ECDSA public key, additionally
+	// requires a cosign signature on the digest and implies pinning. The
+	// registry credentials are used for private images.
+	ImagePinDigests       bool
+	CosignPublicKey       string
+	ImageRegistryUsername string
+	ImageRegistryPassword string
+
+	// FeatureFlagsPath is the JSON file holding feature flags; flags are kept
+	// in memory only when empty.
+	FeatureFlagsPath string
+
+	// Rollouts upgrade the canary, beta and stable channels in turn, each
+	// baking for RolloutBakeTime with at most RolloutMaxErrorRate of its
+	// instances in error. RolloutsPath persists their state.
+	RolloutsPath        string
+	RolloutBakeTime     time.Duration
+	RolloutMaxErrorRate float64
+
+	// Right-sizing samples instance usage every RightsizingSampleInterval (0
+	// disables it) and recommends requests that fit the last
+	// RightsizingWindow of usage plus RightsizingHeadroom.
+	// RightsizingAutoApply applies recommendations without an operator.
+	// RightsizingPath persists usage history.
+	RightsizingPath           string
+	RightsizingSampleInterval time.Duration
+	RightsizingWindow         time.Duration
+	RightsizingHeadroom       float64
+	RightsizingAutoApply      bool
+
+	// HealthCheckInterval is how often running instances are probed over
+	// HTTP (0 disables probing): a GET of HealthCheckPath on the instance
+	// endpoint must return HealthCheckExpectedStatus within
+	// HealthCheckTimeout. Instances may override the path, status and
+	// interval at creation. After HealthCheckDegradedAfter consecutive
+	// failures an instance is degraded, which is alerted on and counted as
+	// downtime.
+	HealthCheckInterval       time.Duration
+	HealthCheckPath           string
+	HealthCheckExpectedStatus int
+	HealthCheckTimeout        time.Duration
+	HealthCheckDegradedAfter  int
+
+	// DNSCheckEnabled holds instances in "waiting-for-dns" until their
+	// hostname resolves, through DNSCheckResolver ("host[:port]") when set
+	// and the system resolver otherwise. With DNSCheckTXTOwner set,
+	// external-dns's TXT ownership record for that owner ID must exist too.
+	DNSCheckEnabled  bool
+	DNSCheckResolver string
+	DNSCheckTXTOwner string
+
+	// CertMonitorInterval is how often certificates of new instances are
+	// checked (0 disables monitoring). Failed issuance is retried up to
+	// CertMaxRetries times. When TLSWildcardSecret names a wildcard
+	// certificate Secret in the namespace, an instance still without a
+	// certificate CertFallbackTimeout after creation is switched to it.
+	CertMonitorInterval time.Duration
+	CertMaxRetries      int
+	CertFallbackTimeout time.Duration
+	TLSWildcardSecret   string
+
+	// WorkQueueWorkers is how many queued operations, such as the items of a
+	// bulk action or queued creates, run at once, and
+	// WorkQueueTenantConcurrency how many of them may belong to one tenant (no
+	// limit when 0).
+	WorkQueueWorkers           int
+	WorkQueueTenantConcurrency int
+
+	// QueueTrialPlans are the plans whose queued creates run in the trial
+	// lane of the work queue, behind those of paying tenants. Creates that
+	// name no plan count as trials.
+	QueueTrialPlans []string
+
+	// UsageLedgerPath is the JSON file holding billable usage history. Usage
+	// is kept in memory only, and lost on restart, when empty.
+	UsageLedgerPath string
+
+	// Lifecycle emails. NotifyProvider is "smtp", "sendgrid", or empty to
+	// disable them; the NotifyOn flags switch individual events.
+	NotifyProvider      string
+	NotifyFrom          string
+	SMTPAddr            string // host:port
+	SMTPUsername        string
+	SMTPPassword        string
+	SendGridAPIKey      string
+	NotifyOnReady       bool
+	NotifyOnTrialExpiry bool
+	NotifyOnSuspension  bool
+	NotifyOnDeletion    bool
+
+	// Lifecycle emails and webhook event descriptions are written in each
+	// tenant's locale. TranslationsDir adds locales, or replaces built-in
+	// templates, with email/<locale>/<event>.tmpl and
+	// webhooks/<locale>/events.tmpl files. DefaultLocale is used for tenants
+	// without a locale and for text their locale does not translate.
+	TranslationsDir string
+	DefaultLocale   string
+
+	// Provisioning failure alerts go to a Slack incoming webhook and/or a
+	// PagerDuty Events v2 routing key. ProvisioningAlertDeadline is how long an
+	// instance may take to become ready before alerting; 0 disables it.
+	SlackWebhookURL           string
+	PagerDutyRoutingKey       string
+	ProvisioningAlertDeadline time.Duration
+
+	// ProvisioningDeadline is how long an instance may take to first run
+	// before it is marked failed and its diagnostics captured; 0 disables
+	// it. ProvisioningDeadlineCleanup then deletes the failed instance.
+	ProvisioningDeadline        time.Duration
+	ProvisioningDeadlineCleanup bool
+
+	// UptimeHistoryPath is the JSON file holding instance status transitions
+	// for uptime reporting; kept in memory only when empty.
+	UptimeHistoryPath string
+
+	// Capacity ceilings for the tenant namespace; zero or empty means
+	// unlimited. CPU and memory are Kubernetes quantities compared against
+	// the sum of instance resource requests.
+	CapacityMaxInstances   int
+	CapacityMaxCPU         string
+	CapacityMaxMemory      string
+	CapacityAlertThreshold float64 // Fraction of a ceiling at which to alert
+
+	// Creates are refused with 429 while ShedQueueDepth or more items wait
+	// on the work queue, or while any capacity ceiling is used to
+	// ShedCapacityRatio or more; zero disables either check. ShedRetryAfter
+	// is the least Retry-After sent with them.
+	ShedQueueDepth    int
+	ShedCapacityRatio float64
+	ShedRetryAfter    time.Duration
+
+	// Caller identity as asserted by an authenticating proxy in front of the
+	// service. Identity is only read when CallerUserHeader is set.
+	CallerUserHeader   string
+	CallerGroupsHeader string
+	// ImpersonateCallers makes Kubernetes calls on behalf of an identified
+	// caller impersonate them instead of using the service account.
+	ImpersonateCallers bool
+
+	// Outbound webhook deliveries: the timeout of each attempt, the attempts
+	// made per event and subscription, and the deliveries logged per
+	// subscription.
+	WebhookTimeout     time.Duration
+	WebhookMaxAttempts int
+	WebhookLogSize     int
+
+	// EventFormat is the payload format of delivered and replayed lifecycle
+	// events: "cloudevents" (CloudEvents 1.0, with EventSource as the source
+	// attribute) or "legacy" (the flat event).
+	EventFormat string
+	EventSource string
+
+	// EventLogRetention is how long lifecycle events stay in the registry's
+	// event log for replay through GET /admin/events; 0 keeps them forever.
+	EventLogRetention time.Duration
+
+	// OperationSyncInterval is how often the queue positions of operations
+	// queued on this replica are written to the registry, for status
+	// requests served by other replicas. OperationRetention is how long
+	// operations stay in the registry after their last update.
+	OperationSyncInterval time.Duration
+	OperationRetention    time.Duration
+
+	// JournalRecoveryInterval is how often the operation journal is checked
+	// for creates left half-done by a replica that stopped; 0 disables
+	// recovery. JournalStaleAfter is how long an entry must have made no
+	// progress before it is resumed or rolled back.
+	JournalRecoveryInterval time.Duration
+	JournalStaleAfter       time.Duration
+
+	// ReservationTTL is how long a reservation made through
+	// POST /tenants/{tenant-id}/instance/reservations holds its instance name
+	// and capacity before it lapses uncommitted.
+	ReservationTTL time.Duration
+
+	// IdempotencyTTL is how long the response to a mutating request made
+	// with an Idempotency-Key is replayed to retries; 0 disables
+	// Idempotency-Key handling.
+	IdempotencyTTL time.Duration
+	// IdempotencyKey is the base64-encoded 32-byte AES key that encrypts
+	// stored responses carrying gateway tokens. Without it each replica
+	// generates its own key at startup.
+	IdempotencyKey string
+
+	// TenantBatchMaxSize bounds the tenants of one POST /admin/tenants/batch.
+	TenantBatchMaxSize int
+
+	// ImportMaxRows bounds the rows of one POST /admin/import.
+	ImportMaxRows int
+
+	// IngressProvider selects how traffic reaches instances: "nginx"
+	// (ingress-nginx), "traefik", or "gateway-api" (an HTTPRoute per instance
+	// attached to IngressGatewayName in IngressGatewayNamespace, optionally to
+	// one listener, sending traffic to port IngressBackendPort). IngressClass
+	// and IngressNamespaces, the namespaces admitted by instance
+	// NetworkPolicies, default to the provider's usual ones. With
+	// IngressGatewayTLS "cert-manager", each instance instead gets a Gateway
+	// of class IngressGatewayClass whose certificate cert-manager issues.
+	IngressProvider         string
+	IngressClass            string
+	IngressNamespaces       []string
+	IngressGatewayName      string
+	IngressGatewayNamespace string
+	IngressGatewayListener  string
+	IngressBackendPort      int
+	IngressGatewayTLS       string
+	IngressGatewayClass     string
+
+	// InternalDomain, when set, also exposes every instance under a second,
+	// internal domain, through an Ingress of class InternalIngressClass
+	// whose controller runs in InternalIngressNamespaces, which instance
+	// NetworkPolicies then admit too. TLS on the internal host uses the
+	// existing Secret InternalTLSSecret or a certificate issued by the
+	// cert-manager ClusterIssuer InternalClusterIssuer; with neither it is
+	// served over plain HTTP.
+	InternalDomain            string
+	InternalIngressClass      string
+	InternalIngressNamespaces []string
+	InternalTLSSecret         string
+	InternalClusterIssuer     string
+
+	// Mesh enrolls the instance namespace in a service mesh, "istio" or
+	// "linkerd", at startup: sidecar injection, strict mutual TLS, and
+	// authorization admitting only MeshAllowedNamespaces (by default the
+	// ingress controller's and the proxy's) to instance ports. Empty leaves
+	// instances out of any mesh.
+	Mesh                  string
+	MeshIstioRevision     string // istio.io/rev label instead of istio-injection
+	MeshAllowedNamespaces []string
+	MeshTrustDomain       string // Linkerd identity trust domain
+
+	// EgressProxyURL, when set, routes instance HTTP(S) egress, including
+	// AI provider traffic, through a proxy, except for EgressNoProxy. With
+	// EgressProxySecret each tenant authenticates to the proxy as itself.
+	// EgressProxyEnforce applies a NetworkPolicy only letting instances
+	// reach DNS and the proxy, in EgressProxyNamespace unless the URL's host
+	// is an IP.
+	EgressProxyURL       string
+	EgressNoProxy        string
+	EgressProxySecret    string
+	EgressProxyNamespace string
+	EgressProxyEnforce   bool
+
+	// AI usage reported by instances or the egress proxy is held to monthly
+	// budgets per plan ("*" for any other plan), in tokens and requests;
+	// tenants without a budget are only tracked. At AIBudgetWarnAt of a
+	// budget a warning webhook is sent; once it is spent, AIBudgetAction,
+	// "throttle" or "suspend", is taken.
+	AITokenBudgets   map[string]int64
+	AIRequestBudgets map[string]int64
+	AIBudgetWarnAt   float64
+	AIBudgetAction   string
+
+	// Billing events posted to /billing/events, signed with
+	// BillingWebhookSecret, drive lifecycle actions; the endpoint is disabled
+	// without a secret. The policies map each action, "warn", "suspend" or
+	// "delete", to how long after a failed payment or a canceled subscription
+	// it is taken. Due actions are taken every BillingPolicyInterval.
+	BillingWebhookSecret              string
+	BillingPaymentFailedPolicy        map[string]string
+	BillingSubscriptionCanceledPolicy map[string]string
+	BillingPolicyInterval             time.Duration
+
+	// SecretScanMode decides what happens to create requests whose env
+	// overrides hold the orchestrator's own secrets or cloud credentials:
+	// "reject" refuses them, "flag" accepts them with an audit entry and
+	// "off" does not scan.
+	SecretScanMode string
+
+	// ConfigRawSchemaPath is a JSON Schema, in YAML or JSON, of the OpenClaw
+	// settings that create requests may override through config.raw; the
+	// built-in schema applies when empty.
+	ConfigRawSchemaPath string
+
+	// GatewayTokenSecrets keeps gateway tokens in a Secret per instance,
+	// referenced from the spec, instead of in the spec itself. Existing
+	// instances are migrated at startup, one at a time, each waiting up to
+	// GatewayTokenMigrationTimeout to run again before the next.
+	GatewayTokenSecrets          bool
+	GatewayTokenMigrationTimeout time.Duration
+
+	// DeletionCertKey is the base64-encoded Ed25519 seed used to sign purge
+	// deletion certificates. Purge deletion is disabled when empty.
+	DeletionCertKey     string
+	PurgeVerifyTimeout  time.Duration // How long to wait for purged artifacts to disappear
+	DeleteVerifyTimeout time.Duration // How long to wait for deleted artifacts to disappear
+
+	// Deletes with ?retain_storage=true keep the instance's volumes and
+	// snapshots for RetainedStorageDays unless the request says otherwise;
+	// expired storage is removed every RetentionJanitorInterval (0 disables).
+	RetainedStorageDays      int
+	RetentionJanitorInterval time.Duration
+
+	// S3-compatible object storage used for tenant data exports.
+	ObjectStoreEndpoint  string
+	ObjectStoreRegion    string
+	ObjectStoreBucket    string
+	ObjectStoreAccessKey string
+	ObjectStoreSecretKey string
+
+	ExportPrefix  string        // Object key prefix for export archives
+	ExportURLTTL  time.Duration // Validity of presigned export URLs
+	ExportImage   string        // Image (with sh, tar and curl) used by export jobs
+	SnapshotClass string        // VolumeSnapshotClass for exports; cluster default when empty
+
+	// PrePullPauseImage is the container that keeps image pre-pull pods
+	// running once their init container has pulled the image.
+	PrePullPauseImage string
+
+	// Audit records are shipped to AuditBucket (on the object storage
+	// endpoint above) when it is set.
+	AuditBucket        string
+	AuditPrefix        string
+	AuditBatchSize     int
+	AuditFlushInterval time.Duration
+	AuditHistorySize   int // Recent entries kept in memory for GraphQL queries
+
+	// Recording of API exchanges per key, for debugging integrations:
+	// RecordingBufferSize exchanges are kept per key (0 disables recording),
+	// bodies are cut at RecordingMaxBodyBytes, and recording stops after at
+	// most RecordingMaxDuration.
+	RecordingBufferSize   int
+	RecordingMaxBodyBytes int
+	RecordingMaxDuration  time.Duration
+
+	// Error reporting is enabled when SentryDSN is set.
+	SentryDSN         string
+	SentryEnvironment string
+	SentrySampleRate  float64 // Fraction of error events sent, 0.0–1.0
 }
 
-// Load reads configuration from environment variables, falling back to
-// sensible defaults where a variable is unset or empty.
+// Load reads configuration from environment variables and the config files
+// selected by CONFIG_DIR and CONFIG_ENVIRONMENT, falling back to sensible
+// defaults where a variable is unset or empty. It exits when a config file
+// cannot be read or sets an unknown variable.
 func Load() *Config {
-	return &Config{
+	values, files, err := loadFiles(configFiles())
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	fileValues, looked = values, map[string]bool{}
+	defer func() { looked = nil }()
+
+	cfg := &Config{
+		ConfigFiles: files,
+
 		Namespace: envOr("TENANT_NAMESPACE", "tenants"),
 		Domain:    envOr("TENANT_DOMAIN", "wareit.ai"),
 		Port:      envOr("PORT", "8080"),
+		DebugAddr: getenv("DEBUG_ADDR"),
+
+		AdminToken: getenv("ADMIN_API_TOKEN"),
+
+		TenantIDPattern: getenv("TENANT_ID_PATTERN"),
+
+		InstanceNamePrefix:   envOr("INSTANCE_NAME_PREFIX", "tenant-"),
+		InstanceNameLength:   envInt("INSTANCE_NAME_LENGTH", 8),
+		InstanceNameMode:     envOr("INSTANCE_NAME_MODE", "random"),
+		InstanceNameAttempts: envInt("INSTANCE_NAME_ATTEMPTS", 5),
+
+		ReservedInstanceNames: envListOr("RESERVED_INSTANCE_NAMES", []string{
+			"admin", "api", "app", "assets", "auth", "billing", "cdn", "dashboard",
+			"docs", "ftp", "help", "login", "mail", "mx", "ns1", "ns2", "smtp",
+			"static", "status", "support", "www",
+		}),
+
+		Backend: envOr("BACKEND", "kubernetes"),
+
+		KubeconfigBase64:     getenv("KUBECONFIG_BASE64"),
+		KubeconfigPath:       getenv("KUBECONFIG"),
+		KubeContexts:         envList("KUBE_CONTEXTS"),
+		KubeFailoverInterval: envDuration("KUBE_FAILOVER_INTERVAL", 30*time.Second),
+		KubeAuthMode:         getenv("KUBE_AUTH_MODE"),
+		KubeAPIServer:        getenv("KUBE_API_SERVER"),
+		KubeCAData:           getenv("KUBE_CA_DATA"),
+		KubeClusterName:      getenv("KUBE_CLUSTER_NAME"),
+		KubeExecCommand:      getenv("KUBE_EXEC_COMMAND"),
+		KubeExecArgs:         strings.Fields(getenv("KUBE_EXEC_ARGS")),
+		KubeExecAPIVersion:   envOr("KUBE_EXEC_API_VERSION", "client.authentication.k8s.io/v1beta1"),
+		KubeTokenFile:        getenv("KUBE_TOKEN_FILE"),
+
+		KubeReadQPS:    envFloat("KUBE_READ_QPS", 20),
+		KubeReadBurst:  envInt("KUBE_READ_BURST", 40),
+		KubeWriteQPS:   envFloat("KUBE_WRITE_QPS", 10),
+		KubeWriteBurst: envInt("KUBE_WRITE_BURST", 20),
+
+		KubeHedgeReads:    envBool("KUBE_HEDGE_READS", false),
+		KubeHedgeDelay:    envDuration("KUBE_HEDGE_DELAY", 0),
+		KubeHedgeMaxRatio: envFloat("KUBE_HEDGE_MAX_RATIO", 0.1),
+
+		ReadTimeout:  envDuration("HTTP_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout: envDuration("HTTP_WRITE_TIMEOUT", 90*time.Second),
+		IdleTimeout:  envDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+
+		ReadRouteTimeout:  envDuration("ROUTE_TIMEOUT_READ", 15*time.Second),
+		WriteRouteTimeout: envDuration("ROUTE_TIMEOUT_WRITE", 60*time.Second),
+		LongRouteTimeout:  envDuration("ROUTE_TIMEOUT_LONG", 5*time.Minute),
+
+		InstanceCacheTTL: envDuration("INSTANCE_CACHE_TTL", 10*time.Second),
+
+		CostLabels:        envBool("COST_LABELS", true),
+		CostLabelPrefix:   envOr("COST_LABEL_PREFIX", "cost.wareit.ai/"),
+		CostEnvironment:   envOr("COST_ENVIRONMENT", "production"),
+		CostDefaultCenter: getenv("COST_DEFAULT_CENTER"),
+
+		RegistryStore:            getenv("REGISTRY_STORE"),
+		RegistryPath:             getenv("REGISTRY_PATH"),
+		RegistryDatabaseURL:      getenv("REGISTRY_DATABASE_URL"),
+		RegistryAutoMigrate:      envBool("REGISTRY_AUTO_MIGRATE", true),
+		ConsistencyCheckInterval: envDuration("CONSISTENCY_CHECK_INTERVAL", 15*time.Minute),
+		ConsistencyAutoRepair:    envBool("CONSISTENCY_AUTO_REPAIR", false),
+
+		WorkQueueWorkers:           envInt("WORK_QUEUE_WORKERS", 4),
+		WorkQueueTenantConcurrency: envInt("WORK_QUEUE_TENANT_CONCURRENCY", 1),
+		QueueTrialPlans:            envListOr("QUEUE_TRIAL_PLANS", []string{"trial", "free"}),
+
+		RightsizingPath:           getenv("RIGHTSIZING_PATH"),
+		RightsizingSampleInterval: envDuration("RIGHTSIZING_SAMPLE_INTERVAL", 5*time.Minute),
+		RightsizingWindow:         envDuration("RIGHTSIZING_WINDOW", 7*24*time.Hour),
+		RightsizingHeadroom:       envFloat("RIGHTSIZING_HEADROOM", 0.3),
+		RightsizingAutoApply:      envBool("RIGHTSIZING_AUTO_APPLY", false),
+
+		HealthCheckInterval:       envDuration("HEALTH_CHECK_INTERVAL", time.Minute),
+		HealthCheckPath:           envOr("HEALTH_CHECK_PATH", "/health"),
+		HealthCheckExpectedStatus: envInt("HEALTH_CHECK_EXPECTED_STATUS", 200),
+		HealthCheckTimeout:        envDuration("HEALTH_CHECK_TIMEOUT", 5*time.Second),
+		HealthCheckDegradedAfter:  envInt("HEALTH_CHECK_DEGRADED_AFTER", 3),
+
+		DNSCheckEnabled:  envBool("DNS_CHECK_ENABLED", true),
+		DNSCheckResolver: getenv("DNS_CHECK_RESOLVER"),
+		DNSCheckTXTOwner: getenv("DNS_CHECK_TXT_OWNER"),
+
+		CertMonitorInterval: envDuration("CERT_MONITOR_INTERVAL", time.Minute),
+		CertMaxRetries:      envInt("CERT_MAX_RETRIES", 3),
+		CertFallbackTimeout: envDuration("CERT_FALLBACK_TIMEOUT", 30*time.Minute),
+		TLSWildcardSecret:   getenv("TLS_WILDCARD_SECRET"),
+
+		ProfilesPath:      getenv("PROFILES_PATH"),
+		ImagePolicyPath:   getenv("IMAGE_POLICY_PATH"),
+		ImageDefaultsPath: getenv("IMAGE_DEFAULTS_PATH"),
+		ImageMirrors:      envMap("IMAGE_MIRRORS", ""),
+		InjectionsPath:    getenv("CONTAINER_INJECTIONS_PATH"),
+
+		ImagePinDigests:       envBool("IMAGE_PIN_DIGESTS", false),
+		CosignPublicKey:       getenv("COSIGN_PUBLIC_KEY"),
+		ImageRegistryUsername: getenv("IMAGE_REGISTRY_USERNAME"),
+		ImageRegistryPassword: getenv("IMAGE_REGISTRY_PASSWORD"),
+		FeatureFlagsPath:      getenv("FEATURE_FLAGS_PATH"),
+
+		RolloutsPath:        getenv("ROLLOUTS_PATH"),
+		RolloutBakeTime:     envDuration("ROLLOUT_BAKE_TIME", time.Hour),
+		RolloutMaxErrorRate: envFloat("ROLLOUT_MAX_ERROR_RATE", 0.05),
+		DefaultProfile:      getenv("DEFAULT_PROFILE"),
+
+		EnvironmentProfiles: envMap("ENVIRONMENT_PROFILES", ""),
+		EnvironmentChannels: envMap("ENVIRONMENT_CHANNELS", "staging=beta,dev=canary"),
+		EnvironmentPlans:    envPlans("ENVIRONMENT_PLANS"),
+		AnnotationPrefixes:  envList("ANNOTATION_PREFIXES"),
+		PlanTiers:           envListOr("PLAN_TIERS", []string{"free", "trial", "pro", "team"}),
+
+		UsageLedgerPath: getenv("USAGE_LEDGER_PATH"),
+
+		NotifyProvider:      getenv("NOTIFY_PROVIDER"),
+		NotifyFrom:          envOr("NOTIFY_FROM", "OpenClaw <no-reply@wareit.ai>"),
+		SMTPAddr:            getenv("SMTP_ADDR"),
+		SMTPUsername:        getenv("SMTP_USERNAME"),
+		SMTPPassword:        getenv("SMTP_PASSWORD"),
+		SendGridAPIKey:      getenv("SENDGRID_API_KEY"),
+		NotifyOnReady:       envBool("NOTIFY_ON_READY", true),
+		NotifyOnTrialExpiry: envBool("NOTIFY_ON_TRIAL_EXPIRY", true),
+		NotifyOnSuspension:  envBool("NOTIFY_ON_SUSPENSION", true),
+		NotifyOnDeletion:    envBool("NOTIFY_ON_DELETION", true),
+
+		TranslationsDir: getenv("TRANSLATIONS_DIR"),
+		DefaultLocale:   envOr("DEFAULT_LOCALE", "en"),
+
+		SlackWebhookURL:           getenv("SLACK_WEBHOOK_URL"),
+		PagerDutyRoutingKey:       getenv("PAGERDUTY_ROUTING_KEY"),
+		ProvisioningAlertDeadline: envDuration("PROVISIONING_ALERT_DEADLINE", 10*time.Minute),
+
+		ProvisioningDeadline:        envDuration("PROVISIONING_DEADLINE", 0),
+		ProvisioningDeadlineCleanup: envBool("PROVISIONING_DEADLINE_CLEANUP", false),
+
+		UptimeHistoryPath: getenv("UPTIME_HISTORY_PATH"),
+
+		CapacityMaxInstances:   envInt("CAPACITY_MAX_INSTANCES", 0),
+		CapacityMaxCPU:         getenv("CAPACITY_MAX_CPU"),
+		CapacityMaxMemory:      getenv("CAPACITY_MAX_MEMORY"),
+		CapacityAlertThreshold: envFloat("CAPACITY_ALERT_THRESHOLD", 0.8),
+
+		ShedQueueDepth:    envInt("SHED_QUEUE_DEPTH", 0),
+		ShedCapacityRatio: envFloat("SHED_CAPACITY_RATIO", 0),
+		ShedRetryAfter:    envDuration("SHED_RETRY_AFTER", 30*time.Second),
+
+		CallerUserHeader:   getenv("CALLER_USER_HEADER"),
+		CallerGroupsHeader: getenv("CALLER_GROUPS_HEADER"),
+		ImpersonateCallers: envBool("IMPERSONATE_CALLERS", false),
+
+		WebhookTimeout:     envDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+		WebhookMaxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", 5),
+		WebhookLogSize:     envInt("WEBHOOK_LOG_SIZE", 50),
+
+		EventFormat: envOr("EVENT_FORMAT", "cloudevents"),
+		EventSource: envOr("EVENT_SOURCE", "/tenant-orchestrator"),
+
+		EventLogRetention: envDuration("EVENT_LOG_RETENTION", 30*24*time.Hour),
+
+		OperationSyncInterval: envDuration("OPERATION_SYNC_INTERVAL", 5*time.Second),
+		OperationRetention:    envDuration("OPERATION_RETENTION", 24*time.Hour),
+
+		JournalRecoveryInterval: envDuration("JOURNAL_RECOVERY_INTERVAL", time.Minute),
+		JournalStaleAfter:       envDuration("JOURNAL_STALE_AFTER", 10*time.Minute),
+
+		ReservationTTL: envDuration("RESERVATION_TTL", 30*time.Minute),
+
+		IdempotencyTTL: envDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		IdempotencyKey: getenv("IDEMPOTENCY_ENCRYPTION_KEY"),
+
+		TenantBatchMaxSize: envInt("TENANT_BATCH_MAX_SIZE", 500),
+		ImportMaxRows:      envInt("IMPORT_MAX_ROWS", 1000),
+
+		IngressProvider:         envOr("INGRESS_PROVIDER", "nginx"),
+		IngressClass:            getenv("INGRESS_CLASS"),
+		IngressNamespaces:       envList("INGRESS_NAMESPACES"),
+		IngressGatewayName:      getenv("INGRESS_GATEWAY_NAME"),
+		IngressGatewayNamespace: envOr("INGRESS_GATEWAY_NAMESPACE", "gateway-system"),
+		IngressGatewayListener:  getenv("INGRESS_GATEWAY_LISTENER"),
+		IngressBackendPort:      envInt("INGRESS_BACKEND_PORT", 18789),
+		IngressGatewayTLS:       envOr("INGRESS_GATEWAY_TLS", "shared"),
+		IngressGatewayClass:     getenv("INGRESS_GATEWAY_CLASS"),
+
+		InternalDomain:            getenv("INTERNAL_DOMAIN"),
+		InternalIngressClass:      getenv("INTERNAL_INGRESS_CLASS"),
+		InternalIngressNamespaces: envList("INTERNAL_INGRESS_NAMESPACES"),
+		InternalTLSSecret:         getenv("INTERNAL_TLS_SECRET"),
+		InternalClusterIssuer:     getenv("INTERNAL_CLUSTER_ISSUER"),
+
+		Mesh:                  getenv("MESH"),
+		MeshIstioRevision:     getenv("MESH_ISTIO_REVISION"),
+		MeshAllowedNamespaces: envList("MESH_ALLOWED_NAMESPACES"),
+		MeshTrustDomain:       envOr("MESH_TRUST_DOMAIN", "cluster.local"),
+
+		EgressProxyURL:       getenv("EGRESS_PROXY_URL"),
+		EgressNoProxy:        envOr("EGRESS_NO_PROXY", "localhost,127.0.0.1,.svc,.cluster.local,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16"),
+		EgressProxySecret:    getenv("EGRESS_PROXY_SECRET"),
+		EgressProxyNamespace: getenv("EGRESS_PROXY_NAMESPACE"),
+		EgressProxyEnforce:   envBool("EGRESS_PROXY_ENFORCE", false),
+
+		AITokenBudgets:   envInt64Map("AI_TOKEN_BUDGETS"),
+		AIRequestBudgets: envInt64Map("AI_REQUEST_BUDGETS"),
+		AIBudgetWarnAt:   envFloat("AI_BUDGET_WARN_AT", 0.8),
+		AIBudgetAction:   envOr("AI_BUDGET_ACTION", "throttle"),
+
+		BillingWebhookSecret:              getenv("BILLING_WEBHOOK_SECRET"),
+		BillingPaymentFailedPolicy:        envMap("BILLING_PAYMENT_FAILED_POLICY", "warn=72h,suspend=168h,delete=720h"),
+		BillingSubscriptionCanceledPolicy: envMap("BILLING_SUBSCRIPTION_CANCELED_POLICY", "warn=72h,suspend=168h,delete=720h"),
+		BillingPolicyInterval:             envDuration("BILLING_POLICY_INTERVAL", 5*time.Minute),
+
+		SecretScanMode:      envOr("SECRET_SCAN_MODE", "reject"),
+		ConfigRawSchemaPath: getenv("CONFIG_RAW_SCHEMA_PATH"),
+
+		GatewayTokenSecrets:          envBool("GATEWAY_TOKEN_SECRETS", false),
+		GatewayTokenMigrationTimeout: envDuration("GATEWAY_TOKEN_MIGRATION_TIMEOUT", 5*time.Minute),
+
+		DeletionCertKey:     getenv("DELETION_CERT_SIGNING_KEY"),
+		PurgeVerifyTimeout:  envDuration("PURGE_VERIFY_TIMEOUT", 45*time.Second),
+		DeleteVerifyTimeout: envDuration("DELETE_VERIFY_TIMEOUT", 45*time.Second),
+
+		RetainedStorageDays:      envInt("RETAINED_STORAGE_DAYS", 7),
+		RetentionJanitorInterval: envDuration("RETENTION_JANITOR_INTERVAL", time.Hour),
+
+		ObjectStoreEndpoint:  getenv("OBJECT_STORE_ENDPOINT"),
+		ObjectStoreRegion:    envOr("OBJECT_STORE_REGION", "us-east-1"),
+		ObjectStoreBucket:    getenv("OBJECT_STORE_BUCKET"),
+		ObjectStoreAccessKey: getenv("OBJECT_STORE_ACCESS_KEY"),
+		ObjectStoreSecretKey: getenv("OBJECT_STORE_SECRET_KEY"),
+
+		ExportPrefix:  envOr("EXPORT_PREFIX", "exports/"),
+		ExportURLTTL:  envDuration("EXPORT_URL_TTL", 24*time.Hour),
+		ExportImage:   envOr("EXPORT_IMAGE", "curlimages/curl:8.10.1"),
+		SnapshotClass: getenv("VOLUME_SNAPSHOT_CLASS"),
+
+		PrePullPauseImage: envOr("PREPULL_PAUSE_IMAGE", "registry.k8s.io/pause:3.10"),
+
+		AuditBucket:        getenv("AUDIT_BUCKET"),
+		AuditPrefix:        envOr("AUDIT_PREFIX", "audit/"),
+		AuditBatchSize:     envInt("AUDIT_BATCH_SIZE", 500),
+		AuditFlushInterval: envDuration("AUDIT_FLUSH_INTERVAL", time.Minute),
+		AuditHistorySize:   envInt("AUDIT_HISTORY_SIZE", 10000),
+
+		RecordingBufferSize:   envInt("RECORDING_BUFFER_SIZE", 100),
+		RecordingMaxBodyBytes: envInt("RECORDING_MAX_BODY_BYTES", 64*1024),
+		RecordingMaxDuration:  envDuration("RECORDING_MAX_DURATION", 24*time.Hour),
+
+		SentryDSN:         getenv("SENTRY_DSN"),
+		SentryEnvironment: envOr("SENTRY_ENVIRONMENT", "production"),
+		SentrySampleRate:  envFloat("SENTRY_SAMPLE_RATE", 1.0),
 	}
+	checkUnusedFileValues(files)
+	return cfg
 }
 
 // envOr returns the value of the named environment variable or fallback if it
 // is empty / unset.
 func envOr(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
+	if v := getenv(key); v != "" {
 		return v
 	}
 	return fallback
 }
+
+// envDuration parses the named environment variable as a time.Duration,
+// returning fallback if it is unset or malformed.
+func envDuration(key string, fallback time.Duration) time.Duration {
+	v := getenv(key)
+	if v == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("config: invalid duration %s=%q, using %s", key, v, fallback)
+		return fallback
+	}
+	return d
+}
+
+// envInt parses the named environment variable as an int, returning fallback
+// if it is unset or malformed.
+func envInt(key string, fallback int) int {
+	v := getenv(key)
+	if v == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("config: invalid integer %s=%q, using %d", key, v, fallback)
+		return fallback
+	}
+	return n
+}
+
+// envFloat parses the named environment variable as a float64, returning
+// fallback if it is unset or malformed.
+func envFloat(key string, fallback float64) float64 {
+	v := getenv(key)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("config: invalid number %s=%q, using %g", key, v, fallback)
+		return fallback
+	}
+	return f
+}
+
+// envBool parses the named environment variable as a bool, returning fallback
+// if it is unset or malformed.
+func envBool(key string, fallback bool) bool {
+	v := getenv(key)
+	if v == "" {
+		return fallback
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("config: invalid boolean %s=%q, using %t", key, v, fallback)
+		return fallback
+	}
+	return b
+}
+
+// envMap parses the named environment variable, or fallback if it is unset,
+// as comma-separated key=value pairs, dropping malformed items.
+func envMap(key, fallback string) map[string]string {
+	v, ok := lookupEnv(key)
+	if !ok {
+		v = fallback
+	}
+	out := map[string]string{}
+	for _, item := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(item, "=")
+		if k, val = strings.TrimSpace(k), strings.TrimSpace(val); ok && k != "" && val != "" {
+			out[k] = val
+		}
+	}
+	return out
+}
+
+// envInt64Map parses the named environment variable as comma-separated
+// key=integer pairs, dropping malformed items.
+func envInt64Map(key string) map[string]int64 {
+	out := map[string]int64{}
+	for k, v := range envMap(key, "") {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			log.Printf("config: invalid %s entry %s=%q, ignoring", key, k, v)
+			continue
+		}
+		out[k] = n
+	}
+	return out
+}
+
+// envPlans parses the named environment variable as comma-separated
+// key=plan|plan pairs.
+func envPlans(key string) map[string][]string {
+	out := map[string][]string{}
+	for k, v := range envMap(key, "") {
+		for _, plan := range strings.Split(v, "|") {
+			if plan = strings.TrimSpace(plan); plan != "" {
+				out[k] = append(out[k], plan)
+			}
+		}
+	}
+	return out
+}
+
+// envList splits the named environment variable on commas, dropping empty
+// items.
+func envList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// envListOr is envList with a default for when the variable is unset. Set to
+// the empty string, it yields an empty list.
+func envListOr(key string, def []string) []string {
+	if _, ok := lookupEnv(key); !ok {
+		return def
+	}
+	return envList(key)
+}
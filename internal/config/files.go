@@ -0,0 +1,178 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Configuration can also come from files, layered under the environment: a
+// base file shared by every deployment and an overlay for the deployment
+// environment, so that the differences between staging and production live
+// in reviewed files. With CONFIG_DIR=config and CONFIG_ENVIRONMENT=prod,
+// config/base.yaml is read, then config/prod.yaml over it, and any variable
+// set in the process environment, even to an empty value, wins over both.
+//
+// A file maps variable names to values:
+//
+//	TENANT_DOMAIN: wareit.ai
+//	WORK_QUEUE_WORKERS: 8
+//	QUEUE_TRIAL_PLANS: [trial, free]
+//	ENVIRONMENT_PLANS: {prod: [pro, team], dev: [trial]}
+//
+// Lists are joined with commas and maps become comma-separated key=value
+// pairs, with list values joined by '|', as the variables expect.
+
+// fileValues holds the variables read from the config files, by name, and
+// looked records the names Load asked for, to find unknown ones. Both are
+// set by Load.
+var (
+	fileValues map[string]string
+	looked     map[string]bool
+)
+
+// getenv returns the value of the named variable from the environment or,
+// when it is not set there, from the config files.
+func getenv(key string) string {
+	v, _ := lookupEnv(key)
+	return v
+}
+
+// lookupEnv is os.LookupEnv over the environment and the config files.
+func lookupEnv(key string) (string, bool) {
+	if looked != nil {
+		looked[key] = true
+	}
+	if v, ok := os.LookupEnv(key); ok {
+		return v, true
+	}
+	v, ok := fileValues[key]
+	return v, ok
+}
+
+// configFiles returns the config files selected by CONFIG_DIR and
+// CONFIG_ENVIRONMENT, in the order they are layered. Only the process
+// environment selects them.
+func configFiles() []string {
+	dir := os.Getenv("CONFIG_DIR")
+	if dir == "" {
+		return nil
+	}
+	files := []string{filepath.Join(dir, "base.yaml")}
+	if env := os.Getenv("CONFIG_ENVIRONMENT"); env != "" {
+		files = append(files, filepath.Join(dir, env+".yaml"))
+	}
+	return files
+}
+
+// loadFiles reads and merges the config files, later files overriding
+// earlier ones, and returns the values and the files read. A missing base
+// file is allowed; a missing overlay is not, since a misspelt
+// CONFIG_ENVIRONMENT would otherwise go unnoticed.
+func loadFiles(files []string) (map[string]string, []string, error) {
+	values := map[string]string{}
+	var read []string
+	for i, path := range files {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) && i == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading config file: %v", err)
+		}
+		read = append(read, path)
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		for key, value := range raw {
+			if key != strings.ToUpper(key) {
+				return nil, nil, fmt.Errorf("%s: %q is not a variable name; names are upper case, e.g. TENANT_DOMAIN", path, key)
+			}
+			if key == "CONFIG_DIR" || key == "CONFIG_ENVIRONMENT" {
+				return nil, nil, fmt.Errorf("%s: %s can only be set in the environment", path, key)
+			}
+			s, err := fileValue(value, 0)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s: %v", path, key, err)
+			}
+			values[key] = s
+		}
+	}
+	return values, read, nil
+}
+
+// fileValue renders a value of a config file as the variable's string.
+func fileValue(value interface{}, depth int) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		sep := ","
+		if depth > 0 {
+			sep = "|"
+		}
+		items := make([]string, len(v))
+		for i, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return "", fmt.Errorf("list items must be values, not maps")
+			}
+			if _, ok := item.([]interface{}); ok {
+				return "", fmt.Errorf("list items must be values, not lists")
+			}
+			s, err := fileValue(item, depth)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return strings.Join(items, sep), nil
+	case map[string]interface{}:
+		if depth > 0 {
+			return "", fmt.Errorf("maps cannot be nested")
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, k := range keys {
+			s, err := fileValue(v[k], depth+1)
+			if err != nil {
+				return "", err
+			}
+			pairs[i] = k + "=" + s
+		}
+		return strings.Join(pairs, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// checkUnusedFileValues fails on variables in the config files that Load
+// does not read, which are most likely misspelt.
+func checkUnusedFileValues(files []string) {
+	var unknown []string
+	for key := range fileValues {
+		if !looked[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		log.Fatalf("config: unknown variables in %s: %s", strings.Join(files, ", "), strings.Join(unknown, ", "))
+	}
+}
@@ -0,0 +1,324 @@
+// Package configschema validates tenant-provided OpenClaw configuration
+// against a JSON Schema of the settings tenants may change. It implements the
+// subset of JSON Schema that such a schema needs: type, properties,
+// additionalProperties, required, enum, items, minimum, maximum, minLength,
+// maxLength, maxItems and pattern. Other keywords are ignored.
+//
+// The same subset, with nullable and the x-kubernetes-preserve-unknown-fields
+// and x-kubernetes-int-or-string extensions, covers the structural OpenAPI
+// schemas of CRDs, so that rendered instance specs can be checked offline
+// (see ParseCRD).
+package configschema
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"sigs.k8s.io/yaml"
+)
+
+// defaultSchema is used when no schema file is configured.
+//
+//go:embed openclaw.schema.json
+var defaultSchema []byte
+
+// Schema is a compiled schema node.
+type Schema struct {
+	Type                 typeList           `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *additional        `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	// Kubernetes extensions, only found in CRD schemas.
+	Nullable              bool `json:"nullable,omitempty"`
+	PreserveUnknownFields bool `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool `json:"x-kubernetes-int-or-string,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// typeList is the "type" keyword, a name or a list of names.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("type must be a string or a list of strings")
+	}
+	*t = many
+	return nil
+}
+
+// additional is the "additionalProperties" keyword, a boolean or a schema.
+type additional struct {
+	allowed bool
+	schema  *Schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.allowed); err == nil {
+		return nil
+	}
+	a.allowed = true
+	return json.Unmarshal(data, &a.schema)
+}
+
+// Load reads a schema from a YAML or JSON file, or returns the built-in one
+// when path is empty.
+func Load(path string) (*Schema, error) {
+	data := defaultSchema
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("reading config schema: %v", err)
+		}
+	}
+	var s Schema
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing config schema: %v", err)
+	}
+	if err := s.compile("$"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// crd is the part of a CustomResourceDefinition that ParseCRD reads.
+type crd struct {
+	Spec struct {
+		Versions []struct {
+			Name   string `json:"name"`
+			Schema struct {
+				OpenAPIV3Schema *Schema `json:"openAPIV3Schema"`
+			} `json:"schema"`
+		} `json:"versions"`
+	} `json:"spec"`
+}
+
+// ParseCRD returns the schema of version in a CustomResourceDefinition
+// manifest. apiVersion, kind and metadata, which the API server accepts on
+// every object, are added to it.
+func ParseCRD(data []byte, version string) (*Schema, error) {
+	var c crd
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing CRD: %v", err)
+	}
+	for _, v := range c.Spec.Versions {
+		if v.Name != version {
+			continue
+		}
+		s := v.Schema.OpenAPIV3Schema
+		if s == nil {
+			return nil, fmt.Errorf("CRD version %s has no schema", version)
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]*Schema{}
+		}
+		s.Properties["apiVersion"] = &Schema{Type: typeList{"string"}}
+		s.Properties["kind"] = &Schema{Type: typeList{"string"}}
+		s.Properties["metadata"] = &Schema{Type: typeList{"object"}, PreserveUnknownFields: true}
+		if err := s.compile("$"); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("CRD has no version %s", version)
+}
+
+// compile checks the schema below path and compiles its patterns.
+func (s *Schema) compile(path string) error {
+	if s == nil {
+		return nil
+	}
+	for _, t := range s.Type {
+		switch t {
+		case "object", "array", "string", "integer", "number", "boolean", "null":
+		default:
+			return fmt.Errorf("config schema %s: unknown type %q", path, t)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("config schema %s: pattern: %v", path, err)
+		}
+		s.pattern = re
+	}
+	for name, p := range s.Properties {
+		if err := p.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.AdditionalProperties != nil {
+		if err := s.AdditionalProperties.schema.compile(path + ".*"); err != nil {
+			return err
+		}
+	}
+	return s.Items.compile(path + "[]")
+}
+
+// Validate checks a value decoded from JSON and returns its violations, each
+// prefixed with the dotted path of the offending field under root.
+func (s *Schema) Validate(root string, v interface{}) []string {
+	var out []string
+	s.validate(root, v, false, &out)
+	return out
+}
+
+// ValidateObject checks an object decoded from JSON as the API server would
+// against a CRD schema from ParseCRD. Fields the schema does not describe
+// are reported too, since the server would silently prune them.
+func (s *Schema) ValidateObject(v interface{}) []string {
+	var out []string
+	s.validate("", v, true, &out)
+	for i, o := range out {
+		out[i] = strings.TrimPrefix(o, ".")
+	}
+	return out
+}
+
+func (s *Schema) validate(path string, v interface{}, prune bool, out *[]string) {
+	if s == nil {
+		return
+	}
+	if v == nil && s.Nullable {
+		return
+	}
+	if s.IntOrString {
+		if _, ok := v.(string); !ok && !(&Schema{Type: typeList{"integer"}}).hasType(v) {
+			*out = append(*out, fmt.Sprintf("%s: must be an integer or a string", path))
+		}
+		return
+	}
+	if len(s.Type) > 0 && !s.hasType(v) {
+		*out = append(*out, fmt.Sprintf("%s: must be of type %s", path, strings.Join(s.Type, " or ")))
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			b, _ := json.Marshal(e)
+			allowed[i] = string(b)
+		}
+		*out = append(*out, fmt.Sprintf("%s: must be one of %s", path, strings.Join(allowed, ", ")))
+		return
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := t[name]; !ok {
+				*out = append(*out, fmt.Sprintf("%s.%s: is required", path, name))
+			}
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field := path + "." + k
+			if p, ok := s.Properties[k]; ok {
+				p.validate(field, t[k], prune, out)
+				continue
+			}
+			switch a := s.AdditionalProperties; {
+			case a == nil && prune && !s.PreserveUnknownFields:
+				*out = append(*out, fmt.Sprintf("%s: is not in the schema and would be pruned", field))
+			case a == nil:
+			case !a.allowed:
+				*out = append(*out, fmt.Sprintf("%s: is not an allowed setting", field))
+			default:
+				a.schema.validate(field, t[k], prune, out)
+			}
+		}
+	case []interface{}:
+		if s.MaxItems != nil && len(t) > *s.MaxItems {
+			*out = append(*out, fmt.Sprintf("%s: must have at most %d items", path, *s.MaxItems))
+		}
+		for i, e := range t {
+			s.Items.validate(fmt.Sprintf("%s[%d]", path, i), e, prune, out)
+		}
+	case string:
+		n := utf8.RuneCountInString(t)
+		if s.MinLength != nil && n < *s.MinLength {
+			*out = append(*out, fmt.Sprintf("%s: must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			*out = append(*out, fmt.Sprintf("%s: must be at most %d characters", path, *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(t) {
+			*out = append(*out, fmt.Sprintf("%s: must match %s", path, s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && t < *s.Minimum {
+			*out = append(*out, fmt.Sprintf("%s: must be at least %g", path, *s.Minimum))
+		}
+		if s.Maximum != nil && t > *s.Maximum {
+			*out = append(*out, fmt.Sprintf("%s: must be at most %g", path, *s.Maximum))
+		}
+	}
+}
+
+// hasType reports whether v is of one of the schema's types.
+func (s *Schema) hasType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || (t == "integer" && x == float64(int64(x))) {
+				return true
+			}
+		case nil:
+			if t == "null" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inEnum reports whether v equals one of the schema's enum values.
+func (s *Schema) inEnum(v interface{}) bool {
+	b, _ := json.Marshal(v)
+	for _, e := range s.Enum {
+		if eb, _ := json.Marshal(e); string(eb) == string(b) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+// Package consistency compares the instance registry with the cluster and
+// reports, and optionally repairs, the places where they disagree.
+package consistency
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// Finding identifies one instance involved in an inconsistency.
+type Finding struct {
+	TenantID     string `json:"tenant_id"`
+	InstanceName string `json:"instance_name"`
+	Status       string `json:"status,omitempty"`
+}
+
+// Mismatch is an instance present on both sides whose recorded fields differ.
+type Mismatch struct {
+	InstanceName string `json:"instance_name"`
+	Field        string `json:"field"`
+	Registry     string `json:"registry"`
+	Cluster      string `json:"cluster"`
+}
+
+// Duplicate is a tenant with more than one instance in the cluster.
+type Duplicate struct {
+	TenantID  string   `json:"tenant_id"`
+	Instances []string `json:"instances"`
+}
+
+// Report is the outcome of one check.
+type Report struct {
+	CheckedAt           time.Time   `json:"checked_at"`
+	Consistent          bool        `json:"consistent"`
+	MissingFromRegistry []Finding   `json:"missing_from_registry"` // In the cluster, not the registry
+	MissingFromCluster  []Finding   `json:"missing_from_cluster"`  // Live in the registry, not the cluster
+	Mismatches          []Mismatch  `json:"mismatches"`
+	DuplicateTenants    []Duplicate `json:"duplicate_tenants"`
+	Repaired            int         `json:"repaired"`
+}
+
+// Checker runs consistency checks between an instance manager and a registry.
+type Checker struct {
+	mgr k8s.InstanceManager
+	reg *registry.Registry
+
+	mu   sync.Mutex
+	last *Report
+}
+
+// New creates a Checker.
+func New(mgr k8s.InstanceManager, reg *registry.Registry) *Checker {
+	return &Checker{mgr: mgr, reg: reg}
+}
+
+// Check lists the cluster, compares it with the registry and, with repair set,
+// brings the registry in line: missing and mismatched rows are rewritten from
+// the cluster and rows with no cluster object are marked deleted. Duplicate
+// instances are only reported, since removing one would destroy tenant data.
+func (c *Checker) Check(ctx context.Context, repair bool) (*Report, error) {
+	if !c.reg.Synced() {
+		return nil, fmt.Errorf("registry has not synced with the cluster yet")
+	}
+
+	// Snapshot the registry before listing the cluster: an instance created in
+	// between is then reported as missing from the registry, which repair
+	// fixes, rather than a stale row being missed.
+	records := c.reg.List()
+	instances, err := c.mgr.ListInstances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		CheckedAt:           time.Now().UTC(),
+		MissingFromRegistry: []Finding{},
+		MissingFromCluster:  []Finding{},
+		Mismatches:          []Mismatch{},
+		DuplicateTenants:    []Duplicate{},
+	}
+
+	live := make(map[string]registry.Record, len(records))
+	for _, rec := range records {
+		if rec.DeletedAt == nil {
+			live[rec.InstanceName] = rec
+		}
+	}
+
+	var repairs []k8s.InstanceEvent
+	inCluster := make(map[string]bool, len(instances))
+	byTenant := make(map[string][]string)
+	for _, inst := range instances {
+		name := inst.Info.Name
+		inCluster[name] = true
+		byTenant[inst.TenantID] = append(byTenant[inst.TenantID], name)
+
+		upsert := k8s.InstanceEvent{Type: k8s.InstanceUpdated, TenantID: inst.TenantID, Info: inst.Info, Object: inst.Object}
+		rec, ok := live[name]
+		if !ok {
+			report.MissingFromRegistry = append(report.MissingFromRegistry, Finding{
+				TenantID: inst.TenantID, InstanceName: name, Status: inst.Info.Status,
+			})
+			repairs = append(repairs, upsert)
+			continue
+		}
+		mismatches := compare(rec, inst)
+		report.Mismatches = append(report.Mismatches, mismatches...)
+		if len(mismatches) > 0 {
+			repairs = append(repairs, upsert)
+		}
+	}
+
+	for name, rec := range live {
+		if inCluster[name] {
+			continue
+		}
+		report.MissingFromCluster = append(report.MissingFromCluster, Finding{
+			TenantID: rec.TenantID, InstanceName: name, Status: rec.Status,
+		})
+		repairs = append(repairs, k8s.InstanceEvent{
+			Type: k8s.InstanceDeleted, TenantID: rec.TenantID, Info: &k8s.InstanceInfo{Name: name},
+		})
+	}
+
+	for tenantID, names := range byTenant {
+		if len(names) > 1 {
+			sort.Strings(names)
+			report.DuplicateTenants = append(report.DuplicateTenants, Duplicate{TenantID: tenantID, Instances: names})
+		}
+	}
+
+	sort.Slice(report.MissingFromRegistry, func(i, j int) bool {
+		return report.MissingFromRegistry[i].InstanceName < report.MissingFromRegistry[j].InstanceName
+	})
+	sort.Slice(report.MissingFromCluster, func(i, j int) bool {
+		return report.MissingFromCluster[i].InstanceName < report.MissingFromCluster[j].InstanceName
+	})
+	sort.Slice(report.DuplicateTenants, func(i, j int) bool {
+		return report.DuplicateTenants[i].TenantID < report.DuplicateTenants[j].TenantID
+	})
+
+	report.Consistent = len(report.MissingFromRegistry) == 0 && len(report.MissingFromCluster) == 0 &&
+		len(report.Mismatches) == 0 && len(report.DuplicateTenants) == 0
+
+	if repair {
+		for _, ev := range repairs {
+			c.reg.HandleInstanceEvent(ev)
+		}
+		report.Repaired = len(repairs)
+	}
+
+	c.mu.Lock()
+	c.last = report
+	c.mu.Unlock()
+	return report, nil
+}
+
+// compare returns the fields on which rec no longer matches the cluster.
+func compare(rec registry.Record, inst k8s.ClusterInstance) []Mismatch {
+	var out []Mismatch
+	check := func(field, reg, cluster string) {
+		if reg != cluster {
+			out = append(out, Mismatch{InstanceName: rec.InstanceName, Field: field, Registry: reg, Cluster: cluster})
+		}
+	}
+	check("tenant_id", rec.TenantID, inst.TenantID)
+	check("plan", rec.Plan, inst.Info.Plan)
+	check("contact_email", rec.ContactEmail, inst.Info.ContactEmail)
+	check("status", rec.Status, inst.Info.Status)
+	return out
+}
+
+// Last returns the most recent report, or nil if no check has completed.
+func (c *Checker) Last() *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Run checks every interval until ctx is cancelled, repairing when repair is
+// set and logging any inconsistency found.
+func (c *Checker) Run(ctx context.Context, interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := c.Check(ctx, repair)
+		if err != nil {
+			log.Printf("consistency: check failed: %v", err)
+			continue
+		}
+		if !report.Consistent {
+			log.Printf("consistency: %d missing from registry, %d missing from cluster, %d mismatched field(s), %d tenant(s) with duplicates, %d repaired",
+				len(report.MissingFromRegistry), len(report.MissingFromCluster), len(report.Mismatches),
+				len(report.DuplicateTenants), report.Repaired)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package correlation carries the per-request correlation ID used to trace a
+// single API call across logs, audit entries, Kubernetes objects and
+// downstream services.
+package correlation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Header is the HTTP header through which callers supply, and responses
+// echo, the correlation ID.
+const Header = "X-Correlation-ID"
+
+// validID restricts caller-supplied IDs to characters that are safe in log
+// lines and Kubernetes annotation values.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the correlation ID stored in ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Valid reports whether a caller-supplied correlation ID is acceptable.
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+// NewID generates a random correlation ID.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+// Package deadline fails instances that have not reached running within the
+// provisioning deadline. Their diagnostics are kept in the registry, the
+// status change fires the instance.failed webhook, and the instance is
+// optionally deleted.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// Config sets the deadline and what happens once it passes.
+type Config struct {
+	Deadline time.Duration // Time from creation to running; 0 disables
+	Cleanup  bool          // Delete the instance once it is failed
+}
+
+// tracked is an instance that has not been seen running yet.
+type tracked struct {
+	tenantID string
+	created  time.Time
+	status   string
+}
+
+// Enforcer follows instance events and fails the instances that miss the
+// deadline.
+type Enforcer struct {
+	mgr k8s.InstanceManager
+	reg *registry.Registry
+	cfg Config
+
+	mu        sync.Mutex
+	synced    bool                // Past the watch's initial list
+	instances map[string]*tracked // By instance name
+}
+
+// New creates an Enforcer failing instances through mgr and keeping their
+// diagnostics in reg.
+func New(mgr k8s.InstanceManager, reg *registry.Registry, cfg Config) *Enforcer {
+	return &Enforcer{mgr: mgr, reg: reg, cfg: cfg, instances: make(map[string]*tracked)}
+}
+
+// HandleInstanceEvent tracks instances until they first run; pass it to
+// OnInstanceEvent. Only provisioning is held to the deadline: an instance
+// that has run is not tracked again when it restarts. Instances listed when
+// the watch starts that are already past the deadline are left alone, since
+// they may have run before.
+func (e *Enforcer) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ev.Type == k8s.InstanceSynced {
+		e.synced = true
+		return
+	}
+	if ev.Info == nil {
+		return
+	}
+	name := ev.Info.Name
+	t, ok := e.instances[name]
+	switch {
+	case ev.Type == k8s.InstanceDeleted || ev.Info.Status == "running" || ev.Info.Status == "error":
+		delete(e.instances, name)
+	case ok:
+		t.status = ev.Info.Status
+	case ev.Type == k8s.InstanceAdded:
+		created := ev.Info.CreatedAt
+		if created.IsZero() {
+			created = time.Now()
+		}
+		if !e.synced && time.Since(created) >= e.cfg.Deadline {
+			return
+		}
+		e.instances[name] = &tracked{tenantID: ev.TenantID, created: created, status: ev.Info.Status}
+	}
+}
+
+// Run checks for overdue instances every 30 seconds until ctx is cancelled.
+func (e *Enforcer) Run(ctx context.Context) {
+	if e.cfg.Deadline <= 0 {
+		return
+	}
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		type overdue struct {
+			name string
+			tracked
+		}
+		var due []overdue
+		e.mu.Lock()
+		for name, t := range e.instances {
+			if t.status != "suspended" && time.Since(t.created) >= e.cfg.Deadline {
+				due = append(due, overdue{name, *t})
+				delete(e.instances, name)
+			}
+		}
+		e.mu.Unlock()
+
+		for _, o := range due {
+			e.fail(ctx, o.tenantID, o.name)
+		}
+	}
+}
+
+// fail fails one overdue instance, keeps its diagnostics and, with Cleanup,
+// deletes it.
+func (e *Enforcer) fail(ctx context.Context, tenantID, name string) {
+	ctx = k8s.WithInstance(ctx, name)
+	reason := fmt.Sprintf("provisioning deadline of %s exceeded", e.cfg.Deadline)
+	d, err := e.mgr.FailInstance(ctx, tenantID, reason)
+	if d != nil {
+		e.reg.SetDiagnostics(d)
+	}
+	if err != nil {
+		log.Printf("deadline: failing instance %s of tenant %s: %v", name, tenantID, err)
+		return
+	}
+	log.Printf("deadline: instance %s of tenant %s failed: %s (state %s, %d event(s) captured)",
+		name, tenantID, reason, d.State, len(d.Events))
+	if !e.cfg.Cleanup {
+		return
+	}
+	if err := e.mgr.DeleteInstance(ctx, tenantID); err != nil {
+		log.Printf("deadline: deleting failed instance %s of tenant %s: %v", name, tenantID, err)
+		return
+	}
+	log.Printf("deadline: deleted failed instance %s of tenant %s", name, tenantID)
+}
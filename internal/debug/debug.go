@@ -0,0 +1,61 @@
+// Package debug serves runtime diagnostics (pprof profiles, goroutine dumps,
+// expvar counters and build info) on a separate, internal-only listener.
+package debug
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+)
+
+// Handler returns the mux for the debug listener. It must never be mounted on
+// the public API router.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	// Profiles, including /debug/pprof/goroutine?debug=2 for full goroutine
+	// dumps and /debug/pprof/heap for memory growth investigations.
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/buildinfo", buildInfo)
+	mux.HandleFunc("/debug/runtime", runtimeStats)
+
+	return mux
+}
+
+// buildInfo reports the module versions and VCS settings baked into the
+// binary.
+func buildInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		http.Error(w, "build info unavailable", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(info.String()))
+}
+
+// runtimeStats reports a point-in-time summary of goroutines and memory.
+func runtimeStats(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"go_version":     runtime.Version(),
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     mem.HeapAlloc,
+		"heap_objects":   mem.HeapObjects,
+		"heap_sys":       mem.HeapSys,
+		"num_gc":         mem.NumGC,
+		"pause_total_ns": mem.PauseTotalNs,
+	})
+}
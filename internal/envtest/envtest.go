@@ -0,0 +1,329 @@
+// Package envtest runs a throwaway etcd and kube-apiserver with the
+// OpenClawInstance CRD installed, for integration tests that need a real API
+// server but no nodes. It uses the binaries installed by setup-envtest and
+// found via KUBEBUILDER_ASSETS, as controller-runtime's envtest does.
+package envtest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed crds/*.yaml
+var crdFS embed.FS
+
+var (
+	crdGVR       = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	namespaceGVR = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+)
+
+// Environment is a running control plane. Create one with Start and release
+// it with Stop.
+type Environment struct {
+	// RestConfig authenticates as a cluster admin.
+	RestConfig *rest.Config
+	// Client is a dynamic client built from RestConfig.
+	Client dynamic.Interface
+	// Namespace is created at startup for tenant instances.
+	Namespace string
+
+	dir       string
+	token     string
+	etcdURL   string
+	etcd      *exec.Cmd
+	apiserver *exec.Cmd
+}
+
+// Start launches etcd and kube-apiserver from assetsDir (KUBEBUILDER_ASSETS
+// when empty), installs the CRD fixtures and creates namespace. Call Stop even
+// if Start fails part-way; it is safe on a partial Environment.
+func Start(ctx context.Context, assetsDir, namespace string) (*Environment, error) {
+	if assetsDir == "" {
+		assetsDir = os.Getenv("KUBEBUILDER_ASSETS")
+	}
+	if assetsDir == "" {
+		return nil, fmt.Errorf("KUBEBUILDER_ASSETS is not set; install binaries with setup-envtest")
+	}
+
+	dir, err := os.MkdirTemp("", "envtest-")
+	if err != nil {
+		return nil, err
+	}
+	env := &Environment{Namespace: namespace, dir: dir}
+
+	if err := env.startEtcd(ctx, assetsDir); err != nil {
+		return env, err
+	}
+	if err := env.startAPIServer(ctx, assetsDir); err != nil {
+		return env, err
+	}
+	if err := env.installCRDs(ctx); err != nil {
+		return env, err
+	}
+
+	ns := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata":   map[string]interface{}{"name": namespace},
+	}}
+	if _, err := env.Client.Resource(namespaceGVR).Create(ctx, ns, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return env, fmt.Errorf("creating namespace %s: %v", namespace, err)
+	}
+	return env, nil
+}
+
+// Stop terminates the control plane and removes its data.
+func (e *Environment) Stop() {
+	for _, cmd := range []*exec.Cmd{e.apiserver, e.etcd} {
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}
+	if e.dir != "" {
+		os.RemoveAll(e.dir)
+	}
+}
+
+// Config returns a service configuration that points at the environment
+// through a generated kubeconfig.
+func (e *Environment) Config() *config.Config {
+	cfg := config.Load()
+	cfg.Backend = "kubernetes"
+	cfg.Namespace = e.Namespace
+	cfg.KubeconfigBase64 = base64.StdEncoding.EncodeToString([]byte(e.kubeconfig()))
+	cfg.KubeAuthMode = ""
+	cfg.KubeContexts = nil
+	return cfg
+}
+
+// kubeconfig renders a kubeconfig for the admin token.
+func (e *Environment) kubeconfig() string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: envtest
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+users:
+- name: admin
+  user:
+    token: %s
+contexts:
+- name: envtest
+  context:
+    cluster: envtest
+    user: admin
+current-context: envtest
+`, e.RestConfig.Host, e.token)
+}
+
+func (e *Environment) startEtcd(ctx context.Context, assetsDir string) error {
+	clientPort, err := freePort()
+	if err != nil {
+		return err
+	}
+	peerPort, err := freePort()
+	if err != nil {
+		return err
+	}
+	clientURL := fmt.Sprintf("http://127.0.0.1:%d", clientPort)
+	peerURL := fmt.Sprintf("http://127.0.0.1:%d", peerPort)
+
+	e.etcd = exec.Command(filepath.Join(assetsDir, "etcd"),
+		"--data-dir="+filepath.Join(e.dir, "etcd"),
+		"--listen-client-urls="+clientURL,
+		"--advertise-client-urls="+clientURL,
+		"--listen-peer-urls="+peerURL,
+		"--initial-advertise-peer-urls="+peerURL,
+		"--initial-cluster=default="+peerURL,
+		"--unsafe-no-fsync=true",
+	)
+	if err := e.startProcess(e.etcd, "etcd"); err != nil {
+		return err
+	}
+	e.etcdURL = clientURL
+
+	return waitHTTP(ctx, clientURL+"/health", nil)
+}
+
+func (e *Environment) startAPIServer(ctx context.Context, assetsDir string) error {
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	host := fmt.Sprintf("https://127.0.0.1:%d", port)
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	e.token = hex.EncodeToString(token)
+	tokenFile := filepath.Join(e.dir, "tokens.csv")
+	if err := os.WriteFile(tokenFile, []byte(e.token+`,admin,admin,"system:masters"`+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	saKeyFile := filepath.Join(e.dir, "sa.key")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(saKey)})
+	if err := os.WriteFile(saKeyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+
+	e.apiserver = exec.Command(filepath.Join(assetsDir, "kube-apiserver"),
+		"--etcd-servers="+e.etcdURL,
+		"--cert-dir="+filepath.Join(e.dir, "certs"),
+		"--bind-address=127.0.0.1",
+		"--advertise-address=127.0.0.1",
+		"--secure-port="+strconv.Itoa(port),
+		"--token-auth-file="+tokenFile,
+		"--authorization-mode=RBAC",
+		"--service-cluster-ip-range=10.0.0.0/24",
+		"--service-account-issuer="+host,
+		"--service-account-key-file="+saKeyFile,
+		"--service-account-signing-key-file="+saKeyFile,
+		"--disable-admission-plugins=ServiceAccount",
+		"--allow-privileged=true",
+	)
+	if err := e.startProcess(e.apiserver, "kube-apiserver"); err != nil {
+		return err
+	}
+
+	e.RestConfig = &rest.Config{
+		Host:            host,
+		BearerToken:     e.token,
+		TLSClientConfig: rest.TLSClientConfig{Insecure: true},
+	}
+	e.Client, err = dynamic.NewForConfig(e.RestConfig)
+	if err != nil {
+		return fmt.Errorf("creating client: %v", err)
+	}
+
+	return waitHTTP(ctx, host+"/readyz", &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}, "Authorization", "Bearer "+e.token)
+}
+
+// startProcess starts cmd with its output captured to a log file in the
+// environment's directory.
+func (e *Environment) startProcess(cmd *exec.Cmd, name string) error {
+	logFile, err := os.Create(filepath.Join(e.dir, name+".log"))
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %s: %v", name, err)
+	}
+	return nil
+}
+
+// installCRDs creates every embedded CRD fixture and waits for each to be
+// established.
+func (e *Environment) installCRDs(ctx context.Context) error {
+	files, err := fs.Glob(crdFS, "crds/*.yaml")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		data, err := crdFS.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		crd := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(data, &crd.Object); err != nil {
+			return fmt.Errorf("parsing %s: %v", f, err)
+		}
+		if _, err := e.Client.Resource(crdGVR).Create(ctx, crd, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("installing %s: %v", crd.GetName(), err)
+		}
+
+		err = wait.PollUntilContextTimeout(ctx, 200*time.Millisecond, 30*time.Second, true,
+			func(ctx context.Context) (bool, error) {
+				got, err := e.Client.Resource(crdGVR).Get(ctx, crd.GetName(), metav1.GetOptions{})
+				if err != nil {
+					return false, nil
+				}
+				conditions, _, _ := unstructured.NestedSlice(got.Object, "status", "conditions")
+				for _, c := range conditions {
+					cond, _ := c.(map[string]interface{})
+					if cond["type"] == "Established" && cond["status"] == "True" {
+						return true, nil
+					}
+				}
+				return false, nil
+			})
+		if err != nil {
+			return fmt.Errorf("waiting for %s to be established: %v", crd.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// waitHTTP polls url until it answers 200. header is an optional name/value
+// pair sent with each request.
+func waitHTTP(ctx context.Context, url string, client *http.Client, header ...string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return wait.PollUntilContextTimeout(ctx, 200*time.Millisecond, time.Minute, true,
+		func(ctx context.Context) (bool, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return false, err
+			}
+			if len(header) == 2 {
+				req.Header.Set(header[0], header[1])
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return false, nil
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK, nil
+		})
+}
+
+// freePort returns a TCP port on the loopback interface that is free right
+// now.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,147 @@
+package envtest
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	instanceGVR  = schema.GroupVersionResource{Group: "openclaw.rocks", Version: "v1alpha1", Resource: "openclawinstances"}
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretGVR    = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// instanceLabel matches the label the real operator puts on dependents.
+const instanceLabel = "app.kubernetes.io/instance"
+
+// FakeOperator stands in for the OpenClaw operator and the garbage collector,
+// neither of which runs in an envtest control plane.
+type FakeOperator struct {
+	env *Environment
+
+	// ReadyAfter is how long a new instance stays without a phase before
+	// being marked Running.
+	ReadyAfter time.Duration
+	// Phase is the phase new instances end up in; "Running" when empty. Set
+	// it to "Failed" to exercise error paths.
+	Phase string
+}
+
+// NewFakeOperator creates an operator for env's namespace.
+func NewFakeOperator(env *Environment) *FakeOperator {
+	return &FakeOperator{env: env, ReadyAfter: time.Second}
+}
+
+// Run reconciles until ctx is cancelled. Every pass it:
+//   - creates a ConfigMap and Secret labelled with the instance name for each
+//     new OpenClawInstance, as the operator does for its config and token;
+//   - sets status.phase once the instance is older than ReadyAfter;
+//   - removes the foregroundDeletion finalizer from anything being deleted, as
+//     the garbage collector would once dependents are gone.
+func (o *FakeOperator) Run(ctx context.Context) {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		o.reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *FakeOperator) reconcile(ctx context.Context) {
+	ns := o.env.Namespace
+	client := o.env.Client
+
+	list, err := client.Resource(instanceGVR).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("fake operator: listing instances: %v", err)
+		}
+		return
+	}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if _, found, _ := unstructured.NestedString(item.Object, "status", "phase"); found {
+			continue
+		}
+		o.createDependents(ctx, item)
+		if time.Since(item.GetCreationTimestamp().Time) < o.ReadyAfter {
+			continue
+		}
+		phase := o.Phase
+		if phase == "" {
+			phase = "Running"
+		}
+		unstructured.SetNestedField(item.Object, phase, "status", "phase")
+		if _, err := client.Resource(instanceGVR).Namespace(ns).UpdateStatus(ctx, item, metav1.UpdateOptions{}); err != nil && !errors.IsConflict(err) {
+			log.Printf("fake operator: updating status of %s: %v", item.GetName(), err)
+		}
+	}
+
+	for _, gvr := range []schema.GroupVersionResource{instanceGVR, configMapGVR, secretGVR} {
+		o.collectGarbage(ctx, gvr)
+	}
+}
+
+// createDependents creates the instance's ConfigMap and Secret if missing.
+func (o *FakeOperator) createDependents(ctx context.Context, instance *unstructured.Unstructured) {
+	for _, dep := range []struct {
+		gvr  schema.GroupVersionResource
+		kind string
+	}{
+		{configMapGVR, "ConfigMap"},
+		{secretGVR, "Secret"},
+	} {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       dep.kind,
+			"metadata": map[string]interface{}{
+				"name":      instance.GetName(),
+				"namespace": o.env.Namespace,
+				"labels":    map[string]interface{}{instanceLabel: instance.GetName()},
+			},
+		}}
+		_, err := o.env.Client.Resource(dep.gvr).Namespace(o.env.Namespace).Create(ctx, obj, metav1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			log.Printf("fake operator: creating %s for %s: %v", dep.kind, instance.GetName(), err)
+		}
+	}
+}
+
+// collectGarbage clears finalizers on objects of gvr that are being deleted,
+// deleting their labelled dependents first when they are instances.
+func (o *FakeOperator) collectGarbage(ctx context.Context, gvr schema.GroupVersionResource) {
+	resource := o.env.Client.Resource(gvr).Namespace(o.env.Namespace)
+	list, err := resource.List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return
+	}
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetDeletionTimestamp() == nil || len(item.GetFinalizers()) == 0 {
+			continue
+		}
+		if gvr == instanceGVR {
+			for _, depGVR := range []schema.GroupVersionResource{configMapGVR, secretGVR} {
+				o.env.Client.Resource(depGVR).Namespace(o.env.Namespace).DeleteCollection(ctx, metav1.DeleteOptions{},
+					metav1.ListOptions{LabelSelector: instanceLabel + "=" + item.GetName()})
+			}
+		}
+		item.SetFinalizers(nil)
+		if _, err := resource.Update(ctx, item, metav1.UpdateOptions{}); err != nil && !errors.IsConflict(err) && !errors.IsNotFound(err) {
+			log.Printf("fake operator: finalizing %s %s: %v", gvr.Resource, item.GetName(), err)
+		}
+	}
+}
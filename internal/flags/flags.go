@@ -0,0 +1,128 @@
+// Package flags stores feature flags that are injected into tenant instances,
+// with per-plan and per-tenant overrides for gradual rollouts.
+package flags
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+)
+
+// namePattern restricts flag names to what maps cleanly onto an environment
+// variable suffix.
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+
+// Flag is one feature flag. The most specific setting wins: a tenant override,
+// then a plan override, then the default.
+type Flag struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Default     bool            `json:"default"`
+	Plans       map[string]bool `json:"plans,omitempty"`
+	Tenants     map[string]bool `json:"tenants,omitempty"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Enabled resolves the flag for a tenant on a plan.
+func (f *Flag) Enabled(tenantID, plan string) bool {
+	if v, ok := f.Tenants[tenantID]; ok {
+		return v
+	}
+	if v, ok := f.Plans[plan]; ok {
+		return v
+	}
+	return f.Default
+}
+
+// ValidName reports whether name may be used as a flag name.
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Store holds the flags, optionally persisted to a file after every change.
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	flags map[string]*Flag
+}
+
+// Open loads the flags at path, or starts an empty in-memory store when path
+// is empty.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, flags: make(map[string]*Flag)}
+	if path == "" {
+		return s, nil
+	}
+	if err := jsonfile.Load(path, &s.flags); err != nil {
+		return nil, fmt.Errorf("loading feature flags: %v", err)
+	}
+	return s, nil
+}
+
+// List returns copies of every flag ordered by name.
+func (s *Store) List() []Flag {
+	s.mu.Lock()
+	out := make([]Flag, 0, len(s.flags))
+	for _, f := range s.flags {
+		out = append(out, *f)
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Put creates or replaces a flag and returns it as stored.
+func (s *Store) Put(f Flag) (Flag, error) {
+	if !ValidName(f.Name) {
+		return f, fmt.Errorf("invalid flag name %q", f.Name)
+	}
+	f.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := f
+	s.flags[f.Name] = &stored
+	return f, s.save()
+}
+
+// Delete removes a flag and reports whether it existed.
+func (s *Store) Delete(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.flags[name]; !ok {
+		return false, nil
+	}
+	delete(s.flags, name)
+	return true, s.save()
+}
+
+// Resolve returns every flag's value for a tenant on a plan. A nil Store
+// resolves to no flags.
+func (s *Store) Resolve(tenantID, plan string) map[string]bool {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]bool, len(s.flags))
+	for name, f := range s.flags {
+		out[name] = f.Enabled(tenantID, plan)
+	}
+	return out
+}
+
+// save persists the flags. Callers hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	if err := jsonfile.Save(s.path, s.flags); err != nil {
+		return fmt.Errorf("saving feature flags: %v", err)
+	}
+	return nil
+}
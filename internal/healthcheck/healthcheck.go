@@ -0,0 +1,341 @@
+// Package healthcheck probes running instances over HTTP. Each instance is
+// probed at its own path, expected status and interval when these were given
+// at creation, and at the service-wide defaults otherwise. Instances that
+// fail several probes in a row are marked degraded, and registered handlers
+// are told when an instance becomes degraded or recovers.
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// schedulerTick is how often probe schedules are examined; instance
+// intervals are effectively rounded to it.
+const schedulerTick = time.Second
+
+// historySize is how many recent probes are kept per instance for latency
+// percentiles and failure counts.
+const historySize = 100
+
+// Result states.
+const (
+	StatusPending   = "pending" // Not probed yet, or not running
+	StatusHealthy   = "healthy"
+	StatusUnhealthy = "unhealthy"
+)
+
+// Config holds the defaults for instances without their own settings.
+type Config struct {
+	Path           string
+	ExpectedStatus int
+	Interval       time.Duration
+	Timeout        time.Duration // Per probe
+	DegradedAfter  int           // Consecutive failures before an instance is degraded
+}
+
+// Change reports that an instance became degraded or recovered.
+type Change struct {
+	TenantID string
+	Instance string
+	Degraded bool
+	Detail   string // The last probe error when degraded
+}
+
+// Result is the latest probe of one instance, with the settings in effect.
+type Result struct {
+	TenantID       string     `json:"tenant_id"`
+	Instance       string     `json:"instance"`
+	URL            string     `json:"url"`
+	ExpectedStatus int        `json:"expected_status"`
+	Interval       string     `json:"interval"`
+	Status         string     `json:"status"` // "pending", "healthy" or "unhealthy"
+	StatusCode     int        `json:"status_code,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	LatencyMS      int64      `json:"latency_ms,omitempty"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+	Failures       int        `json:"consecutive_failures"`
+	Degraded       bool       `json:"degraded"`
+
+	// Over the last (up to) 100 probes.
+	Probes       int   `json:"recent_probes"`
+	FailedProbes int   `json:"recent_failures"`
+	LatencyP50MS int64 `json:"latency_p50_ms,omitempty"`
+	LatencyP95MS int64 `json:"latency_p95_ms,omitempty"`
+}
+
+// sample is one probe outcome.
+type sample struct {
+	latency int64 // Milliseconds
+	ok      bool
+}
+
+// target is one instance being probed.
+type target struct {
+	result   Result
+	history  []sample // Oldest first
+	interval time.Duration
+	running  bool
+	next     time.Time
+	inFlight bool
+}
+
+// Prober probes every running instance on its schedule.
+type Prober struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	targets  map[string]*target // by tenant ID
+	handlers []func(Change)
+}
+
+// New creates a Prober.
+func New(cfg Config) *Prober {
+	return &Prober{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// A redirect is an answer in its own right, typically to a login
+			// page; report its status rather than following it.
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		targets: make(map[string]*target),
+	}
+}
+
+// OnChange registers fn to be called when an instance becomes degraded or
+// recovers. Handlers run on the probing goroutine and must not block.
+func (p *Prober) OnChange(fn func(Change)) {
+	p.mu.Lock()
+	p.handlers = append(p.handlers, fn)
+	p.mu.Unlock()
+}
+
+// HandleInstanceEvent keeps the set of probed instances and their settings in
+// step with the cluster; pass it to OnInstanceEvent.
+func (p *Prober) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.TenantID == "" || ev.Info == nil {
+		return
+	}
+	p.mu.Lock()
+	t := p.targets[ev.TenantID]
+	if ev.Type == k8s.InstanceDeleted {
+		delete(p.targets, ev.TenantID)
+	} else {
+		p.track(ev.TenantID, ev.Info)
+	}
+	// An instance that is deleted, replaced, re-configured or no longer
+	// running is no longer degraded as far as probing is concerned; its
+	// status is handled by the watch's own consumers.
+	var cleared *Change
+	if t != nil && t.result.Degraded && (p.targets[ev.TenantID] != t || !t.running) {
+		t.result.Degraded = false
+		cleared = &Change{TenantID: ev.TenantID, Instance: t.result.Instance}
+	}
+	handlers := p.handlers
+	p.mu.Unlock()
+
+	if cleared != nil {
+		for _, fn := range handlers {
+			fn(*cleared)
+		}
+	}
+}
+
+// track updates the probe settings of a tenant's instance. p.mu must be held.
+func (p *Prober) track(tenantID string, info *k8s.InstanceInfo) {
+	path, expected, interval := p.cfg.Path, p.cfg.ExpectedStatus, p.cfg.Interval
+	if hc := info.HealthCheck; hc != nil {
+		if hc.Path != "" {
+			path = hc.Path
+		}
+		if hc.ExpectedStatus != 0 {
+			expected = hc.ExpectedStatus
+		}
+		if hc.Interval != 0 {
+			interval = hc.Interval
+		}
+	}
+	url := strings.TrimSuffix(info.Endpoint, "/") + path
+
+	t, ok := p.targets[tenantID]
+	if !ok || t.result.Instance != info.Name || t.result.URL != url || t.result.ExpectedStatus != expected {
+		t = &target{result: Result{TenantID: tenantID, Instance: info.Name, URL: url, ExpectedStatus: expected, Status: StatusPending}}
+		p.targets[tenantID] = t
+	}
+	t.interval = interval
+	t.result.Interval = interval.String()
+	t.running = info.Status == "running"
+	if !t.running {
+		t.result.Status = StatusPending
+		t.result.Failures = 0
+	}
+}
+
+// Run probes due instances until ctx is cancelled.
+func (p *Prober) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		// Probes due within half a tick run now, so that ticker jitter does
+		// not push them back a whole tick.
+		due := now.Add(schedulerTick / 2)
+		p.mu.Lock()
+		for tenantID, t := range p.targets {
+			if !t.running || t.inFlight || due.Before(t.next) {
+				continue
+			}
+			t.inFlight = true
+			t.next = now.Add(t.interval)
+			go p.probe(ctx, tenantID, t.result.URL, t.result.ExpectedStatus)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// probe requests url once and records the outcome.
+func (p *Prober) probe(ctx context.Context, tenantID, url string, expected int) {
+	start := time.Now()
+	var code int
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = p.client.Do(req); err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			code = resp.StatusCode
+		}
+	}
+
+	p.mu.Lock()
+	t, ok := p.targets[tenantID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	t.inFlight = false
+	if t.result.URL != url || !t.running {
+		p.mu.Unlock()
+		return
+	}
+	r := &t.result
+	now := time.Now().UTC()
+	r.CheckedAt = &now
+	r.LatencyMS = time.Since(start).Milliseconds()
+	r.StatusCode = code
+	r.Error = ""
+	switch {
+	case err != nil:
+		r.Error = err.Error()
+	case code != expected:
+		r.Error = fmt.Sprintf("unexpected status %d", code)
+	}
+	if r.Error == "" {
+		r.Status = StatusHealthy
+		r.Failures = 0
+	} else {
+		r.Status = StatusUnhealthy
+		r.Failures++
+	}
+	t.record(sample{latency: r.LatencyMS, ok: r.Error == ""})
+
+	var change *Change
+	degraded := p.cfg.DegradedAfter > 0 && r.Failures >= p.cfg.DegradedAfter
+	if degraded != r.Degraded {
+		r.Degraded = degraded
+		change = &Change{TenantID: tenantID, Instance: r.Instance, Degraded: degraded}
+		if degraded {
+			change.Detail = fmt.Sprintf("%d consecutive failed health checks, last: %s", r.Failures, r.Error)
+		}
+	}
+	handlers := p.handlers
+	p.mu.Unlock()
+
+	if change != nil {
+		for _, fn := range handlers {
+			fn(*change)
+		}
+	}
+}
+
+// record appends s to the probe history and refreshes the summary figures.
+func (t *target) record(s sample) {
+	t.history = append(t.history, s)
+	if len(t.history) > historySize {
+		t.history = t.history[len(t.history)-historySize:]
+	}
+	latencies := make([]int64, 0, len(t.history))
+	failed := 0
+	for _, h := range t.history {
+		if h.ok {
+			latencies = append(latencies, h.latency)
+		} else {
+			failed++
+		}
+	}
+	t.result.Probes = len(t.history)
+	t.result.FailedProbes = failed
+	t.result.LatencyP50MS = percentile(latencies, 0.5)
+	t.result.LatencyP95MS = percentile(latencies, 0.95)
+}
+
+// percentile returns the q-quantile of values by nearest rank, or zero for
+// none. values is sorted in place.
+func percentile(values []int64, q float64) int64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	i := int(q*float64(len(values))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(values) {
+		i = len(values) - 1
+	}
+	return values[i]
+}
+
+// Result returns the latest probe of the tenant's instance.
+func (p *Prober) Result(tenantID string) (Result, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	t, ok := p.targets[tenantID]
+	if !ok {
+		return Result{}, false
+	}
+	return t.result, true
+}
+
+// Results returns the latest probe of every instance, degraded instances
+// first and then by tenant ID.
+func (p *Prober) Results() []Result {
+	p.mu.Lock()
+	out := make([]Result, 0, len(p.targets))
+	for _, t := range p.targets {
+		out = append(out, t.result)
+	}
+	p.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Degraded != out[j].Degraded {
+			return out[i].Degraded
+		}
+		return out[i].TenantID < out[j].TenantID
+	})
+	return out
+}
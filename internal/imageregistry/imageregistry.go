@@ -0,0 +1,324 @@
+// Package imageregistry is a minimal client for OCI distribution registries
+// (GHCR, Docker Hub, and most private registries). It only implements what
+// the service needs: resolving a tag to a manifest digest and verifying
+// key-based cosign signatures on that digest.
+package imageregistry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manifestTypes are the manifest media types accepted when resolving a tag.
+// Multi-arch indexes come first so that the digest pins every platform.
+var manifestTypes = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// cosignSignatureAnnotation holds a layer's base64 signature in a cosign
+// signature manifest.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// ErrNotFound is returned when a tag or its signatures do not exist.
+var ErrNotFound = errors.New("not found in registry")
+
+// Config holds optional registry credentials, used for every registry host.
+type Config struct {
+	Username string
+	Password string
+}
+
+// Client talks to image registries, caching bearer tokens per host and
+// repository.
+type Client struct {
+	cfg        Config
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // "host/name" -> bearer token
+}
+
+// New returns a Client using cfg's credentials.
+func New(cfg Config) *Client {
+	return &Client{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		tokens:     make(map[string]string),
+	}
+}
+
+// Resolve returns the manifest digest ("sha256:...") that tag currently
+// points to in repository (e.g. "ghcr.io/openclaw/openclaw").
+func (c *Client) Resolve(ctx context.Context, repository, tag string) (string, error) {
+	host, name := splitRepository(repository)
+	resp, err := c.do(ctx, http.MethodHead, host, name, "/manifests/"+tag, manifestTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries omit the digest header on HEAD; hash the manifest.
+	resp, err = c.do(ctx, http.MethodGet, host, name, "/manifests/"+tag, manifestTypes)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", fmt.Errorf("reading manifest: %v", err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParsePublicKey parses a PEM-encoded ECDSA public key, the default cosign
+// key type.
+func ParsePublicKey(data []byte) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %v", err)
+	}
+	ec, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T: only ECDSA keys are supported", key)
+	}
+	return ec, nil
+}
+
+// VerifyCosign checks that digest in repository carries at least one cosign
+// signature made with key over a payload naming that digest. Signatures are
+// looked up at cosign's "sha256-<hex>.sig" tag; transparency-log entries are
+// not checked.
+func (c *Client) VerifyCosign(ctx context.Context, repository, digest string, key *ecdsa.PublicKey) error {
+	host, name := splitRepository(repository)
+	sigTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	resp, err := c.do(ctx, http.MethodGet, host, name, "/manifests/"+sigTag, "application/vnd.oci.image.manifest.v1+json")
+	if errors.Is(err, ErrNotFound) {
+		return fmt.Errorf("no cosign signatures for %s@%s", repository, digest)
+	}
+	if err != nil {
+		return err
+	}
+	var manifest struct {
+		Layers []struct {
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decoding signature manifest: %v", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		sig, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		payload, err := c.blob(ctx, host, name, layer.Digest)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(payload)
+		if !ecdsa.VerifyASN1(key, sum[:], sig) {
+			continue
+		}
+		var simple struct {
+			Critical struct {
+				Image struct {
+					Digest string `json:"docker-manifest-digest"`
+				} `json:"image"`
+			} `json:"critical"`
+		}
+		if json.Unmarshal(payload, &simple) == nil && simple.Critical.Image.Digest == digest {
+			return nil
+		}
+	}
+	return fmt.Errorf("no cosign signature for %s@%s verifies with the configured key", repository, digest)
+}
+
+// blob fetches a blob and checks it against its digest.
+func (c *Client) blob(ctx context.Context, host, name, digest string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, host, name, "/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %v", digest, err)
+	}
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return data, nil
+}
+
+// do performs a registry API request, authenticating once on a 401. It
+// returns ErrNotFound for a 404 and an error for any other non-2xx status.
+func (c *Client) do(ctx context.Context, method, host, name, path, accept string) (*http.Response, error) {
+	endpoint := "https://" + host + "/v2/" + name + path
+	key := host + "/" + name
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		c.mu.Lock()
+		token := c.tokens[key]
+		c.mu.Unlock()
+		switch {
+		case token != "":
+			req.Header.Set("Authorization", "Bearer "+token)
+		case c.cfg.Username != "":
+			req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %v", method, endpoint, err)
+		}
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.authenticate(ctx, key, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			return nil, ErrNotFound
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("%s %s: status %d: %s", method, endpoint, resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return resp, nil
+	}
+}
+
+// authenticate obtains a bearer token for key from the realm named in a
+// "Bearer" WWW-Authenticate challenge, using the configured credentials if
+// any (anonymous tokens suffice for public images).
+func (c *Client) authenticate(ctx context.Context, key, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		return fmt.Errorf("registry requires %q authentication, which is not supported", scheme)
+	}
+	u, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("invalid token realm %q: %v", params["realm"], err)
+	}
+	q := u.Query()
+	if v := params["service"]; v != "" {
+		q.Set("service", v)
+	}
+	if v := params["scope"]; v != "" {
+		q.Set("scope", v)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting registry token: status %d", resp.StatusCode)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("decoding registry token: %v", err)
+	}
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return fmt.Errorf("registry returned an empty token")
+	}
+	c.mu.Lock()
+	c.tokens[key] = token
+	c.mu.Unlock()
+	return nil
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io"` into its scheme
+// and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var kv string
+		rest = strings.TrimLeft(rest, " ,")
+		k, v, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(v, `"`) {
+			end := strings.Index(v[1:], `"`)
+			if end < 0 {
+				break
+			}
+			kv, rest = v[1:end+1], v[end+2:]
+		} else {
+			kv, rest, _ = strings.Cut(v, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(k))] = kv
+	}
+	return scheme, params
+}
+
+// splitRepository returns the registry host and repository name, applying
+// Docker Hub's defaults to names without a registry host.
+func splitRepository(repository string) (host, name string) {
+	first, rest, ok := strings.Cut(repository, "/")
+	if ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return first, rest
+	}
+	if !ok {
+		return "registry-1.docker.io", "library/" + repository
+	}
+	return "registry-1.docker.io", repository
+}
@@ -0,0 +1,123 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// adoptionPatch labels an existing OpenClawInstance as the tenant's, the
+// way CreateInstance labels the instances it creates, so that every
+// endpoint, the watch and the registry treat it as any other instance. The
+// spec, and with it the gateway token, is left as it is.
+func adoptionPatch(cfg *config.Config, tenantID string, opts CreateOptions, current map[string]string) map[string]interface{} {
+	labels := map[string]interface{}{
+		"tenant": tenantID,
+		"app":    "tenant-instance",
+	}
+	if opts.Plan != "" {
+		labels["plan"] = opts.Plan
+	}
+	if opts.Channel != "" {
+		labels["channel"] = opts.Channel
+	}
+	if opts.Organization != "" {
+		labels[orgLabel] = opts.Organization
+	}
+	// An instance created without an environment label is served as a
+	// production one; only an explicit environment is recorded.
+	if opts.Environment != "" && current[environmentLabel] == "" {
+		labels[environmentLabel] = opts.Environment
+	}
+	for k, v := range costLabels(cfg, tenantID, opts) {
+		labels[k] = v
+	}
+	metadata := map[string]interface{}{"labels": labels}
+	if opts.ContactEmail != "" {
+		metadata["annotations"] = map[string]interface{}{contactEmailAnnotation: opts.ContactEmail}
+	}
+	return map[string]interface{}{"metadata": metadata}
+}
+
+// checkAdoption decides whether the instance, labelled with current, can be
+// adopted by the tenant. It returns adopt=false when the instance is the
+// tenant's already.
+func checkAdoption(instanceName, tenantID string, current map[string]string) (adopt bool, err error) {
+	switch owner := current["tenant"]; owner {
+	case "":
+		return true, nil
+	case tenantID:
+		return false, nil
+	default:
+		return false, &InvalidSpecError{Message: fmt.Sprintf("instance %s belongs to another tenant", instanceName)}
+	}
+}
+
+// AdoptInstance takes over an existing OpenClawInstance created outside the
+// service, such as by a legacy provisioning system, as an instance of the
+// tenant. It returns ErrNotFound when there is no such instance, and an
+// *InvalidSpecError when it belongs to another tenant. When the instance
+// is the tenant's already, it is returned unchanged with adopted=false, so
+// that adopting again is harmless. With opts.DryRun the patch is only
+// validated server-side.
+func (m *Manager) AdoptInstance(ctx context.Context, tenantID, instanceName string, opts CreateOptions) (*InstanceInfo, bool, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	resource := m.clientFor(ctx).Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	item, err := resource.Get(ctx, instanceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, false, ErrNotFound
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("reading instance %s: %v", instanceName, err)
+	}
+	adopt, err := checkAdoption(instanceName, tenantID, item.GetLabels())
+	if err != nil || !adopt {
+		m.current().adapter.decode(item)
+		return m.instanceInfo(item), false, err
+	}
+
+	patch := adoptionPatch(m.cfg, tenantID, opts, item.GetLabels())
+	stampPatch(ctx, patch)
+	raw, err := json.Marshal(patch)
+	if err != nil {
+		return nil, false, fmt.Errorf("encoding patch: %v", err)
+	}
+	patchOpts := metav1.PatchOptions{}
+	if opts.DryRun {
+		patchOpts.DryRun = []string{metav1.DryRunAll}
+	}
+	adopted, err := resource.Patch(ctx, instanceName, types.MergePatchType, raw, patchOpts)
+	if err != nil {
+		return nil, false, fmt.Errorf("adopting instance %s: %v", instanceName, err)
+	}
+	m.current().adapter.decode(adopted)
+	return m.instanceInfo(adopted), true, nil
+}
+
+// AdoptInstance reports on the fake instance with the given name. Fake
+// instances are only created through CreateInstance and so always belong to
+// a tenant; adopting one succeeds only for that tenant, as a no-op.
+func (f *FakeManager) AdoptInstance(ctx context.Context, tenantID, instanceName string, opts CreateOptions) (*InstanceInfo, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	inst, ok := f.instances[instanceName]
+	if !ok {
+		return nil, false, ErrNotFound
+	}
+	if _, err := checkAdoption(instanceName, tenantID, map[string]string{"tenant": inst.tenantID}); err != nil {
+		return nil, false, err
+	}
+	info := inst.info
+	return &info, false, nil
+}
@@ -0,0 +1,26 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// CheckAnnotation reports why a create request may not set the annotation
+// key, or nil if it may: the key must be a valid annotation key starting
+// with one of allowed, and not be one the orchestrator writes.
+func CheckAnnotation(key string, allowed []string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("%q is not a valid annotation key: %s", key, errs[0])
+	}
+	if strings.HasPrefix(key, annotationPrefix) {
+		return fmt.Errorf("%s is set by the orchestrator", key)
+	}
+	for _, prefix := range allowed {
+		if strings.HasPrefix(key, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not start with an allowed prefix", key)
+}
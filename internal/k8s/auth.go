@@ -0,0 +1,74 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// workloadIdentityConfig builds a rest.Config that authenticates with
+// short-lived credentials rather than a stored kubeconfig:
+//
+//   - "token-file": a bearer token file that is re-read as it rotates, e.g. a
+//     projected service account token federated with the cluster.
+//   - "exec": an arbitrary client-go credential plugin.
+//   - "gke", "eks", "doks": the managed-cluster credential plugins, which pick
+//     up GKE Workload Identity, EKS IRSA (AWS_WEB_IDENTITY_TOKEN_FILE) or a
+//     DigitalOcean API token (DIGITALOCEAN_ACCESS_TOKEN) from the environment.
+//
+// The plugin binaries must be present in the image.
+func workloadIdentityConfig(cfg *config.Config) (*rest.Config, error) {
+	if cfg.KubeAPIServer == "" {
+		return nil, fmt.Errorf("KUBE_API_SERVER is required for KUBE_AUTH_MODE=%s", cfg.KubeAuthMode)
+	}
+
+	restCfg := &rest.Config{Host: cfg.KubeAPIServer}
+	if cfg.KubeCAData != "" {
+		ca, err := base64.StdEncoding.DecodeString(cfg.KubeCAData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode KUBE_CA_DATA: %v", err)
+		}
+		restCfg.TLSClientConfig.CAData = ca
+	}
+
+	command, args := cfg.KubeExecCommand, cfg.KubeExecArgs
+	switch cfg.KubeAuthMode {
+	case "token-file":
+		if cfg.KubeTokenFile == "" {
+			return nil, fmt.Errorf("KUBE_TOKEN_FILE is required for KUBE_AUTH_MODE=token-file")
+		}
+		restCfg.BearerTokenFile = cfg.KubeTokenFile
+		return restCfg, nil
+	case "exec":
+		if command == "" {
+			return nil, fmt.Errorf("KUBE_EXEC_COMMAND is required for KUBE_AUTH_MODE=exec")
+		}
+	case "gke":
+		command, args = "gke-gcloud-auth-plugin", nil
+	case "eks":
+		if cfg.KubeClusterName == "" {
+			return nil, fmt.Errorf("KUBE_CLUSTER_NAME is required for KUBE_AUTH_MODE=eks")
+		}
+		command, args = "aws", []string{"eks", "get-token", "--output", "json", "--cluster-name", cfg.KubeClusterName}
+	case "doks":
+		if cfg.KubeClusterName == "" {
+			return nil, fmt.Errorf("KUBE_CLUSTER_NAME is required for KUBE_AUTH_MODE=doks")
+		}
+		command, args = "doctl", []string{"kubernetes", "cluster", "kubeconfig", "exec-credential",
+			"--version=v1beta1", cfg.KubeClusterName}
+	default:
+		return nil, fmt.Errorf("unknown KUBE_AUTH_MODE %q", cfg.KubeAuthMode)
+	}
+
+	restCfg.ExecProvider = &clientcmdapi.ExecConfig{
+		Command:         command,
+		Args:            args,
+		APIVersion:      cfg.KubeExecAPIVersion,
+		InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+	}
+	return restCfg, nil
+}
@@ -0,0 +1,34 @@
+package k8s
+
+// Branding is a reseller's white-label branding of an instance, written into
+// its OpenClaw configuration. Empty fields keep OpenClaw's own.
+type Branding struct {
+	ProductName string // ui.assistant.name
+	LogoURL     string // ui.assistant.avatar
+	ThemeColor  string // ui.seamColor, as #RRGGBB
+}
+
+// withBranding sets the branded settings in the spec's config.raw block,
+// over any the tenant's config.raw override set.
+func withBranding(spec map[string]interface{}, b *Branding) {
+	raw := map[string]interface{}{}
+	ui := map[string]interface{}{}
+	assistant := map[string]interface{}{}
+	if b.ProductName != "" {
+		assistant["name"] = b.ProductName
+	}
+	if b.LogoURL != "" {
+		assistant["avatar"] = b.LogoURL
+	}
+	if len(assistant) > 0 {
+		ui["assistant"] = assistant
+	}
+	if b.ThemeColor != "" {
+		ui["seamColor"] = b.ThemeColor
+	}
+	if len(ui) == 0 {
+		return
+	}
+	raw["ui"] = ui
+	withRawConfig(spec, raw)
+}
@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+var (
+	cacheHits   = expvar.NewInt("instance_cache_hits")
+	cacheMisses = expvar.NewInt("instance_cache_misses")
+)
+
+// instanceCache memoises GetInstance results per tenant and instance
+// selection (see selectionKey) for a fixed TTL.
+// Entries are dropped early on mutations and watch events. A nil cache (TTL
+// of zero) disables caching.
+type instanceCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string]cacheEntry // by tenant ID, then selection
+}
+
+type cacheEntry struct {
+	info    *InstanceInfo // nil records that the tenant has no instance
+	expires time.Time
+}
+
+func newInstanceCache(ttl time.Duration) *instanceCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &instanceCache{
+		ttl:     ttl,
+		entries: make(map[string]map[string]cacheEntry),
+	}
+}
+
+// get returns the cached info for tenantID and selection and whether it was
+// present.
+func (c *instanceCache) get(tenantID, selection string) (*InstanceInfo, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[tenantID][selection]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries[tenantID], selection)
+		cacheMisses.Add(1)
+		return nil, false
+	}
+	cacheHits.Add(1)
+	if e.info == nil {
+		return nil, true
+	}
+	info := *e.info
+	return &info, true
+}
+
+// put stores info for tenantID and selection.
+func (c *instanceCache) put(tenantID, selection string, info *InstanceInfo) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sweep expired entries opportunistically so tenants that are polled once
+	// and never again do not accumulate.
+	now := time.Now()
+	if len(c.entries) > 1024 {
+		for tenant, entries := range c.entries {
+			for k, e := range entries {
+				if now.After(e.expires) {
+					delete(entries, k)
+				}
+			}
+			if len(entries) == 0 {
+				delete(c.entries, tenant)
+			}
+		}
+	}
+	if c.entries[tenantID] == nil {
+		c.entries[tenantID] = make(map[string]cacheEntry)
+	}
+	c.entries[tenantID][selection] = cacheEntry{info: info, expires: now.Add(c.ttl)}
+}
+
+// invalidate drops every cached entry for tenantID.
+func (c *instanceCache) invalidate(tenantID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	delete(c.entries, tenantID)
+	c.mu.Unlock()
+}
+
+// clear drops every cached entry.
+func (c *instanceCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.entries = make(map[string]map[string]cacheEntry)
+	c.mu.Unlock()
+}
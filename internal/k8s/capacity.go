@@ -0,0 +1,222 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// capacityLimits are the parsed namespace ceilings. Zero means unlimited.
+type capacityLimits struct {
+	instances int64
+	cpu       resource.Quantity
+	memory    resource.Quantity
+}
+
+// parseCapacityLimits validates the capacity settings in cfg.
+func parseCapacityLimits(cfg *config.Config) (capacityLimits, error) {
+	limits := capacityLimits{instances: int64(cfg.CapacityMaxInstances)}
+	if cfg.CapacityMaxCPU != "" {
+		q, err := resource.ParseQuantity(cfg.CapacityMaxCPU)
+		if err != nil {
+			return limits, fmt.Errorf("invalid CAPACITY_MAX_CPU %q: %v", cfg.CapacityMaxCPU, err)
+		}
+		limits.cpu = q
+	}
+	if cfg.CapacityMaxMemory != "" {
+		q, err := resource.ParseQuantity(cfg.CapacityMaxMemory)
+		if err != nil {
+			return limits, fmt.Errorf("invalid CAPACITY_MAX_MEMORY %q: %v", cfg.CapacityMaxMemory, err)
+		}
+		limits.memory = q
+	}
+	return limits, nil
+}
+
+// ResourceUsage is the consumption of one capacity dimension.
+type ResourceUsage struct {
+	Resource string  `json:"resource"` // "instances", "cpu" or "memory"
+	Used     string  `json:"used"`
+	Limit    string  `json:"limit,omitempty"` // Empty when unlimited
+	Ratio    float64 `json:"ratio,omitempty"` // Used/Limit; 0 when unlimited
+}
+
+// CapacityReport summarises namespace usage against the configured ceilings.
+type CapacityReport struct {
+	Namespace string          `json:"namespace"`
+	Resources []ResourceUsage `json:"resources"`
+}
+
+// CapacityError is returned by CreateInstance when the new instance would take
+// the namespace past a ceiling.
+type CapacityError struct {
+	Resource  string
+	Used      string
+	Requested string
+	Limit     string
+}
+
+func (e *CapacityError) Error() string {
+	return fmt.Sprintf("capacity exceeded: %s in use is %s of %s and the new instance needs %s",
+		e.Resource, e.Used, e.Limit, e.Requested)
+}
+
+// usage holds raw totals in base units: instances, CPU millicores and memory
+// bytes.
+type usage struct {
+	instances, cpuMilli, memory int64
+}
+
+// instanceRequests returns the CPU and memory requested by one instance spec.
+func instanceRequests(obj map[string]interface{}) usage {
+	u := usage{instances: 1}
+	if v, found, _ := unstructured.NestedString(obj, "spec", "resources", "requests", "cpu"); found {
+		if q, err := resource.ParseQuantity(v); err == nil {
+			u.cpuMilli = q.MilliValue()
+		}
+	}
+	if v, found, _ := unstructured.NestedString(obj, "spec", "resources", "requests", "memory"); found {
+		if q, err := resource.ParseQuantity(v); err == nil {
+			u.memory = q.Value()
+		}
+	}
+	return u
+}
+
+// namespaceUsage totals the requests of every instance in the namespace. It
+// runs as the service account because callers need not be able to list
+// other tenants' instances.
+func (m *Manager) namespaceUsage(ctx context.Context) (usage, error) {
+	list, err := m.current().client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=tenant-instance",
+	})
+	if err != nil {
+		return usage{}, fmt.Errorf("listing instances for capacity: %v", err)
+	}
+	var total usage
+	for i := range list.Items {
+		m.current().adapter.decode(&list.Items[i])
+		u := instanceRequests(list.Items[i].Object)
+		total.instances += u.instances
+		total.cpuMilli += u.cpuMilli
+		total.memory += u.memory
+	}
+	return total, nil
+}
+
+// capacityDimension is one ceiling evaluated against a usage total.
+type capacityDimension struct {
+	name             string
+	used, add, limit int64
+	format           func(int64) string
+}
+
+// dimensions pairs each configured ceiling with its current and added usage.
+func (m *Manager) dimensions(used, add usage) []capacityDimension {
+	count := func(n int64) string { return strconv.FormatInt(n, 10) }
+	milli := func(n int64) string { return resource.NewMilliQuantity(n, resource.DecimalSI).String() }
+	bytes := func(n int64) string { return resource.NewQuantity(n, resource.BinarySI).String() }
+	return []capacityDimension{
+		{"instances", used.instances, add.instances, m.capacity.instances, count},
+		{"cpu", used.cpuMilli, add.cpuMilli, m.capacity.cpu.MilliValue(), milli},
+		{"memory", used.memory, add.memory, m.capacity.memory.Value(), bytes},
+	}
+}
+
+// Capacity reports current namespace usage against the configured ceilings.
+func (m *Manager) Capacity(ctx context.Context) (*CapacityReport, error) {
+	used, err := m.namespaceUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &CapacityReport{Namespace: m.cfg.Namespace}
+	for _, d := range m.dimensions(used, usage{}) {
+		ru := ResourceUsage{Resource: d.name, Used: d.format(d.used)}
+		if d.limit > 0 {
+			ru.Limit = d.format(d.limit)
+			ru.Ratio = float64(d.used) / float64(d.limit)
+		}
+		report.Resources = append(report.Resources, ru)
+		m.evaluateAlert(d.name, ru)
+	}
+	return report, nil
+}
+
+// checkCapacity refuses instance if adding it would exceed a ceiling, with
+// the capacity held by reservations counted as used, and raises an alert for
+// any ceiling the addition takes past the threshold.
+func (m *Manager) checkCapacity(ctx context.Context, instance *unstructured.Unstructured, held usage) error {
+	if m.capacity == (capacityLimits{}) {
+		return nil
+	}
+	used, err := m.namespaceUsage(ctx)
+	if err != nil {
+		return err
+	}
+	used.instances += held.instances
+	used.cpuMilli += held.cpuMilli
+	used.memory += held.memory
+	add := instanceRequests(instance.Object)
+	for _, d := range m.dimensions(used, add) {
+		if d.limit <= 0 {
+			continue
+		}
+		if d.used+d.add > d.limit {
+			return &CapacityError{
+				Resource:  d.name,
+				Used:      d.format(d.used),
+				Requested: d.format(d.add),
+				Limit:     d.format(d.limit),
+			}
+		}
+		m.evaluateAlert(d.name, ResourceUsage{
+			Resource: d.name,
+			Used:     d.format(d.used + d.add),
+			Limit:    d.format(d.limit),
+			Ratio:    float64(d.used+d.add) / float64(d.limit),
+		})
+	}
+	return nil
+}
+
+// OnCapacityAlert registers fn to be called when usage of a ceiling crosses
+// CAPACITY_ALERT_THRESHOLD. Each dimension alerts once per crossing and is
+// re-armed when usage falls back below the threshold.
+func (m *Manager) OnCapacityAlert(fn func(ResourceUsage)) {
+	m.mu.Lock()
+	m.capacityHandlers = append(m.capacityHandlers, fn)
+	m.mu.Unlock()
+}
+
+// evaluateAlert fires or re-arms the alert for one dimension.
+func (m *Manager) evaluateAlert(name string, ru ResourceUsage) {
+	if ru.Limit == "" {
+		return
+	}
+	above := ru.Ratio >= m.cfg.CapacityAlertThreshold
+
+	m.mu.Lock()
+	if m.capacityAlerted == nil {
+		m.capacityAlerted = make(map[string]bool)
+	}
+	fire := above && !m.capacityAlerted[name]
+	m.capacityAlerted[name] = above
+	handlers := append([]func(ResourceUsage){}, m.capacityHandlers...)
+	m.mu.Unlock()
+
+	if !fire {
+		return
+	}
+	log.Printf("capacity alert: %s at %.0f%% (%s of %s) in namespace %s",
+		name, ru.Ratio*100, ru.Used, ru.Limit, m.cfg.Namespace)
+	for _, fn := range handlers {
+		fn(ru)
+	}
+}
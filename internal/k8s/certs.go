@@ -0,0 +1,221 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// clusterIssuerAnnotation asks cert-manager's ingress-shim to issue the
+// ingress's TLS certificate.
+const clusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+
+var (
+	orderGVR     = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "orders"}
+	challengeGVR = schema.GroupVersionResource{Group: "acme.cert-manager.io", Version: "v1", Resource: "challenges"}
+)
+
+// CertificateStatus describes the TLS certificate of an instance.
+type CertificateStatus struct {
+	Instance string
+	Name     string // Certificate and Secret name
+	Managed  bool   // Issued by cert-manager; false once on the wildcard certificate
+	Ready    bool
+	Failed   bool   // Issuance failed; cert-manager backs off before trying again
+	Message  string // Why the certificate is not ready, including any ACME error
+}
+
+// CertificateStatus reports the state of the tenant's TLS certificate, and
+// returns ErrNotFound if the tenant has no instance.
+func (m *Manager) CertificateStatus(ctx context.Context, tenantID string) (*CertificateStatus, error) {
+	client := m.readerFor(ctx)
+	instance, err := m.tenantInstance(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return m.certificateStatus(ctx, client, instance)
+}
+
+// RetryCertificate deletes the tenant's Certificate, together with its
+// requests, orders and challenges, so that ingress-shim re-creates it and
+// issuance starts again without cert-manager's failure backoff.
+func (m *Manager) RetryCertificate(ctx context.Context, tenantID string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	client := m.clientFor(ctx)
+	instance, err := m.tenantInstance(ctx, client, tenantID)
+	if err != nil {
+		return err
+	}
+	name, managed := ingressProviderFor(m.cfg).certificate(ctx, client, instance)
+	if !managed {
+		return fmt.Errorf("instance %s does not use a cert-manager certificate", instance.GetName())
+	}
+	err = client.Resource(certificateGVR).Namespace(m.cfg.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting certificate %s: %v", name, err)
+	}
+	return nil
+}
+
+// UseWildcardCertificate points the tenant's ingress, or its Gateway, at
+// secretName, an existing wildcard certificate for the instance domain, and
+// stops cert-manager from issuing a certificate of its own.
+func (m *Manager) UseWildcardCertificate(ctx context.Context, tenantID, secretName string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if m.cfg.IngressProvider == IngressGatewayAPI && m.cfg.IngressGatewayTLS == GatewayTLSCertManager {
+		client := m.clientFor(ctx)
+		instance, err := m.tenantInstance(ctx, client, tenantID)
+		if err != nil {
+			return err
+		}
+		return m.useWildcardGateway(ctx, client, instance.GetName(), secretName)
+	}
+	return m.patchLockedInstances(ctx, tenantID, func(instance *unstructured.Unstructured) (map[string]interface{}, error) {
+		return wildcardPatch(instance, m.cfg.Domain, secretName), nil
+	})
+}
+
+// wildcardPatch replaces the instance's ingress TLS secret with secretName
+// and removes the cert-manager annotation.
+func wildcardPatch(instance *unstructured.Unstructured, domain, secretName string) map[string]interface{} {
+	hosts := []interface{}{instanceHost(domain, instance.GetName(), instanceEnvironment(instance.GetLabels()))}
+	tls, _, _ := unstructured.NestedSlice(instance.Object, "spec", "networking", "ingress", "tls")
+	if len(tls) > 0 {
+		if entry, ok := tls[0].(map[string]interface{}); ok {
+			if h, ok := entry["hosts"].([]interface{}); ok {
+				hosts = h
+			}
+		}
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"networking": map[string]interface{}{
+				"ingress": map[string]interface{}{
+					"annotations": map[string]interface{}{clusterIssuerAnnotation: nil},
+					"tls":         []interface{}{map[string]interface{}{"hosts": hosts, "secretName": secretName}},
+				},
+			},
+		},
+	}
+}
+
+// tenantInstance returns the tenant's instance selected by ctx, or its
+// default one, in the canonical version, or ErrNotFound.
+func (m *Manager) tenantInstance(ctx context.Context, client dynamic.Interface, tenantID string) (*unstructured.Unstructured, error) {
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	instance := &list.Items[0]
+	m.current().adapter.decode(instance)
+	return instance, nil
+}
+
+// ingressCertificate returns the TLS secret named in the instance's ingress
+// spec, which ingress-shim also uses as the Certificate name, and whether
+// cert-manager issues it.
+func ingressCertificate(instance *unstructured.Unstructured) (string, bool) {
+	var name string
+	tls, _, _ := unstructured.NestedSlice(instance.Object, "spec", "networking", "ingress", "tls")
+	if len(tls) > 0 {
+		if entry, ok := tls[0].(map[string]interface{}); ok {
+			name, _ = entry["secretName"].(string)
+		}
+	}
+	issuer, _, _ := unstructured.NestedString(instance.Object, "spec", "networking", "ingress", "annotations", clusterIssuerAnnotation)
+	return name, name != "" && issuer != ""
+}
+
+// certificateStatus reads the instance's Certificate and, while it is not
+// ready, its newest ACME order and challenges for the underlying error.
+func (m *Manager) certificateStatus(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured) (*CertificateStatus, error) {
+	ns := m.cfg.Namespace
+	name, managed := ingressProviderFor(m.cfg).certificate(ctx, client, instance)
+	status := &CertificateStatus{Instance: instance.GetName(), Name: name, Managed: managed}
+	if !managed {
+		status.Ready = true
+		return status, nil
+	}
+
+	cert, err := client.Resource(certificateGVR).Namespace(ns).Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		status.Message = "certificate not created yet"
+		return status, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading certificate %s: %v", name, err)
+	}
+	ready, message := conditionStatus(cert, "Ready")
+	if ready == "True" {
+		status.Ready = true
+		return status, nil
+	}
+	status.Message = message
+	if failure, _, _ := unstructured.NestedString(cert.Object, "status", "lastFailureTime"); failure != "" {
+		status.Failed = true
+		if _, msg := conditionStatus(cert, "Issuing"); msg != "" {
+			status.Message = msg
+		}
+	}
+
+	// The ACME error itself is only recorded on the order and its
+	// challenges, which are named after the certificate request
+	// ("<certificate>-<n>") and the order respectively.
+	order := newestWithPrefix(ctx, client, orderGVR, ns, name+"-")
+	if order == nil {
+		return status, nil
+	}
+	state, _, _ := unstructured.NestedString(order.Object, "status", "state")
+	reason, _, _ := unstructured.NestedString(order.Object, "status", "reason")
+	if state == "invalid" || state == "errored" {
+		status.Failed = true
+		if reason != "" {
+			status.Message = "ACME order " + state + ": " + reason
+		}
+	}
+	if challenge := newestWithPrefix(ctx, client, challengeGVR, ns, order.GetName()+"-"); challenge != nil {
+		if reason, _, _ := unstructured.NestedString(challenge.Object, "status", "reason"); reason != "" {
+			status.Message = "ACME challenge: " + reason
+		}
+	}
+	return status, nil
+}
+
+// newestWithPrefix returns the most recently created object of gvr whose
+// name starts with prefix, or nil if there is none or they cannot be listed.
+func newestWithPrefix(ctx context.Context, client dynamic.Interface, gvr schema.GroupVersionResource, ns, prefix string) *unstructured.Unstructured {
+	list, err := client.Resource(gvr).Namespace(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+	var newest *unstructured.Unstructured
+	for i := range list.Items {
+		item := &list.Items[i]
+		if !strings.HasPrefix(item.GetName(), prefix) {
+			continue
+		}
+		if newest == nil || item.GetCreationTimestamp().After(newest.GetCreationTimestamp().Time) {
+			newest = item
+		}
+	}
+	return newest
+}
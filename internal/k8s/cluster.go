@@ -0,0 +1,243 @@
+package k8s
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/client-go/util/homedir"
+)
+
+// clusterTarget is one cluster endpoint the Manager can talk to. Mutations
+// go through client and reads through reader, which have separate
+// client-side rate limiters; readCfg and writeCfg are their configs.
+type clusterTarget struct {
+	name       string
+	restCfg    *rest.Config
+	readCfg    *rest.Config
+	writeCfg   *rest.Config
+	client     dynamic.Interface
+	reader     dynamic.Interface
+	httpClient *http.Client // Authenticated client for raw API server requests
+	adapter    crdAdapter   // Negotiated OpenClawInstance version
+}
+
+// current returns the active cluster target.
+func (m *Manager) current() *clusterTarget {
+	m.clusterMu.RLock()
+	defer m.clusterMu.RUnlock()
+	return m.targets[m.active]
+}
+
+// healthy reports whether the target's API server answers /readyz.
+func (t *clusterTarget) healthy(ctx context.Context) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(t.restCfg.Host, "/")+"/readyz", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// firstHealthy returns the index of the highest-priority healthy target, or
+// -1 if none is healthy.
+func (m *Manager) firstHealthy(ctx context.Context) int {
+	for i, t := range m.targets {
+		checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		ok := t.healthy(checkCtx)
+		cancel()
+		if ok {
+			return i
+		}
+		log.Printf("cluster context %s is unhealthy", t.name)
+	}
+	return -1
+}
+
+// RunFailover health-checks the configured contexts every
+// cfg.KubeFailoverInterval until ctx is cancelled, switching to the
+// highest-priority healthy context whenever it differs from the active one,
+// once Bootstrap's objects are applied there. This both fails over from an
+// unhealthy context and fails back once a preferred one recovers. It
+// returns immediately with a single context.
+func (m *Manager) RunFailover(ctx context.Context) {
+	if len(m.targets) < 2 {
+		return
+	}
+
+	ticker := time.NewTicker(m.cfg.KubeFailoverInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		i := m.firstHealthy(ctx)
+		if i < 0 {
+			log.Printf("no cluster context is healthy, staying on %s", m.current().name)
+			continue
+		}
+
+		m.clusterMu.RLock()
+		switching := i != m.active
+		m.clusterMu.RUnlock()
+		if switching {
+			// Instances created after the switch need the NetworkPolicies
+			// and mesh enrollment of the new cluster's namespace.
+			if err := m.bootstrapTarget(ctx, m.targets[i]); err != nil {
+				log.Printf("cluster failover to %s: %v, staying on %s", m.targets[i].name, err, m.current().name)
+				continue
+			}
+		}
+
+		m.clusterMu.Lock()
+		prev := m.targets[m.active].name
+		switched := i != m.active
+		m.active = i
+		m.clusterMu.Unlock()
+
+		if switched {
+			// Cached status came from the previous cluster.
+			m.cache.clear()
+			log.Printf("cluster failover: %s -> %s", prev, m.targets[i].name)
+		}
+	}
+}
+
+// loadClusterTargets resolves cluster credentials in order of precedence: an
+// explicit base64 kubeconfig, a kubeconfig-less auth mode, in-cluster config,
+// and finally the local kubeconfig file. Kubeconfig sources yield one target
+// per context in cfg.KubeContexts (or the current context when unset).
+func loadClusterTargets(cfg *config.Config) ([]*clusterTarget, error) {
+	// Try KUBECONFIG_BASE64 first (for App Platform)
+	if cfg.KubeconfigBase64 != "" {
+		kubeconfigBytes, err := base64.StdEncoding.DecodeString(cfg.KubeconfigBase64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode KUBECONFIG_BASE64: %v", err)
+		}
+		apiCfg, err := clientcmd.Load(kubeconfigBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse kubeconfig: %v", err)
+		}
+		return kubeconfigTargets(cfg, apiCfg)
+	}
+
+	// Workload identity / credential plugins, without a stored kubeconfig
+	if cfg.KubeAuthMode != "" {
+		restCfg, err := workloadIdentityConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return singleTarget(cfg, cfg.KubeAuthMode, restCfg)
+	}
+
+	// Try in-cluster config (for when running in K8s)
+	if restCfg, err := rest.InClusterConfig(); err == nil {
+		return singleTarget(cfg, "in-cluster", restCfg)
+	}
+
+	// Fall back to kubeconfig file (for local development)
+	path := cfg.KubeconfigPath
+	if path == "" {
+		path = filepath.Join(homedir.HomeDir(), ".kube", "config")
+	}
+	apiCfg, err := clientcmd.LoadFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig %s: %v", path, err)
+	}
+	return kubeconfigTargets(cfg, apiCfg)
+}
+
+// kubeconfigTargets builds a target for each context in cfg.KubeContexts,
+// in order.
+func kubeconfigTargets(cfg *config.Config, apiCfg *clientcmdapi.Config) ([]*clusterTarget, error) {
+	contexts := cfg.KubeContexts
+	if len(contexts) == 0 {
+		contexts = []string{apiCfg.CurrentContext}
+	}
+
+	targets := make([]*clusterTarget, 0, len(contexts))
+	for _, name := range contexts {
+		if _, ok := apiCfg.Contexts[name]; !ok {
+			return nil, fmt.Errorf("kubeconfig has no context %q", name)
+		}
+		restCfg, err := clientcmd.NewNonInteractiveClientConfig(*apiCfg, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("context %s: %v", name, err)
+		}
+		target, err := newClusterTarget(cfg, name, restCfg)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func singleTarget(cfg *config.Config, name string, restCfg *rest.Config) ([]*clusterTarget, error) {
+	target, err := newClusterTarget(cfg, name, restCfg)
+	if err != nil {
+		return nil, err
+	}
+	return []*clusterTarget{target}, nil
+}
+
+func newClusterTarget(cfg *config.Config, name string, restCfg *rest.Config) (*clusterTarget, error) {
+	writeCfg := limitedConfig(restCfg, cfg.KubeWriteQPS, cfg.KubeWriteBurst)
+	client, err := dynamic.NewForConfig(writeCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s client for %s: %v", name, err)
+	}
+	readCfg := limitedConfig(restCfg, cfg.KubeReadQPS, cfg.KubeReadBurst)
+	if h := newHedger(cfg); h != nil {
+		readCfg.Wrap(h.wrap)
+	}
+	reader, err := dynamic.NewForConfig(readCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create k8s read client for %s: %v", name, err)
+	}
+	httpClient, err := rest.HTTPClientFor(restCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client for %s: %v", name, err)
+	}
+	return &clusterTarget{
+		name:       name,
+		restCfg:    restCfg,
+		readCfg:    readCfg,
+		writeCfg:   writeCfg,
+		client:     client,
+		reader:     reader,
+		httpClient: httpClient,
+		adapter:    crdAdapters[len(crdAdapters)-1],
+	}, nil
+}
+
+// limitedConfig returns a copy of restCfg with its own client-side rate
+// limiter, allowing qps requests per second in bursts of up to burst. The
+// limiter is shared by every client built from the config and its copies,
+// impersonating ones included.
+func limitedConfig(restCfg *rest.Config, qps float64, burst int) *rest.Config {
+	limited := rest.CopyConfig(restCfg)
+	limited.QPS = float32(qps)
+	limited.Burst = burst
+	limited.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(float32(qps), burst)
+	return limited
+}
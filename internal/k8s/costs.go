@@ -0,0 +1,46 @@
+package k8s
+
+import (
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// costLabels returns the cost-allocation labels for a tenant's resources, or
+// nil when they are disabled. Keys share cfg.CostLabelPrefix so that
+// Kubecost/OpenCost can aggregate on them; empty values are omitted.
+func costLabels(cfg *config.Config, tenantID string, opts CreateOptions) map[string]string {
+	if !cfg.CostLabels {
+		return nil
+	}
+	center := opts.CostCenter
+	if center == "" {
+		center = cfg.CostDefaultCenter
+	}
+	labels := map[string]string{}
+	for key, value := range map[string]string{
+		"tenant":      tenantID,
+		"plan":        opts.Plan,
+		"environment": cfg.CostEnvironment,
+		"cost-center": center,
+	} {
+		if value != "" {
+			labels[cfg.CostLabelPrefix+key] = value
+		}
+	}
+	return labels
+}
+
+// inheritCostLabels copies the cost-allocation labels of owner onto labels, so
+// that resources created later for an instance are charged to the same
+// tenant.
+func inheritCostLabels(cfg *config.Config, owner map[string]string, labels map[string]interface{}) {
+	if !cfg.CostLabels {
+		return
+	}
+	for k, v := range owner {
+		if strings.HasPrefix(k, cfg.CostLabelPrefix) {
+			labels[k] = v
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package k8s
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/imageregistry"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// imagePinner resolves image tags to digests so that a moving tag such as
+// "latest" cannot change what a running tenant pulls, and optionally
+// requires a cosign signature on the digest. A nil *imagePinner resolves
+// nothing.
+type imagePinner struct {
+	registry *imageregistry.Client
+	key      *ecdsa.PublicKey // Cosign verification key; signatures are not checked when nil
+}
+
+// newImagePinner returns a pinner when IMAGE_PIN_DIGESTS or COSIGN_PUBLIC_KEY
+// is set, and nil otherwise.
+func newImagePinner(cfg *config.Config) (*imagePinner, error) {
+	if !cfg.ImagePinDigests && cfg.CosignPublicKey == "" {
+		return nil, nil
+	}
+	p := &imagePinner{
+		registry: imageregistry.New(imageregistry.Config{
+			Username: cfg.ImageRegistryUsername,
+			Password: cfg.ImageRegistryPassword,
+		}),
+	}
+	if cfg.CosignPublicKey != "" {
+		pem, err := base64.StdEncoding.DecodeString(cfg.CosignPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("decoding COSIGN_PUBLIC_KEY: %v", err)
+		}
+		if p.key, err = imageregistry.ParsePublicKey(pem); err != nil {
+			return nil, fmt.Errorf("COSIGN_PUBLIC_KEY: %v", err)
+		}
+	}
+	return p, nil
+}
+
+// resolve returns the digest of repository:tag, after verifying its
+// signature when a key is configured. A tag that does not exist or an image
+// that fails verification is reported as an *InvalidSpecError.
+func (p *imagePinner) resolve(ctx context.Context, repository, tag string) (string, error) {
+	if p == nil {
+		return "", nil
+	}
+	digest, err := p.registry.Resolve(ctx, repository, tag)
+	if errors.Is(err, imageregistry.ErrNotFound) {
+		return "", &InvalidSpecError{Message: fmt.Sprintf("image %s:%s does not exist", repository, tag)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving image %s:%s: %v", repository, tag, err)
+	}
+	if p.key != nil {
+		if err := p.registry.VerifyCosign(ctx, repository, digest, p.key); err != nil {
+			return "", &InvalidSpecError{Message: fmt.Sprintf("image %s:%s failed signature verification: %v", repository, tag, err)}
+		}
+	}
+	return digest, nil
+}
+
+// pin records the digest of the instance's image in spec.image.digest, which
+// the operator pulls in preference to the tag. A digest already in the spec,
+// from the image defaults, is kept, and only its signature is checked.
+func (p *imagePinner) pin(ctx context.Context, instance *unstructured.Unstructured) error {
+	if p == nil {
+		return nil
+	}
+	repository, _, _ := unstructured.NestedString(instance.Object, "spec", "image", "repository")
+	if digest, _, _ := unstructured.NestedString(instance.Object, "spec", "image", "digest"); digest != "" {
+		if p.key != nil {
+			if err := p.registry.VerifyCosign(ctx, repository, digest, p.key); err != nil {
+				return &InvalidSpecError{Message: fmt.Sprintf("image %s@%s failed signature verification: %v", repository, digest, err)}
+			}
+		}
+		return nil
+	}
+	tag, _, _ := unstructured.NestedString(instance.Object, "spec", "image", "tag")
+	digest, err := p.resolve(ctx, repository, tag)
+	if err != nil {
+		return err
+	}
+	return unstructured.SetNestedField(instance.Object, digest, "spec", "image", "digest")
+}
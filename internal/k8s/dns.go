@@ -0,0 +1,98 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// dnsLookupTimeout bounds each propagation check.
+const dnsLookupTimeout = 2 * time.Second
+
+// dnsChecker verifies that instance hostnames resolve before an instance is
+// reported running, optionally through a specific public resolver so that
+// cluster DNS caches cannot hide a missing record. A nil *dnsChecker accepts
+// every host.
+type dnsChecker struct {
+	resolver *net.Resolver
+	owner    string // external-dns owner ID whose TXT record must exist; not checked when empty
+
+	mu       sync.Mutex
+	verified map[string]bool // Hosts that have resolved once; they are not checked again
+}
+
+// newDNSChecker returns a checker when DNS_CHECK_ENABLED is set, and nil
+// otherwise.
+func newDNSChecker(cfg *config.Config) *dnsChecker {
+	if !cfg.DNSCheckEnabled {
+		return nil
+	}
+	c := &dnsChecker{resolver: net.DefaultResolver, owner: cfg.DNSCheckTXTOwner, verified: make(map[string]bool)}
+	if server := cfg.DNSCheckResolver; server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		c.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return c
+}
+
+// check returns "" once host resolves, and external-dns's ownership record
+// for it exists when an owner is configured, or why it does not yet.
+func (c *dnsChecker) check(ctx context.Context, host string) string {
+	if c == nil {
+		return ""
+	}
+	c.mu.Lock()
+	done := c.verified[host]
+	c.mu.Unlock()
+	if done {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsLookupTimeout)
+	defer cancel()
+	if _, err := c.resolver.LookupHost(ctx, host); err != nil {
+		return fmt.Sprintf("%s does not resolve yet: %v", host, err)
+	}
+	if c.owner != "" && !c.ownedByExternalDNS(ctx, host) {
+		return fmt.Sprintf("no external-dns ownership record for %s with owner %q", host, c.owner)
+	}
+
+	c.mu.Lock()
+	c.verified[host] = true
+	c.mu.Unlock()
+	return ""
+}
+
+// ownedByExternalDNS looks for the TXT record external-dns's TXT registry
+// writes next to the records it manages, under both the legacy name (the
+// host itself) and the current per-type names.
+func (c *dnsChecker) ownedByExternalDNS(ctx context.Context, host string) bool {
+	want := "external-dns/owner=" + c.owner
+	for _, name := range []string{host, "a-" + host, "cname-" + host} {
+		records, err := c.resolver.LookupTXT(ctx, name)
+		if err != nil {
+			continue
+		}
+		for _, r := range records {
+			for _, field := range strings.Split(r, ",") {
+				if field == want {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package k8s
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// egressPolicyName is the NetworkPolicy confining instance egress to DNS and
+// the egress proxy.
+const egressPolicyName = "restrict-egress"
+
+// CheckEgressProxy validates the egress proxy settings of cfg.
+func CheckEgressProxy(cfg *config.Config) error {
+	if cfg.EgressProxyURL == "" {
+		if cfg.EgressProxyEnforce {
+			return fmt.Errorf("EGRESS_PROXY_ENFORCE requires EGRESS_PROXY_URL")
+		}
+		return nil
+	}
+	if _, err := proxyPort(cfg.EgressProxyURL); err != nil {
+		return fmt.Errorf("EGRESS_PROXY_URL: %v", err)
+	}
+	if cfg.EgressProxyEnforce && cfg.EgressProxyNamespace == "" && net.ParseIP(proxyHost(cfg.EgressProxyURL)) == nil {
+		return fmt.Errorf("EGRESS_PROXY_ENFORCE requires EGRESS_PROXY_NAMESPACE unless the proxy is addressed by IP")
+	}
+	return nil
+}
+
+// proxyPort checks an egress proxy URL and returns its port, the scheme's
+// default port when it has none.
+func proxyPort(raw string) (int64, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return 0, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return 0, fmt.Errorf("scheme must be http or https")
+	}
+	if u.Hostname() == "" {
+		return 0, fmt.Errorf("no host")
+	}
+	if u.User != nil {
+		return 0, fmt.Errorf("credentials are set per tenant, not in the URL")
+	}
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			return 443, nil
+		}
+		return 80, nil
+	}
+	return strconv.ParseInt(u.Port(), 10, 64)
+}
+
+// egressProxyURL returns the proxy URL an instance of the tenant uses. With
+// EGRESS_PROXY_SECRET set, the tenant ID is the username and its hex
+// HMAC-SHA256 under the secret the password, so that the proxy can
+// attribute, and authenticate, each request to a tenant.
+func egressProxyURL(cfg *config.Config, tenantID string) string {
+	u, err := url.Parse(cfg.EgressProxyURL)
+	if err != nil || cfg.EgressProxySecret == "" {
+		return cfg.EgressProxyURL
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.EgressProxySecret))
+	mac.Write([]byte(tenantID))
+	u.User = url.UserPassword(tenantID, hex.EncodeToString(mac.Sum(nil)))
+	return u.String()
+}
+
+// egressEnv returns the proxy environment of an instance of the tenant. Both
+// spellings are set since tools disagree on case, and NODE_USE_ENV_PROXY
+// makes Node's built-in fetch honour them.
+func egressEnv(cfg *config.Config, tenantID string) []interface{} {
+	proxy := egressProxyURL(cfg, tenantID)
+	var env []interface{}
+	for _, v := range [][2]string{
+		{"HTTP_PROXY", proxy}, {"HTTPS_PROXY", proxy}, {"NO_PROXY", cfg.EgressNoProxy},
+		{"http_proxy", proxy}, {"https_proxy", proxy}, {"no_proxy", cfg.EgressNoProxy},
+		{"NODE_USE_ENV_PROXY", "1"},
+	} {
+		env = append(env, map[string]interface{}{"name": v[0], "value": v[1]})
+	}
+	return env
+}
+
+// egressPolicy returns the restrict-egress NetworkPolicy, which only lets
+// instance pods resolve names and reach the egress proxy, so that AI
+// provider traffic cannot bypass it.
+func egressPolicy(namespace string, cfg *config.Config) *unstructured.Unstructured {
+	port, _ := proxyPort(cfg.EgressProxyURL)
+	proxy := map[string]interface{}{
+		"to": []interface{}{
+			map[string]interface{}{
+				"namespaceSelector": map[string]interface{}{
+					"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": cfg.EgressProxyNamespace},
+				},
+			},
+		},
+		"ports": []interface{}{
+			map[string]interface{}{"port": port, "protocol": "TCP"},
+		},
+	}
+	if ip := net.ParseIP(proxyHost(cfg.EgressProxyURL)); ip != nil {
+		// A proxy addressed by IP may run outside the cluster.
+		proxy["to"] = []interface{}{
+			map[string]interface{}{"ipBlock": map[string]interface{}{"cidr": ip.String() + hostMask(ip)}},
+		}
+	}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "NetworkPolicy",
+			"metadata": map[string]interface{}{
+				"name":      egressPolicyName,
+				"namespace": namespace,
+			},
+			"spec": map[string]interface{}{
+				"podSelector": openclawPods(),
+				"policyTypes": []interface{}{"Egress"},
+				"egress": []interface{}{
+					map[string]interface{}{
+						"to": []interface{}{
+							map[string]interface{}{
+								"namespaceSelector": map[string]interface{}{
+									"matchLabels": map[string]interface{}{"kubernetes.io/metadata.name": "kube-system"},
+								},
+							},
+						},
+						"ports": []interface{}{
+							map[string]interface{}{"port": int64(53), "protocol": "UDP"},
+							map[string]interface{}{"port": int64(53), "protocol": "TCP"},
+						},
+					},
+					proxy,
+				},
+			},
+		},
+	}
+}
+
+// proxyHost returns the host of the proxy URL.
+func proxyHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// hostMask returns the prefix length selecting exactly ip.
+func hostMask(ip net.IP) string {
+	if ip.To4() != nil {
+		return "/32"
+	}
+	return "/128"
+}
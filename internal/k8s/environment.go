@@ -0,0 +1,48 @@
+package k8s
+
+import "fmt"
+
+// Environments an instance can be designated for. A customer's production
+// instance is told apart from its test ones by the "environment" label;
+// unlabelled instances are production ones.
+const (
+	EnvProd    = "prod"
+	EnvStaging = "staging"
+	EnvDev     = "dev"
+)
+
+// Environments lists the valid environments, production first.
+var Environments = []string{EnvProd, EnvStaging, EnvDev}
+
+// environmentLabel records an instance's environment.
+const environmentLabel = "environment"
+
+// ValidEnvironment reports whether env names an environment.
+func ValidEnvironment(env string) bool {
+	for _, e := range Environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceEnvironment returns the environment recorded in an instance's
+// labels.
+func instanceEnvironment(labels map[string]string) string {
+	if env := labels[environmentLabel]; env != "" {
+		return env
+	}
+	return EnvProd
+}
+
+// instanceHost returns the public hostname of an instance. Production
+// instances are served directly under domain and the others under a
+// subdomain named after their environment, such as
+// tenant-1a2b3c4d.staging.wareit.ai.
+func instanceHost(domain, instanceName, env string) string {
+	if env == "" || env == EnvProd {
+		return fmt.Sprintf("%s.%s", instanceName, domain)
+	}
+	return fmt.Sprintf("%s.%s.%s", instanceName, env, domain)
+}
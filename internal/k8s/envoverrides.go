@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envNameRe matches a portable environment variable name.
+var envNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnv are the variables the orchestrator owns, which tenants cannot
+// override: the gateway token and the egress proxy settings.
+var reservedEnv = map[string]bool{
+	gatewayTokenEnv:      true,
+	"HTTP_PROXY":         true,
+	"HTTPS_PROXY":        true,
+	"NO_PROXY":           true,
+	"NODE_USE_ENV_PROXY": true,
+}
+
+// CheckEnvOverride reports why a tenant may not set the variable name, or
+// nil if it may.
+func CheckEnvOverride(name string) error {
+	if !envNameRe.MatchString(name) {
+		return fmt.Errorf("%q is not a valid variable name", name)
+	}
+	if reservedEnv[strings.ToUpper(name)] || strings.HasPrefix(name, featureEnvPrefix) {
+		return fmt.Errorf("%s is set by the orchestrator", name)
+	}
+	return nil
+}
+
+// withEnvOverrides returns env with the tenant's overrides applied in name
+// order: a variable already in env has its entry replaced, others are
+// appended.
+func withEnvOverrides(env []interface{}, overrides map[string]string) []interface{} {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := map[string]interface{}{"name": name, "value": overrides[name]}
+		replaced := false
+		for i, e := range env {
+			if m, ok := e.(map[string]interface{}); ok && m["name"] == name {
+				env[i], replaced = entry, true
+			}
+		}
+		if !replaced {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
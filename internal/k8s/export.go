@@ -0,0 +1,298 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	pvcGVR      = schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}
+	snapshotGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshots"}
+	jobGVR      = schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}
+)
+
+// exportScript archives the restored volume and uploads it to the presigned
+// URL. The archive is staged on disk because S3 rejects chunked uploads.
+const exportScript = `set -eu
+tar -czf /work/export.tar.gz -C /data .
+curl --fail --silent --show-error -X PUT -H 'Content-Type: application/gzip' -T /work/export.tar.gz "$UPLOAD_URL"`
+
+// ErrNoVolume is returned when a tenant's instance has no persistent volume
+// to export.
+var ErrNoVolume = fmt.Errorf("instance has no persistent volume")
+
+// ExportStore is the object storage holding export archives, which
+// PurgeInstance removes with the tenant's other data.
+type ExportStore interface {
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// UseExportStore makes PurgeInstance remove the tenant's export archives,
+// kept under EXPORT_PREFIX/<tenant>/, from store.
+func (m *Manager) UseExportStore(store ExportStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exports = store
+}
+
+// exportStore returns the store set by UseExportStore, or nil.
+func (m *Manager) exportStore() ExportStore {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.exports
+}
+
+// exportPrefix returns the object key prefix of the tenant's export
+// archives.
+func (m *Manager) exportPrefix(tenantID string) string {
+	return m.cfg.ExportPrefix + tenant.Canonical(tenantID) + "/"
+}
+
+// ExportInfo describes a data export job.
+type ExportInfo struct {
+	ID           string
+	InstanceName string
+	Status       string // "pending", "running", "completed" or "failed"
+	CreatedAt    time.Time
+}
+
+// StartExport snapshots the tenant's instance volume and launches a Job that
+// restores the snapshot, archives it and uploads the archive to uploadURL, a
+// presigned PUT URL. The snapshot and restored volume are owned by the Job and
+// are garbage-collected with it.
+func (m *Manager) StartExport(ctx context.Context, tenantID, exportID, uploadURL string) (*ExportInfo, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client := m.clientFor(ctx)
+
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	instanceName := list.Items[0].GetName()
+
+	pvcs, err := client.Resource(pvcGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, instanceName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing volumes for %s: %v", instanceName, err)
+	}
+	if len(pvcs.Items) == 0 {
+		return nil, ErrNoVolume
+	}
+	source := pvcs.Items[0]
+
+	name := fmt.Sprintf("%s-export-%s", instanceName, exportID)
+	labels := map[string]interface{}{
+		"tenant":      tenantID,
+		"app":         "tenant-export",
+		"export-id":   exportID,
+		instanceLabel: instanceName,
+	}
+	inheritCostLabels(m.cfg, list.Items[0].GetLabels(), labels)
+
+	job, err := client.Resource(jobGVR).Namespace(m.cfg.Namespace).Create(ctx,
+		m.buildExportJob(ctx, name, labels, uploadURL), metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("creating export job: %v", err)
+	}
+	owner := []interface{}{
+		map[string]interface{}{
+			"apiVersion":         "batch/v1",
+			"kind":               "Job",
+			"name":               job.GetName(),
+			"uid":                string(job.GetUID()),
+			"blockOwnerDeletion": true,
+		},
+	}
+
+	snapshotSpec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": source.GetName(),
+		},
+	}
+	if m.cfg.SnapshotClass != "" {
+		snapshotSpec["volumeSnapshotClassName"] = m.cfg.SnapshotClass
+	}
+	snapshot := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":            name,
+				"namespace":       m.cfg.Namespace,
+				"labels":          labels,
+				"ownerReferences": owner,
+			},
+			"spec": snapshotSpec,
+		},
+	}
+	if _, err := client.Resource(snapshotGVR).Namespace(m.cfg.Namespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("creating export snapshot: %v", err)
+	}
+
+	size, _, _ := unstructured.NestedString(source.Object, "spec", "resources", "requests", "storage")
+	pvcSpec := map[string]interface{}{
+		"accessModes": []interface{}{"ReadWriteOnce"},
+		"dataSource": map[string]interface{}{
+			"apiGroup": "snapshot.storage.k8s.io",
+			"kind":     "VolumeSnapshot",
+			"name":     name,
+		},
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{"storage": size},
+		},
+	}
+	if sc, found, _ := unstructured.NestedString(source.Object, "spec", "storageClassName"); found {
+		pvcSpec["storageClassName"] = sc
+	}
+	pvc := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata": map[string]interface{}{
+				"name":            name,
+				"namespace":       m.cfg.Namespace,
+				"labels":          labels,
+				"ownerReferences": owner,
+			},
+			"spec": pvcSpec,
+		},
+	}
+	if _, err := client.Resource(pvcGVR).Namespace(m.cfg.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("creating export volume: %v", err)
+	}
+
+	return &ExportInfo{
+		ID:           exportID,
+		InstanceName: instanceName,
+		Status:       "pending",
+		CreatedAt:    job.GetCreationTimestamp().UTC(),
+	}, nil
+}
+
+// GetExport returns the current state of a tenant's export job.
+func (m *Manager) GetExport(ctx context.Context, tenantID, exportID string) (*ExportInfo, error) {
+	client := m.readerFor(ctx)
+
+	list, err := client.Resource(jobGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("tenant=%s,export-id=%s", tenant.Canonical(tenantID), exportID),
+	})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("listing export jobs: %v", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	job := list.Items[0]
+
+	status := "pending"
+	succeeded, _, _ := unstructured.NestedInt64(job.Object, "status", "succeeded")
+	active, _, _ := unstructured.NestedInt64(job.Object, "status", "active")
+	conditions, _, _ := unstructured.NestedSlice(job.Object, "status", "conditions")
+	switch {
+	case succeeded > 0:
+		status = "completed"
+	case hasCondition(conditions, "Failed"):
+		status = "failed"
+	case active > 0:
+		status = "running"
+	}
+
+	return &ExportInfo{
+		ID:           exportID,
+		InstanceName: job.GetLabels()[instanceLabel],
+		Status:       status,
+		CreatedAt:    job.GetCreationTimestamp().UTC(),
+	}, nil
+}
+
+// buildExportJob constructs the batch/v1 Job that archives and uploads the
+// restored export volume named name.
+func (m *Manager) buildExportJob(ctx context.Context, name string, labels map[string]interface{}, uploadURL string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "batch/v1",
+			"kind":       "Job",
+			"metadata": map[string]interface{}{
+				"name":        name,
+				"namespace":   m.cfg.Namespace,
+				"labels":      labels,
+				"annotations": requestAnnotations(ctx),
+			},
+			"spec": map[string]interface{}{
+				"backoffLimit":            int64(2),
+				"activeDeadlineSeconds":   int64(3600),
+				"ttlSecondsAfterFinished": int64(m.cfg.ExportURLTTL.Seconds()),
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{
+						"labels": labels,
+					},
+					"spec": map[string]interface{}{
+						"restartPolicy": "Never",
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":    "export",
+								"image":   m.mirrors.image(m.cfg.ExportImage),
+								"command": []interface{}{"/bin/sh", "-c", exportScript},
+								"env": []interface{}{
+									map[string]interface{}{"name": "UPLOAD_URL", "value": uploadURL},
+								},
+								"volumeMounts": []interface{}{
+									map[string]interface{}{"name": "data", "mountPath": "/data", "readOnly": true},
+									map[string]interface{}{"name": "work", "mountPath": "/work"},
+								},
+							},
+						},
+						"volumes": []interface{}{
+							map[string]interface{}{
+								"name": "data",
+								"persistentVolumeClaim": map[string]interface{}{
+									"claimName": name,
+									"readOnly":  true,
+								},
+							},
+							map[string]interface{}{
+								"name":     "work",
+								"emptyDir": map[string]interface{}{},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// hasCondition reports whether a status.conditions slice contains condType
+// with status "True".
+func hasCondition(conditions []interface{}, condType string) bool {
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cond["type"] == condType && cond["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
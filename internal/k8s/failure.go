@@ -0,0 +1,137 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// provisioningFailedAnnotation records why the orchestrator gave up on
+// provisioning an instance. The instance reports status "error" with it as
+// the message until it runs.
+const provisioningFailedAnnotation = annotationPrefix + "provisioning-failed"
+
+// diagnosticLogTail is the number of log lines captured by FailInstance.
+const diagnosticLogTail = 100
+
+var eventGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// Diagnostics is what FailInstance captured from an instance before marking
+// it failed. Errors lists what could not be captured.
+type Diagnostics struct {
+	TenantID     string        `json:"tenant_id"`
+	Instance     string        `json:"instance"`
+	Reason       string        `json:"reason"`
+	CapturedAt   time.Time     `json:"captured_at"`
+	State        string        `json:"state,omitempty"`
+	StateMessage string        `json:"state_message,omitempty"`
+	Events       []ObjectEvent `json:"events"`
+	Logs         string        `json:"logs,omitempty"`
+	Errors       []string      `json:"errors,omitempty"`
+}
+
+// ObjectEvent is a Kubernetes event about the instance or one of its pods.
+type ObjectEvent struct {
+	Object   string    `json:"object"` // Kind/name
+	Type     string    `json:"type"`   // Normal or Warning
+	Reason   string    `json:"reason"`
+	Message  string    `json:"message"`
+	Count    int64     `json:"count,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// FailInstance gives up on provisioning the tenant's instance selected by ctx:
+// it captures the instance's state, the events of the instance and its pods
+// and the tail of its logs, then records reason on the instance, which
+// reports status "error" from then on unless it runs. It returns ErrNotFound
+// if the tenant has no instance. Diagnostics that cannot be read are listed
+// in Errors rather than failing the call.
+func (m *Manager) FailInstance(ctx context.Context, tenantID, reason string) (*Diagnostics, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client := m.clientFor(ctx)
+	instance, err := m.tenantInstance(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	info := m.instanceInfo(instance)
+	d := &Diagnostics{
+		TenantID:   tenantID,
+		Instance:   info.Name,
+		Reason:     reason,
+		CapturedAt: time.Now().UTC(),
+		Events:     []ObjectEvent{},
+	}
+	d.State, d.StateMessage = m.instanceState(ctx, client, instance, info)
+
+	objects := [][2]string{{"OpenClawInstance", info.Name}}
+	pods, err := instancePods(ctx, client, m.cfg.Namespace, info.Name)
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+	}
+	for _, pod := range pods {
+		objects = append(objects, [2]string{"Pod", pod.GetName()})
+	}
+	for _, obj := range objects {
+		events, err := m.objectEvents(ctx, client, obj[0], obj[1])
+		if err != nil {
+			d.Errors = append(d.Errors, err.Error())
+			continue
+		}
+		d.Events = append(d.Events, events...)
+	}
+	sort.SliceStable(d.Events, func(i, j int) bool { return d.Events[i].LastSeen.Before(d.Events[j].LastSeen) })
+	if len(pods) > 0 {
+		if d.Logs, err = m.podLogs(ctx, &pods[0], diagnosticLogTail); err != nil {
+			d.Errors = append(d.Errors, err.Error())
+		}
+	}
+
+	err = m.patchLockedInstances(ctx, tenantID, fixedPatch(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{provisioningFailedAnnotation: reason},
+		},
+	}))
+	return d, err
+}
+
+// objectEvents lists the events about the named object of the given kind.
+func (m *Manager) objectEvents(ctx context.Context, client dynamic.Interface, kind, name string) ([]ObjectEvent, error) {
+	obj := kind + "/" + name
+	list, err := client.Resource(eventGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", kind, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing events of %s: %v", obj, err)
+	}
+	events := make([]ObjectEvent, 0, len(list.Items))
+	for _, item := range list.Items {
+		ev := ObjectEvent{Object: obj}
+		ev.Type, _ = item.Object["type"].(string)
+		ev.Reason, _ = item.Object["reason"].(string)
+		ev.Message, _ = item.Object["message"].(string)
+		ev.Count, _ = item.Object["count"].(int64)
+		for _, field := range []string{"lastTimestamp", "eventTime", "firstTimestamp"} {
+			if s, _ := item.Object[field].(string); s != "" {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					ev.LastSeen = t.UTC()
+					break
+				}
+			}
+		}
+		if ev.LastSeen.IsZero() {
+			ev.LastSeen = item.GetCreationTimestamp().UTC()
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
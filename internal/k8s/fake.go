@@ -0,0 +1,983 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeStartupDelay is how long a fake instance reports "starting" before it
+// becomes "running", and how long a fake export takes to complete.
+const fakeStartupDelay = 5 * time.Second
+
+// fakeNodes is the number of nodes image pre-pulls report.
+const fakeNodes = 3
+
+// fakeInstance is the in-memory record of one tenant instance.
+type fakeInstance struct {
+	tenantID  string
+	info      InstanceInfo
+	object    *unstructured.Unstructured
+	created   time.Time
+	running   bool
+	suspended bool
+	failed    bool // By FailInstance; the instance never runs
+}
+
+// fakeStartupStates are the provisioning states a fake instance passes
+// through, in equal slices of fakeStartupDelay.
+var fakeStartupStates = []string{
+	StatePending, StateScheduling, StatePullingImage, StateStarting, StateWaitingForDNS, StateWaitingForTLS,
+}
+
+// state returns the instance's provisioning state.
+func (inst *fakeInstance) state() string {
+	switch {
+	case inst.suspended:
+		return StateSuspended
+	case inst.running:
+		return StateRunning
+	case inst.failed:
+		return StateError
+	}
+	i := int(time.Since(inst.created) * time.Duration(len(fakeStartupStates)) / fakeStartupDelay)
+	return fakeStartupStates[min(i, len(fakeStartupStates)-1)]
+}
+
+// fakeExport is the in-memory record of one export.
+type fakeExport struct {
+	tenantID string
+	info     ExportInfo
+}
+
+// FakeManager is an in-memory InstanceManager that needs no cluster. Instances
+// move from "starting" to "running" after a short delay and events are
+// delivered to OnInstanceEvent handlers as they would be by Watch. Nothing
+// survives a restart, and exports never upload an archive.
+type FakeManager struct {
+	cfg      *config.Config
+	names    nameStrategy
+	images   *ImagePolicies
+	defaults *ImageDefaults
+	mirrors  imageMirrors
+	inject   *Injections
+	pinner   *imagePinner
+
+	mu        sync.Mutex
+	instances map[string]*fakeInstance // by instance name
+	exports   map[string]*fakeExport   // by export ID
+	prePulls  map[string]*PrePull      // by pre-pull ID
+	retained  []RetainedArtifact
+	version   int
+	handlers  []func(InstanceEvent)
+
+	reservations ReservationSource
+}
+
+// NewFakeManager creates an empty FakeManager.
+func NewFakeManager(cfg *config.Config) (*FakeManager, error) {
+	images, err := LoadImagePolicies(cfg.ImagePolicyPath)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadImageDefaults(cfg.ImageDefaultsPath)
+	if err != nil {
+		return nil, err
+	}
+	inject, err := LoadInjections(cfg.InjectionsPath)
+	if err != nil {
+		return nil, err
+	}
+	pinner, err := newImagePinner(cfg)
+	if err != nil {
+		return nil, err
+	}
+	names, err := parseNameStrategy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("using in-memory fake backend; no cluster will be contacted")
+	return &FakeManager{
+		cfg:       cfg,
+		names:     names,
+		images:    images,
+		defaults:  defaults,
+		mirrors:   newImageMirrors(cfg),
+		inject:    inject,
+		pinner:    pinner,
+		instances: make(map[string]*fakeInstance),
+		exports:   make(map[string]*fakeExport),
+		prePulls:  make(map[string]*PrePull),
+	}, nil
+}
+
+// Bootstrap is a no-op.
+func (f *FakeManager) Bootstrap(ctx context.Context) error { return nil }
+
+// CreateInstance records a new instance for the tenant, or returns the would-be
+// spec for a dry run.
+func (f *FakeManager) CreateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error) {
+	id, err := tenant.Parse(tenantID)
+	if err != nil {
+		return nil, &InvalidSpecError{Message: "invalid tenant ID: " + err.Error()}
+	}
+	tenantID = id.String()
+	f.mu.Lock()
+	src := f.reservations
+	f.mu.Unlock()
+	heldNames, held, err := heldReservations(ctx, src, opts.Reservation)
+	if err != nil {
+		return nil, err
+	}
+	instanceName := opts.instanceName
+	if opts.Reservation != nil {
+		instanceName = opts.Reservation.InstanceName
+	}
+	if instanceName == "" {
+		instanceName, err = f.names.freeName(tenantID, func(name string) (bool, error) {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			_, ok := f.instances[name]
+			return ok || heldNames[name], nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkInstanceHost(f.cfg, instanceName, opts.Environment); err != nil {
+		return nil, err
+	}
+	opts.image = f.defaults.For(opts.Plan, opts.Environment)
+	instance := buildInstanceSpec(ctx, f.cfg, instanceName, tenantID, opts)
+	if err := f.inject.apply(instance); err != nil {
+		return nil, err
+	}
+	if err := f.images.checkInstance(instance, ""); err != nil {
+		return nil, err
+	}
+	if err := f.mirrors.apply(instance); err != nil {
+		return nil, err
+	}
+	if err := f.pinner.pin(ctx, instance); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	err = f.checkFakeCapacity(held)
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		return &InstanceInfo{
+			Name:             instanceName,
+			Endpoint:         f.InstanceURL(instanceName, opts.Environment),
+			InternalEndpoint: InternalURL(f.cfg, instanceName, opts.Environment),
+			Environment:      instanceEnvironment(instance.GetLabels()),
+			Status:           "dry-run",
+			Spec:             instance.Object,
+		}, nil
+	}
+	// Store the object as the API server would return it, with plain JSON
+	// types throughout.
+	obj, err := copyJSON(instance.Object)
+	if err != nil {
+		return nil, fmt.Errorf("encoding instance: %v", err)
+	}
+	instance = &unstructured.Unstructured{Object: obj}
+	opts.journal(StepSpecBuilt, instanceName)
+
+	f.mu.Lock()
+	if err := f.checkFakeCapacity(held); err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+	f.version++
+	inst := &fakeInstance{
+		tenantID: tenantID,
+		info: InstanceInfo{
+			Name:               instanceName,
+			Endpoint:           f.InstanceURL(instanceName, opts.Environment),
+			InternalEndpoint:   InternalURL(f.cfg, instanceName, opts.Environment),
+			Status:             "starting",
+			GatewayToken:       opts.GatewayToken,
+			GatewayTokenDigest: tokenDigest(opts.GatewayToken),
+			ResourceVersion:    strconv.Itoa(f.version),
+			Plan:               opts.Plan,
+			Environment:        instanceEnvironment(instance.GetLabels()),
+			ContactEmail:       opts.ContactEmail,
+			HealthCheck:        opts.HealthCheck,
+			Storage:            "1Gi",
+			CreatedAt:          time.Now().UTC(),
+		},
+		created: time.Now(),
+	}
+	inst.object = instance
+	f.instances[instanceName] = inst
+	info := inst.info
+	f.mu.Unlock()
+	opts.journal(StepInstanceCreated, instanceName)
+
+	f.dispatch(InstanceEvent{Type: InstanceAdded, TenantID: tenantID, Info: &info, Object: inst.object})
+	return &InstanceInfo{
+		Name:             instanceName,
+		Endpoint:         info.Endpoint,
+		InternalEndpoint: info.InternalEndpoint,
+		Environment:      info.Environment,
+		Status:           "creating",
+		ResourceVersion:  info.ResourceVersion,
+	}, nil
+}
+
+// GetInstance returns the tenant's instance selected by ctx, or its default
+// one, or nil if none exists.
+func (f *FakeManager) GetInstance(ctx context.Context, tenantID string) (*InstanceInfo, error) {
+	f.mu.Lock()
+	inst, ok := f.instance(ctx, tenantID)
+	if !ok {
+		f.mu.Unlock()
+		return nil, nil
+	}
+	changed := false
+	if !inst.running && !inst.suspended && !inst.failed && time.Since(inst.created) >= fakeStartupDelay {
+		f.version++
+		inst.running = true
+		inst.info.Status = "running"
+		inst.info.ResourceVersion = strconv.Itoa(f.version)
+		changed = true
+	}
+	info := inst.info
+	info.State = inst.state()
+	f.mu.Unlock()
+
+	if changed {
+		f.dispatch(InstanceEvent{Type: InstanceUpdated, TenantID: tenantID, Info: &info, Object: inst.object})
+	}
+	return &info, nil
+}
+
+// ListInstances returns every fake instance.
+func (f *FakeManager) ListInstances(ctx context.Context) ([]ClusterInstance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]ClusterInstance, 0, len(f.instances))
+	for _, inst := range f.instances {
+		info := inst.info
+		out = append(out, ClusterInstance{TenantID: inst.tenantID, Info: &info, Object: inst.object})
+	}
+	return out, nil
+}
+
+// TenantInstances returns all of the tenant's instances, oldest first.
+func (f *FakeManager) TenantInstances(ctx context.Context, tenantID string) ([]*InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	insts := f.selected(context.WithValue(ctx, instanceKey{}, nil), tenantID)
+	out := make([]*InstanceInfo, 0, len(insts))
+	for _, inst := range insts {
+		info := inst.info
+		out = append(out, &info)
+	}
+	return out, nil
+}
+
+// selected returns the tenant's instances selected by ctx, oldest first.
+// Callers hold f.mu.
+func (f *FakeManager) selected(ctx context.Context, tenantID string) []*fakeInstance {
+	var out []*fakeInstance
+	for _, inst := range f.instances {
+		if inst.tenantID == tenantID {
+			out = append(out, inst)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		ti, tj := out[i].info.CreatedAt, out[j].info.CreatedAt
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return out[i].info.Name < out[j].info.Name
+	})
+
+	name, ok := selectedInstance(ctx)
+	switch {
+	case !ok:
+	case name == "":
+		out = out[:min(len(out), 1)]
+	default:
+		var named []*fakeInstance
+		for _, inst := range out {
+			if inst.info.Name == name {
+				named = append(named, inst)
+			}
+		}
+		out = named
+	}
+	return out
+}
+
+// instance returns the first of the tenant's instances selected by ctx.
+// Callers hold f.mu.
+func (f *FakeManager) instance(ctx context.Context, tenantID string) (*fakeInstance, bool) {
+	insts := f.selected(ctx, tenantID)
+	if len(insts) == 0 {
+		return nil, false
+	}
+	return insts[0], true
+}
+
+// DeleteInstance forgets the tenant's instances selected by ctx, subject to
+// the version required by ctx.
+func (f *FakeManager) DeleteInstance(ctx context.Context, tenantID string) error {
+	f.mu.Lock()
+	insts := f.selected(ctx, tenantID)
+	for _, inst := range insts {
+		if rv := requiredVersion(ctx); rv != "" && inst.info.ResourceVersion != rv {
+			f.mu.Unlock()
+			return ErrPreconditionFailed
+		}
+	}
+	for _, inst := range insts {
+		delete(f.instances, inst.info.Name)
+	}
+	f.mu.Unlock()
+
+	for _, inst := range insts {
+		info := inst.info
+		f.dispatch(InstanceEvent{Type: InstanceDeleted, TenantID: tenantID, Info: &info, Object: inst.object})
+	}
+	return nil
+}
+
+// DeleteInstanceRetainingStorage deletes the tenant's instances selected by
+// ctx and records their volumes as retained.
+func (f *FakeManager) DeleteInstanceRetainingStorage(ctx context.Context, tenantID string, until time.Time) ([]RetainedArtifact, error) {
+	f.mu.Lock()
+	insts := f.selected(ctx, tenantID)
+	f.mu.Unlock()
+	if len(insts) == 0 {
+		return nil, ErrNotFound
+	}
+	if err := f.DeleteInstance(ctx, tenantID); err != nil {
+		return nil, err
+	}
+
+	var retained []RetainedArtifact
+	for _, inst := range insts {
+		retained = append(retained, RetainedArtifact{
+			TenantID: tenantID,
+			Instance: inst.info.Name,
+			Kind:     "PersistentVolumeClaim",
+			Name:     inst.info.Name + "-data",
+			Until:    until.UTC(),
+		})
+	}
+	f.mu.Lock()
+	f.retained = append(f.retained, retained...)
+	f.mu.Unlock()
+	return retained, nil
+}
+
+// ReactivateInstance re-creates the instance selected by ctx, or the one
+// retained most recently, under its old name on its retained volume.
+func (f *FakeManager) ReactivateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error) {
+	selected, _ := selectedInstance(ctx)
+	f.mu.Lock()
+	var volume *RetainedArtifact
+	for i := range f.retained {
+		r := &f.retained[i]
+		if r.TenantID == tenantID && (selected == "" || r.Instance == selected) && (volume == nil || volume.Until.Before(r.Until)) {
+			volume = r
+		}
+	}
+	var name, claim string
+	var exists bool
+	if volume != nil {
+		name, claim = volume.Instance, volume.Name
+		_, exists = f.instances[name]
+	}
+	f.mu.Unlock()
+	if volume == nil {
+		return nil, ErrNoRetainedStorage
+	}
+	if exists {
+		return nil, ErrInstanceExists
+	}
+
+	opts.DryRun = false
+	opts.instanceName = name
+	opts.existingClaim = claim
+	info, err := f.CreateInstance(ctx, tenantID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	kept := f.retained[:0]
+	for _, r := range f.retained {
+		if r.TenantID != tenantID || r.Instance != name {
+			kept = append(kept, r)
+		}
+	}
+	f.retained = kept
+	f.mu.Unlock()
+	return info, nil
+}
+
+// RetainedStorage lists the retained volumes, soonest to expire first.
+func (f *FakeManager) RetainedStorage(ctx context.Context) ([]RetainedArtifact, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := append([]RetainedArtifact{}, f.retained...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out, nil
+}
+
+// ExpireRetainedStorage forgets the retained volumes whose retention has
+// ended.
+func (f *FakeManager) ExpireRetainedStorage(ctx context.Context) ([]RetainedArtifact, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	var kept, expired []RetainedArtifact
+	for _, r := range f.retained {
+		if now.Before(r.Until) {
+			kept = append(kept, r)
+		} else {
+			expired = append(expired, r)
+		}
+	}
+	f.retained = kept
+	return expired, nil
+}
+
+// SuspendInstance marks the tenant's instance suspended.
+func (f *FakeManager) SuspendInstance(ctx context.Context, tenantID string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		inst.suspended = true
+		inst.info.Status = "suspended"
+	})
+}
+
+// ResumeInstance returns a suspended instance to its previous status.
+func (f *FakeManager) ResumeInstance(ctx context.Context, tenantID string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		inst.suspended = false
+		inst.info.Status = "starting"
+		if inst.running {
+			inst.info.Status = "running"
+		}
+	})
+}
+
+// LifecycleCapabilities reports every lifecycle action as supported.
+func (f *FakeManager) LifecycleCapabilities(ctx context.Context) ([]LifecycleCapability, error) {
+	caps := make([]LifecycleCapability, 0, len(LifecycleActions))
+	for _, action := range LifecycleActions {
+		caps = append(caps, LifecycleCapability{Action: action, Supported: true})
+	}
+	return caps, nil
+}
+
+// UpgradeInstance records the new image tag, and its digest when pinning is
+// enabled, in the instance's spec, subject to the image policy.
+func (f *FakeManager) UpgradeInstance(ctx context.Context, tenantID, imageTag string) error {
+	f.mu.Lock()
+	inst, ok := f.instance(ctx, tenantID)
+	var object *unstructured.Unstructured
+	if ok {
+		object = inst.object
+	}
+	f.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	repository, _, _ := unstructured.NestedString(object.Object, "spec", "image", "repository")
+	if err := f.images.Check(object.GetLabels()["plan"], f.mirrors.source(repository), imageTag); err != nil {
+		return err
+	}
+	repository = f.mirrors.pull(repository)
+	digest, err := f.pinner.resolve(ctx, repository, imageTag)
+	if err != nil {
+		return err
+	}
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		mergePatch(obj, upgradePatch(repository, imageTag, digest))
+		inst.object = &unstructured.Unstructured{Object: obj}
+	})
+}
+
+// SetResourceRequests records new resource requests in the instance's spec.
+func (f *FakeManager) SetResourceRequests(ctx context.Context, tenantID, cpu, memory string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		mergePatch(obj, requestsPatch(cpu, memory))
+		inst.object = &unstructured.Unstructured{Object: obj}
+	})
+}
+
+// CertificateStatus reports the certificate as issued once the instance is
+// running.
+func (f *FakeManager) CertificateStatus(ctx context.Context, tenantID string) (*CertificateStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	inst, ok := f.instance(ctx, tenantID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	name, managed := ingressCertificate(inst.object)
+	status := &CertificateStatus{Instance: inst.info.Name, Name: name, Managed: managed, Ready: inst.running || !managed}
+	if !status.Ready {
+		status.Message = "certificate not created yet"
+	}
+	return status, nil
+}
+
+// RetryCertificate does nothing beyond checking that the instance exists.
+func (f *FakeManager) RetryCertificate(ctx context.Context, tenantID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.instance(ctx, tenantID); !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UseWildcardCertificate records the wildcard secret in the instance's spec.
+func (f *FakeManager) UseWildcardCertificate(ctx context.Context, tenantID, secretName string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		mergePatch(obj, wildcardPatch(inst.object, f.cfg.Domain, secretName))
+		inst.object = &unstructured.Unstructured{Object: obj}
+	})
+}
+
+// SetChannel records the release channel label on the instance.
+func (f *FakeManager) SetChannel(ctx context.Context, tenantID, channel string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		unstructured.SetNestedField(obj, channel, "metadata", "labels", "channel")
+		inst.object = &unstructured.Unstructured{Object: obj}
+	})
+}
+
+// SetFeatureFlags rewrites the feature variables in the instance's spec.
+func (f *FakeManager) SetFeatureFlags(ctx context.Context, tenantID string, features map[string]bool) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		env, _, _ := unstructured.NestedSlice(obj, "spec", "env")
+		unstructured.SetNestedSlice(obj, withFeatures(env, features), "spec", "env")
+		inst.object = &unstructured.Unstructured{Object: obj}
+	})
+}
+
+// update applies fn to the tenant's instances selected by ctx and dispatches
+// update events, unless ctx requires a version an instance no longer has.
+func (f *FakeManager) update(ctx context.Context, tenantID string, fn func(*fakeInstance)) error {
+	f.mu.Lock()
+	insts := f.selected(ctx, tenantID)
+	if len(insts) == 0 {
+		f.mu.Unlock()
+		return ErrNotFound
+	}
+	for _, inst := range insts {
+		if rv := requiredVersion(ctx); rv != "" && inst.info.ResourceVersion != rv {
+			f.mu.Unlock()
+			return ErrPreconditionFailed
+		}
+	}
+	events := make([]InstanceEvent, 0, len(insts))
+	for _, inst := range insts {
+		fn(inst)
+		if inst.object != nil {
+			obj := inst.object.DeepCopy()
+			stampChange(ctx, obj)
+			inst.object = obj
+		}
+		f.version++
+		inst.info.ResourceVersion = strconv.Itoa(f.version)
+		info := inst.info
+		events = append(events, InstanceEvent{Type: InstanceUpdated, TenantID: tenantID, Info: &info, Object: inst.object})
+	}
+	f.mu.Unlock()
+
+	for _, ev := range events {
+		f.dispatch(ev)
+	}
+	return nil
+}
+
+// UseExportStore does nothing: fake exports upload no archives.
+func (f *FakeManager) UseExportStore(store ExportStore) {}
+
+// PurgeInstance deletes the tenant's instance and reports it as the only
+// purged artifact.
+func (f *FakeManager) PurgeInstance(ctx context.Context, tenantID string) (*PurgeReport, error) {
+	artifacts, err := f.PlanDeletion(ctx, tenantID, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.DeleteInstance(ctx, tenantID); err != nil {
+		return nil, err
+	}
+	return &PurgeReport{
+		TenantID:   tenantID,
+		Artifacts:  artifacts,
+		VerifiedAt: time.Now().UTC(),
+	}, nil
+}
+
+// PlanDeletion lists the tenant's instances selected by ctx, which are the
+// only resources the fake backend tracks.
+func (f *FakeManager) PlanDeletion(ctx context.Context, tenantID string, purge bool) ([]PurgedArtifact, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var artifacts []PurgedArtifact
+	for _, inst := range f.selected(ctx, tenantID) {
+		if rv := requiredVersion(ctx); rv != "" && inst.info.ResourceVersion != rv {
+			return nil, ErrPreconditionFailed
+		}
+		artifacts = append(artifacts, PurgedArtifact{Kind: "OpenClawInstance", Name: inst.info.Name})
+	}
+	return artifacts, nil
+}
+
+// InstanceURL returns the public HTTPS URL of an instance in the given
+// environment.
+func (f *FakeManager) InstanceURL(instanceName, environment string) string {
+	return "https://" + instanceHost(f.cfg.Domain, instanceName, environment)
+}
+
+// InstanceMetrics reports a single pod using a quarter of each resource
+// request, and a volume a quarter full, so that dashboards have data to show.
+func (f *FakeManager) InstanceMetrics(ctx context.Context, tenantID string) (*InstanceMetrics, error) {
+	f.mu.Lock()
+	inst, ok := f.instance(ctx, tenantID)
+	var object *unstructured.Unstructured
+	if ok {
+		object = inst.object
+	}
+	f.mu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	container := ContainerMetrics{Name: "openclaw"}
+	container.CPU = ResourceMetric{
+		Request: quantity(object.Object, true, "spec", "resources", "requests", "cpu"),
+		Limit:   quantity(object.Object, true, "spec", "resources", "limits", "cpu"),
+	}
+	container.Memory = ResourceMetric{
+		Request: quantity(object.Object, false, "spec", "resources", "requests", "memory"),
+		Limit:   quantity(object.Object, false, "spec", "resources", "limits", "memory"),
+	}
+	container.CPU.Usage = container.CPU.Request / 4
+	container.Memory.Usage = container.Memory.Request / 4
+	container.CPU.finish()
+	container.Memory.finish()
+
+	capacity := quantity(object.Object, false, "spec", "storage", "persistence", "size")
+	name := object.GetName()
+	return &InstanceMetrics{
+		Instance:    name,
+		CollectedAt: time.Now().UTC(),
+		CPU:         container.CPU,
+		Memory:      container.Memory,
+		Pods:        []PodMetrics{{Name: name + "-0", Node: "fake-node", Phase: "Running", Containers: []ContainerMetrics{container}}},
+		Volumes: []VolumeMetrics{{
+			Claim:       name + "-data",
+			Requested:   capacity,
+			Capacity:    capacity,
+			Used:        capacity / 4,
+			Available:   capacity - capacity/4,
+			Utilization: fraction(capacity/4, capacity),
+		}},
+	}, nil
+}
+
+// RestartInstance sends a running instance back through startup.
+func (f *FakeManager) RestartInstance(ctx context.Context, tenantID string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		if inst.suspended {
+			return
+		}
+		inst.running = false
+		inst.created = time.Now()
+		inst.info.Status = "starting"
+	})
+}
+
+// InstanceLogs returns a few synthetic lines describing the instance's
+// lifecycle so far.
+func (f *FakeManager) InstanceLogs(ctx context.Context, tenantID string, tail int) (string, error) {
+	f.mu.Lock()
+	inst, ok := f.instance(ctx, tenantID)
+	var created time.Time
+	var running, suspended bool
+	if ok {
+		created, running, suspended = inst.created, inst.running, inst.suspended
+	}
+	f.mu.Unlock()
+	switch {
+	case !ok:
+		return "", ErrNotFound
+	case suspended:
+		return "", ErrNoPods
+	}
+
+	lines := []string{created.UTC().Format(time.RFC3339) + " openclaw: starting gateway"}
+	if running {
+		lines = append(lines, created.Add(fakeStartupDelay).UTC().Format(time.RFC3339)+" openclaw: gateway listening on :18789")
+	}
+	if len(lines) > tail {
+		lines = lines[len(lines)-tail:]
+	}
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+	return out.String(), nil
+}
+
+// FailInstance marks the tenant's instance selected by ctx failed, unless it
+// is running, with the fake log as its only diagnostics.
+func (f *FakeManager) FailInstance(ctx context.Context, tenantID, reason string) (*Diagnostics, error) {
+	logs, err := f.InstanceLogs(ctx, tenantID, diagnosticLogTail)
+	if err != nil && err != ErrNoPods {
+		return nil, err
+	}
+	var d *Diagnostics
+	err = f.update(ctx, tenantID, func(inst *fakeInstance) {
+		d = &Diagnostics{
+			TenantID:   tenantID,
+			Instance:   inst.info.Name,
+			Reason:     reason,
+			CapturedAt: time.Now().UTC(),
+			State:      inst.state(),
+			Events:     []ObjectEvent{},
+			Logs:       logs,
+		}
+		if !inst.running {
+			inst.failed = true
+			inst.info.Status, inst.info.Message = "error", reason
+		}
+	})
+	return d, err
+}
+
+// RotateGatewayToken records the new token in the instance's info and spec.
+func (f *FakeManager) RotateGatewayToken(ctx context.Context, tenantID, token string) error {
+	return f.update(ctx, tenantID, func(inst *fakeInstance) {
+		obj, err := copyJSON(inst.object.Object)
+		if err != nil {
+			return
+		}
+		env, _, _ := unstructured.NestedSlice(obj, "spec", "env")
+		unstructured.SetNestedSlice(obj, withGatewayToken(env, token), "spec", "env")
+		inst.object = &unstructured.Unstructured{Object: obj}
+		inst.info.GatewayToken = token
+		inst.info.GatewayTokenDigest = tokenDigest(token)
+	})
+}
+
+// MigrateGatewayTokens does nothing: the fake keeps no Secrets.
+func (f *FakeManager) MigrateGatewayTokens(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// StartExport records an export that completes after a short delay. No
+// archive is uploaded to uploadURL.
+func (f *FakeManager) StartExport(ctx context.Context, tenantID, exportID, uploadURL string) (*ExportInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	inst, ok := f.instance(ctx, tenantID)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	exp := &fakeExport{
+		tenantID: tenantID,
+		info: ExportInfo{
+			ID:           exportID,
+			InstanceName: inst.info.Name,
+			Status:       "pending",
+			CreatedAt:    time.Now().UTC(),
+		},
+	}
+	f.exports[exportID] = exp
+	info := exp.info
+	return &info, nil
+}
+
+// GetExport returns the state of a recorded export.
+func (f *FakeManager) GetExport(ctx context.Context, tenantID, exportID string) (*ExportInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	exp, ok := f.exports[exportID]
+	if !ok || exp.tenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	if time.Since(exp.info.CreatedAt) >= fakeStartupDelay {
+		exp.info.Status = "completed"
+	}
+	info := exp.info
+	return &info, nil
+}
+
+// StartPrePull records a pre-pull that reaches the fake nodes one by one
+// over fakeStartupDelay.
+func (f *FakeManager) StartPrePull(ctx context.Context, id, repository, tag string) (*PrePull, error) {
+	repository = f.mirrors.pull(repository)
+	image := repository + ":" + tag
+	digest, err := f.pinner.resolve(ctx, repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	if digest != "" {
+		image = repository + "@" + digest
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p := &PrePull{ID: id, Image: image, CreatedAt: time.Now().UTC(), Nodes: fakeNodes}
+	f.prePulls[id] = p
+	out := *p
+	return &out, nil
+}
+
+// PrePulls returns the recorded pre-pulls, newest first.
+func (f *FakeManager) PrePulls(ctx context.Context) ([]PrePull, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]PrePull, 0, len(f.prePulls))
+	for _, p := range f.prePulls {
+		out = append(out, fakePrePullProgress(*p))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// GetPrePull returns a recorded pre-pull.
+func (f *FakeManager) GetPrePull(ctx context.Context, id string) (*PrePull, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.prePulls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := fakePrePullProgress(*p)
+	return &out, nil
+}
+
+// DeletePrePull forgets a recorded pre-pull.
+func (f *FakeManager) DeletePrePull(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.prePulls[id]; !ok {
+		return ErrNotFound
+	}
+	delete(f.prePulls, id)
+	return nil
+}
+
+// fakePrePullProgress fills in how many fake nodes p has reached.
+func fakePrePullProgress(p PrePull) PrePull {
+	p.Pulled = min(int64(time.Since(p.CreatedAt)*fakeNodes/fakeStartupDelay), fakeNodes)
+	p.Complete = p.Pulled == p.Nodes
+	return p
+}
+
+// Rebuild reports every instance with a recorded spec as created, without
+// storing anything: the fake backend has a single namespace and no volumes.
+func (f *FakeManager) Rebuild(ctx context.Context, opts RebuildOptions, instances []RebuildInstance) (*RebuildReport, error) {
+	report := &RebuildReport{
+		Context:   "fake",
+		Namespace: opts.Namespace,
+		DryRun:    opts.DryRun,
+		Started:   time.Now().UTC(),
+		Results:   []RebuildResult{},
+	}
+	for _, inst := range instances {
+		res := RebuildResult{Instance: inst.Name, TenantID: inst.TenantID, Status: "created"}
+		if inst.Spec == nil {
+			res.Status = "failed"
+			res.Error = "no spec recorded for instance"
+		}
+		report.Results = append(report.Results, res)
+	}
+	report.Finished = time.Now().UTC()
+	return report, nil
+}
+
+// CheckPermissions reports nothing: the fake backend needs no RBAC.
+func (f *FakeManager) CheckPermissions(ctx context.Context) ([]PermissionCheck, error) {
+	return nil, nil
+}
+
+// Capacity reports the number of fake instances against
+// CAPACITY_MAX_INSTANCES; CPU and memory are not tracked.
+func (f *FakeManager) Capacity(ctx context.Context) (*CapacityReport, error) {
+	f.mu.Lock()
+	n := len(f.instances)
+	f.mu.Unlock()
+
+	ru := ResourceUsage{Resource: "instances", Used: strconv.Itoa(n)}
+	if max := f.cfg.CapacityMaxInstances; max > 0 {
+		ru.Limit = strconv.Itoa(max)
+		ru.Ratio = float64(n) / float64(max)
+	}
+	return &CapacityReport{Namespace: f.cfg.Namespace, Resources: []ResourceUsage{ru}}, nil
+}
+
+// OnCapacityAlert is a no-op; the fake backend never alerts.
+func (f *FakeManager) OnCapacityAlert(fn func(ResourceUsage)) {}
+
+// OnInstanceEvent registers fn to be called for every instance change.
+// Events are delivered synchronously from the call that caused them.
+func (f *FakeManager) OnInstanceEvent(fn func(InstanceEvent)) {
+	f.mu.Lock()
+	f.handlers = append(f.handlers, fn)
+	f.mu.Unlock()
+}
+
+// Watch reports the (empty) initial state as synced and blocks until ctx is
+// cancelled; the fake delivers other events directly.
+func (f *FakeManager) Watch(ctx context.Context) {
+	f.dispatch(InstanceEvent{Type: InstanceSynced})
+	<-ctx.Done()
+}
+
+// RunFailover blocks until ctx is cancelled; there is no cluster to fail over.
+func (f *FakeManager) RunFailover(ctx context.Context) { <-ctx.Done() }
+
+// dispatch delivers ev to every registered handler.
+func (f *FakeManager) dispatch(ev InstanceEvent) {
+	f.mu.Lock()
+	handlers := append([]func(InstanceEvent){}, f.handlers...)
+	f.mu.Unlock()
+	for _, fn := range handlers {
+		fn(ev)
+	}
+}
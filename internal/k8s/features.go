@@ -0,0 +1,117 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// featureEnvPrefix prefixes the environment variable carrying each feature
+// flag, e.g. OPENCLAW_FEATURE_NEW_EDITOR for "new-editor".
+const featureEnvPrefix = "OPENCLAW_FEATURE_"
+
+// featureEnvName returns the environment variable for a flag.
+func featureEnvName(flag string) string {
+	return featureEnvPrefix + strings.ToUpper(strings.ReplaceAll(flag, "-", "_"))
+}
+
+// withFeatures returns env with every feature variable replaced by one per
+// flag, in name order. Other variables are kept as they are.
+func withFeatures(env []interface{}, features map[string]bool) []interface{} {
+	out := make([]interface{}, 0, len(env)+len(features))
+	for _, e := range env {
+		if m, ok := e.(map[string]interface{}); ok {
+			if name, _ := m["name"].(string); strings.HasPrefix(name, featureEnvPrefix) {
+				continue
+			}
+		}
+		out = append(out, e)
+	}
+	names := make([]string, 0, len(features))
+	for name := range features {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		out = append(out, map[string]interface{}{
+			"name":  featureEnvName(name),
+			"value": fmt.Sprintf("%t", features[name]),
+		})
+	}
+	return out
+}
+
+// envEqual reports whether two env lists hold the same variables in order.
+func envEqual(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		am, _ := a[i].(map[string]interface{})
+		bm, _ := b[i].(map[string]interface{})
+		if am["name"] != bm["name"] || am["value"] != bm["value"] {
+			return false
+		}
+	}
+	return true
+}
+
+// SetFeatureFlags rewrites the feature variables of the tenant's instances to
+// match features. Instances already up to date are left untouched; for the
+// others the env change makes the operator roll the pod, which restarts
+// OpenClaw with the new flags. It returns ErrNotFound if the tenant has no
+// instance.
+func (m *Manager) SetFeatureFlags(ctx context.Context, tenantID string, features map[string]bool) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	resource := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return ErrNotFound
+	}
+
+	for _, instance := range list.Items {
+		name := instance.GetName()
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			current, err := resource.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := checkVersion(ctx, current); err != nil {
+				return err
+			}
+			env, _, _ := unstructured.NestedSlice(current.Object, "spec", "env")
+			updated := withFeatures(env, features)
+			if envEqual(env, updated) {
+				return nil
+			}
+			if err := unstructured.SetNestedSlice(current.Object, updated, "spec", "env"); err != nil {
+				return err
+			}
+			stampChange(ctx, current)
+			_, err = resource.Update(ctx, current, metav1.UpdateOptions{})
+			return err
+		})
+		if err == ErrPreconditionFailed {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("updating feature flags on %s: %v", name, err)
+		}
+	}
+	return nil
+}
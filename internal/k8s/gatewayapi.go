@@ -0,0 +1,263 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// TLS modes of the gateway-api ingress provider, selected with
+// INGRESS_GATEWAY_TLS.
+const (
+	// GatewayTLSShared attaches routes to a shared Gateway that terminates
+	// TLS itself, typically with a wildcard certificate.
+	GatewayTLSShared = "shared"
+	// GatewayTLSCertManager gives each instance a Gateway with an HTTPS
+	// listener for its hostname, whose certificate cert-manager's
+	// gateway-shim issues.
+	GatewayTLSCertManager = "cert-manager"
+)
+
+// ValidGatewayTLS reports whether mode is a TLS mode of the gateway-api
+// provider.
+func ValidGatewayTLS(mode string) bool {
+	return mode == GatewayTLSShared || mode == GatewayTLSCertManager
+}
+
+var (
+	httpRouteGVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "httproutes"}
+	gatewayGVR   = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+)
+
+// httpsListener is the name of the listener terminating TLS on per-instance
+// Gateways.
+const httpsListener = "https"
+
+// gatewayRoute disables the operator's Ingress and routes traffic with an
+// HTTPRoute named after the instance, sent to the instance's Service, which
+// the operator names after the instance. The route attaches to a shared
+// Gateway, which terminates TLS, or with perInstance to a Gateway of class
+// class created for the instance, whose certificate cert-manager issues.
+type gatewayRoute struct {
+	gateway, gatewayNS, listener string
+	perInstance                  bool
+	class                        string
+	port                         int64
+	ns                           []string
+}
+
+func (p *gatewayRoute) ingress(instanceName, host string) map[string]interface{} {
+	return map[string]interface{}{"enabled": false}
+}
+
+func (p *gatewayRoute) namespaces() []string { return p.ns }
+
+func (p *gatewayRoute) routes(namespace, instanceName, host string) []*unstructured.Unstructured {
+	labels := map[string]interface{}{instanceLabel: instanceName}
+	parent := map[string]interface{}{"name": p.gateway, "namespace": p.gatewayNS}
+	if p.listener != "" {
+		parent["sectionName"] = p.listener
+	}
+	var objects []*unstructured.Unstructured
+	if p.perInstance {
+		parent = map[string]interface{}{"name": instanceName}
+		objects = append(objects, instanceGateway(namespace, instanceName, host, p.class, labels))
+	}
+	return append(objects, &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "HTTPRoute",
+			"metadata": map[string]interface{}{
+				"name":      instanceName,
+				"namespace": namespace,
+				"labels":    labels,
+			},
+			"spec": map[string]interface{}{
+				"parentRefs": []interface{}{parent},
+				"hostnames":  []interface{}{host},
+				"rules": []interface{}{
+					map[string]interface{}{
+						"matches": []interface{}{
+							map[string]interface{}{"path": map[string]interface{}{"type": "PathPrefix", "value": "/"}},
+						},
+						"backendRefs": []interface{}{
+							map[string]interface{}{"name": instanceName, "port": p.port},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+// instanceGateway returns the Gateway of one instance: an HTTPS listener
+// for its hostname, using the Secret "<instance>-tls" that cert-manager's
+// gateway-shim issues because of the cluster-issuer annotation, and a plain
+// HTTP listener, as on the operator's Ingress. Both only admit routes from
+// the instance's namespace.
+func instanceGateway(namespace, instanceName, host, class string, labels map[string]interface{}) *unstructured.Unstructured {
+	allowed := map[string]interface{}{"namespaces": map[string]interface{}{"from": "Same"}}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "gateway.networking.k8s.io/v1",
+			"kind":       "Gateway",
+			"metadata": map[string]interface{}{
+				"name":        instanceName,
+				"namespace":   namespace,
+				"labels":      labels,
+				"annotations": map[string]interface{}{clusterIssuerAnnotation: "letsencrypt-prod"},
+			},
+			"spec": map[string]interface{}{
+				"gatewayClassName": class,
+				"listeners": []interface{}{
+					map[string]interface{}{
+						"name":     httpsListener,
+						"hostname": host,
+						"port":     int64(443),
+						"protocol": "HTTPS",
+						"tls": map[string]interface{}{
+							"mode": "Terminate",
+							"certificateRefs": []interface{}{
+								map[string]interface{}{"kind": "Secret", "name": fmt.Sprintf("%s-tls", instanceName)},
+							},
+						},
+						"allowedRoutes": allowed,
+					},
+					map[string]interface{}{
+						"name":          "http",
+						"hostname":      host,
+						"port":          int64(80),
+						"protocol":      "HTTP",
+						"allowedRoutes": allowed,
+					},
+				},
+			},
+		},
+	}
+}
+
+// routed waits for the instance's Gateway, if it has one, to get an address
+// and then for the route to be accepted.
+func (p *gatewayRoute) routed(ctx context.Context, client dynamic.Interface, namespace, instanceName string) (string, error) {
+	gatewayName := p.gatewayNS + "/" + p.gateway
+	if p.perInstance {
+		gatewayName = namespace + "/" + instanceName
+		gw, err := client.Resource(gatewayGVR).Namespace(namespace).Get(ctx, instanceName, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return "gateway not created yet", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if addresses, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses"); len(addresses) == 0 {
+			return fmt.Sprintf("gateway %s has no address", instanceName), nil
+		}
+	}
+
+	route, err := client.Resource(httpRouteGVR).Namespace(namespace).Get(ctx, instanceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return "route not created yet", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, parent := range parents {
+		entry, ok := parent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		conditions, _, _ := unstructured.NestedSlice(entry, "conditions")
+		for _, c := range conditions {
+			cond, _ := c.(map[string]interface{})
+			if cond["type"] != "Accepted" {
+				continue
+			}
+			if cond["status"] == "True" {
+				return "", nil
+			}
+			return fmt.Sprintf("route %s not accepted: %v", instanceName, cond["message"]), nil
+		}
+	}
+	return fmt.Sprintf("route %s not accepted by gateway %s yet", instanceName, gatewayName), nil
+}
+
+// certificate reads the HTTPS listener of the instance's Gateway. Instances
+// on a shared Gateway have no certificate of their own.
+func (p *gatewayRoute) certificate(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured) (string, bool) {
+	if !p.perInstance {
+		return "", false
+	}
+	name := fmt.Sprintf("%s-tls", instance.GetName())
+	gw, err := client.Resource(gatewayGVR).Namespace(instance.GetNamespace()).Get(ctx, instance.GetName(), metav1.GetOptions{})
+	if err != nil {
+		// Until the Gateway can be read, assume it is as created.
+		return name, true
+	}
+	if ref := listenerCertificate(gw); ref != "" {
+		name = ref
+	}
+	return name, gw.GetAnnotations()[clusterIssuerAnnotation] != ""
+}
+
+// listenerCertificate returns the Secret referenced by the Gateway's HTTPS
+// listener.
+func listenerCertificate(gw *unstructured.Unstructured) string {
+	listeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	for _, l := range listeners {
+		listener, ok := l.(map[string]interface{})
+		if !ok || listener["name"] != httpsListener {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(listener, "tls", "certificateRefs")
+		if len(refs) > 0 {
+			if ref, ok := refs[0].(map[string]interface{}); ok {
+				name, _ := ref["name"].(string)
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// useWildcardGateway points the HTTPS listener of the instance's Gateway at
+// secretName and removes the cert-manager annotation, so that gateway-shim
+// stops managing the certificate.
+func (m *Manager) useWildcardGateway(ctx context.Context, client dynamic.Interface, instanceName, secretName string) error {
+	gw, err := client.Resource(gatewayGVR).Namespace(m.cfg.Namespace).Get(ctx, instanceName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("reading gateway %s: %v", instanceName, err)
+	}
+	listeners, _, _ := unstructured.NestedSlice(gw.Object, "spec", "listeners")
+	for i, l := range listeners {
+		if listener, ok := l.(map[string]interface{}); ok && listener["name"] == httpsListener {
+			unstructured.SetNestedSlice(listener, []interface{}{
+				map[string]interface{}{"kind": "Secret", "name": secretName},
+			}, "tls", "certificateRefs")
+			listeners[i] = listener
+		}
+	}
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations":     map[string]interface{}{clusterIssuerAnnotation: nil},
+			"resourceVersion": gw.GetResourceVersion(),
+		},
+		"spec": map[string]interface{}{"listeners": listeners},
+	}
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = client.Resource(gatewayGVR).Namespace(m.cfg.Namespace).Patch(ctx, instanceName, types.MergePatchType, body, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("patching gateway %s: %v", instanceName, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package k8s
+
+import (
+	"strconv"
+	"time"
+)
+
+// Annotations recording an instance's health-check settings.
+const (
+	healthPathAnnotation     = annotationPrefix + "health-path"
+	healthStatusAnnotation   = annotationPrefix + "health-status"
+	healthIntervalAnnotation = annotationPrefix + "health-interval"
+)
+
+// HealthCheck overrides how the orchestrator probes an instance. Zero fields
+// fall back to the service-wide defaults.
+type HealthCheck struct {
+	Path           string        // HTTP path requested on the instance endpoint
+	ExpectedStatus int           // Status code that counts as healthy
+	Interval       time.Duration // Time between probes
+}
+
+// annotate records the non-zero settings in annotations.
+func (hc *HealthCheck) annotate(annotations map[string]interface{}) {
+	if hc == nil {
+		return
+	}
+	if hc.Path != "" {
+		annotations[healthPathAnnotation] = hc.Path
+	}
+	if hc.ExpectedStatus != 0 {
+		annotations[healthStatusAnnotation] = strconv.Itoa(hc.ExpectedStatus)
+	}
+	if hc.Interval != 0 {
+		annotations[healthIntervalAnnotation] = hc.Interval.String()
+	}
+}
+
+// healthCheckFrom reads the settings recorded by annotate, returning nil
+// when there are none. Malformed values are ignored.
+func healthCheckFrom(annotations map[string]string) *HealthCheck {
+	hc := &HealthCheck{Path: annotations[healthPathAnnotation]}
+	hc.ExpectedStatus, _ = strconv.Atoi(annotations[healthStatusAnnotation])
+	hc.Interval, _ = time.ParseDuration(annotations[healthIntervalAnnotation])
+	if *hc == (HealthCheck{}) {
+		return nil
+	}
+	return hc
+}
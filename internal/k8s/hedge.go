@@ -0,0 +1,218 @@
+package k8s
+
+import (
+	"context"
+	"expvar"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+var (
+	hedgedRequests = expvar.NewInt("kube_hedged_requests")
+	hedgeWins      = expvar.NewInt("kube_hedge_wins")
+)
+
+const (
+	// hedgeWindow is how many recent read latencies the adaptive hedge
+	// delay is computed from, and hedgeMinSamples how many are needed
+	// before reads are hedged at all.
+	hedgeWindow     = 256
+	hedgeMinSamples = 32
+	// hedgeRecompute is how often, in observed reads, the p95 is
+	// recomputed.
+	hedgeRecompute = 16
+)
+
+// hedger holds the state shared by the hedging transports of one cluster
+// target: the recent read latencies and the budget of hedged reads.
+type hedger struct {
+	fixed    time.Duration // Hedge delay; 0 for the p95 of recent reads
+	maxRatio float64       // Largest fraction of reads that may be hedged
+
+	reads  atomic.Int64
+	hedges atomic.Int64
+	p95    atomic.Int64 // Nanoseconds; 0 until there are enough samples
+
+	mu        sync.Mutex
+	latencies []time.Duration // Ring buffer of the last hedgeWindow reads
+	next      int
+	observed  int
+}
+
+// newHedger returns the hedger configured by cfg, or nil when hedging is
+// off.
+func newHedger(cfg *config.Config) *hedger {
+	if !cfg.KubeHedgeReads {
+		return nil
+	}
+	return &hedger{fixed: cfg.KubeHedgeDelay, maxRatio: cfg.KubeHedgeMaxRatio}
+}
+
+// wrap returns rt hedged by h, for rest.Config.Wrap.
+func (h *hedger) wrap(rt http.RoundTripper) http.RoundTripper {
+	return &hedgingTransport{base: rt, h: h}
+}
+
+// observe records the latency of a completed read.
+func (h *hedger) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < hedgeWindow {
+		h.latencies = append(h.latencies, d)
+	} else {
+		h.latencies[h.next] = d
+		h.next = (h.next + 1) % hedgeWindow
+	}
+	h.observed++
+	if len(h.latencies) >= hedgeMinSamples && h.observed%hedgeRecompute == 0 {
+		sorted := append([]time.Duration(nil), h.latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		h.p95.Store(int64(sorted[len(sorted)*95/100]))
+	}
+}
+
+// delay returns how long to wait for a read before hedging it, and false
+// when reads are not hedged yet because the p95 is not known.
+func (h *hedger) delay() (time.Duration, bool) {
+	d := h.fixed
+	if d == 0 {
+		d = time.Duration(h.p95.Load())
+	}
+	return d, d > 0
+}
+
+// allow reports whether another read may be hedged within the budget, and
+// counts it if so.
+func (h *hedger) allow() bool {
+	if float64(h.hedges.Load()+1) > h.maxRatio*float64(h.reads.Load()) {
+		return false
+	}
+	h.hedges.Add(1)
+	return true
+}
+
+// hedgingTransport sends a second, identical request when a read has not
+// been answered within the hedge delay, and returns whichever response
+// arrives first, cancelling the other. Only reads are hedged: GETs that are
+// not watches or followed logs, which are safe to repeat and end promptly.
+type hedgingTransport struct {
+	base http.RoundTripper
+	h    *hedger
+}
+
+// hedgeable reports whether req is a read that may be sent twice.
+func hedgeable(req *http.Request) bool {
+	if req.Method != http.MethodGet || req.Body != nil && req.Body != http.NoBody {
+		return false
+	}
+	q := req.URL.Query()
+	return q.Get("watch") != "true" && q.Get("follow") != "true"
+}
+
+// attempt is the outcome of one of the requests of a hedged read.
+type attempt struct {
+	resp   *http.Response
+	err    error
+	hedge  bool
+	cancel context.CancelFunc
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !hedgeable(req) {
+		return t.base.RoundTrip(req)
+	}
+	t.h.reads.Add(1)
+	results := make(chan attempt, 2)
+	var cancels [2]context.CancelFunc
+	send := func(hedge bool) {
+		ctx, cancel := context.WithCancel(req.Context())
+		i := 0
+		if hedge {
+			i = 1
+		}
+		cancels[i] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := t.base.RoundTrip(req.Clone(ctx))
+			if err == nil {
+				t.h.observe(time.Since(start))
+			}
+			results <- attempt{resp: resp, err: err, hedge: hedge, cancel: cancel}
+		}()
+	}
+	send(false)
+
+	d, ok := t.h.delay()
+	if !ok {
+		return finish(<-results)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case res := <-results:
+		return finish(res)
+	case <-req.Context().Done():
+		return finish(<-results)
+	case <-timer.C:
+	}
+	if !t.h.allow() {
+		return finish(<-results)
+	}
+	hedgedRequests.Add(1)
+	send(true)
+
+	first := <-results
+	if first.err != nil {
+		// The other request may still succeed.
+		first.cancel()
+		return finish(<-results)
+	}
+	// Abandon the slower request.
+	if first.hedge {
+		hedgeWins.Add(1)
+		cancels[0]()
+	} else {
+		cancels[1]()
+	}
+	go discard(results)
+	return finish(first)
+}
+
+// finish returns the response of res, whose request context is cancelled
+// once its body is closed, or its error.
+func finish(res attempt) (*http.Response, error) {
+	if res.err != nil {
+		res.cancel()
+		return nil, res.err
+	}
+	res.resp.Body = &cancelOnClose{ReadCloser: res.resp.Body, cancel: res.cancel}
+	return res.resp, nil
+}
+
+// discard waits for the request that lost a hedged read, which has been
+// cancelled, and closes its response.
+func discard(results <-chan attempt) {
+	res := <-results
+	res.cancel()
+	if res.resp != nil {
+		res.resp.Body.Close()
+	}
+}
+
+// cancelOnClose cancels a request's context when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
@@ -0,0 +1,53 @@
+package k8s
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// dnsLabelRe matches a DNS label in the lowercase form hostnames are
+// created in.
+var dnsLabelRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// CheckHostname reports whether host is a valid DNS name for an ingress
+// host and its certificate: labels of 1 to 63 lowercase letters, digits and
+// '-', not starting or ending with '-', and at most 253 characters in all.
+func CheckHostname(host string) error {
+	if len(host) > 253 {
+		return fmt.Errorf("hostname %q is %d characters long; at most 253 are allowed", host, len(host))
+	}
+	for _, label := range strings.Split(host, ".") {
+		switch {
+		case label == "":
+			return fmt.Errorf("hostname %q has an empty label", host)
+		case len(label) > 63:
+			return fmt.Errorf("hostname %q: label %q is %d characters long; at most 63 are allowed", host, label, len(label))
+		case !dnsLabelRe.MatchString(label):
+			return fmt.Errorf("hostname %q: label %q must hold only lowercase letters, digits and '-', and start and end with a letter or digit", host, label)
+		}
+	}
+	return nil
+}
+
+// checkInstanceHost validates the hostname an instance would be served on,
+// and refuses instance names reserved for the service's own hosts. Errors
+// are *InvalidSpecError, so that the caller gets a clear 400 instead of a
+// certificate that can never be issued.
+func checkInstanceHost(cfg *config.Config, instanceName, env string) error {
+	if slices.Contains(cfg.ReservedInstanceNames, instanceName) {
+		return &InvalidSpecError{Message: fmt.Sprintf("instance name %q is reserved", instanceName)}
+	}
+	if err := CheckHostname(instanceHost(cfg.Domain, instanceName, env)); err != nil {
+		return &InvalidSpecError{Message: err.Error()}
+	}
+	if host := internalHost(cfg, instanceName, env); host != "" {
+		if err := CheckHostname(host); err != nil {
+			return &InvalidSpecError{Message: err.Error()}
+		}
+	}
+	return nil
+}
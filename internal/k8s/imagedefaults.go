@@ -0,0 +1,131 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// imageDigest matches an image digest such as "sha256:<64 hex digits>".
+var imageDigest = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ImageSettings are how an instance pulls its image. Empty fields inherit.
+type ImageSettings struct {
+	Tag string `json:"tag,omitempty"`
+	// Digest, when set, is written to spec.image.digest, which the operator
+	// pulls in preference to the tag; digest pinning then leaves it as is.
+	Digest string `json:"digest,omitempty"`
+	// PullPolicy is Always, IfNotPresent or Never.
+	PullPolicy string `json:"pullPolicy,omitempty"`
+	// PullSecret names the Secret the image is pulled with.
+	PullSecret string `json:"pullSecret,omitempty"`
+}
+
+// builtinImage is what instances get when no image defaults are configured.
+var builtinImage = ImageSettings{
+	Tag:        "latest",
+	PullPolicy: "Always",
+	PullSecret: imagePullSecret,
+}
+
+// ImageDefaults holds the image settings of new instances, layered from
+// least to most specific: the built-in settings, Default, the plan's and
+// the environment's. Only the fields a layer sets replace those below it.
+type ImageDefaults struct {
+	Default      ImageSettings            `json:"default"`
+	Plans        map[string]ImageSettings `json:"plans,omitempty"`
+	Environments map[string]ImageSettings `json:"environments,omitempty"`
+}
+
+// LoadImageDefaults reads image defaults from a YAML or JSON file of the
+// form {"default": {...}, "plans": {"<plan>": {...}}, "environments":
+// {"<environment>": {...}}}. An empty path yields nil, which keeps the
+// built-in settings.
+func LoadImageDefaults(path string) (*ImageDefaults, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading image defaults: %v", err)
+	}
+	var d ImageDefaults
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("parsing image defaults %s: %v", path, err)
+	}
+	if err := d.Default.validate(); err != nil {
+		return nil, fmt.Errorf("default image settings: %v", err)
+	}
+	for plan, s := range d.Plans {
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("image settings for plan %q: %v", plan, err)
+		}
+	}
+	for env, s := range d.Environments {
+		if !ValidEnvironment(env) {
+			return nil, fmt.Errorf("image settings for unknown environment %q", env)
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("image settings for environment %q: %v", env, err)
+		}
+	}
+	return &d, nil
+}
+
+// validate checks the fields that are set.
+func (s ImageSettings) validate() error {
+	switch s.PullPolicy {
+	case "", "Always", "IfNotPresent", "Never":
+	default:
+		return fmt.Errorf("invalid pullPolicy %q: must be Always, IfNotPresent or Never", s.PullPolicy)
+	}
+	if s.Digest != "" && !imageDigest.MatchString(s.Digest) {
+		return fmt.Errorf("invalid digest %q: must be sha256:<hex>", s.Digest)
+	}
+	return nil
+}
+
+// over returns s with the fields set in o replacing its own.
+func (s ImageSettings) over(o ImageSettings) ImageSettings {
+	if o.Tag != "" {
+		s.Tag = o.Tag
+	}
+	if o.Digest != "" {
+		s.Digest = o.Digest
+	}
+	if o.PullPolicy != "" {
+		s.PullPolicy = o.PullPolicy
+	}
+	if o.PullSecret != "" {
+		s.PullSecret = o.PullSecret
+	}
+	return s
+}
+
+// For returns the image settings of a new instance on the plan in the
+// environment. A nil *ImageDefaults returns the built-in settings.
+func (d *ImageDefaults) For(plan, environment string) ImageSettings {
+	s := builtinImage
+	if d == nil {
+		return s
+	}
+	s = s.over(d.Default).over(d.Plans[plan])
+	if environment == "" {
+		environment = EnvProd
+	}
+	return s.over(d.Environments[environment])
+}
+
+// setsImageTag reports whether the profile picks its own image tag, which a
+// configured digest, being that of the configured tag, must not override. A
+// nil profile sets nothing.
+func (p *Profile) setsImageTag() bool {
+	if p == nil {
+		return false
+	}
+	_, found, _ := unstructured.NestedString(p.Spec, "image", "tag")
+	return found
+}
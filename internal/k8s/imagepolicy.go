@@ -0,0 +1,127 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// semverTag matches release versions such as "1.4.2" or "v2.0.0-rc.1".
+var semverTag = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`)
+
+// ImagePolicy restricts the images that instances may run.
+type ImagePolicy struct {
+	// Repositories lists the allowed image repositories; any repository is
+	// allowed when empty.
+	Repositories []string `json:"repositories,omitempty"`
+
+	// Tags is "semver" to allow release versions only (which rules out
+	// "latest"), a regular expression that must match the whole tag, or
+	// empty to allow any tag.
+	Tags string `json:"tags,omitempty"`
+
+	tags *regexp.Regexp
+}
+
+// ImagePolicies holds the policy for each plan. Plans without their own
+// policy use Default; a plan's policy replaces Default rather than merging
+// with it.
+type ImagePolicies struct {
+	Default *ImagePolicy            `json:"default,omitempty"`
+	Plans   map[string]*ImagePolicy `json:"plans,omitempty"`
+}
+
+// LoadImagePolicies reads image policies from a YAML or JSON file of the form
+// {"default": {...}, "plans": {"<plan>": {...}}}. An empty path yields nil,
+// which allows every image.
+func LoadImagePolicies(path string) (*ImagePolicies, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading image policies: %v", err)
+	}
+	var p ImagePolicies
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing image policies %s: %v", path, err)
+	}
+	if err := p.Default.compile(); err != nil {
+		return nil, fmt.Errorf("default image policy: %v", err)
+	}
+	for plan, policy := range p.Plans {
+		if err := policy.compile(); err != nil {
+			return nil, fmt.Errorf("image policy for plan %q: %v", plan, err)
+		}
+	}
+	return &p, nil
+}
+
+// compile prepares the tag pattern. A nil policy is valid.
+func (p *ImagePolicy) compile() error {
+	if p == nil {
+		return nil
+	}
+	switch p.Tags {
+	case "":
+	case "semver":
+		p.tags = semverTag
+	default:
+		re, err := regexp.Compile("^(?:" + p.Tags + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid tag pattern: %v", err)
+		}
+		p.tags = re
+	}
+	return nil
+}
+
+// Check returns an *InvalidSpecError if the plan's policy does not allow the
+// image. A nil *ImagePolicies allows everything.
+func (p *ImagePolicies) Check(plan, repository, tag string) error {
+	if p == nil {
+		return nil
+	}
+	policy := p.Default
+	if planPolicy, ok := p.Plans[plan]; ok {
+		policy = planPolicy
+	}
+	if policy == nil {
+		return nil
+	}
+	if len(policy.Repositories) > 0 && !contains(policy.Repositories, repository) {
+		return &InvalidSpecError{Message: fmt.Sprintf("image repository %q is not allowed for plan %q (allowed: %s)",
+			repository, plan, strings.Join(policy.Repositories, ", "))}
+	}
+	if policy.tags != nil && !policy.tags.MatchString(tag) {
+		want := fmt.Sprintf("match %q", policy.Tags)
+		if policy.Tags == "semver" {
+			want = "be a semantic version"
+		}
+		return &InvalidSpecError{Message: fmt.Sprintf("image tag %q is not allowed for plan %q: must %s", tag, plan, want)}
+	}
+	return nil
+}
+
+// checkInstance applies Check to an OpenClawInstance in the canonical
+// version, optionally with its tag replaced by tag.
+func (p *ImagePolicies) checkInstance(obj *unstructured.Unstructured, tag string) error {
+	repository, _, _ := unstructured.NestedString(obj.Object, "spec", "image", "repository")
+	if tag == "" {
+		tag, _, _ = unstructured.NestedString(obj.Object, "spec", "image", "tag")
+	}
+	return p.Check(obj.GetLabels()["plan"], repository, tag)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
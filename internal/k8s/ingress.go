@@ -0,0 +1,212 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// Ingress providers selectable with INGRESS_PROVIDER.
+const (
+	IngressNginx      = "nginx"       // ingress-nginx
+	IngressTraefik    = "traefik"     // Traefik's Kubernetes Ingress provider
+	IngressGatewayAPI = "gateway-api" // An HTTPRoute attached to a shared Gateway
+)
+
+// ValidIngressProvider reports whether p names an ingress provider.
+func ValidIngressProvider(p string) bool {
+	return p == IngressNginx || p == IngressTraefik || p == IngressGatewayAPI
+}
+
+// ingressProvider decides how traffic reaches an instance: what the
+// operator is asked to create through spec.networking.ingress, which
+// namespaces the instance's NetworkPolicy admits, and which routing objects
+// the orchestrator creates itself.
+type ingressProvider interface {
+	// ingress returns spec.networking.ingress for the instance.
+	ingress(instanceName, host string) map[string]interface{}
+	// namespaces returns the namespaces the ingress controller runs in.
+	namespaces() []string
+	// routes returns the Gateway API objects to create alongside the
+	// instance.
+	routes(namespace, instanceName, host string) []*unstructured.Unstructured
+	// routed returns why traffic does not reach the instance yet, or "" once
+	// it does. An error means the routing objects could not be read.
+	routed(ctx context.Context, client dynamic.Interface, namespace, instanceName string) (string, error)
+	// certificate returns the instance's TLS Secret, which is also the name
+	// of its Certificate, and whether cert-manager issues it.
+	certificate(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured) (string, bool)
+}
+
+// ingressProviderFor returns the provider selected by cfg.IngressProvider,
+// ingress-nginx when it is unset or unknown.
+func ingressProviderFor(cfg *config.Config) ingressProvider {
+	switch cfg.IngressProvider {
+	case IngressTraefik:
+		return &ingressClass{
+			class: envDefault(cfg.IngressClass, "traefik"),
+			ns:    nsDefault(cfg.IngressNamespaces, "traefik"),
+			annotations: map[string]interface{}{
+				clusterIssuerAnnotation:                            "letsencrypt-prod",
+				"traefik.ingress.kubernetes.io/router.entrypoints": "websecure",
+				"traefik.ingress.kubernetes.io/router.tls":         "true",
+			},
+		}
+	case IngressGatewayAPI:
+		return &gatewayRoute{
+			gateway:     cfg.IngressGatewayName,
+			gatewayNS:   cfg.IngressGatewayNamespace,
+			listener:    cfg.IngressGatewayListener,
+			perInstance: cfg.IngressGatewayTLS == GatewayTLSCertManager,
+			class:       cfg.IngressGatewayClass,
+			port:        int64(cfg.IngressBackendPort),
+			ns:          nsDefault(cfg.IngressNamespaces, cfg.IngressGatewayNamespace),
+		}
+	default:
+		return &ingressClass{
+			class: envDefault(cfg.IngressClass, "nginx"),
+			ns:    nsDefault(cfg.IngressNamespaces, "ingress-nginx"),
+			annotations: map[string]interface{}{
+				clusterIssuerAnnotation:                          "letsencrypt-prod",
+				"nginx.ingress.kubernetes.io/proxy-body-size":    "50m",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
+				"nginx.ingress.kubernetes.io/proxy-send-timeout": "3600",
+				"nginx.ingress.kubernetes.io/proxy-http-version": "1.1",
+				"nginx.ingress.kubernetes.io/upstream-hash-by":   "$binary_remote_addr",
+				"nginx.ingress.kubernetes.io/ssl-redirect":       "false",
+				"nginx.ingress.kubernetes.io/force-ssl-redirect": "false",
+			},
+		}
+	}
+}
+
+// envDefault returns v, or fallback when v is empty.
+func envDefault(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
+
+// nsDefault returns ns, or just fallback when ns is empty.
+func nsDefault(ns []string, fallback string) []string {
+	if len(ns) == 0 {
+		return []string{fallback}
+	}
+	return ns
+}
+
+// ingressClass has the operator create an Ingress of the given class, with
+// the controller's annotations and a cert-manager certificate.
+type ingressClass struct {
+	class       string
+	ns          []string
+	annotations map[string]interface{}
+}
+
+func (p *ingressClass) ingress(instanceName, host string) map[string]interface{} {
+	annotations := make(map[string]interface{}, len(p.annotations))
+	for k, v := range p.annotations {
+		annotations[k] = v
+	}
+	return map[string]interface{}{
+		"enabled":     true,
+		"className":   p.class,
+		"annotations": annotations,
+		"hosts": []map[string]interface{}{
+			{
+				"host": host,
+				"paths": []map[string]interface{}{
+					{"path": "/", "pathType": "Prefix"},
+				},
+			},
+		},
+		"tls": []map[string]interface{}{
+			{
+				"hosts":      []string{host},
+				"secretName": fmt.Sprintf("%s-tls", instanceName),
+			},
+		},
+		"security": map[string]interface{}{
+			"enableHSTS": false,
+			"forceHTTPS": false,
+		},
+	}
+}
+
+func (p *ingressClass) namespaces() []string { return p.ns }
+
+func (p *ingressClass) routes(namespace, instanceName, host string) []*unstructured.Unstructured {
+	return nil
+}
+
+// routed waits for the controller to give the instance's Ingress a load
+// balancer address. The internal Ingress, if any, does not gate readiness.
+func (p *ingressClass) routed(ctx context.Context, client dynamic.Interface, namespace, instanceName string) (string, error) {
+	ingresses, err := client.Resource(ingressGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,!%s", instanceLabel, instanceName, internalIngressLabel),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(ingresses.Items) == 0 {
+		return "ingress not created yet", nil
+	}
+	for _, ing := range ingresses.Items {
+		addresses, _, _ := unstructured.NestedSlice(ing.Object, "status", "loadBalancer", "ingress")
+		if len(addresses) == 0 {
+			return fmt.Sprintf("ingress %s has no load balancer address", ing.GetName()), nil
+		}
+	}
+	return "", nil
+}
+
+func (p *ingressClass) certificate(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured) (string, bool) {
+	return ingressCertificate(instance)
+}
+
+// createRoutes creates the ingress provider's Gateway API objects for a new
+// instance, owned by it so that they are garbage-collected with it.
+func (m *Manager) createRoutes(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured, host string) error {
+	for _, route := range ingressProviderFor(m.cfg).routes(m.cfg.Namespace, instance.GetName(), host) {
+		route.SetOwnerReferences([]metav1.OwnerReference{{
+			APIVersion: instance.GetAPIVersion(),
+			Kind:       instance.GetKind(),
+			Name:       instance.GetName(),
+			UID:        instance.GetUID(),
+		}})
+		gvr := httpRouteGVR
+		if route.GetKind() == "Gateway" {
+			gvr = gatewayGVR
+		}
+		if _, err := client.Resource(gvr).Namespace(m.cfg.Namespace).Create(ctx, route, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("creating %s %s: %v", route.GetKind(), route.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// createInternalIngress creates the Ingress serving a new instance under the
+// internal domain, owned by it, when internal exposure is on.
+func (m *Manager) createInternalIngress(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured, env string) error {
+	ing := internalIngress(m.cfg, m.cfg.Namespace, instance.GetName(), env)
+	if ing == nil {
+		return nil
+	}
+	ing.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: instance.GetAPIVersion(),
+		Kind:       instance.GetKind(),
+		Name:       instance.GetName(),
+		UID:        instance.GetUID(),
+	}})
+	if _, err := client.Resource(ingressGVR).Namespace(m.cfg.Namespace).Create(ctx, ing, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating internal Ingress %s: %v", ing.GetName(), err)
+	}
+	return nil
+}
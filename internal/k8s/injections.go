@@ -0,0 +1,128 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Containers are init containers and sidecars added to instances for
+// platform concerns such as log shipping or backups. Each is a Kubernetes
+// container spec, passed to the operator as is.
+type Containers struct {
+	InitContainers []map[string]interface{} `json:"initContainers,omitempty"`
+	Sidecars       []map[string]interface{} `json:"sidecars,omitempty"`
+}
+
+// Injections holds the containers added to new instances. An instance gets
+// Default's, its plan's and its environment's, in that order; a container
+// named like an earlier one replaces it.
+type Injections struct {
+	Default      Containers            `json:"default"`
+	Plans        map[string]Containers `json:"plans,omitempty"`
+	Environments map[string]Containers `json:"environments,omitempty"`
+}
+
+// LoadInjections reads container injections from a YAML or JSON file of the
+// form {"default": {...}, "plans": {"<plan>": {...}}, "environments":
+// {"<environment>": {...}}}. An empty path yields nil, which injects
+// nothing.
+func LoadInjections(path string) (*Injections, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading container injections: %v", err)
+	}
+	var in Injections
+	if err := yaml.Unmarshal(data, &in); err != nil {
+		return nil, fmt.Errorf("parsing container injections %s: %v", path, err)
+	}
+	if err := in.Default.validate(); err != nil {
+		return nil, fmt.Errorf("default container injections: %v", err)
+	}
+	for plan, c := range in.Plans {
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("container injections for plan %q: %v", plan, err)
+		}
+	}
+	for env, c := range in.Environments {
+		if !ValidEnvironment(env) {
+			return nil, fmt.Errorf("container injections for unknown environment %q", env)
+		}
+		if err := c.validate(); err != nil {
+			return nil, fmt.Errorf("container injections for environment %q: %v", env, err)
+		}
+	}
+	return &in, nil
+}
+
+// validate checks that every container has a unique valid name and an
+// image.
+func (c Containers) validate() error {
+	seen := map[string]bool{}
+	for _, list := range [][]map[string]interface{}{c.InitContainers, c.Sidecars} {
+		for _, container := range list {
+			name, _ := container["name"].(string)
+			if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+				return fmt.Errorf("invalid container name %q: %s", name, errs[0])
+			}
+			if seen[name] {
+				return fmt.Errorf("container %q is defined twice", name)
+			}
+			seen[name] = true
+			if image, _ := container["image"].(string); image == "" {
+				return fmt.Errorf("container %q has no image", name)
+			}
+		}
+	}
+	return nil
+}
+
+// apply appends the containers for the plan and environment recorded in an
+// OpenClawInstance's labels to its spec.initContainers and spec.sidecars,
+// after any a profile set. A nil *Injections changes nothing.
+func (in *Injections) apply(instance *unstructured.Unstructured) error {
+	if in == nil {
+		return nil
+	}
+	labels := instance.GetLabels()
+	layers := []Containers{in.Default, in.Plans[labels["plan"]], in.Environments[instanceEnvironment(labels)]}
+	for _, field := range []string{"initContainers", "sidecars"} {
+		list, _, _ := unstructured.NestedSlice(instance.Object, "spec", field)
+		for _, layer := range layers {
+			added := layer.InitContainers
+			if field == "sidecars" {
+				added = layer.Sidecars
+			}
+			for _, container := range added {
+				// Injections were decoded from JSON, so copying cannot fail.
+				c, _ := copyJSON(container)
+				list = withContainer(list, c)
+			}
+		}
+		if len(list) == 0 {
+			continue
+		}
+		if err := unstructured.SetNestedSlice(instance.Object, list, "spec", field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withContainer returns list with c in place of the container of the same
+// name, or appended if there is none.
+func withContainer(list []interface{}, c map[string]interface{}) []interface{} {
+	for i, existing := range list {
+		if m, ok := existing.(map[string]interface{}); ok && m["name"] == c["name"] {
+			list[i] = c
+			return list
+		}
+	}
+	return append(list, c)
+}
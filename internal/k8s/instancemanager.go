@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"context"
+	"time"
+)
+
+// InstanceManager is the set of tenant instance operations the API and the
+// background loops rely on. *Manager implements it against a cluster;
+// *FakeManager implements it in memory for local development.
+type InstanceManager interface {
+	Bootstrap(ctx context.Context) error
+
+	CreateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error)
+	AdoptInstance(ctx context.Context, tenantID, instanceName string, opts CreateOptions) (*InstanceInfo, bool, error)
+	ReserveInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, Reservation, error)
+	UseReservations(src ReservationSource)
+	UseExportStore(store ExportStore)
+	ResumeCreate(ctx context.Context, tenantID, instanceName string) (*InstanceInfo, error)
+	RollbackCreate(ctx context.Context, tenantID, instanceName string) error
+	GetInstance(ctx context.Context, tenantID string) (*InstanceInfo, error)
+	ListInstances(ctx context.Context) ([]ClusterInstance, error)
+	TenantInstances(ctx context.Context, tenantID string) ([]*InstanceInfo, error)
+	DeleteInstance(ctx context.Context, tenantID string) error
+	DeleteInstanceRetainingStorage(ctx context.Context, tenantID string, until time.Time) ([]RetainedArtifact, error)
+	RetainedStorage(ctx context.Context) ([]RetainedArtifact, error)
+	ExpireRetainedStorage(ctx context.Context) ([]RetainedArtifact, error)
+	ReactivateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error)
+	PurgeInstance(ctx context.Context, tenantID string) (*PurgeReport, error)
+	SuspendInstance(ctx context.Context, tenantID string) error
+	ResumeInstance(ctx context.Context, tenantID string) error
+	LifecycleCapabilities(ctx context.Context) ([]LifecycleCapability, error)
+	UpgradeInstance(ctx context.Context, tenantID, imageTag string) error
+	SetChannel(ctx context.Context, tenantID, channel string) error
+	SetResourceRequests(ctx context.Context, tenantID, cpu, memory string) error
+	SetFeatureFlags(ctx context.Context, tenantID string, features map[string]bool) error
+	PlanDeletion(ctx context.Context, tenantID string, purge bool) ([]PurgedArtifact, error)
+	InstanceURL(instanceName, environment string) string
+	InstanceMetrics(ctx context.Context, tenantID string) (*InstanceMetrics, error)
+	RestartInstance(ctx context.Context, tenantID string) error
+	InstanceLogs(ctx context.Context, tenantID string, tail int) (string, error)
+	FailInstance(ctx context.Context, tenantID, reason string) (*Diagnostics, error)
+	RotateGatewayToken(ctx context.Context, tenantID, token string) error
+	MigrateGatewayTokens(ctx context.Context) (int, error)
+
+	CertificateStatus(ctx context.Context, tenantID string) (*CertificateStatus, error)
+	RetryCertificate(ctx context.Context, tenantID string) error
+	UseWildcardCertificate(ctx context.Context, tenantID, secretName string) error
+
+	StartExport(ctx context.Context, tenantID, exportID, uploadURL string) (*ExportInfo, error)
+	GetExport(ctx context.Context, tenantID, exportID string) (*ExportInfo, error)
+
+	StartPrePull(ctx context.Context, id, repository, tag string) (*PrePull, error)
+	PrePulls(ctx context.Context) ([]PrePull, error)
+	GetPrePull(ctx context.Context, id string) (*PrePull, error)
+	DeletePrePull(ctx context.Context, id string) error
+
+	Rebuild(ctx context.Context, opts RebuildOptions, instances []RebuildInstance) (*RebuildReport, error)
+
+	CheckPermissions(ctx context.Context) ([]PermissionCheck, error)
+	Capacity(ctx context.Context) (*CapacityReport, error)
+	OnCapacityAlert(fn func(ResourceUsage))
+
+	OnInstanceEvent(fn func(InstanceEvent))
+	Watch(ctx context.Context)
+	RunFailover(ctx context.Context)
+}
+
+var (
+	_ InstanceManager = (*Manager)(nil)
+	_ InstanceManager = (*FakeManager)(nil)
+)
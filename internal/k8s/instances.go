@@ -0,0 +1,112 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// A tenant may have several instances, for example a production and a
+// staging one. Operations on a tenant apply to all of them unless ctx
+// selects one with WithInstance or WithDefaultInstance. The default instance
+// is the tenant's oldest.
+
+type instanceKey struct{}
+
+// instanceSelection is the instance a context selects; an empty name selects
+// the tenant's default instance.
+type instanceSelection struct {
+	name string
+}
+
+// WithInstance returns a copy of ctx under which operations on a tenant only
+// apply to its instance named name.
+func WithInstance(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, instanceKey{}, instanceSelection{name: name})
+}
+
+// WithDefaultInstance returns a copy of ctx under which operations on a
+// tenant only apply to its default instance.
+func WithDefaultInstance(ctx context.Context) context.Context {
+	return context.WithValue(ctx, instanceKey{}, instanceSelection{})
+}
+
+// selectedInstance returns the instance ctx selects, "" for the default one,
+// and whether ctx selects one at all.
+func selectedInstance(ctx context.Context) (name string, ok bool) {
+	sel, ok := ctx.Value(instanceKey{}).(instanceSelection)
+	return sel.name, ok
+}
+
+// selectionKey identifies the selection of ctx in cache keys.
+func selectionKey(ctx context.Context) string {
+	name, ok := selectedInstance(ctx)
+	switch {
+	case !ok:
+		return "*"
+	case name == "":
+		return "default"
+	}
+	return "name:" + name
+}
+
+// sortInstances orders a tenant's instances oldest first, and so the default
+// one first, breaking ties by name.
+func sortInstances(items []unstructured.Unstructured) {
+	sort.SliceStable(items, func(i, j int) bool {
+		ti, tj := items[i].GetCreationTimestamp(), items[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return items[i].GetName() < items[j].GetName()
+	})
+}
+
+// listTenantInstances lists the tenant's instances selected by ctx, oldest
+// first, in the version the cluster serves.
+func (m *Manager) listTenantInstances(ctx context.Context, client dynamic.Interface, tenantID string) (*unstructured.UnstructuredList, error) {
+	list, err := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("tenant=%s", tenant.Canonical(tenantID)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing instances: %v", err)
+	}
+	sortInstances(list.Items)
+
+	name, ok := selectedInstance(ctx)
+	switch {
+	case !ok:
+	case name == "":
+		list.Items = list.Items[:min(len(list.Items), 1)]
+	default:
+		var selected []unstructured.Unstructured
+		for _, item := range list.Items {
+			if item.GetName() == name {
+				selected = append(selected, item)
+			}
+		}
+		list.Items = selected
+	}
+	return list, nil
+}
+
+// TenantInstances returns all of the tenant's instances, oldest and so the
+// default one first, whatever ctx selects.
+func (m *Manager) TenantInstances(ctx context.Context, tenantID string) ([]*InstanceInfo, error) {
+	all := context.WithValue(ctx, instanceKey{}, nil) // Drops any selection
+	list, err := m.listTenantInstances(all, m.readerFor(ctx), tenantID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*InstanceInfo, 0, len(list.Items))
+	for i := range list.Items {
+		m.current().adapter.decode(&list.Items[i])
+		out = append(out, m.instanceInfo(&list.Items[i]))
+	}
+	return out, nil
+}
@@ -0,0 +1,164 @@
+package k8s_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/envtest"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// startManager starts an envtest control plane with a FakeOperator and
+// returns a Manager pointed at it. The test is skipped when
+// KUBEBUILDER_ASSETS is unset.
+func startManager(t *testing.T, ctx context.Context, cacheTTL time.Duration) (*k8s.Manager, *envtest.FakeOperator) {
+	t.Helper()
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set; install binaries with setup-envtest")
+	}
+	env, err := envtest.Start(ctx, "", "tenants")
+	t.Cleanup(env.Stop)
+	if err != nil {
+		t.Fatalf("starting envtest: %v", err)
+	}
+
+	operator := envtest.NewFakeOperator(env)
+	go operator.Run(ctx)
+
+	cfg := env.Config()
+	cfg.InstanceCacheTTL = cacheTTL
+	cfg.DeleteVerifyTimeout = 20 * time.Second
+	m, err := k8s.NewManager(cfg)
+	if err != nil {
+		t.Fatalf("creating manager: %v", err)
+	}
+	if err := m.Bootstrap(ctx); err != nil {
+		t.Fatalf("bootstrap: %v", err)
+	}
+	return m, operator
+}
+
+// waitStatus polls GetInstance until the tenant's instance reports status.
+func waitStatus(t *testing.T, ctx context.Context, m *k8s.Manager, tenantID, status string) *k8s.InstanceInfo {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		info, err := m.GetInstance(ctx, tenantID)
+		if err != nil {
+			t.Fatalf("GetInstance: %v", err)
+		}
+		if info != nil && info.Status == status {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance of %s never reached %q, last %+v", tenantID, status, info)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func TestCreateGetDelete(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, _ := startManager(t, ctx, 0)
+	tenantID := "0b6f3c1e-8f1a-4c3e-9d2b-5a7e4f6c8d10"
+
+	created, err := m.CreateInstance(ctx, tenantID, k8s.CreateOptions{GatewayToken: "integration-token", Plan: "pro"})
+	if err != nil {
+		t.Fatalf("CreateInstance: %v", err)
+	}
+	if created.Name == "" {
+		t.Fatal("CreateInstance returned no instance name")
+	}
+
+	info, err := m.GetInstance(ctx, tenantID)
+	if err != nil {
+		t.Fatalf("GetInstance: %v", err)
+	}
+	if info == nil || info.Name != created.Name {
+		t.Fatalf("GetInstance = %+v, want instance %s", info, created.Name)
+	}
+	if info.GatewayToken != "integration-token" {
+		t.Errorf("gateway token = %q, want the one created with", info.GatewayToken)
+	}
+
+	if err := m.DeleteInstance(ctx, tenantID); err != nil {
+		t.Fatalf("DeleteInstance: %v", err)
+	}
+	info, err = m.GetInstance(ctx, tenantID)
+	if err != nil && !errors.Is(err, k8s.ErrNotFound) {
+		t.Fatalf("GetInstance after delete: %v", err)
+	}
+	if info != nil {
+		t.Fatalf("GetInstance after delete = %+v, want none", info)
+	}
+}
+
+func TestReconciliation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m, operator := startManager(t, ctx, 0)
+	operator.ReadyAfter = 500 * time.Millisecond
+	tenantID := "1c7a4d2f-9a2b-4d4f-8e3c-6b8f5a7d9e21"
+
+	if _, err := m.CreateInstance(ctx, tenantID, k8s.CreateOptions{GatewayToken: "integration-token"}); err != nil {
+		t.Fatalf("CreateInstance: %v", err)
+	}
+	info, err := m.GetInstance(ctx, tenantID)
+	if err != nil {
+		t.Fatalf("GetInstance: %v", err)
+	}
+	if info.Status != "starting" {
+		t.Errorf("status before reconciliation = %q, want starting", info.Status)
+	}
+	waitStatus(t, ctx, m, tenantID, "running")
+}
+
+func TestWatchInvalidatesCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A TTL far beyond the test's length, so that only the watch can make
+	// GetInstance see the operator's status change.
+	m, operator := startManager(t, ctx, time.Hour)
+	operator.ReadyAfter = 2 * time.Second
+	tenantID := "2d8b5e3a-ab3c-4e5a-9f4d-7c9a6b8e0f32"
+
+	events := make(chan k8s.InstanceEvent, 64)
+	m.OnInstanceEvent(func(ev k8s.InstanceEvent) {
+		if ev.TenantID == tenantID {
+			events <- ev
+		}
+	})
+	go m.Watch(ctx)
+
+	if _, err := m.CreateInstance(ctx, tenantID, k8s.CreateOptions{GatewayToken: "integration-token"}); err != nil {
+		t.Fatalf("CreateInstance: %v", err)
+	}
+	info, err := m.GetInstance(ctx, tenantID)
+	if err != nil {
+		t.Fatalf("GetInstance: %v", err)
+	}
+	if info.Status != "starting" {
+		t.Fatalf("status before reconciliation = %q, want starting", info.Status)
+	}
+
+	timeout := time.After(20 * time.Second)
+	for running := false; !running; {
+		select {
+		case ev := <-events:
+			running = ev.Info != nil && ev.Info.Status == "running"
+		case <-timeout:
+			t.Fatal("no watch event for the running instance")
+		}
+	}
+	info, err = m.GetInstance(ctx, tenantID)
+	if err != nil {
+		t.Fatalf("GetInstance: %v", err)
+	}
+	if info.Status != "running" {
+		t.Fatalf("status after watch event = %q, want running from a fresh read", info.Status)
+	}
+}
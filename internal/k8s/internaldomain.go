@@ -0,0 +1,148 @@
+package k8s
+
+import (
+	"fmt"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// internalIngressLabel marks the Ingress serving an instance under the
+// internal domain, so that it is told apart from the operator's public one.
+const internalIngressLabel = "tenant-provisioner/internal-ingress"
+
+// CheckInternalDomain validates the internal domain settings of cfg.
+// Internal exposure is off when INTERNAL_DOMAIN is unset, and then the other
+// settings must be unset too.
+func CheckInternalDomain(cfg *config.Config) error {
+	if cfg.InternalDomain == "" {
+		switch {
+		case cfg.InternalIngressClass != "":
+			return fmt.Errorf("INTERNAL_INGRESS_CLASS requires INTERNAL_DOMAIN")
+		case len(cfg.InternalIngressNamespaces) > 0:
+			return fmt.Errorf("INTERNAL_INGRESS_NAMESPACES requires INTERNAL_DOMAIN")
+		case cfg.InternalTLSSecret != "" || cfg.InternalClusterIssuer != "":
+			return fmt.Errorf("INTERNAL_TLS_SECRET and INTERNAL_CLUSTER_ISSUER require INTERNAL_DOMAIN")
+		}
+		return nil
+	}
+	switch {
+	case cfg.InternalDomain == cfg.Domain:
+		return fmt.Errorf("INTERNAL_DOMAIN must differ from TENANT_DOMAIN")
+	case cfg.InternalIngressClass == "":
+		return fmt.Errorf("INTERNAL_DOMAIN requires INTERNAL_INGRESS_CLASS")
+	case len(cfg.InternalIngressNamespaces) == 0:
+		return fmt.Errorf("INTERNAL_DOMAIN requires INTERNAL_INGRESS_NAMESPACES, the namespaces of the internal ingress controller")
+	case cfg.InternalTLSSecret != "" && cfg.InternalClusterIssuer != "":
+		return fmt.Errorf("INTERNAL_TLS_SECRET and INTERNAL_CLUSTER_ISSUER are mutually exclusive")
+	}
+	if err := CheckHostname(cfg.InternalDomain); err != nil {
+		return fmt.Errorf("INTERNAL_DOMAIN: %v", err)
+	}
+	return nil
+}
+
+// internalHost returns the hostname of an instance under the internal
+// domain, laid out as under the public one, or "" when internal exposure is
+// off.
+func internalHost(cfg *config.Config, instanceName, env string) string {
+	if cfg.InternalDomain == "" {
+		return ""
+	}
+	return instanceHost(cfg.InternalDomain, instanceName, env)
+}
+
+// InternalURL returns the URL of an instance under the internal domain, or
+// "" when internal exposure is off. It is plain HTTP unless the internal
+// Ingress terminates TLS.
+func InternalURL(cfg *config.Config, instanceName, env string) string {
+	host := internalHost(cfg, instanceName, env)
+	switch {
+	case host == "":
+		return ""
+	case cfg.InternalTLSSecret == "" && cfg.InternalClusterIssuer == "":
+		return "http://" + host
+	default:
+		return "https://" + host
+	}
+}
+
+// internalIngress returns the Ingress serving an instance under the internal
+// domain through the internal ingress controller, or nil when internal
+// exposure is off. Unlike the public Ingress it is created by the
+// orchestrator, not the operator, so that it can have its own class and
+// certificate: the Secret named by INTERNAL_TLS_SECRET, typically a wildcard
+// from an internal CA, or one INTERNAL_CLUSTER_ISSUER issues for the
+// instance. It carries the operator's instance label, so that deletes and
+// purges find it, and routes to the Service the operator names after the
+// instance.
+func internalIngress(cfg *config.Config, namespace, instanceName, env string) *unstructured.Unstructured {
+	host := internalHost(cfg, instanceName, env)
+	if host == "" {
+		return nil
+	}
+	annotations := map[string]interface{}{}
+	spec := map[string]interface{}{
+		"ingressClassName": cfg.InternalIngressClass,
+		"rules": []interface{}{
+			map[string]interface{}{
+				"host": host,
+				"http": map[string]interface{}{
+					"paths": []interface{}{
+						map[string]interface{}{
+							"path":     "/",
+							"pathType": "Prefix",
+							"backend": map[string]interface{}{
+								"service": map[string]interface{}{
+									"name": instanceName,
+									"port": map[string]interface{}{"number": int64(cfg.IngressBackendPort)},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	secret := cfg.InternalTLSSecret
+	if cfg.InternalClusterIssuer != "" {
+		secret = instanceName + "-internal-tls"
+		annotations[clusterIssuerAnnotation] = cfg.InternalClusterIssuer
+	}
+	if secret != "" {
+		spec["tls"] = []interface{}{
+			map[string]interface{}{"hosts": []interface{}{host}, "secretName": secret},
+		}
+	}
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "networking.k8s.io/v1",
+			"kind":       "Ingress",
+			"metadata": map[string]interface{}{
+				"name":      instanceName + "-internal",
+				"namespace": namespace,
+				"labels": map[string]interface{}{
+					instanceLabel:        instanceName,
+					internalIngressLabel: "true",
+				},
+				"annotations": annotations,
+			},
+			"spec": spec,
+		},
+	}
+}
+
+// allowedIngressNamespaces returns the namespaces an instance's
+// NetworkPolicy admits: the public ingress controller's and, with internal
+// exposure, the internal one's.
+func allowedIngressNamespaces(cfg *config.Config, ingress ingressProvider) []string {
+	namespaces := append([]string(nil), ingress.namespaces()...)
+	for _, ns := range cfg.InternalIngressNamespaces {
+		if !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,119 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Create steps reported to CreateOptions.Journal, in the order they happen.
+// StepSecretCreated is only reported with GatewayTokenSecrets.
+const (
+	StepSpecBuilt       = "spec_built"       // Name chosen and spec built; nothing created yet
+	StepSecretCreated   = "secret_created"   // Gateway token Secret applied
+	StepInstanceCreated = "instance_created" // OpenClawInstance created
+)
+
+// journal reports a completed create step to o.Journal, if set.
+func (o CreateOptions) journal(step, instanceName string) {
+	if o.Journal != nil {
+		o.Journal(step, instanceName)
+	}
+}
+
+// ResumeCreate finishes a create that was interrupted after the tenant's
+// instance was created: the gateway token Secret is given its owner and the
+// instance's routes and internal Ingress are created where missing. It
+// returns ErrNotFound when no instance of the name belongs to the tenant.
+func (m *Manager) ResumeCreate(ctx context.Context, tenantID, instanceName string) (*InstanceInfo, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	item, err := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).Get(ctx, instanceName, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading instance %s: %v", instanceName, err)
+	}
+	if item.GetLabels()["tenant"] != tenantID {
+		return nil, ErrNotFound
+	}
+	if m.cfg.GatewayTokenSecrets {
+		if err := m.ownGatewaySecret(ctx, client, item); err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+	}
+	env := instanceEnvironment(item.GetLabels())
+	if err := m.createRoutes(ctx, client, item, instanceHost(m.cfg.Domain, instanceName, env)); err != nil {
+		return nil, err
+	}
+	if err := m.createInternalIngress(ctx, client, item, env); err != nil {
+		return nil, err
+	}
+	m.current().adapter.decode(item)
+	return m.instanceInfo(item), nil
+}
+
+// RollbackCreate undoes a create that was interrupted before the tenant's
+// instance was created, by deleting the gateway token Secret it may have
+// left behind. A Secret is kept while an instance of its name exists, or
+// when it belongs to another tenant.
+func (m *Manager) RollbackCreate(ctx context.Context, tenantID, instanceName string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	client := m.clientFor(ctx)
+	_, err = client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).Get(ctx, instanceName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("reading instance %s: %v", instanceName, err)
+	}
+	secrets := client.Resource(secretGVR).Namespace(m.cfg.Namespace)
+	name := gatewaySecretName(instanceName)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading secret %s: %v", name, err)
+	}
+	if secret.GetLabels()["tenant"] != tenantID {
+		return nil
+	}
+	if err := secrets.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("deleting secret %s: %v", name, err)
+	}
+	return nil
+}
+
+// ResumeCreate returns the fake instance of the name, which a fake create
+// makes in one step, or ErrNotFound.
+func (f *FakeManager) ResumeCreate(ctx context.Context, tenantID, instanceName string) (*InstanceInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	inst, ok := f.instances[instanceName]
+	if !ok || inst.tenantID != tenantID {
+		return nil, ErrNotFound
+	}
+	info := inst.info
+	return &info, nil
+}
+
+// RollbackCreate does nothing: a fake create leaves nothing behind when it
+// does not finish.
+func (f *FakeManager) RollbackCreate(ctx context.Context, tenantID, instanceName string) error {
+	return nil
+}
@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// suspendedAnnotation records when an instance was suspended.
+const suspendedAnnotation = annotationPrefix + "suspended-at"
+
+// Lifecycle actions, as reported by LifecycleCapabilities.
+const (
+	ActionSuspend   = "suspend"
+	ActionResume    = "resume"
+	ActionRestart   = "restart"
+	ActionTerminate = "terminate"
+)
+
+// LifecycleActions lists every lifecycle action in a stable order.
+var LifecycleActions = []string{ActionSuspend, ActionResume, ActionRestart, ActionTerminate}
+
+// crdGVR is the resource of CustomResourceDefinitions.
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// LifecycleCapability reports whether the operator supports a lifecycle
+// action. Reason explains an unsupported action, or a supported one that
+// could not be verified.
+type LifecycleCapability struct {
+	Action    string `json:"action"`
+	Supported bool   `json:"supported"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// LifecycleCapabilities reports which lifecycle actions the cluster's
+// operator supports. Restarting and terminating only need pods and the CR to
+// be deletable; suspending and resuming need spec.suspend, which is looked up
+// in the schema of the negotiated OpenClawInstance version. If the CRD cannot
+// be read they are assumed supported, and the reason says so.
+func (m *Manager) LifecycleCapabilities(ctx context.Context) ([]LifecycleCapability, error) {
+	suspend := LifecycleCapability{Supported: true}
+	t := m.current()
+	crd, err := t.client.Resource(crdGVR).Get(ctx, "openclawinstances."+crdGroup, metav1.GetOptions{})
+	switch {
+	case err != nil && ctx.Err() != nil:
+		return nil, fmt.Errorf("reading OpenClawInstance CRD: %v", err)
+	case err != nil:
+		suspend.Reason = fmt.Sprintf("assumed: OpenClawInstance CRD could not be read: %v", err)
+	default:
+		suspend.Supported, suspend.Reason = crdHasSuspend(crd, t.adapter.version())
+	}
+
+	caps := make([]LifecycleCapability, 0, len(LifecycleActions))
+	for _, action := range LifecycleActions {
+		c := LifecycleCapability{Action: action, Supported: true}
+		if action == ActionSuspend || action == ActionResume {
+			c.Supported, c.Reason = suspend.Supported, suspend.Reason
+		}
+		caps = append(caps, c)
+	}
+	return caps, nil
+}
+
+// crdHasSuspend reports whether version of the CRD declares spec.suspend,
+// with the reason when it does not.
+func crdHasSuspend(crd *unstructured.Unstructured, version string) (bool, string) {
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok || v["name"] != version {
+			continue
+		}
+		props, found, _ := unstructured.NestedMap(v, "schema", "openAPIV3Schema", "properties", "spec", "properties")
+		if !found {
+			return false, fmt.Sprintf("OpenClawInstance %s has no spec schema", version)
+		}
+		if _, ok := props["suspend"]; !ok {
+			return false, fmt.Sprintf("OpenClawInstance %s has no spec.suspend", version)
+		}
+		return true, ""
+	}
+	return false, fmt.Sprintf("OpenClawInstance CRD does not serve %s", version)
+}
+
+// SuspendInstance stops the tenant's instances by setting spec.suspend, which
+// the operator honours by scaling the instance to zero while keeping its
+// volume. The instance reports status "suspended" until resumed.
+func (m *Manager) SuspendInstance(ctx context.Context, tenantID string) error {
+	return m.patchInstances(ctx, tenantID, fixedPatch(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{suspendedAnnotation: time.Now().UTC().Format(time.RFC3339)},
+		},
+		"spec": map[string]interface{}{"suspend": true},
+	}))
+}
+
+// ResumeInstance reverses SuspendInstance.
+func (m *Manager) ResumeInstance(ctx context.Context, tenantID string) error {
+	return m.patchInstances(ctx, tenantID, fixedPatch(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{suspendedAnnotation: nil},
+		},
+		"spec": map[string]interface{}{"suspend": nil},
+	}))
+}
+
+// UpgradeInstance rolls the tenant's instances to the given image tag,
+// pinning its digest when digest pinning is enabled. It returns an
+// *InvalidSpecError, and changes nothing, if the image policy of any
+// instance's plan does not allow the tag or the image cannot be verified.
+func (m *Manager) UpgradeInstance(ctx context.Context, tenantID, imageTag string) error {
+	return m.patchInstances(ctx, tenantID, func(instance *unstructured.Unstructured) (map[string]interface{}, error) {
+		repository, _, _ := unstructured.NestedString(instance.Object, "spec", "image", "repository")
+		if err := m.images.Check(instance.GetLabels()["plan"], m.mirrors.source(repository), imageTag); err != nil {
+			return nil, err
+		}
+		repository = m.mirrors.pull(repository)
+		digest, err := m.pinner.resolve(ctx, repository, imageTag)
+		if err != nil {
+			return nil, err
+		}
+		return upgradePatch(repository, imageTag, digest), nil
+	})
+}
+
+// SetChannel moves the tenant's instances to a release channel, recorded as
+// the "channel" label.
+func (m *Manager) SetChannel(ctx context.Context, tenantID, channel string) error {
+	return m.patchInstances(ctx, tenantID, fixedPatch(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{"channel": channel},
+		},
+	}))
+}
+
+// SetResourceRequests changes the CPU and memory requested by the tenant's
+// instances, leaving limits unchanged. Either value may be empty to keep it.
+func (m *Manager) SetResourceRequests(ctx context.Context, tenantID, cpu, memory string) error {
+	return m.patchInstances(ctx, tenantID, fixedPatch(requestsPatch(cpu, memory)))
+}
+
+// requestsPatch sets the non-empty resource requests.
+func requestsPatch(cpu, memory string) map[string]interface{} {
+	requests := map[string]interface{}{}
+	if cpu != "" {
+		requests["cpu"] = cpu
+	}
+	if memory != "" {
+		requests["memory"] = memory
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"resources": map[string]interface{}{"requests": requests},
+		},
+	}
+}
+
+// upgradePatch moves an instance to repository:tag; the repository changes
+// only when mirrors were configured after the instance was created. The
+// digest is always written, and removed when empty, so that an earlier pin
+// cannot outlive the upgrade.
+func upgradePatch(repository, tag, digest string) map[string]interface{} {
+	var pinned interface{}
+	if digest != "" {
+		pinned = digest
+	}
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"image": map[string]interface{}{"repository": repository, "tag": tag, "digest": pinned},
+		},
+	}
+}
+
+// fixedPatch returns a patchInstances callback applying the same patch to
+// every instance.
+func fixedPatch(patch map[string]interface{}) func(*unstructured.Unstructured) (map[string]interface{}, error) {
+	return func(*unstructured.Unstructured) (map[string]interface{}, error) { return patch, nil }
+}
+
+// patchInstances applies a JSON merge patch to every instance of the tenant.
+// It returns ErrNotFound if the tenant has none. The patch for each instance
+// is built by patchFor from the instance, decoded to the canonical version;
+// every patch is built before any is applied, so an error changes nothing.
+func (m *Manager) patchInstances(ctx context.Context, tenantID string, patchFor func(*unstructured.Unstructured) (map[string]interface{}, error)) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return m.patchLockedInstances(ctx, tenantID, patchFor)
+}
+
+// patchLockedInstances is patchInstances for callers holding the tenant lock.
+func (m *Manager) patchLockedInstances(ctx context.Context, tenantID string, patchFor func(*unstructured.Unstructured) (map[string]interface{}, error)) error {
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	resource := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return ErrNotFound
+	}
+
+	patches := make([][]byte, len(list.Items))
+	for i := range list.Items {
+		if err := checkVersion(ctx, &list.Items[i]); err != nil {
+			return err
+		}
+		instance := list.Items[i].DeepCopy()
+		m.current().adapter.decode(instance)
+		patch, err := patchFor(instance)
+		if err != nil {
+			return err
+		}
+		stampPatch(ctx, patch)
+		if rv := requiredVersion(ctx); rv != "" {
+			// A resourceVersion in a merge patch makes it conditional.
+			mergePatch(patch, map[string]interface{}{
+				"metadata": map[string]interface{}{"resourceVersion": rv},
+			})
+		}
+		if patches[i], err = json.Marshal(patch); err != nil {
+			return fmt.Errorf("encoding patch: %v", err)
+		}
+	}
+	for i, instance := range list.Items {
+		if _, err := resource.Patch(ctx, instance.GetName(), types.MergePatchType, patches[i], metav1.PatchOptions{}); err != nil {
+			if isPreconditionConflict(ctx, err) {
+				return ErrPreconditionFailed
+			}
+			return fmt.Errorf("patching tenant instance %s: %v", instance.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// tenantLocks serialises mutating operations per tenant, so that for
+// example a delete and a create for the same tenant cannot interleave and
+// leave an instance behind that the delete never saw. Locks are held in
+// this process only: with several replicas, mutations of one tenant that
+// reach different replicas are not serialised.
+type tenantLocks struct {
+	mu    sync.Mutex
+	locks map[string]*tenantLock
+}
+
+// tenantLock is one tenant's lock. sem holds a token while the lock is
+// held; waiters counts the holder and everyone queued, so that the entry
+// can be dropped once nobody needs it.
+type tenantLock struct {
+	sem     chan struct{}
+	waiters int
+}
+
+func newTenantLocks() *tenantLocks {
+	return &tenantLocks{locks: make(map[string]*tenantLock)}
+}
+
+// lock waits until no other mutation of tenantID is in progress and returns
+// the function that ends this one. It gives up when ctx is done.
+func (l *tenantLocks) lock(ctx context.Context, tenantID string) (func(), error) {
+	l.mu.Lock()
+	tl, ok := l.locks[tenantID]
+	if !ok {
+		tl = &tenantLock{sem: make(chan struct{}, 1)}
+		l.locks[tenantID] = tl
+	}
+	tl.waiters++
+	l.mu.Unlock()
+
+	select {
+	case tl.sem <- struct{}{}:
+		return func() {
+			<-tl.sem
+			l.release(tenantID, tl)
+		}, nil
+	case <-ctx.Done():
+		l.release(tenantID, tl)
+		return nil, fmt.Errorf("waiting for another operation on tenant %s: %v", tenantID, ctx.Err())
+	}
+}
+
+// release drops a holder or waiter of tl.
+func (l *tenantLocks) release(tenantID string, tl *tenantLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tl.waiters--
+	if tl.waiters == 0 {
+		delete(l.locks, tenantID)
+	}
+}
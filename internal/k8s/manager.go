@@ -4,14 +4,16 @@ package k8s
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
-	"encoding/hex"
 	"fmt"
+	"log"
 	"os"
-	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/mchatman/tenant-provisioner/internal/caller"
 	"github.com/mchatman/tenant-provisioner/internal/config"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,22 +21,55 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 )
 
 // Manager provides high-level operations on OpenClaw tenant instances inside a
 // single Kubernetes namespace.
 type Manager struct {
-	client dynamic.Interface
-	cfg    *config.Config
+	cfg   *config.Config
+	cache *instanceCache
+	locks *tenantLocks
+
+	clusterMu sync.RWMutex
+	targets   []*clusterTarget // In priority order
+	active    int              // Index into targets
+
+	capacity capacityLimits
+	names    nameStrategy
+	images   *ImagePolicies
+	defaults *ImageDefaults
+	mirrors  imageMirrors
+	inject   *Injections
+	pinner   *imagePinner
+	dns      *dnsChecker
+
+	clientsMu    sync.Mutex
+	impersonated map[impersonationKey]dynamic.Interface // Clients by config and caller
+
+	mu               sync.Mutex
+	handlers         []func(InstanceEvent)
+	capacityHandlers []func(ResourceUsage)
+	capacityAlerted  map[string]bool   // Dimensions currently above the alert threshold
+	reservations     ReservationSource // Names and capacity held for later creates
+	exports          ExportStore       // Export archives, removed by purges
 }
 
-var tenantGVR = schema.GroupVersionResource{
-	Group:    "openclaw.rocks",
-	Version:  "v1alpha1",
-	Resource: "openclawinstances",
-}
+// annotationPrefix namespaces the annotations the provisioner writes on the
+// objects it creates.
+const annotationPrefix = "tenant-provisioner/"
+
+// contactEmailAnnotation holds the address notified about an instance.
+const contactEmailAnnotation = annotationPrefix + "contact-email"
+
+// orgLabel records the organization of an instance's tenant.
+const orgLabel = "org"
+
+// DefaultImageRepository is the image instances run, and imagePullSecret
+// the Secret they pull it with.
+const (
+	DefaultImageRepository = "ghcr.io/openclaw/openclaw"
+	imagePullSecret        = "registry-wareit"
+)
 
 var networkPolicyGVR = schema.GroupVersionResource{
 	Group:    "networking.k8s.io",
@@ -43,54 +78,149 @@ var networkPolicyGVR = schema.GroupVersionResource{
 }
 
 // NewManager creates a Manager that operates in the namespace specified by cfg.
+// When several kubeconfig contexts are configured, the first healthy one in
+// priority order becomes active.
 func NewManager(cfg *config.Config) (*Manager, error) {
-	restCfg, err := getConfig()
+	targets, err := loadClusterTargets(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get k8s config: %v", err)
 	}
 
-	client, err := dynamic.NewForConfig(restCfg)
+	capacity, err := parseCapacityLimits(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create k8s client: %v", err)
+		return nil, err
+	}
+	names, err := parseNameStrategy(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Manager{
-		client: client,
-		cfg:    cfg,
-	}, nil
-}
+	images, err := LoadImagePolicies(cfg.ImagePolicyPath)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadImageDefaults(cfg.ImageDefaultsPath)
+	if err != nil {
+		return nil, err
+	}
+	inject, err := LoadInjections(cfg.InjectionsPath)
+	if err != nil {
+		return nil, err
+	}
+	pinner, err := newImagePinner(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-func getConfig() (*rest.Config, error) {
-	// Try KUBECONFIG_BASE64 environment variable first (for App Platform)
-	if kubeconfigBase64 := os.Getenv("KUBECONFIG_BASE64"); kubeconfigBase64 != "" {
-		kubeconfigBytes, err := base64.StdEncoding.DecodeString(kubeconfigBase64)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode KUBECONFIG_BASE64: %v", err)
+	m := &Manager{
+		cfg:      cfg,
+		cache:    newInstanceCache(cfg.InstanceCacheTTL),
+		locks:    newTenantLocks(),
+		targets:  targets,
+		capacity: capacity,
+		names:    names,
+		images:   images,
+		defaults: defaults,
+		mirrors:  newImageMirrors(cfg),
+		inject:   inject,
+		pinner:   pinner,
+		dns:      newDNSChecker(cfg),
+	}
+	if len(targets) > 1 {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if i := m.firstHealthy(ctx); i >= 0 {
+			m.active = i
+		} else {
+			log.Printf("no kubeconfig context is healthy, starting with %s", targets[0].name)
 		}
+	}
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		t.adapter = t.negotiateCRDVersion(ctx)
+		cancel()
+	}
+	log.Printf("using cluster context %s (%s/%s)", m.current().name, crdGroup, m.current().adapter.version())
+	return m, nil
+}
 
-		cfg, err := clientcmd.RESTConfigFromKubeConfig(kubeconfigBytes)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse kubeconfig: %v", err)
-		}
-		return cfg, nil
+// clientFor returns the client to use for a mutation, and for the reads a
+// mutation depends on. When caller impersonation is enabled and ctx carries
+// a caller, the client impersonates them so that cluster audit logs record
+// the real identity; otherwise the service account's client is returned.
+func (m *Manager) clientFor(ctx context.Context) dynamic.Interface {
+	target := m.current()
+	return m.impersonating(ctx, target.client, target.writeCfg)
+}
+
+// readerFor is clientFor for reads that serve lookups, such as status
+// polling, which are rate-limited apart from mutations.
+func (m *Manager) readerFor(ctx context.Context) dynamic.Interface {
+	target := m.current()
+	return m.impersonating(ctx, target.reader, target.readCfg)
+}
+
+// impersonates reports whether requests for ctx impersonate its caller: one
+// asserted by the authenticating proxy. Tenant and organization tokens act
+// as the service account.
+func (m *Manager) impersonates(ctx context.Context) bool {
+	if !m.cfg.ImpersonateCallers {
+		return false
 	}
+	id, ok := caller.FromContext(ctx)
+	return ok && id.Proxied
+}
+
+// maxImpersonatedClients bounds the impersonating clients kept; past it they
+// are dropped and built again as callers return.
+const maxImpersonatedClients = 256
 
-	// Try in-cluster config (for when running in K8s)
-	cfg, err := rest.InClusterConfig()
-	if err == nil {
-		return cfg, nil
+// impersonating returns client, or a client built from restCfg that
+// impersonates the caller of ctx when caller impersonation is enabled.
+// Clients are kept per config and identity.
+func (m *Manager) impersonating(ctx context.Context, client dynamic.Interface, restCfg *rest.Config) dynamic.Interface {
+	if !m.impersonates(ctx) {
+		return client
+	}
+	id, _ := caller.FromContext(ctx)
+	key := impersonationKey{cfg: restCfg, user: id.User, groups: strings.Join(id.Groups, "\n")}
+	m.clientsMu.Lock()
+	defer m.clientsMu.Unlock()
+	if c, ok := m.impersonated[key]; ok {
+		return c
 	}
 
-	// Fall back to kubeconfig file (for local development)
-	kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
-	return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	cfg := rest.CopyConfig(restCfg)
+	cfg.Impersonate = rest.ImpersonationConfig{
+		UserName: id.User,
+		Groups:   id.Groups,
+	}
+	impersonated, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		// NewForConfig only fails on malformed configs, which the service
+		// account config above already proved is not the case.
+		log.Printf("impersonation client for %s failed, using service account: %v", id.User, err)
+		return client
+	}
+	if m.impersonated == nil || len(m.impersonated) >= maxImpersonatedClients {
+		m.impersonated = make(map[impersonationKey]dynamic.Interface)
+	}
+	m.impersonated[key] = impersonated
+	return impersonated
+}
+
+// impersonationKey identifies a client impersonating a caller.
+type impersonationKey struct {
+	cfg    *rest.Config
+	user   string
+	groups string // Newline-separated
 }
 
 // buildEnvVars constructs the env var list for a new tenant instance.
 // It injects shared API keys from the orchestrator's own environment.
 func buildEnvVars(gatewayToken string) []map[string]interface{} {
 	envs := []map[string]interface{}{
-		{"name": "OPENCLAW_GATEWAY_TOKEN", "value": gatewayToken},
+		{"name": gatewayTokenEnv, "value": gatewayToken},
 		{"name": "NODE_ENV", "value": "production"},
 	}
 
@@ -107,38 +237,62 @@ func buildEnvVars(gatewayToken string) []map[string]interface{} {
 	return envs
 }
 
-func generateTenantInstanceName() (string, error) {
-	bytes := make([]byte, 4)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("tenant-%s", hex.EncodeToString(bytes)), nil
-}
-
 // buildInstanceSpec constructs the full OpenClawInstance CRD object ready for
 // creation in the cluster.
-func (m *Manager) buildInstanceSpec(instanceName, tenantID, gatewayToken string) *unstructured.Unstructured {
-	domain := m.cfg.Domain
+func buildInstanceSpec(ctx context.Context, cfg *config.Config, instanceName, tenantID string, opts CreateOptions) *unstructured.Unstructured {
+	domain := cfg.Domain
 
-	return &unstructured.Unstructured{
+	labels := map[string]interface{}{
+		"tenant": tenantID,
+		"app":    "tenant-instance",
+	}
+	if opts.Plan != "" {
+		labels["plan"] = opts.Plan
+	}
+	if opts.Profile != nil {
+		labels["profile"] = opts.Profile.Name
+	}
+	if opts.Channel != "" {
+		labels["channel"] = opts.Channel
+	}
+	if opts.Environment != "" {
+		labels[environmentLabel] = opts.Environment
+	}
+	if opts.Organization != "" {
+		labels[orgLabel] = opts.Organization
+	}
+	host := instanceHost(domain, instanceName, opts.Environment)
+	ingress := ingressProviderFor(cfg)
+	annotations := requestAnnotations(ctx)
+	for k, v := range opts.Annotations {
+		annotations[k] = v
+	}
+	if opts.ContactEmail != "" {
+		annotations[contactEmailAnnotation] = opts.ContactEmail
+	}
+	opts.HealthCheck.annotate(annotations)
+	for k, v := range costLabels(cfg, tenantID, opts) {
+		labels[k] = v
+	}
+	image := builtinImage.over(opts.image)
+
+	instance := &unstructured.Unstructured{
 		Object: map[string]interface{}{
-			"apiVersion": "openclaw.rocks/v1alpha1",
+			"apiVersion": crdGroup + "/v1alpha1",
 			"kind":       "OpenClawInstance",
 			"metadata": map[string]interface{}{
-				"name":      instanceName,
-				"namespace": m.cfg.Namespace,
-				"labels": map[string]interface{}{
-					"tenant": tenantID,
-					"app":    "tenant-instance",
-				},
+				"name":        instanceName,
+				"namespace":   cfg.Namespace,
+				"labels":      labels,
+				"annotations": annotations,
 			},
 			"spec": map[string]interface{}{
 				"image": map[string]interface{}{
-					"repository": "ghcr.io/openclaw/openclaw",
-					"tag":        "latest",
-					"pullPolicy": "Always",
+					"repository": DefaultImageRepository,
+					"tag":        image.Tag,
+					"pullPolicy": image.PullPolicy,
 					"pullSecrets": []map[string]interface{}{
-						{"name": "registry-wareit"},
+						{"name": image.PullSecret},
 					},
 				},
 				"config": map[string]interface{}{
@@ -158,44 +312,13 @@ func (m *Manager) buildInstanceSpec(instanceName, tenantID, gatewayToken string)
 						},
 					},
 				},
-				"env": buildEnvVars(gatewayToken),
+				"env": buildEnvVars(opts.GatewayToken),
 				"networking": map[string]interface{}{
-					"ingress": map[string]interface{}{
-						"enabled":   true,
-						"className": "nginx",
-						"annotations": map[string]interface{}{
-							"cert-manager.io/cluster-issuer":                 "letsencrypt-prod",
-							"nginx.ingress.kubernetes.io/proxy-body-size":    "50m",
-							"nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
-							"nginx.ingress.kubernetes.io/proxy-send-timeout": "3600",
-							"nginx.ingress.kubernetes.io/proxy-http-version": "1.1",
-							"nginx.ingress.kubernetes.io/upstream-hash-by":   "$binary_remote_addr",
-							"nginx.ingress.kubernetes.io/ssl-redirect":       "false",
-							"nginx.ingress.kubernetes.io/force-ssl-redirect": "false",
-						},
-						"hosts": []map[string]interface{}{
-							{
-								"host": fmt.Sprintf("%s.%s", instanceName, domain),
-								"paths": []map[string]interface{}{
-									{"path": "/", "pathType": "Prefix"},
-								},
-							},
-						},
-						"tls": []map[string]interface{}{
-							{
-								"hosts":      []string{fmt.Sprintf("%s.%s", instanceName, domain)},
-								"secretName": fmt.Sprintf("%s-tls", instanceName),
-							},
-						},
-						"security": map[string]interface{}{
-							"enableHSTS": false,
-							"forceHTTPS": false,
-						},
-					},
+					"ingress": ingress.ingress(instanceName, host),
 				},
 				"security": map[string]interface{}{
 					"networkPolicy": map[string]interface{}{
-						"allowedIngressNamespaces": []string{"ingress-nginx"},
+						"allowedIngressNamespaces": allowedIngressNamespaces(cfg, ingress),
 					},
 				},
 				"resources": map[string]interface{}{
@@ -217,23 +340,94 @@ func (m *Manager) buildInstanceSpec(instanceName, tenantID, gatewayToken string)
 			},
 		},
 	}
+	spec := instance.Object["spec"].(map[string]interface{})
+	if opts.Profile != nil {
+		applyProfile(spec, opts.Profile)
+	}
+	if image.Digest != "" && !opts.Profile.setsImageTag() {
+		spec["image"].(map[string]interface{})["digest"] = image.Digest
+	}
+	if len(opts.Features) > 0 {
+		spec["env"] = withFeatures(envSlice(spec["env"]), opts.Features)
+	}
+	if len(opts.RawConfig) > 0 {
+		withRawConfig(spec, opts.RawConfig)
+	}
+	if opts.Branding != nil {
+		withBranding(spec, opts.Branding)
+	}
+	if len(opts.Env) > 0 {
+		spec["env"] = withEnvOverrides(envSlice(spec["env"]), opts.Env)
+	}
+	if cfg.EgressProxyURL != "" {
+		spec["env"] = append(envSlice(spec["env"]), egressEnv(cfg, tenantID)...)
+	}
+	if opts.existingClaim != "" {
+		unstructured.SetNestedField(instance.Object, opts.existingClaim, "spec", "storage", "persistence", "existingClaim")
+	}
+	if opts.storageSize != "" {
+		unstructured.SetNestedField(instance.Object, opts.storageSize, "spec", "storage", "persistence", "size")
+	}
+	if cfg.GatewayTokenSecrets {
+		spec["env"] = withGatewayTokenEntry(envSlice(spec["env"]), gatewayTokenRef(gatewaySecretName(instanceName)))
+		annotations[tokenDigestAnnotation] = tokenDigest(opts.GatewayToken)
+	}
+	return instance
 }
 
 // Bootstrap ensures namespace-level resources that must exist before any tenant
 // is provisioned are present and correctly configured. Safe to call on every
 // startup — it uses server-side apply so it is idempotent.
 func (m *Manager) Bootstrap(ctx context.Context) error {
+	return m.bootstrapTarget(ctx, m.current())
+}
+
+// bootstrapTarget applies the bootstrap objects to the cluster of t.
+func (m *Manager) bootstrapTarget(ctx context.Context, t *clusterTarget) error {
+	_, err := t.client.Resource(networkPolicyGVR).Namespace(m.cfg.Namespace).Apply(
+		ctx,
+		"allow-bluefairy-proxy",
+		bootstrapPolicy(m.cfg.Namespace),
+		metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true},
+	)
+	if err != nil {
+		return fmt.Errorf("bootstrap allow-bluefairy-proxy: %w", err)
+	}
+	if m.cfg.EgressProxyEnforce {
+		_, err := t.client.Resource(networkPolicyGVR).Namespace(m.cfg.Namespace).Apply(
+			ctx,
+			egressPolicyName,
+			egressPolicy(m.cfg.Namespace, m.cfg),
+			metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true},
+		)
+		if err != nil {
+			return fmt.Errorf("bootstrap %s: %w", egressPolicyName, err)
+		}
+	}
+	if err := m.enrollMesh(ctx, t.client, m.cfg.Namespace); err != nil {
+		return fmt.Errorf("bootstrap mesh enrollment: %w", err)
+	}
+	if err := m.canonicalizeTenantLabels(ctx, t.client); err != nil {
+		return fmt.Errorf("bootstrap tenant labels: %w", err)
+	}
+
+	return nil
+}
+
+// bootstrapPolicy returns the allow-bluefairy-proxy NetworkPolicy for the
+// namespace.
+func bootstrapPolicy(namespace string) *unstructured.Unstructured {
 	// allow-bluefairy-proxy restricts ingress to openclaw pods only.
 	// podSelector MUST be scoped to app.kubernetes.io/name=openclaw so that
 	// ephemeral pods (e.g. cert-manager ACME HTTP-01 solvers) are not caught
 	// by the policy and blocked from receiving challenge traffic on port 8089.
-	policy := &unstructured.Unstructured{
+	return &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "networking.k8s.io/v1",
 			"kind":       "NetworkPolicy",
 			"metadata": map[string]interface{}{
 				"name":      "allow-bluefairy-proxy",
-				"namespace": m.cfg.Namespace,
+				"namespace": namespace,
 			},
 			"spec": map[string]interface{}{
 				"podSelector": map[string]interface{}{
@@ -262,70 +456,369 @@ func (m *Manager) Bootstrap(ctx context.Context) error {
 			},
 		},
 	}
+}
 
-	_, err := m.client.Resource(networkPolicyGVR).Namespace(m.cfg.Namespace).Apply(
-		ctx,
-		"allow-bluefairy-proxy",
-		policy,
-		metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true},
-	)
+// CreateOptions holds the caller-supplied parameters of CreateInstance.
+type CreateOptions struct {
+	GatewayToken string // Injected as OPENCLAW_GATEWAY_TOKEN
+
+	// Cost-allocation metadata stamped as labels; see costLabels.
+	Plan       string
+	CostCenter string
+
+	// ContactEmail receives lifecycle notifications; stored as an annotation.
+	ContactEmail string
+
+	// Profile, when set, overrides parts of the default spec and is recorded
+	// as the "profile" label.
+	Profile *Profile
+
+	// Channel is the release channel, recorded as the "channel" label;
+	// unlabelled instances follow stable.
+	Channel string
+
+	// Environment is EnvProd, EnvStaging or EnvDev, recorded as the
+	// "environment" label; it decides the instance's hostname (see
+	// instanceHost). Empty means production.
+	Environment string
+
+	// HealthCheck, when set, overrides how the instance is probed; stored as
+	// annotations.
+	HealthCheck *HealthCheck
+
+	// Features are the tenant's resolved feature flags, injected as
+	// OPENCLAW_FEATURE_* variables.
+	Features map[string]bool
+
+	// Env holds the tenant's own variables, set over the generated ones;
+	// see CheckEnvOverride for those it may not set.
+	Env map[string]string
+
+	// Annotations are set on the instance besides the orchestrator's own;
+	// see CheckAnnotation.
+	Annotations map[string]string
+
+	// RawConfig is the tenant's config.raw override, merged over the
+	// generated OpenClaw configuration; see CheckConfigOverride for the
+	// fields it may not set.
+	RawConfig map[string]interface{}
+
+	// Organization is the organization the tenant belongs to, if any,
+	// recorded as the "org" label.
+	Organization string
+
+	// Branding, when set, brands the instance for a reseller, over
+	// RawConfig.
+	Branding *Branding
+
+	// DryRun validates the generated spec server-side and returns it in
+	// InstanceInfo.Spec without creating anything.
+	DryRun bool
+
+	// Reservation, when set, commits a reservation made by ReserveInstance:
+	// the instance takes the reserved name, and the capacity the
+	// reservation holds is not counted a second time.
+	Reservation *Reservation
+
+	// Journal, when set, is called as each create step completes (see
+	// StepSpecBuilt and the steps after it), so that a create interrupted
+	// by a crash can be resumed or rolled back. Dry runs are not journaled.
+	Journal func(step, instanceName string)
+
+	// instanceName, existingClaim and storageSize are set by
+	// ReactivateInstance to re-create a deleted instance under its old name
+	// on its retained volume.
+	instanceName  string
+	existingClaim string
+	storageSize   string
+
+	// image is set by the managers from their ImageDefaults.
+	image ImageSettings
+}
+
+// CreateInstance provisions a new OpenClaw instance for the given tenant.
+func (m *Manager) CreateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error) {
+	id, err := tenant.Parse(tenantID)
 	if err != nil {
-		return fmt.Errorf("bootstrap allow-bluefairy-proxy: %w", err)
+		return nil, &InvalidSpecError{Message: "invalid tenant ID: " + err.Error()}
 	}
-
-	return nil
+	tenantID = id.String()
+	if !opts.DryRun {
+		unlock, err := m.locks.lock(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	if opts.Reservation != nil {
+		opts.instanceName = opts.Reservation.InstanceName
+	}
+	return m.createInstance(ctx, tenantID, opts)
 }
 
-// CreateInstance provisions a new OpenClaw instance for the given tenant.
-func (m *Manager) CreateInstance(ctx context.Context, tenantID, gatewayToken string) (*InstanceInfo, error) {
-	instanceName, err := generateTenantInstanceName()
+// createInstance is CreateInstance without the tenant lock.
+func (m *Manager) createInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error) {
+	client := m.clientFor(ctx)
+	resource := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+
+	heldNames, held, err := heldReservations(ctx, m.reservationSource(), opts.Reservation)
 	if err != nil {
-		return nil, fmt.Errorf("generating instance name: %v", err)
+		return nil, err
+	}
+	instanceName := opts.instanceName
+	if instanceName == "" {
+		instanceName, err = m.names.freeName(tenantID, func(name string) (bool, error) {
+			if heldNames[name] {
+				return true, nil
+			}
+			_, err := resource.Get(ctx, name, metav1.GetOptions{})
+			if errors.IsNotFound(err) {
+				return false, nil
+			}
+			return err == nil, err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkInstanceHost(m.cfg, instanceName, opts.Environment); err != nil {
+		return nil, err
+	}
+	opts.image = m.defaults.For(opts.Plan, opts.Environment)
+	instance := buildInstanceSpec(ctx, m.cfg, instanceName, tenantID, opts)
+	if err := m.inject.apply(instance); err != nil {
+		return nil, err
 	}
 
-	instance := m.buildInstanceSpec(instanceName, tenantID, gatewayToken)
+	if err := m.images.checkInstance(instance, ""); err != nil {
+		return nil, err
+	}
+	if err := m.mirrors.apply(instance); err != nil {
+		return nil, err
+	}
+	if err := m.pinner.pin(ctx, instance); err != nil {
+		return nil, err
+	}
+	if err := m.checkCapacity(ctx, instance, held); err != nil {
+		return nil, err
+	}
+	m.current().adapter.encode(instance)
+	if !opts.DryRun {
+		opts.journal(StepSpecBuilt, instanceName)
+	}
 
-	_, err = m.client.Resource(tenantGVR).Namespace(m.cfg.Namespace).Create(ctx, instance, metav1.CreateOptions{})
+	// Pre-flight with a server-side dry run so that schema and admission
+	// webhook rejections are reported as such rather than as a failed create.
+	if _, err := resource.Create(ctx, instance, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}); err != nil {
+		if rejected := specRejection(err); rejected != nil {
+			return nil, rejected
+		}
+		return nil, fmt.Errorf("dry-run create of tenant instance: %v", err)
+	}
+	if opts.DryRun {
+		return &InstanceInfo{
+			Name:             instanceName,
+			Endpoint:         m.InstanceURL(instanceName, opts.Environment),
+			InternalEndpoint: InternalURL(m.cfg, instanceName, opts.Environment),
+			Environment:      instanceEnvironment(instance.GetLabels()),
+			Status:           "dry-run",
+			Spec:             instance.Object,
+		}, nil
+	}
+
+	if m.cfg.GatewayTokenSecrets {
+		if err := m.applyGatewaySecret(ctx, client, instanceName, tenantID, opts.GatewayToken); err != nil {
+			return nil, err
+		}
+		opts.journal(StepSecretCreated, instanceName)
+	}
+
+	created, err := resource.Create(ctx, instance, metav1.CreateOptions{})
+	m.cache.invalidate(tenantID)
 	if err != nil {
+		if m.cfg.GatewayTokenSecrets {
+			client.Resource(secretGVR).Namespace(m.cfg.Namespace).Delete(ctx, gatewaySecretName(instanceName), metav1.DeleteOptions{})
+		}
+		if errors.IsAlreadyExists(err) {
+			// Another create took the name since it was checked.
+			return nil, fmt.Errorf("instance name %s was taken by a concurrent create: %v", instanceName, err)
+		}
 		return nil, fmt.Errorf("failed to create tenant instance: %v", err)
 	}
+	opts.journal(StepInstanceCreated, instanceName)
+	if m.cfg.GatewayTokenSecrets {
+		// The Secret is still deleted with the instance by label if this
+		// fails; the owner reference only covers deletions made elsewhere.
+		if err := m.ownGatewaySecret(ctx, client, created); err != nil {
+			log.Printf("instance %s: %v", instanceName, err)
+		}
+	}
+	if err := m.createRoutes(ctx, client, created, instanceHost(m.cfg.Domain, instanceName, opts.Environment)); err != nil {
+		// The instance exists; a missing route shows as waiting_for_dns
+		// until it is recreated.
+		log.Printf("instance %s: %v", instanceName, err)
+	}
+	if err := m.createInternalIngress(ctx, client, created, opts.Environment); err != nil {
+		// Internal exposure does not gate readiness; the instance is still
+		// served on its public host.
+		log.Printf("instance %s: %v", instanceName, err)
+	}
 
 	return &InstanceInfo{
-		Name:     instanceName,
-		Endpoint: m.InstanceURL(instanceName),
-		Status:   "creating",
+		Name:             instanceName,
+		Endpoint:         m.InstanceURL(instanceName, opts.Environment),
+		InternalEndpoint: InternalURL(m.cfg, instanceName, opts.Environment),
+		Environment:      instanceEnvironment(instance.GetLabels()),
+		Status:           "creating",
+		ResourceVersion:  created.GetResourceVersion(),
 	}, nil
 }
 
+// ErrNotFound is returned when the requested tenant object does not exist.
+var ErrNotFound = fmt.Errorf("not found")
+
+// InvalidSpecError is returned when the API server rejects a generated spec,
+// either through CRD schema validation or an admission webhook. Message is
+// the server's explanation and is safe to show to the caller.
+type InvalidSpecError struct {
+	Message string
+}
+
+func (e *InvalidSpecError) Error() string {
+	return "instance spec rejected: " + e.Message
+}
+
+// specRejection returns an *InvalidSpecError if err is the API server
+// refusing the object itself, or nil for any other failure.
+func specRejection(err error) error {
+	status, ok := err.(errors.APIStatus)
+	if !ok {
+		return nil
+	}
+	switch {
+	case errors.IsInvalid(err), errors.IsBadRequest(err):
+	case errors.IsForbidden(err) && strings.Contains(status.Status().Message, "admission webhook"):
+	default:
+		return nil
+	}
+	return &InvalidSpecError{Message: status.Status().Message}
+}
+
 // InstanceInfo holds metadata about a running tenant instance.
 type InstanceInfo struct {
 	Name         string // Kubernetes resource name (e.g. "tenant-ab12cd34")
 	Endpoint     string // Public URL (e.g. "https://tenant-ab12cd34.wareit.ai")
-	Status       string // Simplified status: "starting", "running", or "error"
-	GatewayToken string // The OPENCLAW_GATEWAY_TOKEN injected at creation time
+	Status       string // Simplified status: "starting", "running", "suspended" or "error"
+	State        string // Provisioning state (see StatePending etc.); only set by GetInstance
+	Message      string // Operator's explanation of the status, if any
+	GatewayToken string // The current OPENCLAW_GATEWAY_TOKEN; see GetInstance
+
+	// GatewayTokenDigest is the hex SHA-256 digest of GatewayToken. Unlike
+	// the token, it is known for instances whose token is kept in a Secret
+	// without reading the Secret.
+	GatewayTokenDigest string
+
+	// ResourceVersion is the CR's resourceVersion, which changes whenever the
+	// object (including its status) changes. Empty for just-created instances.
+	ResourceVersion string
+
+	Plan         string       // Plan named at creation, if any
+	Organization string       // Organization of the tenant, if any
+	Environment  string       // EnvProd, EnvStaging or EnvDev
+	ContactEmail string       // Address for lifecycle notifications, if any
+	Storage      string       // Requested persistent volume size, e.g. "1Gi"
+	CreatedAt    time.Time    // Zero for just-created instances
+	HealthCheck  *HealthCheck // Probe settings given at creation, if any
+
+	// InternalEndpoint is the URL under INTERNAL_DOMAIN, when instances are
+	// also exposed there.
+	InternalEndpoint string
+
+	// Spec is the object that would be submitted; only set for dry runs.
+	Spec map[string]interface{}
 }
 
-// InstanceURL returns the public HTTPS URL for the given instance name.
-func (m *Manager) InstanceURL(instanceName string) string {
-	return fmt.Sprintf("https://%s.%s", instanceName, m.cfg.Domain)
+// InstanceURL returns the public HTTPS URL of an instance in the given
+// environment.
+func (m *Manager) InstanceURL(instanceName, environment string) string {
+	return "https://" + instanceHost(m.cfg.Domain, instanceName, environment)
 }
 
-// GetInstance finds a tenant's instance and returns its info, or nil if none
-// exists.
+// GetInstance finds the tenant's instance selected by ctx, or its default
+// one, and returns its info, or nil if none exists. A gateway token kept in
+// a Secret is read from it. Results are served from the instance cache when
+// it is enabled.
 func (m *Manager) GetInstance(ctx context.Context, tenantID string) (*InstanceInfo, error) {
-	list, err := m.client.Resource(tenantGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("tenant=%s", tenantID),
+	// An impersonated caller must be refused by RBAC what it may not read,
+	// so it is never served what another caller cached.
+	if !m.impersonates(ctx) {
+		if info, ok := m.cache.get(tenantID, selectionKey(ctx)); ok {
+			return info, nil
+		}
+	}
+
+	client := m.readerFor(ctx)
+
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var info *InstanceInfo
+	if len(list.Items) > 0 {
+		m.current().adapter.decode(&list.Items[0])
+		info = m.instanceInfo(&list.Items[0])
+		env, _, _ := unstructured.NestedSlice(list.Items[0].Object, "spec", "env")
+		if _, secretName := gatewayTokenSource(env); secretName != "" {
+			if info.GatewayToken, err = m.gatewayToken(ctx, client, secretName); err != nil {
+				return nil, err
+			}
+		}
+		var detail string
+		info.State, detail = m.instanceState(ctx, client, &list.Items[0], info)
+		if info.Message == "" {
+			info.Message = detail
+		}
+	}
+	m.cache.put(tenantID, selectionKey(ctx), info)
+	return info, nil
+}
+
+// ClusterInstance is one OpenClawInstance as returned by ListInstances.
+type ClusterInstance struct {
+	TenantID string
+	Info     *InstanceInfo
+	Object   *unstructured.Unstructured // In the canonical version
+}
+
+// ListInstances returns every tenant instance in the namespace, read directly
+// from the API server rather than the instance cache.
+func (m *Manager) ListInstances(ctx context.Context) ([]ClusterInstance, error) {
+	list, err := m.readerFor(ctx).Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=tenant-instance",
 	})
 	if err != nil {
 		return nil, fmt.Errorf("listing instances: %v", err)
 	}
 
-	if len(list.Items) == 0 {
-		return nil, nil
+	out := make([]ClusterInstance, 0, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		m.current().adapter.decode(item)
+		out = append(out, ClusterInstance{
+			TenantID: item.GetLabels()["tenant"],
+			Info:     m.instanceInfo(item),
+			Object:   item,
+		})
 	}
+	return out, nil
+}
 
-	item := list.Items[0]
+// instanceInfo summarises an OpenClawInstance object.
+func (m *Manager) instanceInfo(item *unstructured.Unstructured) *InstanceInfo {
 	name := item.GetName()
+	env := instanceEnvironment(item.GetLabels())
 
 	phase, found, _ := unstructured.NestedString(item.Object, "status", "phase")
 	status := "starting"
@@ -338,44 +831,52 @@ func (m *Manager) GetInstance(ctx context.Context, tenantID string) (*InstanceIn
 		}
 	}
 
-	// Extract gateway token from env vars
-	var gatewayToken string
+	// Extract gateway token from env vars; one kept in a Secret is only
+	// known by its digest here.
 	envVars, _, _ := unstructured.NestedSlice(item.Object, "spec", "env")
-	for _, e := range envVars {
-		if envMap, ok := e.(map[string]interface{}); ok {
-			if envMap["name"] == "OPENCLAW_GATEWAY_TOKEN" {
-				gatewayToken, _ = envMap["value"].(string)
-				break
-			}
-		}
+	gatewayToken, _ := gatewayTokenSource(envVars)
+	digest := item.GetAnnotations()[tokenDigestAnnotation]
+	if gatewayToken != "" {
+		digest = tokenDigest(gatewayToken)
 	}
 
-	return &InstanceInfo{
-		Name:         name,
-		Endpoint:     m.InstanceURL(name),
-		Status:       status,
-		GatewayToken: gatewayToken,
-	}, nil
-}
-
-// DeleteInstance deletes all instances belonging to the given tenant.
-func (m *Manager) DeleteInstance(ctx context.Context, tenantID string) error {
-	list, err := m.client.Resource(tenantGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
-		LabelSelector: fmt.Sprintf("tenant=%s", tenantID),
-	})
-	if err != nil {
-		return fmt.Errorf("listing instances for deletion: %v", err)
+	if suspended, _, _ := unstructured.NestedBool(item.Object, "spec", "suspend"); suspended {
+		status = "suspended"
 	}
 
-	for _, instance := range list.Items {
-		err = m.client.Resource(tenantGVR).Namespace(m.cfg.Namespace).Delete(
-			ctx, instance.GetName(), metav1.DeleteOptions{})
-		if err != nil && !errors.IsNotFound(err) {
-			return fmt.Errorf("failed to delete tenant instance %s: %v", instance.GetName(), err)
+	storage, _, _ := unstructured.NestedString(item.Object, "spec", "storage", "persistence", "size")
+
+	message, _, _ := unstructured.NestedString(item.Object, "status", "message")
+	if message == "" {
+		conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+		for _, c := range conditions {
+			if cond, ok := c.(map[string]interface{}); ok && cond["status"] == "False" {
+				if msg, _ := cond["message"].(string); msg != "" {
+					message = msg
+					break
+				}
+			}
 		}
 	}
+	if reason := item.GetAnnotations()[provisioningFailedAnnotation]; reason != "" && status == "starting" {
+		status, message = "error", reason
+	}
 
-	return nil
+	return &InstanceInfo{
+		Name:               name,
+		Endpoint:           m.InstanceURL(name, env),
+		InternalEndpoint:   InternalURL(m.cfg, name, env),
+		Status:             status,
+		Message:            message,
+		GatewayToken:       gatewayToken,
+		GatewayTokenDigest: digest,
+		ResourceVersion:    item.GetResourceVersion(),
+		Plan:               item.GetLabels()["plan"],
+		Organization:       item.GetLabels()[orgLabel],
+		Environment:        env,
+		ContactEmail:       item.GetAnnotations()[contactEmailAnnotation],
+		HealthCheck:        healthCheckFrom(item.GetAnnotations()),
+		Storage:            storage,
+		CreatedAt:          item.GetCreationTimestamp().UTC(),
+	}
 }
-
-
@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// Service meshes that instances can be enrolled in, selected with MESH.
+const (
+	MeshIstio   = "istio"
+	MeshLinkerd = "linkerd"
+)
+
+// ValidMesh reports whether mesh names a supported service mesh, or is empty
+// for none.
+func ValidMesh(mesh string) bool {
+	return mesh == "" || mesh == MeshIstio || mesh == MeshLinkerd
+}
+
+// instancePorts are the instance ports that the mesh policies open to the
+// ingress controller and the proxy, as the allow-bluefairy-proxy
+// NetworkPolicy does.
+var instancePorts = []int64{18789, 18793}
+
+// meshPolicyName names the authorization objects admitting ingress traffic.
+const meshPolicyName = "openclaw-ingress"
+
+var (
+	peerAuthenticationGVR    = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1", Resource: "peerauthentications"}
+	istioAuthorizationGVR    = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1", Resource: "authorizationpolicies"}
+	linkerdServerGVR         = schema.GroupVersionResource{Group: "policy.linkerd.io", Version: "v1beta1", Resource: "servers"}
+	meshTLSAuthenticationGVR = schema.GroupVersionResource{Group: "policy.linkerd.io", Version: "v1alpha1", Resource: "meshtlsauthentications"}
+	linkerdAuthorizationGVR  = schema.GroupVersionResource{Group: "policy.linkerd.io", Version: "v1alpha1", Resource: "authorizationpolicies"}
+)
+
+// meshObject is a mesh policy object and the resource it is applied to.
+type meshObject struct {
+	gvr schema.GroupVersionResource
+	obj *unstructured.Unstructured
+}
+
+// enrollMesh enrolls the namespace in cfg.Mesh, if set: it marks the
+// namespace for sidecar injection, requires mutual TLS for traffic to its
+// pods, and only admits traffic to instance ports from the namespaces in
+// meshNamespaces. Pods that are already running are only injected when they
+// next restart.
+func (m *Manager) enrollMesh(ctx context.Context, client dynamic.Interface, namespace string) error {
+	if m.cfg.Mesh == "" {
+		return nil
+	}
+	metadata := map[string]interface{}{}
+	var objects []meshObject
+	switch m.cfg.Mesh {
+	case MeshIstio:
+		metadata["labels"] = map[string]interface{}{"istio-injection": "enabled"}
+		if m.cfg.MeshIstioRevision != "" {
+			// A revision label only takes effect without istio-injection.
+			metadata["labels"] = map[string]interface{}{"istio-injection": nil, "istio.io/rev": m.cfg.MeshIstioRevision}
+		}
+		objects = istioPolicies(namespace, m.meshNamespaces())
+	case MeshLinkerd:
+		metadata["annotations"] = map[string]interface{}{
+			"linkerd.io/inject":                        "enabled",
+			"config.linkerd.io/default-inbound-policy": "all-authenticated",
+		}
+		objects = linkerdPolicies(namespace, m.meshNamespaces(), m.cfg.MeshTrustDomain)
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+	if err != nil {
+		return err
+	}
+	if _, err := client.Resource(namespaceGVR).Patch(ctx, namespace, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("enrolling namespace %s in %s: %v", namespace, m.cfg.Mesh, err)
+	}
+	for _, o := range objects {
+		_, err := client.Resource(o.gvr).Namespace(namespace).Apply(ctx, o.obj.GetName(), o.obj,
+			metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true})
+		if err != nil {
+			return fmt.Errorf("applying %s %s in %s: %v", o.obj.GetKind(), o.obj.GetName(), namespace, err)
+		}
+	}
+	return nil
+}
+
+// meshNamespaces returns the namespaces admitted to instance ports: those of
+// the ingress controller and the proxy's, unless MESH_ALLOWED_NAMESPACES
+// lists them.
+func (m *Manager) meshNamespaces() []string {
+	if len(m.cfg.MeshAllowedNamespaces) > 0 {
+		return m.cfg.MeshAllowedNamespaces
+	}
+	return append(append([]string(nil), ingressProviderFor(m.cfg).namespaces()...), "bluefairy")
+}
+
+// meshMeta returns the metadata of a mesh policy object.
+func meshMeta(name, namespace string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+		"labels":    map[string]interface{}{"app.kubernetes.io/managed-by": "tenant-provisioner"},
+	}
+}
+
+// openclawPods selects instance pods, as the allow-bluefairy-proxy
+// NetworkPolicy does.
+func openclawPods() map[string]interface{} {
+	return map[string]interface{}{
+		"matchLabels": map[string]interface{}{"app.kubernetes.io/name": "openclaw"},
+	}
+}
+
+// istioPolicies returns a namespace-wide STRICT PeerAuthentication and an
+// AuthorizationPolicy admitting the allowed namespaces to instance ports.
+// Istio authorizes a source namespace from its mTLS identity, so the policy
+// also rejects plaintext traffic.
+func istioPolicies(namespace string, allowed []string) []meshObject {
+	var ports, sources []interface{}
+	for _, p := range instancePorts {
+		ports = append(ports, strconv.FormatInt(p, 10))
+	}
+	for _, ns := range allowed {
+		sources = append(sources, ns)
+	}
+	return []meshObject{
+		{gvr: peerAuthenticationGVR, obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "security.istio.io/v1",
+			"kind":       "PeerAuthentication",
+			"metadata":   meshMeta("default", namespace),
+			"spec": map[string]interface{}{
+				"mtls": map[string]interface{}{"mode": "STRICT"},
+			},
+		}}},
+		{gvr: istioAuthorizationGVR, obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "security.istio.io/v1",
+			"kind":       "AuthorizationPolicy",
+			"metadata":   meshMeta(meshPolicyName, namespace),
+			"spec": map[string]interface{}{
+				"selector": openclawPods(),
+				"action":   "ALLOW",
+				"rules": []interface{}{
+					map[string]interface{}{
+						"from": []interface{}{
+							map[string]interface{}{"source": map[string]interface{}{"namespaces": sources}},
+						},
+						"to": []interface{}{
+							map[string]interface{}{"operation": map[string]interface{}{"ports": ports}},
+						},
+					},
+				},
+			},
+		}}},
+	}
+}
+
+// linkerdPolicies returns a Server per instance port, a MeshTLSAuthentication
+// matching the service accounts of the allowed namespaces, and an
+// AuthorizationPolicy per Server requiring it.
+func linkerdPolicies(namespace string, allowed []string, trustDomain string) []meshObject {
+	var identities []interface{}
+	for _, ns := range allowed {
+		identities = append(identities, fmt.Sprintf("*.%s.serviceaccount.identity.linkerd.%s", ns, trustDomain))
+	}
+	objects := []meshObject{
+		{gvr: meshTLSAuthenticationGVR, obj: &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "policy.linkerd.io/v1alpha1",
+			"kind":       "MeshTLSAuthentication",
+			"metadata":   meshMeta(meshPolicyName, namespace),
+			"spec":       map[string]interface{}{"identities": identities},
+		}}},
+	}
+	for _, p := range instancePorts {
+		server := fmt.Sprintf("openclaw-%d", p)
+		objects = append(objects,
+			meshObject{gvr: linkerdServerGVR, obj: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "policy.linkerd.io/v1beta1",
+				"kind":       "Server",
+				"metadata":   meshMeta(server, namespace),
+				"spec": map[string]interface{}{
+					"podSelector": openclawPods(),
+					"port":        p,
+				},
+			}}},
+			meshObject{gvr: linkerdAuthorizationGVR, obj: &unstructured.Unstructured{Object: map[string]interface{}{
+				"apiVersion": "policy.linkerd.io/v1alpha1",
+				"kind":       "AuthorizationPolicy",
+				"metadata":   meshMeta(server+"-ingress", namespace),
+				"spec": map[string]interface{}{
+					"targetRef": map[string]interface{}{"group": "policy.linkerd.io", "kind": "Server", "name": server},
+					"requiredAuthenticationRefs": []interface{}{
+						map[string]interface{}{"group": "policy.linkerd.io", "kind": "MeshTLSAuthentication", "name": meshPolicyName},
+					},
+				},
+			}}},
+		)
+	}
+	return objects
+}
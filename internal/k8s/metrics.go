@@ -0,0 +1,301 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	podGVR        = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	podMetricsGVR = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+)
+
+// ResourceMetric compares current usage of a resource with its request and
+// limit. CPU is in millicores and memory in bytes. The fractions are usage
+// divided by request or limit, and are omitted when those are unset.
+type ResourceMetric struct {
+	Usage     int64   `json:"usage"`
+	Request   int64   `json:"request,omitempty"`
+	Limit     int64   `json:"limit,omitempty"`
+	OfRequest float64 `json:"of_request,omitempty"`
+	OfLimit   float64 `json:"of_limit,omitempty"`
+}
+
+// add accumulates o into r.
+func (r *ResourceMetric) add(o ResourceMetric) {
+	r.Usage += o.Usage
+	r.Request += o.Request
+	r.Limit += o.Limit
+}
+
+// finish computes the fractions.
+func (r *ResourceMetric) finish() {
+	r.OfRequest = fraction(r.Usage, r.Request)
+	r.OfLimit = fraction(r.Usage, r.Limit)
+}
+
+// ContainerMetrics is one container's CPU and memory.
+type ContainerMetrics struct {
+	Name   string         `json:"name"`
+	CPU    ResourceMetric `json:"cpu"`
+	Memory ResourceMetric `json:"memory"`
+}
+
+// PodMetrics is one pod of an instance.
+type PodMetrics struct {
+	Name       string             `json:"name"`
+	Node       string             `json:"node,omitempty"`
+	Phase      string             `json:"phase,omitempty"`
+	Containers []ContainerMetrics `json:"containers"`
+}
+
+// VolumeMetrics is the utilization of one of an instance's volumes, in bytes.
+// Capacity, Used and Available come from the kubelet and are zero when its
+// stats could not be read.
+type VolumeMetrics struct {
+	Claim       string  `json:"claim"`
+	Requested   int64   `json:"requested,omitempty"`
+	Capacity    int64   `json:"capacity,omitempty"`
+	Used        int64   `json:"used,omitempty"`
+	Available   int64   `json:"available,omitempty"`
+	Utilization float64 `json:"utilization,omitempty"` // Used / Capacity
+}
+
+// InstanceMetrics is the current resource usage of a tenant's instance. CPU
+// and Memory are totals over every container of every pod.
+type InstanceMetrics struct {
+	Instance    string          `json:"instance"`
+	CollectedAt time.Time       `json:"collected_at"`
+	CPU         ResourceMetric  `json:"cpu"`
+	Memory      ResourceMetric  `json:"memory"`
+	Pods        []PodMetrics    `json:"pods"`
+	Volumes     []VolumeMetrics `json:"volumes"`
+	Warnings    []string        `json:"warnings,omitempty"` // Sources that could not be read
+}
+
+// InstanceMetrics reports the tenant's current CPU and memory usage against
+// requests and limits, from metrics.k8s.io, and volume utilization, from the
+// kubelet stats summary of each pod's node. It returns ErrNotFound if the
+// tenant has no instance. Metrics that cannot be read, for example when
+// metrics-server is not installed or a pod has just started, are left at
+// zero and explained in Warnings rather than failing the report. Kubelet
+// stats are read as the service account, since node proxy access is not
+// something callers are expected to hold.
+func (m *Manager) InstanceMetrics(ctx context.Context, tenantID string) (*InstanceMetrics, error) {
+	client := m.readerFor(ctx)
+	ns := m.cfg.Namespace
+
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, ErrNotFound
+	}
+	instanceName := list.Items[0].GetName()
+	selector := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, instanceName)}
+
+	report := &InstanceMetrics{
+		Instance:    instanceName,
+		CollectedAt: time.Now().UTC(),
+		Pods:        []PodMetrics{},
+		Volumes:     []VolumeMetrics{},
+	}
+
+	pods, err := client.Resource(podGVR).Namespace(ns).List(ctx, selector)
+	if err != nil {
+		return nil, fmt.Errorf("listing pods for %s: %v", instanceName, err)
+	}
+	podNames := map[string]bool{}
+	nodes := map[string]bool{}
+	for _, pod := range pods.Items {
+		pm := PodMetrics{Name: pod.GetName()}
+		pm.Node, _, _ = unstructured.NestedString(pod.Object, "spec", "nodeName")
+		pm.Phase, _, _ = unstructured.NestedString(pod.Object, "status", "phase")
+		podNames[pm.Name] = true
+		if pm.Node != "" {
+			nodes[pm.Node] = true
+		}
+
+		podUsage, err := client.Resource(podMetricsGVR).Namespace(ns).Get(ctx, pm.Name, metav1.GetOptions{})
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("usage for pod %s unavailable from metrics.k8s.io: %v", pm.Name, err))
+			podUsage = nil
+		}
+		used := containerUsage(podUsage)
+
+		containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			cm := ContainerMetrics{}
+			cm.Name, _, _ = unstructured.NestedString(container, "name")
+			cm.CPU = ResourceMetric{
+				Usage:   used[cm.Name].CPU.Usage,
+				Request: quantity(container, true, "resources", "requests", "cpu"),
+				Limit:   quantity(container, true, "resources", "limits", "cpu"),
+			}
+			cm.Memory = ResourceMetric{
+				Usage:   used[cm.Name].Memory.Usage,
+				Request: quantity(container, false, "resources", "requests", "memory"),
+				Limit:   quantity(container, false, "resources", "limits", "memory"),
+			}
+			report.CPU.add(cm.CPU)
+			report.Memory.add(cm.Memory)
+			cm.CPU.finish()
+			cm.Memory.finish()
+			pm.Containers = append(pm.Containers, cm)
+		}
+		report.Pods = append(report.Pods, pm)
+	}
+	report.CPU.finish()
+	report.Memory.finish()
+
+	pvcs, err := client.Resource(pvcGVR).Namespace(ns).List(ctx, selector)
+	if err != nil {
+		return nil, fmt.Errorf("listing volumes for %s: %v", instanceName, err)
+	}
+	volumes := map[string]*VolumeMetrics{}
+	for _, pvc := range pvcs.Items {
+		volumes[pvc.GetName()] = &VolumeMetrics{
+			Claim:     pvc.GetName(),
+			Requested: quantity(pvc.Object, false, "spec", "resources", "requests", "storage"),
+		}
+	}
+	for node := range nodes {
+		stats, err := m.nodeVolumeStats(ctx, node)
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("volume stats unavailable from node %s: %v", node, err))
+			continue
+		}
+		for _, pod := range stats.Pods {
+			if pod.PodRef.Namespace != ns || !podNames[pod.PodRef.Name] {
+				continue
+			}
+			for _, v := range pod.Volumes {
+				if v.PVCRef == nil {
+					continue
+				}
+				vm, ok := volumes[v.PVCRef.Name]
+				if !ok {
+					vm = &VolumeMetrics{Claim: v.PVCRef.Name}
+					volumes[v.PVCRef.Name] = vm
+				}
+				vm.Capacity, vm.Used, vm.Available = v.CapacityBytes, v.UsedBytes, v.AvailableBytes
+				vm.Utilization = fraction(vm.Used, vm.Capacity)
+			}
+		}
+	}
+	for _, vm := range volumes {
+		report.Volumes = append(report.Volumes, *vm)
+	}
+	sort.Slice(report.Volumes, func(i, j int) bool { return report.Volumes[i].Claim < report.Volumes[j].Claim })
+	return report, nil
+}
+
+// containerUsage maps container names to their usage in a PodMetrics object.
+// A nil object yields an empty map.
+func containerUsage(podMetrics *unstructured.Unstructured) map[string]ContainerMetrics {
+	out := map[string]ContainerMetrics{}
+	if podMetrics == nil {
+		return out
+	}
+	containers, _, _ := unstructured.NestedSlice(podMetrics.Object, "containers")
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(container, "name")
+		out[name] = ContainerMetrics{
+			Name:   name,
+			CPU:    ResourceMetric{Usage: quantity(container, true, "usage", "cpu")},
+			Memory: ResourceMetric{Usage: quantity(container, false, "usage", "memory")},
+		}
+	}
+	return out
+}
+
+// quantity reads a resource quantity at fields, in millis when milli is set
+// and in base units otherwise. Missing or malformed values read as zero.
+func quantity(obj map[string]interface{}, milli bool, fields ...string) int64 {
+	v, found, _ := unstructured.NestedString(obj, fields...)
+	if !found {
+		return 0
+	}
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		return 0
+	}
+	if milli {
+		return q.MilliValue()
+	}
+	return q.Value()
+}
+
+// fraction returns a/b rounded to three places, or zero when b is zero.
+func fraction(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(float64(a)/float64(b)*1000) / 1000
+}
+
+// statsSummary is the subset of the kubelet's /stats/summary we read.
+type statsSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Volumes []struct {
+			Name   string `json:"name"`
+			PVCRef *struct {
+				Name string `json:"name"`
+			} `json:"pvcRef"`
+			CapacityBytes  int64 `json:"capacityBytes"`
+			UsedBytes      int64 `json:"usedBytes"`
+			AvailableBytes int64 `json:"availableBytes"`
+		} `json:"volume"`
+	} `json:"pods"`
+}
+
+// nodeVolumeStats fetches a node's kubelet stats summary through the API
+// server's node proxy.
+func (m *Manager) nodeVolumeStats(ctx context.Context, node string) (*statsSummary, error) {
+	t := m.current()
+	endpoint := strings.TrimSuffix(t.restCfg.Host, "/") + "/api/v1/nodes/" + url.PathEscape(node) + "/proxy/stats/summary"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET stats summary: status %d", resp.StatusCode)
+	}
+	var summary statsSummary
+	if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+		return nil, fmt.Errorf("decoding stats summary: %v", err)
+	}
+	return &summary, nil
+}
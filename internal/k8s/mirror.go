@@ -0,0 +1,105 @@
+package k8s
+
+import (
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// imageMirrors maps repository prefixes, such as "ghcr.io/openclaw", to the
+// internal mirror that serves them, such as "registry.corp:5000/openclaw",
+// for clusters without internet egress. The longest matching prefix wins; a
+// prefix matches a whole repository or a leading run of its path segments.
+// Image policies keep naming the original repositories.
+type imageMirrors map[string]string
+
+// newImageMirrors returns the IMAGE_MIRRORS mapping, without trailing
+// slashes.
+func newImageMirrors(cfg *config.Config) imageMirrors {
+	mm := make(imageMirrors, len(cfg.ImageMirrors))
+	for from, to := range cfg.ImageMirrors {
+		mm[strings.TrimSuffix(from, "/")] = strings.TrimSuffix(to, "/")
+	}
+	return mm
+}
+
+// pull returns the repository instances pull in place of repository, which
+// may already be a mirrored one.
+func (mm imageMirrors) pull(repository string) string {
+	source := mm.source(repository)
+	if prefix := longestPrefix(mm, source); prefix != "" {
+		return mm[prefix] + strings.TrimPrefix(source, prefix)
+	}
+	return source
+}
+
+// source returns the original repository of a mirrored one, or repository
+// itself when it is not mirrored.
+func (mm imageMirrors) source(repository string) string {
+	mirrors := make(map[string]string, len(mm))
+	for from, to := range mm {
+		mirrors[to] = from
+	}
+	if prefix := longestPrefix(mirrors, repository); prefix != "" {
+		return mirrors[prefix] + strings.TrimPrefix(repository, prefix)
+	}
+	return repository
+}
+
+// image rewrites a full image reference such as "registry.k8s.io/pause:3.10"
+// to its mirror.
+func (mm imageMirrors) image(ref string) string {
+	repository, rest := ref, ""
+	if i := strings.Index(ref, "@"); i >= 0 {
+		repository, rest = ref[:i], ref[i:]
+	} else if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		repository, rest = ref[:i], ref[i:]
+	}
+	return mm.pull(repository) + rest
+}
+
+// apply points an OpenClawInstance in the canonical version at the mirror of
+// its image repository and of the images of its init containers and
+// sidecars.
+func (mm imageMirrors) apply(instance *unstructured.Unstructured) error {
+	if len(mm) == 0 {
+		return nil
+	}
+	for _, field := range []string{"initContainers", "sidecars"} {
+		list, found, _ := unstructured.NestedSlice(instance.Object, "spec", field)
+		if !found {
+			continue
+		}
+		for _, c := range list {
+			if m, ok := c.(map[string]interface{}); ok {
+				if image, ok := m["image"].(string); ok {
+					m["image"] = mm.image(image)
+				}
+			}
+		}
+		if err := unstructured.SetNestedSlice(instance.Object, list, "spec", field); err != nil {
+			return err
+		}
+	}
+	repository, found, _ := unstructured.NestedString(instance.Object, "spec", "image", "repository")
+	if !found {
+		return nil
+	}
+	return unstructured.SetNestedField(instance.Object, mm.pull(repository), "spec", "image", "repository")
+}
+
+// longestPrefix returns the longest key of m that is repository or a
+// path-segment prefix of it, or "" if there is none.
+func longestPrefix(m map[string]string, repository string) string {
+	best := ""
+	for prefix := range m {
+		if len(prefix) <= len(best) {
+			continue
+		}
+		if repository == prefix || strings.HasPrefix(repository, prefix+"/") {
+			best = prefix
+		}
+	}
+	return best
+}
@@ -0,0 +1,116 @@
+package k8s
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// Instance name modes.
+const (
+	// NameModeRandom names instances with random hex digits.
+	NameModeRandom = "random"
+	// NameModeTenant derives the name from the tenant ID, so that a
+	// tenant's first instance always gets the same name and subdomain.
+	NameModeTenant = "tenant"
+)
+
+// ValidNameMode reports whether mode is a known instance name mode.
+func ValidNameMode(mode string) bool {
+	return mode == NameModeRandom || mode == NameModeTenant
+}
+
+// maxInstanceNameLength leaves room in a 63-character DNS label, or label
+// value, for the suffixes added to names of an instance's objects.
+const maxInstanceNameLength = 40
+
+// namePrefixRe matches an instance name prefix: a DNS label start.
+var namePrefixRe = regexp.MustCompile(`^[a-z]([-a-z0-9]*)?$`)
+
+// nameStrategy generates names for new instances: a prefix followed by
+// length hex digits.
+type nameStrategy struct {
+	prefix   string
+	length   int
+	mode     string
+	attempts int
+	reserved []string
+}
+
+// parseNameStrategy validates the instance name settings in cfg.
+func parseNameStrategy(cfg *config.Config) (nameStrategy, error) {
+	s := nameStrategy{prefix: cfg.InstanceNamePrefix, length: cfg.InstanceNameLength, mode: cfg.InstanceNameMode, attempts: cfg.InstanceNameAttempts, reserved: cfg.ReservedInstanceNames}
+	switch {
+	case !ValidNameMode(s.mode):
+		return s, fmt.Errorf("invalid INSTANCE_NAME_MODE %q: must be %q or %q", s.mode, NameModeRandom, NameModeTenant)
+	case !namePrefixRe.MatchString(s.prefix):
+		return s, fmt.Errorf("invalid INSTANCE_NAME_PREFIX %q: must start with a lowercase letter and hold only lowercase letters, digits and '-'", s.prefix)
+	case s.length < 6 || s.length > 32:
+		return s, fmt.Errorf("invalid INSTANCE_NAME_LENGTH %d: must be between 6 and 32", s.length)
+	case len(s.prefix)+s.length > maxInstanceNameLength:
+		return s, fmt.Errorf("INSTANCE_NAME_PREFIX and INSTANCE_NAME_LENGTH make names of %d characters; at most %d are allowed", len(s.prefix)+s.length, maxInstanceNameLength)
+	case s.attempts < 1:
+		return s, fmt.Errorf("invalid INSTANCE_NAME_ATTEMPTS %d: must be at least 1", s.attempts)
+	}
+	// The longest hostname a generated name gives must be valid.
+	for _, env := range Environments {
+		if err := CheckHostname(instanceHost(cfg.Domain, s.prefix+strings.Repeat("0", s.length), env)); err != nil {
+			return s, fmt.Errorf("TENANT_DOMAIN and the instance name settings give invalid hostnames: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// name returns the candidate name for attempt (from 0) at naming an instance
+// of the tenant. Random names differ on every call; tenant-derived names
+// depend only on the tenant and the attempt, so that a tenant's first free
+// name is stable.
+func (s nameStrategy) name(tenantID string, attempt int) (string, error) {
+	var digits string
+	switch s.mode {
+	case NameModeTenant:
+		seed := tenantID
+		if attempt > 0 {
+			seed += "#" + strconv.Itoa(attempt)
+		}
+		sum := sha256.Sum256([]byte(seed))
+		digits = hex.EncodeToString(sum[:])
+	default:
+		b := make([]byte, (s.length+1)/2)
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		digits = hex.EncodeToString(b)
+	}
+	return s.prefix + digits[:s.length], nil
+}
+
+// freeName tries up to s.attempts candidate names for a new instance of the
+// tenant and returns the first that is not reserved and for which taken
+// reports false.
+func (s nameStrategy) freeName(tenantID string, taken func(name string) (bool, error)) (string, error) {
+	for attempt := 0; attempt < s.attempts; attempt++ {
+		name, err := s.name(tenantID, attempt)
+		if err != nil {
+			return "", fmt.Errorf("generating instance name: %v", err)
+		}
+		if slices.Contains(s.reserved, name) {
+			continue
+		}
+		used, err := taken(name)
+		if err != nil {
+			return "", fmt.Errorf("checking instance name %s: %v", name, err)
+		}
+		if !used {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free instance name after %d attempts", s.attempts)
+}
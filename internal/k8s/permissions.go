@@ -0,0 +1,163 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var selfSubjectAccessReviewGVR = schema.GroupVersionResource{
+	Group:    "authorization.k8s.io",
+	Version:  "v1",
+	Resource: "selfsubjectaccessreviews",
+}
+
+// PermissionCheck is the outcome of one SelfSubjectAccessReview.
+type PermissionCheck struct {
+	Group       string `json:"group"`
+	Resource    string `json:"resource"`
+	Subresource string `json:"subresource,omitempty"`
+	Verb        string `json:"verb"`
+	Namespaced  bool   `json:"namespaced"`
+	Allowed     bool   `json:"allowed"`
+	Reason      string `json:"reason,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// requiredPermission is a verb the service needs on a resource.
+type requiredPermission struct {
+	group, resource, subresource string
+	verbs                        []string
+	clusterScoped                bool
+}
+
+// requiredPermissions returns every permission the service relies on, given
+// the features enabled in cfg.
+func (m *Manager) requiredPermissions() []requiredPermission {
+	perms := []requiredPermission{
+		{group: "openclaw.rocks", resource: "openclawinstances", verbs: []string{"create", "get", "list", "watch", "update", "patch", "delete"}},
+		{group: "networking.k8s.io", resource: "networkpolicies", verbs: []string{"get", "patch"}},
+		{group: "", resource: "persistentvolumeclaims", verbs: []string{"get", "list", "create", "patch", "delete"}},
+		{group: "snapshot.storage.k8s.io", resource: "volumesnapshots", verbs: []string{"get", "list", "create", "patch", "delete"}},
+		{group: "", resource: "secrets", verbs: []string{"get", "list", "delete"}},
+		{group: "", resource: "configmaps", verbs: []string{"get", "list", "delete"}},
+		{group: "networking.k8s.io", resource: "ingresses", verbs: []string{"get", "list", "delete"}},
+		{group: "externaldns.k8s.io", resource: "dnsendpoints", verbs: []string{"get", "list", "delete"}},
+		{group: "batch", resource: "jobs", verbs: []string{"create", "get", "list"}},
+		{group: "apps", resource: "daemonsets", verbs: []string{"create", "list", "delete"}},
+		{group: "", resource: "events", verbs: []string{"list"}},
+		{group: "", resource: "pods", verbs: []string{"list", "delete"}},
+		{group: "", resource: "pods", subresource: "log", verbs: []string{"get"}},
+		{group: "metrics.k8s.io", resource: "pods", verbs: []string{"get"}},
+		{group: "cert-manager.io", resource: "certificates", verbs: []string{"get", "delete"}},
+		{group: "acme.cert-manager.io", resource: "orders", verbs: []string{"list"}},
+		{group: "acme.cert-manager.io", resource: "challenges", verbs: []string{"list"}},
+		{group: "", resource: "nodes", subresource: "proxy", verbs: []string{"get"}, clusterScoped: true},
+		{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", verbs: []string{"get"}, clusterScoped: true},
+	}
+	if m.cfg.GatewayTokenSecrets {
+		perms = append(perms,
+			requiredPermission{group: "", resource: "secrets", verbs: []string{"create", "update", "patch"}},
+		)
+	}
+	if m.cfg.IngressProvider == IngressGatewayAPI {
+		perms = append(perms,
+			requiredPermission{group: "gateway.networking.k8s.io", resource: "httproutes", verbs: []string{"create", "get", "list", "delete"}},
+		)
+		if m.cfg.IngressGatewayTLS == GatewayTLSCertManager {
+			perms = append(perms,
+				requiredPermission{group: "gateway.networking.k8s.io", resource: "gateways", verbs: []string{"create", "get", "patch", "delete"}},
+			)
+		}
+	}
+	switch m.cfg.Mesh {
+	case MeshIstio:
+		perms = append(perms,
+			requiredPermission{group: "", resource: "namespaces", verbs: []string{"patch"}, clusterScoped: true},
+			requiredPermission{group: "security.istio.io", resource: "peerauthentications", verbs: []string{"get", "patch"}},
+			requiredPermission{group: "security.istio.io", resource: "authorizationpolicies", verbs: []string{"get", "patch"}},
+		)
+	case MeshLinkerd:
+		perms = append(perms,
+			requiredPermission{group: "", resource: "namespaces", verbs: []string{"patch"}, clusterScoped: true},
+			requiredPermission{group: "policy.linkerd.io", resource: "servers", verbs: []string{"get", "patch"}},
+			requiredPermission{group: "policy.linkerd.io", resource: "meshtlsauthentications", verbs: []string{"get", "patch"}},
+			requiredPermission{group: "policy.linkerd.io", resource: "authorizationpolicies", verbs: []string{"get", "patch"}},
+		)
+	}
+	if m.cfg.ImpersonateCallers {
+		perms = append(perms,
+			requiredPermission{group: "", resource: "users", verbs: []string{"impersonate"}, clusterScoped: true},
+			requiredPermission{group: "", resource: "groups", verbs: []string{"impersonate"}, clusterScoped: true},
+		)
+	}
+	return perms
+}
+
+// CheckPermissions asks the API server, via SelfSubjectAccessReview, whether
+// the service account may perform every operation the service relies on.
+// Checks always run as the service account, never as an impersonated caller.
+func (m *Manager) CheckPermissions(ctx context.Context) ([]PermissionCheck, error) {
+	client := m.current().client
+
+	var checks []PermissionCheck
+	for _, p := range m.requiredPermissions() {
+		for _, verb := range p.verbs {
+			attrs := map[string]interface{}{
+				"group":    p.group,
+				"resource": p.resource,
+				"verb":     verb,
+			}
+			if p.subresource != "" {
+				attrs["subresource"] = p.subresource
+			}
+			if !p.clusterScoped {
+				attrs["namespace"] = m.cfg.Namespace
+			}
+			review := &unstructured.Unstructured{
+				Object: map[string]interface{}{
+					"apiVersion": "authorization.k8s.io/v1",
+					"kind":       "SelfSubjectAccessReview",
+					"spec": map[string]interface{}{
+						"resourceAttributes": attrs,
+					},
+				},
+			}
+
+			check := PermissionCheck{
+				Group:       p.group,
+				Resource:    p.resource,
+				Subresource: p.subresource,
+				Verb:        verb,
+				Namespaced:  !p.clusterScoped,
+			}
+			result, err := client.Resource(selfSubjectAccessReviewGVR).Create(ctx, review, metav1.CreateOptions{})
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, fmt.Errorf("checking permissions: %v", err)
+				}
+				check.Error = err.Error()
+			} else {
+				check.Allowed, _, _ = unstructured.NestedBool(result.Object, "status", "allowed")
+				check.Reason, _, _ = unstructured.NestedString(result.Object, "status", "reason")
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks, nil
+}
+
+// String renders the check as "verb resource.group/subresource".
+func (c PermissionCheck) String() string {
+	resource := c.Resource
+	if c.Group != "" {
+		resource += "." + c.Group
+	}
+	if c.Subresource != "" {
+		resource += "/" + c.Subresource
+	}
+	return c.Verb + " " + resource
+}
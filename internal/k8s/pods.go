@@ -0,0 +1,141 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// maxLogBytes bounds the log text returned by InstanceLogs, whatever the
+// number of lines asked for.
+const maxLogBytes = 1 << 20
+
+// ErrNoPods is returned by InstanceLogs when the instance has no live pod,
+// for example while it is suspended or still being scheduled.
+var ErrNoPods = fmt.Errorf("instance has no pods")
+
+// RestartInstance deletes the pods of the tenant's instances so that their
+// controller re-creates them, restarting OpenClaw without changing its spec
+// or volume. It returns ErrNotFound if the tenant has no instance.
+func (m *Manager) RestartInstance(ctx context.Context, tenantID string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return ErrNotFound
+	}
+
+	for _, instance := range list.Items {
+		if err := checkVersion(ctx, &instance); err != nil {
+			return err
+		}
+	}
+	pods := client.Resource(podGVR).Namespace(m.cfg.Namespace)
+	for _, instance := range list.Items {
+		items, err := instancePods(ctx, client, m.cfg.Namespace, instance.GetName())
+		if err != nil {
+			return err
+		}
+		for _, pod := range items {
+			err := pods.Delete(ctx, pod.GetName(), metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("deleting pod %s: %v", pod.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// InstanceLogs returns the last tail lines logged by the main container of
+// the tenant's instance, at most maxLogBytes of them. It returns ErrNotFound
+// if the tenant has no instance and ErrNoPods if the instance has no pod.
+func (m *Manager) InstanceLogs(ctx context.Context, tenantID string, tail int) (string, error) {
+	client := m.readerFor(ctx)
+	instance, err := m.tenantInstance(ctx, client, tenantID)
+	if err != nil {
+		return "", err
+	}
+	pods, err := instancePods(ctx, client, m.cfg.Namespace, instance.GetName())
+	if err != nil {
+		return "", err
+	}
+	if len(pods) == 0 {
+		return "", ErrNoPods
+	}
+	return m.podLogs(ctx, &pods[0], tail)
+}
+
+// podLogs returns the last tail lines logged by the main container of pod,
+// at most maxLogBytes of them.
+func (m *Manager) podLogs(ctx context.Context, pod *unstructured.Unstructured, tail int) (string, error) {
+	query := url.Values{
+		"tailLines":  {strconv.Itoa(tail)},
+		"limitBytes": {strconv.Itoa(maxLogBytes)},
+	}
+	containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+	if len(containers) > 0 {
+		if c, ok := containers[0].(map[string]interface{}); ok {
+			if name, _ := c["name"].(string); name != "" {
+				query.Set("container", name)
+			}
+		}
+	}
+
+	// The log subresource is plain text, which the dynamic client cannot
+	// decode, so it is read with a raw request.
+	t := m.current()
+	endpoint := strings.TrimSuffix(t.restCfg.Host, "/") + "/api/v1/namespaces/" + url.PathEscape(m.cfg.Namespace) +
+		"/pods/" + url.PathEscape(pod.GetName()) + "/log?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("reading logs of pod %s: %v", pod.GetName(), err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLogBytes))
+	if err != nil {
+		return "", fmt.Errorf("reading logs of pod %s: %v", pod.GetName(), err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("reading logs of pod %s: status %d: %s", pod.GetName(), resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
+
+// instancePods lists the pods of an instance that are not being deleted.
+func instancePods(ctx context.Context, client dynamic.Interface, namespace, instanceName string) ([]unstructured.Unstructured, error) {
+	list, err := client.Resource(podGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, instanceName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing pods of %s: %v", instanceName, err)
+	}
+	var pods []unstructured.Unstructured
+	for _, pod := range list.Items {
+		if pod.GetDeletionTimestamp() == nil {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
@@ -0,0 +1,45 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ErrPreconditionFailed is returned by a mutation whose context requires a
+// resourceVersion (see WithResourceVersion) that the instance no longer has.
+var ErrPreconditionFailed = fmt.Errorf("instance has changed")
+
+type resourceVersionKey struct{}
+
+// WithResourceVersion returns a copy of ctx under which mutations of a
+// tenant's instance only apply if the instance is still at resourceVersion,
+// as last read by the caller. Patches and deletes carry the version to the
+// API server, so that a change made in between is caught there too.
+func WithResourceVersion(ctx context.Context, resourceVersion string) context.Context {
+	return context.WithValue(ctx, resourceVersionKey{}, resourceVersion)
+}
+
+// requiredVersion returns the resourceVersion ctx requires, or "" if any
+// will do.
+func requiredVersion(ctx context.Context) string {
+	rv, _ := ctx.Value(resourceVersionKey{}).(string)
+	return rv
+}
+
+// checkVersion returns ErrPreconditionFailed if ctx requires a version that
+// instance does not have.
+func checkVersion(ctx context.Context, instance *unstructured.Unstructured) error {
+	if rv := requiredVersion(ctx); rv != "" && instance.GetResourceVersion() != rv {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// isPreconditionConflict reports whether err is the API server refusing a
+// write because the version required by ctx was no longer current.
+func isPreconditionConflict(ctx context.Context, err error) bool {
+	return requiredVersion(ctx) != "" && errors.IsConflict(err)
+}
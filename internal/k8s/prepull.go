@@ -0,0 +1,195 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var daemonSetGVR = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
+
+// prePullApp labels the DaemonSets and pods of image pre-pulls.
+const prePullApp = "openclaw-prepull"
+
+// PrePull is an image being pulled onto every node ahead of an upgrade or a
+// wave of new instances.
+type PrePull struct {
+	ID        string    `json:"id"`
+	Image     string    `json:"image"` // Repository and tag, or digest when pinned
+	CreatedAt time.Time `json:"created_at"`
+	Nodes     int64     `json:"nodes"`  // Nodes the pull is scheduled on
+	Pulled    int64     `json:"pulled"` // Nodes that have the image
+	Complete  bool      `json:"complete"`
+	Errors    []string  `json:"errors,omitempty"` // Pull failures, by pod
+}
+
+// StartPrePull pulls repository:tag, from its mirror if it has one, onto
+// every node with a DaemonSet whose init container uses the image and whose
+// only container is a pause container. With digest pinning the tag is
+// resolved to its digest first, so that the nodes hold exactly what
+// instances will run. The DaemonSet tolerates every taint and stays until
+// DeletePrePull.
+func (m *Manager) StartPrePull(ctx context.Context, id, repository, tag string) (*PrePull, error) {
+	repository = m.mirrors.pull(repository)
+	image := repository + ":" + tag
+	digest, err := m.pinner.resolve(ctx, repository, tag)
+	if err != nil {
+		return nil, err
+	}
+	if digest != "" {
+		image = repository + "@" + digest
+	}
+
+	labels := map[string]interface{}{"app": prePullApp, "prepull-id": id}
+	ds := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "DaemonSet",
+			"metadata": map[string]interface{}{
+				"name":        "prepull-" + id,
+				"namespace":   m.cfg.Namespace,
+				"labels":      labels,
+				"annotations": requestAnnotations(ctx),
+			},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": labels},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": labels},
+					"spec": map[string]interface{}{
+						"imagePullSecrets": []interface{}{
+							map[string]interface{}{"name": imagePullSecret},
+						},
+						"tolerations": []interface{}{
+							map[string]interface{}{"operator": "Exists"},
+						},
+						"terminationGracePeriodSeconds": int64(0),
+						"initContainers": []interface{}{
+							map[string]interface{}{
+								"name":            "pull",
+								"image":           image,
+								"imagePullPolicy": "IfNotPresent",
+								"command":         []interface{}{"sh", "-c", "true"},
+								"resources":       prePullResources(),
+							},
+						},
+						"containers": []interface{}{
+							map[string]interface{}{
+								"name":      "pause",
+								"image":     m.mirrors.image(m.cfg.PrePullPauseImage),
+								"resources": prePullResources(),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	created, err := m.clientFor(ctx).Resource(daemonSetGVR).Namespace(m.cfg.Namespace).Create(ctx, ds, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("creating pre-pull daemonset: %v", err)
+	}
+	return &PrePull{ID: id, Image: image, CreatedAt: created.GetCreationTimestamp().UTC()}, nil
+}
+
+// prePullResources keeps pre-pull containers from taking node capacity.
+func prePullResources() map[string]interface{} {
+	small := map[string]interface{}{"cpu": "10m", "memory": "16Mi"}
+	return map[string]interface{}{"requests": small, "limits": small}
+}
+
+// PrePulls returns every pre-pull, newest first, with its progress.
+func (m *Manager) PrePulls(ctx context.Context) ([]PrePull, error) {
+	return m.prePulls(ctx, "app="+prePullApp)
+}
+
+// GetPrePull returns one pre-pull with its progress, or ErrNotFound.
+func (m *Manager) GetPrePull(ctx context.Context, id string) (*PrePull, error) {
+	list, err := m.prePulls(ctx, fmt.Sprintf("app=%s,prepull-id=%s", prePullApp, id))
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// DeletePrePull removes a pre-pull's DaemonSet and pods. The pulled image
+// stays on the nodes until the kubelet garbage-collects it.
+func (m *Manager) DeletePrePull(ctx context.Context, id string) error {
+	background := metav1.DeletePropagationBackground
+	err := m.clientFor(ctx).Resource(daemonSetGVR).Namespace(m.cfg.Namespace).Delete(ctx, "prepull-"+id, metav1.DeleteOptions{PropagationPolicy: &background})
+	if errors.IsNotFound(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("deleting pre-pull daemonset: %v", err)
+	}
+	return nil
+}
+
+// prePulls lists the pre-pull DaemonSets matching selector and counts, from
+// their pods, the nodes that have pulled the image: a pull has finished once
+// the init container has an image ID, whether or not its command succeeds.
+func (m *Manager) prePulls(ctx context.Context, selector string) ([]PrePull, error) {
+	client := m.readerFor(ctx)
+	list, err := client.Resource(daemonSetGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("listing pre-pull daemonsets: %v", err)
+	}
+	out := make([]PrePull, 0, len(list.Items))
+	for _, ds := range list.Items {
+		p := PrePull{ID: ds.GetLabels()["prepull-id"], CreatedAt: ds.GetCreationTimestamp().UTC()}
+		if containers, _, _ := unstructured.NestedSlice(ds.Object, "spec", "template", "spec", "initContainers"); len(containers) > 0 {
+			if c, ok := containers[0].(map[string]interface{}); ok {
+				p.Image, _ = c["image"].(string)
+			}
+		}
+		p.Nodes, _, _ = unstructured.NestedInt64(ds.Object, "status", "desiredNumberScheduled")
+		if err := m.countPulled(ctx, client, &p); err != nil {
+			return nil, err
+		}
+		p.Complete = p.Nodes > 0 && p.Pulled >= p.Nodes
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// countPulled sets p.Pulled and p.Errors from the pre-pull's pods.
+func (m *Manager) countPulled(ctx context.Context, client dynamic.Interface, p *PrePull) error {
+	pods, err := client.Resource(podGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app=%s,prepull-id=%s", prePullApp, p.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("listing pre-pull pods: %v", err)
+	}
+	for _, pod := range pods.Items {
+		statuses, _, _ := unstructured.NestedSlice(pod.Object, "status", "initContainerStatuses")
+		if len(statuses) == 0 {
+			continue
+		}
+		st, ok := statuses[0].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if imageID, _ := st["imageID"].(string); imageID != "" {
+			p.Pulled++
+			continue
+		}
+		reason, _, _ := unstructured.NestedString(st, "state", "waiting", "reason")
+		if reason == "ErrImagePull" || reason == "ImagePullBackOff" || reason == "InvalidImageName" {
+			message, _, _ := unstructured.NestedString(st, "state", "waiting", "message")
+			node, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+			p.Errors = append(p.Errors, fmt.Sprintf("%s: %s: %s", node, reason, message))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// Profile is a named provisioning variant, such as "trial" or
+// "dedicated-gpu", selected at creation time.
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Plan is used when the create request names none.
+	Plan string `json:"plan,omitempty"`
+
+	// Spec is merged over the default OpenClawInstance spec as a JSON merge
+	// patch: maps merge, other values replace and null removes. An env list
+	// is appended to the generated variables instead of replacing them, so
+	// that the gateway token is always injected.
+	Spec map[string]interface{} `json:"spec,omitempty"`
+}
+
+// profileFile is the on-disk layout read by LoadProfiles.
+type profileFile struct {
+	Profiles map[string]*Profile `json:"profiles"`
+}
+
+// LoadProfiles reads the profile catalog from a YAML or JSON file of the form
+// {"profiles": {"<name>": {...}}}. An empty path yields an empty catalog.
+func LoadProfiles(path string) (map[string]*Profile, error) {
+	profiles := map[string]*Profile{}
+	if path == "" {
+		return profiles, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading profiles: %v", err)
+	}
+	var f profileFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing profiles %s: %v", path, err)
+	}
+	for name, p := range f.Profiles {
+		if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+			return nil, fmt.Errorf("profile %q: invalid name: %s", name, errs[0])
+		}
+		if p == nil {
+			p = &Profile{}
+		}
+		if errs := validation.IsValidLabelValue(p.Plan); len(errs) > 0 {
+			return nil, fmt.Errorf("profile %q: invalid plan: %s", name, errs[0])
+		}
+		p.Name = name
+		profiles[name] = p
+	}
+	return profiles, nil
+}
+
+// ProfileNames returns the catalog's profile names in order.
+func ProfileNames(profiles map[string]*Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyProfile merges a copy of p's spec into spec, so that instances never
+// share values with the catalog; see Profile.Spec.
+func applyProfile(spec map[string]interface{}, p *Profile) {
+	// Profile specs were decoded from JSON, so copying cannot fail.
+	overlay, _ := copyJSON(p.Spec)
+	if env, ok := overlay["env"].([]interface{}); ok {
+		delete(overlay, "env")
+		for _, e := range env {
+			if m, ok := e.(map[string]interface{}); ok && m["name"] == "OPENCLAW_GATEWAY_TOKEN" {
+				continue
+			}
+			spec["env"] = append(envSlice(spec["env"]), e)
+		}
+	}
+	mergePatch(spec, overlay)
+}
+
+// envSlice returns an env list built by buildEnvVars or decoded from JSON as
+// a []interface{}.
+func envSlice(list interface{}) []interface{} {
+	switch l := list.(type) {
+	case []map[string]interface{}:
+		out := make([]interface{}, 0, len(l))
+		for _, v := range l {
+			out = append(out, v)
+		}
+		return out
+	case []interface{}:
+		return l
+	}
+	return nil
+}
+
+// mergePatch applies patch to dst following RFC 7386.
+func mergePatch(dst, patch map[string]interface{}) {
+	for k, v := range patch {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+		if pm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := dst[k].(map[string]interface{}); ok {
+				mergePatch(dm, pm)
+				continue
+			}
+			fresh := map[string]interface{}{}
+			mergePatch(fresh, pm)
+			dst[k] = fresh
+			continue
+		}
+		dst[k] = v
+	}
+}
@@ -0,0 +1,104 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/mchatman/tenant-provisioner/internal/buildinfo"
+	"github.com/mchatman/tenant-provisioner/internal/caller"
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// SpecTemplateRevision identifies the built-in instance spec generated by
+// buildInstanceSpec. Bump it whenever that spec changes, so that objects
+// created from an older template can be told apart in the cluster.
+const SpecTemplateRevision = "1"
+
+// Annotations tying an object back to the API call that last created or
+// changed it.
+const (
+	correlationIDAnnotation = annotationPrefix + "correlation-id"
+	callerAnnotation        = annotationPrefix + "caller"
+	versionAnnotation       = annotationPrefix + "orchestrator-version"
+	commitAnnotation        = annotationPrefix + "orchestrator-commit"
+	templateAnnotation      = annotationPrefix + "spec-template-revision"
+)
+
+// CorrelationID returns the correlation ID of the API request that last
+// created or changed obj, or "" if none did.
+func CorrelationID(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+	return obj.GetAnnotations()[correlationIDAnnotation]
+}
+
+// requestAnnotations returns the annotations that tie a new object back to
+// the API request that produced it: its correlation ID and caller, the
+// orchestrator version and commit, and the spec template revision.
+func requestAnnotations(ctx context.Context) map[string]interface{} {
+	annotations := map[string]interface{}{templateAnnotation: SpecTemplateRevision}
+	for k, v := range changeAnnotations(ctx) {
+		if v != nil {
+			annotations[k] = v
+		}
+	}
+	return annotations
+}
+
+// changeAnnotations returns, as a merge patch of an object's annotations,
+// those recording the API request that changes it. The correlation ID and
+// caller are removed when ctx has none, so that they never describe an
+// earlier change. The spec template revision is left alone: a change does
+// not regenerate the spec.
+func changeAnnotations(ctx context.Context) map[string]interface{} {
+	annotations := map[string]interface{}{
+		correlationIDAnnotation: nil,
+		callerAnnotation:        nil,
+		versionAnnotation:       buildinfo.Version,
+		commitAnnotation:        buildinfo.Commit,
+	}
+	if id := correlation.FromContext(ctx); id != "" {
+		annotations[correlationIDAnnotation] = id
+	}
+	if id, ok := caller.FromContext(ctx); ok {
+		annotations[callerAnnotation] = id.User
+	}
+	return annotations
+}
+
+// stampPatch adds the annotations recording the API request to a merge
+// patch. They are set directly rather than with mergePatch, which would drop
+// the removals.
+func stampPatch(ctx context.Context, patch map[string]interface{}) {
+	metadata, _ := patch["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		patch["metadata"] = metadata
+	}
+	annotations, _ := metadata["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = map[string]interface{}{}
+		metadata["annotations"] = annotations
+	}
+	for k, v := range changeAnnotations(ctx) {
+		annotations[k] = v
+	}
+}
+
+// stampChange records the API request changing obj in its annotations, for
+// changes written with Update rather than a merge patch.
+func stampChange(ctx context.Context, obj *unstructured.Unstructured) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for k, v := range changeAnnotations(ctx) {
+		if s, ok := v.(string); ok {
+			annotations[k] = s
+		} else {
+			delete(annotations, k)
+		}
+	}
+	obj.SetAnnotations(annotations)
+}
@@ -0,0 +1,294 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+// instanceLabel is the label the OpenClaw operator stamps on every resource it
+// creates on behalf of an OpenClawInstance, keyed by the instance name.
+const instanceLabel = "app.kubernetes.io/instance"
+
+// purgeKind describes one class of per-instance artifact removed during a
+// purge.
+type purgeKind struct {
+	Kind string
+	GVR  schema.GroupVersionResource
+}
+
+// deleteKinds lists the dependent resources removed alongside the CR by
+// DeleteInstance, so that nothing the operator may leave behind outlives the
+// tenant. Ingresses and external-dns DNSEndpoints are included so that
+// verification also covers DNS: external-dns retracts a record once the
+// object that owns the hostname is gone. Export Jobs are included so that the
+// snapshots and volumes they own go too. DeleteInstanceRetainingStorage
+// keeps the volumes and snapshots instead.
+var deleteKinds = []purgeKind{
+	{Kind: "PersistentVolumeClaim", GVR: pvcGVR},
+	{Kind: "VolumeSnapshot", GVR: snapshotGVR},
+	{Kind: "Secret", GVR: schema.GroupVersionResource{Version: "v1", Resource: "secrets"}},
+	{Kind: "ConfigMap", GVR: schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+	{Kind: "Ingress", GVR: schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}},
+	{Kind: "DNSEndpoint", GVR: schema.GroupVersionResource{Group: "externaldns.k8s.io", Version: "v1alpha1", Resource: "dnsendpoints"}},
+	{Kind: "Job", GVR: jobGVR},
+}
+
+// exportArchiveKind is the PurgedArtifact kind of an export archive in
+// object storage.
+const exportArchiveKind = "ExportArchive"
+
+// purgeKinds lists the dependent resources removed by PurgeInstance: the
+// same as a delete, which a purge certifies.
+var purgeKinds = deleteKinds
+
+// PurgedArtifact identifies a single resource removed by PurgeInstance.
+type PurgedArtifact struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// PurgeReport is the verified outcome of PurgeInstance.
+type PurgeReport struct {
+	TenantID   string
+	Artifacts  []PurgedArtifact
+	VerifiedAt time.Time
+}
+
+// purgeTarget pairs an artifact with the GVR needed to look it up again.
+type purgeTarget struct {
+	artifact PurgedArtifact
+	gvr      schema.GroupVersionResource
+}
+
+// DeleteInstance deletes the tenant's instances selected by ctx, all of them
+// by default, together with their volumes, snapshots, Secrets, ConfigMaps,
+// ingress and DNS endpoints, then waits until none of them can be found any
+// more. It returns an error naming the first artifact still present once
+// cfg.DeleteVerifyTimeout elapses.
+func (m *Manager) DeleteInstance(ctx context.Context, tenantID string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	targets, err := m.purgeTargets(ctx, client, tenantID, deleteKinds)
+	if err != nil {
+		return err
+	}
+	if err := m.removeTargets(ctx, client, targets, m.cfg.DeleteVerifyTimeout); err != nil {
+		return err
+	}
+	if len(targets) > 0 {
+		log.Printf("deleted tenant %s: %d artifact(s) removed and verified", tenantID, len(targets))
+	}
+	return nil
+}
+
+// PurgeInstance deletes the tenant's instances selected by ctx, all of them
+// by default, together with their volumes, snapshots, Secrets, ConfigMaps,
+// ingress and DNS endpoints, then waits until none of them can be found any
+// more. When it removes all of the tenant's instances, it also deletes the
+// tenant's export archives from the store set by UseExportStore. It returns
+// an error if any artifact is still present once cfg.PurgeVerifyTimeout
+// elapses.
+func (m *Manager) PurgeInstance(ctx context.Context, tenantID string) (*PurgeReport, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	targets, err := m.purgeTargets(ctx, client, tenantID, purgeKinds)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.removeTargets(ctx, client, targets, m.cfg.PurgeVerifyTimeout); err != nil {
+		return nil, err
+	}
+	archives, err := m.removeExportArchives(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PurgeReport{
+		TenantID:   tenantID,
+		VerifiedAt: time.Now().UTC(),
+	}
+	for _, t := range targets {
+		report.Artifacts = append(report.Artifacts, t.artifact)
+	}
+	report.Artifacts = append(report.Artifacts, archives...)
+	return report, nil
+}
+
+// exportArchives lists the tenant's export archives that a purge under ctx
+// removes: all of them when it removes all of the tenant's instances, none
+// when ctx selects one or no export store is set.
+func (m *Manager) exportArchives(ctx context.Context, tenantID string) ([]PurgedArtifact, error) {
+	store := m.exportStore()
+	if _, selected := selectedInstance(ctx); selected || store == nil {
+		return nil, nil
+	}
+	keys, err := store.List(ctx, m.exportPrefix(tenantID))
+	if err != nil {
+		return nil, fmt.Errorf("listing export archives: %v", err)
+	}
+	artifacts := make([]PurgedArtifact, 0, len(keys))
+	for _, key := range keys {
+		artifacts = append(artifacts, PurgedArtifact{Kind: exportArchiveKind, Name: key})
+	}
+	return artifacts, nil
+}
+
+// removeExportArchives deletes the tenant's export archives that a purge
+// under ctx removes, then checks that none is left.
+func (m *Manager) removeExportArchives(ctx context.Context, tenantID string) ([]PurgedArtifact, error) {
+	archives, err := m.exportArchives(ctx, tenantID)
+	if err != nil || len(archives) == 0 {
+		return nil, err
+	}
+	store := m.exportStore()
+	for _, a := range archives {
+		if err := store.Delete(ctx, a.Name); err != nil {
+			return nil, fmt.Errorf("failed to delete %s %s: %v", a.Kind, a.Name, err)
+		}
+	}
+	remaining, err := m.exportArchives(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("verifying export archives: %v", err)
+	}
+	if len(remaining) > 0 {
+		return nil, fmt.Errorf("deletion verification failed: %d artifact(s) still present, first %s %s",
+			len(remaining), remaining[0].Kind, remaining[0].Name)
+	}
+	return archives, nil
+}
+
+// removeTargets deletes targets in order, each instance before its
+// dependents, and waits up to timeout until none of them can be found.
+// Instance deletes carry the resourceVersion required by ctx, if any.
+func (m *Manager) removeTargets(ctx context.Context, client dynamic.Interface, targets []purgeTarget, timeout time.Duration) error {
+	propagation := metav1.DeletePropagationForeground
+	for _, t := range targets {
+		opts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+		if rv := requiredVersion(ctx); rv != "" && t.gvr == m.instanceGVR() {
+			opts.Preconditions = &metav1.Preconditions{ResourceVersion: &rv}
+		}
+		err := client.Resource(t.gvr).Namespace(m.cfg.Namespace).Delete(ctx, t.artifact.Name, opts)
+		if isPreconditionConflict(ctx, err) && t.gvr == m.instanceGVR() {
+			return ErrPreconditionFailed
+		}
+		if err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s %s: %v", t.artifact.Kind, t.artifact.Name, err)
+		}
+	}
+
+	remaining := targets
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true,
+		func(ctx context.Context) (bool, error) {
+			var still []purgeTarget
+			for _, t := range remaining {
+				_, err := client.Resource(t.gvr).Namespace(m.cfg.Namespace).Get(ctx, t.artifact.Name, metav1.GetOptions{})
+				if errors.IsNotFound(err) {
+					continue
+				}
+				if err != nil {
+					return false, fmt.Errorf("verifying %s %s: %v", t.artifact.Kind, t.artifact.Name, err)
+				}
+				still = append(still, t)
+			}
+			remaining = still
+			return len(remaining) == 0, nil
+		})
+	if err != nil {
+		if len(remaining) > 0 {
+			return fmt.Errorf("deletion verification failed: %d artifact(s) still present, first %s %s",
+				len(remaining), remaining[0].artifact.Kind, remaining[0].artifact.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// PlanDeletion lists the resources that deleting the tenant's instances would
+// remove, without removing anything: those DeleteInstance removes or, with
+// purge set, those PurgeInstance wipes.
+func (m *Manager) PlanDeletion(ctx context.Context, tenantID string, purge bool) ([]PurgedArtifact, error) {
+	kinds := deleteKinds
+	if purge {
+		kinds = purgeKinds
+	}
+	targets, err := m.purgeTargets(ctx, m.clientFor(ctx), tenantID, kinds)
+	if err != nil {
+		return nil, err
+	}
+	artifacts := make([]PurgedArtifact, 0, len(targets))
+	for _, t := range targets {
+		artifacts = append(artifacts, t.artifact)
+	}
+	if purge {
+		archives, err := m.exportArchives(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, archives...)
+	}
+	return artifacts, nil
+}
+
+// purgeTargets collects the tenant's OpenClawInstance objects, followed by
+// their dependent resources of the given kinds.
+func (m *Manager) purgeTargets(ctx context.Context, client dynamic.Interface, tenantID string, kinds []purgeKind) ([]purgeTarget, error) {
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []purgeTarget
+	for _, instance := range list.Items {
+		if err := checkVersion(ctx, &instance); err != nil {
+			return nil, err
+		}
+		name := instance.GetName()
+		targets = append(targets, purgeTarget{
+			artifact: PurgedArtifact{Kind: "OpenClawInstance", Name: name},
+			gvr:      m.instanceGVR(),
+		})
+
+		// Collect dependents before deleting the CR so that resources the
+		// operator would garbage-collect are still accounted for.
+		for _, pk := range kinds {
+			deps, err := client.Resource(pk.GVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+				LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, name),
+			})
+			if err != nil {
+				// Optional APIs such as VolumeSnapshot may not be installed.
+				if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+					continue
+				}
+				return nil, fmt.Errorf("listing %s for %s: %v", pk.Kind, name, err)
+			}
+			for _, dep := range deps.Items {
+				targets = append(targets, purgeTarget{
+					artifact: PurgedArtifact{Kind: pk.Kind, Name: dep.GetName()},
+					gvr:      pk.GVR,
+				})
+			}
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,72 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ownedConfigFields are the config.raw settings the orchestrator decides,
+// which tenant overrides cannot change: how the gateway listens and whom it
+// trusts, which ingress and the dashboard depend on.
+var ownedConfigFields = [][]string{
+	{"gateway", "bind"},
+	{"gateway", "mode"},
+	{"gateway", "port"},
+	{"gateway", "auth"},
+	{"gateway", "trustedProxies"},
+	{"gateway", "controlUi", "allowInsecureAuth"},
+	{"gateway", "controlUi", "allowedOrigins"},
+}
+
+// CheckConfigOverride returns an error naming the first orchestrator-owned
+// field that a config.raw override sets.
+func CheckConfigOverride(raw map[string]interface{}) error {
+	for _, path := range ownedConfigFields {
+		if _, found, _ := unstructured.NestedFieldNoCopy(raw, path...); found {
+			return fmt.Errorf("config.raw.%s is set by the orchestrator", strings.Join(path, "."))
+		}
+	}
+	return nil
+}
+
+// withRawConfig merges a tenant's config.raw override into the spec as a JSON
+// merge patch, then restores the owned fields as they were, so that neither
+// the override nor a null in it can change them. The spec holds typed slices
+// such as []string, so it is walked without the unstructured helpers, which
+// deep-copy and only accept JSON types.
+func withRawConfig(spec map[string]interface{}, override map[string]interface{}) {
+	config, _ := spec["config"].(map[string]interface{})
+	if config == nil {
+		config = map[string]interface{}{}
+		spec["config"] = config
+	}
+	raw, _ := config["raw"].(map[string]interface{})
+	if raw == nil {
+		raw = map[string]interface{}{}
+		config["raw"] = raw
+	}
+	saved := make([]interface{}, len(ownedConfigFields))
+	for i, path := range ownedConfigFields {
+		saved[i], _, _ = unstructured.NestedFieldNoCopy(raw, path...)
+	}
+
+	mergePatch(raw, override)
+	for i, path := range ownedConfigFields {
+		if saved[i] == nil {
+			unstructured.RemoveNestedField(raw, path...)
+			continue
+		}
+		parent := raw
+		for _, key := range path[:len(path)-1] {
+			next, _ := parent[key].(map[string]interface{})
+			if next == nil {
+				next = map[string]interface{}{}
+				parent[key] = next
+			}
+			parent = next
+		}
+		parent[path[len(path)-1]] = saved[i]
+	}
+}
@@ -0,0 +1,402 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	namespaceGVR       = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	snapshotContentGVR = schema.GroupVersionResource{Group: "snapshot.storage.k8s.io", Version: "v1", Resource: "volumesnapshotcontents"}
+)
+
+// restoredFromAnnotation records the snapshot an instance's volume was
+// restored from during a rebuild.
+const restoredFromAnnotation = annotationPrefix + "restored-from"
+
+// RebuildInstance is one instance to re-create, as recorded before the loss.
+type RebuildInstance struct {
+	Name        string
+	TenantID    string
+	Labels      map[string]string
+	Annotations map[string]string
+	Spec        map[string]interface{} // v1alpha1 shape, including the gateway token
+}
+
+// RebuildOptions selects where a rebuild creates instances.
+type RebuildOptions struct {
+	Context   string // Kubeconfig context to rebuild into; the active one when empty
+	Namespace string // Created if missing
+	DryRun    bool   // Validate every object server-side; only the namespace is created
+}
+
+// RebuildResult is the outcome for one instance.
+type RebuildResult struct {
+	Instance string `json:"instance"`
+	TenantID string `json:"tenant_id"`
+	Status   string `json:"status"`             // "restored", "created", "exists" or "failed"
+	Snapshot string `json:"snapshot,omitempty"` // Source snapshot the volume was restored from
+	Error    string `json:"error,omitempty"`
+}
+
+// RebuildReport is the outcome of Rebuild.
+type RebuildReport struct {
+	Context   string          `json:"context"`
+	Namespace string          `json:"namespace"`
+	DryRun    bool            `json:"dry_run"`
+	Started   time.Time       `json:"started_at"`
+	Finished  time.Time       `json:"finished_at"`
+	Results   []RebuildResult `json:"results"`
+}
+
+// sourceSnapshot is the latest backup of an instance's volume.
+type sourceSnapshot struct {
+	name      string
+	pvcName   string
+	handle    string // Storage-backend snapshot ID
+	driver    string
+	class     string
+	size      string
+	storClass string
+}
+
+// Rebuild re-creates instances into opts.Namespace of the cluster named by
+// opts.Context, for region-loss recovery and recovery drills. Each instance
+// gets its recorded spec, labels and annotations. When the active cluster
+// still holds a ready VolumeSnapshot of the instance's volume, the snapshot is
+// imported into the target by its storage handle and the instance's claim is
+// pre-created from it under its original name, so that the operator binds the
+// restored volume instead of provisioning an empty one. Instances without a
+// reachable snapshot start with an empty volume. A failure for one instance
+// does not stop the others.
+func (m *Manager) Rebuild(ctx context.Context, opts RebuildOptions, instances []RebuildInstance) (*RebuildReport, error) {
+	target := m.current()
+	if opts.Context != "" {
+		target = nil
+		m.clusterMu.RLock()
+		for _, t := range m.targets {
+			if t.name == opts.Context {
+				target = t
+			}
+		}
+		m.clusterMu.RUnlock()
+		if target == nil {
+			return nil, fmt.Errorf("unknown kubeconfig context %q", opts.Context)
+		}
+	}
+	if target == m.current() && opts.Namespace == m.cfg.Namespace {
+		return nil, fmt.Errorf("refusing to rebuild into the live namespace %s", opts.Namespace)
+	}
+
+	report := &RebuildReport{
+		Context:   target.name,
+		Namespace: opts.Namespace,
+		DryRun:    opts.DryRun,
+		Started:   time.Now().UTC(),
+		Results:   []RebuildResult{},
+	}
+
+	// The namespace is created even for a dry run, since the API server
+	// rejects dry-run creates into a namespace that does not exist.
+	if err := m.prepareRebuildNamespace(ctx, target.client, opts.Namespace, opts.DryRun); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	for _, inst := range instances {
+		res := RebuildResult{Instance: inst.Name, TenantID: inst.TenantID}
+		status, snapshot, err := m.rebuildLockedInstance(ctx, target, opts, inst)
+		res.Status, res.Snapshot = status, snapshot
+		if err != nil {
+			res.Status = "failed"
+			res.Error = err.Error()
+		}
+		report.Results = append(report.Results, res)
+	}
+
+	report.Finished = time.Now().UTC()
+	return report, nil
+}
+
+// prepareRebuildNamespace creates the namespace if needed and, unless dryRun
+// is set, applies the namespace-level resources Bootstrap maintains for the
+// live one.
+func (m *Manager) prepareRebuildNamespace(ctx context.Context, client dynamic.Interface, namespace string, dryRun bool) error {
+	ns := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Namespace",
+			"metadata":   map[string]interface{}{"name": namespace},
+		},
+	}
+	if _, err := client.Resource(namespaceGVR).Create(ctx, ns, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating namespace %s: %v", namespace, err)
+	}
+	if dryRun {
+		return nil
+	}
+	_, err := client.Resource(networkPolicyGVR).Namespace(namespace).Apply(
+		ctx,
+		"allow-bluefairy-proxy",
+		bootstrapPolicy(namespace),
+		metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true},
+	)
+	if err != nil {
+		return fmt.Errorf("applying allow-bluefairy-proxy in %s: %v", namespace, err)
+	}
+	if m.cfg.EgressProxyEnforce {
+		_, err := client.Resource(networkPolicyGVR).Namespace(namespace).Apply(
+			ctx,
+			egressPolicyName,
+			egressPolicy(namespace, m.cfg),
+			metav1.ApplyOptions{FieldManager: "tenant-provisioner", Force: true},
+		)
+		if err != nil {
+			return fmt.Errorf("applying %s in %s: %v", egressPolicyName, namespace, err)
+		}
+	}
+	return m.enrollMesh(ctx, client, namespace)
+}
+
+// rebuildLockedInstance is rebuildInstance under the tenant's lock, so that
+// the instance's snapshot is not deleted or replaced while it is restored.
+func (m *Manager) rebuildLockedInstance(ctx context.Context, target *clusterTarget, opts RebuildOptions, inst RebuildInstance) (string, string, error) {
+	unlock, err := m.locks.lock(ctx, inst.TenantID)
+	if err != nil {
+		return "", "", err
+	}
+	defer unlock()
+	return m.rebuildInstance(ctx, target, opts, inst)
+}
+
+// rebuildInstance restores one instance and returns its result status and the
+// snapshot used, if any.
+func (m *Manager) rebuildInstance(ctx context.Context, target *clusterTarget, opts RebuildOptions, inst RebuildInstance) (string, string, error) {
+	if inst.Spec == nil {
+		return "", "", fmt.Errorf("no spec recorded for instance")
+	}
+	spec, err := copyJSON(inst.Spec)
+	if err != nil {
+		return "", "", fmt.Errorf("copying recorded spec: %v", err)
+	}
+
+	var createOpts metav1.CreateOptions
+	if opts.DryRun {
+		createOpts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	snap, err := m.latestSnapshot(ctx, inst.Name)
+	if err != nil {
+		return "", "", err
+	}
+	if snap != nil {
+		if err := restoreVolume(ctx, target.client, opts.Namespace, inst.Name, snap, createOpts); err != nil {
+			return "", snap.name, err
+		}
+	}
+
+	labels := make(map[string]interface{}, len(inst.Labels))
+	for k, v := range inst.Labels {
+		labels[k] = v
+	}
+	annotations := make(map[string]interface{}, len(inst.Annotations)+1)
+	for k, v := range inst.Annotations {
+		annotations[k] = v
+	}
+	if snap != nil {
+		annotations[restoredFromAnnotation] = snap.name
+	}
+	for k, v := range changeAnnotations(ctx) {
+		if v == nil {
+			delete(annotations, k)
+		} else {
+			annotations[k] = v
+		}
+	}
+	instance := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": crdGroup + "/v1alpha1",
+			"kind":       "OpenClawInstance",
+			"metadata": map[string]interface{}{
+				"name":        inst.Name,
+				"namespace":   opts.Namespace,
+				"labels":      labels,
+				"annotations": annotations,
+			},
+			"spec": spec,
+		},
+	}
+	target.adapter.encode(instance)
+
+	gvr := schema.GroupVersionResource{Group: crdGroup, Version: target.adapter.version(), Resource: "openclawinstances"}
+	if _, err := target.client.Resource(gvr).Namespace(opts.Namespace).Create(ctx, instance, createOpts); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return "exists", "", nil
+		}
+		return "", "", fmt.Errorf("creating instance: %v", err)
+	}
+	if snap != nil {
+		return "restored", snap.name, nil
+	}
+	return "created", "", nil
+}
+
+// latestSnapshot finds the newest ready VolumeSnapshot of the instance's
+// volume in the active cluster, or nil if there is none or the cluster cannot
+// be reached.
+func (m *Manager) latestSnapshot(ctx context.Context, instanceName string) (*sourceSnapshot, error) {
+	client := m.current().client
+	list, err := client.Resource(snapshotGVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, instanceName),
+	})
+	if err != nil {
+		// The source region may be gone entirely; rebuild without data.
+		return nil, nil
+	}
+
+	var latest *unstructured.Unstructured
+	for i := range list.Items {
+		s := &list.Items[i]
+		if ready, _, _ := unstructured.NestedBool(s.Object, "status", "readyToUse"); !ready {
+			continue
+		}
+		if latest == nil || s.GetCreationTimestamp().After(latest.GetCreationTimestamp().Time) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+
+	snap := &sourceSnapshot{name: latest.GetName()}
+	snap.pvcName, _, _ = unstructured.NestedString(latest.Object, "spec", "source", "persistentVolumeClaimName")
+	snap.class, _, _ = unstructured.NestedString(latest.Object, "spec", "volumeSnapshotClassName")
+	snap.size, _, _ = unstructured.NestedString(latest.Object, "status", "restoreSize")
+	contentName, _, _ := unstructured.NestedString(latest.Object, "status", "boundVolumeSnapshotContentName")
+
+	content, err := client.Resource(snapshotContentGVR).Get(ctx, contentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading snapshot content %s: %v", contentName, err)
+	}
+	snap.handle, _, _ = unstructured.NestedString(content.Object, "status", "snapshotHandle")
+	snap.driver, _, _ = unstructured.NestedString(content.Object, "spec", "driver")
+	if snap.handle == "" || snap.pvcName == "" {
+		return nil, nil
+	}
+
+	if pvc, err := client.Resource(pvcGVR).Namespace(m.cfg.Namespace).Get(ctx, snap.pvcName, metav1.GetOptions{}); err == nil {
+		snap.storClass, _, _ = unstructured.NestedString(pvc.Object, "spec", "storageClassName")
+		if snap.size == "" {
+			snap.size, _, _ = unstructured.NestedString(pvc.Object, "spec", "resources", "requests", "storage")
+		}
+	}
+	return snap, nil
+}
+
+// restoreVolume imports snap into namespace as a pre-provisioned
+// VolumeSnapshotContent and VolumeSnapshot, then creates the instance's claim
+// from it. Existing objects from an earlier attempt are reused.
+func restoreVolume(ctx context.Context, client dynamic.Interface, namespace, instanceName string, snap *sourceSnapshot, opts metav1.CreateOptions) error {
+	name := instanceName + "-restore"
+	labels := map[string]interface{}{instanceLabel: instanceName}
+
+	contentSpec := map[string]interface{}{
+		"deletionPolicy": "Retain",
+		"driver":         snap.driver,
+		"source":         map[string]interface{}{"snapshotHandle": snap.handle},
+		"volumeSnapshotRef": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}
+	if snap.class != "" {
+		contentSpec["volumeSnapshotClassName"] = snap.class
+	}
+	content := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshotContent",
+			"metadata": map[string]interface{}{
+				"name":   namespace + "-" + name,
+				"labels": labels,
+			},
+			"spec": contentSpec,
+		},
+	}
+	if _, err := client.Resource(snapshotContentGVR).Create(ctx, content, opts); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("importing snapshot %s: %v", snap.name, err)
+	}
+
+	snapshot := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+				"labels":    labels,
+			},
+			"spec": map[string]interface{}{
+				"source": map[string]interface{}{"volumeSnapshotContentName": content.GetName()},
+			},
+		},
+	}
+	if _, err := client.Resource(snapshotGVR).Namespace(namespace).Create(ctx, snapshot, opts); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating restore snapshot: %v", err)
+	}
+
+	pvcSpec := map[string]interface{}{
+		"accessModes": []interface{}{"ReadWriteOnce"},
+		"dataSource": map[string]interface{}{
+			"apiGroup": "snapshot.storage.k8s.io",
+			"kind":     "VolumeSnapshot",
+			"name":     name,
+		},
+		"resources": map[string]interface{}{
+			"requests": map[string]interface{}{"storage": snap.size},
+		},
+	}
+	if snap.storClass != "" {
+		pvcSpec["storageClassName"] = snap.storClass
+	}
+	pvc := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "PersistentVolumeClaim",
+			"metadata": map[string]interface{}{
+				"name":      snap.pvcName,
+				"namespace": namespace,
+				"labels":    labels,
+			},
+			"spec": pvcSpec,
+		},
+	}
+	if _, err := client.Resource(pvcGVR).Namespace(namespace).Create(ctx, pvc, opts); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating restored volume: %v", err)
+	}
+	return nil
+}
+
+// copyJSON deep-copies an object or spec through JSON. Unlike DeepCopy it
+// accepts the typed slices buildInstanceSpec produces, and normalises them
+// into the shapes the dynamic client expects.
+func copyJSON(in map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
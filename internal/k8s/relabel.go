@@ -0,0 +1,60 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// canonicalizeTenantLabels rewrites "tenant" labels that are not in
+// canonical form, as on objects created before tenant IDs were
+// lowercased, so that lookups by the canonical ID find them. It covers
+// instances, their volumes and snapshots, and gateway token Secrets; kinds
+// the cluster does not serve are skipped.
+func (m *Manager) canonicalizeTenantLabels(ctx context.Context, client dynamic.Interface) error {
+	gvrs := []schema.GroupVersionResource{m.instanceGVR(), pvcGVR, snapshotGVR}
+	if m.cfg.GatewayTokenSecrets {
+		gvrs = append(gvrs, secretGVR)
+	}
+	relabelled := 0
+	for _, gvr := range gvrs {
+		resource := client.Resource(gvr).Namespace(m.cfg.Namespace)
+		list, err := resource.List(ctx, metav1.ListOptions{LabelSelector: "tenant"})
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("listing %s: %v", gvr.Resource, err)
+		}
+		for _, item := range list.Items {
+			id := item.GetLabels()["tenant"]
+			if id == tenant.Canonical(id) {
+				continue
+			}
+			patch, err := json.Marshal(map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": map[string]interface{}{"tenant": tenant.Canonical(id)},
+				},
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := resource.Patch(ctx, item.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("relabelling %s %s: %v", gvr.Resource, item.GetName(), err)
+			}
+			relabelled++
+		}
+	}
+	if relabelled > 0 {
+		log.Printf("lowercased the tenant label of %d object(s)", relabelled)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// RenderInstanceSpec returns the OpenClawInstance that a create with opts
+// would submit, the route objects of the ingress provider and the internal
+// Ingress, if any, without a cluster: the spec template with the image
+// defaults, profile, overrides and injected containers applied, checked
+// against the image policy. Digest pinning and the capacity check, which
+// need a registry or the cluster, are left out. The objects are returned as
+// decoded from JSON, as the API server would see them.
+func RenderInstanceSpec(cfg *config.Config, instanceName, tenantID string, opts CreateOptions) ([]map[string]interface{}, error) {
+	images, err := LoadImagePolicies(cfg.ImagePolicyPath)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := LoadImageDefaults(cfg.ImageDefaultsPath)
+	if err != nil {
+		return nil, err
+	}
+	inject, err := LoadInjections(cfg.InjectionsPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkInstanceHost(cfg, instanceName, opts.Environment); err != nil {
+		return nil, err
+	}
+	opts.image = defaults.For(opts.Plan, opts.Environment)
+	instance := buildInstanceSpec(context.Background(), cfg, instanceName, tenantID, opts)
+	if err := inject.apply(instance); err != nil {
+		return nil, err
+	}
+	if err := images.checkInstance(instance, ""); err != nil {
+		return nil, err
+	}
+	if err := newImageMirrors(cfg).apply(instance); err != nil {
+		return nil, err
+	}
+	host := instanceHost(cfg.Domain, instanceName, opts.Environment)
+	objects := []interface{}{instance.Object}
+	for _, route := range ingressProviderFor(cfg).routes(cfg.Namespace, instanceName, host) {
+		objects = append(objects, route.Object)
+	}
+	if ing := internalIngress(cfg, cfg.Namespace, instanceName, opts.Environment); ing != nil {
+		objects = append(objects, ing.Object)
+	}
+
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return nil, fmt.Errorf("encoding rendered objects: %v", err)
+	}
+	var out []map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("decoding rendered objects: %v", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Reservation is an instance name, and the capacity of an instance, set
+// aside by ReserveInstance for a create that commits it later; see
+// CreateOptions.Reservation.
+type Reservation struct {
+	ID           string
+	TenantID     string
+	InstanceName string
+	CPU          string // Requested by the reserved spec; empty when unset
+	Memory       string
+}
+
+// ReservationSource returns the reservations currently held. See
+// UseReservations.
+type ReservationSource func(ctx context.Context) ([]Reservation, error)
+
+// usage returns the capacity the reservation holds.
+func (r Reservation) usage() usage {
+	u := usage{instances: 1}
+	if q, err := resource.ParseQuantity(r.CPU); err == nil {
+		u.cpuMilli = q.MilliValue()
+	}
+	if q, err := resource.ParseQuantity(r.Memory); err == nil {
+		u.memory = q.Value()
+	}
+	return u
+}
+
+// heldReservations returns the reservations held by src other than the one
+// being committed, if any, with the names they hold and their total usage.
+func heldReservations(ctx context.Context, src ReservationSource, committing *Reservation) (map[string]bool, usage, error) {
+	names := make(map[string]bool)
+	var total usage
+	if src == nil {
+		return names, total, nil
+	}
+	held, err := src(ctx)
+	if err != nil {
+		return nil, total, fmt.Errorf("reading reservations: %v", err)
+	}
+	for _, r := range held {
+		if committing != nil && r.ID == committing.ID {
+			continue
+		}
+		names[r.InstanceName] = true
+		u := r.usage()
+		total.instances += u.instances
+		total.cpuMilli += u.cpuMilli
+		total.memory += u.memory
+	}
+	return names, total, nil
+}
+
+// reservationFor describes the capacity a validated spec needs, for the
+// reservation of info, an instance of the tenant.
+func reservationFor(tenantID string, info *InstanceInfo) Reservation {
+	u := instanceRequests(info.Spec)
+	r := Reservation{TenantID: tenantID, InstanceName: info.Name}
+	if u.cpuMilli > 0 {
+		r.CPU = resource.NewMilliQuantity(u.cpuMilli, resource.DecimalSI).String()
+	}
+	if u.memory > 0 {
+		r.Memory = resource.NewQuantity(u.memory, resource.BinarySI).String()
+	}
+	return r
+}
+
+// UseReservations makes creates and reservations honour the reservations src
+// returns: the names they hold are not given to other instances, and the
+// capacity they hold counts as used.
+func (m *Manager) UseReservations(src ReservationSource) {
+	m.mu.Lock()
+	m.reservations = src
+	m.mu.Unlock()
+}
+
+// reservationSource returns the source set by UseReservations, if any.
+func (m *Manager) reservationSource() ReservationSource {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reservations
+}
+
+// ReserveInstance chooses the name of a new instance of the tenant and checks
+// that the instance can be created, as a dry-run create does, without
+// creating anything. It returns the would-be instance, with status
+// "reserved", and the reservation to hold for it until the create is
+// committed; the caller sets the reservation's ID.
+func (m *Manager) ReserveInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, Reservation, error) {
+	id, err := tenant.Parse(tenantID)
+	if err != nil {
+		return nil, Reservation{}, &InvalidSpecError{Message: "invalid tenant ID: " + err.Error()}
+	}
+	tenantID = id.String()
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, Reservation{}, err
+	}
+	defer unlock()
+
+	opts.DryRun = true
+	info, err := m.createInstance(ctx, tenantID, opts)
+	if err != nil {
+		return nil, Reservation{}, err
+	}
+	info.Status = "reserved"
+	return info, reservationFor(tenantID, info), nil
+}
+
+// UseReservations makes fake creates leave the names that src returns alone
+// and count the reservations against CAPACITY_MAX_INSTANCES.
+func (f *FakeManager) UseReservations(src ReservationSource) {
+	f.mu.Lock()
+	f.reservations = src
+	f.mu.Unlock()
+}
+
+// ReserveInstance is ReserveInstance for fake instances.
+func (f *FakeManager) ReserveInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, Reservation, error) {
+	opts.DryRun = true
+	info, err := f.CreateInstance(ctx, tenantID, opts)
+	if err != nil {
+		return nil, Reservation{}, err
+	}
+	info.Status = "reserved"
+	return info, reservationFor(tenantID, info), nil
+}
+
+// checkFakeCapacity refuses a fake instance when the instances and the
+// reservations held would exceed CAPACITY_MAX_INSTANCES. Callers hold f.mu.
+func (f *FakeManager) checkFakeCapacity(held usage) error {
+	max := f.cfg.CapacityMaxInstances
+	used := len(f.instances) + int(held.instances)
+	if max > 0 && used >= max {
+		return &CapacityError{
+			Resource:  "instances",
+			Used:      strconv.Itoa(used),
+			Requested: "1",
+			Limit:     strconv.Itoa(max),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// retainedLabel marks volumes and snapshots kept after their instance
+	// was deleted, so that they can be found again without the instance.
+	retainedLabel = annotationPrefix + "retained"
+
+	// retainedUntilAnnotation holds the RFC 3339 time after which retained
+	// storage is removed.
+	retainedUntilAnnotation = annotationPrefix + "retained-until"
+
+	// retainedInstanceAnnotation names the instance the storage belonged to.
+	retainedInstanceAnnotation = annotationPrefix + "retained-instance"
+)
+
+// retainedKinds are the artifacts kept by DeleteInstanceRetainingStorage.
+var retainedKinds = []purgeKind{
+	{Kind: "PersistentVolumeClaim", GVR: pvcGVR},
+	{Kind: "VolumeSnapshot", GVR: snapshotGVR},
+}
+
+// ErrNoRetainedStorage is returned by ReactivateInstance when the tenant has
+// no retained volume to re-create its instance on.
+var ErrNoRetainedStorage = fmt.Errorf("no retained storage")
+
+// ErrInstanceExists is returned by ReactivateInstance when the instance to
+// re-create already exists.
+var ErrInstanceExists = fmt.Errorf("instance already exists")
+
+// RetainedArtifact is a volume or snapshot kept after its instance was
+// deleted.
+type RetainedArtifact struct {
+	TenantID string    `json:"tenant_id"`
+	Instance string    `json:"instance"`
+	Kind     string    `json:"kind"`
+	Name     string    `json:"name"`
+	Until    time.Time `json:"retained_until"`
+}
+
+// DeleteInstanceRetainingStorage deletes the tenant's instances like
+// DeleteInstance, except that their volumes and snapshots are detached from
+// the instance and kept until until, so that the tenant can be re-created
+// with its data. It returns what was retained, or ErrNotFound if the tenant
+// has no instance.
+func (m *Manager) DeleteInstanceRetainingStorage(ctx context.Context, tenantID string, until time.Time) ([]RetainedArtifact, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	kinds := make([]purgeKind, 0, len(deleteKinds))
+	for _, k := range deleteKinds {
+		if k.GVR != pvcGVR && k.GVR != snapshotGVR {
+			kinds = append(kinds, k)
+		}
+	}
+	targets, err := m.purgeTargets(ctx, client, tenantID, kinds)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// Detach the storage first: without owner references the garbage
+	// collector leaves it alone when the instance goes.
+	var retained []RetainedArtifact
+	for _, t := range targets {
+		if t.gvr != m.instanceGVR() {
+			continue
+		}
+		for _, k := range retainedKinds {
+			items, err := m.retain(ctx, client, k, tenantID, t.artifact.Name, until)
+			if err != nil {
+				return nil, err
+			}
+			retained = append(retained, items...)
+		}
+	}
+
+	if err := m.removeTargets(ctx, client, targets, m.cfg.DeleteVerifyTimeout); err != nil {
+		return nil, err
+	}
+	for _, r := range retained {
+		gvr := pvcGVR
+		if r.Kind != "PersistentVolumeClaim" {
+			gvr = snapshotGVR
+		}
+		if _, err := client.Resource(gvr).Namespace(m.cfg.Namespace).Get(ctx, r.Name, metav1.GetOptions{}); err != nil {
+			return nil, fmt.Errorf("verifying retained %s %s: %v", r.Kind, r.Name, err)
+		}
+	}
+	log.Printf("deleted tenant %s retaining %d volume(s) and snapshot(s) until %s", tenantID, len(retained), until.Format(time.RFC3339))
+	return retained, nil
+}
+
+// retain detaches the instance's objects of kind k and marks them retained
+// until until.
+func (m *Manager) retain(ctx context.Context, client dynamic.Interface, k purgeKind, tenantID, instanceName string, until time.Time) ([]RetainedArtifact, error) {
+	resource := client.Resource(k.GVR).Namespace(m.cfg.Namespace)
+	list, err := resource.List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, instanceName),
+	})
+	if err != nil {
+		// Optional APIs such as VolumeSnapshot may not be installed.
+		if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("listing %s for %s: %v", k.Kind, instanceName, err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": nil,
+			"labels":          map[string]interface{}{retainedLabel: "true", "tenant": tenantID},
+			"annotations": map[string]interface{}{
+				retainedUntilAnnotation:    until.UTC().Format(time.RFC3339),
+				retainedInstanceAnnotation: instanceName,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding patch: %v", err)
+	}
+
+	var out []RetainedArtifact
+	for _, item := range list.Items {
+		if _, err := resource.Patch(ctx, item.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, fmt.Errorf("retaining %s %s: %v", k.Kind, item.GetName(), err)
+		}
+		out = append(out, RetainedArtifact{TenantID: tenantID, Instance: instanceName, Kind: k.Kind, Name: item.GetName(), Until: until.UTC()})
+	}
+	return out, nil
+}
+
+// ReactivateInstance re-creates a tenant's instance deleted with
+// DeleteInstanceRetainingStorage: the new instance takes the old one's name,
+// and so its endpoint, and is bound to its retained volume. If ctx selects an
+// instance by name (see WithInstance) that instance is re-created; otherwise
+// the one retained most recently. The volume and the instance's snapshots
+// then stop being retained. It returns ErrNoRetainedStorage if there is no
+// such retained volume and ErrInstanceExists if an instance of that name
+// exists.
+func (m *Manager) ReactivateInstance(ctx context.Context, tenantID string, opts CreateOptions) (*InstanceInfo, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client := m.clientFor(ctx)
+	items, err := m.retainedObjects(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := selectedInstance(ctx)
+	var volume *RetainedArtifact
+	for i := range items {
+		a := &items[i].artifact
+		if a.TenantID == tenantID && a.Kind == "PersistentVolumeClaim" && a.Instance != "" && (name == "" || a.Instance == name) {
+			volume = a // Sorted by expiry, so the last is the most recent.
+		}
+	}
+	if volume == nil {
+		return nil, ErrNoRetainedStorage
+	}
+	if _, err := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).Get(ctx, volume.Instance, metav1.GetOptions{}); err == nil {
+		return nil, ErrInstanceExists
+	} else if !errors.IsNotFound(err) {
+		return nil, fmt.Errorf("looking up instance %s: %v", volume.Instance, err)
+	}
+	pvc, err := client.Resource(pvcGVR).Namespace(m.cfg.Namespace).Get(ctx, volume.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("reading retained volume %s: %v", volume.Name, err)
+	}
+	size, _, _ := unstructured.NestedString(pvc.Object, "spec", "resources", "requests", "storage")
+
+	opts.DryRun = false
+	opts.instanceName = volume.Instance
+	opts.existingClaim = volume.Name
+	opts.storageSize = size
+	info, err := m.createInstance(ctx, tenantID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if item.artifact.TenantID != tenantID || item.artifact.Instance != volume.Instance {
+			continue
+		}
+		if err := m.release(ctx, client, item); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("reactivated tenant %s as %s on retained volume %s", tenantID, info.Name, volume.Name)
+	return info, nil
+}
+
+// release stops retaining item, so that the janitor leaves it alone and the
+// next delete of its instance removes it.
+func (m *Manager) release(ctx context.Context, client dynamic.Interface, item retainedObject) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{retainedLabel: nil},
+			"annotations": map[string]interface{}{
+				retainedUntilAnnotation:    nil,
+				retainedInstanceAnnotation: nil,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("encoding patch: %v", err)
+	}
+	_, err = client.Resource(item.gvr).Namespace(m.cfg.Namespace).Patch(ctx, item.artifact.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("releasing retained %s %s: %v", item.artifact.Kind, item.artifact.Name, err)
+	}
+	return nil
+}
+
+// RetainedStorage lists the retained volumes and snapshots of every tenant,
+// soonest to expire first.
+func (m *Manager) RetainedStorage(ctx context.Context) ([]RetainedArtifact, error) {
+	items, err := m.retainedObjects(ctx, m.readerFor(ctx))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]RetainedArtifact, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.artifact)
+	}
+	return out, nil
+}
+
+// ExpireRetainedStorage deletes the retained volumes and snapshots whose
+// retention has ended, and returns them. Each is read again and deleted
+// under its tenant's lock, so that one reactivated in the meantime is kept.
+func (m *Manager) ExpireRetainedStorage(ctx context.Context) ([]RetainedArtifact, error) {
+	client := m.clientFor(ctx)
+	items, err := m.retainedObjects(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var expired []RetainedArtifact
+	for _, item := range items {
+		if now.Before(item.artifact.Until) {
+			continue
+		}
+		deleted, err := m.expireRetainedObject(ctx, client, item, now)
+		if err != nil {
+			return expired, err
+		}
+		if deleted {
+			expired = append(expired, item.artifact)
+		}
+	}
+	return expired, nil
+}
+
+// expireRetainedObject deletes item under its tenant's lock if it is still
+// retained and its retention has ended at now.
+func (m *Manager) expireRetainedObject(ctx context.Context, client dynamic.Interface, item retainedObject, now time.Time) (bool, error) {
+	unlock, err := m.locks.lock(ctx, item.artifact.TenantID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	resource := client.Resource(item.gvr).Namespace(m.cfg.Namespace)
+	current, err := resource.Get(ctx, item.artifact.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("reading retained %s %s: %v", item.artifact.Kind, item.artifact.Name, err)
+	}
+	if current.GetLabels()[retainedLabel] != "true" || now.Before(retainedArtifact(current, item.artifact.Kind).Until) {
+		return false, nil
+	}
+	uid, rv := current.GetUID(), current.GetResourceVersion()
+	err = resource.Delete(ctx, item.artifact.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid, ResourceVersion: &rv},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("deleting retained %s %s: %v", item.artifact.Kind, item.artifact.Name, err)
+	}
+	return true, nil
+}
+
+// retainedObject is a retained artifact with the GVR to delete it by.
+type retainedObject struct {
+	artifact RetainedArtifact
+	gvr      schema.GroupVersionResource
+}
+
+// retainedObjects lists every retained volume and snapshot, soonest to
+// expire first. Objects with an unreadable expiry are treated as expired.
+func (m *Manager) retainedObjects(ctx context.Context, client dynamic.Interface) ([]retainedObject, error) {
+	var out []retainedObject
+	for _, k := range retainedKinds {
+		list, err := client.Resource(k.GVR).Namespace(m.cfg.Namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: retainedLabel + "=true",
+		})
+		if err != nil {
+			if errors.IsNotFound(err) || meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("listing retained %s: %v", k.Kind, err)
+		}
+		for _, item := range list.Items {
+			out = append(out, retainedObject{artifact: retainedArtifact(&item, k.Kind), gvr: k.GVR})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].artifact.Until.Before(out[j].artifact.Until) })
+	return out, nil
+}
+
+// retainedArtifact describes a retained object from its labels and
+// annotations.
+func retainedArtifact(item *unstructured.Unstructured, kind string) RetainedArtifact {
+	annotations := item.GetAnnotations()
+	until, _ := time.Parse(time.RFC3339, annotations[retainedUntilAnnotation])
+	return RetainedArtifact{
+		TenantID: item.GetLabels()["tenant"],
+		Instance: annotations[retainedInstanceAnnotation],
+		Kind:     kind,
+		Name:     item.GetName(),
+		Until:    until,
+	}
+}
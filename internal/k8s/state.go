@@ -0,0 +1,185 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// Provisioning states reported in InstanceInfo.State. They refine Status,
+// which stays coarse for the consumers that only care whether an instance is
+// up: every state before StateRunning corresponds to a Status of "starting".
+const (
+	StatePending       = "pending"         // No pod exists yet
+	StateScheduling    = "scheduling"      // The pod is waiting for a node
+	StatePullingImage  = "pulling-image"   // The pod is on a node and its containers are being created
+	StateStarting      = "starting"        // Containers are up but not yet ready
+	StateWaitingForDNS = "waiting-for-dns" // The ingress has no load balancer address, or the hostname does not resolve yet
+	StateWaitingForTLS = "waiting-for-tls" // cert-manager has not issued the certificate yet
+	StateTLSFailed     = "tls-failed"      // Certificate issuance failed; the message carries the ACME error
+	StateRunning       = "running"
+	StateDegraded      = "degraded" // The operator reports Running but a pod is not ready
+	StateSuspended     = "suspended"
+	StateError         = "error"
+)
+
+var (
+	ingressGVR     = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	certificateGVR = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+)
+
+// failedWaitingReasons are container waiting reasons that will not resolve
+// without intervention.
+var failedWaitingReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+	"RunContainerError":          true,
+	"CrashLoopBackOff":           true,
+}
+
+// podProgress orders the pod-level states from least to most advanced, so
+// that an instance is reported at the stage of its slowest pod.
+var podProgress = map[string]int{
+	StateError:        0,
+	StateScheduling:   1,
+	StatePullingImage: 2,
+	StateStarting:     3,
+	StateRunning:      4,
+}
+
+// stateFromStatus is the State implied by a coarse Status alone, used when the
+// instance's pods cannot be inspected.
+func stateFromStatus(status string) string {
+	switch status {
+	case "running", "suspended", "error":
+		return status
+	}
+	return StatePending
+}
+
+// instanceState derives the provisioning state of an instance, whose coarse
+// info has already been computed from item, from its pods, its ingress and
+// its cert-manager Certificate. It returns the state and, where there is
+// one, a short explanation. Resources that cannot be read are skipped
+// rather than failing the lookup.
+func (m *Manager) instanceState(ctx context.Context, client dynamic.Interface, item *unstructured.Unstructured, info *InstanceInfo) (string, string) {
+	if info.Status == "suspended" || info.Status == "error" {
+		return info.Status, ""
+	}
+	ns := m.cfg.Namespace
+
+	pods, err := client.Resource(podGVR).Namespace(ns).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", instanceLabel, info.Name),
+	})
+	if err != nil {
+		return stateFromStatus(info.Status), ""
+	}
+	state, detail := StatePending, ""
+	if info.Status == "running" {
+		state, detail = StateDegraded, "no pods"
+	}
+	seen := false
+	for _, pod := range pods.Items {
+		if pod.GetDeletionTimestamp() != nil {
+			continue
+		}
+		s, d := podState(&pod)
+		if !seen || podProgress[s] < podProgress[state] {
+			state, detail = s, d
+		}
+		seen = true
+	}
+	if !seen {
+		return state, detail
+	}
+	if state != StateRunning {
+		if info.Status == "running" {
+			return StateDegraded, detail
+		}
+		return state, detail
+	}
+
+	if message, err := ingressProviderFor(m.cfg).routed(ctx, client, ns, info.Name); err == nil && message != "" {
+		return StateWaitingForDNS, message
+	}
+	if message := m.dns.check(ctx, instanceHost(m.cfg.Domain, info.Name, info.Environment)); message != "" {
+		return StateWaitingForDNS, message
+	}
+
+	if cert, err := m.certificateStatus(ctx, client, item); err == nil && !cert.Ready {
+		if cert.Failed {
+			return StateTLSFailed, cert.Message
+		}
+		return StateWaitingForTLS, cert.Message
+	}
+	return StateRunning, ""
+}
+
+// podState places a single pod in the provisioning sequence.
+func podState(pod *unstructured.Unstructured) (string, string) {
+	if phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase"); phase == "Failed" {
+		reason, _, _ := unstructured.NestedString(pod.Object, "status", "reason")
+		return StateError, fmt.Sprintf("pod %s failed: %s", pod.GetName(), reason)
+	}
+	if scheduled, message := conditionStatus(pod, "PodScheduled"); scheduled != "True" {
+		return StateScheduling, message
+	}
+
+	var statuses []interface{}
+	for _, field := range []string{"initContainerStatuses", "containerStatuses"} {
+		s, _, _ := unstructured.NestedSlice(pod.Object, "status", field)
+		statuses = append(statuses, s...)
+	}
+	if len(statuses) == 0 {
+		return StatePullingImage, ""
+	}
+	creating := false
+	for _, s := range statuses {
+		status, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		reason, _, _ := unstructured.NestedString(status, "state", "waiting", "reason")
+		if failedWaitingReasons[reason] {
+			message, _, _ := unstructured.NestedString(status, "state", "waiting", "message")
+			name, _, _ := unstructured.NestedString(status, "name")
+			if message == "" {
+				message = reason
+			}
+			return StateError, fmt.Sprintf("container %s: %s", name, message)
+		}
+		if reason == "ContainerCreating" {
+			creating = true
+		}
+	}
+	if creating {
+		return StatePullingImage, ""
+	}
+	if ready, message := conditionStatus(pod, "Ready"); ready != "True" {
+		return StateStarting, message
+	}
+	return StateRunning, ""
+}
+
+// conditionStatus returns the status ("True", "False", "Unknown") and message
+// of the named condition in obj's status, or "" if it is absent.
+func conditionStatus(obj *unstructured.Unstructured, conditionType string) (string, string) {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		cond, ok := c.(map[string]interface{})
+		if !ok || cond["type"] != conditionType {
+			continue
+		}
+		status, _ := cond["status"].(string)
+		message, _ := cond["message"].(string)
+		return status, message
+	}
+	return "", ""
+}
@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/util/retry"
+)
+
+// gatewayTokenEnv is the variable through which OpenClaw receives its
+// gateway token.
+const gatewayTokenEnv = "OPENCLAW_GATEWAY_TOKEN"
+
+// RotateGatewayToken replaces the gateway token of the tenant's instances
+// with token. The env change makes the operator roll the pod, after which
+// the old token is no longer accepted. For a token kept in a Secret, the
+// Secret and the digest annotation are updated instead and the pods deleted,
+// since the spec does not change. It returns ErrNotFound if the tenant has
+// no instance.
+func (m *Manager) RotateGatewayToken(ctx context.Context, tenantID, token string) error {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	resource := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	list, err := m.listTenantInstances(ctx, client, tenantID)
+	if err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		return ErrNotFound
+	}
+
+	var restart []string // Secret-backed instances, whose pods must be restarted
+	for _, instance := range list.Items {
+		name := instance.GetName()
+		secretBacked := false
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			current, err := resource.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := checkVersion(ctx, current); err != nil {
+				return err
+			}
+			env, _, _ := unstructured.NestedSlice(current.Object, "spec", "env")
+			if _, secretName := gatewayTokenSource(env); secretName != "" {
+				if err := m.applyGatewaySecret(ctx, client, name, tenantID, token); err != nil {
+					return err
+				}
+				annotations := current.GetAnnotations()
+				if annotations == nil {
+					annotations = map[string]string{}
+				}
+				annotations[tokenDigestAnnotation] = tokenDigest(token)
+				current.SetAnnotations(annotations)
+				secretBacked = true
+			} else if err := unstructured.SetNestedSlice(current.Object, withGatewayToken(env, token), "spec", "env"); err != nil {
+				return err
+			}
+			stampChange(ctx, current)
+			_, err = resource.Update(ctx, current, metav1.UpdateOptions{})
+			return err
+		})
+		if err == ErrPreconditionFailed {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("rotating gateway token on %s: %v", name, err)
+		}
+		if secretBacked {
+			restart = append(restart, name)
+		}
+	}
+
+	pods := client.Resource(podGVR).Namespace(m.cfg.Namespace)
+	for _, name := range restart {
+		items, err := instancePods(ctx, client, m.cfg.Namespace, name)
+		if err != nil {
+			return err
+		}
+		for _, pod := range items {
+			err := pods.Delete(ctx, pod.GetName(), metav1.DeleteOptions{})
+			if err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("deleting pod %s: %v", pod.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// withGatewayToken returns env with the gateway token variable set to token,
+// keeping its position, or appended if it was missing.
+func withGatewayToken(env []interface{}, token string) []interface{} {
+	return withGatewayTokenEntry(env, map[string]interface{}{"name": gatewayTokenEnv, "value": token})
+}
+
+// withGatewayTokenEntry returns env with the gateway token variable replaced
+// by entry, keeping its position, or appended if it was missing.
+func withGatewayTokenEntry(env []interface{}, entry map[string]interface{}) []interface{} {
+	out := make([]interface{}, 0, len(env)+1)
+	found := false
+	for _, e := range env {
+		if m, ok := e.(map[string]interface{}); ok && m["name"] == gatewayTokenEnv {
+			e = entry
+			found = true
+		}
+		out = append(out, e)
+	}
+	if !found {
+		out = append(out, entry)
+	}
+	return out
+}
+
+// RedactSpec returns a copy of an OpenClawInstance object whose spec.env
+// carries no secret values: the value of the gateway token, of the
+// variables named in shared and of any variable set to one of shared's
+// values is dropped. References to Secrets are kept.
+func RedactSpec(obj map[string]interface{}, shared map[string]string) map[string]interface{} {
+	out, err := copyJSON(obj)
+	if err != nil {
+		return nil
+	}
+	secret := map[string]bool{}
+	for _, value := range shared {
+		if value != "" {
+			secret[value] = true
+		}
+	}
+	env, _, _ := unstructured.NestedSlice(out, "spec", "env")
+	for _, e := range env {
+		m, ok := e.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := m["name"].(string)
+		value, _ := m["value"].(string)
+		if _, isShared := shared[name]; name == gatewayTokenEnv || isShared || secret[value] {
+			delete(m, "value")
+		}
+	}
+	if env != nil {
+		unstructured.SetNestedSlice(out, env, "spec", "env")
+	}
+	return out
+}
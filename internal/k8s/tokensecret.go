@@ -0,0 +1,265 @@
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// With cfg.GatewayTokenSecrets, an instance's gateway token is kept in a
+// Secret of its own and the spec only references it, so that the token
+// stays out of the CR, the registry and anything else that records specs.
+// The CR carries the token's SHA-256 digest instead, which is all tenant
+// authentication needs.
+
+var secretGVR = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+const (
+	// gatewaySecretKey is the key of the token in the Secret.
+	gatewaySecretKey = "token"
+
+	// tokenDigestAnnotation holds the hex SHA-256 digest of the gateway
+	// token of an instance whose token is kept in a Secret.
+	tokenDigestAnnotation = annotationPrefix + "gateway-token-sha256"
+)
+
+// gatewaySecretName returns the name of the Secret holding an instance's
+// gateway token.
+func gatewaySecretName(instanceName string) string {
+	return instanceName + "-gateway-token"
+}
+
+// tokenDigest returns the hex SHA-256 digest of token.
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// gatewayTokenRef returns the env entry that reads the gateway token from
+// secretName.
+func gatewayTokenRef(secretName string) map[string]interface{} {
+	return map[string]interface{}{
+		"name": gatewayTokenEnv,
+		"valueFrom": map[string]interface{}{
+			"secretKeyRef": map[string]interface{}{"name": secretName, "key": gatewaySecretKey},
+		},
+	}
+}
+
+// gatewayTokenSource returns the plaintext gateway token in env, or the
+// Secret it is read from.
+func gatewayTokenSource(env []interface{}) (token, secretName string) {
+	for _, e := range env {
+		m, ok := e.(map[string]interface{})
+		if !ok || m["name"] != gatewayTokenEnv {
+			continue
+		}
+		if v, ok := m["value"].(string); ok {
+			return v, ""
+		}
+		secretName, _, _ = unstructured.NestedString(m, "valueFrom", "secretKeyRef", "name")
+		return "", secretName
+	}
+	return "", ""
+}
+
+// applyGatewaySecret creates the Secret holding an instance's gateway token,
+// or replaces the token in it.
+func (m *Manager) applyGatewaySecret(ctx context.Context, client dynamic.Interface, instanceName, tenantID, token string) error {
+	secrets := client.Resource(secretGVR).Namespace(m.cfg.Namespace)
+	name := gatewaySecretName(instanceName)
+	data := map[string]interface{}{gatewaySecretKey: base64.StdEncoding.EncodeToString([]byte(token))}
+
+	labels := map[string]interface{}{
+		instanceLabel: instanceName,
+		"tenant":      tenantID,
+		"app":         "tenant-instance",
+	}
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"namespace":   m.cfg.Namespace,
+			"labels":      labels,
+			"annotations": requestAnnotations(ctx),
+		},
+		"type": "Opaque",
+		"data": data,
+	}}
+	_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if err == nil {
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("creating secret %s: %v", name, err)
+	}
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		current.Object["data"] = data
+		stampChange(ctx, current)
+		_, err = secrets.Update(ctx, current, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("updating secret %s: %v", name, err)
+	}
+	return nil
+}
+
+// ownGatewaySecret makes instance the owner of its token Secret, so that the
+// Secret is garbage-collected with it however it is deleted.
+func (m *Manager) ownGatewaySecret(ctx context.Context, client dynamic.Interface, instance *unstructured.Unstructured) error {
+	patch := fmt.Sprintf(`{"metadata":{"ownerReferences":[{"apiVersion":%q,"kind":%q,"name":%q,"uid":%q}]}}`,
+		instance.GetAPIVersion(), instance.GetKind(), instance.GetName(), instance.GetUID())
+	name := gatewaySecretName(instance.GetName())
+	_, err := client.Resource(secretGVR).Namespace(m.cfg.Namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("setting owner of secret %s: %v", name, err)
+	}
+	return nil
+}
+
+// gatewayToken reads the gateway token of an instance from the Secret its
+// spec references.
+func (m *Manager) gatewayToken(ctx context.Context, client dynamic.Interface, secretName string) (string, error) {
+	secret, err := client.Resource(secretGVR).Namespace(m.cfg.Namespace).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("reading secret %s: %v", secretName, err)
+	}
+	encoded, _, _ := unstructured.NestedString(secret.Object, "data", gatewaySecretKey)
+	token, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("decoding secret %s: %v", secretName, err)
+	}
+	return string(token), nil
+}
+
+// MigrateGatewayTokens moves the gateway token of every instance that still
+// carries it in plaintext into a Secret, and points the spec at the Secret.
+// The token itself is unchanged, so clients are unaffected. Instances are
+// migrated one at a time: each change rolls the instance's pod, and the next
+// migration waits until it runs again, or cfg.GatewayTokenMigrationTimeout
+// elapses, in which case the migration stops. It returns the number of
+// instances migrated.
+func (m *Manager) MigrateGatewayTokens(ctx context.Context) (int, error) {
+	instances, err := m.ListInstances(ctx)
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for _, inst := range instances {
+		env, _, _ := unstructured.NestedSlice(inst.Object.Object, "spec", "env")
+		if token, _ := gatewayTokenSource(env); token == "" {
+			continue
+		}
+		ok, err := m.migrateGatewayToken(ctx, inst.TenantID, inst.Object.GetName())
+		if err != nil {
+			return migrated, fmt.Errorf("migrating %s: %v", inst.Object.GetName(), err)
+		}
+		if !ok {
+			continue
+		}
+		migrated++
+		log.Printf("gateway tokens: moved token of %s (tenant %s) into secret %s",
+			inst.Object.GetName(), inst.TenantID, gatewaySecretName(inst.Object.GetName()))
+		if err := m.waitRunning(ctx, inst.Object.GetName(), m.cfg.GatewayTokenMigrationTimeout); err != nil {
+			return migrated, err
+		}
+	}
+	return migrated, nil
+}
+
+// migrateGatewayToken migrates one instance under its tenant's lock. It
+// reports false if the instance no longer carries a plaintext token.
+func (m *Manager) migrateGatewayToken(ctx context.Context, tenantID, name string) (bool, error) {
+	unlock, err := m.locks.lock(ctx, tenantID)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	defer m.cache.invalidate(tenantID)
+
+	client := m.clientFor(ctx)
+	resource := client.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	migrated := false
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		current, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		env, _, _ := unstructured.NestedSlice(current.Object, "spec", "env")
+		token, _ := gatewayTokenSource(env)
+		if token == "" {
+			return nil
+		}
+		// The Secret exists, with the same token, before the spec refers to
+		// it, so the rolled pod starts with the token it had.
+		if err := m.applyGatewaySecret(ctx, client, name, tenantID, token); err != nil {
+			return err
+		}
+		if err := m.ownGatewaySecret(ctx, client, current); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedSlice(current.Object, withGatewayTokenEntry(env, gatewayTokenRef(gatewaySecretName(name))), "spec", "env"); err != nil {
+			return err
+		}
+		annotations := current.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[tokenDigestAnnotation] = tokenDigest(token)
+		current.SetAnnotations(annotations)
+		stampChange(ctx, current)
+		if _, err := resource.Update(ctx, current, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		migrated = true
+		return nil
+	})
+	return migrated, err
+}
+
+// waitRunning waits until the named instance reports the Running phase
+// again, polling every few seconds, for at most timeout.
+func (m *Manager) waitRunning(ctx context.Context, name string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resource := m.clientFor(ctx).Resource(m.instanceGVR()).Namespace(m.cfg.Namespace)
+	// Let the operator pick up the change before the phase is trusted.
+	wait := 5 * time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not running again after %s: %v", name, timeout, ctx.Err())
+		case <-time.After(wait):
+		}
+		current, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err == nil {
+			if phase, _, _ := unstructured.NestedString(current.Object, "status", "phase"); phase == "Running" {
+				return nil
+			}
+		}
+	}
+}
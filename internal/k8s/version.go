@@ -0,0 +1,130 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// crdGroup is the API group of the OpenClaw operator's CRDs.
+const crdGroup = "openclaw.rocks"
+
+// crdAdapter hides the differences between served versions of the
+// OpenClawInstance CRD. The rest of the package builds and reads objects in
+// the v1alpha1 shape; adapters convert to and from the version the cluster
+// actually serves.
+type crdAdapter interface {
+	// version is the CRD version this adapter speaks, e.g. "v1alpha1".
+	version() string
+	// encode converts an object built in the v1alpha1 shape into this
+	// version's shape, in place.
+	encode(obj *unstructured.Unstructured)
+	// decode converts an object read from the cluster back into the v1alpha1
+	// shape, in place.
+	decode(obj *unstructured.Unstructured)
+}
+
+// crdAdapters lists the supported versions, newest first. Negotiation picks
+// the first one the cluster serves.
+var crdAdapters = []crdAdapter{
+	v1alpha1Adapter{},
+}
+
+// SupportedCRDVersions returns the OpenClawInstance versions this build can
+// speak, newest first.
+func SupportedCRDVersions() []string {
+	versions := make([]string, 0, len(crdAdapters))
+	for _, a := range crdAdapters {
+		versions = append(versions, a.version())
+	}
+	return versions
+}
+
+// v1alpha1Adapter is the identity adapter for the canonical version.
+type v1alpha1Adapter struct{}
+
+func (v1alpha1Adapter) version() string { return "v1alpha1" }
+
+func (v1alpha1Adapter) encode(obj *unstructured.Unstructured) {
+	obj.SetAPIVersion(crdGroup + "/v1alpha1")
+}
+
+func (v1alpha1Adapter) decode(*unstructured.Unstructured) {}
+
+// instanceGVR returns the OpenClawInstance resource at the active cluster's
+// negotiated version.
+func (m *Manager) instanceGVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    crdGroup,
+		Version:  m.current().adapter.version(),
+		Resource: "openclawinstances",
+	}
+}
+
+// apiGroup is the subset of the discovery APIGroup document we need.
+type apiGroup struct {
+	Versions []struct {
+		Version string `json:"version"`
+	} `json:"versions"`
+}
+
+// negotiateCRDVersion asks the target's API server which versions of the
+// openclaw.rocks group it serves and returns the newest adapter among them.
+// If discovery fails or nothing matches, it falls back to the oldest
+// supported version so that startup does not depend on the CRD being
+// installed yet.
+func (t *clusterTarget) negotiateCRDVersion(ctx context.Context) crdAdapter {
+	fallback := crdAdapters[len(crdAdapters)-1]
+
+	served, err := t.servedVersions(ctx)
+	if err != nil {
+		log.Printf("CRD version discovery on %s failed, assuming %s: %v", t.name, fallback.version(), err)
+		return fallback
+	}
+	for _, a := range crdAdapters {
+		for _, v := range served {
+			if v == a.version() {
+				return a
+			}
+		}
+	}
+	log.Printf("cluster %s serves %s versions %v, none supported (%v); assuming %s",
+		t.name, crdGroup, served, SupportedCRDVersions(), fallback.version())
+	return fallback
+}
+
+// servedVersions lists the versions of the openclaw.rocks group served by the
+// target's API server.
+func (t *clusterTarget) servedVersions(ctx context.Context) ([]string, error) {
+	url := strings.TrimSuffix(t.restCfg.Host, "/") + "/apis/" + crdGroup
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET /apis/%s: status %d", crdGroup, resp.StatusCode)
+	}
+
+	var group apiGroup
+	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+		return nil, fmt.Errorf("decoding API group: %v", err)
+	}
+	versions := make([]string, 0, len(group.Versions))
+	for _, v := range group.Versions {
+		versions = append(versions, v.Version)
+	}
+	return versions, nil
+}
@@ -0,0 +1,118 @@
+package k8s
+
+import (
+	"context"
+	"log"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InstanceEventType identifies the kind of change seen by the watch.
+type InstanceEventType string
+
+const (
+	InstanceAdded   InstanceEventType = "added"
+	InstanceUpdated InstanceEventType = "updated"
+	InstanceDeleted InstanceEventType = "deleted"
+
+	// InstanceSynced is sent once Watch has delivered an InstanceAdded event
+	// for every instance that existed when it started. It carries no tenant
+	// or info; handlers use it to drop state for instances deleted while the
+	// service was down.
+	InstanceSynced InstanceEventType = "synced"
+)
+
+// InstanceEvent describes a change to a tenant's OpenClawInstance observed by
+// Watch.
+type InstanceEvent struct {
+	Type     InstanceEventType
+	TenantID string
+	Info     *InstanceInfo
+
+	// Object is the full OpenClawInstance in the canonical version. Handlers
+	// must not modify it.
+	Object *unstructured.Unstructured
+}
+
+// OnInstanceEvent registers fn to be called for every instance change seen by
+// Watch. Handlers run synchronously on the watch goroutine and must not block.
+func (m *Manager) OnInstanceEvent(fn func(InstanceEvent)) {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, fn)
+	m.mu.Unlock()
+}
+
+// Watch follows OpenClawInstance changes in the namespace until ctx is
+// cancelled, invalidating the instance cache and notifying registered
+// handlers. The informer re-lists and re-watches on its own after API server
+// disconnects.
+func (m *Manager) Watch(ctx context.Context) {
+	selector := "app=tenant-instance"
+	lw := &cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			opts.LabelSelector = selector
+			return m.current().reader.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).List(ctx, opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.LabelSelector = selector
+			return m.current().reader.Resource(m.instanceGVR()).Namespace(m.cfg.Namespace).Watch(ctx, opts)
+		},
+	}
+
+	informer := cache.NewSharedInformer(lw, &unstructured.Unstructured{}, 0)
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			m.dispatch(InstanceAdded, obj)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			m.dispatch(InstanceUpdated, obj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			m.dispatch(InstanceDeleted, obj)
+		},
+	})
+
+	log.Printf("watching OpenClawInstances in namespace %s", m.cfg.Namespace)
+	go informer.Run(ctx.Done())
+	if cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		m.notify(InstanceEvent{Type: InstanceSynced})
+	}
+	<-ctx.Done()
+}
+
+// dispatch converts an informer object into an InstanceEvent and fans it out.
+func (m *Manager) dispatch(typ InstanceEventType, obj interface{}) {
+	item, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	tenantID := item.GetLabels()["tenant"]
+	m.cache.invalidate(tenantID)
+
+	item = item.DeepCopy()
+	m.current().adapter.decode(item)
+
+	m.notify(InstanceEvent{
+		Type:     typ,
+		TenantID: tenantID,
+		Info:     m.instanceInfo(item),
+		Object:   item,
+	})
+}
+
+// notify delivers ev to every registered handler.
+func (m *Manager) notify(ev InstanceEvent) {
+	m.mu.Lock()
+	handlers := append([]func(InstanceEvent){}, m.handlers...)
+	m.mu.Unlock()
+	for _, fn := range handlers {
+		fn(ev)
+	}
+}
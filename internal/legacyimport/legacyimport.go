@@ -0,0 +1,140 @@
+// Package legacyimport reads tenant exports of the legacy provisioning
+// system, in CSV or JSON, into rows for the service to create or adopt
+// instances from. Parsing is lenient per row: a row that cannot be read is
+// returned with its error, so that one bad row does not hide the others.
+package legacyimport
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of an export.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Row is one tenant of an export. Only TenantID is required. Instance names
+// an existing OpenClawInstance to adopt; without it an instance is created.
+// GatewayToken keeps the tenant's legacy token on a created instance; a new
+// one is generated when it is empty.
+type Row struct {
+	Line         int    `json:"line"` // 1-based row number in the export, after any header
+	TenantID     string `json:"tenant_id"`
+	Instance     string `json:"instance,omitempty"`
+	Plan         string `json:"plan,omitempty"`
+	CostCenter   string `json:"cost_center,omitempty"`
+	ContactEmail string `json:"contact_email,omitempty"`
+	Environment  string `json:"environment,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	Profile      string `json:"profile,omitempty"`
+	GatewayToken string `json:"gateway_token,omitempty"`
+
+	// Err is why the row could not be read; the other fields may be
+	// partly set.
+	Err error `json:"-"`
+}
+
+// columns maps each accepted CSV column, and JSON field, to its Row field.
+var columns = map[string]func(*Row) *string{
+	"tenant_id":     func(r *Row) *string { return &r.TenantID },
+	"instance":      func(r *Row) *string { return &r.Instance },
+	"plan":          func(r *Row) *string { return &r.Plan },
+	"cost_center":   func(r *Row) *string { return &r.CostCenter },
+	"contact_email": func(r *Row) *string { return &r.ContactEmail },
+	"environment":   func(r *Row) *string { return &r.Environment },
+	"channel":       func(r *Row) *string { return &r.Channel },
+	"profile":       func(r *Row) *string { return &r.Profile },
+	"gateway_token": func(r *Row) *string { return &r.GatewayToken },
+}
+
+// Parse reads an export in the given format. A CSV export starts with a
+// header naming its columns, in any order; a JSON export is an array of
+// objects. Unknown columns and fields are errors, so that a misspelt column
+// is not silently dropped. The error is only for an export that cannot be
+// read at all; problems with single rows are reported in their Err.
+func Parse(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		return parseJSON(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q: must be %q or %q", format, FormatCSV, FormatJSON)
+	}
+}
+
+func parseCSV(r io.Reader) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("empty CSV export: a header row is required")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %v", err)
+	}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if columns[name] == nil {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		header[i] = name
+	}
+
+	var rows []Row
+	for line := 1; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		row := Row{Line: line}
+		if err != nil {
+			if _, ok := err.(*csv.ParseError); !ok {
+				return nil, fmt.Errorf("reading CSV: %v", err)
+			}
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		if len(record) != len(header) {
+			row.Err = fmt.Errorf("has %d fields; the header has %d", len(record), len(header))
+		}
+		for i, value := range record {
+			if i < len(header) {
+				*columns[header[i]](&row) = strings.TrimSpace(value)
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func parseJSON(r io.Reader) ([]Row, error) {
+	var raw []map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("reading JSON export: must be an array of objects: %v", err)
+	}
+	rows := make([]Row, len(raw))
+	for i, fields := range raw {
+		rows[i].Line = i + 1
+		for name, value := range fields {
+			field := columns[name]
+			if field == nil {
+				rows[i].Err = fmt.Errorf("unknown field %q", name)
+				break
+			}
+			s, ok := value.(string)
+			if !ok && value != nil {
+				rows[i].Err = fmt.Errorf("field %q must be a string", name)
+				break
+			}
+			*field(&rows[i]) = strings.TrimSpace(s)
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,131 @@
+// Package locale renders customer-facing text, such as lifecycle emails and
+// webhook event descriptions, in a tenant's language. A Catalog holds one
+// directory of templates per locale, named by its BCP 47 tag ("en", "de",
+// "pt-BR"): those built into the binary, and any from a translations
+// directory, which add locales or replace built-in templates file by file.
+// Text a locale does not translate falls back to a more general locale, and
+// then to the catalog's default.
+package locale
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Parse returns the canonical form of a BCP 47 language tag, such as "pt-BR"
+// for "pt_br".
+func Parse(tag string) (string, error) {
+	t, err := language.Parse(strings.ReplaceAll(tag, "_", "-"))
+	if err != nil {
+		return "", fmt.Errorf("invalid locale %q", tag)
+	}
+	return t.String(), nil
+}
+
+// Catalog holds templates by locale and file name.
+type Catalog struct {
+	def       string
+	templates map[string]map[string]*template.Template // By locale, then file name without .tmpl
+}
+
+// Load reads the templates of builtin and then of dir, which may be empty:
+// every <locale>/<name>.tmpl file, where a file in dir replaces the one of
+// the same locale and name in builtin. def is the locale of text a tenant's
+// locale does not translate; it must have templates.
+func Load(builtin fs.FS, dir, def string) (*Catalog, error) {
+	c := &Catalog{templates: make(map[string]map[string]*template.Template)}
+	if err := c.load(builtin); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := c.load(os.DirFS(dir)); err != nil {
+			return nil, fmt.Errorf("%s: %v", dir, err)
+		}
+	}
+	def, err := Parse(def)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := c.templates[def]; !ok {
+		return nil, fmt.Errorf("default locale %s has no templates", def)
+	}
+	c.def = def
+	return c, nil
+}
+
+// load adds the templates of fsys.
+func (c *Catalog) load(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		dir, base := path.Split(file)
+		tag, err := Parse(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		t, err := template.ParseFS(fsys, file)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %v", file, err)
+		}
+		if c.templates[tag] == nil {
+			c.templates[tag] = make(map[string]*template.Template)
+		}
+		c.templates[tag][strings.TrimSuffix(base, ".tmpl")] = t
+	}
+	return nil
+}
+
+// Default returns the default locale.
+func (c *Catalog) Default() string { return c.def }
+
+// Locales returns the locales with templates, sorted.
+func (c *Catalog) Locales() []string {
+	out := make([]string, 0, len(c.templates))
+	for tag := range c.templates {
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Has reports whether the default locale has the named template, which every
+// locale can then render.
+func (c *Catalog) Has(name string) bool {
+	_, ok := c.templates[c.def][name]
+	return ok
+}
+
+// Execute renders block of the named template in the most specific of tag,
+// its parents ("pt" for "pt-BR") and the default locale that defines it. An
+// empty or unknown tag renders the default locale.
+func (c *Catalog) Execute(w io.Writer, tag, name, block string, data any) error {
+	for _, loc := range c.fallbacks(tag) {
+		t := c.templates[loc][name]
+		if t == nil || t.Lookup(block) == nil {
+			continue
+		}
+		return t.ExecuteTemplate(w, block, data)
+	}
+	return fmt.Errorf("no %s block in template %s", block, name)
+}
+
+// fallbacks returns the locales to try for tag, most specific first.
+func (c *Catalog) fallbacks(tag string) []string {
+	var out []string
+	if t, err := language.Parse(tag); err == nil {
+		for ; !t.IsRoot(); t = t.Parent() {
+			out = append(out, t.String())
+		}
+	}
+	return append(out, c.def)
+}
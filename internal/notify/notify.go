@@ -0,0 +1,208 @@
+// Package notify emails tenants about lifecycle changes to their instance,
+// in the locale of their contact.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/locale"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// Event is a lifecycle change a tenant can be notified about.
+type Event string
+
+const (
+	EventReady         Event = "ready"
+	EventTrialExpiring Event = "trial_expiring"
+	EventSuspended     Event = "suspended"
+	EventDeleted       Event = "deleted"
+)
+
+// Events lists every event.
+var Events = []Event{EventReady, EventTrialExpiring, EventSuspended, EventDeleted}
+
+// ContactSource returns the tenant's contact, if it has one. See
+// UseContacts.
+type ContactSource func(tenantID string) (registry.Contact, bool, error)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Templates returns the built-in email templates, one directory per locale
+// of one file per event, for locale.Load.
+func Templates() fs.FS {
+	sub, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// Data is passed to the templates.
+type Data struct {
+	TenantID     string
+	InstanceName string
+	Endpoint     string
+	When         time.Time // Trial expiry
+	Reason       string    // Suspension reason
+}
+
+// Message is a rendered email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a rendered message.
+type Sender interface {
+	Send(ctx context.Context, from string, msg Message) error
+}
+
+// Notifier renders and sends lifecycle emails. A nil *Notifier is valid and
+// sends nothing.
+type Notifier struct {
+	sender    Sender
+	from      string
+	enabled   map[Event]bool
+	templates *locale.Catalog
+
+	contactsMu sync.Mutex
+	contacts   ContactSource
+
+	// lastStatus tracks instance status from the watch so that "ready" is
+	// sent on the transition to running rather than on every resync.
+	mu         sync.Mutex
+	lastStatus map[string]string
+}
+
+// New creates a Notifier sending from the given address and rendering from
+// templates, which are usually loaded from Templates. Events missing from
+// enabled, or mapped to false, are not sent.
+func New(sender Sender, from string, enabled map[Event]bool, templates *locale.Catalog) (*Notifier, error) {
+	for _, ev := range Events {
+		if !templates.Has(string(ev)) {
+			return nil, fmt.Errorf("no %s template for locale %s", ev, templates.Default())
+		}
+	}
+	return &Notifier{
+		sender:     sender,
+		from:       from,
+		enabled:    enabled,
+		templates:  templates,
+		lastStatus: make(map[string]string),
+	}, nil
+}
+
+// UseContacts makes the tenant's contact, when it has one, decide who is
+// emailed, about which events and in which locale, in place of the address
+// given to Notify. A contact without emails only sets the events and locale.
+func (n *Notifier) UseContacts(src ContactSource) {
+	if n == nil {
+		return
+	}
+	n.contactsMu.Lock()
+	n.contacts = src
+	n.contactsMu.Unlock()
+}
+
+// Notify emails the tenant's contacts, or to, about ev in the background. It
+// returns immediately; send failures are logged.
+func (n *Notifier) Notify(ev Event, to string, data Data) {
+	if n == nil || !n.enabled[ev] {
+		return
+	}
+	n.contactsMu.Lock()
+	contacts := n.contacts
+	n.contactsMu.Unlock()
+	go func() {
+		recipients, tag := []string{to}, ""
+		if contacts != nil {
+			c, ok, err := contacts(data.TenantID)
+			if err != nil {
+				log.Printf("notify: %v", err)
+			} else if ok {
+				if !c.Wants(string(ev)) {
+					return
+				}
+				if len(c.Emails) > 0 {
+					recipients = c.Emails
+				}
+				tag = c.Locale
+			}
+		}
+		for _, addr := range recipients {
+			if addr != "" {
+				n.send(ev, addr, tag, data)
+			}
+		}
+	}()
+}
+
+// send renders the email about ev in the locale tag and sends it to one
+// address.
+func (n *Notifier) send(ev Event, to, tag string, data Data) {
+	msg, err := n.render(ev, to, tag, data)
+	if err != nil {
+		log.Printf("notify: rendering %s for tenant %s: %v", ev, data.TenantID, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := n.sender.Send(ctx, n.from, msg); err != nil {
+		log.Printf("notify: sending %s to tenant %s: %v", ev, data.TenantID, err)
+		return
+	}
+	log.Printf("notify: sent %s to tenant %s", ev, data.TenantID)
+}
+
+// render executes the event's subject and body templates in the locale tag.
+func (n *Notifier) render(ev Event, to, tag string, data Data) (Message, error) {
+	var subject, body bytes.Buffer
+	if err := n.templates.Execute(&subject, tag, string(ev), "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := n.templates.Execute(&body, tag, string(ev), "body", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
+
+// HandleInstanceEvent sends "ready" when an instance first reaches running,
+// "suspended" when it is suspended and "deleted" when it disappears; pass it
+// to OnInstanceEvent. Instances already running when the watch starts, or
+// resumed after a suspension, are not announced as ready.
+func (n *Notifier) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if n == nil || ev.Info == nil {
+		return
+	}
+	data := Data{TenantID: ev.TenantID, InstanceName: ev.Info.Name, Endpoint: ev.Info.Endpoint}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch ev.Type {
+	case k8s.InstanceAdded:
+		n.lastStatus[ev.Info.Name] = ev.Info.Status
+	case k8s.InstanceUpdated:
+		prev := n.lastStatus[ev.Info.Name]
+		n.lastStatus[ev.Info.Name] = ev.Info.Status
+		switch {
+		case ev.Info.Status == "running" && prev != "running" && prev != "suspended":
+			n.Notify(EventReady, ev.Info.ContactEmail, data)
+		case ev.Info.Status == "suspended" && prev != "suspended":
+			n.Notify(EventSuspended, ev.Info.ContactEmail, data)
+		}
+	case k8s.InstanceDeleted:
+		delete(n.lastStatus, ev.Info.Name)
+		n.Notify(EventDeleted, ev.Info.ContactEmail, data)
+	}
+}
@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPSender delivers mail through an SMTP relay, upgrading to TLS with
+// STARTTLS when the server offers it.
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string // No authentication when empty
+	Password string
+}
+
+// Send implements Sender. net/smtp has no context support, so ctx only bounds
+// the connection attempt.
+func (s *SMTPSender) Send(ctx context.Context, from string, msg Message) error {
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address %q: %v", s.Addr, err)
+	}
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %v", from, err)
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", sender)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, sender.Address, []string{msg.To}, []byte(b.String())) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendGridSender delivers mail through the SendGrid v3 API.
+type SendGridSender struct {
+	APIKey string
+	Client *http.Client
+}
+
+// sendGridURL is the SendGrid mail send endpoint.
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// Send implements Sender.
+func (s *SendGridSender) Send(ctx context.Context, from string, msg Message) error {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %v", from, err)
+	}
+	payload := map[string]interface{}{
+		"personalizations": []interface{}{
+			map[string]interface{}{"to": []interface{}{map[string]string{"email": msg.To}}},
+		},
+		"from":    map[string]string{"email": sender.Address, "name": sender.Name},
+		"subject": msg.Subject,
+		"content": []interface{}{map[string]string{"type": "text/plain", "value": msg.Body}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("sendgrid: status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
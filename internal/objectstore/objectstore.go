@@ -0,0 +1,250 @@
+// Package objectstore is a minimal client for S3-compatible object storage
+// (AWS S3, DigitalOcean Spaces, MinIO). It only implements what the service
+// needs: AWS Signature V4 presigned URLs and simple uploads, listings and
+// deletes built on them.
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config holds the connection settings for a bucket.
+type Config struct {
+	Endpoint  string // Base URL, e.g. "https://nyc3.digitaloceanspaces.com"
+	Region    string // Signing region, e.g. "us-east-1" or "nyc3"
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// Client signs and performs requests against a single bucket using
+// path-style addressing.
+type Client struct {
+	cfg        Config
+	endpoint   *url.URL
+	httpClient *http.Client
+}
+
+// New validates cfg and returns a Client for it.
+func New(cfg Config) (*Client, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("object storage endpoint, bucket and credentials are required")
+	}
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid object storage endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &Client{
+		cfg:        cfg,
+		endpoint:   u,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// PresignURL returns a URL that allows the holder to perform method on key
+// until expires has elapsed, without any further credentials.
+func (c *Client) PresignURL(method, key string, expires time.Duration) string {
+	return c.presign(method, key, nil, expires, time.Now())
+}
+
+// presign is PresignURL with additional query parameters, which are signed
+// along with the rest of the request. now is the signing time.
+func (c *Client) presign(method, key string, params map[string]string, expires time.Duration, now time.Time) string {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, c.cfg.Region)
+
+	path := "/" + c.cfg.Bucket + "/" + strings.TrimPrefix(key, "/")
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    c.cfg.AccessKey + "/" + scope,
+		"X-Amz-Date":          amzDate,
+		"X-Amz-Expires":       fmt.Sprintf("%d", int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+	for k, v := range params {
+		query[k] = v
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		encodePath(path),
+		canonicalQuery,
+		"host:" + c.endpoint.Host + "\n",
+		"host",
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+c.cfg.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, c.cfg.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	return fmt.Sprintf("%s://%s%s?%s&X-Amz-Signature=%s",
+		c.endpoint.Scheme, c.endpoint.Host, encodePath(path), canonicalQuery, signature)
+}
+
+// Put uploads body to key with the given content type.
+func (c *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut,
+		c.PresignURL(http.MethodPut, key, 15*time.Minute), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("building upload request: %v", err)
+	}
+	req.ContentLength = int64(len(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("uploading %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response the client reads.
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the keys of the objects under prefix.
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	params := map[string]string{"list-type": "2", "prefix": prefix}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			c.presign(http.MethodGet, "", params, 15*time.Minute, time.Now()), nil)
+		if err != nil {
+			return nil, fmt.Errorf("building list request: %v", err)
+		}
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %v", prefix, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %v", prefix, err)
+		}
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("listing %s: status %d: %s", prefix, resp.StatusCode, strings.TrimSpace(string(body[:min(len(body), 1024)])))
+		}
+		var result listResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, fmt.Errorf("listing %s: %v", prefix, err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		params["continuation-token"] = result.NextContinuationToken
+	}
+}
+
+// Delete removes key. Deleting a key that does not exist succeeds.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete,
+		c.PresignURL(http.MethodDelete, key, 15*time.Minute), nil)
+	if err != nil {
+		return fmt.Errorf("building delete request: %v", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("deleting %s: status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ---------- signing helpers ----------
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQueryString sorts and strictly URI-encodes query parameters as
+// required by Signature V4.
+func canonicalQueryString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, uriEncode(k, true)+"="+uriEncode(params[k], true))
+	}
+	return strings.Join(parts, "&")
+}
+
+// encodePath URI-encodes every segment of an object path, leaving the
+// separators intact.
+func encodePath(p string) string {
+	return uriEncode(p, false)
+}
+
+// uriEncode implements the RFC 3986 encoding used by Signature V4: only
+// unreserved characters are left as-is, and '/' is kept unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch >= 'A' && ch <= 'Z', ch >= 'a' && ch <= 'z', ch >= '0' && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
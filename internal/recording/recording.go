@@ -0,0 +1,234 @@
+// Package recording keeps sanitized copies of the API requests and responses
+// of callers whose API key has recording turned on, to debug integrations
+// that behave differently from a hand-written curl. Recording is opt-in per
+// key, expires on its own, and is held in memory only: each key gets a ring
+// buffer of its most recent exchanges.
+//
+// Keys are never stored. A key is known by its ID, a truncated SHA-256 of
+// the bearer token, which KeyID computes. Credentials in headers and in JSON
+// bodies are redacted before an exchange is kept.
+package recording
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Redacted replaces sanitized values.
+const Redacted = "[redacted]"
+
+// Exchange is one recorded request and its response.
+type Exchange struct {
+	Time            time.Time           `json:"time"`
+	Duration        string              `json:"duration"`
+	CorrelationID   string              `json:"correlation_id,omitempty"`
+	Method          string              `json:"method"`
+	URL             string              `json:"url"`
+	RemoteAddr      string              `json:"remote_addr,omitempty"`
+	RequestHeaders  map[string][]string `json:"request_headers"`
+	RequestBody     string              `json:"request_body,omitempty"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    string              `json:"response_body,omitempty"`
+	// Truncated is set when a body was longer than the recorder keeps.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Session is the recording state of one key.
+type Session struct {
+	KeyID     string    `json:"key_id"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Recorded  int       `json:"recorded"` // Exchanges recorded so far, including those dropped from the buffer
+
+	exchanges []Exchange // Ring buffer, oldest first once full
+	next      int
+}
+
+// Recorder holds the sessions. The zero value is not usable; create one with
+// New.
+type Recorder struct {
+	size    int
+	maxBody int
+
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+// New creates a Recorder keeping the last size exchanges of each key, with
+// bodies cut at maxBody bytes.
+func New(size, maxBody int) *Recorder {
+	return &Recorder{size: size, maxBody: maxBody, sessions: map[string]*Session{}}
+}
+
+// KeyID returns the ID of an API key.
+func KeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key_" + hex.EncodeToString(sum[:8])
+}
+
+// keyIDRe matches a key ID.
+var keyIDRe = regexp.MustCompile(`^key_[0-9a-f]{16}$`)
+
+// ValidKeyID reports whether id has the form of a key ID.
+func ValidKeyID(id string) bool {
+	return keyIDRe.MatchString(id)
+}
+
+// Start turns recording on for the key until d from now, keeping any
+// exchanges already recorded, and returns the session.
+func (rec *Recorder) Start(keyID string, d time.Duration) Session {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	now := time.Now().UTC()
+	s := rec.sessions[keyID]
+	if s == nil {
+		s = &Session{KeyID: keyID, StartedAt: now}
+		rec.sessions[keyID] = s
+	}
+	s.ExpiresAt = now.Add(d)
+	return s.summary()
+}
+
+// Stop turns recording off for the key and discards its exchanges. It
+// reports whether the key was being recorded.
+func (rec *Recorder) Stop(keyID string) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	_, ok := rec.sessions[keyID]
+	delete(rec.sessions, keyID)
+	return ok
+}
+
+// Sessions returns the sessions, including expired ones whose exchanges are
+// still held, by key ID.
+func (rec *Recorder) Sessions() []Session {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	out := make([]Session, 0, len(rec.sessions))
+	for _, s := range rec.sessions {
+		out = append(out, s.summary())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].KeyID < out[j].KeyID })
+	return out
+}
+
+// Exchanges returns the session of the key and its exchanges, newest first,
+// or false if the key has none.
+func (rec *Recorder) Exchanges(keyID string) (Session, []Exchange, bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	s := rec.sessions[keyID]
+	if s == nil {
+		return Session{}, nil, false
+	}
+	out := make([]Exchange, 0, len(s.exchanges))
+	for i := range s.exchanges {
+		// Walk back from the most recent slot.
+		out = append(out, s.exchanges[(s.next-1-i+2*len(s.exchanges))%len(s.exchanges)])
+	}
+	return s.summary(), out, true
+}
+
+// Active reports whether requests with the key are being recorded.
+func (rec *Recorder) Active(keyID string) bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	s := rec.sessions[keyID]
+	return s != nil && time.Now().Before(s.ExpiresAt)
+}
+
+// MaxBody returns how many bytes of each body are kept.
+func (rec *Recorder) MaxBody() int { return rec.maxBody }
+
+// Add records an exchange of the key, if it is still being recorded. The
+// headers and bodies are sanitized here.
+func (rec *Recorder) Add(keyID string, e Exchange) {
+	e.RequestHeaders = sanitizeHeaders(e.RequestHeaders)
+	e.ResponseHeaders = sanitizeHeaders(e.ResponseHeaders)
+	e.RequestBody = sanitizeBody(e.RequestBody)
+	e.ResponseBody = sanitizeBody(e.ResponseBody)
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	s := rec.sessions[keyID]
+	if s == nil || !time.Now().Before(s.ExpiresAt) {
+		return
+	}
+	s.Recorded++
+	if len(s.exchanges) < rec.size {
+		s.exchanges = append(s.exchanges, e)
+		s.next = len(s.exchanges) % rec.size
+		return
+	}
+	s.exchanges[s.next] = e
+	s.next = (s.next + 1) % rec.size
+}
+
+// summary returns a copy of the session without its exchanges.
+func (s *Session) summary() Session {
+	return Session{KeyID: s.KeyID, StartedAt: s.StartedAt, ExpiresAt: s.ExpiresAt, Recorded: s.Recorded}
+}
+
+// sensitiveName matches header and JSON field names whose values are
+// credentials.
+var sensitiveName = regexp.MustCompile(`(?i)(authorization|cookie|token|secret|password|passwd|api[-_]?key|private[-_]?key|signature|credential)`)
+
+// sanitizeHeaders returns a copy of h with credential headers redacted.
+func sanitizeHeaders(h map[string][]string) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for name, values := range h {
+		if sensitiveName.MatchString(name) {
+			out[name] = []string{Redacted}
+			continue
+		}
+		out[name] = append([]string(nil), values...)
+	}
+	return out
+}
+
+// sensitiveField matches a JSON string field with a sensitive name, for
+// bodies that cannot be decoded, such as truncated ones.
+var sensitiveField = regexp.MustCompile(`(?i)("[^"]*(?:authorization|cookie|token|secret|password|passwd|api[-_]?key|private[-_]?key|signature|credential)[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// sanitizeBody redacts credential fields of a JSON body. Bodies that are not
+// valid JSON, such as truncated ones, have sensitive string fields redacted
+// by pattern.
+func sanitizeBody(body string) string {
+	var v interface{}
+	if body == "" {
+		return body
+	}
+	if json.Unmarshal([]byte(body), &v) != nil {
+		return sensitiveField.ReplaceAllString(body, `${1}"`+Redacted+`"`)
+	}
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return body
+	}
+	return string(out)
+}
+
+// redact replaces the values of sensitive fields throughout v.
+func redact(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			if sensitiveName.MatchString(k) {
+				t[k] = Redacted
+				continue
+			}
+			t[k] = redact(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = redact(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,143 @@
+// Package recovery finishes the provisioning operations a replica left
+// half-done when it stopped, from their entries in the registry's operation
+// journal: creates whose instance exists are resumed and announced, and the
+// others are rolled back.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+	"github.com/mchatman/tenant-provisioner/internal/webhooks"
+)
+
+// Recoverer resolves abandoned journal entries.
+type Recoverer struct {
+	mgr      k8s.InstanceManager
+	reg      *registry.Registry
+	webhooks *webhooks.Dispatcher
+}
+
+// New returns a Recoverer for the operations journaled in reg, announcing
+// resumed creates through d.
+func New(mgr k8s.InstanceManager, reg *registry.Registry, d *webhooks.Dispatcher) *Recoverer {
+	return &Recoverer{mgr: mgr, reg: reg, webhooks: d}
+}
+
+// Report counts the outcomes of one pass of Recover.
+type Report struct {
+	Resumed    int
+	RolledBack int
+	Failed     int // Left in the journal for the next pass
+}
+
+// Recover resolves every journal entry not updated for staleAfter, which no
+// live replica is expected to be working on any more.
+func (r *Recoverer) Recover(ctx context.Context, staleAfter time.Duration) (Report, error) {
+	var report Report
+	entries, err := r.reg.Journal()
+	if err != nil {
+		return report, err
+	}
+	cutoff := time.Now().Add(-staleAfter)
+	for _, e := range entries {
+		if e.UpdatedAt.After(cutoff) {
+			continue
+		}
+		resumed, err := r.recover(ctx, e)
+		switch {
+		case err != nil:
+			log.Printf("recovery: %s operation %s of tenant %s: %v", e.Action, e.ID, e.TenantID, err)
+			report.Failed++
+			continue
+		case resumed:
+			report.Resumed++
+		default:
+			report.RolledBack++
+		}
+		if err := r.reg.EndJournal(e.ID); err != nil {
+			log.Printf("recovery: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// recover resumes or rolls back the operation of e, and reports which.
+func (r *Recoverer) recover(ctx context.Context, e registry.JournalEntry) (resumed bool, err error) {
+	if e.Action != "create" {
+		return false, fmt.Errorf("cannot recover %s operations", e.Action)
+	}
+	if e.InstanceName == "" {
+		// Stopped before a name was chosen; nothing was created.
+		r.finishOperation(e.ID, errors.New("interrupted by a restart"))
+		return false, nil
+	}
+	info, err := r.mgr.ResumeCreate(ctx, e.TenantID, e.InstanceName)
+	if err == nil {
+		r.webhooks.AnnounceCreated(e.TenantID, info)
+		r.finishOperation(e.ID, nil)
+		log.Printf("recovery: resumed create of instance %s for tenant %s", e.InstanceName, e.TenantID)
+		return true, nil
+	}
+	if !errors.Is(err, k8s.ErrNotFound) {
+		return false, err
+	}
+	if e.Done(k8s.StepInstanceCreated) {
+		// Created, then deleted before the create could be resumed.
+		r.finishOperation(e.ID, errors.New("instance was deleted"))
+		return false, nil
+	}
+	if err := r.mgr.RollbackCreate(ctx, e.TenantID, e.InstanceName); err != nil {
+		return false, err
+	}
+	r.finishOperation(e.ID, errors.New("interrupted by a restart"))
+	log.Printf("recovery: rolled back create of instance %s for tenant %s", e.InstanceName, e.TenantID)
+	return false, nil
+}
+
+// finishOperation records the outcome of the queued operation with the given
+// ID, if it is one and its outcome was never recorded.
+func (r *Recoverer) finishOperation(id string, err error) {
+	op, ok, rerr := r.reg.Operation(id)
+	if rerr != nil {
+		log.Printf("recovery: %v", rerr)
+		return
+	}
+	if !ok || op.FinishedAt != nil {
+		return
+	}
+	now := time.Now().UTC()
+	op.Status, op.QueuePosition, op.EstimatedWaitSeconds, op.FinishedAt = "succeeded", 0, 0, &now
+	if err != nil {
+		op.Status, op.Error = "failed", err.Error()
+	}
+	if err := r.reg.PutOperation(op); err != nil {
+		log.Printf("recovery: %v", err)
+	}
+}
+
+// Run recovers abandoned operations every interval, starting at once, until
+// ctx is cancelled.
+func (r *Recoverer) Run(ctx context.Context, interval, staleAfter time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := r.Recover(ctx, staleAfter)
+		if err != nil {
+			log.Printf("recovery: %v", err)
+		} else if report.Resumed+report.RolledBack+report.Failed > 0 {
+			log.Printf("recovery: resumed %d and rolled back %d operation(s), %d failed",
+				report.Resumed, report.RolledBack, report.Failed)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// BillingCase is an unresolved billing problem of a tenant, opened by a
+// billing event such as a failed payment, with the lifecycle actions taken
+// on the tenant since. A tenant has at most one case per opening event.
+// Like operations, cases are not cached in memory, so that every replica
+// acts on the same ones.
+type BillingCase struct {
+	TenantID string          `json:"tenant_id"`
+	Event    string          `json:"event"`              // The billing event that opened the case
+	EventID  string          `json:"event_id,omitempty"` // Its ID in the billing system
+	OpenedAt time.Time       `json:"opened_at"`          // When the event occurred; grace periods run from it
+	Actions  []BillingAction `json:"actions,omitempty"`  // In the order they were taken
+}
+
+// BillingAction is a lifecycle action taken on a billing case.
+type BillingAction struct {
+	Action string    `json:"action"`
+	At     time.Time `json:"at"`
+}
+
+// Taken reports whether action was taken on the case.
+func (c BillingCase) Taken(action string) bool {
+	for _, a := range c.Actions {
+		if a.Action == action {
+			return true
+		}
+	}
+	return false
+}
+
+// AddBillingCase opens the tenant's case for c.Event, unless one is open,
+// and reports whether it did.
+func (r *Registry) AddBillingCase(c BillingCase) (bool, error) {
+	added, err := r.store.AddBillingCase(c)
+	if err != nil {
+		return false, fmt.Errorf("saving %s billing case of tenant %s: %v", c.Event, c.TenantID, err)
+	}
+	return added, nil
+}
+
+// UpdateBillingCase replaces the tenant's case for c.Event with c, but only
+// while the stored case is still prev, and reports whether it did. A false
+// result means the case was changed or closed since prev was read, for
+// example by another replica acting on it.
+func (r *Registry) UpdateBillingCase(prev, c BillingCase) (bool, error) {
+	updated, err := r.store.UpdateBillingCase(prev, c)
+	if err != nil {
+		return false, fmt.Errorf("saving %s billing case of tenant %s: %v", c.Event, c.TenantID, err)
+	}
+	return updated, nil
+}
+
+// same reports whether c and o encode alike, as the stores compare cases.
+func (c BillingCase) same(o BillingCase) bool {
+	a, err := json.Marshal(c)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(o)
+	return err == nil && bytes.Equal(a, b)
+}
+
+// DeleteBillingCase closes the tenant's case for event, if open.
+func (r *Registry) DeleteBillingCase(tenantID, event string) error {
+	if err := r.store.DeleteBillingCase(tenantID, event); err != nil {
+		return fmt.Errorf("deleting %s billing case of tenant %s: %v", event, tenantID, err)
+	}
+	return nil
+}
+
+// BillingCases returns every open billing case, oldest first.
+func (r *Registry) BillingCases() ([]BillingCase, error) {
+	cases, err := r.store.BillingCases()
+	if err != nil {
+		return nil, fmt.Errorf("reading billing cases: %v", err)
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].OpenedAt.Before(cases[j].OpenedAt) })
+	return cases, nil
+}
+
+// TenantBillingCases returns the tenant's open billing cases, oldest first.
+func (r *Registry) TenantBillingCases(tenantID string) ([]BillingCase, error) {
+	cases, err := r.BillingCases()
+	if err != nil {
+		return nil, err
+	}
+	out := cases[:0]
+	for _, c := range cases {
+		if c.TenantID == tenantID {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
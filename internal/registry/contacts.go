@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+)
+
+// Contact is whom to notify about a tenant's lifecycle events, which of
+// them to email and in which language. It takes the place of the
+// contact_email a create request stores on each instance.
+type Contact struct {
+	TenantID string   `json:"tenant_id"`
+	Emails   []string `json:"emails"`
+	// EmailEvents lists the lifecycle emails the tenant receives, such as
+	// "ready" or "suspended"; nil receives every one the deployment sends,
+	// and an empty list none.
+	EmailEvents []string `json:"email_events"`
+	// Locale is the BCP 47 tag of the language the tenant's emails and
+	// webhook event descriptions are written in; empty for the default.
+	Locale    string    `json:"locale,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Wants reports whether the tenant receives the email for event.
+func (c Contact) Wants(event string) bool {
+	if c.EmailEvents == nil {
+		return true
+	}
+	for _, e := range c.EmailEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// PutContact creates or replaces the tenant's contact.
+func (r *Registry) PutContact(c Contact) error {
+	if err := r.store.PutContact(c); err != nil {
+		return fmt.Errorf("saving contact of tenant %s: %v", c.TenantID, err)
+	}
+	return nil
+}
+
+// Contact returns the tenant's contact, if it has one.
+func (r *Registry) Contact(tenantID string) (Contact, bool, error) {
+	c, ok, err := r.store.Contact(tenantID)
+	if err != nil {
+		return Contact{}, false, fmt.Errorf("reading contact of tenant %s: %v", tenantID, err)
+	}
+	return c, ok, nil
+}
+
+// DeleteContact drops the tenant's contact, if present.
+func (r *Registry) DeleteContact(tenantID string) error {
+	if err := r.store.DeleteContact(tenantID); err != nil {
+		return fmt.Errorf("deleting contact of tenant %s: %v", tenantID, err)
+	}
+	return nil
+}
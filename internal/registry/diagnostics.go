@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// SetDiagnostics keeps the diagnostics captured when an instance's
+// provisioning was failed on the instance's row, where they outlive the
+// instance.
+func (r *Registry) SetDiagnostics(d *k8s.Diagnostics) {
+	now := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.forgotten[d.Instance] {
+		return
+	}
+	rec, ok := r.records[d.Instance]
+	if !ok {
+		rec = &Record{TenantID: d.TenantID, InstanceName: d.Instance, Status: "error", CreatedAt: now}
+		r.records[d.Instance] = rec
+	}
+	rec.Diagnostics = d
+	rec.UpdatedAt = now
+	r.save(rec)
+}
+
+// Diagnostics returns the diagnostics kept for the tenant's instances,
+// including deleted ones, newest first.
+func (r *Registry) Diagnostics(tenantID string) []k8s.Diagnostics {
+	r.mu.Lock()
+	var out []k8s.Diagnostics
+	for _, rec := range r.records {
+		if rec.TenantID == tenantID && rec.Diagnostics != nil {
+			out = append(out, *rec.Diagnostics)
+		}
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CapturedAt.After(out[j].CapturedAt) })
+	return out
+}
@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Event is one entry of the lifecycle event log, as delivered to webhooks
+// and replayed by GET /admin/events.
+type Event struct {
+	Seq      int64     `json:"seq,omitempty"` // Position in the log, assigned by AppendEvent; 0 for test deliveries
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	At       time.Time `json:"at"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	Instance string    `json:"instance,omitempty"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Message  string    `json:"message,omitempty"`
+	// CorrelationID is that of the API request behind the event, if any.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// ContactEmails are the tenant's contact emails and Description the
+	// event's description in its locale, added to deliveries rather than
+	// logged.
+	ContactEmails []string `json:"contact_emails,omitempty"`
+	Description   string   `json:"description,omitempty"`
+}
+
+// AppendEvent adds ev to the end of the event log and returns it with its
+// sequence number. Sequence numbers only grow, so that a consumer can resume
+// after the last one it has seen.
+func (r *Registry) AppendEvent(ev Event) (Event, error) {
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	seq, err := r.store.AppendEvent(ev)
+	if err != nil {
+		return ev, fmt.Errorf("logging event %s: %v", ev.ID, err)
+	}
+	ev.Seq = seq
+	return ev, nil
+}
+
+// Events returns up to limit events logged after sequence number since,
+// oldest first, and the first sequence number still retained, 0 when the log
+// is empty.
+func (r *Registry) Events(since int64, limit int) ([]Event, int64, error) {
+	events, err := r.store.Events(since, limit)
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading events: %v", err)
+	}
+	first, err := r.store.FirstEventSeq()
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading events: %v", err)
+	}
+	return events, first, nil
+}
+
+// RunEventPruning drops events older than retention every hour until ctx is
+// cancelled.
+func (r *Registry) RunEventPruning(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		r.eventsMu.Lock()
+		n, err := r.store.PruneEvents(time.Now().Add(-retention))
+		r.eventsMu.Unlock()
+		if err != nil {
+			log.Printf("registry: pruning events: %v", err)
+		} else if n > 0 {
+			log.Printf("registry: pruned %d event(s) older than %s", n, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
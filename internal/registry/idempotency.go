@@ -0,0 +1,96 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// IdempotentResponse is the response to the first request made with an
+// Idempotency-Key, replayed to retries of that request. It is keyed by the
+// key, the request's method and path, and the tenant making it, so that
+// keys chosen by different tenants never collide. A response with a zero
+// Status is still being produced.
+type IdempotentResponse struct {
+	ID          string      `json:"id"`
+	RequestHash string      `json:"request_hash"` // SHA-256 of the request body
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	Sealed      bool        `json:"sealed,omitempty"` // Body is encrypted
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Complete reports whether the response has been stored, as opposed to
+// being produced by a request still in flight.
+func (r IdempotentResponse) Complete() bool { return r.Status != 0 }
+
+// IdempotencyID derives the ID of an idempotent response from its key, the
+// request's method and path, the tenant and the authenticated principal.
+func IdempotencyID(key, method, path, tenantID, principal string) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + method + "\x00" + path + "\x00" + tenantID + "\x00" + principal))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimIdempotencyKey records that the request identified by claim.ID is
+// being served. When another request holds the ID already, it returns that
+// request's response, complete or not, and claimed=false. Claims older than
+// ttl are replaced.
+func (r *Registry) ClaimIdempotencyKey(claim IdempotentResponse, ttl time.Duration) (IdempotentResponse, bool, error) {
+	claim.CreatedAt = time.Now().UTC()
+	for range 2 {
+		existing, claimed, err := r.store.ClaimIdempotencyKey(claim)
+		if err != nil {
+			return IdempotentResponse{}, false, fmt.Errorf("claiming idempotency key: %v", err)
+		}
+		if claimed || existing.CreatedAt.After(claim.CreatedAt.Add(-ttl)) {
+			return existing, claimed, nil
+		}
+		// Expired but not yet pruned.
+		if err := r.store.DeleteIdempotencyKey(claim.ID); err != nil {
+			return IdempotentResponse{}, false, fmt.Errorf("releasing idempotency key: %v", err)
+		}
+	}
+	return IdempotentResponse{}, false, fmt.Errorf("claiming idempotency key: claimed concurrently")
+}
+
+// PutIdempotentResponse stores the response of a claimed request.
+func (r *Registry) PutIdempotentResponse(resp IdempotentResponse) error {
+	if err := r.store.PutIdempotentResponse(resp); err != nil {
+		return fmt.Errorf("storing idempotent response: %v", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops a claim without a response, so that a retry
+// of the request runs again.
+func (r *Registry) ReleaseIdempotencyKey(id string) error {
+	if err := r.store.DeleteIdempotencyKey(id); err != nil {
+		return fmt.Errorf("releasing idempotency key: %v", err)
+	}
+	return nil
+}
+
+// RunIdempotencyPruning drops idempotent responses older than ttl every hour
+// until ctx is cancelled.
+func (r *Registry) RunIdempotencyPruning(ctx context.Context, ttl time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := r.store.PruneIdempotencyKeys(time.Now().Add(-ttl))
+		if err != nil {
+			log.Printf("registry: pruning idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("registry: pruned %d idempotency key(s) older than %s", n, ttl)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StepWebhookSent is the last step of a journaled create: the
+// instance.created event has been logged and published. The webhook
+// dispatcher records it, which completes the entry. The steps before it are
+// reported by the instance manager; see k8s.CreateOptions.Journal.
+const StepWebhookSent = "webhook_sent"
+
+// JournalEntry is the progress of one provisioning operation, written
+// through to the store as each step completes, so that the operation can be
+// resumed or rolled back if the replica running it dies half-way. Entries
+// only exist while their operation is unfinished. Like operations, they are
+// not cached in memory: every read goes to the store.
+type JournalEntry struct {
+	ID           string        `json:"id"`
+	Action       string        `json:"action"`
+	TenantID     string        `json:"tenant_id"`
+	InstanceName string        `json:"instance_name,omitempty"` // Known once the spec is built
+	Steps        []JournalStep `json:"steps,omitempty"`         // In the order they completed
+	StartedAt    time.Time     `json:"started_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// JournalStep is one completed step of a journaled operation.
+type JournalStep struct {
+	Step string    `json:"step"`
+	At   time.Time `json:"at"`
+}
+
+// Done reports whether the entry's operation completed step.
+func (e JournalEntry) Done(step string) bool {
+	for _, s := range e.Steps {
+		if s.Step == step {
+			return true
+		}
+	}
+	return false
+}
+
+// BeginJournal opens the journal entry of an operation about to start.
+func (r *Registry) BeginJournal(id, action, tenantID string) error {
+	now := time.Now().UTC()
+	e := JournalEntry{ID: id, Action: action, TenantID: tenantID, StartedAt: now, UpdatedAt: now}
+	if err := r.store.PutJournalEntry(e); err != nil {
+		return fmt.Errorf("journaling operation %s: %v", id, err)
+	}
+	return nil
+}
+
+// JournalStep records that the operation with the given ID completed step,
+// on instanceName when set. An entry already ended is left alone.
+func (r *Registry) JournalStep(id, step, instanceName string) error {
+	r.journalMu.Lock()
+	defer r.journalMu.Unlock()
+	entries, err := r.store.JournalEntries()
+	if err != nil {
+		return fmt.Errorf("journaling operation %s: %v", id, err)
+	}
+	for _, e := range entries {
+		if e.ID == id {
+			return r.recordStep(e, step, instanceName)
+		}
+	}
+	return nil
+}
+
+// JournalInstanceStep is JournalStep for the open operation on the named
+// instance, if any. StepWebhookSent completes the entry.
+func (r *Registry) JournalInstanceStep(instanceName, step string) error {
+	r.journalMu.Lock()
+	defer r.journalMu.Unlock()
+	entries, err := r.store.JournalEntries()
+	if err != nil {
+		return fmt.Errorf("journaling instance %s: %v", instanceName, err)
+	}
+	for _, e := range entries {
+		if e.InstanceName != instanceName {
+			continue
+		}
+		if step == StepWebhookSent {
+			if err := r.store.DeleteJournalEntry(e.ID); err != nil {
+				return fmt.Errorf("ending journal of operation %s: %v", e.ID, err)
+			}
+			continue
+		}
+		if err := r.recordStep(e, step, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordStep appends step to e and stores it. Callers hold r.journalMu.
+func (r *Registry) recordStep(e JournalEntry, step, instanceName string) error {
+	now := time.Now().UTC()
+	if instanceName != "" {
+		e.InstanceName = instanceName
+	}
+	e.Steps = append(e.Steps, JournalStep{Step: step, At: now})
+	e.UpdatedAt = now
+	if err := r.store.PutJournalEntry(e); err != nil {
+		return fmt.Errorf("journaling operation %s: %v", e.ID, err)
+	}
+	return nil
+}
+
+// EndJournal drops the journal entry of an operation that finished, or that
+// failed and cleaned up after itself.
+func (r *Registry) EndJournal(id string) error {
+	r.journalMu.Lock()
+	defer r.journalMu.Unlock()
+	if err := r.store.DeleteJournalEntry(id); err != nil {
+		return fmt.Errorf("ending journal of operation %s: %v", id, err)
+	}
+	return nil
+}
+
+// Journal returns the entries of every unfinished operation, oldest first.
+func (r *Registry) Journal() ([]JournalEntry, error) {
+	entries, err := r.store.JournalEntries()
+	if err != nil {
+		return nil, fmt.Errorf("reading operation journal: %v", err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].StartedAt.Equal(entries[j].StartedAt) {
+			return entries[i].StartedAt.Before(entries[j].StartedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries, nil
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"fmt"
+	"time"
+)
+
+// AcquireLease takes or renews the named lease for holder for ttl, and
+// reports whether holder has it. A lease is free once its holder stops
+// renewing it, so a loop meant to run on one replica renews it on every
+// pass and only works while it holds it; with a shared store that is one
+// replica at a time.
+func (r *Registry) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	held, err := r.store.AcquireLease(name, holder, time.Now(), ttl)
+	if err != nil {
+		return false, fmt.Errorf("acquiring lease %s: %v", name, err)
+	}
+	return held, nil
+}
@@ -0,0 +1,294 @@
+package registry
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The SQL stores' schema is defined by the numbered migrations embedded
+// below, one directory per database. Each migration NNNN_name has an
+// NNNN_name.up.sql and an NNNN_name.down.sql file; applied versions are
+// recorded in the schema_migrations table. Never edit a released migration:
+// add a new one.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationLockID keys the Postgres advisory lock that keeps replicas
+// starting together from applying the same migration twice.
+const migrationLockID = 7242118
+
+// Migration is one schema change.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string     // Empty for versions applied by a newer release
+	AppliedAt *time.Time // Nil while pending
+}
+
+// migrations returns the migrations for dir, oldest first.
+func migrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dir))
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		file := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("malformed migration file name %s", file)
+		}
+		b, err := fs.ReadFile(migrationFiles, path.Join("migrations", dir, file))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %s lacks an up or down file", m)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// migrationDir returns the directory of the store's migrations.
+func (s *SQLStore) migrationDir() string {
+	if s.postgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+// applied returns the applied versions and when they were applied.
+func (s *SQLStore) applied() (map[int]time.Time, error) {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema_migrations table: %v", err)
+	}
+	rows, err := s.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	out := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("reading schema_migrations: %v", err)
+		}
+		out[version] = at.UTC()
+	}
+	return out, rows.Err()
+}
+
+// MigrationStatus lists every known or applied migration, oldest first.
+func (s *SQLStore) MigrationStatus() ([]MigrationStatus, error) {
+	all, err := migrations(s.migrationDir())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+	var out []MigrationStatus
+	for _, m := range all {
+		st := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			st.AppliedAt = &at
+			delete(applied, m.Version)
+		}
+		out = append(out, st)
+	}
+	for version, at := range applied {
+		at := at
+		out = append(out, MigrationStatus{Version: version, AppliedAt: &at})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending returns the migrations not applied yet, oldest first.
+func (s *SQLStore) Pending() ([]Migration, error) {
+	all, err := migrations(s.migrationDir())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+	var out []Migration
+	for _, m := range all {
+		if _, ok := applied[m.Version]; !ok {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// MigrateUp applies up to steps pending migrations, all of them when steps
+// is 0, oldest first. Each runs in its own transaction together with its
+// schema_migrations row. It returns the migrations applied.
+func (s *SQLStore) MigrateUp(steps int) ([]Migration, error) {
+	pending, err := s.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+	var done []Migration
+	for _, m := range pending {
+		ran, err := s.runMigration(m, true)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the steps most recently applied migrations, newest
+// first; steps must be at least 1. It returns the migrations reverted.
+func (s *SQLStore) MigrateDown(steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, fmt.Errorf("down needs at least one step")
+	}
+	all, err := migrations(s.migrationDir())
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(all) - 1; i >= 0 && len(done) < steps; i-- {
+		m := all[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		ran, err := s.runMigration(m, false)
+		if err != nil {
+			return done, err
+		}
+		if ran {
+			done = append(done, m)
+		}
+	}
+	return done, nil
+}
+
+// runMigration applies (up) or reverts m in a transaction. It reports false
+// if another process got there first.
+func (s *SQLStore) runMigration(m Migration, up bool) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if s.postgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return false, fmt.Errorf("locking schema_migrations: %v", err)
+		}
+	}
+	var exists int
+	err = tx.QueryRow(s.query(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), m.Version).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("reading schema_migrations: %v", err)
+	}
+	if (exists > 0) == up {
+		return false, nil
+	}
+
+	script, verb := m.down, "reverting"
+	if up {
+		script, verb = m.up, "applying"
+	}
+	if _, err := tx.Exec(script); err != nil {
+		return false, fmt.Errorf("%s migration %s: %v", verb, m, err)
+	}
+	if up {
+		_, err = tx.Exec(s.query(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`), m.Version, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(s.query(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+	}
+	if err != nil {
+		return false, fmt.Errorf("recording migration %s: %v", m, err)
+	}
+	return true, tx.Commit()
+}
+
+// prepareSchema brings the store's schema up to date when autoMigrate is
+// set, and otherwise refuses a schema with pending migrations.
+func (s *SQLStore) prepareSchema(autoMigrate bool) error {
+	if !autoMigrate {
+		pending, err := s.Pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d registry schema migration(s) pending, starting with %s; run \"migrate up\"",
+				len(pending), pending[0])
+		}
+		return nil
+	}
+	done, err := s.MigrateUp(0)
+	for _, m := range done {
+		log.Printf("registry: applied schema migration %s", m)
+	}
+	return err
+}
+
+// String returns the migration's file name prefix, such as
+// 0001_create_registry_records.
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteMigrationsRoundTrip(t *testing.T) {
+	s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	defer s.Close()
+
+	up, err := s.MigrateUp(0)
+	if err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	if len(up) == 0 {
+		t.Fatal("MigrateUp applied no migrations")
+	}
+	if pending, err := s.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending() after MigrateUp = %d, %v; want none", len(pending), err)
+	}
+
+	down, err := s.MigrateDown(len(up))
+	if err != nil {
+		t.Fatalf("MigrateDown: %v", err)
+	}
+	if len(down) != len(up) {
+		t.Fatalf("MigrateDown reverted %d migrations, want %d", len(down), len(up))
+	}
+
+	again, err := s.MigrateUp(0)
+	if err != nil {
+		t.Fatalf("MigrateUp after MigrateDown: %v", err)
+	}
+	if len(again) != len(up) {
+		t.Errorf("MigrateUp after MigrateDown applied %d migrations, want %d", len(again), len(up))
+	}
+}
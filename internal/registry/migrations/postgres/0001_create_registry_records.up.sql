@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS registry_records (
+	instance_name TEXT PRIMARY KEY,
+	tenant_id     TEXT NOT NULL,
+	record        JSONB NOT NULL,
+	updated_at    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS registry_records_tenant_id;
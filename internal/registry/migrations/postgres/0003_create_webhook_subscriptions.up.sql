@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id           TEXT PRIMARY KEY,
+	subscription JSONB NOT NULL,
+	updated_at   TIMESTAMPTZ NOT NULL
+);
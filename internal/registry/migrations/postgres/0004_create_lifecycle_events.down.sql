@@ -0,0 +1 @@
+DROP TABLE IF EXISTS lifecycle_events;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS lifecycle_events (
+	seq      BIGSERIAL PRIMARY KEY,
+	event_id TEXT NOT NULL,
+	at       TIMESTAMPTZ NOT NULL,
+	event    JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS lifecycle_events_at ON lifecycle_events (at);
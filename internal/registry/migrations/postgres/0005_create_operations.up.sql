@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS operations (
+	id         TEXT PRIMARY KEY,
+	tenant_id  TEXT NOT NULL,
+	operation  JSONB NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS operations_updated_at ON operations (updated_at);
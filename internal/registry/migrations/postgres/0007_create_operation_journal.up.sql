@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS operation_journal (
+	id            TEXT PRIMARY KEY,
+	instance_name TEXT NOT NULL,
+	entry         JSONB NOT NULL,
+	updated_at    TIMESTAMPTZ NOT NULL
+);
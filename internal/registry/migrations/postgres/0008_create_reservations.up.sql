@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS reservations (
+	id            TEXT PRIMARY KEY,
+	tenant_id     TEXT NOT NULL,
+	instance_name TEXT NOT NULL,
+	reservation   JSONB NOT NULL,
+	expires_at    TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS reservations_expires_at ON reservations (expires_at);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS tenant_contacts (
+	tenant_id TEXT PRIMARY KEY,
+	contact   JSONB NOT NULL
+);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS organizations (
+	id           TEXT PRIMARY KEY,
+	organization JSONB NOT NULL
+);
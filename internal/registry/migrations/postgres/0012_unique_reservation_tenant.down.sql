@@ -0,0 +1 @@
+DROP INDEX IF EXISTS reservations_tenant_id;
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS registry_records (
+	instance_name TEXT PRIMARY KEY,
+	tenant_id     TEXT NOT NULL,
+	record        TEXT NOT NULL,
+	updated_at    TIMESTAMP NOT NULL
+);
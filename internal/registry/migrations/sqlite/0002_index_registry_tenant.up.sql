@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS registry_records_tenant_id ON registry_records (tenant_id);
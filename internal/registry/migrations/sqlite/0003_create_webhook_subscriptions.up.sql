@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	id           TEXT PRIMARY KEY,
+	subscription TEXT NOT NULL,
+	updated_at   TIMESTAMP NOT NULL
+);
@@ -0,0 +1,8 @@
+-- AUTOINCREMENT keeps sequence numbers of pruned events from being reused.
+CREATE TABLE IF NOT EXISTS lifecycle_events (
+	seq      INTEGER PRIMARY KEY AUTOINCREMENT,
+	event_id TEXT NOT NULL,
+	at       TIMESTAMP NOT NULL,
+	event    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS lifecycle_events_at ON lifecycle_events (at);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS operation_journal (
+	id            TEXT PRIMARY KEY,
+	instance_name TEXT NOT NULL,
+	entry         TEXT NOT NULL,
+	updated_at    TIMESTAMP NOT NULL
+);
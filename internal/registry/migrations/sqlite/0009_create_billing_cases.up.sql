@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS billing_cases (
+	tenant_id    TEXT NOT NULL,
+	event        TEXT NOT NULL,
+	billing_case TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, event)
+);
@@ -0,0 +1,3 @@
+DELETE FROM reservations
+	WHERE id NOT IN (SELECT MIN(id) FROM reservations GROUP BY tenant_id);
+CREATE UNIQUE INDEX IF NOT EXISTS reservations_tenant_id ON reservations (tenant_id);
@@ -0,0 +1,64 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Operation is the state of an asynchronous tenant operation, such as a
+// queued create. The replica running it writes each change through to the
+// store, so that any replica behind the load balancer can answer a status
+// request for it. Operations are not cached in memory: every read goes to
+// the store.
+type Operation struct {
+	ID                   string     `json:"id"`
+	Action               string     `json:"action"`
+	TenantID             string     `json:"tenant_id"`
+	Status               string     `json:"status"` // "queued", "running", "succeeded" or "failed"
+	QueuePosition        int        `json:"queue_position,omitempty"`
+	EstimatedWaitSeconds int        `json:"estimated_wait_seconds,omitempty"`
+	Error                string     `json:"error,omitempty"`
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	FinishedAt           *time.Time `json:"finished_at,omitempty"`
+}
+
+// PutOperation creates or replaces an operation, stamping its update time.
+func (r *Registry) PutOperation(op Operation) error {
+	op.UpdatedAt = time.Now().UTC()
+	if err := r.store.PutOperation(op); err != nil {
+		return fmt.Errorf("saving operation %s: %v", op.ID, err)
+	}
+	return nil
+}
+
+// Operation returns the operation with the given ID.
+func (r *Registry) Operation(id string) (Operation, bool, error) {
+	op, ok, err := r.store.Operation(id)
+	if err != nil {
+		return Operation{}, false, fmt.Errorf("reading operation %s: %v", id, err)
+	}
+	return op, ok, nil
+}
+
+// RunOperationPruning drops operations last updated more than retention ago
+// every hour until ctx is cancelled.
+func (r *Registry) RunOperationPruning(ctx context.Context, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := r.store.PruneOperations(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("registry: pruning operations: %v", err)
+		} else if n > 0 {
+			log.Printf("registry: pruned %d operation(s) older than %s", n, retention)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
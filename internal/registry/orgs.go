@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Organization is a reseller, or another organization, above tenants: the
+// tenants it provisioned, the quotas and plan ceiling they share, and the
+// API tokens it acts with.
+type Organization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// MaxTenants and MaxInstances cap the organization's tenants and their
+	// live instances; zero is unlimited.
+	MaxTenants   int `json:"max_tenants"`
+	MaxInstances int `json:"max_instances"`
+	// MaxPlan is the highest plan, in PLAN_TIERS order, that its tenants'
+	// instances may be created on; empty allows any.
+	MaxPlan   string     `json:"max_plan,omitempty"`
+	Tenants   []string   `json:"tenants"`
+	Tokens    []OrgToken `json:"tokens"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// OrgToken is an API token of an organization. Only its digest is kept.
+type OrgToken struct {
+	ID        string    `json:"id"`
+	Digest    string    `json:"digest"` // Hex SHA-256 of the token
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TokenDigest returns the hex SHA-256 digest of an organization token.
+func TokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// HasTenant reports whether the tenant belongs to o.
+func (o Organization) HasTenant(tenantID string) bool {
+	for _, t := range o.Tenants {
+		if t == tenantID {
+			return true
+		}
+	}
+	return false
+}
+
+// PutOrganization creates or replaces an organization.
+func (r *Registry) PutOrganization(o Organization) error {
+	if err := r.store.PutOrganization(o); err != nil {
+		return fmt.Errorf("saving organization %s: %v", o.ID, err)
+	}
+	return nil
+}
+
+// Organization returns the organization with the ID, if there is one.
+func (r *Registry) Organization(id string) (Organization, bool, error) {
+	orgs, err := r.Organizations()
+	if err != nil {
+		return Organization{}, false, err
+	}
+	for _, o := range orgs {
+		if o.ID == id {
+			return o, true, nil
+		}
+	}
+	return Organization{}, false, nil
+}
+
+// Organizations returns every organization, ordered by ID.
+func (r *Registry) Organizations() ([]Organization, error) {
+	orgs, err := r.store.Organizations()
+	if err != nil {
+		return nil, fmt.Errorf("reading organizations: %v", err)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+	return orgs, nil
+}
+
+// DeleteOrganization drops an organization, if present.
+func (r *Registry) DeleteOrganization(id string) error {
+	if err := r.store.DeleteOrganization(id); err != nil {
+		return fmt.Errorf("deleting organization %s: %v", id, err)
+	}
+	return nil
+}
+
+// OrganizationByToken returns the organization that token belongs to.
+func (r *Registry) OrganizationByToken(token string) (Organization, bool, error) {
+	if token == "" {
+		return Organization{}, false, nil
+	}
+	orgs, err := r.Organizations()
+	if err != nil {
+		return Organization{}, false, err
+	}
+	digest := []byte(TokenDigest(token))
+	for _, o := range orgs {
+		for _, t := range o.Tokens {
+			if subtle.ConstantTimeCompare(digest, []byte(t.Digest)) == 1 {
+				return o, true, nil
+			}
+		}
+	}
+	return Organization{}, false, nil
+}
+
+// TenantOrganization returns the organization the tenant belongs to, if any.
+func (r *Registry) TenantOrganization(tenantID string) (Organization, bool, error) {
+	orgs, err := r.Organizations()
+	if err != nil {
+		return Organization{}, false, err
+	}
+	for _, o := range orgs {
+		if o.HasTenant(tenantID) {
+			return o, true, nil
+		}
+	}
+	return Organization{}, false, nil
+}
+
+// UpdateOrganization applies update to the organization with the ID, or to
+// a new one with the ID when found is false, and stores the result unless
+// update returns an error, which is returned as is. Updates through one
+// replica are serialised.
+func (r *Registry) UpdateOrganization(id string, update func(o *Organization, found bool) error) (Organization, error) {
+	r.orgsMu.Lock()
+	defer r.orgsMu.Unlock()
+	o, found, err := r.Organization(id)
+	if err != nil {
+		return Organization{}, err
+	}
+	if !found {
+		o = Organization{ID: id, Tenants: []string{}, Tokens: []OrgToken{}, CreatedAt: time.Now().UTC()}
+	}
+	if err := update(&o, found); err != nil {
+		return Organization{}, err
+	}
+	o.UpdatedAt = time.Now().UTC()
+	return o, r.PutOrganization(o)
+}
+
+// TenantRecords returns the live records of the tenants, ordered by tenant
+// and instance name.
+func (r *Registry) TenantRecords(tenantIDs []string) []Record {
+	want := make(map[string]bool, len(tenantIDs))
+	for _, id := range tenantIDs {
+		want[id] = true
+	}
+	var out []Record
+	for _, rec := range r.List() {
+		if rec.DeletedAt == nil && want[rec.TenantID] {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
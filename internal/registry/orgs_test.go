@@ -0,0 +1,42 @@
+package registry
+
+import "testing"
+
+func TestOrganizationByToken(t *testing.T) {
+	r, err := Open(NewMemoryStore())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, o := range []Organization{
+		{ID: "acme", Tokens: []OrgToken{{ID: "t1", Digest: TokenDigest("acme-one")}, {ID: "t2", Digest: TokenDigest("acme-two")}}},
+		{ID: "globex", Tokens: []OrgToken{{ID: "t3", Digest: TokenDigest("globex-one")}}},
+		{ID: "initech"},
+	} {
+		if err := r.PutOrganization(o); err != nil {
+			t.Fatalf("PutOrganization: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		wantID string
+		wantOK bool
+	}{
+		{"first token", "acme-one", "acme", true},
+		{"second token", "acme-two", "acme", true},
+		{"other organization", "globex-one", "globex", true},
+		{"unknown token", "acme-three", "", false},
+		{"digest is not a token", TokenDigest("acme-one"), "", false},
+		{"empty token", "", "", false},
+	}
+	for _, tt := range tests {
+		o, ok, err := r.OrganizationByToken(tt.token)
+		if err != nil {
+			t.Fatalf("%s: OrganizationByToken: %v", tt.name, err)
+		}
+		if ok != tt.wantOK || o.ID != tt.wantID {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, o.ID, ok, tt.wantID, tt.wantOK)
+		}
+	}
+}
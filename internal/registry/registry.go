@@ -0,0 +1,296 @@
+// Package registry is the service's durable record of every tenant instance
+// it knows about, kept in step with the cluster by the instance watch.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/tenant"
+)
+
+// Record is one instance as last seen in the cluster.
+type Record struct {
+	TenantID     string                 `json:"tenant_id"`
+	InstanceName string                 `json:"instance_name"`
+	Plan         string                 `json:"plan,omitempty"`
+	ContactEmail string                 `json:"contact_email,omitempty"`
+	Status       string                 `json:"status"`
+	Labels       map[string]string      `json:"labels,omitempty"`
+	Annotations  map[string]string      `json:"annotations,omitempty"`
+	Spec         map[string]interface{} `json:"spec,omitempty"`
+	CreatedAt    time.Time              `json:"created_at"`
+	UpdatedAt    time.Time              `json:"updated_at"`
+	DeletedAt    *time.Time             `json:"deleted_at,omitempty"`  // Set once the instance is gone
+	Revisions    []Revision             `json:"revisions,omitempty"`   // Oldest first
+	Diagnostics  *k8s.Diagnostics       `json:"diagnostics,omitempty"` // Captured when provisioning was failed
+}
+
+// maxRevisions caps the spec history kept per instance.
+const maxRevisions = 20
+
+// Revision is one distinct spec an instance has run with.
+type Revision struct {
+	Revision int       `json:"revision"`
+	At       time.Time `json:"at"`
+	ImageTag string    `json:"image_tag,omitempty"`
+	SpecHash string    `json:"spec_hash"`
+}
+
+// Registry holds Records keyed by instance name, written through to a Store
+// after every change.
+type Registry struct {
+	store Store
+
+	mu        sync.Mutex
+	records   map[string]*Record
+	seen      map[string]bool // Instances listed since startup, until the first sync
+	synced    bool
+	forgotten map[string]bool // Instances removed by Forget, whose late watch events are ignored
+	webhooks  map[string]Webhook
+
+	eventsMu  sync.Mutex // Serialises appends to and pruning of the event log
+	journalMu sync.Mutex // Serialises this replica's updates of journal entries
+	orgsMu    sync.Mutex // Serialises this replica's updates of organizations
+}
+
+// Open loads the registry from store.
+func Open(store Store) (*Registry, error) {
+	r := &Registry{store: store, records: make(map[string]*Record), seen: make(map[string]bool), forgotten: make(map[string]bool), webhooks: make(map[string]Webhook)}
+	records, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("loading registry: %v", err)
+	}
+	for i := range records {
+		rec := &records[i]
+		r.records[rec.InstanceName] = rec
+		// Rows written before tenant IDs were canonicalized.
+		if id := tenant.Canonical(rec.TenantID); id != rec.TenantID {
+			rec.TenantID = id
+			r.save(rec)
+		}
+	}
+	webhooks, err := store.LoadWebhooks()
+	if err != nil {
+		return nil, fmt.Errorf("loading webhooks: %v", err)
+	}
+	for _, w := range webhooks {
+		r.webhooks[w.ID] = w
+	}
+	return r, nil
+}
+
+// Close closes the registry's store.
+func (r *Registry) Close() error {
+	return r.store.Close()
+}
+
+// HandleInstanceEvent applies a watch event; pass it to OnInstanceEvent. The
+// watch's initial list adds rows missing after downtime, and the sync that
+// follows marks deleted every live row the list did not include.
+func (r *Registry) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	now := time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch ev.Type {
+	case k8s.InstanceSynced:
+		r.reconcile(now)
+	case k8s.InstanceAdded, k8s.InstanceUpdated:
+		if ev.Info == nil || r.forgotten[ev.Info.Name] {
+			return
+		}
+		if !r.synced {
+			r.seen[ev.Info.Name] = true
+		}
+		r.upsert(ev, now)
+	case k8s.InstanceDeleted:
+		if ev.Info == nil {
+			return
+		}
+		if rec, ok := r.records[ev.Info.Name]; ok && rec.DeletedAt == nil {
+			rec.DeletedAt = &now
+			rec.UpdatedAt = now
+			rec.Status = "deleted"
+			r.save(rec)
+		}
+	}
+}
+
+// upsert records the instance in ev. Callers hold r.mu.
+func (r *Registry) upsert(ev k8s.InstanceEvent, now time.Time) {
+	rec, ok := r.records[ev.Info.Name]
+	if !ok {
+		rec = &Record{InstanceName: ev.Info.Name, CreatedAt: ev.Info.CreatedAt}
+		if rec.CreatedAt.IsZero() {
+			rec.CreatedAt = now
+		}
+		r.records[ev.Info.Name] = rec
+		log.Printf("registry: added instance %s for tenant %s", ev.Info.Name, ev.TenantID)
+	}
+	rec.TenantID = ev.TenantID
+	rec.Plan = ev.Info.Plan
+	rec.ContactEmail = ev.Info.ContactEmail
+	rec.Status = ev.Info.Status
+	rec.DeletedAt = nil
+	rec.UpdatedAt = now
+	if obj := ev.Object; obj != nil {
+		rec.Labels = obj.GetLabels()
+		rec.Annotations = obj.GetAnnotations()
+		if spec, ok := obj.Object["spec"].(map[string]interface{}); ok {
+			rec.Spec = spec
+			rec.addRevision(spec, now)
+		}
+	}
+	r.save(rec)
+}
+
+// addRevision appends a revision when spec differs from the latest one.
+func (rec *Record) addRevision(spec map[string]interface{}, now time.Time) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+	next := 1
+	if n := len(rec.Revisions); n > 0 {
+		if rec.Revisions[n-1].SpecHash == hash {
+			return
+		}
+		next = rec.Revisions[n-1].Revision + 1
+	}
+	rev := Revision{Revision: next, At: now, SpecHash: hash}
+	if image, ok := spec["image"].(map[string]interface{}); ok {
+		rev.ImageTag, _ = image["tag"].(string)
+	}
+	rec.Revisions = append(rec.Revisions, rev)
+	if n := len(rec.Revisions); n > maxRevisions {
+		rec.Revisions = append([]Revision(nil), rec.Revisions[n-maxRevisions:]...)
+	}
+}
+
+// Forget removes the tenant's rows once its instances have been torn down
+// through the API, so that no spec of a deleted tenant stays on record. Rows
+// of instances that disappear any other way are kept, marked deleted. Watch
+// events still in flight for the forgotten instances are ignored.
+func (r *Registry) Forget(tenantID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	removed := 0
+	for name, rec := range r.records {
+		if rec.TenantID == tenantID {
+			delete(r.records, name)
+			r.forgotten[name] = true
+			r.remove(name)
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("registry: forgot %d instance(s) of deleted tenant %s", removed, tenantID)
+	}
+}
+
+// ForgetInstance removes the row of one instance torn down through the API,
+// leaving the rows of the tenant's other instances in place. It reports
+// whether there was a row, and fails if the store could not delete it.
+func (r *Registry) ForgetInstance(name string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.records[name]
+	r.forgotten[name] = true
+	if !ok {
+		return false, nil
+	}
+	delete(r.records, name)
+	if err := r.store.Delete(name); err != nil {
+		return true, fmt.Errorf("deleting the row of %s: %v", name, err)
+	}
+	log.Printf("registry: forgot instance %s of tenant %s", name, rec.TenantID)
+	return true, nil
+}
+
+// reconcile marks deleted the live rows absent from the initial list. Callers
+// hold r.mu.
+func (r *Registry) reconcile(now time.Time) {
+	if r.synced {
+		return
+	}
+	r.synced = true
+	marked := 0
+	for name, rec := range r.records {
+		if rec.DeletedAt == nil && !r.seen[name] {
+			rec.DeletedAt = &now
+			rec.UpdatedAt = now
+			rec.Status = "deleted"
+			r.save(rec)
+			marked++
+		}
+	}
+	r.seen = nil
+	log.Printf("registry: synced with cluster, %d live instance(s), %d marked deleted", r.liveCount(), marked)
+}
+
+// Synced reports whether the registry has been reconciled with the watch's
+// initial list since startup. Until then it may be missing instances.
+func (r *Registry) Synced() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.synced
+}
+
+// liveCount returns the number of rows not marked deleted. Callers hold r.mu.
+func (r *Registry) liveCount() int {
+	n := 0
+	for _, rec := range r.records {
+		if rec.DeletedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// List returns copies of every record, live ones first, each group ordered by
+// tenant and instance name.
+func (r *Registry) List() []Record {
+	r.mu.Lock()
+	out := make([]Record, 0, len(r.records))
+	for _, rec := range r.records {
+		out = append(out, *rec)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if (a.DeletedAt == nil) != (b.DeletedAt == nil) {
+			return a.DeletedAt == nil
+		}
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		return a.InstanceName < b.InstanceName
+	})
+	return out
+}
+
+// save writes rec through to the store. Callers hold r.mu.
+func (r *Registry) save(rec *Record) {
+	if err := r.store.Put(*rec); err != nil {
+		log.Printf("registry: saving: %v", err)
+	}
+}
+
+// remove deletes the named instance's record from the store. Callers hold
+// r.mu.
+func (r *Registry) remove(name string) {
+	if err := r.store.Delete(name); err != nil {
+		log.Printf("registry: saving: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// Reservation holds an instance name, its capacity and the create request
+// for a tenant until the create is committed, released or the reservation
+// expires. Like operations, reservations are not cached in memory, so that
+// every replica honours those made on the others.
+type Reservation struct {
+	ID               string          `json:"id"`
+	TenantID         string          `json:"tenant_id"`
+	InstanceName     string          `json:"instance_name"`
+	Endpoint         string          `json:"endpoint"`
+	InternalEndpoint string          `json:"internal_endpoint,omitempty"`
+	Environment      string          `json:"environment,omitempty"`
+	Plan             string          `json:"plan,omitempty"`
+	CPU              string          `json:"cpu,omitempty"`     // Requested by the reserved spec
+	Memory           string          `json:"memory,omitempty"`  // Requested by the reserved spec
+	Request          json.RawMessage `json:"request,omitempty"` // The create request, without a gateway token
+	CreatedAt        time.Time       `json:"created_at"`
+	ExpiresAt        time.Time       `json:"expires_at"`
+}
+
+// Expired reports whether the reservation no longer holds anything.
+func (r Reservation) Expired(now time.Time) bool { return !now.Before(r.ExpiresAt) }
+
+// ClaimReservation stores res unless its tenant already holds an unexpired
+// reservation, which it returns with claimed=false. The check and the write
+// are one store operation, so two replicas cannot both reserve for a tenant.
+func (r *Registry) ClaimReservation(res Reservation) (existing Reservation, claimed bool, err error) {
+	existing, claimed, err = r.store.ClaimReservation(res, time.Now())
+	if err != nil {
+		return Reservation{}, false, fmt.Errorf("saving reservation %s: %v", res.ID, err)
+	}
+	return existing, claimed, nil
+}
+
+// Reservation returns the unexpired reservation with the given ID. An
+// expired one is deleted rather than left for the hourly pruning.
+func (r *Registry) Reservation(id string) (Reservation, bool, error) {
+	res, ok, err := r.store.Reservation(id)
+	if err != nil {
+		return Reservation{}, false, fmt.Errorf("reading reservation %s: %v", id, err)
+	}
+	if !ok {
+		return Reservation{}, false, nil
+	}
+	if res.Expired(time.Now()) {
+		r.dropExpiredReservation(res)
+		return Reservation{}, false, nil
+	}
+	return res, true, nil
+}
+
+// Reservations returns every unexpired reservation, deleting the expired
+// ones it finds.
+func (r *Registry) Reservations() ([]Reservation, error) {
+	all, err := r.store.Reservations()
+	if err != nil {
+		return nil, fmt.Errorf("reading reservations: %v", err)
+	}
+	now := time.Now()
+	out := all[:0]
+	for _, res := range all {
+		if res.Expired(now) {
+			r.dropExpiredReservation(res)
+			continue
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+// dropExpiredReservation deletes an expired reservation. A failure is only
+// logged: the reservation holds nothing and the pruning retries it.
+func (r *Registry) dropExpiredReservation(res Reservation) {
+	if err := r.store.DeleteReservation(res.ID); err != nil {
+		log.Printf("registry: deleting expired reservation %s: %v", res.ID, err)
+	}
+}
+
+// DeleteReservation drops a reservation, if present.
+func (r *Registry) DeleteReservation(id string) error {
+	if err := r.store.DeleteReservation(id); err != nil {
+		return fmt.Errorf("deleting reservation %s: %v", id, err)
+	}
+	return nil
+}
+
+// HeldReservations returns the unexpired reservations as the instance manager
+// honours them; pass it to UseReservations.
+func (r *Registry) HeldReservations(ctx context.Context) ([]k8s.Reservation, error) {
+	all, err := r.Reservations()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]k8s.Reservation, len(all))
+	for i, res := range all {
+		out[i] = res.Held()
+	}
+	return out, nil
+}
+
+// Held returns the name and capacity the reservation holds.
+func (r Reservation) Held() k8s.Reservation {
+	return k8s.Reservation{ID: r.ID, TenantID: r.TenantID, InstanceName: r.InstanceName, CPU: r.CPU, Memory: r.Memory}
+}
+
+// RunReservationPruning drops expired reservations every hour until ctx is
+// cancelled. Expired reservations hold nothing even before they are pruned.
+func (r *Registry) RunReservationPruning(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := r.store.PruneReservations(time.Now())
+		if err != nil {
+			log.Printf("registry: pruning reservations: %v", err)
+		} else if n > 0 {
+			log.Printf("registry: pruned %d expired reservation(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
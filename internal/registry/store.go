@@ -0,0 +1,1033 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+)
+
+// Store persists registry records. The Registry keeps every record in memory
+// and writes each change through to its Store, so a Store is only read when
+// the registry is opened.
+type Store interface {
+	// Load returns every stored record.
+	Load() ([]Record, error)
+	// Put stores rec, replacing any record of the same instance.
+	Put(rec Record) error
+	// Delete removes the record of the named instance, if any.
+	Delete(instanceName string) error
+
+	// LoadWebhooks, PutWebhook and DeleteWebhook do the same for webhook
+	// subscriptions, keyed by ID.
+	LoadWebhooks() ([]Webhook, error)
+	PutWebhook(w Webhook) error
+	DeleteWebhook(id string) error
+
+	// AppendEvent adds ev to the event log and returns its sequence number,
+	// greater than any before it. Events returns up to limit events after
+	// since, oldest first; FirstEventSeq the oldest retained sequence
+	// number, 0 when the log is empty; and PruneEvents drops events logged
+	// before the given time, returning how many. Callers serialise
+	// AppendEvent and PruneEvents.
+	AppendEvent(ev Event) (int64, error)
+	Events(since int64, limit int) ([]Event, error)
+	FirstEventSeq() (int64, error)
+	PruneEvents(before time.Time) (int, error)
+
+	// PutOperation stores op, replacing any operation with its ID, and
+	// Operation reads one back. PruneOperations drops operations last
+	// updated before the given time, returning how many.
+	PutOperation(op Operation) error
+	Operation(id string) (Operation, bool, error)
+	PruneOperations(before time.Time) (int, error)
+
+	// ClaimIdempotencyKey stores resp unless a response with its ID exists,
+	// in which case it returns that one and claimed=false. The check and
+	// the insert are atomic across replicas sharing the store.
+	// PutIdempotentResponse replaces a response, DeleteIdempotencyKey drops
+	// one and PruneIdempotencyKeys drops those created before the given
+	// time, returning how many.
+	ClaimIdempotencyKey(resp IdempotentResponse) (existing IdempotentResponse, claimed bool, err error)
+	PutIdempotentResponse(resp IdempotentResponse) error
+	DeleteIdempotencyKey(id string) error
+	PruneIdempotencyKeys(before time.Time) (int, error)
+
+	// PutJournalEntry stores e, replacing any entry with its ID;
+	// DeleteJournalEntry drops one, if present; and JournalEntries returns
+	// every entry.
+	PutJournalEntry(e JournalEntry) error
+	DeleteJournalEntry(id string) error
+	JournalEntries() ([]JournalEntry, error)
+
+	// ClaimReservation drops the tenant's reservations expired at now and
+	// stores res unless the tenant still holds one, which it returns with
+	// claimed=false; Reservation reads one back and Reservations returns
+	// every one, expired or not. DeleteReservation drops one, if present,
+	// and PruneReservations drops those expiring before the given time,
+	// returning how many.
+	ClaimReservation(res Reservation, now time.Time) (existing Reservation, claimed bool, err error)
+	Reservation(id string) (Reservation, bool, error)
+	Reservations() ([]Reservation, error)
+	DeleteReservation(id string) error
+	PruneReservations(before time.Time) (int, error)
+
+	// AddBillingCase stores c unless the tenant has a case for c.Event;
+	// UpdateBillingCase replaces the tenant's case for c.Event with c only
+	// while it is still prev. Both report whether they stored c.
+	// DeleteBillingCase drops a case, if present, and BillingCases returns
+	// every case.
+	AddBillingCase(c BillingCase) (bool, error)
+	UpdateBillingCase(prev, c BillingCase) (bool, error)
+	DeleteBillingCase(tenantID, event string) error
+	BillingCases() ([]BillingCase, error)
+
+	// AcquireLease gives the named lease to holder until now+ttl if it is
+	// free, expired or already holder's, reporting whether holder has it.
+	AcquireLease(name, holder string, now time.Time, ttl time.Duration) (bool, error)
+
+	// PutContact stores c, replacing the tenant's contact; Contact reads
+	// one back; and DeleteContact drops one, if present.
+	PutContact(c Contact) error
+	Contact(tenantID string) (Contact, bool, error)
+	DeleteContact(tenantID string) error
+
+	// PutOrganization stores o, replacing any organization with its ID;
+	// Organizations returns every one; and DeleteOrganization drops one, if
+	// present.
+	PutOrganization(o Organization) error
+	Organizations() ([]Organization, error)
+	DeleteOrganization(id string) error
+
+	// Close releases the store's resources.
+	Close() error
+}
+
+// MemoryStore keeps nothing beyond the process: the registry lives in
+// memory only and starts empty on every restart, event log included. It
+// suits development, and deployments that rely on the startup sync with the
+// cluster alone.
+type MemoryStore struct {
+	mu         sync.Mutex
+	events     eventLog
+	operations operationSet
+	idempotent idempotentSet
+	journal    journalSet
+	reserved   reservationSet
+	billing    billingSet
+	leases     leaseSet
+	contacts   map[string]Contact
+	orgs       map[string]Organization
+}
+
+// NewMemoryStore returns a MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{operations: operationSet{}, idempotent: idempotentSet{}, journal: journalSet{}, reserved: reservationSet{}, billing: billingSet{}, leases: leaseSet{}, contacts: make(map[string]Contact), orgs: make(map[string]Organization)}
+}
+
+func (*MemoryStore) Load() ([]Record, error)          { return nil, nil }
+func (*MemoryStore) Put(rec Record) error             { return nil }
+func (*MemoryStore) Delete(instanceName string) error { return nil }
+func (*MemoryStore) LoadWebhooks() ([]Webhook, error) { return nil, nil }
+func (*MemoryStore) PutWebhook(w Webhook) error       { return nil }
+func (*MemoryStore) DeleteWebhook(id string) error    { return nil }
+func (*MemoryStore) Close() error                     { return nil }
+
+func (s *MemoryStore) AppendEvent(ev Event) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.append(ev).Seq, nil
+}
+
+func (s *MemoryStore) Events(since int64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.after(since, limit), nil
+}
+
+func (s *MemoryStore) FirstEventSeq() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.first(), nil
+}
+
+func (s *MemoryStore) PruneEvents(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.prune(before), nil
+}
+
+func (s *MemoryStore) PutOperation(op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.ID] = op
+	return nil
+}
+
+func (s *MemoryStore) Operation(id string) (Operation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.operations[id]
+	return op, ok, nil
+}
+
+func (s *MemoryStore) PruneOperations(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.operations.prune(before), nil
+}
+
+func (s *MemoryStore) ClaimIdempotencyKey(resp IdempotentResponse) (IdempotentResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, claimed := s.idempotent.claim(resp)
+	return existing, claimed, nil
+}
+
+func (s *MemoryStore) PutIdempotentResponse(resp IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotent[resp.ID] = resp
+	return nil
+}
+
+func (s *MemoryStore) DeleteIdempotencyKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotent, id)
+	return nil
+}
+
+func (s *MemoryStore) PruneIdempotencyKeys(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.idempotent.prune(before), nil
+}
+
+func (s *MemoryStore) PutJournalEntry(e JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journal[e.ID] = e
+	return nil
+}
+
+func (s *MemoryStore) DeleteJournalEntry(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.journal, id)
+	return nil
+}
+
+func (s *MemoryStore) JournalEntries() ([]JournalEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.list(), nil
+}
+
+func (s *MemoryStore) ClaimReservation(res Reservation, now time.Time) (Reservation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, held, _ := s.reserved.claim(res, now); held {
+		return existing, false, nil
+	}
+	return res, true, nil
+}
+
+func (s *MemoryStore) Reservation(id string) (Reservation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.reserved[id]
+	return res, ok, nil
+}
+
+func (s *MemoryStore) Reservations() ([]Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reserved.list(), nil
+}
+
+func (s *MemoryStore) DeleteReservation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reserved, id)
+	return nil
+}
+
+func (s *MemoryStore) PruneReservations(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reserved.prune(before), nil
+}
+
+func (s *MemoryStore) AddBillingCase(c BillingCase) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.billing.add(c), nil
+}
+
+func (s *MemoryStore) UpdateBillingCase(prev, c BillingCase) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.billing.update(prev, c), nil
+}
+
+func (s *MemoryStore) DeleteBillingCase(tenantID, event string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.billing, billingKey(tenantID, event))
+	return nil
+}
+
+func (s *MemoryStore) BillingCases() ([]BillingCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.billing.list(), nil
+}
+
+func (s *MemoryStore) AcquireLease(name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leases.acquire(name, holder, now, ttl), nil
+}
+
+func (s *MemoryStore) PutContact(c Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contacts[c.TenantID] = c
+	return nil
+}
+
+func (s *MemoryStore) Contact(tenantID string) (Contact, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[tenantID]
+	return c, ok, nil
+}
+
+func (s *MemoryStore) DeleteContact(tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.contacts, tenantID)
+	return nil
+}
+
+func (s *MemoryStore) PutOrganization(o Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs[o.ID] = o
+	return nil
+}
+
+func (s *MemoryStore) Organizations() ([]Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return orgList(s.orgs), nil
+}
+
+func (s *MemoryStore) DeleteOrganization(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.orgs, id)
+	return nil
+}
+
+// orgList returns the organizations of m in no particular order.
+func orgList(m map[string]Organization) []Organization {
+	out := make([]Organization, 0, len(m))
+	for _, o := range m {
+		out = append(out, o)
+	}
+	return out
+}
+
+// billingSet holds billing cases by tenant and opening event; see
+// billingKey.
+type billingSet map[string]BillingCase
+
+// billingKey is the key of the tenant's case for event in a billingSet.
+func billingKey(tenantID, event string) string { return tenantID + "/" + event }
+
+func (x billingSet) list() []BillingCase {
+	out := make([]BillingCase, 0, len(x))
+	for _, c := range x {
+		out = append(out, c)
+	}
+	return out
+}
+
+// add stores c unless the tenant has a case for c.Event.
+func (x billingSet) add(c BillingCase) bool {
+	key := billingKey(c.TenantID, c.Event)
+	if _, ok := x[key]; ok {
+		return false
+	}
+	x[key] = c
+	return true
+}
+
+// update replaces the tenant's case for c.Event with c if it is still prev.
+func (x billingSet) update(prev, c BillingCase) bool {
+	key := billingKey(c.TenantID, c.Event)
+	current, ok := x[key]
+	if !ok || !current.same(prev) {
+		return false
+	}
+	x[key] = c
+	return true
+}
+
+// leaseSet holds leases by name.
+type leaseSet map[string]lease
+
+// lease is a leaseSet entry.
+type lease struct {
+	holder string
+	until  time.Time
+}
+
+func (x leaseSet) acquire(name, holder string, now time.Time, ttl time.Duration) bool {
+	if l, ok := x[name]; ok && l.holder != holder && now.Before(l.until) {
+		return false
+	}
+	x[name] = lease{holder: holder, until: now.Add(ttl)}
+	return true
+}
+
+// reservationSet holds reservations by ID.
+type reservationSet map[string]Reservation
+
+func (x reservationSet) list() []Reservation {
+	out := make([]Reservation, 0, len(x))
+	for _, res := range x {
+		out = append(out, res)
+	}
+	return out
+}
+
+// claim drops the reservations of res's tenant expired at now and adds res
+// unless the tenant still holds one, which it returns with held=true. It
+// also returns how many reservations it dropped.
+func (x reservationSet) claim(res Reservation, now time.Time) (existing Reservation, held bool, dropped int) {
+	for id, other := range x {
+		if other.TenantID != res.TenantID {
+			continue
+		}
+		if other.Expired(now) {
+			delete(x, id)
+			dropped++
+			continue
+		}
+		existing, held = other, true
+	}
+	if !held {
+		x[res.ID] = res
+	}
+	return existing, held, dropped
+}
+
+func (x reservationSet) prune(before time.Time) int {
+	n := 0
+	for id, res := range x {
+		if res.ExpiresAt.Before(before) {
+			delete(x, id)
+			n++
+		}
+	}
+	return n
+}
+
+// journalSet holds journal entries by operation ID.
+type journalSet map[string]JournalEntry
+
+func (j journalSet) list() []JournalEntry {
+	out := make([]JournalEntry, 0, len(j))
+	for _, e := range j {
+		out = append(out, e)
+	}
+	return out
+}
+
+// idempotentSet holds idempotent responses by ID.
+type idempotentSet map[string]IdempotentResponse
+
+func (x idempotentSet) claim(resp IdempotentResponse) (IdempotentResponse, bool) {
+	if existing, ok := x[resp.ID]; ok {
+		return existing, false
+	}
+	x[resp.ID] = resp
+	return resp, true
+}
+
+func (x idempotentSet) prune(before time.Time) int {
+	n := 0
+	for id, resp := range x {
+		if resp.CreatedAt.Before(before) {
+			delete(x, id)
+			n++
+		}
+	}
+	return n
+}
+
+// operationSet holds operations by ID.
+type operationSet map[string]Operation
+
+func (o operationSet) prune(before time.Time) int {
+	n := 0
+	for id, op := range o {
+		if op.UpdatedAt.Before(before) {
+			delete(o, id)
+			n++
+		}
+	}
+	return n
+}
+
+// eventLog is an in-memory event log, kept in sequence order.
+type eventLog struct {
+	events []Event
+	last   int64
+}
+
+func (l *eventLog) append(ev Event) Event {
+	l.last++
+	ev.Seq = l.last
+	l.events = append(l.events, ev)
+	return ev
+}
+
+// load replaces the log with events, which are in sequence order.
+func (l *eventLog) load(events []Event) {
+	l.events = events
+	if n := len(events); n > 0 {
+		l.last = events[n-1].Seq
+	}
+}
+
+func (l *eventLog) after(since int64, limit int) []Event {
+	i := sort.Search(len(l.events), func(i int) bool { return l.events[i].Seq > since })
+	end := len(l.events)
+	if limit > 0 && i+limit < end {
+		end = i + limit
+	}
+	return append([]Event(nil), l.events[i:end]...)
+}
+
+func (l *eventLog) first() int64 {
+	if len(l.events) == 0 {
+		return 0
+	}
+	return l.events[0].Seq
+}
+
+func (l *eventLog) prune(before time.Time) int {
+	i := sort.Search(len(l.events), func(i int) bool { return !l.events[i].At.Before(before) })
+	l.events = append([]Event(nil), l.events[i:]...)
+	return i
+}
+
+// FileStore keeps the registry in a single JSON file, rewritten on every
+// change. It suits single-replica deployments with a persistent volume.
+// Webhook subscriptions, operations, the operation journal, reservations,
+// billing cases, contacts and the event log are kept in files next to it;
+// see sidePath.
+type FileStore struct {
+	path string
+
+	mu         sync.Mutex
+	records    map[string]Record
+	webhooks   map[string]Webhook
+	operations operationSet
+	idempotent idempotentSet
+	journal    journalSet
+	reserved   reservationSet
+	billing    billingSet
+	leases     leaseSet // Not saved; see AcquireLease
+	contacts   map[string]Contact
+	orgs       map[string]Organization
+	events     eventLog
+}
+
+// NewFileStore opens the JSON file at path, which need not exist yet.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, records: make(map[string]Record), webhooks: make(map[string]Webhook), operations: operationSet{}, idempotent: idempotentSet{}, journal: journalSet{}, reserved: reservationSet{}, billing: billingSet{}, leases: leaseSet{}, contacts: make(map[string]Contact), orgs: make(map[string]Organization)}
+	if err := jsonfile.Load(path, &s.records); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", path, err)
+	}
+	if err := jsonfile.Load(s.sidePath("webhooks", ""), &s.webhooks); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("webhooks", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("operations", ""), &s.operations); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("operations", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("idempotency", ""), &s.idempotent); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("idempotency", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("journal", ""), &s.journal); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("journal", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("reservations", ""), &s.reserved); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("reservations", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("billing", ""), &s.billing); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("billing", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("contacts", ""), &s.contacts); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("contacts", ""), err)
+	}
+	if err := jsonfile.Load(s.sidePath("orgs", ""), &s.orgs); err != nil {
+		return nil, fmt.Errorf("loading %s: %v", s.sidePath("orgs", ""), err)
+	}
+	events, err := readEvents(s.sidePath("events", ".jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	s.events.load(events)
+	return s, nil
+}
+
+// sidePath returns the path of a file kept next to the registry file: its
+// name with "."+kind before the extension, which ext replaces when set. For
+// registry.json these are registry.webhooks.json, registry.operations.json,
+// registry.idempotency.json, registry.journal.json,
+// registry.reservations.json, registry.billing.json,
+// registry.contacts.json and registry.events.jsonl.
+func (s *FileStore) sidePath(kind, ext string) string {
+	base := filepath.Ext(s.path)
+	if ext == "" {
+		ext = base
+	}
+	return strings.TrimSuffix(s.path, base) + "." + kind + ext
+}
+
+func (s *FileStore) Load() ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Record, 0, len(s.records))
+	for _, rec := range s.records {
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func (s *FileStore) Put(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[rec.InstanceName] = rec
+	return jsonfile.Save(s.path, s.records)
+}
+
+func (s *FileStore) Delete(instanceName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[instanceName]; !ok {
+		return nil
+	}
+	delete(s.records, instanceName)
+	return jsonfile.Save(s.path, s.records)
+}
+
+func (s *FileStore) LoadWebhooks() ([]Webhook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Webhook, 0, len(s.webhooks))
+	for _, w := range s.webhooks {
+		out = append(out, w)
+	}
+	return out, nil
+}
+
+func (s *FileStore) PutWebhook(w Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.webhooks[w.ID] = w
+	return jsonfile.Save(s.sidePath("webhooks", ""), s.webhooks)
+}
+
+func (s *FileStore) DeleteWebhook(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.webhooks, id)
+	return jsonfile.Save(s.sidePath("webhooks", ""), s.webhooks)
+}
+
+func (s *FileStore) PutOperation(op Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations[op.ID] = op
+	return jsonfile.Save(s.sidePath("operations", ""), s.operations)
+}
+
+func (s *FileStore) Operation(id string) (Operation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.operations[id]
+	return op, ok, nil
+}
+
+func (s *FileStore) PruneOperations(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.operations.prune(before)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, jsonfile.Save(s.sidePath("operations", ""), s.operations)
+}
+
+func (s *FileStore) ClaimIdempotencyKey(resp IdempotentResponse) (IdempotentResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, claimed := s.idempotent.claim(resp)
+	if !claimed {
+		return existing, false, nil
+	}
+	return existing, true, jsonfile.Save(s.sidePath("idempotency", ""), s.idempotent)
+}
+
+func (s *FileStore) PutIdempotentResponse(resp IdempotentResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idempotent[resp.ID] = resp
+	return jsonfile.Save(s.sidePath("idempotency", ""), s.idempotent)
+}
+
+func (s *FileStore) DeleteIdempotencyKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.idempotent, id)
+	return jsonfile.Save(s.sidePath("idempotency", ""), s.idempotent)
+}
+
+func (s *FileStore) PruneIdempotencyKeys(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.idempotent.prune(before)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, jsonfile.Save(s.sidePath("idempotency", ""), s.idempotent)
+}
+
+func (s *FileStore) PutJournalEntry(e JournalEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journal[e.ID] = e
+	return jsonfile.Save(s.sidePath("journal", ""), s.journal)
+}
+
+func (s *FileStore) DeleteJournalEntry(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.journal[id]; !ok {
+		return nil
+	}
+	delete(s.journal, id)
+	return jsonfile.Save(s.sidePath("journal", ""), s.journal)
+}
+
+func (s *FileStore) JournalEntries() ([]JournalEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.journal.list(), nil
+}
+
+func (s *FileStore) ClaimReservation(res Reservation, now time.Time) (Reservation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, held, dropped := s.reserved.claim(res, now)
+	if held {
+		if dropped == 0 {
+			return existing, false, nil
+		}
+		return existing, false, jsonfile.Save(s.sidePath("reservations", ""), s.reserved)
+	}
+	return res, true, jsonfile.Save(s.sidePath("reservations", ""), s.reserved)
+}
+
+func (s *FileStore) Reservation(id string) (Reservation, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.reserved[id]
+	return res, ok, nil
+}
+
+func (s *FileStore) Reservations() ([]Reservation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reserved.list(), nil
+}
+
+func (s *FileStore) DeleteReservation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reserved[id]; !ok {
+		return nil
+	}
+	delete(s.reserved, id)
+	return jsonfile.Save(s.sidePath("reservations", ""), s.reserved)
+}
+
+func (s *FileStore) PruneReservations(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.reserved.prune(before)
+	if n == 0 {
+		return 0, nil
+	}
+	return n, jsonfile.Save(s.sidePath("reservations", ""), s.reserved)
+}
+
+func (s *FileStore) AddBillingCase(c BillingCase) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.billing.add(c) {
+		return false, nil
+	}
+	return true, jsonfile.Save(s.sidePath("billing", ""), s.billing)
+}
+
+func (s *FileStore) UpdateBillingCase(prev, c BillingCase) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.billing.update(prev, c) {
+		return false, nil
+	}
+	return true, jsonfile.Save(s.sidePath("billing", ""), s.billing)
+}
+
+func (s *FileStore) DeleteBillingCase(tenantID, event string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := billingKey(tenantID, event)
+	if _, ok := s.billing[key]; !ok {
+		return nil
+	}
+	delete(s.billing, key)
+	return jsonfile.Save(s.sidePath("billing", ""), s.billing)
+}
+
+func (s *FileStore) BillingCases() ([]BillingCase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.billing.list(), nil
+}
+
+// AcquireLease keeps leases in memory: the file store serves one replica,
+// which holds every lease.
+func (s *FileStore) AcquireLease(name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leases.acquire(name, holder, now, ttl), nil
+}
+
+func (s *FileStore) PutContact(c Contact) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.contacts[c.TenantID] = c
+	return jsonfile.Save(s.sidePath("contacts", ""), s.contacts)
+}
+
+func (s *FileStore) Contact(tenantID string) (Contact, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.contacts[tenantID]
+	return c, ok, nil
+}
+
+func (s *FileStore) DeleteContact(tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.contacts[tenantID]; !ok {
+		return nil
+	}
+	delete(s.contacts, tenantID)
+	return jsonfile.Save(s.sidePath("contacts", ""), s.contacts)
+}
+
+func (s *FileStore) PutOrganization(o Organization) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.orgs[o.ID] = o
+	return jsonfile.Save(s.sidePath("orgs", ""), s.orgs)
+}
+
+func (s *FileStore) Organizations() ([]Organization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return orgList(s.orgs), nil
+}
+
+func (s *FileStore) DeleteOrganization(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.orgs[id]; !ok {
+		return nil
+	}
+	delete(s.orgs, id)
+	return jsonfile.Save(s.sidePath("orgs", ""), s.orgs)
+}
+
+// AppendEvent appends ev to the event log file as one JSON line.
+func (s *FileStore) AppendEvent(ev Event) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev.Seq = s.events.last + 1
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(s.sidePath("events", ".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	return s.events.append(ev).Seq, nil
+}
+
+func (s *FileStore) Events(since int64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.after(since, limit), nil
+}
+
+func (s *FileStore) FirstEventSeq() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events.first(), nil
+}
+
+// PruneEvents rewrites the event log file without the pruned events.
+func (s *FileStore) PruneEvents(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.events
+	n := kept.prune(before)
+	if n == 0 {
+		return 0, nil
+	}
+	if err := writeEvents(s.sidePath("events", ".jsonl"), kept.events); err != nil {
+		return 0, err
+	}
+	s.events = kept
+	return n, nil
+}
+
+// readEvents reads a JSON-lines event log; a missing file is an empty log.
+func readEvents(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []Event
+	dec := json.NewDecoder(f)
+	for {
+		var ev Event
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+		events = append(events, ev)
+	}
+}
+
+// writeEvents replaces the event log at path atomically.
+func writeEvents(path string, events []Event) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(tmp)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Close() error { return nil }
+
+// StoreConfig selects and locates a registry store.
+type StoreConfig struct {
+	Kind        string // "memory", "file", "sqlite" or "postgres"; see OpenStore
+	Path        string // JSON file or SQLite database
+	DatabaseURL string // Postgres URL
+
+	// AutoMigrate applies pending schema migrations of the SQL stores when
+	// they are opened. Without it, a SQL store with pending migrations is
+	// refused until they are applied with the migrate command.
+	AutoMigrate bool
+}
+
+// OpenStore opens the store cfg names. An empty Kind means "file" when Path
+// is set and "memory" otherwise.
+func OpenStore(cfg StoreConfig) (Store, error) {
+	switch cfg.Kind {
+	case "", "memory", "file":
+		if cfg.Kind == "file" && cfg.Path == "" {
+			return nil, fmt.Errorf("the file registry store needs REGISTRY_PATH")
+		}
+		if cfg.Path == "" || cfg.Kind == "memory" {
+			log.Printf("registry: keeping the registry in memory only")
+			return NewMemoryStore(), nil
+		}
+		return NewFileStore(cfg.Path)
+	}
+	s, err := OpenSQLStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.prepareSchema(cfg.AutoMigrate); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenSQLStore opens the SQL store cfg names, "sqlite" or "postgres", without
+// touching its schema.
+func OpenSQLStore(cfg StoreConfig) (*SQLStore, error) {
+	switch cfg.Kind {
+	case "sqlite":
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("the sqlite registry store needs REGISTRY_PATH")
+		}
+		return NewSQLiteStore(cfg.Path)
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			return nil, fmt.Errorf("the postgres registry store needs REGISTRY_DATABASE_URL")
+		}
+		return NewPostgresStore(cfg.DatabaseURL)
+	case "", "memory", "file":
+		return nil, fmt.Errorf("the %s registry store has no schema", cfg.Kind)
+	}
+	return nil, fmt.Errorf("unknown registry store %q: must be memory, file, sqlite or postgres", cfg.Kind)
+}
@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStores returns a fresh store of each kind that runs without a server.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	dir := t.TempDir()
+	file, err := NewFileStore(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	sqlite, err := NewSQLiteStore(filepath.Join(dir, "registry.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	if _, err := sqlite.MigrateUp(0); err != nil {
+		t.Fatalf("MigrateUp: %v", err)
+	}
+	return map[string]Store{
+		"memory": NewMemoryStore(),
+		"file":   file,
+		"sqlite": sqlite,
+	}
+}
+
+func TestClaimReservation(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	res := func(id, tenantID string, expires time.Time) Reservation {
+		return Reservation{ID: id, TenantID: tenantID, CreatedAt: now.Add(-time.Hour), ExpiresAt: expires}
+	}
+	tests := []struct {
+		name        string
+		held        []Reservation
+		claim       Reservation
+		wantClaimed bool
+		wantID      string // Of the reservation returned
+		wantKept    []string
+	}{
+		{"no reservation", nil, res("r2", "a", now.Add(time.Hour)), true, "r2", []string{"r2"}},
+		{"held by the tenant", []Reservation{res("r1", "a", now.Add(time.Minute))}, res("r2", "a", now.Add(time.Hour)), false, "r1", []string{"r1"}},
+		{"expired reservation", []Reservation{res("r1", "a", now)}, res("r2", "a", now.Add(time.Hour)), true, "r2", []string{"r2"}},
+		{"held by another tenant", []Reservation{res("r1", "b", now.Add(time.Minute))}, res("r2", "a", now.Add(time.Hour)), true, "r2", []string{"r1", "r2"}},
+	}
+	for _, tt := range tests {
+		for kind, s := range testStores(t) {
+			t.Run(tt.name+"/"+kind, func(t *testing.T) {
+				for _, h := range tt.held {
+					if _, claimed, err := s.ClaimReservation(h, h.CreatedAt); err != nil || !claimed {
+						t.Fatalf("claiming %s: %v, %v", h.ID, claimed, err)
+					}
+				}
+				got, claimed, err := s.ClaimReservation(tt.claim, now)
+				if err != nil {
+					t.Fatalf("ClaimReservation: %v", err)
+				}
+				if claimed != tt.wantClaimed || got.ID != tt.wantID {
+					t.Errorf("got %s, claimed %v; want %s, claimed %v", got.ID, claimed, tt.wantID, tt.wantClaimed)
+				}
+				all, err := s.Reservations()
+				if err != nil {
+					t.Fatalf("Reservations: %v", err)
+				}
+				kept := make([]string, len(all))
+				for i, r := range all {
+					kept[i] = r.ID
+				}
+				sort.Strings(kept)
+				if strings.Join(kept, ",") != strings.Join(tt.wantKept, ",") {
+					t.Errorf("kept %v, want %v", kept, tt.wantKept)
+				}
+			})
+		}
+	}
+}
+
+func TestBillingCaseUpdates(t *testing.T) {
+	opened := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := BillingCase{TenantID: "a", Event: "payment_failed", EventID: "evt_1", OpenedAt: opened}
+	warned := c
+	warned.Actions = []BillingAction{{Action: "warn", At: opened.Add(time.Hour)}}
+	suspended := warned
+	suspended.Actions = append(append([]BillingAction(nil), warned.Actions...), BillingAction{Action: "suspend", At: opened.Add(2 * time.Hour)})
+
+	for kind, s := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			steps := []struct {
+				name string
+				do   func() (bool, error)
+				want bool
+			}{
+				{"open", func() (bool, error) { return s.AddBillingCase(c) }, true},
+				{"open again", func() (bool, error) { return s.AddBillingCase(c) }, false},
+				{"claim warn", func() (bool, error) { return s.UpdateBillingCase(c, warned) }, true},
+				{"claim warn from a stale copy", func() (bool, error) { return s.UpdateBillingCase(c, warned) }, false},
+				{"claim suspend", func() (bool, error) { return s.UpdateBillingCase(warned, suspended) }, true},
+			}
+			for _, step := range steps {
+				got, err := step.do()
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if got != step.want {
+					t.Fatalf("%s: stored %v, want %v", step.name, got, step.want)
+				}
+			}
+			cases, err := s.BillingCases()
+			if err != nil {
+				t.Fatalf("BillingCases: %v", err)
+			}
+			if len(cases) != 1 || !cases[0].same(suspended) {
+				t.Errorf("BillingCases() = %+v, want only %+v", cases, suspended)
+			}
+		})
+	}
+}
+
+func TestAcquireLease(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	ttl := time.Minute
+	for kind, s := range testStores(t) {
+		t.Run(kind, func(t *testing.T) {
+			steps := []struct {
+				name   string
+				holder string
+				at     time.Time
+				want   bool
+			}{
+				{"free", "a", now, true},
+				{"held by another", "b", now.Add(30 * time.Second), false},
+				{"renewed by its holder", "a", now.Add(50 * time.Second), true},
+				{"still held after renewal", "b", now.Add(90 * time.Second), false},
+				{"expired", "b", now.Add(50*time.Second + ttl), true},
+				{"lost by the old holder", "a", now.Add(2 * ttl), false},
+			}
+			for _, step := range steps {
+				got, err := s.AcquireLease("billing-policy", step.holder, step.at, ttl)
+				if err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				if got != step.want {
+					t.Fatalf("%s: acquired %v, want %v", step.name, got, step.want)
+				}
+			}
+		})
+	}
+}
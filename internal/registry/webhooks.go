@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Webhook is a subscription to outbound event deliveries; see package
+// webhooks.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`           // Signs every delivery
+	Events    []string  `json:"events,omitempty"` // Event filter; every event when empty
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Webhooks returns every webhook subscription, oldest first.
+func (r *Registry) Webhooks() []Webhook {
+	r.mu.Lock()
+	out := make([]Webhook, 0, len(r.webhooks))
+	for _, w := range r.webhooks {
+		out = append(out, w)
+	}
+	r.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+// Webhook returns the subscription with the given ID.
+func (r *Registry) Webhook(id string) (Webhook, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.webhooks[id]
+	return w, ok
+}
+
+// PutWebhook creates or replaces a subscription. Unlike instance records,
+// it is only kept if the store accepts it.
+func (r *Registry) PutWebhook(w Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.store.PutWebhook(w); err != nil {
+		return fmt.Errorf("saving webhook %s: %v", w.ID, err)
+	}
+	r.webhooks[w.ID] = w
+	return nil
+}
+
+// DeleteWebhook removes a subscription. It reports whether it existed.
+func (r *Registry) DeleteWebhook(id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return false, nil
+	}
+	if err := r.store.DeleteWebhook(id); err != nil {
+		return true, fmt.Errorf("deleting webhook %s: %v", id, err)
+	}
+	delete(r.webhooks, id)
+	return true, nil
+}
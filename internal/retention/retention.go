@@ -0,0 +1,49 @@
+// Package retention removes volumes and snapshots kept after an instance was
+// deleted once their retention period has ended.
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// Janitor periodically deletes expired retained storage.
+type Janitor struct {
+	mgr k8s.InstanceManager
+}
+
+// New returns a janitor for the storage retained by mgr.
+func New(mgr k8s.InstanceManager) *Janitor {
+	return &Janitor{mgr: mgr}
+}
+
+// Sweep deletes the retained storage whose retention has ended and returns
+// what was deleted.
+func (j *Janitor) Sweep(ctx context.Context) ([]k8s.RetainedArtifact, error) {
+	expired, err := j.mgr.ExpireRetainedStorage(ctx)
+	for _, a := range expired {
+		log.Printf("retention: deleted %s %s of tenant %s, retained until %s",
+			a.Kind, a.Name, a.TenantID, a.Until.Format(time.RFC3339))
+	}
+	return expired, err
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := j.Sweep(ctx); err != nil {
+			log.Printf("retention: sweep failed: %v", err)
+		}
+	}
+}
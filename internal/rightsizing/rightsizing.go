@@ -0,0 +1,401 @@
+// Package rightsizing samples each instance's resource usage over time and
+// recommends resource requests, and plan moves, that fit what the instance
+// actually uses. Recommendations can be applied by an operator or, when
+// enabled, automatically.
+package rightsizing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	minHours      = 24             // Hours of history needed before recommending
+	minChange     = 0.25           // Smallest relative change worth making
+	applyCooldown = 24 * time.Hour // Minimum time between automatic changes to one instance
+
+	cpuStep     = 10       // Millicores
+	memoryStep  = 16 << 20 // Bytes
+	minCPU      = 10       // Millicores
+	minMemory   = 64 << 20 // Bytes
+	cpuQuantile = 0.95
+)
+
+// Actions reported in a Recommendation.
+const (
+	ActionNone             = "none"
+	ActionResize           = "resize"
+	ActionInsufficientData = "insufficient-data"
+)
+
+// ErrNothingToApply is returned by Apply when the tenant has no resize
+// recommendation.
+var ErrNothingToApply = fmt.Errorf("no resize is recommended")
+
+// Config tunes recommendations.
+type Config struct {
+	Window    time.Duration // Usage history considered
+	Headroom  float64       // Fraction added above observed usage, e.g. 0.3
+	AutoApply bool          // Apply resize recommendations without an operator
+}
+
+// Bucket is the peak usage of an instance during one hour: CPU in
+// millicores and memory in bytes, totalled over its containers.
+type Bucket struct {
+	Hour   time.Time `json:"hour"`
+	CPU    int64     `json:"cpu"`
+	Memory int64     `json:"memory"`
+}
+
+// sizing is a resource's request and limit as set in an instance spec.
+type sizing struct {
+	Request int64 `json:"request"`
+	Limit   int64 `json:"limit,omitempty"`
+}
+
+// history is what is kept per instance.
+type history struct {
+	TenantID  string     `json:"tenant_id"`
+	Plan      string     `json:"plan,omitempty"`
+	CPU       sizing     `json:"cpu"`
+	Memory    sizing     `json:"memory"`
+	Buckets   []Bucket   `json:"buckets"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Resource is the recommendation for one resource. CPU is in millicores and
+// memory in bytes.
+type Resource struct {
+	Request     int64   `json:"request"`
+	Limit       int64   `json:"limit,omitempty"`
+	Observed    int64   `json:"observed"` // 95th percentile of hourly peaks for CPU, highest peak for memory
+	Recommended int64   `json:"recommended"`
+	Change      float64 `json:"change"` // (Recommended - Request) / Request
+}
+
+// Recommendation is the right-sizing advice for one instance.
+type Recommendation struct {
+	TenantID      string   `json:"tenant_id"`
+	Instance      string   `json:"instance"`
+	Plan          string   `json:"plan,omitempty"`
+	HoursObserved int      `json:"hours_observed"`
+	Action        string   `json:"action"` // "none", "resize" or "insufficient-data"
+	CPU           Resource `json:"cpu"`
+	Memory        Resource `json:"memory"`
+
+	// SuggestedProfile is the smallest provisioning profile that fits the
+	// recommended requests, when its plan differs from the instance's.
+	SuggestedProfile string `json:"suggested_profile,omitempty"`
+	SuggestedPlan    string `json:"suggested_plan,omitempty"`
+
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // Last time a resize was applied
+}
+
+// Advisor samples usage and produces recommendations.
+type Advisor struct {
+	cfg      Config
+	mgr      k8s.InstanceManager
+	profiles map[string]*k8s.Profile
+	path     string
+
+	mu        sync.Mutex
+	instances map[string]*history // by instance name
+}
+
+// New creates an Advisor, loading usage history from path when it is set.
+func New(cfg Config, mgr k8s.InstanceManager, profiles map[string]*k8s.Profile, path string) (*Advisor, error) {
+	a := &Advisor{cfg: cfg, mgr: mgr, profiles: profiles, path: path, instances: make(map[string]*history)}
+	if path != "" {
+		if err := jsonfile.Load(path, &a.instances); err != nil {
+			return nil, fmt.Errorf("loading right-sizing history: %v", err)
+		}
+	}
+	return a, nil
+}
+
+// HandleInstanceEvent forgets deleted instances; pass it to OnInstanceEvent.
+func (a *Advisor) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.Type != k8s.InstanceDeleted || ev.Info == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.instances[ev.Info.Name]; ok {
+		delete(a.instances, ev.Info.Name)
+		a.save()
+	}
+}
+
+// Run samples every interval until ctx is cancelled, applying resize
+// recommendations afterwards when AutoApply is set.
+func (a *Advisor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := a.Sample(ctx); err != nil {
+			log.Printf("rightsizing: %v", err)
+			continue
+		}
+		if a.cfg.AutoApply {
+			a.applyAll(ctx)
+		}
+	}
+}
+
+// Sample records the current usage of every running instance.
+func (a *Advisor) Sample(ctx context.Context) error {
+	instances, err := a.mgr.ListInstances(ctx)
+	if err != nil {
+		return fmt.Errorf("listing instances: %v", err)
+	}
+	now := time.Now().UTC()
+	hour := now.Truncate(time.Hour)
+	for _, inst := range instances {
+		if inst.Info == nil || inst.Info.Status != "running" {
+			continue
+		}
+		metrics, err := a.mgr.InstanceMetrics(ctx, inst.TenantID)
+		if err != nil {
+			log.Printf("rightsizing: sampling %s: %v", inst.Info.Name, err)
+			continue
+		}
+		if len(metrics.Warnings) > 0 && metrics.CPU.Usage == 0 && metrics.Memory.Usage == 0 {
+			continue // No usage data yet
+		}
+
+		a.mu.Lock()
+		h, ok := a.instances[inst.Info.Name]
+		if !ok {
+			h = &history{}
+			a.instances[inst.Info.Name] = h
+		}
+		h.TenantID = inst.TenantID
+		h.Plan = inst.Info.Plan
+		h.CPU, h.Memory = specResources(inst.Object)
+		if n := len(h.Buckets); n > 0 && h.Buckets[n-1].Hour.Equal(hour) {
+			b := &h.Buckets[n-1]
+			b.CPU = max(b.CPU, metrics.CPU.Usage)
+			b.Memory = max(b.Memory, metrics.Memory.Usage)
+		} else {
+			h.Buckets = append(h.Buckets, Bucket{Hour: hour, CPU: metrics.CPU.Usage, Memory: metrics.Memory.Usage})
+		}
+		cutoff := now.Add(-a.cfg.Window)
+		for len(h.Buckets) > 0 && h.Buckets[0].Hour.Before(cutoff) {
+			h.Buckets = h.Buckets[1:]
+		}
+		a.mu.Unlock()
+	}
+
+	a.mu.Lock()
+	a.save()
+	a.mu.Unlock()
+	return nil
+}
+
+// Recommendations returns advice for every sampled instance, ordered by
+// tenant.
+func (a *Advisor) Recommendations() []Recommendation {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]Recommendation, 0, len(a.instances))
+	for name, h := range a.instances {
+		out = append(out, a.recommend(name, h))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TenantID != out[j].TenantID {
+			return out[i].TenantID < out[j].TenantID
+		}
+		return out[i].Instance < out[j].Instance
+	})
+	return out
+}
+
+// Apply sets the recommended requests on the tenant's instance. It returns
+// ErrNothingToApply when no resize is recommended.
+func (a *Advisor) Apply(ctx context.Context, tenantID string) (*Recommendation, error) {
+	a.mu.Lock()
+	var rec *Recommendation
+	for name, h := range a.instances {
+		if h.TenantID == tenantID {
+			r := a.recommend(name, h)
+			rec = &r
+			break
+		}
+	}
+	a.mu.Unlock()
+	if rec == nil || rec.Action != ActionResize {
+		return nil, ErrNothingToApply
+	}
+
+	cpu := resource.NewMilliQuantity(rec.CPU.Recommended, resource.DecimalSI).String()
+	memory := resource.NewQuantity(rec.Memory.Recommended, resource.BinarySI).String()
+	if err := a.mgr.SetResourceRequests(ctx, tenantID, cpu, memory); err != nil {
+		return nil, err
+	}
+	log.Printf("rightsizing: set requests of %s to cpu=%s memory=%s", rec.Instance, cpu, memory)
+
+	now := time.Now().UTC()
+	a.mu.Lock()
+	if h, ok := a.instances[rec.Instance]; ok {
+		h.CPU.Request = rec.CPU.Recommended
+		h.Memory.Request = rec.Memory.Recommended
+		h.AppliedAt = &now
+		a.save()
+	}
+	a.mu.Unlock()
+	rec.AppliedAt = &now
+	return rec, nil
+}
+
+// applyAll applies every resize recommendation not applied within the
+// cooldown.
+func (a *Advisor) applyAll(ctx context.Context) {
+	for _, rec := range a.Recommendations() {
+		if rec.Action != ActionResize || (rec.AppliedAt != nil && time.Since(*rec.AppliedAt) < applyCooldown) {
+			continue
+		}
+		if _, err := a.Apply(ctx, rec.TenantID); err != nil {
+			log.Printf("rightsizing: applying to %s: %v", rec.Instance, err)
+		}
+	}
+}
+
+// recommend computes the advice for one instance. Callers hold a.mu.
+func (a *Advisor) recommend(name string, h *history) Recommendation {
+	rec := Recommendation{
+		TenantID:      h.TenantID,
+		Instance:      name,
+		Plan:          h.Plan,
+		HoursObserved: len(h.Buckets),
+		Action:        ActionNone,
+		AppliedAt:     h.AppliedAt,
+		CPU:           Resource{Request: h.CPU.Request, Limit: h.CPU.Limit},
+		Memory:        Resource{Request: h.Memory.Request, Limit: h.Memory.Limit},
+	}
+	if len(h.Buckets) < minHours {
+		rec.Action = ActionInsufficientData
+		rec.CPU.Recommended, rec.Memory.Recommended = h.CPU.Request, h.Memory.Request
+		return rec
+	}
+
+	cpus := make([]int64, len(h.Buckets))
+	for i, b := range h.Buckets {
+		cpus[i] = b.CPU
+		rec.Memory.Observed = max(rec.Memory.Observed, b.Memory)
+	}
+	rec.CPU.Observed = quantile(cpus, cpuQuantile)
+
+	resize := false
+	for _, r := range []struct {
+		res       *Resource
+		step, min int64
+	}{{&rec.CPU, cpuStep, minCPU}, {&rec.Memory, memoryStep, minMemory}} {
+		want := roundUp(int64(float64(r.res.Observed)*(1+a.cfg.Headroom)), r.step)
+		want = max(want, r.min)
+		if r.res.Limit > 0 {
+			want = min(want, r.res.Limit)
+		}
+		r.res.Recommended = r.res.Request
+		if r.res.Request == 0 {
+			continue
+		}
+		change := float64(want-r.res.Request) / float64(r.res.Request)
+		if math.Abs(change) >= minChange {
+			r.res.Recommended = want
+			r.res.Change = math.Round(change*1000) / 1000
+			resize = true
+		}
+	}
+	if resize {
+		rec.Action = ActionResize
+	}
+	rec.SuggestedProfile, rec.SuggestedPlan = a.suggestProfile(h.Plan, rec.CPU.Recommended, rec.Memory.Recommended)
+	return rec
+}
+
+// suggestProfile returns the smallest plan-bearing profile whose requests
+// cover cpu and memory, if its plan differs from plan.
+func (a *Advisor) suggestProfile(plan string, cpu, memory int64) (string, string) {
+	var best *k8s.Profile
+	var bestCPU, bestMemory int64
+	for _, name := range k8s.ProfileNames(a.profiles) {
+		p := a.profiles[name]
+		if p.Plan == "" {
+			continue
+		}
+		pc, pm := specResources(&unstructured.Unstructured{Object: map[string]interface{}{"spec": p.Spec}})
+		if pc.Request < cpu || pm.Request < memory {
+			continue
+		}
+		if best == nil || pm.Request < bestMemory || (pm.Request == bestMemory && pc.Request < bestCPU) {
+			best, bestCPU, bestMemory = p, pc.Request, pm.Request
+		}
+	}
+	if best == nil || best.Plan == plan {
+		return "", ""
+	}
+	return best.Name, best.Plan
+}
+
+// specResources reads the CPU and memory requests and limits from an
+// instance spec.
+func specResources(obj *unstructured.Unstructured) (cpu, memory sizing) {
+	if obj == nil {
+		return
+	}
+	read := func(milli bool, fields ...string) int64 {
+		v, found, _ := unstructured.NestedString(obj.Object, append([]string{"spec", "resources"}, fields...)...)
+		if !found {
+			return 0
+		}
+		q, err := resource.ParseQuantity(v)
+		if err != nil {
+			return 0
+		}
+		if milli {
+			return q.MilliValue()
+		}
+		return q.Value()
+	}
+	cpu = sizing{Request: read(true, "requests", "cpu"), Limit: read(true, "limits", "cpu")}
+	memory = sizing{Request: read(false, "requests", "memory"), Limit: read(false, "limits", "memory")}
+	return
+}
+
+// quantile returns the q-th quantile of values by the nearest-rank method.
+func quantile(values []int64, q float64) int64 {
+	sorted := append([]int64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+// roundUp rounds n up to a multiple of step.
+func roundUp(n, step int64) int64 {
+	return (n + step - 1) / step * step
+}
+
+// save persists usage history. Callers hold a.mu.
+func (a *Advisor) save() {
+	if a.path == "" {
+		return
+	}
+	if err := jsonfile.Save(a.path, a.instances); err != nil {
+		log.Printf("rightsizing: saving: %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+// Package rollout upgrades the fleet channel by channel: canary instances
+// first, then beta, then stable, promoting to the next channel only after the
+// previous one has baked without exceeding an error-rate threshold.
+package rollout
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/workqueue"
+)
+
+// Release channels in promotion order.
+const (
+	ChannelCanary = "canary"
+	ChannelBeta   = "beta"
+	ChannelStable = "stable"
+)
+
+// Channels lists the release channels in promotion order.
+var Channels = []string{ChannelCanary, ChannelBeta, ChannelStable}
+
+// ValidChannel reports whether c names a release channel.
+func ValidChannel(c string) bool {
+	for _, ch := range Channels {
+		if c == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrActive is returned by Start while another rollout is running.
+var ErrActive = fmt.Errorf("another rollout is already running")
+
+// Stage is the progress of a rollout through one channel.
+type Stage struct {
+	Channel   string           `json:"channel"`
+	Status    string           `json:"status"` // "pending", "upgrading", "baking", "passed", "skipped" or "failed"
+	BatchID   string           `json:"batch_id,omitempty"`
+	Instances []workqueue.Item `json:"instances,omitempty"`
+	BakeUntil *time.Time       `json:"bake_until,omitempty"`
+	ErrorRate float64          `json:"error_rate"` // Highest observed during the stage
+}
+
+// Rollout is one fleet upgrade to an image tag.
+type Rollout struct {
+	ID        string    `json:"id"`
+	ImageTag  string    `json:"image_tag"`
+	Status    string    `json:"status"` // "running", "completed" or "halted"
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Stages    []Stage   `json:"stages"`
+}
+
+// Config tunes promotion.
+type Config struct {
+	BakeTime     time.Duration // How long each channel must stay healthy
+	MaxErrorRate float64       // Fraction of a channel's instances allowed in error, 0.0–1.0
+}
+
+// Manager runs rollouts, persisting their state so that a restart resumes
+// where it left off.
+type Manager struct {
+	cfg   Config
+	mgr   k8s.InstanceManager
+	queue *workqueue.Queue
+	path  string
+
+	mu       sync.Mutex
+	rollouts map[string]*Rollout
+}
+
+// New creates a Manager, loading rollouts from path when it is set.
+func New(cfg Config, mgr k8s.InstanceManager, queue *workqueue.Queue, path string) (*Manager, error) {
+	m := &Manager{cfg: cfg, mgr: mgr, queue: queue, path: path, rollouts: make(map[string]*Rollout)}
+	if path != "" {
+		if err := jsonfile.Load(path, &m.rollouts); err != nil {
+			return nil, fmt.Errorf("loading rollouts: %v", err)
+		}
+	}
+	return m, nil
+}
+
+// Start begins a rollout of imageTag. Only one rollout may run at a time.
+func (m *Manager) Start(imageTag string) (*Rollout, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.rollouts {
+		if r.Status == "running" {
+			return nil, ErrActive
+		}
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	now := time.Now().UTC()
+	r := &Rollout{
+		ID:        hex.EncodeToString(b),
+		ImageTag:  imageTag,
+		Status:    "running",
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	for _, ch := range Channels {
+		r.Stages = append(r.Stages, Stage{Channel: ch, Status: "pending"})
+	}
+	m.rollouts[r.ID] = r
+	m.save()
+	log.Printf("rollout %s: started for image tag %s", r.ID, imageTag)
+	return r.copy(), nil
+}
+
+// Halt stops a running rollout. Instances already upgraded keep the new tag.
+func (m *Manager) Halt(id, reason string) (*Rollout, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rollouts[id]
+	if !ok {
+		return nil, false
+	}
+	if r.Status == "running" {
+		m.halt(r, reason)
+	}
+	return r.copy(), true
+}
+
+// Get returns a copy of the rollout with the given ID.
+func (m *Manager) Get(id string) (*Rollout, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.rollouts[id]
+	if !ok {
+		return nil, false
+	}
+	return r.copy(), true
+}
+
+// List returns copies of every rollout, newest first.
+func (m *Manager) List() []*Rollout {
+	m.mu.Lock()
+	out := make([]*Rollout, 0, len(m.rollouts))
+	for _, r := range m.rollouts {
+		out = append(out, r.copy())
+	}
+	m.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out
+}
+
+// Run advances running rollouts every interval until ctx is cancelled.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		var running []*Rollout
+		for _, r := range m.rollouts {
+			if r.Status == "running" {
+				running = append(running, r)
+			}
+		}
+		m.mu.Unlock()
+		for _, r := range running {
+			if err := m.advance(ctx, r); err != nil {
+				log.Printf("rollout %s: %v", r.ID, err)
+			}
+		}
+	}
+}
+
+// advance moves r's current stage forward by at most one step.
+func (m *Manager) advance(ctx context.Context, r *Rollout) error {
+	// Cluster reads happen before taking the lock; the stage is re-checked
+	// afterwards in case the rollout was halted meanwhile.
+	instances, err := m.mgr.ListInstances(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if r.Status != "running" {
+		return nil
+	}
+	i := r.current()
+	if i < 0 {
+		return nil
+	}
+	st := &r.Stages[i]
+	now := time.Now().UTC()
+	r.UpdatedAt = now
+	defer m.save()
+
+	switch st.Status {
+	case "pending":
+		st.Instances = []workqueue.Item{}
+		for _, inst := range instances {
+			if channelOf(inst) == st.Channel {
+				st.Instances = append(st.Instances, workqueue.Item{TenantID: inst.TenantID, Instance: inst.Info.Name})
+			}
+		}
+		if len(st.Instances) == 0 {
+			st.Status = "skipped"
+			log.Printf("rollout %s: no %s instances, skipping", r.ID, st.Channel)
+			m.finishIfDone(r)
+			return nil
+		}
+		m.submit(r, st)
+
+	case "upgrading":
+		batch, ok := m.queue.Get(st.BatchID)
+		if !ok {
+			// The batch was lost with a restart; upgrades are idempotent.
+			m.submit(r, st)
+			return nil
+		}
+		if batch.Status != "completed" {
+			return nil
+		}
+		if rate := float64(batch.Failed) / float64(batch.Total); rate > m.cfg.MaxErrorRate {
+			st.ErrorRate = rate
+			st.Status = "failed"
+			m.halt(r, fmt.Sprintf("%d of %d %s upgrades failed", batch.Failed, batch.Total, st.Channel))
+			return nil
+		}
+		until := now.Add(m.cfg.BakeTime)
+		st.BakeUntil = &until
+		st.Status = "baking"
+		log.Printf("rollout %s: %s upgraded, baking until %s", r.ID, st.Channel, until.Format(time.RFC3339))
+
+	case "baking":
+		rate := errorRate(st.Instances, instances)
+		if rate > st.ErrorRate {
+			st.ErrorRate = rate
+		}
+		if rate > m.cfg.MaxErrorRate {
+			st.Status = "failed"
+			m.halt(r, fmt.Sprintf("%s error rate %.1f%% exceeds %.1f%%", st.Channel, rate*100, m.cfg.MaxErrorRate*100))
+			return nil
+		}
+		if now.Before(*st.BakeUntil) {
+			return nil
+		}
+		st.Status = "passed"
+		log.Printf("rollout %s: %s passed with peak error rate %.1f%%", r.ID, st.Channel, st.ErrorRate*100)
+		m.finishIfDone(r)
+	}
+	return nil
+}
+
+// submit queues the upgrade of the stage's instances. Callers hold m.mu.
+func (m *Manager) submit(r *Rollout, st *Stage) {
+	tag := r.ImageTag
+	batch := m.queue.Submit("upgrade", workqueue.PriorityBulk, st.Instances, func(ctx context.Context, it workqueue.Item) error {
+		return m.mgr.UpgradeInstance(ctx, it.TenantID, tag)
+	})
+	st.BatchID = batch.ID
+	st.Status = "upgrading"
+	log.Printf("rollout %s: upgrading %d %s instance(s) to %s (batch %s)", r.ID, len(st.Instances), st.Channel, tag, batch.ID)
+}
+
+// finishIfDone marks r completed once every stage has passed or been skipped.
+// Callers hold m.mu.
+func (m *Manager) finishIfDone(r *Rollout) {
+	if r.current() < 0 {
+		r.Status = "completed"
+		log.Printf("rollout %s: completed, %s promoted to stable", r.ID, r.ImageTag)
+	}
+}
+
+// halt stops r. Callers hold m.mu.
+func (m *Manager) halt(r *Rollout, reason string) {
+	r.Status = "halted"
+	r.Reason = reason
+	r.UpdatedAt = time.Now().UTC()
+	m.save()
+	log.Printf("rollout %s: halted: %s", r.ID, reason)
+}
+
+// current returns the index of the first unfinished stage, or -1.
+func (r *Rollout) current() int {
+	for i, st := range r.Stages {
+		if st.Status != "passed" && st.Status != "skipped" {
+			return i
+		}
+	}
+	return -1
+}
+
+// copy returns a deep copy of r.
+func (r *Rollout) copy() *Rollout {
+	c := *r
+	c.Stages = make([]Stage, len(r.Stages))
+	for i, st := range r.Stages {
+		st.Instances = append([]workqueue.Item(nil), st.Instances...)
+		c.Stages[i] = st
+	}
+	return &c
+}
+
+// save persists the rollouts. Callers hold m.mu.
+func (m *Manager) save() {
+	if m.path == "" {
+		return
+	}
+	if err := jsonfile.Save(m.path, m.rollouts); err != nil {
+		log.Printf("rollout: saving: %v", err)
+	}
+}
+
+// channelOf returns the instance's release channel; unlabelled instances are
+// stable.
+func channelOf(inst k8s.ClusterInstance) string {
+	if inst.Object != nil {
+		if ch := inst.Object.GetLabels()["channel"]; ValidChannel(ch) {
+			return ch
+		}
+	}
+	return ChannelStable
+}
+
+// errorRate returns the fraction of items whose instance is in error.
+// Instances deleted since the stage began are left out.
+func errorRate(items []workqueue.Item, instances []k8s.ClusterInstance) float64 {
+	status := make(map[string]string, len(instances))
+	for _, inst := range instances {
+		status[inst.Info.Name] = inst.Info.Status
+	}
+	total, bad := 0, 0
+	for _, it := range items {
+		s, ok := status[it.Instance]
+		if !ok {
+			continue
+		}
+		total++
+		if s == "error" {
+			bad++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total)
+}
@@ -0,0 +1,138 @@
+// Package secretscan looks for credentials in tenant-provided configuration,
+// such as env overrides, before it is written into an instance spec: the
+// orchestrator's own shared keys, which a tenant could otherwise copy into a
+// spec that outlives them, and well-known cloud credential formats. Findings
+// name the field and kind of credential, never the value.
+package secretscan
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mchatman/tenant-provisioner/internal/config"
+)
+
+// Modes of SECRET_SCAN_MODE.
+const (
+	ModeReject = "reject" // Refuse requests with findings
+	ModeFlag   = "flag"   // Accept them, logging and auditing the findings
+	ModeOff    = "off"    // Do not scan
+)
+
+// ValidMode reports whether mode is a scan mode.
+func ValidMode(mode string) bool {
+	return mode == ModeReject || mode == ModeFlag || mode == ModeOff
+}
+
+// minSharedLen is the length below which shared values are not looked for,
+// since short ones match too much by chance.
+const minSharedLen = 8
+
+// patterns are the credential formats looked for, by kind.
+var patterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"AWS access key ID", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"AWS secret access key", regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	{"GCP service account key", regexp.MustCompile(`"type"\s*:\s*"service_account"`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}\b`)},
+	{"Azure storage account key", regexp.MustCompile(`(?i)AccountKey=[A-Za-z0-9+/]{86}==`)},
+	{"Azure SAS token", regexp.MustCompile(`[?&]sig=[A-Za-z0-9%+/]{40,}`)},
+	{"private key", regexp.MustCompile(`-----BEGIN ([A-Z]+ )*PRIVATE KEY-----`)},
+	{"GitHub token", regexp.MustCompile(`\b(gh[pousr]_[A-Za-z0-9]{36}|github_pat_[A-Za-z0-9_]{82})\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+}
+
+// Finding is a credential found in a field.
+type Finding struct {
+	Field string `json:"field"` // e.g. "env.DATABASE_URL"
+	Kind  string `json:"kind"`  // e.g. "AWS access key ID" or "shared key ADMIN_API_TOKEN"
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s: %s", f.Field, f.Kind)
+}
+
+// Scanner looks for the shared values it was created with and for the
+// credential patterns.
+type Scanner struct {
+	shared map[string]string // value -> name
+}
+
+// New creates a Scanner looking for the given shared values, keyed by the
+// name they are reported as. Empty and short values are ignored.
+func New(shared map[string]string) *Scanner {
+	s := &Scanner{shared: map[string]string{}}
+	for name, value := range shared {
+		if len(value) >= minSharedLen {
+			s.shared[value] = name
+		}
+	}
+	return s
+}
+
+// SharedKeys returns the orchestrator's own secrets by variable name: the AI
+// provider keys injected into every instance and the credentials in cfg.
+func SharedKeys(cfg *config.Config) map[string]string {
+	return map[string]string{
+		"ANTHROPIC_API_KEY":         os.Getenv("ANTHROPIC_API_KEY"),
+		"OPENAI_API_KEY":            os.Getenv("OPENAI_API_KEY"),
+		"ADMIN_API_TOKEN":           cfg.AdminToken,
+		"EGRESS_PROXY_SECRET":       cfg.EgressProxySecret,
+		"IMAGE_REGISTRY_PASSWORD":   cfg.ImageRegistryPassword,
+		"SMTP_PASSWORD":             cfg.SMTPPassword,
+		"SENDGRID_API_KEY":          cfg.SendGridAPIKey,
+		"PAGERDUTY_ROUTING_KEY":     cfg.PagerDutyRoutingKey,
+		"DELETION_CERT_SIGNING_KEY": cfg.DeletionCertKey,
+		"OBJECT_STORE_SECRET_KEY":   cfg.ObjectStoreSecretKey,
+		"BILLING_WEBHOOK_SECRET":    cfg.BillingWebhookSecret,
+	}
+}
+
+// Scan returns the credentials found in the value of field.
+func (s *Scanner) Scan(field, value string) []Finding {
+	var out []Finding
+	for v, name := range s.shared {
+		if strings.Contains(value, v) {
+			out = append(out, Finding{Field: field, Kind: "shared key " + name})
+		}
+	}
+	for _, p := range patterns {
+		if p.re.MatchString(value) {
+			out = append(out, Finding{Field: field, Kind: p.kind})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kind < out[j].Kind })
+	return out
+}
+
+// ScanTree returns the credentials found in the strings of a value decoded
+// from JSON, naming fields by their dotted path under field.
+func (s *Scanner) ScanTree(field string, v interface{}) []Finding {
+	switch t := v.(type) {
+	case string:
+		return s.Scan(field, t)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var out []Finding
+		for _, k := range keys {
+			out = append(out, s.ScanTree(field+"."+k, t[k])...)
+		}
+		return out
+	case []interface{}:
+		var out []Finding
+		for i, e := range t {
+			out = append(out, s.ScanTree(fmt.Sprintf("%s[%d]", field, i), e)...)
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package status
+
+import (
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+// atomFeed and atomEntry are the subset of RFC 4287 used by the feed.
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomEntry struct {
+	ID      string `xml:"id"`
+	Title   string `xml:"title"`
+	Updated string `xml:"updated"`
+	Summary string `xml:"summary"`
+}
+
+// WriteAtom renders the summary's incidents as an Atom feed. selfURL is the
+// feed's own absolute URL.
+func (s Summary) WriteAtom(w io.Writer, selfURL string) error {
+	feed := atomFeed{
+		ID:      selfURL,
+		Title:   "OpenClaw provisioning status",
+		Updated: s.UpdatedAt.Format(time.RFC3339),
+		Link:    atomLink{Href: selfURL, Rel: "self"},
+	}
+	for _, inc := range s.Incidents {
+		title := inc.Title
+		if inc.ResolvedAt != nil {
+			title = "[Resolved] " + title
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      selfURL + "#" + inc.ID,
+			Title:   title,
+			Updated: inc.UpdatedAt.Format(time.RFC3339),
+			Summary: inc.Message,
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
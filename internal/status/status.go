@@ -0,0 +1,210 @@
+// Package status summarises fleet health for the public status page:
+// provisioning availability over a rolling window and ongoing incidents.
+package status
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// window is the period over which provisioning availability is measured.
+	window = 24 * time.Hour
+
+	// Availability below these thresholds marks the fleet degraded or down,
+	// and below degradedBelow opens an automatic incident.
+	degradedBelow = 0.99
+	outageBelow   = 0.90
+
+	// minSamples avoids declaring incidents from a handful of requests.
+	minSamples = 20
+
+	// autoIncidentID identifies the incident opened for low availability.
+	autoIncidentID = "provisioning-availability"
+)
+
+// Overall fleet states.
+const (
+	Operational = "operational"
+	Degraded    = "degraded"
+	MajorOutage = "major_outage"
+)
+
+// Incident is a publicly visible disruption.
+type Incident struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Message    string     `json:"message,omitempty"`
+	Status     string     `json:"status"` // "investigating" or "resolved"
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Summary is the sanitized document served as /status.json.
+type Summary struct {
+	Status       string       `json:"status"`
+	Provisioning Provisioning `json:"provisioning"`
+	Incidents    []Incident   `json:"incidents"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// Provisioning reports create success over the rolling window.
+type Provisioning struct {
+	Window       string   `json:"window"`
+	Availability *float64 `json:"availability"` // Null when nothing was provisioned
+	Attempts     int      `json:"attempts"`
+}
+
+// sample is one provisioning outcome.
+type sample struct {
+	at time.Time
+	ok bool
+}
+
+// Tracker collects provisioning outcomes and incidents.
+type Tracker struct {
+	mu        sync.Mutex
+	samples   []sample
+	incidents []*Incident // Newest last; resolved ones kept for the feed
+}
+
+// NewTracker creates an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// RecordProvisioning records the outcome of a create. Only failures on our
+// side should be recorded as not ok; rejected requests are not outages.
+func (t *Tracker) RecordProvisioning(ok bool) {
+	if t == nil {
+		return
+	}
+	now := time.Now().UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, sample{at: now, ok: ok})
+	t.prune(now)
+
+	availability, n := t.availability()
+	switch {
+	case n >= minSamples && availability < degradedBelow:
+		t.open(autoIncidentID, "Elevated provisioning failures",
+			"New instances are failing to provision more often than usual. Existing instances are not affected.", now)
+	case availability >= degradedBelow:
+		t.resolve(autoIncidentID, now)
+	}
+}
+
+// OpenIncident starts a new incident and returns it.
+func (t *Tracker) OpenIncident(title, message string) Incident {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+
+	now := time.Now().UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *t.open(id, title, message, now)
+}
+
+// ResolveIncident marks an open incident resolved. It reports whether an open
+// incident with that ID existed.
+func (t *Tracker) ResolveIncident(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.resolve(id, time.Now().UTC())
+}
+
+// open starts incident id unless it is already open. Callers hold t.mu.
+func (t *Tracker) open(id, title, message string, now time.Time) *Incident {
+	for _, inc := range t.incidents {
+		if inc.ID == id && inc.ResolvedAt == nil {
+			return inc
+		}
+	}
+	inc := &Incident{ID: id, Title: title, Message: message, Status: "investigating", StartedAt: now, UpdatedAt: now}
+	t.incidents = append(t.incidents, inc)
+	return inc
+}
+
+// resolve closes incident id. Callers hold t.mu.
+func (t *Tracker) resolve(id string, now time.Time) bool {
+	for _, inc := range t.incidents {
+		if inc.ID == id && inc.ResolvedAt == nil {
+			inc.Status = "resolved"
+			inc.UpdatedAt = now
+			inc.ResolvedAt = &now
+			return true
+		}
+	}
+	return false
+}
+
+// prune drops samples older than the window and resolved incidents older than
+// a week. Callers hold t.mu.
+func (t *Tracker) prune(now time.Time) {
+	i := sort.Search(len(t.samples), func(i int) bool { return now.Sub(t.samples[i].at) < window })
+	t.samples = t.samples[i:]
+
+	kept := t.incidents[:0]
+	for _, inc := range t.incidents {
+		if inc.ResolvedAt == nil || now.Sub(*inc.ResolvedAt) < 7*24*time.Hour {
+			kept = append(kept, inc)
+		}
+	}
+	t.incidents = kept
+}
+
+// availability returns the success ratio over the window and the number of
+// samples. Callers hold t.mu.
+func (t *Tracker) availability() (float64, int) {
+	if len(t.samples) == 0 {
+		return 1, 0
+	}
+	ok := 0
+	for _, s := range t.samples {
+		if s.ok {
+			ok++
+		}
+	}
+	return float64(ok) / float64(len(t.samples)), len(t.samples)
+}
+
+// Summary returns the current public status.
+func (t *Tracker) Summary() Summary {
+	now := time.Now().UTC()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune(now)
+
+	availability, n := t.availability()
+	sum := Summary{
+		Status:       Operational,
+		Provisioning: Provisioning{Window: "24h", Attempts: n},
+		Incidents:    []Incident{},
+		UpdatedAt:    now,
+	}
+	if n > 0 {
+		a := float64(int64(availability*10000)) / 10000
+		sum.Provisioning.Availability = &a
+	}
+
+	for i := len(t.incidents) - 1; i >= 0; i-- {
+		inc := t.incidents[i]
+		sum.Incidents = append(sum.Incidents, *inc)
+		if inc.ResolvedAt == nil {
+			sum.Status = Degraded
+		}
+		if inc.UpdatedAt.After(sum.UpdatedAt) {
+			sum.UpdatedAt = inc.UpdatedAt
+		}
+	}
+	if n >= minSamples && availability < outageBelow {
+		sum.Status = MajorOutage
+	}
+	return sum
+}
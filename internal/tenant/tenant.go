@@ -0,0 +1,94 @@
+// Package tenant defines the tenant identity shared by the API and the
+// Kubernetes backend: parsing, validation and the canonical form of tenant
+// IDs. Tenant IDs are label values on every object a tenant owns and are
+// matched by label selectors, so they are lowercased before use; an ID given
+// as "ORG_ABC123" and one given as "org_abc123" name the same tenant.
+package tenant
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ID is a validated tenant ID in canonical form. Obtain one with Parse.
+type ID string
+
+// String returns the ID.
+func (id ID) String() string { return string(id) }
+
+// Validator decides which tenant IDs the service accepts. The default
+// accepts UUIDs; deployments whose billing system uses other IDs, such as
+// "org_abc123", configure a pattern with TENANT_ID_PATTERN or install their
+// own validator with SetValidator at startup.
+type Validator interface {
+	// Validate returns an error describing the expected format when id,
+	// already in canonical form, is not a valid tenant ID, e.g. "must be a
+	// valid UUID".
+	Validate(id string) error
+}
+
+// uuidPattern matches a UUID in canonical, lowercase form.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// PatternValidator accepts tenant IDs matching a regular expression.
+type PatternValidator struct {
+	re   *regexp.Regexp
+	want string // How the format is described in errors
+}
+
+// NewPatternValidator compiles pattern, which is anchored at both ends, into
+// a validator. It is matched against the canonical, lowercase ID.
+func NewPatternValidator(pattern string) (*PatternValidator, error) {
+	re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenant ID pattern %q: %v", pattern, err)
+	}
+	return &PatternValidator{re: re, want: "must match " + pattern}, nil
+}
+
+// Validate implements Validator.
+func (v *PatternValidator) Validate(id string) error {
+	if !v.re.MatchString(id) {
+		return fmt.Errorf("%s", v.want)
+	}
+	return nil
+}
+
+var (
+	mu        sync.RWMutex
+	validator Validator = &PatternValidator{re: uuidPattern, want: "must be a valid UUID"}
+)
+
+// SetValidator replaces the tenant ID validator. It is meant to be called
+// once at startup, before requests are served.
+func SetValidator(v Validator) {
+	mu.Lock()
+	validator = v
+	mu.Unlock()
+}
+
+// Canonical returns the canonical form of a tenant ID, without validating
+// it. Label selectors and lookups by tenant use it.
+func Canonical(s string) string {
+	return strings.ToLower(s)
+}
+
+// Parse canonicalizes s and checks it against the configured validator.
+// Whatever the validator allows must also be a valid label value.
+func Parse(s string) (ID, error) {
+	id := Canonical(s)
+	mu.RLock()
+	v := validator
+	mu.RUnlock()
+	if err := v.Validate(id); err != nil {
+		return "", err
+	}
+	if errs := validation.IsValidLabelValue(id); id == "" || len(errs) > 0 {
+		return "", fmt.Errorf("must be a valid label value: at most 63 alphanumeric characters, '-', '_' or '.'")
+	}
+	return ID(id), nil
+}
@@ -0,0 +1,86 @@
+// Package tenantauth authenticates tenants by the gateway token of their
+// instance, which the customer dashboard already holds. Tokens are indexed
+// from the instance watch, so a rotated token stops working as soon as the
+// change is observed.
+package tenantauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// Index maps gateway tokens to the tenant instances they belong to. Only
+// token digests are kept.
+type Index struct {
+	mu         sync.RWMutex
+	owners     map[[sha256.Size]byte]Owner  // token digest -> instance
+	byInstance map[string][sha256.Size]byte // instance name -> token digest
+}
+
+// Owner is the tenant instance a token belongs to.
+type Owner struct {
+	TenantID string
+	Instance string
+}
+
+// NewIndex creates an empty Index.
+func NewIndex() *Index {
+	return &Index{
+		owners:     make(map[[sha256.Size]byte]Owner),
+		byInstance: make(map[string][sha256.Size]byte),
+	}
+}
+
+// HandleInstanceEvent keeps the index in step with the cluster; pass it to
+// OnInstanceEvent.
+func (x *Index) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.TenantID == "" || ev.Info == nil {
+		return
+	}
+	name := ev.Info.Name
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if old, ok := x.byInstance[name]; ok {
+		delete(x.owners, old)
+		delete(x.byInstance, name)
+	}
+	if ev.Type == k8s.InstanceDeleted {
+		return
+	}
+	// Instances whose token is kept in a Secret carry only its digest.
+	var digest [sha256.Size]byte
+	if n, err := hex.Decode(digest[:], []byte(ev.Info.GatewayTokenDigest)); err != nil || n != sha256.Size {
+		return
+	}
+	x.owners[digest] = Owner{TenantID: ev.TenantID, Instance: name}
+	x.byInstance[name] = digest
+}
+
+// Lookup returns the tenant instance that uses token.
+func (x *Index) Lookup(token string) (Owner, bool) {
+	if token == "" {
+		return Owner{}, false
+	}
+	digest := sha256.Sum256([]byte(token))
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	owner, ok := x.owners[digest]
+	return owner, ok
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the authenticated tenant.
+func NewContext(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext returns the authenticated tenant stored in ctx, or "".
+func FromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(contextKey{}).(string)
+	return tenantID
+}
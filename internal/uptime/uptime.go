@@ -0,0 +1,207 @@
+// Package uptime records instance status transitions and computes uptime and
+// downtime windows from them for SLA reporting.
+package uptime
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/healthcheck"
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+)
+
+// retention is how much history is kept; it bounds the longest window.
+const retention = 30 * 24 * time.Hour
+
+// Windows are the periods reported by Report.
+var Windows = []time.Duration{24 * time.Hour, 7 * 24 * time.Hour, 30 * 24 * time.Hour}
+
+// Transition is a change of an instance's status.
+type Transition struct {
+	At     time.Time `json:"at"`
+	Status string    `json:"status"` // "starting", "running", "degraded", "suspended", "error" or "deleted"
+}
+
+// History keeps transitions per instance, optionally persisted to a file.
+type History struct {
+	path string
+
+	mu        sync.Mutex
+	instances map[string][]Transition // By instance name, oldest first
+	degraded  map[string]bool         // Instances failing health checks, by name
+}
+
+// NewHistory loads the history at path, or starts an empty in-memory one when
+// path is empty.
+func NewHistory(path string) (*History, error) {
+	h := &History{path: path, instances: make(map[string][]Transition), degraded: make(map[string]bool)}
+	if path != "" {
+		if err := jsonfile.Load(path, &h.instances); err != nil {
+			return nil, fmt.Errorf("loading uptime history: %v", err)
+		}
+	}
+	return h, nil
+}
+
+// HandleInstanceEvent records status changes; pass it to OnInstanceEvent.
+func (h *History) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.Info == nil {
+		return
+	}
+	status := ev.Info.Status
+	h.mu.Lock()
+	switch {
+	case ev.Type == k8s.InstanceDeleted:
+		status = "deleted"
+		delete(h.degraded, ev.Info.Name)
+	case status == "running" && h.degraded[ev.Info.Name]:
+		status = "degraded"
+	}
+	h.mu.Unlock()
+	h.record(ev.Info.Name, status, time.Now().UTC())
+}
+
+// HandleHealthChange records a running instance as "degraded" while it fails
+// its health checks, which counts as downtime; pass it to the prober's
+// OnChange.
+func (h *History) HandleHealthChange(c healthcheck.Change) {
+	h.mu.Lock()
+	ts := h.instances[c.Instance]
+	last := ""
+	if n := len(ts); n > 0 {
+		last = ts[n-1].Status
+	}
+	if c.Degraded {
+		h.degraded[c.Instance] = true
+	} else {
+		delete(h.degraded, c.Instance)
+	}
+	h.mu.Unlock()
+
+	switch {
+	case c.Degraded && last == "running":
+		h.record(c.Instance, "degraded", time.Now().UTC())
+	case !c.Degraded && last == "degraded":
+		h.record(c.Instance, "running", time.Now().UTC())
+	}
+}
+
+// record appends a transition if status differs from the last one.
+func (h *History) record(name, status string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ts := h.instances[name]
+	if n := len(ts); n > 0 && ts[n-1].Status == status {
+		return
+	}
+	ts = append(ts, Transition{At: at, Status: status})
+
+	// Drop history older than retention, keeping the transition in force at
+	// the cutoff so that the longest window starts in a known state.
+	cutoff := at.Add(-retention)
+	i := 0
+	for i+1 < len(ts) && ts[i+1].At.Before(cutoff) {
+		i++
+	}
+	ts = ts[i:]
+	if status == "deleted" && ts[0].At.Before(cutoff) {
+		delete(h.instances, name)
+	} else {
+		h.instances[name] = ts
+	}
+
+	if h.path != "" {
+		if err := jsonfile.Save(h.path, h.instances); err != nil {
+			log.Printf("uptime: saving history: %v", err)
+		}
+	}
+}
+
+// Downtime is a period during which the instance was not running.
+type Downtime struct {
+	Start  time.Time  `json:"start"`
+	End    *time.Time `json:"end,omitempty"` // Nil while ongoing
+	Status string     `json:"status"`
+}
+
+// WindowReport is the uptime of an instance over one window.
+type WindowReport struct {
+	Window          string     `json:"window"`
+	UptimePercent   *float64   `json:"uptime_percent"` // Nil when nothing was observed
+	DowntimeSeconds int64      `json:"downtime_seconds"`
+	Downtime        []Downtime `json:"downtime"`
+}
+
+// Report computes uptime for each of Windows ending at now. Time before the
+// instance first reached running is provisioning, not downtime, and is left
+// out of the measured period.
+func (h *History) Report(name string, now time.Time) []WindowReport {
+	h.mu.Lock()
+	ts := append([]Transition(nil), h.instances[name]...)
+	h.mu.Unlock()
+
+	// Measurement starts when the instance was first running.
+	first := -1
+	for i, t := range ts {
+		if t.Status == "running" {
+			first = i
+			break
+		}
+	}
+
+	reports := make([]WindowReport, 0, len(Windows))
+	for _, w := range Windows {
+		r := WindowReport{Window: formatWindow(w), Downtime: []Downtime{}}
+		if first < 0 {
+			reports = append(reports, r)
+			continue
+		}
+		from := now.Add(-w)
+		var observed, down time.Duration
+		for i := first; i < len(ts); i++ {
+			start := ts[i].At
+			end := now
+			if i+1 < len(ts) {
+				end = ts[i+1].At
+			}
+			if ts[i].Status == "deleted" {
+				break
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if !end.After(start) {
+				continue
+			}
+			observed += end.Sub(start)
+			if ts[i].Status != "running" {
+				down += end.Sub(start)
+				d := Downtime{Start: start, Status: ts[i].Status}
+				if i+1 < len(ts) {
+					e := end
+					d.End = &e
+				}
+				r.Downtime = append(r.Downtime, d)
+			}
+		}
+		if observed > 0 {
+			pct := float64(int64((1-float64(down)/float64(observed))*1000000)) / 10000
+			r.UptimePercent = &pct
+		}
+		r.DowntimeSeconds = int64(down.Seconds())
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+// formatWindow renders a window as "24h", "7d" or "30d".
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 && d > 24*time.Hour {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return fmt.Sprintf("%dh", d/time.Hour)
+}
@@ -0,0 +1,118 @@
+package usage
+
+import (
+	"time"
+)
+
+// AIUsage is a tenant's AI provider usage in one calendar month, as reported
+// by its instances or the egress proxy. WarnedAt and ExceededAt record when
+// the month's budget warning and overrun were acted on, so that each happens
+// once.
+type AIUsage struct {
+	TenantID     string     `json:"tenant_id"`
+	Month        string     `json:"month"` // "2006-01"
+	InputTokens  int64      `json:"input_tokens"`
+	OutputTokens int64      `json:"output_tokens"`
+	Requests     int64      `json:"requests"`
+	WarnedAt     *time.Time `json:"warned_at,omitempty"`
+	ExceededAt   *time.Time `json:"exceeded_at,omitempty"`
+}
+
+// Tokens returns the input and output tokens together.
+func (u AIUsage) Tokens() int64 { return u.InputTokens + u.OutputTokens }
+
+// RecordAI adds AI usage reported at the given time to the tenant's month and
+// returns the month's totals.
+func (l *Ledger) RecordAI(tenantID string, at time.Time, inputTokens, outputTokens, requests int64) AIUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.aiUsage(tenantID, at.UTC().Format("2006-01"), true)
+	u.InputTokens += inputTokens
+	u.OutputTokens += outputTokens
+	u.Requests += requests
+	l.save()
+	return *u
+}
+
+// AI returns the tenant's AI usage in the month of at.
+func (l *Ledger) AI(tenantID string, at time.Time) AIUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	month := at.UTC().Format("2006-01")
+	if u := l.aiUsage(tenantID, month, false); u != nil {
+		return *u
+	}
+	return AIUsage{TenantID: tenantID, Month: month}
+}
+
+// AIMonth returns the AI usage of every tenant with some in the month of at.
+func (l *Ledger) AIMonth(at time.Time) []AIUsage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	month := at.UTC().Format("2006-01")
+	out := []AIUsage{}
+	for _, u := range l.data.AI {
+		if u.Month == month {
+			out = append(out, *u)
+		}
+	}
+	return out
+}
+
+// MarkAIWarned records that the tenant was warned about its budget in the
+// month of at, and reports whether it had not been already.
+func (l *Ledger) MarkAIWarned(tenantID string, at time.Time) bool {
+	return l.markAI(tenantID, at, func(u *AIUsage) **time.Time { return &u.WarnedAt })
+}
+
+// MarkAIExceeded records that the tenant's budget overrun in the month of at
+// was acted on, and reports whether it had not been already.
+func (l *Ledger) MarkAIExceeded(tenantID string, at time.Time) bool {
+	return l.markAI(tenantID, at, func(u *AIUsage) **time.Time { return &u.ExceededAt })
+}
+
+// markAI sets the timestamp field of the tenant's month returned by field,
+// unless it is set.
+func (l *Ledger) markAI(tenantID string, at time.Time, field func(*AIUsage) **time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.aiUsage(tenantID, at.UTC().Format("2006-01"), true)
+	f := field(u)
+	if *f != nil {
+		return false
+	}
+	t := at.UTC()
+	*f = &t
+	l.save()
+	return true
+}
+
+// Plan returns the plan of the tenant's most recent instance.
+func (l *Ledger) Plan(tenantID string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var plan string
+	var latest time.Time
+	for _, iv := range l.data.Intervals {
+		if iv.TenantID == tenantID && !iv.Start.Before(latest) {
+			latest, plan = iv.Start, iv.Plan
+		}
+	}
+	return plan
+}
+
+// aiUsage returns the tenant's entry for month, adding it if create is set.
+// Callers hold l.mu.
+func (l *Ledger) aiUsage(tenantID, month string, create bool) *AIUsage {
+	for _, u := range l.data.AI {
+		if u.TenantID == tenantID && u.Month == month {
+			return u
+		}
+	}
+	if !create {
+		return nil
+	}
+	u := &AIUsage{TenantID: tenantID, Month: month}
+	l.data.AI = append(l.data.AI, u)
+	return u
+}
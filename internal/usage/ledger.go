@@ -0,0 +1,175 @@
+// Package usage keeps a ledger of billable tenant activity — instance
+// lifetimes, snapshots and AI provider usage — and aggregates it into
+// monthly reports.
+package usage
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/jsonfile"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Interval is the lifetime of one instance. End is zero while it is running.
+type Interval struct {
+	TenantID     string    `json:"tenant_id"`
+	InstanceName string    `json:"instance_name"`
+	Plan         string    `json:"plan,omitempty"`
+	StorageBytes int64     `json:"storage_bytes"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end,omitempty"`
+}
+
+// Snapshot records one volume snapshot taken for a tenant.
+type Snapshot struct {
+	TenantID string    `json:"tenant_id"`
+	Time     time.Time `json:"time"`
+}
+
+// ledgerFile is the on-disk form of a Ledger.
+type ledgerFile struct {
+	Intervals []*Interval `json:"intervals"`
+	Snapshots []Snapshot  `json:"snapshots"`
+	AI        []*AIUsage  `json:"ai,omitempty"`
+}
+
+// Ledger records usage in memory and, when given a path, persists it as JSON
+// after every change so that history survives restarts.
+type Ledger struct {
+	path string
+
+	mu     sync.Mutex
+	data   ledgerFile
+	open   map[string]*Interval // Running intervals by instance name
+	seen   map[string]bool      // Instances observed since startup
+	synced bool
+}
+
+// NewLedger loads the ledger at path, or starts an empty in-memory one when
+// path is empty.
+func NewLedger(path string) (*Ledger, error) {
+	l := &Ledger{path: path, open: make(map[string]*Interval), seen: make(map[string]bool)}
+	if path == "" {
+		return l, nil
+	}
+	if err := jsonfile.Load(path, &l.data); err != nil {
+		return nil, fmt.Errorf("loading usage ledger: %v", err)
+	}
+	for _, iv := range l.data.Intervals {
+		if iv.End.IsZero() {
+			l.open[iv.InstanceName] = iv
+		}
+	}
+	return l, nil
+}
+
+// Start opens an interval for an instance unless one is already open. start
+// is the instance's creation time, so replayed watch events are harmless.
+func (l *Ledger) Start(tenantID, instanceName, plan string, storageBytes int64, start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.open[instanceName]; ok {
+		return
+	}
+	iv := &Interval{
+		TenantID:     tenantID,
+		InstanceName: instanceName,
+		Plan:         plan,
+		StorageBytes: storageBytes,
+		Start:        start.UTC(),
+	}
+	l.data.Intervals = append(l.data.Intervals, iv)
+	l.open[instanceName] = iv
+	l.save()
+}
+
+// Stop closes the open interval of an instance, if any.
+func (l *Ledger) Stop(instanceName string, end time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	iv, ok := l.open[instanceName]
+	if !ok {
+		return
+	}
+	iv.End = end.UTC()
+	delete(l.open, instanceName)
+	l.save()
+}
+
+// HandleInstanceEvent keeps the ledger in step with the instance watch; pass
+// it to OnInstanceEvent.
+func (l *Ledger) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if ev.Type == k8s.InstanceSynced {
+		l.closeUnseen(time.Now())
+		return
+	}
+	if ev.Info == nil {
+		return
+	}
+	switch ev.Type {
+	case k8s.InstanceAdded, k8s.InstanceUpdated:
+		var storage int64
+		if q, err := resource.ParseQuantity(ev.Info.Storage); err == nil {
+			storage = q.Value()
+		}
+		start := ev.Info.CreatedAt
+		if start.IsZero() {
+			start = time.Now()
+		}
+		l.mu.Lock()
+		if !l.synced {
+			l.seen[ev.Info.Name] = true
+		}
+		l.mu.Unlock()
+		l.Start(ev.TenantID, ev.Info.Name, ev.Info.Plan, storage, start)
+	case k8s.InstanceDeleted:
+		l.Stop(ev.Info.Name, time.Now())
+	}
+}
+
+// closeUnseen ends, at the time of the first sync, intervals left open by a
+// previous run for instances that no longer exist.
+func (l *Ledger) closeUnseen(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.synced {
+		return
+	}
+	l.synced = true
+	closed := false
+	for name, iv := range l.open {
+		if !l.seen[name] {
+			iv.End = now.UTC()
+			delete(l.open, name)
+			closed = true
+		}
+	}
+	l.seen = nil
+	if closed {
+		l.save()
+	}
+}
+
+// RecordSnapshot counts a snapshot taken for tenantID.
+func (l *Ledger) RecordSnapshot(tenantID string, at time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data.Snapshots = append(l.data.Snapshots, Snapshot{TenantID: tenantID, Time: at.UTC()})
+	l.save()
+}
+
+// save writes the ledger atomically. Failures are logged, not returned: usage
+// recording must never fail the operation being recorded. Callers hold l.mu.
+func (l *Ledger) save() {
+	if l.path == "" {
+		return
+	}
+	if err := jsonfile.Save(l.path, l.data); err != nil {
+		log.Printf("usage: saving ledger: %v", err)
+	}
+}
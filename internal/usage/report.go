@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TenantUsage is one tenant's billable usage for a month.
+type TenantUsage struct {
+	TenantID        string  `json:"tenant_id"`
+	Plan            string  `json:"plan,omitempty"` // Plan of the most recent instance
+	InstanceHours   float64 `json:"instance_hours"`
+	StorageGiBHours float64 `json:"storage_gib_hours"`
+	Snapshots       int     `json:"snapshots"`
+	AITokens        int64   `json:"ai_tokens"`
+	AIRequests      int64   `json:"ai_requests"`
+}
+
+// Report is the usage of every tenant active in a calendar month.
+type Report struct {
+	Month       string        `json:"month"` // "2006-01"
+	GeneratedAt time.Time     `json:"generated_at"`
+	Partial     bool          `json:"partial"` // The month has not ended yet
+	Tenants     []TenantUsage `json:"tenants"`
+}
+
+// Report aggregates usage for the calendar month (UTC) starting at month.
+// Running instances are counted up to now.
+func (l *Ledger) Report(month time.Time, now time.Time) *Report {
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	report := &Report{
+		Month:       from.Format("2006-01"),
+		GeneratedAt: now.UTC(),
+		Partial:     now.Before(to),
+		Tenants:     []TenantUsage{},
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byTenant := map[string]*TenantUsage{}
+	latest := map[string]time.Time{}
+	tenant := func(id string) *TenantUsage {
+		t, ok := byTenant[id]
+		if !ok {
+			t = &TenantUsage{TenantID: id}
+			byTenant[id] = t
+		}
+		return t
+	}
+
+	for _, iv := range l.data.Intervals {
+		end := iv.End
+		if end.IsZero() {
+			end = now
+		}
+		start, stop := iv.Start, end
+		if start.Before(from) {
+			start = from
+		}
+		if stop.After(to) {
+			stop = to
+		}
+		if !stop.After(start) {
+			continue
+		}
+		hours := stop.Sub(start).Hours()
+		t := tenant(iv.TenantID)
+		t.InstanceHours += hours
+		t.StorageGiBHours += hours * float64(iv.StorageBytes) / (1 << 30)
+		if !iv.Start.Before(latest[iv.TenantID]) {
+			latest[iv.TenantID] = iv.Start
+			t.Plan = iv.Plan
+		}
+	}
+	for _, s := range l.data.Snapshots {
+		if !s.Time.Before(from) && s.Time.Before(to) {
+			tenant(s.TenantID).Snapshots++
+		}
+	}
+
+	for _, u := range l.data.AI {
+		if u.Month == report.Month {
+			t := tenant(u.TenantID)
+			t.AITokens += u.Tokens()
+			t.AIRequests += u.Requests
+		}
+	}
+
+	for _, t := range byTenant {
+		t.InstanceHours = round2(t.InstanceHours)
+		t.StorageGiBHours = round2(t.StorageGiBHours)
+		report.Tenants = append(report.Tenants, *t)
+	}
+	sortTenants(report.Tenants)
+	return report
+}
+
+// sortTenants orders usage by tenant ID.
+func sortTenants(tenants []TenantUsage) {
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].TenantID < tenants[j].TenantID
+	})
+}
+
+// WriteCSV writes the report's rows with a header line.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "tenant_id", "plan", "instance_hours", "storage_gib_hours", "snapshots", "ai_tokens", "ai_requests"})
+	for _, t := range r.Tenants {
+		cw.Write([]string{
+			r.Month,
+			t.TenantID,
+			t.Plan,
+			strconv.FormatFloat(t.InstanceHours, 'f', 2, 64),
+			strconv.FormatFloat(t.StorageGiBHours, 'f', 2, 64),
+			strconv.Itoa(t.Snapshots),
+			strconv.FormatInt(t.AITokens, 10),
+			strconv.FormatInt(t.AIRequests, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func round2(f float64) float64 {
+	return float64(int64(f*100+0.5)) / 100
+}
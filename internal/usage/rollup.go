@@ -0,0 +1,97 @@
+package usage
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Totals is usage summed over tenants.
+type Totals struct {
+	InstanceHours   float64 `json:"instance_hours"`
+	StorageGiBHours float64 `json:"storage_gib_hours"`
+	Snapshots       int     `json:"snapshots"`
+	AITokens        int64   `json:"ai_tokens"`
+	AIRequests      int64   `json:"ai_requests"`
+}
+
+// Rollup is the usage of a group of tenants, such as an organization's,
+// for one billing period: a line per tenant and their totals.
+type Rollup struct {
+	Month       string        `json:"month"`        // "2006-01"
+	PeriodStart time.Time     `json:"period_start"` // Inclusive
+	PeriodEnd   time.Time     `json:"period_end"`   // Exclusive
+	GeneratedAt time.Time     `json:"generated_at"`
+	Partial     bool          `json:"partial"` // The period has not ended yet
+	Lines       []TenantUsage `json:"lines"`   // By tenant ID
+	Totals      Totals        `json:"totals"`
+}
+
+// Rollup returns the report's usage of the tenants, with a zero line for
+// tenants that used nothing in the month.
+func (r *Report) Rollup(tenantIDs []string) *Rollup {
+	start, _ := time.Parse("2006-01", r.Month)
+	rollup := &Rollup{
+		Month:       r.Month,
+		PeriodStart: start,
+		PeriodEnd:   start.AddDate(0, 1, 0),
+		GeneratedAt: r.GeneratedAt,
+		Partial:     r.Partial,
+		Lines:       []TenantUsage{},
+	}
+	want := make(map[string]bool, len(tenantIDs))
+	for _, id := range tenantIDs {
+		want[id] = true
+	}
+	seen := make(map[string]bool, len(tenantIDs))
+	for _, t := range r.Tenants {
+		if want[t.TenantID] {
+			rollup.Lines = append(rollup.Lines, t)
+			seen[t.TenantID] = true
+		}
+	}
+	for _, id := range tenantIDs {
+		if !seen[id] {
+			rollup.Lines = append(rollup.Lines, TenantUsage{TenantID: id})
+			seen[id] = true
+		}
+	}
+	sortTenants(rollup.Lines)
+
+	for _, t := range rollup.Lines {
+		rollup.Totals.InstanceHours += t.InstanceHours
+		rollup.Totals.StorageGiBHours += t.StorageGiBHours
+		rollup.Totals.Snapshots += t.Snapshots
+		rollup.Totals.AITokens += t.AITokens
+		rollup.Totals.AIRequests += t.AIRequests
+	}
+	rollup.Totals.InstanceHours = round2(rollup.Totals.InstanceHours)
+	rollup.Totals.StorageGiBHours = round2(rollup.Totals.StorageGiBHours)
+	return rollup
+}
+
+// WriteCSV writes the rollup's lines with a header line, then a "total"
+// line.
+func (r *Rollup) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"month", "tenant_id", "plan", "instance_hours", "storage_gib_hours", "snapshots", "ai_tokens", "ai_requests"})
+	row := func(tenant, plan string, t Totals) {
+		cw.Write([]string{
+			r.Month,
+			tenant,
+			plan,
+			strconv.FormatFloat(t.InstanceHours, 'f', 2, 64),
+			strconv.FormatFloat(t.StorageGiBHours, 'f', 2, 64),
+			strconv.Itoa(t.Snapshots),
+			strconv.FormatInt(t.AITokens, 10),
+			strconv.FormatInt(t.AIRequests, 10),
+		})
+	}
+	for _, t := range r.Lines {
+		row(t.TenantID, t.Plan, Totals{t.InstanceHours, t.StorageGiBHours, t.Snapshots, t.AITokens, t.AIRequests})
+	}
+	row("total", "", r.Totals)
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,154 @@
+package webhooks
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// Payload formats of delivered and replayed events.
+const (
+	FormatCloudEvents = "cloudevents" // CloudEvents 1.0 structured mode
+	FormatLegacy      = "legacy"      // The flat registry.Event
+)
+
+// cloudEventTypePrefix namespaces CloudEvents types. Types are the event name
+// under this prefix with the schema version of their data appended, e.g.
+// "ai.wareit.instance.created.v1". A change to the data that breaks consumers
+// gets a new version rather than a changed schema.
+const cloudEventTypePrefix = "ai.wareit."
+
+// eventSchemaVersion is the schema version of InstanceData.
+const eventSchemaVersion = "v1"
+
+// CloudEvent is a lifecycle event in the CloudEvents 1.0 JSON envelope.
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"` // The instance name
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	// Sequence is the event's position in the event log, zero-padded so
+	// that it orders as a string, as the sequence extension requires.
+	Sequence string       `json:"sequence,omitempty"`
+	Data     InstanceData `json:"data"`
+}
+
+// InstanceData is the data of a CloudEvent.
+type InstanceData struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Message  string `json:"message,omitempty"`
+	// CorrelationID is that of the API request behind the event, if any.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// ContactEmails are the emails of the tenant's contact, if it has one,
+	// for notification integrations, and Description describes the event to
+	// the tenant in the contact's locale.
+	ContactEmails []string `json:"contact_emails,omitempty"`
+	Description   string   `json:"description,omitempty"`
+}
+
+// CloudEventType returns the CloudEvents type of an event name.
+func CloudEventType(event string) string {
+	return cloudEventTypePrefix + event + "." + eventSchemaVersion
+}
+
+// ValidFormat reports whether f is a payload format.
+func ValidFormat(f string) bool {
+	return f == FormatCloudEvents || f == FormatLegacy
+}
+
+// Envelope returns ev as it is delivered, with the tenant's contact emails
+// and a description of the event: a CloudEvent or, in the legacy format, ev
+// itself.
+func (d *Dispatcher) Envelope(ev registry.Event) any {
+	if d == nil {
+		return ev
+	}
+	c := d.contact(ev.TenantID)
+	ev.ContactEmails = c.Emails
+	ev.Description = d.describe(ev, c.Locale)
+	if d.cfg.Format == FormatLegacy {
+		return ev
+	}
+	ce := CloudEvent{
+		SpecVersion:     "1.0",
+		ID:              ev.ID,
+		Source:          d.cfg.Source,
+		Type:            CloudEventType(ev.Type),
+		Subject:         ev.Instance,
+		Time:            ev.At,
+		DataContentType: "application/json",
+		Data: InstanceData{
+			TenantID: ev.TenantID,
+			Instance: ev.Instance,
+			Endpoint: ev.Endpoint,
+			Status:   ev.Status,
+			Message:  ev.Message,
+
+			CorrelationID: ev.CorrelationID,
+			ContactEmails: ev.ContactEmails,
+			Description:   ev.Description,
+		},
+	}
+	if ev.Seq > 0 {
+		ce.Sequence = fmt.Sprintf("%020d", ev.Seq)
+	}
+	return ce
+}
+
+// contact returns the tenant's contact, or the zero Contact if it has none.
+func (d *Dispatcher) contact(tenantID string) registry.Contact {
+	if tenantID == "" {
+		return registry.Contact{}
+	}
+	c, _, err := d.reg.Contact(tenantID)
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+	return c
+}
+
+// describe renders the description of ev in the locale tag, or returns ""
+// when no template describes its type.
+func (d *Dispatcher) describe(ev registry.Event, tag string) string {
+	if d.cfg.Descriptions == nil {
+		return ""
+	}
+	var b strings.Builder
+	if err := d.cfg.Descriptions.Execute(&b, tag, "events", ev.Type, ev); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(b.String())
+}
+
+//go:embed descriptions
+var descriptionFS embed.FS
+
+// Descriptions returns the built-in event descriptions, one directory per
+// locale holding events.tmpl, with a template per event type, for
+// locale.Load.
+func Descriptions() fs.FS {
+	sub, err := fs.Sub(descriptionFS, "descriptions")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// contentType returns the Content-Type of a delivery.
+func (d *Dispatcher) contentType() string {
+	if d.cfg.Format == FormatLegacy {
+		return "application/json"
+	}
+	return "application/cloudevents+json; charset=utf-8"
+}
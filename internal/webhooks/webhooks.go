@@ -0,0 +1,387 @@
+// Package webhooks records instance lifecycle events in the registry's event
+// log and delivers them to the HTTP endpoints subscribed through the admin
+// API, as CloudEvents 1.0 unless the legacy format is configured.
+// Subscriptions are kept in the registry; recent deliveries are kept in memory
+// for inspection.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mchatman/tenant-provisioner/internal/correlation"
+	"github.com/mchatman/tenant-provisioner/internal/k8s"
+	"github.com/mchatman/tenant-provisioner/internal/locale"
+	"github.com/mchatman/tenant-provisioner/internal/registry"
+)
+
+// Events a subscription can filter on.
+const (
+	EventInstanceCreated   = "instance.created"
+	EventInstanceRunning   = "instance.running"
+	EventInstanceFailed    = "instance.failed"
+	EventInstanceSuspended = "instance.suspended"
+	EventInstanceDeleted   = "instance.deleted"
+	EventAIBudgetWarning   = "ai_budget.warning"  // Sent by PublishTenantEvent
+	EventAIBudgetExceeded  = "ai_budget.exceeded" // Sent by PublishTenantEvent
+	EventBillingWarning    = "billing.warning"    // Sent by PublishTenantEvent
+	EventBillingSuspended  = "billing.suspended"  // Sent by PublishTenantEvent
+	EventBillingDeleted    = "billing.deleted"    // Sent by PublishTenantEvent
+	EventBillingResolved   = "billing.resolved"   // Sent by PublishTenantEvent
+	EventTest              = "webhook.test"       // Only sent by Test
+)
+
+// Events lists every event, in lifecycle order.
+var Events = []string{
+	EventInstanceCreated, EventInstanceRunning, EventInstanceFailed,
+	EventInstanceSuspended, EventInstanceDeleted,
+	EventAIBudgetWarning, EventAIBudgetExceeded,
+	EventBillingWarning, EventBillingSuspended, EventBillingDeleted, EventBillingResolved,
+	EventTest,
+}
+
+// ValidFilter reports whether f names an event, or a family of them such as
+// "instance.*".
+func ValidFilter(f string) bool {
+	for _, ev := range Events {
+		if matches(f, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether filter f selects event ev.
+func matches(f, ev string) bool {
+	if prefix, ok := strings.CutSuffix(f, ".*"); ok {
+		return strings.HasPrefix(ev, prefix+".")
+	}
+	return f == ev
+}
+
+// subscribed reports whether w receives ev. Test deliveries are sent
+// whatever the filter.
+func subscribed(w registry.Webhook, ev string) bool {
+	if ev == EventTest || len(w.Events) == 0 {
+		return true
+	}
+	for _, f := range w.Events {
+		if matches(f, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery is one attempt to deliver an event to a subscription.
+type Delivery struct {
+	EventID    string        `json:"event_id"`
+	Event      string        `json:"event"`
+	Attempt    int           `json:"attempt"`
+	At         time.Time     `json:"at"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration_ns"`
+	Succeeded  bool          `json:"succeeded"`
+}
+
+// Config tunes deliveries.
+type Config struct {
+	Timeout     time.Duration // Per attempt
+	MaxAttempts int           // Attempts per event and subscription, with exponential backoff
+	LogSize     int           // Deliveries kept per subscription
+	Format      string        // FormatCloudEvents or FormatLegacy
+	Source      string        // CloudEvents source attribute
+
+	// Descriptions renders the description of each event type, usually
+	// loaded from Descriptions; nil leaves deliveries without one.
+	Descriptions *locale.Catalog
+}
+
+// Dispatcher turns instance events into deliveries. A nil *Dispatcher is
+// valid and delivers nothing.
+type Dispatcher struct {
+	reg    *registry.Registry
+	cfg    Config
+	client *http.Client
+
+	mu         sync.Mutex
+	synced     bool              // Past the watch's initial list
+	lastStatus map[string]string // Instance status, to announce transitions once
+	log        map[string][]Delivery
+}
+
+// New creates a Dispatcher delivering to the subscriptions in reg.
+func New(reg *registry.Registry, cfg Config) *Dispatcher {
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	return &Dispatcher{
+		reg:        reg,
+		cfg:        cfg,
+		client:     &http.Client{Timeout: cfg.Timeout},
+		lastStatus: make(map[string]string),
+		log:        make(map[string][]Delivery),
+	}
+}
+
+// HandleInstanceEvent logs lifecycle transitions to the registry's event
+// log and publishes them; pass it to OnInstanceEvent. Instances listed when
+// the watch starts are not announced as created, and a status is only
+// announced when it changes.
+func (d *Dispatcher) HandleInstanceEvent(ev k8s.InstanceEvent) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if ev.Type == k8s.InstanceSynced {
+		d.synced = true
+		return
+	}
+	if ev.Info == nil {
+		return
+	}
+	name := ev.Info.Name
+	prev, known := d.lastStatus[name]
+	var types []string
+	switch ev.Type {
+	case k8s.InstanceAdded, k8s.InstanceUpdated:
+		d.lastStatus[name] = ev.Info.Status
+		if !known && d.synced && ev.Type == k8s.InstanceAdded {
+			types = append(types, EventInstanceCreated)
+		}
+		if known && prev != ev.Info.Status {
+			switch ev.Info.Status {
+			case "running":
+				types = append(types, EventInstanceRunning)
+			case "error":
+				types = append(types, EventInstanceFailed)
+			case "suspended":
+				types = append(types, EventInstanceSuspended)
+			}
+		}
+	case k8s.InstanceDeleted:
+		delete(d.lastStatus, name)
+		types = append(types, EventInstanceDeleted)
+	}
+	for _, t := range types {
+		event, err := d.reg.AppendEvent(newEvent(t, ev))
+		if err != nil {
+			log.Printf("webhooks: %v", err)
+		}
+		d.publish(event)
+		if t == EventInstanceCreated {
+			d.journalCreated(name)
+		}
+	}
+}
+
+// AnnounceCreated logs and publishes instance.created for an instance whose
+// create was resumed after a restart, which the instance watch, having
+// listed it at startup, does not announce.
+func (d *Dispatcher) AnnounceCreated(tenantID string, info *k8s.InstanceInfo) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, known := d.lastStatus[info.Name]; !known {
+		d.lastStatus[info.Name] = info.Status
+	}
+	event, err := d.reg.AppendEvent(newEvent(EventInstanceCreated, k8s.InstanceEvent{TenantID: tenantID, Info: info}))
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+	d.publish(event)
+	d.journalCreated(info.Name)
+}
+
+// journalCreated completes the journaled create of the named instance, now
+// that it has been announced.
+func (d *Dispatcher) journalCreated(instanceName string) {
+	if err := d.reg.JournalInstanceStep(instanceName, registry.StepWebhookSent); err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+}
+
+// newEvent builds the delivery body of an instance event. Its correlation
+// ID is that of the API request that last changed the instance.
+func newEvent(eventType string, ev k8s.InstanceEvent) registry.Event {
+	return registry.Event{
+		ID:            NewID(),
+		Type:          eventType,
+		At:            time.Now().UTC(),
+		TenantID:      ev.TenantID,
+		Instance:      ev.Info.Name,
+		Endpoint:      ev.Info.Endpoint,
+		Status:        ev.Info.Status,
+		Message:       ev.Info.Message,
+		CorrelationID: k8s.CorrelationID(ev.Object),
+	}
+}
+
+// PublishTenantEvent logs an event about a tenant rather than one of its
+// instances, such as a budget warning, and publishes it.
+func (d *Dispatcher) PublishTenantEvent(eventType, tenantID, message string) {
+	if d == nil {
+		return
+	}
+	event, err := d.reg.AppendEvent(registry.Event{
+		ID:       NewID(),
+		Type:     eventType,
+		At:       time.Now().UTC(),
+		TenantID: tenantID,
+		Message:  message,
+	})
+	if err != nil {
+		log.Printf("webhooks: %v", err)
+	}
+	d.publish(event)
+}
+
+// publish delivers event to every enabled subscription that selects it, in
+// the background.
+func (d *Dispatcher) publish(event registry.Event) {
+	for _, w := range d.reg.Webhooks() {
+		if w.Enabled && subscribed(w, event.Type) {
+			go d.deliver(w, event)
+		}
+	}
+}
+
+// Test delivers a webhook.test event to the subscription once, whether or
+// not it is enabled, and returns the attempt. The event carries the
+// correlation ID of the request in ctx.
+func (d *Dispatcher) Test(ctx context.Context, w registry.Webhook) Delivery {
+	event := registry.Event{
+		ID:            NewID(),
+		Type:          EventTest,
+		At:            time.Now().UTC(),
+		Message:       "test delivery",
+		CorrelationID: correlation.FromContext(ctx),
+	}
+	return d.attempt(ctx, w, event, 1)
+}
+
+// Deliveries returns the subscription's recent deliveries, newest first.
+func (d *Dispatcher) Deliveries(id string) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entries := d.log[id]
+	out := make([]Delivery, len(entries))
+	for i, del := range entries {
+		out[len(entries)-1-i] = del
+	}
+	return out
+}
+
+// Forget drops the delivery log of a deleted subscription.
+func (d *Dispatcher) Forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.log, id)
+}
+
+// deliver attempts event up to cfg.MaxAttempts times, waiting 1s, 2s, 4s...
+// between attempts.
+func (d *Dispatcher) deliver(w registry.Webhook, event registry.Event) {
+	wait := time.Second
+	for n := 1; n <= d.cfg.MaxAttempts; n++ {
+		if n > 1 {
+			time.Sleep(wait)
+			wait *= 2
+		}
+		if d.attempt(context.Background(), w, event, n).Succeeded {
+			return
+		}
+	}
+	log.Printf("webhooks: giving up on %s to %s after %d attempt(s)", event.Type, w.ID, d.cfg.MaxAttempts)
+}
+
+// attempt posts event to w once and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, w registry.Webhook, event registry.Event, n int) Delivery {
+	start := time.Now()
+	del := Delivery{EventID: event.ID, Event: event.Type, Attempt: n, At: start.UTC()}
+	status, err := d.post(ctx, w, event)
+	del.Duration = time.Since(start)
+	del.StatusCode = status
+	if err != nil {
+		del.Error = err.Error()
+	} else {
+		del.Succeeded = true
+	}
+	d.record(w.ID, del)
+	return del
+}
+
+// post sends event to w in the configured format, signed with its secret.
+// The signature is the hex HMAC-SHA256 of "<timestamp>.<body>". The event's
+// correlation ID, if any, is sent in the X-Correlation-ID header.
+func (d *Dispatcher) post(ctx context.Context, w registry.Webhook, event registry.Event) (int, error) {
+	body, err := json.Marshal(d.Envelope(event))
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+	req.Header.Set("Content-Type", d.contentType())
+	req.Header.Set("X-Webhook-ID", w.ID)
+	req.Header.Set("X-Webhook-Event", event.Type)
+	req.Header.Set("X-Webhook-Delivery", event.ID)
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	if event.CorrelationID != "" {
+		req.Header.Set(correlation.Header, event.CorrelationID)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return resp.StatusCode, nil
+}
+
+// record appends del to the subscription's log, keeping cfg.LogSize entries.
+func (d *Dispatcher) record(id string, del Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.reg.Webhook(id); !ok {
+		return
+	}
+	entries := append(d.log[id], del)
+	if n := len(entries); d.cfg.LogSize > 0 && n > d.cfg.LogSize {
+		entries = append([]Delivery(nil), entries[n-d.cfg.LogSize:]...)
+	}
+	d.log[id] = entries
+}
+
+// NewID returns a random identifier for a subscription or an event.
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,370 @@
+// Package workqueue runs batches of per-instance operations on a bounded pool
+// of workers and tracks the progress of each batch. A batch still waiting for
+// a worker reports its position in the queue and an estimate of the wait,
+// from how long recent items of the same action took.
+//
+// Batches are submitted in a priority lane. Workers take items from the
+// highest lane first, so that paying customers' operations are not stuck
+// behind a wave of trial signups or a fleet-wide bulk job.
+package workqueue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxBatches is how many batches are kept for progress queries; the oldest
+// finished batch is forgotten first.
+const maxBatches = 100
+
+// Priority is the lane a batch is queued in. Higher priorities run first;
+// within a lane, items run in submission order.
+type Priority int
+
+// The priority lanes, lowest first.
+const (
+	PriorityBulk  Priority = iota // Admin bulk jobs, flag and image rollouts
+	PriorityTrial                 // Trial and free-plan tenants
+	PriorityPaid                  // Paying tenants
+)
+
+// String returns the name of the lane.
+func (p Priority) String() string {
+	switch p {
+	case PriorityBulk:
+		return "bulk"
+	case PriorityTrial:
+		return "trial"
+	case PriorityPaid:
+		return "paid"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the lane by name.
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Item is one unit of work in a batch.
+type Item struct {
+	TenantID string `json:"tenant_id"`
+	Instance string `json:"instance,omitempty"` // Empty for creates
+}
+
+// ItemResult is the state of one item.
+type ItemResult struct {
+	Item
+	Status string `json:"status"` // "pending", "running", "succeeded" or "failed"
+	Error  string `json:"error,omitempty"`
+}
+
+// Batch is a group of items submitted together and its progress.
+type Batch struct {
+	ID         string       `json:"id"`
+	Action     string       `json:"action"`
+	Priority   Priority     `json:"priority"`
+	Status     string       `json:"status"` // "running" or "completed"
+	Total      int          `json:"total"`
+	Succeeded  int          `json:"succeeded"`
+	Failed     int          `json:"failed"`
+	CreatedAt  time.Time    `json:"created_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Items      []ItemResult `json:"items"`
+
+	// QueuePosition is the 1-based position of the batch's next pending
+	// item among all pending items, and EstimatedWaitSeconds how long it is
+	// expected to wait for a worker. Both are 0 once every item has started;
+	// the estimate is also 0 while no item of a similar action has finished.
+	// Later batches of a higher priority move ahead of the batch.
+	QueuePosition        int `json:"queue_position,omitempty"`
+	EstimatedWaitSeconds int `json:"estimated_wait_seconds,omitempty"`
+}
+
+// task is one queued item.
+type task struct {
+	batch *Batch
+	index int
+	fn    func(context.Context, Item) error
+}
+
+// durationWeight is the weight of the latest item in the moving average of
+// item durations.
+const durationWeight = 0.2
+
+// Queue executes submitted batches with a fixed number of workers. Items from
+// different batches of the same priority are interleaved in submission
+// order, and higher priorities go first, except that no
+// tenant has more than a set number of items running at once: a worker skips
+// over the items of a tenant at its limit.
+type Queue struct {
+	workers   int
+	perTenant int
+	timeout   time.Duration
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	pending   []task                   // Highest priority first
+	running   map[string]int           // Running items by tenant ID
+	durations map[string]time.Duration // Moving average item duration by action
+	batches   map[string]*Batch
+	order     []string // Batch IDs, oldest first
+	closed    bool
+}
+
+// New creates a Queue with the given number of workers, running at most
+// perTenant items of any one tenant at once (no limit when 0). Each item runs
+// with the given timeout.
+func New(workers, perTenant int, timeout time.Duration) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		workers:   workers,
+		perTenant: max(perTenant, 0),
+		timeout:   timeout,
+		running:   make(map[string]int),
+		durations: make(map[string]time.Duration),
+		batches:   make(map[string]*Batch),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Run processes items until ctx is cancelled. Items still pending then are
+// left pending.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	<-ctx.Done()
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	wg.Wait()
+}
+
+// work runs queued items one at a time until the queue is closed.
+func (q *Queue) work(ctx context.Context) {
+	for {
+		q.mu.Lock()
+		i := q.next()
+		for i < 0 && !q.closed {
+			q.cond.Wait()
+			i = q.next()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		t := q.pending[i]
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		item := t.batch.Items[t.index].Item
+		t.batch.Items[t.index].Status = "running"
+		q.running[item.TenantID]++
+		q.mu.Unlock()
+
+		start := time.Now()
+		itemCtx, cancel := context.WithTimeout(ctx, q.timeout)
+		err := t.fn(itemCtx, item)
+		cancel()
+		took := time.Since(start)
+
+		q.mu.Lock()
+		if q.running[item.TenantID]--; q.running[item.TenantID] == 0 {
+			delete(q.running, item.TenantID)
+		}
+		if avg, ok := q.durations[t.batch.Action]; ok {
+			q.durations[t.batch.Action] = avg + time.Duration(durationWeight*float64(took-avg))
+		} else {
+			q.durations[t.batch.Action] = took
+		}
+		// Another tenant's item may have been held back for this one.
+		q.cond.Broadcast()
+		b := t.batch
+		if err != nil {
+			b.Items[t.index].Status = "failed"
+			b.Items[t.index].Error = err.Error()
+			b.Failed++
+			log.Printf("workqueue: batch %s: %s %s for tenant %s failed: %v", b.ID, b.Action, item.Instance, item.TenantID, err)
+		} else {
+			b.Items[t.index].Status = "succeeded"
+			b.Succeeded++
+		}
+		if b.Succeeded+b.Failed == b.Total {
+			now := time.Now().UTC()
+			b.Status = "completed"
+			b.FinishedAt = &now
+			log.Printf("workqueue: batch %s (%s) completed: %d succeeded, %d failed", b.ID, b.Action, b.Succeeded, b.Failed)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Submit queues fn for every item as a new batch in the priority's lane and
+// returns a snapshot of it.
+func (q *Queue) Submit(action string, priority Priority, items []Item, fn func(context.Context, Item) error) *Batch {
+	b := &Batch{
+		ID:        newBatchID(),
+		Action:    action,
+		Priority:  priority,
+		Status:    "running",
+		Total:     len(items),
+		CreatedAt: time.Now().UTC(),
+		Items:     make([]ItemResult, len(items)),
+	}
+	for i, item := range items {
+		b.Items[i] = ItemResult{Item: item, Status: "pending"}
+	}
+	if len(items) == 0 {
+		b.Status = "completed"
+		b.FinishedAt = &b.CreatedAt
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.batches[b.ID] = b
+	q.order = append(q.order, b.ID)
+	q.evict()
+	// The batch goes behind the items of its lane and of higher lanes.
+	at := len(q.pending)
+	for i, t := range q.pending {
+		if t.batch.Priority < priority {
+			at = i
+			break
+		}
+	}
+	tasks := make([]task, len(items))
+	for i := range items {
+		tasks[i] = task{batch: b, index: i, fn: fn}
+	}
+	q.pending = append(q.pending[:at], append(tasks, q.pending[at:]...)...)
+	q.cond.Broadcast()
+	return q.snapshot(b)
+}
+
+// Get returns a snapshot of the batch with the given ID.
+func (q *Queue) Get(id string) (*Batch, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	b, ok := q.batches[id]
+	if !ok {
+		return nil, false
+	}
+	return q.snapshot(b), true
+}
+
+// Depth returns how many items are waiting for a worker.
+func (q *Queue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// EstimatedWait estimates how long an item submitted now in the lowest lane
+// would wait for a worker, or 0 while no item has finished.
+func (q *Queue) EstimatedWait() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.estimateWait(len(q.pending))
+}
+
+// next returns the index of the first pending item whose tenant is below
+// its limit, or -1. Callers hold q.mu.
+func (q *Queue) next() int {
+	for i, t := range q.pending {
+		if q.perTenant == 0 || q.running[t.batch.Items[t.index].TenantID] < q.perTenant {
+			return i
+		}
+	}
+	return -1
+}
+
+// snapshot copies b with its queue position so that callers can read it
+// without holding the lock. Callers hold q.mu.
+func (q *Queue) snapshot(b *Batch) *Batch {
+	c := b.snapshot()
+	for i, t := range q.pending {
+		if t.batch == b {
+			c.QueuePosition = i + 1
+			c.EstimatedWaitSeconds = int(q.estimateWait(i).Round(time.Second) / time.Second)
+			break
+		}
+	}
+	return c
+}
+
+// estimateWait estimates how long the pending item at index i waits for a
+// worker: the items ahead of it, and those running, are spread over the
+// workers, each taking the average duration of its action. Actions without a
+// finished item count as the average of the others. Callers hold q.mu.
+func (q *Queue) estimateWait(i int) time.Duration {
+	var fallback time.Duration
+	for _, d := range q.durations {
+		fallback += d
+	}
+	if len(q.durations) == 0 {
+		return 0
+	}
+	fallback /= time.Duration(len(q.durations))
+	cost := func(action string) time.Duration {
+		if d, ok := q.durations[action]; ok {
+			return d
+		}
+		return fallback
+	}
+
+	var total time.Duration
+	for _, b := range q.batches {
+		for _, item := range b.Items {
+			if item.Status == "running" {
+				// On average half done.
+				total += cost(b.Action) / 2
+			}
+		}
+	}
+	for _, t := range q.pending[:i] {
+		total += cost(t.batch.Action)
+	}
+	return total / time.Duration(q.workers)
+}
+
+// evict forgets the oldest finished batches beyond maxBatches. Callers hold
+// q.mu.
+func (q *Queue) evict() {
+	for i := 0; len(q.order) > maxBatches && i < len(q.order); {
+		id := q.order[i]
+		if q.batches[id].Status != "completed" {
+			i++
+			continue
+		}
+		delete(q.batches, id)
+		q.order = append(q.order[:i], q.order[i+1:]...)
+	}
+}
+
+// snapshot copies b so that callers can read it without holding the lock.
+func (b *Batch) snapshot() *Batch {
+	c := *b
+	c.Items = append([]ItemResult(nil), b.Items...)
+	return &c
+}
+
+// newBatchID returns a random 16-character hex ID.
+func newBatchID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,217 @@
+package workqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitCompleted polls until every batch has completed.
+func waitCompleted(t *testing.T, q *Queue, batches ...*Batch) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, b := range batches {
+		for {
+			got, ok := q.Get(b.ID)
+			if !ok {
+				t.Fatalf("batch %s not found", b.ID)
+			}
+			if got.Status == "completed" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("batch %s did not complete: %+v", b.ID, got)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	type submission struct {
+		priority Priority
+		tenants  []string
+	}
+	tests := []struct {
+		name        string
+		submissions []submission
+		want        []string
+	}{
+		{
+			name: "higher lanes first",
+			submissions: []submission{
+				{PriorityBulk, []string{"bulk"}},
+				{PriorityTrial, []string{"trial"}},
+				{PriorityPaid, []string{"paid"}},
+			},
+			want: []string{"paid", "trial", "bulk"},
+		},
+		{
+			name: "submission order within a lane",
+			submissions: []submission{
+				{PriorityTrial, []string{"t1", "t2"}},
+				{PriorityTrial, []string{"t3"}},
+			},
+			want: []string{"t1", "t2", "t3"},
+		},
+		{
+			name: "later paid batch moves ahead of earlier ones",
+			submissions: []submission{
+				{PriorityBulk, []string{"b1", "b2"}},
+				{PriorityPaid, []string{"p1"}},
+				{PriorityTrial, []string{"t1"}},
+				{PriorityPaid, []string{"p2"}},
+			},
+			want: []string{"p1", "p2", "t1", "b1", "b2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(1, 0, time.Minute)
+			var mu sync.Mutex
+			var got []string
+			record := func(_ context.Context, item Item) error {
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, item.TenantID)
+				return nil
+			}
+			var batches []*Batch
+			for _, s := range tt.submissions {
+				items := make([]Item, len(s.tenants))
+				for i, id := range s.tenants {
+					items[i] = Item{TenantID: id}
+				}
+				batches = append(batches, q.Submit("restart", s.priority, items, record))
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go q.Run(ctx)
+			waitCompleted(t, q, batches...)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(got) != len(tt.want) {
+				t.Fatalf("ran %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("ran %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueuePosition(t *testing.T) {
+	q := New(1, 0, time.Minute)
+	noop := func(context.Context, Item) error { return nil }
+	bulk := q.Submit("restart", PriorityBulk, []Item{{TenantID: "a"}, {TenantID: "b"}}, noop)
+	paid := q.Submit("restart", PriorityPaid, []Item{{TenantID: "c"}}, noop)
+	empty := q.Submit("restart", PriorityPaid, nil, noop)
+
+	tests := []struct {
+		name   string
+		id     string
+		want   int
+		status string
+	}{
+		{"bulk batch behind the paid one", bulk.ID, 2, "running"},
+		{"paid batch first", paid.ID, 1, "running"},
+		{"empty batch already completed", empty.ID, 0, "completed"},
+	}
+	for _, tt := range tests {
+		got, ok := q.Get(tt.id)
+		if !ok {
+			t.Fatalf("%s: batch not found", tt.name)
+		}
+		if got.QueuePosition != tt.want || got.Status != tt.status {
+			t.Errorf("%s: position %d, status %s; want %d, %s", tt.name, got.QueuePosition, got.Status, tt.want, tt.status)
+		}
+	}
+	if d := q.Depth(); d != 3 {
+		t.Errorf("Depth() = %d, want 3", d)
+	}
+}
+
+func TestNextSkipsTenantsAtLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		perTenant int
+		pending   []string
+		running   map[string]int
+		want      int
+	}{
+		{"no limit", 0, []string{"a", "b"}, map[string]int{"a": 5}, 0},
+		{"below limit", 2, []string{"a", "b"}, map[string]int{"a": 1}, 0},
+		{"skips a tenant at its limit", 1, []string{"a", "a", "b"}, map[string]int{"a": 1}, 2},
+		{"every tenant at its limit", 1, []string{"a", "b"}, map[string]int{"a": 1, "b": 1}, -1},
+		{"nothing pending", 1, nil, map[string]int{}, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(1, tt.perTenant, time.Minute)
+			b := &Batch{}
+			for i, id := range tt.pending {
+				b.Items = append(b.Items, ItemResult{Item: Item{TenantID: id}})
+				q.pending = append(q.pending, task{batch: b, index: i})
+			}
+			q.running = tt.running
+			if got := q.next(); got != tt.want {
+				t.Errorf("next() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerTenantLimit(t *testing.T) {
+	q := New(2, 1, time.Minute)
+	bStarted := make(chan struct{})
+	var mu sync.Mutex
+	var started []string
+	fn := func(ctx context.Context, item Item) error {
+		mu.Lock()
+		started = append(started, item.Instance)
+		mu.Unlock()
+		switch item.Instance {
+		case "a1":
+			// Holds tenant a's only slot until the second worker has
+			// skipped a2 for b1.
+			select {
+			case <-bStarted:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(5 * time.Second):
+			}
+		case "b1":
+			close(bStarted)
+		}
+		return nil
+	}
+	batch := q.Submit("restart", PriorityPaid, []Item{
+		{TenantID: "a", Instance: "a1"},
+		{TenantID: "a", Instance: "a2"},
+		{TenantID: "b", Instance: "b1"},
+	}, fn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+	waitCompleted(t, q, batch)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"a1", "b1", "a2"}
+	for i := range want {
+		if i >= len(started) || started[i] != want[i] {
+			t.Fatalf("started %v, want %v", started, want)
+		}
+	}
+	select {
+	case <-bStarted:
+	default:
+		t.Fatal("b1 never ran while a1 held tenant a's slot")
+	}
+}